@@ -0,0 +1,171 @@
+// Command fake-agent simulates a deployment agent without any Docker hosts.
+// It claims pending deployments, uploads a short log for each, waits a
+// random rollout time and reports it deployed or, at the configured rate,
+// failed with one of the well-known failure codes. Run several with
+// different -id values to load test the controller or demo the lifecycle.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/pkg/client"
+)
+
+// failureCodes are the failures a simulated rollout may end in
+var failureCodes = []string{models.FailureImagePull, models.FailurePortInUse, models.FailureHealthCheckTimeout}
+
+// agent claims and rolls out deployments against one controller
+type agent struct {
+	client *client.Client
+	logger *slog.Logger
+
+	domain      string
+	batch       int
+	minLatency  time.Duration
+	maxLatency  time.Duration
+	failureRate float64
+
+	// rng is shared by the rollouts, so it is guarded by mu
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "controller base URL")
+	token := flag.String("token", os.Getenv("CONTROLLER_API_TOKEN"), "API bearer token, for status updates")
+	agentToken := flag.String("agent-token", os.Getenv("CONTROLLER_AGENT_TOKEN"), "agent token")
+	id := flag.String("id", "", "agent ID sent as X-Agent-ID; defaults to fake-agent-<hostname>")
+	domain := flag.String("domain", "", "only claim deployments of this domain")
+	interval := flag.Duration("interval", 2*time.Second, "how often to claim pending deployments")
+	batch := flag.Int("batch", 5, "most deployments to claim at once (1-100)")
+	minLatency := flag.Duration("min-latency", time.Second, "shortest simulated rollout")
+	maxLatency := flag.Duration("max-latency", 5*time.Second, "longest simulated rollout")
+	failureRate := flag.Float64("failure-rate", 0.1, "fraction of rollouts that fail, from 0 to 1")
+	seed := flag.Uint64("seed", 0, "random seed, for repeatable runs; 0 picks one")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	if *batch < 1 || *batch > 100 || *minLatency < 0 || *maxLatency < *minLatency || *failureRate < 0 || *failureRate > 1 {
+		logger.Error("Invalid flags: need 1 <= batch <= 100, 0 <= min-latency <= max-latency and 0 <= failure-rate <= 1")
+		os.Exit(2)
+	}
+	if *id == "" {
+		hostname, _ := os.Hostname()
+		*id = "fake-agent-" + hostname
+	}
+	if *seed == 0 {
+		*seed = rand.Uint64()
+	}
+
+	a := &agent{
+		client: client.New(client.Config{
+			BaseURL:    *url,
+			Token:      *token,
+			AgentToken: *agentToken,
+			AgentID:    *id,
+		}),
+		logger:      logger.With("agent", *id),
+		domain:      *domain,
+		batch:       *batch,
+		minLatency:  *minLatency,
+		maxLatency:  *maxLatency,
+		failureRate: *failureRate,
+		rng:         rand.New(rand.NewPCG(*seed, *seed)),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	a.logger.Info("Starting fake agent", "url", *url, "domain", *domain, "failure_rate", *failureRate, "seed", *seed)
+	a.run(ctx, *interval)
+	a.logger.Info("Fake agent stopped")
+}
+
+// run claims deployments every interval and rolls each out concurrently,
+// waiting for the rollouts in flight once ctx is cancelled
+func (a *agent) run(ctx context.Context, interval time.Duration) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		claimed, err := a.client.Claim(ctx, a.domain, a.batch)
+		if err != nil && ctx.Err() == nil {
+			a.logger.Error("Failed to claim deployments", "error", err)
+		}
+		for _, d := range claimed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a.rollout(context.WithoutCancel(ctx), d)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollout simulates rolling out a claimed deployment and reports how it went
+func (a *agent) rollout(ctx context.Context, d client.Deployment) {
+	logger := a.logger.With("id", d.ID, "domain", d.Domain, "app_name", d.AppName, "version", d.Version)
+	logger.Info("Rolling out deployment")
+
+	a.mu.Lock()
+	latency := a.minLatency + time.Duration(a.rng.Int64N(int64(a.maxLatency-a.minLatency)+1))
+	failed := a.rng.Float64() < a.failureRate
+	code := failureCodes[a.rng.IntN(len(failureCodes))]
+	a.mu.Unlock()
+
+	// The agent endpoint resolves secret references, as a real agent's fetch
+	if _, err := a.client.GetAgentDeployment(ctx, d.ID); err != nil {
+		logger.Warn("Failed to fetch deployment", "error", err)
+	}
+
+	a.log(ctx, logger, d, 0, fmt.Sprintf("Pulling %s\n", d.DockerImage))
+	time.Sleep(latency)
+
+	update := client.StatusUpdate{Status: "deployed"}
+	if failed {
+		update = client.StatusUpdate{Status: "failed", ErrorCode: code, ErrorMessage: "simulated " + code}
+		a.log(ctx, logger, d, 1, fmt.Sprintf("Rollout failed: %s\n", code))
+	} else {
+		a.log(ctx, logger, d, 1, fmt.Sprintf("Started on port %d after %s\n", d.Port, latency.Round(time.Millisecond)))
+	}
+
+	// The claim's response is the version this rollout is based on
+	if _, err := a.client.UpdateStatus(ctx, d.ID, update, d.ETag()); err != nil {
+		logger.Error("Failed to report status", "status", update.Status, "error", err)
+		return
+	}
+	logger.Info("Reported status", "status", update.Status, "error_code", update.ErrorCode, "latency", latency)
+
+	if !failed {
+		state := client.ObservedStateRequest{DeploymentID: &d.ID, DockerImage: d.DockerImage, Replicas: 1}
+		if _, err := a.client.ReportObservedState(ctx, d.Domain, d.AppName, state); err != nil {
+			logger.Warn("Failed to report observed state", "error", err)
+		}
+	}
+}
+
+// log uploads a chunk of a deployment's log, logging rather than failing
+// the rollout when the upload fails
+func (a *agent) log(ctx context.Context, logger *slog.Logger, d client.Deployment, seq int64, content string) {
+	if _, err := a.client.UploadLog(ctx, d.ID, seq, content); err != nil {
+		logger.Warn("Failed to upload log", "seq", seq, "error", err)
+	}
+}
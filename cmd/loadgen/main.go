@@ -0,0 +1,268 @@
+// Command loadgen pushes synthetic deployments to a controller at a fixed
+// rate and reports the latency percentiles of the pushes, so capacity
+// planning runs are repeatable. Pushes are sent open-loop: a slow controller
+// doesn't slow the offered rate down, up to -concurrency pushes in flight.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"deployment-controller/pkg/client"
+)
+
+// generator builds realistic push batches: a fixed fleet of apps spread
+// over a few domains, each push rolling some of them to a new image tag
+type generator struct {
+	rng      *rand.Rand
+	domains  int
+	apps     int
+	batch    int
+	envVars  int
+	versions map[int]int
+}
+
+// next returns the next push batch
+func (g *generator) next() []client.DeploymentRequest {
+	batch := make([]client.DeploymentRequest, 0, g.batch)
+	for _, app := range g.rng.Perm(g.apps)[:g.batch] {
+		g.versions[app]++
+		name := fmt.Sprintf("svc-%03d", app)
+
+		env := make([]string, 0, g.envVars)
+		for i := range g.envVars {
+			env = append(env, fmt.Sprintf("SETTING_%02d=%x", i, g.rng.Uint32()))
+		}
+		batch = append(batch, client.DeploymentRequest{
+			Domain:      fmt.Sprintf("app%d.loadgen.test", app%g.domains),
+			AppName:     name,
+			DockerImage: fmt.Sprintf("registry.example.com/%s:1.%d.0", name, g.versions[app]),
+			Port:        8000 + app%1000,
+			Env:         env,
+		})
+	}
+	return batch
+}
+
+// result is the outcome of one push
+type result struct {
+	latency time.Duration
+
+	// status is the HTTP status of the push, or 0 when it got none
+	status int
+}
+
+// Report summarizes a run
+type Report struct {
+	Duration   time.Duration  `json:"duration_ns"`
+	Sent       int            `json:"sent"`
+	Dropped    int            `json:"dropped"`
+	Throughput float64        `json:"throughput_per_second"`
+	Statuses   map[string]int `json:"statuses"`
+	P50        time.Duration  `json:"p50_ns"`
+	P90        time.Duration  `json:"p90_ns"`
+	P95        time.Duration  `json:"p95_ns"`
+	P99        time.Duration  `json:"p99_ns"`
+	Max        time.Duration  `json:"max_ns"`
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "controller base URL")
+	token := flag.String("token", os.Getenv("CONTROLLER_API_TOKEN"), "API bearer token")
+	rate := flag.Float64("rate", 10, "pushes per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send pushes")
+	concurrency := flag.Int("concurrency", 50, "most pushes in flight; pushes due beyond it are dropped")
+	domains := flag.Int("domains", 5, "domains the apps are spread over")
+	apps := flag.Int("apps", 100, "apps in the simulated fleet")
+	batch := flag.Int("batch", 1, "apps per push")
+	envVars := flag.Int("env", 10, "env vars per app")
+	seed := flag.Uint64("seed", 1, "random seed, for repeatable traffic")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	if *rate <= 0 || *duration <= 0 || *concurrency < 1 || *domains < 1 || *apps < 1 || *batch < 1 || *batch > *apps || *envVars < 0 {
+		logger.Error("Invalid flags: rate, duration, concurrency, domains and apps must be positive and 1 <= batch <= apps")
+		os.Exit(2)
+	}
+
+	gen := &generator{
+		rng:      rand.New(rand.NewPCG(*seed, *seed)),
+		domains:  *domains,
+		apps:     *apps,
+		batch:    *batch,
+		envVars:  *envVars,
+		versions: map[int]int{},
+	}
+	// Retries would hide the latency of failed attempts
+	c := client.New(client.Config{BaseURL: *url, Token: *token, MaxRetries: -1})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("Starting load generation", "url", *url, "rate", *rate, "duration", duration.String(), "apps", *apps, "batch", *batch)
+	report := run(ctx, c, gen, *rate, *duration, *concurrency)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			logger.Error("Failed to write report", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printReport(report)
+}
+
+// run sends pushes at rate until duration passes or ctx is cancelled, then
+// waits for the pushes in flight and summarizes them
+func run(ctx context.Context, c *client.Client, gen *generator, rate float64, duration time.Duration, concurrency int) Report {
+	results := make(chan result, concurrency)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var collected []result
+	done := make(chan struct{})
+	go func() {
+		for r := range results {
+			collected = append(collected, r)
+		}
+		close(done)
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	dropped := 0
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			dropped++
+			continue
+		}
+
+		batch := gen.next()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results <- push(c, batch)
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+	<-done
+	return summarize(collected, dropped, time.Since(start))
+}
+
+// push sends one batch, outliving the run's deadline so the last pushes
+// are measured in full
+func push(c *client.Client, batch []client.DeploymentRequest) result {
+	start := time.Now()
+	pushed, err := c.Push(context.Background(), batch, client.PushOptions{})
+	r := result{latency: time.Since(start)}
+
+	var apiErr *client.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		r.status = apiErr.StatusCode
+	case err != nil:
+	case pushed.FailedCount > 0:
+		r.status = http.StatusPartialContent
+	default:
+		r.status = http.StatusCreated
+	}
+	return r
+}
+
+// summarize computes the report of a run's pushes
+func summarize(results []result, dropped int, elapsed time.Duration) Report {
+	report := Report{
+		Duration: elapsed,
+		Sent:     len(results),
+		Dropped:  dropped,
+		Statuses: map[string]int{},
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(results)) / elapsed.Seconds()
+	}
+
+	latencies := make([]time.Duration, 0, len(results))
+	for _, r := range results {
+		key := strconv.Itoa(r.status)
+		if r.status == 0 {
+			key = "error"
+		}
+		report.Statuses[key]++
+		latencies = append(latencies, r.latency)
+	}
+	slices.Sort(latencies)
+
+	report.P50 = percentile(latencies, 50)
+	report.P90 = percentile(latencies, 90)
+	report.P95 = percentile(latencies, 95)
+	report.P99 = percentile(latencies, 99)
+	if len(latencies) > 0 {
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.5)
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// printReport writes the report as text
+func printReport(r Report) {
+	fmt.Printf("duration    %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Printf("sent        %d (%.1f/s)\n", r.Sent, r.Throughput)
+	fmt.Printf("dropped     %d\n", r.Dropped)
+
+	statuses := make([]string, 0, len(r.Statuses))
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		fmt.Printf("status %-5s%d\n", status, r.Statuses[status])
+	}
+
+	for _, p := range []struct {
+		name  string
+		value time.Duration
+	}{{"p50", r.P50}, {"p90", r.P90}, {"p95", r.P95}, {"p99", r.P99}, {"max", r.Max}} {
+		fmt.Printf("%-12s%s\n", p.name, p.value.Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/redact"
+)
+
+// commandTimeout bounds a subcommand run from the command line
+const commandTimeout = 30 * time.Minute
+
+// runCommand runs a subcommand of the server binary, returning its exit code
+func runCommand(name string, args []string) int {
+	var run func(ctx context.Context, h *handlers.Handler, args []string) error
+	var remote func(ctx context.Context, cfg *config.Config, args []string) error
+	switch name {
+	case "backup":
+		run = runBackup
+	case "restore":
+		run = runRestore
+	case "seed":
+		run = runSeed
+	case "selftest":
+		remote = runSelftest
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q; usage: deployment-controller [backup|restore|seed|selftest] [flags]\n", name)
+		return 2
+	}
+
+	// Log to stderr so a backup can be written to stdout
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level:       slog.LevelInfo,
+		ReplaceAttr: redact.New(redact.DefaultPatterns).ReplaceAttr,
+	}))
+
+	cfg, err := config.Load("")
+	if err != nil {
+		logger.Error("Failed to load configuration", "error", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// Remote commands talk to a running instance over its API, so they
+	// don't open the database
+	if remote != nil {
+		if err := remote(ctx, cfg, args); err != nil {
+			logger.Error("Command failed", "command", name, "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := run(ctx, handlers.New(db, logger, cfg), args); err != nil {
+		logger.Error("Command failed", "command", name, "error", err)
+		return 1
+	}
+	return 0
+}
+
+// runBackup writes a backup to a file, stdout or the blob store
+func runBackup(ctx context.Context, h *handlers.Handler, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the backup to, or - for stdout")
+	blob := flags.Bool("blob", false, "write the backup to the blob store instead")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	backup, err := h.CreateBackup(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *blob {
+		archived, err := h.WriteBackup(ctx, backup)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "backup written to", archived.Key)
+		return nil
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return json.NewEncoder(out).Encode(backup)
+}
+
+// runRestore restores a backup from a file, stdin or the blob store
+func runRestore(ctx context.Context, h *handlers.Handler, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "-", "file to read the backup from, or - for stdin")
+	key := flags.String("key", "", "blob store key of the backup to restore instead")
+	conflicts := flags.String("conflicts", models.RestoreSkip, "rows conflicting with existing ones: skip or fail")
+	dryRun := flags.Bool("dry-run", false, "report what would be restored without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var backup *models.Backup
+	if *key != "" {
+		var err error
+		if backup, err = h.ReadBackup(ctx, *key); err != nil {
+			return err
+		}
+	} else {
+		in := io.Reader(os.Stdin)
+		if *input != "-" {
+			f, err := os.Open(*input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		backup = &models.Backup{}
+		if err := json.NewDecoder(in).Decode(backup); err != nil {
+			return fmt.Errorf("invalid backup document: %w", err)
+		}
+	}
+
+	result, restoreErr := h.RestoreBackup(ctx, backup, *conflicts, *dryRun)
+	if result != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	return restoreErr
+}
@@ -1,26 +1,63 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"deployment-controller/internal/auth"
+	"deployment-controller/internal/cache"
 	"deployment-controller/internal/config"
+	"deployment-controller/internal/cors"
 	"deployment-controller/internal/database"
 	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/jobs"
+	"deployment-controller/internal/leader"
+	"deployment-controller/internal/localpg"
+	"deployment-controller/internal/logstream"
+	"deployment-controller/internal/memstore"
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/redact"
+	"deployment-controller/internal/worker"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// backend is the store the server runs on, with the notifications and
+// locks its background subsystems need: PostgreSQL, or the in-memory store
+// with --dev
+type backend interface {
+	database.Store
+	Listen(ctx context.Context, channel string, onNotify func(payload string), logger *slog.Logger)
+	Exclusive(name string, logger *slog.Logger, fn func(ctx context.Context) error) func(ctx context.Context) error
+	Close()
+}
+
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	dev := flag.Bool("dev", false, "run on an in-memory store instead of PostgreSQL; all data is lost on restart")
+	local := flag.Bool("local", false, "start PostgreSQL from the installed binaries in database.local.data_dir and run on it")
+	flag.Parse()
+
 	// Setup logger
-	logger := setupLogger()
+	logger := setupLogger(redact.New(redact.DefaultPatterns))
 
 	// Load configuration
 	cfg, err := config.Load("")
@@ -28,6 +65,7 @@ func main() {
 		logger.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	logger = setupLogger(redact.New(cfg.Security.RedactPatterns))
 
 	// Set Gin mode based on log level
 	if cfg.Server.LogLevel == "debug" {
@@ -37,33 +75,166 @@ func main() {
 	}
 
 	// Initialize database
-	db, err := database.New(cfg)
+	db, err := openBackend(cfg, *dev, *local, logger)
 	if err != nil {
 		logger.Error("Failed to initialize database", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	logger.Info("Database connection established", "max_conns", cfg.Database.MaxConns)
+	// Background subsystems are stopped when the server shuts down
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Cache the latest deployments list, invalidated by changes on any replica
+	store := cache.New(db, cfg.Cache.LatestDeploymentsTTL)
+	go db.Listen(bgCtx, database.DeploymentsChangedChannel, func(string) {
+		store.Invalidate("notify")
+	}, logger)
+
+	// Elect a leader among replicas to run the periodic tasks below
+	elector := leader.New(db, logger, cfg.Leader.InstanceID, cfg.Leader.LeaseTTL)
+	go elector.Run(bgCtx)
+
+	// Periodic tasks run only on the leader. Each run also takes an advisory
+	// lock, so an old and a new leader never overlap during a handover.
+	periodic := func(name string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+		return elector.LeaderOnly(db.Exclusive(name, logger, fn))
+	}
+
+	// Keep the materialized stats fresh
+	go worker.RunPeriodic(bgCtx, logger, "stats-refresh", cfg.Cache.StatsRefreshInterval,
+		periodic("stats-refresh", db.RefreshDeploymentStats))
+
+	// Precompute analytics so the analytics endpoints never scan deployments
+	go worker.RunPeriodic(bgCtx, logger, "analytics", cfg.Cache.AnalyticsRefreshInterval,
+		periodic("analytics", db.RefreshAnalytics))
 
 	// Initialize handlers
-	h := handlers.New(db, logger)
+	h := handlers.New(store, logger, cfg)
+	h.SetElector(elector)
+
+	// Wake deployment log streams on uploads to any replica
+	logHub := logstream.New()
+	h.SetLogHub(logHub)
+
+	// Accepted bearer tokens, reloaded on SIGHUP so they rotate without a
+	// restart
+	tokens := auth.New(cfg.Security, "")
+	h.SetTokens(tokens)
+	go reloadTokensOnHangup(bgCtx, tokens, logger)
+	go db.Listen(bgCtx, database.DeploymentLogsChannel, logHub.Notify, logger)
+
+	// Process queued background jobs, woken by inserts on any replica
+	pool := jobs.NewPool(store, logger, cfg.Jobs.Workers, cfg.Jobs.Concurrency, cfg.Jobs.PollInterval, cfg.Jobs.Lease,
+		jobs.Retry{MaxAttempts: cfg.Jobs.MaxAttempts, Backoff: cfg.Jobs.RetryBackoff})
+	pool.Register(models.JobTypePush, h.RunPushJob)
+	pool.Register(models.JobTypeImageUpdate, h.RunImageUpdateJob)
+	pool.Register(models.JobTypeWebhook, h.RunWebhookJob)
+	pool.Register(models.JobTypeRetention, handlers.RunSweepJob(h.RunRetention))
+	pool.Register(models.JobTypeOrphans, handlers.RunSweepJob(h.RunOrphanCheck))
+	if cfg.GitSync.Repo != "" && cfg.Features.Enabled(config.FeatureGitOps) {
+		pool.Register(models.JobTypeGitSync, h.RunGitSyncJob)
+	}
+	go db.Listen(bgCtx, database.JobsChannel, pool.Notify, logger)
+	go db.Listen(bgCtx, database.JobsCancelledChannel, pool.Cancel, logger)
+	go pool.Run(bgCtx)
+
+	// Redeploy apps whose cron schedule is due
+	go worker.RunPeriodic(bgCtx, logger, "schedules", cfg.Schedules.Interval,
+		periodic("schedules", h.RunSchedules))
+
+	// Reset failed deployments to pending once their retry backoff elapses
+	go worker.RunPeriodic(bgCtx, logger, "retries", cfg.Schedules.Interval,
+		periodic("retries", h.RunRetries))
+
+	// Pull the git branch of deployment YAMLs and push what changed
+	if cfg.GitSync.Repo != "" && cfg.Features.Enabled(config.FeatureGitOps) {
+		go worker.RunPeriodic(bgCtx, logger, "git-sync", cfg.GitSync.Interval,
+			periodic("git-sync", h.RunGitSync))
+	}
+
+	// Deploy new images selected by the image policies
+	if cfg.Features.Enabled(config.FeatureImageUpdates) {
+		go worker.RunPeriodic(bgCtx, logger, "image-updates", cfg.Registry.ImageUpdateInterval,
+			periodic("image-updates", h.RunImageUpdates))
+	}
+
+	// Flag deployed mutable tags that moved to a new digest
+	go worker.RunPeriodic(bgCtx, logger, "digest-checks", cfg.Registry.DigestCheckInterval,
+		periodic("digest-checks", h.RunDigestChecks))
+
+	// Mark deployments stuck deploying or pending and alert on them
+	go worker.RunPeriodic(bgCtx, logger, "watchdog", cfg.Watchdog.Interval,
+		periodic("watchdog", h.RunWatchdog))
+
+	// Alert on apps whose deployments keep failing
+	go worker.RunPeriodic(bgCtx, logger, "failure-rate-alerts", cfg.Alerts.Interval,
+		periodic("failure-rate-alerts", h.RunFailureRateAlerts))
+
+	// Evaluate the operator-defined alert rules
+	go worker.RunPeriodic(bgCtx, logger, "alert-rules", cfg.Alerts.RulesInterval,
+		periodic("alert-rules", h.RunAlertRules))
+
+	// Health check deployments once agents report them deployed
+	if cfg.Verify.Enabled {
+		go worker.RunPeriodic(bgCtx, logger, "verification", cfg.Verify.Interval,
+			periodic("verification", h.RunVerification))
+	}
+
+	// Probe deployed apps so the deployments list shows their liveness
+	if cfg.Probes.Enabled {
+		go worker.RunPeriodic(bgCtx, logger, "health-probes", cfg.Probes.Interval,
+			periodic("health-probes", h.RunHealthProbes))
+	}
+
+	// Drop health probes older than the longest SLA window allowed
+	go worker.RunPeriodic(bgCtx, logger, "probe-retention", time.Hour,
+		periodic("probe-retention", h.RunHealthProbeRetention))
+
+	// Prune deployment logs, events and versions past their retention, as
+	// a job so the sweep is visible under /api/v1/jobs
+	go worker.RunPeriodic(bgCtx, logger, "retention", cfg.Retention.Interval,
+		periodic("retention", h.QueueSweep(models.JobTypeRetention)))
+
+	// Report, and with orphans.cleanup delete, data left inconsistent by
+	// deletions, as a job like the retention sweep
+	go worker.RunPeriodic(bgCtx, logger, "orphans", cfg.Orphans.Interval,
+		periodic("orphans", h.QueueSweep(models.JobTypeOrphans)))
+
+	// Smoke test newly deployed deployments
+	go worker.RunPeriodic(bgCtx, logger, "smoke-tests", cfg.Smoke.Interval,
+		periodic("smoke-tests", h.RunSmokeTests))
+
+	// Push per-app deployment metrics for Prometheus setups that can't
+	// scrape the controller
+	if cfg.Metrics.PushgatewayURL != "" {
+		go worker.RunPeriodic(bgCtx, logger, "metrics-push", cfg.Metrics.PushInterval,
+			periodic("metrics-push", h.RunMetricsPush))
+	}
 
 	// Setup router
-	router := setupRouter(h, cfg, logger)
+	router := setupRouter(h, cfg, tokens, logger)
 
 	// Create HTTP server
+	var handler http.Handler = router
+	if cfg.Server.H2C {
+		handler = h2c.NewHandler(router, &http2.Server{})
+	}
+
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:      router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Info("Starting server", "port", cfg.Server.Port)
+		logger.Info("Starting server", "port", cfg.Server.Port, "h2c", cfg.Server.H2C)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed to start server", "error", err)
 			os.Exit(1)
@@ -77,24 +248,122 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Fail health checks first, so load balancers route new requests to
+	// other replicas while we still serve the ones that arrive meanwhile
+	logger.Info("Draining server...", "drain_delay", cfg.Server.DrainDelay)
+	h.StartDrain()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	// Stop claiming jobs, renewing the leader lease and running periodic
+	// tasks
 	logger.Info("Shutting down server...")
+	stopBackground()
 
-	// The context is used to inform the server it has 30 seconds to finish
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// The context is used to inform the server how long it has to finish
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	// Streams still open at the deadline are cut off, but we carry on so
+	// jobs are checkpointed and the lease released before exiting
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", "error", err)
-		os.Exit(1)
+		server.Close()
 	}
 
+	// Let running jobs finish; no new ones are claimed after stopBackground.
+	// Jobs still running at the deadline are requeued for another replica.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Jobs.DrainTimeout)
+	defer cancelDrain()
+	pool.Drain(drainCtx)
+
+	// Wait for the leader lease to be released so another replica takes
+	// over without waiting for it to expire
+	leaseCtx, cancelLease := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelLease()
+	elector.Wait(leaseCtx)
+
 	logger.Info("Server exited")
 }
 
-func setupLogger() *slog.Logger {
-	// Create JSON logger for production
+// reloadTokensOnHangup reloads the accepted tokens from the config file on
+// every SIGHUP until ctx is done
+func reloadTokensOnHangup(ctx context.Context, tokens *auth.Tokens, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			counts, err := tokens.Reload()
+			if err != nil {
+				logger.Error("Failed to reload tokens, keeping the current ones", "error", err)
+				continue
+			}
+			logger.Info("Reloaded tokens on SIGHUP", "api", counts.API, "reveal", counts.Reveal, "agent", counts.Agent)
+		}
+	}
+}
+
+// localBackend is the database on a PostgreSQL server started with --local,
+// which is stopped once the database is closed
+type localBackend struct {
+	*database.DB
+	server *localpg.Server
+}
+
+// Close closes the connection pool, then stops the server
+func (b *localBackend) Close() {
+	b.DB.Close()
+	b.server.Stop()
+}
+
+// openBackend connects to PostgreSQL. With dev it creates an empty in-memory
+// store so the server runs without a database; with local it first starts
+// a PostgreSQL server of its own.
+func openBackend(cfg *config.Config, dev, local bool, logger *slog.Logger) (backend, error) {
+	if dev && local {
+		return nil, fmt.Errorf("--dev and --local are mutually exclusive")
+	}
+	if local {
+		server, err := localpg.Start(context.Background(), cfg.Database, logger)
+		if err != nil {
+			return nil, err
+		}
+		server.Configure(&cfg.Database)
+
+		db, err := database.New(cfg)
+		if err != nil {
+			server.Stop()
+			return nil, err
+		}
+		logger.Info("Database connection established", "max_conns", cfg.Database.MaxConns, "local", true)
+		return &localBackend{DB: db, server: server}, nil
+	}
+	if dev {
+		store, err := memstore.New(cfg.Database.IDVersion)
+		if err != nil {
+			return nil, err
+		}
+		logger.Warn("Running in development mode on an in-memory store; all data is lost on restart")
+		return store, nil
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Database connection established", "max_conns", cfg.Database.MaxConns)
+	return db, nil
+}
+
+func setupLogger(redactor *redact.Redactor) *slog.Logger {
+	// Create JSON logger for production; sensitive env values are masked
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level:       slog.LevelInfo,
+		ReplaceAttr: redactor.ReplaceAttr,
 	}
 
 	handler := slog.NewJSONHandler(os.Stdout, opts)
@@ -104,39 +373,212 @@ func setupLogger() *slog.Logger {
 	return logger
 }
 
-func setupRouter(h *handlers.Handler, cfg *config.Config, logger *slog.Logger) *gin.Engine {
+func setupRouter(h *handlers.Handler, cfg *config.Config, tokens *auth.Tokens, logger *slog.Logger) *gin.Engine {
 	router := gin.New()
 
 	// Middleware
 	router.Use(gin.Recovery())
 	router.Use(requestLoggingMiddleware(logger))
 
-	// Optional bearer token authentication
-	if cfg.Security.BearerToken != "" {
-		router.Use(authMiddleware(cfg.Security.BearerToken, logger))
-	}
+	// CORS comes before authentication: preflights carry no credentials,
+	// and browsers only show rejections that carry CORS headers
+	router.Use(corsMiddleware(cors.New(cfg.Server.CORS), logger))
+
+	// Callers presenting the reveal token see unredacted env values
+	router.Use(revealScopeMiddleware(tokens))
 
-	// CORS middleware
-	router.Use(corsMiddleware())
+	// Optional bearer token authentication
+	router.Use(authMiddleware(tokens, logger))
 
 	// Health check endpoint (no auth required)
 	router.GET("/healthz", h.HealthCheck)
 
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// API routes
 	v1 := router.Group("/api/v1")
+	v1.Use(drainMiddleware(h, cfg.Server.DrainRetryAfter, logger))
+	v1.Use(concurrencyLimitMiddleware(cfg.Server.Concurrency, logger))
+	v1.Use(bodyLimitMiddleware(cfg.Server.BodyLimits, logger))
 	{
 		// Deployment endpoints
 		v1.POST("/push", h.Push)
-		v1.GET("/deployments", h.GetDeployments)
+		v1.POST("/requests/:request_id/replay", h.ReplayPush)
+		v1.GET("/deployments", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.GetDeployments)
 		v1.GET("/deployments/:id", h.GetDeployment)
+		v1.GET("/deployments/:id/history", h.GetDeploymentHistory)
+		v1.GET("/deployments/:id/events", h.GetDeploymentEvents)
+		v1.POST("/deployments/:id/rollback", h.RollbackDeployment)
+		v1.POST("/deployments/:id/events/replay", h.ReplayDeploymentEvents)
+		v1.GET("/deployments/:id/manifests", h.GetDeploymentManifest)
+		v1.GET("/deployments/:id/manifests/snapshots", h.ListManifestSnapshots)
+		v1.GET("/deployments/:id/manifests/snapshots/:snapshot_id", h.GetManifestSnapshot)
+		v1.GET("/deployments/:id/bundle", h.GetDeploymentBundle)
+		v1.GET("/deployments/:id/checks", h.GetDeploymentChecks)
+		v1.POST("/deployments/:id/checks", h.ReportDeploymentChecks)
 		v1.PATCH("/deployments/:id/status", h.UpdateDeploymentStatus)
+		v1.DELETE("/deployments/:id", h.DeleteDeployment)
+		v1.GET("/deployments/:id/smoke-test", h.GetSmokeTestResult)
+		v1.GET("/deployments/:id/logs", h.GetDeploymentLogs)
+		v1.POST("/deployments/:id/logs", h.UploadDeploymentLog)
+		v1.GET("/deployments/:id/logs/stream", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.StreamDeploymentLogs)
 
 		// Registry endpoints
 		v1.POST("/registry", h.StoreRegistryCredential)
 		v1.GET("/registry", h.GetRegistryCredential)
+		v1.GET("/registry/access", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.GetRegistryAccessLog)
+
+		// Declarative endpoints addressing apps and registries by stable
+		// IDs, for infrastructure-as-code clients such as Terraform
+		v1.GET("/apps", h.ListApps)
+		v1.GET("/apps/:domain/:app_name", h.GetApp)
+		v1.PUT("/apps/:domain/:app_name", h.PutApp)
+		v1.GET("/apps/:domain/:app_name/observed", h.GetAppComparison)
+		v1.GET("/apps/:domain/:app_name/incidents", h.ListAppIncidents)
+		v1.GET("/apps/:domain/:app_name/maintenance", h.GetMaintenance)
+		v1.PATCH("/apps/:domain/:app_name/maintenance", h.SetMaintenance)
+		v1.GET("/maintenance", h.ListMaintenance)
+		v1.GET("/observed", h.ListAppComparisons)
+		v1.GET("/incidents", h.ListIncidents)
+		v1.GET("/registries", h.ListRegistries)
+		v1.GET("/registries/:registry", h.GetRegistry)
+		v1.PUT("/registries/:registry", h.PutRegistry)
+		v1.DELETE("/registries/:registry", h.DeleteRegistry)
+
+		// Secret endpoints
+		v1.POST("/secrets", h.CreateSecret)
+		v1.GET("/secrets", h.ListSecrets)
+		v1.GET("/secrets/:project/:name", h.GetSecret)
+		v1.PUT("/secrets/:project/:name", h.UpdateSecret)
+		v1.DELETE("/secrets/:project/:name", h.DeleteSecret)
+		v1.GET("/secrets/:project/:name/versions", h.ListSecretVersions)
+		v1.GET("/secrets/:project/:name/impact", h.GetSecretImpact)
+		v1.GET("/secrets/:project/:name/access", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.GetSecretAccessLog)
+		v1.POST("/secrets/:project/:name/rotate", h.RotateSecret)
+
+		// Envelope encryption key management
+		v1.POST("/encryption/data-keys", h.GenerateDataKey)
+		v1.POST("/encryption/reencrypt", h.ReencryptSecrets)
+
+		// Public key for sealing env and secret values client-side
+		v1.GET("/sealing/public-key", h.GetSealingKey)
+
+		// Agent endpoints, authenticated with the agent token
+		agent := v1.Group("/agent")
+		agent.Use(agentAuthMiddleware(tokens, logger))
+		agent.GET("/deployments/:id", h.GetAgentDeployment)
+		agent.GET("/deployments/:id/manifest", h.GetAgentManifest)
+		agent.GET("/pending", h.ListPendingDeployments)
+		agent.POST("/claim", h.ClaimDeployments)
+		agent.POST("/apps/:domain/:app_name/observed", h.ReportObservedState)
+		agent.POST("/apps/:domain/:app_name/probes", h.ReportHealthProbe)
+		agent.GET("/health-checks", h.ListHealthChecks)
+		agent.GET("/smoke-tests", h.ListAgentSmokeTests)
+		agent.POST("/deployments/:id/smoke-test", h.ReportSmokeTest)
+		agent.POST("/deployments/:id/logs", h.UploadDeploymentLog)
+
+		// Cron schedule endpoints
+		v1.GET("/schedules", h.ListSchedules)
+		v1.GET("/schedules/:domain/:app_name", h.GetSchedule)
+		v1.PUT("/schedules/:domain/:app_name", h.PutSchedule)
+		v1.DELETE("/schedules/:domain/:app_name", h.DeleteSchedule)
+		v1.POST("/schedules/:domain/:app_name/pause", h.PauseSchedule)
+		v1.POST("/schedules/:domain/:app_name/resume", h.ResumeSchedule)
+		v1.POST("/schedules/:domain/:app_name/trigger", h.TriggerSchedule)
+
+		// Retry policy endpoints
+		v1.GET("/retry-policies/:domain/:app_name", h.GetRetryPolicy)
+		v1.PUT("/retry-policies/:domain/:app_name", h.PutRetryPolicy)
+		v1.DELETE("/retry-policies/:domain/:app_name", h.DeleteRetryPolicy)
+
+		// Rollout limit endpoints; a limit without an app name is domain-wide
+		v1.GET("/rollout-limits", h.ListRolloutLimits)
+		v1.PUT("/rollout-limits/:domain", h.PutRolloutLimit)
+		v1.DELETE("/rollout-limits/:domain", h.DeleteRolloutLimit)
+		v1.PUT("/rollout-limits/:domain/:app_name", h.PutRolloutLimit)
+		v1.DELETE("/rollout-limits/:domain/:app_name", h.DeleteRolloutLimit)
+
+		// Image policy endpoints
+		v1.GET("/image-policies", h.ListImagePolicies)
+		v1.GET("/image-policies/:domain/:app_name", h.GetImagePolicy)
+		v1.PUT("/image-policies/:domain/:app_name", h.PutImagePolicy)
+		v1.DELETE("/image-policies/:domain/:app_name", h.DeleteImagePolicy)
+		v1.GET("/image-digests", h.ListImageDigests)
+
+		// Alert rule endpoints
+		v1.GET("/alert-rules", h.ListAlertRules)
+		v1.GET("/alert-rules/:name", h.GetAlertRule)
+		v1.PUT("/alert-rules/:name", h.PutAlertRule)
+		v1.DELETE("/alert-rules/:name", h.DeleteAlertRule)
+		v1.POST("/alert-rules/:name/silence", h.SilenceAlertRule)
+		v1.DELETE("/alert-rules/:name/silence", h.UnsilenceAlertRule)
+		v1.GET("/alerts", h.ListRuleAlerts)
+		v1.POST("/alerts/:name/:domain/:app_name/ack", h.AcknowledgeRuleAlert)
+
+		// Health check endpoints
+		v1.GET("/health-checks", h.ListHealthChecks)
+		v1.GET("/health-checks/:domain/:app_name", h.GetHealthCheck)
+		v1.PUT("/health-checks/:domain/:app_name", h.PutHealthCheck)
+		v1.DELETE("/health-checks/:domain/:app_name", h.DeleteHealthCheck)
+
+		// Smoke test endpoints
+		v1.GET("/smoke-tests/:domain/:app_name", h.GetSmokeTest)
+		v1.PUT("/smoke-tests/:domain/:app_name", h.PutSmokeTest)
+		v1.DELETE("/smoke-tests/:domain/:app_name", h.DeleteSmokeTest)
+
+		// Environment status rollup
+		v1.GET("/status", h.GetStatus)
 
 		// Stats endpoint
 		v1.GET("/stats", h.GetStats)
+		v1.GET("/stats/top", h.GetTopApps)
+		v1.GET("/stats/sla", h.GetSLAReport)
+		v1.GET("/stats/latency/:domain/:app_name", h.GetLatencyReport)
+
+		// Background job endpoints
+		v1.GET("/jobs", h.ListJobs)
+		v1.GET("/jobs/:id", h.GetJob)
+		v1.POST("/jobs/:id/cancel", h.CancelJob)
+		v1.POST("/jobs/:id/retry", h.RetryJob)
+
+		// Admin endpoints
+		v1.GET("/version", h.GetVersion)
+		v1.GET("/admin/leader", h.GetLeader)
+		v1.POST("/admin/tokens/reload", h.ReloadTokens)
+		v1.POST("/admin/deployments/requeue", h.RequeueDeployments)
+		v1.GET("/admin/retention", h.GetRetention)
+		v1.GET("/admin/orphans", h.GetOrphans)
+		v1.POST("/admin/orphans/cleanup", h.CleanOrphans)
+		v1.GET("/admin/maintenance", h.GetHousekeeping)
+		v1.POST("/admin/maintenance", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.RunHousekeeping)
+		v1.GET("/admin/freeze", h.GetWriteFreeze)
+		v1.PATCH("/admin/freeze", h.SetWriteFreeze)
+		v1.GET("/admin/backup", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.Backup)
+		v1.POST("/admin/backup", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.ArchiveBackup)
+		v1.POST("/admin/restore", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.Restore)
+
+		// Analytics endpoints
+		v1.GET("/analytics/apps", h.GetAppAnalytics)
+		v1.GET("/analytics/trends", h.GetTrendAnalytics)
+		v1.GET("/analytics/dora", h.GetDoraAnalytics)
+		v1.GET("/analytics/failure-rates", h.GetFailureRates)
+
+		// Git sync endpoints
+		v1.GET("/git-sync", h.GetGitSync)
+		v1.POST("/reconcile", h.Reconcile)
+		v1.POST("/webhooks/git", h.GitWebhook)
+
+		// Registry push and delete webhooks, deploying through the image
+		// policies
+		v1.POST("/webhooks/dockerhub", h.DockerHubWebhook)
+		v1.POST("/webhooks/harbor", h.HarborWebhook)
+		v1.POST("/webhooks/registry", h.RegistryWebhook)
+
+		// State export/import endpoints
+		v1.GET("/export", streamTimeoutMiddleware(cfg.Server.StreamWriteTimeout, logger), h.Export)
+		v1.POST("/export/archive", h.ArchiveExport)
+		v1.POST("/import", h.Import)
 	}
 
 	return router
@@ -147,7 +589,7 @@ func requestLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 		Formatter: func(param gin.LogFormatterParams) string {
 			logger.Info("HTTP Request",
 				"method", param.Method,
-				"path", param.Path,
+				"path", redactToken(param.Path),
 				"status", param.StatusCode,
 				"latency", param.Latency,
 				"ip", param.ClientIP,
@@ -159,10 +601,26 @@ func requestLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 	})
 }
 
-func authMiddleware(bearerToken string, logger *slog.Logger) gin.HandlerFunc {
+// redactToken masks the token query parameter registry webhooks are
+// authenticated with, keeping it out of request logs
+func redactToken(path string) string {
+	u, err := url.Parse(path)
+	if err != nil || !u.Query().Has("token") {
+		return path
+	}
+	query := u.Query()
+	query.Set("token", "[REDACTED]")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// authMiddleware requires an accepted bearer token once any is configured
+func authMiddleware(tokens *auth.Tokens, logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Skip auth for health check
-		if c.Request.URL.Path == "/healthz" {
+		// Skip auth for health check; agent routes use the agent token and
+		// webhooks verify their own signatures
+		if !tokens.APIRequired() || c.Request.URL.Path == "/healthz" || strings.HasPrefix(c.Request.URL.Path, "/api/v1/agent/") ||
+			strings.HasPrefix(c.Request.URL.Path, "/api/v1/webhooks/") {
 			c.Next()
 			return
 		}
@@ -170,31 +628,223 @@ func authMiddleware(bearerToken string, logger *slog.Logger) gin.HandlerFunc {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			logger.Warn("Missing Authorization header", "path", c.Request.URL.Path)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Authorization header required",
-			})
+			handlers.RespondError(c, http.StatusUnauthorized, "Authorization header required")
 			c.Abort()
 			return
 		}
 
 		if !strings.HasPrefix(authHeader, "Bearer ") {
 			logger.Warn("Invalid Authorization header format", "path", c.Request.URL.Path)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Invalid Authorization header format",
-			})
+			handlers.RespondError(c, http.StatusUnauthorized, "Invalid Authorization header format")
 			c.Abort()
 			return
 		}
 
 		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token != bearerToken {
+		if !tokens.API(token) && !c.GetBool(handlers.RevealScopeKey) {
 			logger.Warn("Invalid bearer token", "path", c.Request.URL.Path)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"error":   "Invalid bearer token",
-			})
+			handlers.RespondError(c, http.StatusUnauthorized, "Invalid bearer token")
+			c.Abort()
+			return
+		}
+
+		if c.GetString(handlers.ActorKey) == "" {
+			c.Set(handlers.ActorKey, "api")
+		}
+
+		c.Next()
+	}
+}
+
+// revealScopeMiddleware grants the reveal scope to requests bearing the
+// reveal token; it does not reject anything itself
+func revealScopeMiddleware(tokens *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok && tokens.Reveal(token) {
+			c.Set(handlers.RevealScopeKey, true)
+			c.Set(handlers.ActorKey, "api:reveal")
+		}
+		c.Next()
+	}
+}
+
+// agentAuthMiddleware authenticates deployment agents, which may read
+// resolved secret values, with a token separate from the API bearer token
+func agentAuthMiddleware(tokens *auth.Tokens, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokens.AgentEnabled() {
+			handlers.RespondError(c, http.StatusServiceUnavailable, "Agent API is disabled: security.agent_token is not configured")
+			c.Abort()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || !tokens.Agent(token) {
+			logger.Warn("Invalid agent token", "path", c.Request.URL.Path)
+			handlers.RespondError(c, http.StatusUnauthorized, "Invalid agent token")
+			c.Abort()
+			return
+		}
+
+		// Agents share a token, so they name themselves for the audit trail
+		actor := "agent"
+		if id := c.GetHeader(handlers.AgentIDHeader); id != "" {
+			actor += ":" + id
+		}
+		c.Set(handlers.ActorKey, actor)
+
+		c.Next()
+	}
+}
+
+// pushRoutes are the bulk write endpoints limited by the push concurrency class
+var pushRoutes = map[string]bool{
+	"/api/v1/push":                        true,
+	"/api/v1/requests/:request_id/replay": true,
+	"/api/v1/import":                      true,
+	"/api/v1/admin/restore":               true,
+}
+
+// tailRoute is the log tail, an SSE stream held open for as long as the
+// client follows the logs; it has a concurrency class of its own so tails
+// never take the slots of short reads
+const tailRoute = "/api/v1/deployments/:id/logs/stream"
+
+// routeClass classifies a request for concurrency limiting
+func routeClass(c *gin.Context) string {
+	switch {
+	case pushRoutes[c.FullPath()]:
+		return "push"
+	case c.FullPath() == tailRoute:
+		return "tail"
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+		return "read"
+	default:
+		return "write"
+	}
+}
+
+// concurrencyLimitMiddleware caps in-flight requests per route class and
+// sheds excess load with 503 and Retry-After, so a burst of clients cannot
+// exhaust the database pool
+func concurrencyLimitMiddleware(cfg config.ConcurrencyConfig, logger *slog.Logger) gin.HandlerFunc {
+	slots := map[string]chan struct{}{}
+	for class, limit := range map[string]int{"push": cfg.Push, "write": cfg.Write, "read": cfg.Read, "tail": cfg.Tail} {
+		if limit > 0 {
+			slots[class] = make(chan struct{}, limit)
+		}
+	}
+	retryAfter := strconv.Itoa(int(cfg.RetryAfter.Round(time.Second).Seconds()))
+
+	return func(c *gin.Context) {
+		class := routeClass(c)
+		sem, limited := slots[class]
+		if !limited {
+			c.Next()
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			metrics.ShedRequests.WithLabelValues(class).Inc()
+			logger.Warn("Shedding request, concurrency limit reached", "class", class, "path", c.Request.URL.Path)
+			c.Header("Retry-After", retryAfter)
+			handlers.RespondError(c, http.StatusServiceUnavailable, "Server is busy, retry later")
+			c.Abort()
+			return
+		}
+
+		metrics.InFlightRequests.WithLabelValues(class).Inc()
+		defer func() {
+			<-sem
+			metrics.InFlightRequests.WithLabelValues(class).Dec()
+		}()
+
+		c.Next()
+	}
+}
+
+// bodyLimit returns the maximum body size allowed for a request
+func bodyLimit(c *gin.Context, cfg config.BodyLimitsConfig) int64 {
+	switch {
+	case pushRoutes[c.FullPath()]:
+		return cfg.Push
+	case c.FullPath() == "/api/v1/deployments/:id/status":
+		return cfg.Status
+	default:
+		return cfg.Default
+	}
+}
+
+// bodyLimitMiddleware rejects request bodies over the route's limit with 413.
+// The body is buffered up to the limit so oversized payloads are refused
+// before any decoding, whether or not Content-Length was sent.
+func bodyLimitMiddleware(cfg config.BodyLimitsConfig, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := bodyLimit(c, cfg)
+		tooLarge := func() {
+			logger.Warn("Request body too large", "path", c.Request.URL.Path, "limit", limit)
+			handlers.RespondError(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body exceeds the %d byte limit for this endpoint", limit))
+			c.Abort()
+		}
+
+		if c.Request.ContentLength > limit {
+			tooLarge()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body.Close()
+		if err != nil {
+			handlers.RespondError(c, http.StatusBadRequest, "Failed to read request body")
+			c.Abort()
+			return
+		}
+		if int64(len(body)) > limit {
+			tooLarge()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// streamRoutes are the GET endpoints that stream responses under
+// streamTimeoutMiddleware and may run for minutes
+var streamRoutes = map[string]bool{
+	"/api/v1/deployments":                   true,
+	"/api/v1/deployments/:id/logs/stream":   true,
+	"/api/v1/export":                        true,
+	"/api/v1/registry/access":               true,
+	"/api/v1/secrets/:project/:name/access": true,
+}
+
+// drainMiddleware asks clients to reconnect, landing on another instance,
+// once shutdown has begun. New streams could outlive the shutdown timeout,
+// so they are turned away with a Retry-After hint instead.
+func drainMiddleware(h *handlers.Handler, retryAfter time.Duration, logger *slog.Logger) gin.HandlerFunc {
+	retryAfterSeconds := strconv.Itoa(int(retryAfter.Round(time.Second).Seconds()))
+
+	return func(c *gin.Context) {
+		if !h.IsDraining() {
+			c.Next()
+			return
+		}
+
+		c.Header("Connection", "close")
+		if c.Request.Method == http.MethodGet && streamRoutes[c.FullPath()] {
+			logger.Info("Refusing stream while draining", "path", c.Request.URL.Path)
+			c.Header("Retry-After", retryAfterSeconds)
+			handlers.RespondError(c, http.StatusServiceUnavailable, "Server is shutting down, retry later")
 			c.Abort()
 			return
 		}
@@ -203,13 +853,46 @@ func authMiddleware(bearerToken string, logger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
-func corsMiddleware() gin.HandlerFunc {
+// streamTimeoutMiddleware overrides the server-wide write timeout for
+// streaming routes; a zero timeout removes the write deadline entirely
+func streamTimeoutMiddleware(timeout time.Duration, logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+			logger.Warn("Failed to extend write deadline", "path", c.Request.URL.Path, "error", err)
+		}
+
+		c.Next()
+	}
+}
+
+// corsMiddleware adds the CORS headers of the route's policy to responses to
+// browsers on allowed origins and answers preflights, refusing those from
+// other origins with 403
+func corsMiddleware(policies *cors.Policies, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin != "" {
+			headers, allowed := policies.For(c.Request.URL.Path).Headers(origin, preflight)
+			for name, values := range headers {
+				c.Writer.Header()[name] = values
+			}
+			// Other requests go ahead without CORS headers, so browsers
+			// hide the response while other clients are unaffected
+			if !allowed && preflight {
+				logger.Warn("CORS preflight from disallowed origin", "origin", origin, "path", c.Request.URL.Path)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
 
-		if c.Request.Method == "OPTIONS" {
+		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/cors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(concurrencyLimitMiddleware(config.ConcurrencyConfig{Read: 1, Write: 1, RetryAfter: 2 * time.Second}, logger))
+	router.GET("/api/v1/slow", func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/deployments/:id", ok)
+	router.PATCH("/api/v1/deployments/:id/status", ok)
+	router.POST("/api/v1/push", ok)
+	router.GET("/api/v1/deployments/:id/logs/stream", ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// Hold the only read slot
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve("GET", "/api/v1/slow") }()
+	<-entered
+
+	w := serve("GET", "/api/v1/deployments/1")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a read beyond the limit to be shed with %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+
+	// Other classes have slots of their own, or no limit at all
+	for _, tt := range []struct{ method, path string }{
+		{"PATCH", "/api/v1/deployments/1/status"},
+		{"POST", "/api/v1/push"},
+		{"GET", "/api/v1/deployments/1/logs/stream"},
+	} {
+		if w := serve(tt.method, tt.path); w.Code != http.StatusOK {
+			t.Errorf("Expected %s %s to be served while reads are full, got %d", tt.method, tt.path, w.Code)
+		}
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("Expected the held read to complete, got %d", w.Code)
+	}
+	if w := serve("GET", "/api/v1/deployments/1"); w.Code != http.StatusOK {
+		t.Errorf("Expected a read to be served once the slot was freed, got %d", w.Code)
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router := gin.New()
+	router.Use(bodyLimitMiddleware(config.BodyLimitsConfig{Default: 16, Push: 64, Status: 8}, logger))
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	}
+	router.POST("/api/v1/secrets", echo)
+	router.POST("/api/v1/push", echo)
+	router.PATCH("/api/v1/deployments/:id/status", echo)
+
+	tests := []struct {
+		name          string
+		method, path  string
+		body          string
+		contentLength int64
+		chunked       bool
+		want          int
+	}{
+		{name: "Under the default limit", method: "POST", path: "/api/v1/secrets", body: strings.Repeat("a", 16), want: http.StatusOK},
+		{name: "Oversized Content-Length", method: "POST", path: "/api/v1/secrets", body: "a", contentLength: 17, want: http.StatusRequestEntityTooLarge},
+		{name: "Chunked under the limit", method: "POST", path: "/api/v1/secrets", body: strings.Repeat("a", 16), chunked: true, want: http.StatusOK},
+		{name: "Chunked over the limit", method: "POST", path: "/api/v1/secrets", body: strings.Repeat("a", 17), chunked: true, want: http.StatusRequestEntityTooLarge},
+		{name: "Push route override", method: "POST", path: "/api/v1/push", body: strings.Repeat("a", 64), want: http.StatusOK},
+		{name: "Push route over its limit", method: "POST", path: "/api/v1/push", body: strings.Repeat("a", 65), chunked: true, want: http.StatusRequestEntityTooLarge},
+		{name: "Status route override", method: "PATCH", path: "/api/v1/deployments/1/status", body: strings.Repeat("a", 9), want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				// Hide the length, as a chunked request without Content-Length
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want == http.StatusOK && w.Body.String() != strconv.Itoa(len(tt.body)) {
+				t.Errorf("Expected the handler to read the whole %d byte body, got %s", len(tt.body), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareNestedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	policies := cors.New(config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "POST", "DELETE"}},
+		Routes: []config.CORSRoute{
+			{Path: "/api/v1/secrets", CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"https://vault-ui.example.com"}}},
+			{Path: "/api/v1/secrets/payments", CORSPolicy: config.CORSPolicy{AllowedMethods: []string{"GET"}}},
+		},
+	})
+	router := gin.New()
+	router.Use(corsMiddleware(policies, logger))
+	router.GET("/api/v1/secrets/payments/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/api/v1/secrets/payments/db-pass", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The nested route overrides only the methods, keeping the enclosing
+	// route's origins rather than falling back to the server's *
+	w := preflight("https://vault-ui.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET" ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://vault-ui.example.com" {
+		t.Errorf("Expected the nested route's methods for the enclosing route's origin, got %d %v", w.Code, w.Header())
+	}
+	if w := preflight("https://any.example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a preflight from an origin only the server allows refused with %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
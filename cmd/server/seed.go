@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runSeed loads deployments and registry credentials from a fixtures file
+func runSeed(ctx context.Context, h *handlers.Handler, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "fixtures.yaml", "fixtures file to load, in the export document format")
+	dryRun := flags.Bool("dry-run", false, "report what would be seeded without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Unknown fields are rejected so a typo doesn't silently drop a value
+	var fixtures models.ControllerExport
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fixtures); err != nil {
+		return fmt.Errorf("invalid fixtures file %s: %w", *file, err)
+	}
+
+	result, err := h.SeedFixtures(ctx, fixtures, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		return err
+	}
+
+	for _, item := range append(result.Deployments, result.Registries...) {
+		if item.Error != "" {
+			return fmt.Errorf("some fixtures were not seeded")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/pkg/client"
+
+	"github.com/google/uuid"
+)
+
+// selftestDomain holds the selftest's deployment and registry credential.
+// .invalid never resolves, so nothing real is ever deployed there.
+const selftestDomain = "selftest.invalid"
+
+// selftestHold is a CI check the selftest's deployment is pushed with and
+// never reported, so agents' pending and claim endpoints skip it
+const selftestHold = "selftest-hold"
+
+// selftest walks a running instance through a deployment's lifecycle and a
+// registry credential's, printing a line per step
+type selftest struct {
+	client *client.Client
+	runID  string
+	failed bool
+}
+
+// runSelftest checks a running instance end to end over its API: it pushes
+// a test deployment, walks it through its statuses, fetches it, stores and
+// reads back a dummy registry credential, then cleans up
+func runSelftest(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	url := flags.String("url", fmt.Sprintf("http://localhost:%d", cfg.Server.Port), "base URL of the instance to test")
+	token := flags.String("token", cfg.Security.BearerToken, "API bearer token; defaults to the config's")
+	timeout := flags.Duration("timeout", time.Minute, "how long the whole test may take")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	t := &selftest{
+		// A failure should surface as is rather than be retried away
+		client: client.New(client.Config{BaseURL: *url, Token: *token, MaxRetries: -1}),
+		runID:  uuid.NewString()[:8],
+	}
+	fmt.Printf("Testing %s (run %s)\n", *url, t.runID)
+
+	t.deployment(ctx)
+	t.credential(ctx)
+
+	if t.failed {
+		return fmt.Errorf("selftest failed")
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// step runs one check and prints its outcome; it returns whether it passed
+func (t *selftest) step(name string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.failed = true
+		fmt.Printf("FAIL  %-24s %s: %v\n", name, elapsed, err)
+		return false
+	}
+	fmt.Printf("ok    %-24s %s\n", name, elapsed)
+	return true
+}
+
+// deployment pushes a test deployment held from agents, moves it from
+// pending to deployed, fetches it and deletes it
+func (t *selftest) deployment(ctx context.Context) {
+	image := fmt.Sprintf("%s/selftest:%s", selftestDomain, t.runID)
+
+	var d *client.Deployment
+	if !t.step("push", func() error {
+		result, err := t.client.Push(ctx, []client.DeploymentRequest{{
+			Domain:      selftestDomain,
+			AppName:     "selftest",
+			DockerImage: image,
+			Port:        8080,
+			Env:         []string{"SELFTEST_RUN=" + t.runID},
+			Checks:      []string{selftestHold},
+		}}, client.PushOptions{})
+		if err != nil {
+			return err
+		}
+		if len(result.Created) != 1 {
+			return fmt.Errorf("expected one created deployment, got %d", len(result.Created))
+		}
+		d = &result.Created[0]
+		if d.Status != "pending" {
+			return fmt.Errorf("expected status pending, got %s", d.Status)
+		}
+		return nil
+	}) {
+		return
+	}
+
+	// Deleted whatever state a failed step left it in
+	defer t.step("cleanup deployment", func() error {
+		if err := t.client.DeleteDeployment(ctx, d.ID, "*"); err != nil {
+			return err
+		}
+		if _, err := t.client.GetDeployment(ctx, d.ID); !client.IsNotFound(err) {
+			return fmt.Errorf("expected the deployment to be gone, got %v", err)
+		}
+		return nil
+	})
+
+	// Each update is conditional on the previous one, so anything else
+	// changing the test deployment in between fails the step instead of
+	// racing it
+	for _, status := range []string{"deploying", "deployed"} {
+		if !t.step("status "+status, func() error {
+			updated, err := t.client.UpdateStatus(ctx, d.ID, client.StatusUpdate{Status: status}, d.ETag())
+			if err != nil {
+				return err
+			}
+			if updated.Status != status {
+				return fmt.Errorf("expected status %s, got %s", status, updated.Status)
+			}
+			d = updated
+			return nil
+		}) {
+			return
+		}
+	}
+
+	t.step("fetch", func() error {
+		fetched, err := t.client.GetDeployment(ctx, d.ID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fetched.Status != "deployed":
+			return fmt.Errorf("expected status deployed, got %s", fetched.Status)
+		case fetched.DeployedAt == nil:
+			return fmt.Errorf("expected deployed_at to be set")
+		case fetched.DockerImage != image || fetched.Version != d.Version:
+			return fmt.Errorf("expected %s version %d, got %s version %d", image, d.Version, fetched.DockerImage, fetched.Version)
+		}
+		return nil
+	})
+}
+
+// credential stores a dummy registry credential, reads it back and deletes
+// it
+func (t *selftest) credential(ctx context.Context) {
+	password := "selftest-" + uuid.NewString()
+
+	if !t.step("store credential", func() error {
+		return t.client.PutRegistryCredential(ctx, selftestDomain, "selftest", password)
+	}) {
+		return
+	}
+
+	t.step("read credential", func() error {
+		cred, err := t.client.GetRegistryCredential(ctx, selftestDomain)
+		if err != nil {
+			return err
+		}
+		if cred.Username != "selftest" || cred.Password != password {
+			return fmt.Errorf("expected the stored username and password, got user %q", cred.Username)
+		}
+		return nil
+	})
+
+	t.step("cleanup credential", func() error {
+		if err := t.client.DeleteRegistryCredential(ctx, selftestDomain); err != nil {
+			return err
+		}
+		if _, err := t.client.GetRegistryCredential(ctx, selftestDomain); !client.IsNotFound(err) {
+			return fmt.Errorf("expected the credential to be gone, got %v", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,10 @@
+// Package db embeds the database schema, so the server can create a
+// database without a checkout of the repository.
+package db
+
+import _ "embed"
+
+// Schema is db/schema.sql, to apply to a new, empty database
+//
+//go:embed schema.sql
+var Schema string
@@ -14,8 +14,30 @@ CREATE TABLE deployments (
     version INTEGER NOT NULL DEFAULT 1,
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
     deployed_at TIMESTAMP WITH TIME ZONE,
-    status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'deploying', 'deployed', 'failed', 'rolled_back')),
+    status TEXT DEFAULT 'pending' CHECK (status IN ('pending', 'deploying', 'deployed', 'failed', 'rolled_back', 'stalled')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    -- When the deployment entered its current status, kept by a trigger
+    status_changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Last error resolving the deployment's secret references for an agent
+    secret_error TEXT NOT NULL DEFAULT '',
+    -- Orders pending deployments for agents
+    priority TEXT NOT NULL DEFAULT 'normal' CHECK (priority IN ('hotfix', 'normal', 'bulk')),
+    -- When a registry reported the deployment's image deleted
+    image_deleted_at TIMESTAMP WITH TIME ZONE,
+    -- Outcome of health checking the deployment after it was deployed
+    verification TEXT NOT NULL DEFAULT '' CHECK (verification IN ('', 'verifying', 'verified', 'degraded')),
+    verified_at TIMESTAMP WITH TIME ZONE,
+    -- Commit and CI run that built the deployment's image, when reported
+    git_sha TEXT NOT NULL DEFAULT '',
+    git_ref TEXT NOT NULL DEFAULT '',
+    build_url TEXT NOT NULL DEFAULT '',
+    builder TEXT NOT NULL DEFAULT '',
+    -- Machine-readable reason reported with a failed status
+    failure_code TEXT NOT NULL DEFAULT '',
+    failure_message TEXT NOT NULL DEFAULT '',
+    failure_details JSONB,
+    -- Free-form context set on push, such as ticket IDs or release names
+    metadata JSONB NOT NULL DEFAULT '{}',
 
     -- Composite unique constraint to ensure one active version per app per domain
     UNIQUE(domain, app_name, version)
@@ -30,20 +52,480 @@ CREATE TABLE docker_credentials (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Idempotency keys so retried pushes replay the original result
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER, -- NULL while the original request is in flight
+    response JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Push batches as submitted, so they can be replayed; failed holds the
+-- indexes of the items that failed
+CREATE TABLE push_requests (
+    request_id TEXT PRIMARY KEY,
+    deployments JSONB NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
+    failed INTEGER[] NOT NULL DEFAULT '{}',
+    replay_of TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Background jobs processed by the controller's worker pool
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled', 'dead')),
+    priority TEXT NOT NULL DEFAULT 'normal' CHECK (priority IN ('hotfix', 'normal', 'bulk')),
+    payload JSONB,
+    result JSONB,
+    total INTEGER NOT NULL DEFAULT 0,
+    processed INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    -- Set when an operator cancels a running job
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Failed jobs are queued again with a backoff until they run out of
+    -- attempts and are dead-lettered
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_after TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- The replica running a job renews its lease while it runs; a running
+    -- job whose lease lapsed lost its replica and is claimed again
+    lease_expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Per-app analytics, rebuilt periodically by the analytics worker
+CREATE TABLE app_deployment_summary (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    total_versions INTEGER NOT NULL,
+    deployed_count INTEGER NOT NULL,
+    failed_count INTEGER NOT NULL,
+    current_version INTEGER NOT NULL,
+    current_status TEXT NOT NULL,
+    last_created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_deployed_at TIMESTAMP WITH TIME ZONE,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Daily deployment counts per app, maintained incrementally by the analytics worker
+CREATE TABLE deployment_daily_counts (
+    day DATE NOT NULL,
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    created_count INTEGER NOT NULL,
+    deployed_count INTEGER NOT NULL,
+    failed_count INTEGER NOT NULL,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (day, domain, app_name)
+);
+
+-- Application secrets; version is the current version in secret_versions
+CREATE TABLE secrets (
+    project TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (project, name)
+);
+
+-- Every value a secret has held, encrypted at rest by the controller
+-- (AES-GCM, nonce-prefixed), so deployments can pin older versions
+CREATE TABLE secret_versions (
+    project TEXT NOT NULL,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    value BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (project, name, version),
+    FOREIGN KEY (project, name) REFERENCES secrets (project, name) ON DELETE CASCADE
+);
+
+-- Audit trail of sensitive reads: secret values and registry credentials
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    action TEXT NOT NULL,
+    resource TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    client_ip TEXT,
+    deployment_id UUID,
+    detail TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Cron schedules that re-create an app's latest deployment on a cadence
+CREATE TABLE schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    cron TEXT NOT NULL,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_deployment_id UUID,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    UNIQUE(domain, app_name)
+);
+
+-- Per-app policies for retrying failed deployments with exponential backoff
+CREATE TABLE retry_policies (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    max_attempts INTEGER NOT NULL CHECK (max_attempts >= 1),
+    initial_backoff_seconds INTEGER NOT NULL,
+    max_backoff_seconds INTEGER NOT NULL,
+    jitter DOUBLE PRECISION NOT NULL DEFAULT 0,
+    -- Failure codes worth retrying; empty retries every failure
+    retry_on TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Retry state of failed deployments; attempts counts the first attempt
+CREATE TABLE deployment_retries (
+    deployment_id UUID PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    next_retry_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Timeline of status changes and retries per deployment
+CREATE TABLE deployment_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    deployment_id UUID NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    message TEXT NOT NULL,
+    attempt INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    -- Set on status_changed events
+    from_status TEXT,
+    to_status TEXT
+);
+
+-- Caps on deployments in the deploying state; an empty app_name is a
+-- domain-wide limit
+CREATE TABLE rollout_limits (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL DEFAULT '',
+    max_deploying INTEGER NOT NULL CHECK (max_deploying >= 1),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Image policies: deploy new image tags or digests as registries publish
+-- them
+CREATE TABLE image_policies (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('semver', 'regex', 'digest')),
+    pattern TEXT NOT NULL DEFAULT '',
+    last_checked_at TIMESTAMP WITH TIME ZONE,
+    last_image TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Digests behind the deployed mutable tags of apps, to detect tags moving
+-- after a deployment
+CREATE TABLE image_digests (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    deployment_id UUID NOT NULL,
+    docker_image TEXT NOT NULL,
+    deployed_digest TEXT NOT NULL DEFAULT '',
+    registry_digest TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    checked_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- What agents last reported actually running for each app
+CREATE TABLE observed_states (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    deployment_id UUID,
+    docker_image TEXT NOT NULL,
+    digest TEXT NOT NULL DEFAULT '',
+    replicas INTEGER NOT NULL DEFAULT 0,
+    agent TEXT NOT NULL DEFAULT '',
+    reported_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- CI checks a pushed deployment is held on until they all succeed
+CREATE TABLE deployment_checks (
+    deployment_id UUID NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'success', 'failure')),
+    details_url TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (deployment_id, name)
+);
+
+-- Failure rate alerts currently firing, one per app
+CREATE TABLE failure_rate_alerts (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    failure_rate DOUBLE PRECISION NOT NULL,
+    firing_since TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Alert rules evaluated periodically against app health and deployment
+-- outcomes; an empty domain or app name matches every app
+CREATE TABLE alert_rules (
+    name TEXT PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('app_down', 'failure_rate')),
+    domain TEXT NOT NULL DEFAULT '',
+    app_name TEXT NOT NULL DEFAULT '',
+    for_seconds INTEGER NOT NULL DEFAULT 0 CHECK (for_seconds >= 0),
+    window_seconds INTEGER NOT NULL DEFAULT 0 CHECK (window_seconds >= 0),
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min_deployments INTEGER NOT NULL DEFAULT 0 CHECK (min_deployments >= 0),
+    silenced_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Alerts firing on apps that break an alert rule
+CREATE TABLE rule_alerts (
+    rule_name TEXT NOT NULL REFERENCES alert_rules(name) ON DELETE CASCADE,
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    firing_since TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    notified_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_by TEXT NOT NULL DEFAULT '',
+
+    PRIMARY KEY (rule_name, domain, app_name)
+);
+
+-- Health probe results reported by agents, aggregated into SLA reports
+CREATE TABLE health_probes (
+    id BIGSERIAL PRIMARY KEY,
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    deployment_id UUID,
+    healthy BOOLEAN NOT NULL,
+    agent TEXT NOT NULL DEFAULT '',
+    checked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Response time of http probes that got an answer, in milliseconds
+    latency_ms DOUBLE PRECISION
+);
+
+-- Incidents: spans during which an app's health probes were failing, opened
+-- by an unhealthy probe and resolved by the next healthy one
+CREATE TABLE incidents (
+    id BIGSERIAL PRIMARY KEY,
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    deployment_id UUID,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Per-app health checks, replacing the prober's default HTTP check with a
+-- different path, a TCP connect or a command run by the app's agent
+CREATE TABLE health_checks (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('http', 'tcp', 'exec')),
+    path TEXT NOT NULL DEFAULT '',
+    port INTEGER NOT NULL DEFAULT 0 CHECK (port >= 0 AND port <= 65535),
+    command TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Smoke tests run once after each deployment of an app is deployed: an HTTP
+-- request made by the controller, or a command run by the app's agent
+CREATE TABLE smoke_tests (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('http', 'exec')),
+    method TEXT NOT NULL DEFAULT 'GET',
+    path TEXT NOT NULL DEFAULT '',
+    expected_status INTEGER NOT NULL DEFAULT 0,
+    expected_body TEXT NOT NULL DEFAULT '',
+    command TEXT[] NOT NULL DEFAULT '{}',
+    rollback BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Smoke test outcomes, one per deployment tested
+CREATE TABLE smoke_test_results (
+    deployment_id UUID PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('running', 'passed', 'failed')),
+    message TEXT NOT NULL DEFAULT '',
+    agent TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Deployment logs uploaded by agents in sequenced chunks
+CREATE TABLE deployment_logs (
+    deployment_id UUID NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    content TEXT NOT NULL,
+    agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (deployment_id, seq)
+);
+
+-- Deployment logs moved to the blob store by retention; their chunks are
+-- no longer in deployment_logs
+CREATE TABLE archived_deployment_logs (
+    deployment_id UUID PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    chunks BIGINT NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Manifests as rendered for a deployment, with secret values masked. Rows
+-- are never updated; each distinct rendering of a format is kept once.
+CREATE TABLE manifest_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    format TEXT NOT NULL,
+    content TEXT NOT NULL,
+    secret_files JSONB NOT NULL DEFAULT '{}',
+    content_digest TEXT NOT NULL,
+    inline_secrets BOOLEAN NOT NULL DEFAULT FALSE,
+    maintenance BOOLEAN NOT NULL DEFAULT FALSE,
+    rendered_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    UNIQUE (deployment_id, format, content_digest)
+);
+
+-- Apps in maintenance: they are not probed or alerted on, and their rendered
+-- manifests are marked so proxies can serve a maintenance page
+CREATE TABLE app_maintenance (
+    domain TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    started_by TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (domain, app_name)
+);
+
+-- Server-wide freeze on new deployments, set by an admin during incidents;
+-- at most one row, present while the freeze is on
+CREATE TABLE write_freeze (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    reason TEXT NOT NULL DEFAULT '',
+    started_by TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Expiring leases, such as the leader lease held by one controller instance
+CREATE TABLE leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    renewed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Outcome of the latest git sync of each branch
+CREATE TABLE git_syncs (
+    branch TEXT PRIMARY KEY,
+    commit_sha TEXT NOT NULL DEFAULT '',
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    result JSONB NOT NULL DEFAULT '[]',
+    declared JSONB NOT NULL DEFAULT '[]',
+    error TEXT
+);
+
+-- Ranks priorities for ordering, most urgent first
+CREATE OR REPLACE FUNCTION priority_rank(p_priority TEXT)
+RETURNS INTEGER AS $$
+    SELECT CASE p_priority WHEN 'hotfix' THEN 0 WHEN 'bulk' THEN 2 ELSE 1 END;
+$$ LANGUAGE sql IMMUTABLE;
+
 -- Indexes for better performance
 CREATE INDEX idx_deployments_domain_app ON deployments(domain, app_name);
 CREATE INDEX idx_deployments_status ON deployments(status);
 CREATE INDEX idx_deployments_updated_at ON deployments(updated_at DESC);
 CREATE INDEX idx_deployments_request_id ON deployments(request_id);
+CREATE INDEX idx_deployments_history ON deployments(domain, app_name, created_at DESC, id DESC);
+CREATE INDEX idx_deployments_created_at ON deployments(created_at);
+CREATE INDEX idx_deployments_status_changed_at ON deployments(status_changed_at);
+CREATE INDEX idx_deployments_status_since ON deployments(status, status_changed_at);
+CREATE INDEX idx_audit_events_resource ON audit_events(resource, created_at DESC, id DESC);
+CREATE INDEX idx_jobs_queued ON jobs(type, priority_rank(priority), created_at) WHERE status = 'queued';
+CREATE INDEX idx_jobs_created ON jobs(created_at DESC, id DESC);
+CREATE INDEX idx_jobs_lease ON jobs(type, lease_expires_at) WHERE status = 'running';
+CREATE INDEX idx_schedules_due ON schedules(next_run_at) WHERE NOT paused;
+CREATE INDEX idx_deployment_retries_due ON deployment_retries(next_retry_at) WHERE next_retry_at IS NOT NULL;
+CREATE INDEX idx_deployment_events_deployment ON deployment_events(deployment_id, created_at);
+CREATE INDEX idx_health_probes_checked_at ON health_probes(checked_at);
+CREATE INDEX idx_health_probes_app ON health_probes(domain, app_name, checked_at DESC);
+CREATE INDEX idx_smoke_test_results_running ON smoke_test_results(started_at) WHERE status = 'running';
+CREATE UNIQUE INDEX idx_incidents_open ON incidents(domain, app_name) WHERE resolved_at IS NULL;
+CREATE INDEX idx_incidents_app ON incidents(domain, app_name, started_at DESC);
 
 -- View to get the latest version for each app
 CREATE VIEW latest_deployments AS
 SELECT DISTINCT ON (domain, app_name)
     id, request_id, domain, app_name, docker_image, port, env,
-    version, updated_at, deployed_at, status, created_at
+    version, updated_at, deployed_at, status, created_at, secret_error, priority,
+    image_deleted_at, verification, verified_at, git_sha, git_ref, build_url, builder,
+    failure_code, failure_message, failure_details, metadata
 FROM deployments
 ORDER BY domain, app_name, version DESC;
 
+-- Deployment counters served by GET /api/v1/stats, refreshed periodically by
+-- the controller instead of scanning latest_deployments on every request
+CREATE MATERIALIZED VIEW deployment_stats AS
+SELECT
+    TRUE AS singleton, -- keys the single row for the unique index below
+    COUNT(*) AS total,
+    COUNT(CASE WHEN status = 'pending' THEN 1 END) AS pending,
+    COUNT(CASE WHEN status = 'deployed' THEN 1 END) AS deployed,
+    COUNT(CASE WHEN status = 'failed' THEN 1 END) AS failed,
+    NOW() AS refreshed_at
+FROM latest_deployments;
+
+-- Per-app counterpart of deployment_stats, refreshed along with it
+CREATE MATERIALIZED VIEW app_deployment_stats AS
+SELECT
+    d.domain,
+    d.app_name,
+    COUNT(*) AS versions,
+    l.version AS current_version,
+    l.status AS current_status,
+    MAX(d.deployed_at) AS last_deployed_at
+FROM deployments d
+JOIN latest_deployments l ON l.domain = d.domain AND l.app_name = d.app_name
+GROUP BY d.domain, d.app_name, l.version, l.status;
+
+-- Unique indexes let both views be refreshed CONCURRENTLY, so /stats keeps
+-- reading the previous contents instead of blocking during a refresh
+CREATE UNIQUE INDEX idx_deployment_stats_singleton ON deployment_stats(singleton);
+CREATE UNIQUE INDEX idx_app_deployment_stats_app ON app_deployment_stats(domain, app_name);
+
 -- Function to get next version number for an app
 CREATE OR REPLACE FUNCTION get_next_version(p_domain TEXT, p_app_name TEXT)
 RETURNS INTEGER AS $$
@@ -57,4 +539,46 @@ BEGIN
 
     RETURN next_version;
 END;
-$$ LANGUAGE plpgsql;
\ No newline at end of file
+$$ LANGUAGE plpgsql;
+-- Notify listeners (e.g. other controller replicas) whenever deployments change
+CREATE OR REPLACE FUNCTION notify_deployments_changed()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('deployments_changed', TG_OP);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER deployments_changed
+AFTER INSERT OR UPDATE OR DELETE ON deployments
+FOR EACH STATEMENT EXECUTE FUNCTION notify_deployments_changed();
+
+-- Stamp status_changed_at whenever a deployment's status changes, whichever
+-- code path changed it
+CREATE OR REPLACE FUNCTION set_status_changed_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.status IS DISTINCT FROM OLD.status THEN
+        NEW.status_changed_at := NOW();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER deployments_status_changed
+BEFORE UPDATE OF status ON deployments
+FOR EACH ROW EXECUTE FUNCTION set_status_changed_at();
+
+-- Wake worker pools on every replica when a job is queued
+CREATE OR REPLACE FUNCTION notify_jobs_queued()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('jobs_queued', NEW.type);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER jobs_queued
+AFTER INSERT OR UPDATE OF status ON jobs
+FOR EACH ROW WHEN (NEW.status = 'queued')
+EXECUTE FUNCTION notify_jobs_queued();
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/models"
+)
+
+// Tokens holds the bearer tokens accepted on the API, for the reveal scope
+// and on the agent routes. The whole set is swapped at once by Update, so
+// tokens can be rotated while the server keeps serving.
+type Tokens struct {
+	set atomic.Pointer[tokenSet]
+
+	// path is the config file Reload reads, as passed to config.Load
+	path string
+}
+
+type tokenSet struct {
+	api, reveal, agent [][]byte
+}
+
+// New creates a token store holding the tokens of cfg, which was loaded
+// from the config file at path
+func New(cfg config.SecurityConfig, path string) *Tokens {
+	t := &Tokens{path: path}
+	t.Update(cfg)
+	return t
+}
+
+// Update replaces every token with those of cfg and reports how many of
+// each kind are now accepted
+func (t *Tokens) Update(cfg config.SecurityConfig) models.TokenCounts {
+	set := &tokenSet{
+		api:    tokenList(cfg.BearerToken, cfg.BearerTokens),
+		reveal: tokenList(cfg.RevealToken, cfg.RevealTokens),
+		agent:  tokenList(cfg.AgentToken, cfg.AgentTokens),
+	}
+	t.set.Store(set)
+	return models.TokenCounts{API: len(set.api), Reveal: len(set.reveal), Agent: len(set.agent)}
+}
+
+// Reload re-reads the config file and applies its tokens. Other settings in
+// the file still need a restart to take effect. A file that leaves no token
+// of a kind that has some, such as one saved half-edited, is refused unless
+// it sets security.allow_empty_tokens; the current tokens are kept.
+func (t *Tokens) Reload() (models.TokenCounts, error) {
+	cfg, err := config.Load(t.path)
+	if err != nil {
+		return models.TokenCounts{}, err
+	}
+
+	if !cfg.Security.AllowEmptyTokens {
+		current := t.set.Load()
+		var emptied []string
+		for _, kind := range []struct {
+			name          string
+			before, after [][]byte
+		}{
+			{"API", current.api, tokenList(cfg.Security.BearerToken, cfg.Security.BearerTokens)},
+			{"reveal", current.reveal, tokenList(cfg.Security.RevealToken, cfg.Security.RevealTokens)},
+			{"agent", current.agent, tokenList(cfg.Security.AgentToken, cfg.Security.AgentTokens)},
+		} {
+			if len(kind.before) > 0 && len(kind.after) == 0 {
+				emptied = append(emptied, kind.name)
+			}
+		}
+		if len(emptied) > 0 {
+			return models.TokenCounts{}, fmt.Errorf("the config file has no %s tokens left; set security.allow_empty_tokens to remove them all", strings.Join(emptied, ", "))
+		}
+	}
+	return t.Update(cfg.Security), nil
+}
+
+// APIRequired reports whether the API requires a bearer token
+func (t *Tokens) APIRequired() bool {
+	return len(t.set.Load().api) > 0
+}
+
+// AgentEnabled reports whether any agent token is configured; the agent API
+// is disabled without one
+func (t *Tokens) AgentEnabled() bool {
+	return len(t.set.Load().agent) > 0
+}
+
+// API reports whether token is an accepted API bearer token
+func (t *Tokens) API(token string) bool {
+	return matches(t.set.Load().api, token)
+}
+
+// Reveal reports whether token is an accepted reveal token
+func (t *Tokens) Reveal(token string) bool {
+	return matches(t.set.Load().reveal, token)
+}
+
+// Agent reports whether token is an accepted agent token
+func (t *Tokens) Agent(token string) bool {
+	return matches(t.set.Load().agent, token)
+}
+
+// tokenList collects the non-empty tokens of a kind
+func tokenList(token string, more []string) [][]byte {
+	var list [][]byte
+	for _, tok := range append([]string{token}, more...) {
+		if tok != "" {
+			list = append(list, []byte(tok))
+		}
+	}
+	return list
+}
+
+// matches compares token against every accepted token in constant time, so
+// the response time doesn't reveal which one it came close to
+func matches(accepted [][]byte, token string) bool {
+	ok := 0
+	for _, tok := range accepted {
+		ok |= subtle.ConstantTimeCompare([]byte(token), tok)
+	}
+	return ok == 1
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/models"
+)
+
+func TestTokensRotation(t *testing.T) {
+	tokens := New(config.SecurityConfig{}, "")
+	if tokens.APIRequired() || tokens.AgentEnabled() || tokens.API("") || tokens.Reveal("") {
+		t.Fatal("Expected no tokens accepted without any configured")
+	}
+
+	tokens.Update(config.SecurityConfig{BearerToken: "old", AgentToken: "agent-old"})
+	if !tokens.APIRequired() || !tokens.API("old") || tokens.API("new") || !tokens.Agent("agent-old") {
+		t.Fatal("Expected only the configured tokens accepted")
+	}
+
+	// Both tokens work while clients move over
+	counts := tokens.Update(config.SecurityConfig{
+		BearerToken:  "new",
+		BearerTokens: []string{"old"},
+		AgentTokens:  []string{"agent-new", "agent-old", ""},
+	})
+	if counts != (models.TokenCounts{API: 2, Agent: 2}) {
+		t.Errorf("Unexpected token counts %+v", counts)
+	}
+	for _, token := range []string{"old", "new"} {
+		if !tokens.API(token) {
+			t.Errorf("Expected %q accepted during the rotation", token)
+		}
+	}
+	if tokens.Reveal("new") || tokens.Agent("new") {
+		t.Error("Expected API tokens not accepted as reveal or agent tokens")
+	}
+
+	tokens.Update(config.SecurityConfig{BearerToken: "new", AgentToken: "agent-new"})
+	if tokens.API("old") || tokens.Agent("agent-old") {
+		t.Error("Expected retired tokens rejected")
+	}
+}
+
+func TestTokensReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("security:\n  bearer_token: old\n")
+	tokens := New(config.SecurityConfig{BearerToken: "old"}, path)
+
+	write("security:\n  bearer_token: new\n  reveal_tokens: [reveal]\n")
+	counts, err := tokens.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if counts != (models.TokenCounts{API: 1, Reveal: 1}) || !tokens.API("new") || tokens.API("old") || !tokens.Reveal("reveal") {
+		t.Errorf("Expected the reloaded tokens, got %+v", counts)
+	}
+
+	// An emptied token list is more likely a half-edited file than a wish
+	// to open the API
+	write("security:\n  reveal_tokens: [reveal]\n")
+	if _, err := tokens.Reload(); err == nil {
+		t.Fatal("Expected a reload removing every API token to be refused")
+	}
+	if !tokens.API("new") || !tokens.APIRequired() {
+		t.Error("Expected a refused reload to keep the current tokens")
+	}
+
+	write("security:\n  allow_empty_tokens: true\n  reveal_tokens: [reveal]\n")
+	if counts, err := tokens.Reload(); err != nil || counts != (models.TokenCounts{Reveal: 1}) || tokens.APIRequired() {
+		t.Fatalf("Expected allow_empty_tokens to let the API tokens go, got %+v, %v", counts, err)
+	}
+
+	write("security:\n  bearer_token: new\n  reveal_tokens: [reveal]\n")
+	if _, err := tokens.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	write("security: [")
+	if _, err := tokens.Reload(); err == nil {
+		t.Fatal("Expected an invalid config to fail the reload")
+	}
+	if !tokens.API("new") {
+		t.Error("Expected a failed reload to keep the current tokens")
+	}
+}
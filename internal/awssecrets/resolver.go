@@ -0,0 +1,127 @@
+package awssecrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	// SecretsManagerScheme prefixes references like aws-sm://prod/payments/api-key
+	SecretsManagerScheme = "aws-sm"
+	// ParameterStoreScheme prefixes references like aws-ssm://prod/payments/db-pass
+	ParameterStoreScheme = "aws-ssm"
+)
+
+// LoadConfig loads AWS configuration from the default credential chain
+// (environment, shared config, or the controller's IAM role)
+func LoadConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// secretsManagerAPI is the subset of the Secrets Manager client used here
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SecretsManagerResolver resolves aws-sm://<secret-id>[#json-key]. With a
+// key, the secret string is parsed as a JSON object and that field returned.
+type SecretsManagerResolver struct {
+	client secretsManagerAPI
+}
+
+// NewSecretsManagerResolver creates a Secrets Manager resolver
+func NewSecretsManagerResolver(cfg aws.Config) *SecretsManagerResolver {
+	return &SecretsManagerResolver{client: secretsmanager.NewFromConfig(cfg)}
+}
+
+func (r *SecretsManagerResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	id, key, _ := strings.Cut(strings.TrimPrefix(ref, SecretsManagerScheme+"://"), "#")
+
+	out, err := r.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		var notFound *smtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("secret not found")
+		}
+		return "", fmt.Errorf("failed to get secret from Secrets Manager: %w", err)
+	}
+
+	value := aws.ToString(out.SecretString)
+	if out.SecretString == nil {
+		value = string(out.SecretBinary)
+	}
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot select key %q", key)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret not found")
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+
+	encoded, err := json.Marshal(field)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode secret field: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// parameterStoreAPI is the subset of the SSM client used here
+type parameterStoreAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ParameterStoreResolver resolves aws-ssm://<parameter-path> to the
+// decrypted value of the parameter /<parameter-path>
+type ParameterStoreResolver struct {
+	client parameterStoreAPI
+}
+
+// NewParameterStoreResolver creates an SSM Parameter Store resolver
+func NewParameterStoreResolver(cfg aws.Config) *ParameterStoreResolver {
+	return &ParameterStoreResolver{client: ssm.NewFromConfig(cfg)}
+}
+
+func (r *ParameterStoreResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	name := "/" + strings.TrimPrefix(strings.TrimPrefix(ref, ParameterStoreScheme+"://"), "/")
+
+	out, err := r.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("secret not found")
+		}
+		return "", fmt.Errorf("failed to get parameter from SSM: %w", err)
+	}
+
+	return aws.ToString(out.Parameter.Value), nil
+}
@@ -0,0 +1,75 @@
+package awssecrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type fakeSecretsManager map[string]string
+
+func (f fakeSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, &smtypes.ResourceNotFoundException{}
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+type fakeParameterStore map[string]string
+
+func (f fakeParameterStore) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	value, ok := f[aws.ToString(params.Name)]
+	if !ok {
+		return nil, &ssmtypes.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestSecretsManagerResolver(t *testing.T) {
+	r := &SecretsManagerResolver{client: fakeSecretsManager{
+		"prod/payments/api-key": "abc123",
+		"prod/payments/db":      `{"username":"app","password":"s3cret"}`,
+	}}
+	ctx := context.Background()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "aws-sm://prod/payments/api-key", want: "abc123"},
+		{ref: "aws-sm://prod/payments/db#password", want: "s3cret"},
+		{ref: "aws-sm://prod/payments/db#missing", wantErr: "secret not found"},
+		{ref: "aws-sm://prod/unknown", wantErr: "secret not found"},
+	}
+
+	for _, tt := range tests {
+		got, err := r.Resolve(ctx, tt.ref)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Resolve(%q) error = %v, want %q", tt.ref, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestParameterStoreResolver(t *testing.T) {
+	r := &ParameterStoreResolver{client: fakeParameterStore{"/prod/payments/db-pass": "s3cret"}}
+
+	if got, err := r.Resolve(context.Background(), "aws-ssm://prod/payments/db-pass"); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	if _, err := r.Resolve(context.Background(), "aws-ssm://prod/unknown"); err == nil || err.Error() != "secret not found" {
+		t.Errorf("Expected secret not found, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/awssecrets"
+	"deployment-controller/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Store keeps immutable objects by key outside Postgres
+type Store interface {
+	// Put writes body to key, replacing any object already there
+	Put(ctx context.Context, key, contentType string, body []byte) error
+
+	// Get reads the object at key; a missing object is "blob not found"
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// New creates the configured blob store, or returns nil when none is
+func New(ctx context.Context, cfg config.BlobStoreConfig) (Store, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "s3":
+		var credentials aws.CredentialsProvider
+		if cfg.AccessKeyID != "" {
+			static := aws.Credentials{AccessKeyID: cfg.AccessKeyID, SecretAccessKey: cfg.SecretAccessKey}
+			credentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return static, nil
+			})
+		} else {
+			awsCfg, err := awssecrets.LoadConfig(ctx, cfg.Region)
+			if err != nil {
+				return nil, err
+			}
+			credentials = awsCfg.Credentials
+		}
+		return NewS3Store(cfg, credentials), nil
+	default:
+		return nil, fmt.Errorf("unsupported blob store provider %q: must be s3", cfg.Provider)
+	}
+}
@@ -0,0 +1,84 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestS3Store(t *testing.T) {
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+			r.Header.Get("X-Amz-Content-Sha256") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = r.Header.Get("Content-Type") + ":" + string(body)
+		case http.MethodGet:
+			object, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, body, _ := strings.Cut(object, ":")
+			io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+
+	store, err := New(context.Background(), config.BlobStoreConfig{
+		Provider:        "s3",
+		Bucket:          "deployments",
+		Region:          "us-east-1",
+		Prefix:          "prod/",
+		Endpoint:        server.URL,
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio-secret",
+		Timeout:         time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := store.Put(context.Background(), "logs/abc.json", "application/json", []byte(`[]`)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := objects["/deployments/prod/logs/abc.json"]; got != "application/json:[]" {
+		t.Errorf("Expected the object at its path-style key, got %v", objects)
+	}
+
+	body, err := store.Get(context.Background(), "logs/abc.json")
+	if err != nil || string(body) != "[]" {
+		t.Errorf("Expected the stored object, got %q, %v", body, err)
+	}
+	if _, err := store.Get(context.Background(), "logs/missing.json"); err == nil || err.Error() != "blob not found" {
+		t.Errorf("Expected blob not found, got %v", err)
+	}
+}
+
+func TestS3StoreVirtualHosted(t *testing.T) {
+	s := NewS3Store(config.BlobStoreConfig{Bucket: "deployments", Region: "eu-west-1"}, aws.AnonymousCredentials{})
+	if got := s.endpoint.String(); got != "https://deployments.s3.eu-west-1.amazonaws.com" || s.pathStyle {
+		t.Errorf("Unexpected endpoint %s", got)
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	store, err := New(context.Background(), config.BlobStoreConfig{})
+	if err != nil || store != nil {
+		t.Errorf("Expected no store without a provider, got %v, %v", store, err)
+	}
+}
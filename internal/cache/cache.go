@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// latestCacheName labels metrics for the latest deployments cache
+const latestCacheName = "latest_deployments"
+
+// Store wraps a database.Store and serves the latest deployments list from a
+// short-lived in-process cache. Writes made through the Store invalidate the
+// cache immediately; writes from other replicas are picked up through
+// Invalidate, typically driven by a LISTEN/NOTIFY subscription.
+type Store struct {
+	database.Store
+
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu         sync.RWMutex
+	latest     []models.Deployment
+	expiresAt  time.Time
+	generation uint64
+}
+
+// New creates a caching store around the given store
+func New(store database.Store, ttl time.Duration) *Store {
+	return &Store{
+		Store: store,
+		ttl:   ttl,
+		clock: clock.Real,
+	}
+}
+
+// SetClock sets the clock the TTL is measured with
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// GetLatestDeployments returns the cached latest deployments, refreshing them
+// from the underlying store once the TTL has expired
+func (s *Store) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	s.mu.RLock()
+	if s.latest != nil && s.clock.Now().Before(s.expiresAt) {
+		deployments := copyDeployments(s.latest)
+		s.mu.RUnlock()
+		metrics.CacheHits.WithLabelValues(latestCacheName).Inc()
+		return deployments, nil
+	}
+	generation := s.generation
+	s.mu.RUnlock()
+
+	metrics.CacheMisses.WithLabelValues(latestCacheName).Inc()
+
+	deployments, err := s.Store.GetLatestDeployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	// Don't store results that raced with an invalidation
+	if s.generation == generation {
+		s.latest = copyDeployments(deployments)
+		if s.latest == nil {
+			s.latest = []models.Deployment{}
+		}
+		s.expiresAt = s.clock.Now().Add(s.ttl)
+	}
+	s.mu.Unlock()
+
+	return deployments, nil
+}
+
+// Invalidate drops the cached data; source labels the invalidation metric
+func (s *Store) Invalidate(source string) {
+	s.mu.Lock()
+	s.latest = nil
+	s.generation++
+	s.mu.Unlock()
+
+	metrics.CacheInvalidations.WithLabelValues(latestCacheName, source).Inc()
+}
+
+// CreateDeployment creates a deployment and invalidates the cache
+func (s *Store) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
+	deployment, err := s.Store.CreateDeployment(ctx, req, requestID)
+	s.Invalidate("local")
+	return deployment, err
+}
+
+// CreateDeploymentBatch creates a batch of deployments and invalidates the cache
+func (s *Store) CreateDeploymentBatch(ctx context.Context, reqs models.DeploymentPushRequest, requestID string, skipUnchanged bool) ([]models.Deployment, error) {
+	deployments, err := s.Store.CreateDeploymentBatch(ctx, reqs, requestID, skipUnchanged)
+	s.Invalidate("local")
+	return deployments, err
+}
+
+// UpdateDeploymentStatus updates a deployment's status and invalidates the cache
+func (s *Store) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error) {
+	deployment, err := s.Store.UpdateDeploymentStatus(ctx, id, status, failure, deployedAt, ifMatch)
+	s.Invalidate("local")
+	return deployment, err
+}
+
+// DeleteDeployment deletes a deployment version and invalidates the cache
+func (s *Store) DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch []string) error {
+	err := s.Store.DeleteDeployment(ctx, id, ifMatch)
+	s.Invalidate("local")
+	return err
+}
+
+// SetDeploymentSecretError records a secret resolution error and invalidates the cache
+func (s *Store) SetDeploymentSecretError(ctx context.Context, id uuid.UUID, message string) error {
+	err := s.Store.SetDeploymentSecretError(ctx, id, message)
+	s.Invalidate("local")
+	return err
+}
+
+// SetDeploymentImageDeleted flags or clears a deleted image and invalidates the cache
+func (s *Store) SetDeploymentImageDeleted(ctx context.Context, id uuid.UUID, deletedAt *time.Time) error {
+	err := s.Store.SetDeploymentImageDeleted(ctx, id, deletedAt)
+	s.Invalidate("local")
+	return err
+}
+
+// SetDeploymentVerification records a verification state and invalidates the cache
+func (s *Store) SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error {
+	err := s.Store.SetDeploymentVerification(ctx, id, verification, message)
+	s.Invalidate("local")
+	return err
+}
+
+// ClaimDeployments claims pending deployments and invalidates the cache
+func (s *Store) ClaimDeployments(ctx context.Context, domain string, max, defaultDomainLimit int) ([]models.Deployment, error) {
+	deployments, err := s.Store.ClaimDeployments(ctx, domain, max, defaultDomainLimit)
+	s.Invalidate("local")
+	return deployments, err
+}
+
+// RequeueDeployments resets stuck deployments to pending and invalidates the cache
+func (s *Store) RequeueDeployments(ctx context.Context, status string, before time.Time, domain string, limit int, dryRun bool, actor string) ([]models.StuckDeployment, error) {
+	deployments, err := s.Store.RequeueDeployments(ctx, status, before, domain, limit, dryRun, actor)
+	if !dryRun {
+		s.Invalidate("local")
+	}
+	return deployments, err
+}
+
+// MarkStuckDeployments marks stuck deployments stalled or failed and invalidates the cache
+func (s *Store) MarkStuckDeployments(ctx context.Context, status string, before time.Time, to string, failure *models.DeploymentFailure, limit int) ([]models.StuckDeployment, error) {
+	deployments, err := s.Store.MarkStuckDeployments(ctx, status, before, to, failure, limit)
+	s.Invalidate("local")
+	return deployments, err
+}
+
+// copyDeployments returns a shallow copy so callers can annotate the
+// returned records without mutating the cache
+func copyDeployments(deployments []models.Deployment) []models.Deployment {
+	if deployments == nil {
+		return nil
+	}
+	out := make([]models.Deployment, len(deployments))
+	copy(out, deployments)
+	return out
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+)
+
+// countingStore counts calls to GetLatestDeployments
+type countingStore struct {
+	database.Store
+	calls int
+}
+
+func (s *countingStore) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	s.calls++
+	return []models.Deployment{{AppName: "test-app"}}, nil
+}
+
+func (s *countingStore) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
+	return &models.Deployment{AppName: req.AppName}, nil
+}
+
+func TestLatestDeploymentsCache(t *testing.T) {
+	backend := &countingStore{}
+	store := New(backend, time.Minute)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.GetLatestDeployments(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if backend.calls != 1 {
+		t.Errorf("Expected 1 backend call while cached, got %d", backend.calls)
+	}
+
+	if _, err := store.CreateDeployment(ctx, models.DeploymentRequest{AppName: "test-app"}, "req"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.GetLatestDeployments(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backend.calls != 2 {
+		t.Errorf("Expected a backend call after invalidation, got %d calls", backend.calls)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := store.GetLatestDeployments(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backend.calls != 3 {
+		t.Errorf("Expected a backend call once the TTL passed, got %d calls", backend.calls)
+	}
+
+	deployments, _ := store.GetLatestDeployments(ctx)
+	deployments[0].AppName = "mutated"
+	cached, _ := store.GetLatestDeployments(ctx)
+	if cached[0].AppName != "test-app" {
+		t.Errorf("Expected cached data to be isolated from callers, got %q", cached[0].AppName)
+	}
+}
@@ -2,16 +2,46 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Database DatabaseConfig `yaml:"database"`
-	Server   ServerConfig   `yaml:"server"`
-	Security SecurityConfig `yaml:"security"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Server     ServerConfig     `yaml:"server"`
+	Security   SecurityConfig   `yaml:"security"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Jobs       JobsConfig       `yaml:"jobs"`
+	Validation ValidationConfig `yaml:"validation"`
+	Push       PushConfig       `yaml:"push"`
+	Manifests  ManifestsConfig  `yaml:"manifests"`
+	Schedules  SchedulesConfig  `yaml:"schedules"`
+	Rollout    RolloutConfig    `yaml:"rollout"`
+	Leader     LeaderConfig     `yaml:"leader"`
+	GitSync    GitSyncConfig    `yaml:"git_sync"`
+	Registry   RegistryConfig   `yaml:"registry"`
+	Observed   ObservedConfig   `yaml:"observed"`
+	Alerts     AlertsConfig     `yaml:"alerts"`
+	SLA        SLAConfig        `yaml:"sla"`
+	Verify     VerifyConfig     `yaml:"verify"`
+	Probes     ProbesConfig     `yaml:"probes"`
+	Smoke      SmokeConfig      `yaml:"smoke"`
+	Logs       LogsConfig       `yaml:"logs"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	BlobStore  BlobStoreConfig  `yaml:"blob_store"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Vault      VaultConfig      `yaml:"vault"`
+	AWS        AWSConfig        `yaml:"aws"`
+	Features   FeaturesConfig   `yaml:"features"`
+	Watchdog   WatchdogConfig   `yaml:"watchdog"`
+	Orphans    OrphansConfig    `yaml:"orphans"`
 }
 
 type DatabaseConfig struct {
@@ -21,16 +51,671 @@ type DatabaseConfig struct {
 	Password string `yaml:"password"`
 	Name     string `yaml:"name"`
 	MaxConns int    `yaml:"max_conns"`
+
+	// StatementCacheCapacity is the per-connection prepared statement cache size
+	StatementCacheCapacity int `yaml:"statement_cache_capacity"`
+	// QueryExecMode selects how pgx sends queries: cache_statement (default),
+	// cache_describe, describe_exec, exec or simple_protocol. Use exec or
+	// simple_protocol behind transaction-pooling proxies such as PgBouncer.
+	QueryExecMode string `yaml:"query_exec_mode"`
+
+	// IDVersion selects the UUID version for new deployment IDs: 4 (random,
+	// default) or 7 (time-ordered, index friendly)
+	IDVersion int `yaml:"id_version"`
+
+	// Local configures the PostgreSQL server started by --local
+	Local LocalPostgresConfig `yaml:"local"`
+}
+
+// LocalPostgresConfig configures the PostgreSQL server --local runs from the
+// binaries installed on the machine
+type LocalPostgresConfig struct {
+	// DataDir holds the server's data; it is initialized on first start and
+	// kept across restarts
+	DataDir string `yaml:"data_dir"`
+
+	// Port is the port the server listens on, on 127.0.0.1 only
+	Port int `yaml:"port"`
+
+	// BinDir is the directory with initdb and postgres; empty searches the
+	// PATH, then the versioned directories Debian and Ubuntu install to
+	BinDir string `yaml:"bin_dir"`
 }
 
 type ServerConfig struct {
 	Port     int    `yaml:"port"`
 	LogLevel string `yaml:"log_level"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+
+	// StreamWriteTimeout replaces WriteTimeout on streaming routes
+	// (exports, long-poll and server-sent events); 0 disables the deadline
+	StreamWriteTimeout time.Duration `yaml:"stream_write_timeout"`
+
+	// DrainDelay is how long the server keeps serving after a shutdown
+	// signal, failing health checks, so load balancers stop routing to it
+	// before it stops listening
+	DrainDelay time.Duration `yaml:"drain_delay"`
+
+	// DrainRetryAfter is the Retry-After hint sent with requests turned away
+	// while draining
+	DrainRetryAfter time.Duration `yaml:"drain_retry_after"`
+
+	// H2C enables cleartext HTTP/2 for deployments behind a TLS-terminating proxy
+	H2C bool `yaml:"h2c"`
+
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	BodyLimits  BodyLimitsConfig  `yaml:"body_limits"`
+	CORS        CORSConfig        `yaml:"cors"`
+}
+
+// CORSConfig is the CORS policy browsers are told to enforce. Routes
+// override it for the paths under a prefix, the longest matching prefix
+// winning; fields a route leaves unset are taken from the enclosing route,
+// or from the server's policy when no route encloses it.
+type CORSConfig struct {
+	CORSPolicy `yaml:",inline"`
+
+	Routes []CORSRoute `yaml:"routes"`
+}
+
+// CORSRoute overrides the CORS policy for the paths under Path
+type CORSRoute struct {
+	Path string `yaml:"path"`
+
+	CORSPolicy `yaml:",inline"`
+}
+
+// CORSPolicy says which cross-origin browser requests are allowed. In a
+// route, nil fields (and a zero max_age) are inherited; an empty
+// allowed_origins list allows no origin.
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as https://dash.example.com; * allows
+	// any origin and https://*.example.com any subdomain. None are allowed
+	// by default.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	ExposedHeaders []string `yaml:"exposed_headers"`
+
+	// AllowCredentials lets browsers send cookies and auth headers
+	// cross-origin; it can't be combined with the * origin
+	AllowCredentials *bool `yaml:"allow_credentials"`
+
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// Resolve returns the policy of each route, keyed by its path without a
+// trailing slash, with the fields it leaves unset inherited: from the
+// nearest enclosing route, found by walking up the path a segment at a
+// time, or from the server's policy
+func (c CORSConfig) Resolve() map[string]CORSPolicy {
+	// Enclosing routes have shorter paths, so resolve those first
+	routes := append([]CORSRoute(nil), c.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].Path) < len(routes[j].Path) })
+
+	resolved := make(map[string]CORSPolicy, len(routes))
+	for _, r := range routes {
+		path := strings.TrimSuffix(r.Path, "/")
+		parent := c.CORSPolicy
+		for up := path; up != ""; {
+			up = up[:max(strings.LastIndex(up, "/"), 0)]
+			if policy, ok := resolved[up]; ok {
+				parent = policy
+				break
+			}
+		}
+		resolved[path] = r.inherit(parent)
+	}
+	return resolved
+}
+
+// inherit returns p with the fields it leaves unset taken from parent
+func (p CORSPolicy) inherit(parent CORSPolicy) CORSPolicy {
+	if p.AllowedOrigins == nil {
+		p.AllowedOrigins = parent.AllowedOrigins
+	}
+	if p.AllowedMethods == nil {
+		p.AllowedMethods = parent.AllowedMethods
+	}
+	if p.AllowedHeaders == nil {
+		p.AllowedHeaders = parent.AllowedHeaders
+	}
+	if p.ExposedHeaders == nil {
+		p.ExposedHeaders = parent.ExposedHeaders
+	}
+	if p.AllowCredentials == nil {
+		p.AllowCredentials = parent.AllowCredentials
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = parent.MaxAge
+	}
+	return p
+}
+
+// ConcurrencyConfig caps in-flight API requests per route class; requests
+// beyond a cap are shed with 503. A zero cap means unlimited.
+type ConcurrencyConfig struct {
+	Push       int           `yaml:"push"`
+	Write      int           `yaml:"write"`
+	Read       int           `yaml:"read"`
+	Tail       int           `yaml:"tail"`
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+// BodyLimitsConfig caps request body size in bytes per route class; larger
+// bodies are rejected with 413 before they are decoded
+type BodyLimitsConfig struct {
+	Default int64 `yaml:"default"`
+	Push    int64 `yaml:"push"`
+	Status  int64 `yaml:"status"`
 }
 
 type SecurityConfig struct {
 	BearerToken   string `yaml:"bearer_token"`
 	EncryptionKey string `yaml:"encryption_key"`
+
+	// BearerTokens, RevealTokens and AgentTokens are accepted alongside
+	// BearerToken, RevealToken and AgentToken, so a new token can be rolled
+	// out before the old one is removed. Token changes are picked up on
+	// SIGHUP or POST /api/v1/admin/tokens/reload without a restart.
+	BearerTokens []string `yaml:"bearer_tokens"`
+	RevealTokens []string `yaml:"reveal_tokens"`
+	AgentTokens  []string `yaml:"agent_tokens"`
+
+	// AllowEmptyTokens lets a reload remove every token of a kind, which
+	// opens the API or disables the reveal scope or agent API; otherwise
+	// such a reload is refused as a likely mistake
+	AllowEmptyTokens bool `yaml:"allow_empty_tokens"`
+
+	// SealingKey is the base64 X25519 private key that opens values clients
+	// sealed to the controller's public key; sealing is disabled when empty
+	SealingKey string `yaml:"sealing_key"`
+
+	// KMS wraps the data keys that encrypt secrets with an external master
+	// key, replacing EncryptionKey (which then only decrypts old values)
+	KMS KMSConfig `yaml:"kms"`
+
+	// RevealToken is an alternative bearer token whose callers see env values
+	// unredacted; everyone else gets values of sensitive keys masked
+	RevealToken string `yaml:"reveal_token"`
+
+	// RedactPatterns are the env key fragments whose values are masked in
+	// logs and responses (default PASSWORD, TOKEN, KEY)
+	RedactPatterns []string `yaml:"redact_patterns"`
+
+	// AgentToken authenticates deployment agents on /api/v1/agent routes,
+	// which return secret values; the agent API is disabled when empty
+	AgentToken string `yaml:"agent_token"`
+}
+
+type CacheConfig struct {
+	LatestDeploymentsTTL time.Duration `yaml:"latest_deployments_ttl"`
+	StatsRefreshInterval time.Duration `yaml:"stats_refresh_interval"`
+
+	// AnalyticsRefreshInterval is how often the analytics summary tables are rebuilt
+	AnalyticsRefreshInterval time.Duration `yaml:"analytics_refresh_interval"`
+}
+
+type JobsConfig struct {
+	// Workers is the number of jobs of each type run at once
+	Workers int `yaml:"workers"`
+
+	// Concurrency overrides Workers for individual job types
+	Concurrency map[string]int `yaml:"concurrency"`
+
+	PollInterval time.Duration `yaml:"poll_interval"`
+
+	// DrainTimeout bounds how long running jobs may take to finish on
+	// shutdown before they are cancelled
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	// MaxAttempts is how many times a failing job runs before it is
+	// dead-lettered
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// RetryBackoff is the delay before a failed job's first retry, doubled
+	// for each further attempt
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// Lease is how long a running job stays claimed without a heartbeat
+	// from its replica; a job whose replica died is claimed again after it
+	Lease time.Duration `yaml:"lease"`
+}
+
+type ValidationConfig struct {
+	MaxEnvVars  int `yaml:"max_env_vars"`
+	MaxEnvBytes int `yaml:"max_env_bytes"`
+
+	// MaxMetadataBytes caps the JSON size of a deployment's metadata
+	MaxMetadataBytes int `yaml:"max_metadata_bytes"`
+
+	// StrictParsing rejects unknown fields in request bodies on write
+	// endpoints; overridable per request with the X-Strict-Parsing header
+	StrictParsing bool `yaml:"strict_parsing"`
+}
+
+type PushConfig struct {
+	// SkipUnchanged makes pushes identical to an app's latest version return
+	// that version instead of creating a new one; overridable per request
+	SkipUnchanged bool `yaml:"skip_unchanged"`
+}
+
+// ManifestsConfig configures manifests rendered for agents
+type ManifestsConfig struct {
+	// InlineSecrets writes secret values into the container environment
+	// instead of native Secret objects, for simple Docker hosts;
+	// overridable per request
+	InlineSecrets bool `yaml:"inline_secrets"`
+}
+
+// SchedulesConfig configures the scheduler for recurring deployments and
+// retries of failed ones
+type SchedulesConfig struct {
+	// Interval is how often due schedules and retries are checked, bounding
+	// how late a run can start
+	Interval time.Duration `yaml:"interval"`
+}
+
+// RolloutConfig configures how many deployments agents may start at once
+type RolloutConfig struct {
+	// MaxDeployingPerDomain caps deploying deployments in domains without
+	// their own rollout limit; 0 means unlimited
+	MaxDeployingPerDomain int `yaml:"max_deploying_per_domain"`
+}
+
+// LeaderConfig configures leader election among controller instances
+type LeaderConfig struct {
+	// InstanceID names this instance in the leader lease; defaults to the
+	// hostname with a random suffix
+	InstanceID string `yaml:"instance_id"`
+
+	// LeaseTTL is how long the leader lease lasts without renewal, and so
+	// how long a crashed leader's background work pauses before another
+	// instance takes over
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+}
+
+// GitSyncConfig configures pulling deployment YAMLs from a git repository
+// and applying them, making the branch the source of truth
+type GitSyncConfig struct {
+	// Repo is the URL to clone, including any credentials; empty disables
+	// git sync
+	Repo   string `yaml:"repo"`
+	Branch string `yaml:"branch"`
+
+	// Path is the directory within the repository holding the YAMLs
+	Path string `yaml:"path"`
+
+	// Interval is how often the branch is fetched and applied
+	Interval time.Duration `yaml:"interval"`
+
+	// Dir is where the repository is checked out
+	Dir string `yaml:"dir"`
+
+	// WebhookSecret verifies push webhooks from GitHub (HMAC signature) or
+	// GitLab (token); empty disables the webhook
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// RegistryConfig configures how the controller queries image registries,
+// authenticating with the stored registry credentials
+type RegistryConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Insecure lists registry hosts (host:port) reached over plain HTTP
+	Insecure []string `yaml:"insecure"`
+
+	// ImageUpdateInterval is how often image policies are checked for new
+	// tags
+	ImageUpdateInterval time.Duration `yaml:"image_update_interval"`
+
+	// DigestCheckInterval is how often deployed mutable tags are resolved
+	// to detect digest drift
+	DigestCheckInterval time.Duration `yaml:"digest_check_interval"`
+
+	// WebhookSecret authenticates registry push webhooks; empty disables
+	// them
+	WebhookSecret string `yaml:"webhook_secret"`
+
+	// FlagDeletedImages makes registry webhooks reporting an image deletion
+	// flag the latest deployments running that image
+	FlagDeletedImages bool `yaml:"flag_deleted_images"`
+}
+
+// ObservedConfig configures the comparison of what agents report running
+// with the desired deployments
+type ObservedConfig struct {
+	// StaleAfter is how old an agent's latest report may be before its app
+	// is reported stale
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+// AlertsConfig configures the failure rate alerts raised when an app's
+// deployments keep failing
+type AlertsConfig struct {
+	// FailureRateThreshold is the share of an app's finished deployments,
+	// between 0 and 1, that may fail within Window before an alert fires
+	FailureRateThreshold float64 `yaml:"failure_rate_threshold"`
+
+	// Window is how far back failure rates are computed
+	Window time.Duration `yaml:"window"`
+
+	// MinDeployments is how many deployments an app must have finished in
+	// the window before it can alert
+	MinDeployments int `yaml:"min_deployments"`
+
+	// Interval is how often failure rates are evaluated
+	Interval time.Duration `yaml:"interval"`
+
+	// WebhookURL receives a JSON notification when an alert fires or
+	// resolves; empty only logs them
+	WebhookURL string `yaml:"webhook_url"`
+
+	// RulesInterval is how often alert rules are evaluated
+	RulesInterval time.Duration `yaml:"rules_interval"`
+
+	// RepeatInterval is how often an alert rule's unacknowledged alert is
+	// notified again while it keeps firing
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+}
+
+// SLAConfig configures the availability report built from the health
+// probes agents report
+type SLAConfig struct {
+	// Windows are the periods the report covers unless a request asks for
+	// others
+	Windows []time.Duration `yaml:"windows"`
+
+	// Target is the availability percentage each app is expected to meet
+	Target float64 `yaml:"target"`
+
+	// Retention is how long health probes are kept; it bounds the windows
+	Retention time.Duration `yaml:"retention"`
+}
+
+// WatchdogConfig configures the detection of deployments stuck pending or
+// deploying, which are marked stalled or failed and alerted on
+type WatchdogConfig struct {
+	// Deploying is how long a deployment may stay deploying (default 1h); a
+	// negative value turns the check off
+	Deploying time.Duration `yaml:"deploying"`
+
+	// Pending is how long a deployment may stay pending; 0 (the default)
+	// turns the check off, since rollout limits and offline agents keep
+	// deployments pending legitimately
+	Pending time.Duration `yaml:"pending"`
+
+	// Action is what stuck deployments become: "stall" (default) marks them
+	// stalled, "fail" fails them so retry policies apply
+	Action string `yaml:"action"`
+
+	// Interval is how often deployments are checked
+	Interval time.Duration `yaml:"interval"`
+}
+
+// VerifyConfig configures the health checks of deployments once agents
+// report them deployed, which end with the deployment verified or degraded
+type VerifyConfig struct {
+	// Enabled turns post-deploy verification on
+	Enabled bool `yaml:"enabled"`
+
+	// HealthURL is the health check URL the controller probes, with
+	// {domain}, {app_name} and {port} replaced from the deployment; empty
+	// leaves probing to agents reporting health probes
+	HealthURL string `yaml:"health_url"`
+
+	// Window is how long after being deployed a deployment is checked
+	Window time.Duration `yaml:"window"`
+
+	// Interval is how often deployments under verification are probed
+	Interval time.Duration `yaml:"interval"`
+
+	// Timeout bounds one probe
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxFailures is how many probes in the window may fail before the
+	// deployment is degraded
+	MaxFailures int `yaml:"max_failures"`
+
+	// Rollback rolls deployments degraded by failed probes back to the
+	// app's previous deployed version
+	Rollback bool `yaml:"rollback"`
+}
+
+// ProbesConfig configures the controller's periodic health probes of
+// deployed apps
+type ProbesConfig struct {
+	// Enabled turns the prober on
+	Enabled bool `yaml:"enabled"`
+
+	// Scheme is http or https
+	Scheme string `yaml:"scheme"`
+
+	// HealthPath is requested on each app's domain, with {app_name}
+	// replaced
+	HealthPath string `yaml:"health_path"`
+
+	// Interval is how often apps are probed
+	Interval time.Duration `yaml:"interval"`
+
+	// Timeout bounds one probe
+	Timeout time.Duration `yaml:"timeout"`
+
+	// StaleAfter is how old an app's latest probe may be before its health
+	// is reported stale
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+// SmokeConfig configures running the smoke tests apps register once their
+// deployments are deployed; http tests use probes.scheme
+type SmokeConfig struct {
+	// Interval is how often newly deployed deployments are looked for
+	Interval time.Duration `yaml:"interval"`
+
+	// Window is how long after being deployed a deployment is still smoke
+	// tested, so tests registered later don't run against old deployments
+	Window time.Duration `yaml:"window"`
+
+	// Timeout bounds one http test
+	Timeout time.Duration `yaml:"timeout"`
+
+	// AgentTimeout is how long an exec test may wait for its agent's report
+	// before it fails
+	AgentTimeout time.Duration `yaml:"agent_timeout"`
+}
+
+// LogsConfig caps the deployment logs agents upload
+type LogsConfig struct {
+	// MaxChunkBytes caps one uploaded chunk
+	MaxChunkBytes int `yaml:"max_chunk_bytes"`
+
+	// MaxBytes caps the whole log of one deployment; chunks past it are
+	// rejected
+	MaxBytes int64 `yaml:"max_bytes"`
+
+	// StreamPollInterval is how often log streams check for new chunks and
+	// the deployment's status without being woken by an upload
+	StreamPollInterval time.Duration `yaml:"stream_poll_interval"`
+}
+
+// RetentionConfig bounds how much deployment history is kept. A zero age or
+// count keeps that data forever.
+type RetentionConfig struct {
+	// Logs is how long a deployment's log is kept after its last chunk
+	Logs time.Duration `yaml:"logs"`
+
+	// Events is how long deployment timeline events are kept
+	Events time.Duration `yaml:"events"`
+
+	// VersionsPerApp is how many of each app's newest versions are kept;
+	// its newest deployed version and unfinished versions are always kept
+	VersionsPerApp int `yaml:"versions_per_app"`
+
+	// Requests is how long push batches are kept for replays
+	Requests time.Duration `yaml:"requests"`
+
+	// Interval is how often the pruning job runs
+	Interval time.Duration `yaml:"interval"`
+
+	// DryRun makes the pruning job only report what it would delete
+	DryRun bool `yaml:"dry_run"`
+}
+
+// OrphansConfig configures the job looking for data left inconsistent by
+// deletions: deployments referencing deleted secret projects, credentials
+// of registries no deployment uses and archived logs with chunks left in
+// Postgres
+type OrphansConfig struct {
+	// Interval is how often the job runs
+	Interval time.Duration `yaml:"interval"`
+
+	// Cleanup makes the job delete the unused credentials and dangling log
+	// chunks it finds instead of only reporting them
+	Cleanup bool `yaml:"cleanup"`
+
+	// RegistryGrace is how long credentials must go unchanged before they
+	// count as unused, so credentials stored ahead of an app's first
+	// deployment are kept
+	RegistryGrace time.Duration `yaml:"registry_grace"`
+}
+
+// BlobStoreConfig configures an S3-compatible object store (AWS S3, MinIO,
+// or GCS through its XML API) that deployment logs, pruned versions and
+// export bundles are archived to, keeping them out of Postgres
+type BlobStoreConfig struct {
+	// Provider is "s3"; empty disables the blob store
+	Provider string `yaml:"provider"`
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+
+	// Prefix is prepended to every object key, e.g. "controller/"
+	Prefix string `yaml:"prefix"`
+
+	// Endpoint replaces the AWS S3 endpoint, e.g. http://minio:9000 or
+	// https://storage.googleapis.com; objects are then addressed path-style
+	Endpoint string `yaml:"endpoint"`
+
+	// AccessKeyID and SecretAccessKey are static credentials (MinIO keys or
+	// GCS HMAC keys); when empty the AWS default credential chain is used
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	// Timeout bounds each request to the store
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// MetricsConfig configures pushing per-app deployment metrics to a
+// Prometheus Pushgateway, for setups that can't scrape the controller
+type MetricsConfig struct {
+	// PushgatewayURL is the Pushgateway base URL; empty disables the push
+	PushgatewayURL string `yaml:"pushgateway_url"`
+
+	// Job is the job label the metrics are grouped under
+	Job string `yaml:"job"`
+
+	// Username and Password, if set, authenticate with HTTP basic auth
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// PushInterval is how often the metrics are pushed
+	PushInterval time.Duration `yaml:"push_interval"`
+}
+
+// VaultConfig configures resolution of vault:// secret references
+type VaultConfig struct {
+	Address string        `yaml:"address"`
+	Token   string        `yaml:"token"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// ResolveMode is "controller" to resolve Vault references when an agent
+	// fetches a deployment, or "agent" to hand the agent a short-lived Vault
+	// token so it resolves them itself
+	ResolveMode string `yaml:"resolve_mode"`
+
+	// AgentTokenTTL and AgentTokenPolicies shape the tokens minted in agent mode
+	AgentTokenTTL      time.Duration `yaml:"agent_token_ttl"`
+	AgentTokenPolicies []string      `yaml:"agent_token_policies"`
+}
+
+// KMSConfig configures envelope encryption of secrets
+type KMSConfig struct {
+	// Provider is "aws", "gcp" or "age"; empty disables envelope encryption
+	Provider string `yaml:"provider"`
+
+	// KeyID is the AWS KMS key ID/ARN/alias, the GCP cryptoKey resource name,
+	// or the age recipient
+	KeyID           string `yaml:"key_id"`
+	Region          string `yaml:"region"`
+	AgeIdentityFile string `yaml:"age_identity_file"`
+
+	// DataKeys are wrapped data keys, newest first. The first encrypts new
+	// values; the others are kept to decrypt values not yet re-encrypted.
+	DataKeys []DataKeyConfig `yaml:"data_keys"`
+}
+
+// DataKeyConfig is a data key wrapped by the KMS master key
+type DataKeyConfig struct {
+	ID      string `yaml:"id"`
+	Wrapped string `yaml:"wrapped"`
+}
+
+// AWSConfig enables resolution of aws-sm:// and aws-ssm:// secret
+// references using the controller's AWS credentials (usually its IAM role)
+type AWSConfig struct {
+	Region         string `yaml:"region"`
+	SecretsManager bool   `yaml:"secrets_manager"`
+	ParameterStore bool   `yaml:"parameter_store"`
+
+	// CacheTTL is how long resolved AWS secret values are reused (default
+	// 5m); a negative value disables caching
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// Feature names a subsystem that can be switched on or off per install
+type Feature string
+
+const (
+	// FeatureGitOps runs git sync and serves its endpoints when git_sync.repo
+	// is set
+	FeatureGitOps Feature = "enable_gitops"
+	// FeatureImageUpdates deploys new images selected by image policies
+	FeatureImageUpdates Feature = "enable_image_updates"
+)
+
+// featureDefaults are the features and whether each is on when the config
+// doesn't say. New subsystems are added here off, so they ship dark.
+var featureDefaults = map[Feature]bool{
+	FeatureGitOps:       true,
+	FeatureImageUpdates: true,
+}
+
+// FeaturesConfig switches features on or off by name; features left out
+// take their defaults
+type FeaturesConfig map[Feature]bool
+
+// Enabled reports whether a feature is on
+func (f FeaturesConfig) Enabled(feature Feature) bool {
+	if enabled, ok := f[feature]; ok {
+		return enabled
+	}
+	return featureDefaults[feature]
+}
+
+// All returns whether each known feature is on
+func (f FeaturesConfig) All() map[Feature]bool {
+	all := make(map[Feature]bool, len(featureDefaults))
+	for feature := range featureDefaults {
+		all[feature] = f.Enabled(feature)
+	}
+	return all
 }
 
 // GetDatabaseURL returns the PostgreSQL connection string
@@ -80,9 +765,357 @@ func Load(configPath string) (*Config, error) {
 	if config.Server.LogLevel == "" {
 		config.Server.LogLevel = "info"
 	}
+	if config.Server.ReadTimeout == 0 {
+		config.Server.ReadTimeout = 30 * time.Second
+	}
+	if config.Server.ReadHeaderTimeout == 0 {
+		config.Server.ReadHeaderTimeout = 10 * time.Second
+	}
+	if config.Server.WriteTimeout == 0 {
+		config.Server.WriteTimeout = 30 * time.Second
+	}
+	if config.Server.IdleTimeout == 0 {
+		config.Server.IdleTimeout = 60 * time.Second
+	}
+	if config.Server.ShutdownTimeout == 0 {
+		config.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if config.Server.DrainRetryAfter == 0 {
+		config.Server.DrainRetryAfter = 5 * time.Second
+	}
+	if config.Server.MaxHeaderBytes == 0 {
+		config.Server.MaxHeaderBytes = 1 << 20
+	}
+	if config.Server.Concurrency.RetryAfter == 0 {
+		config.Server.Concurrency.RetryAfter = 5 * time.Second
+	}
+	if config.Server.BodyLimits.Default == 0 {
+		config.Server.BodyLimits.Default = 1 << 20
+	}
+	if config.Server.BodyLimits.Push == 0 {
+		config.Server.BodyLimits.Push = 10 << 20
+	}
+	if config.Server.BodyLimits.Status == 0 {
+		config.Server.BodyLimits.Status = 4 << 10
+	}
+	if config.Server.CORS.AllowedMethods == nil {
+		config.Server.CORS.AllowedMethods = []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"}
+	}
+	if config.Server.CORS.AllowedHeaders == nil {
+		config.Server.CORS.AllowedHeaders = []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token",
+			"Authorization", "If-Match", "If-None-Match", "Idempotency-Key", "X-Strict-Parsing", "X-Agent-ID"}
+	}
+	if config.Server.CORS.ExposedHeaders == nil {
+		config.Server.CORS.ExposedHeaders = []string{"ETag", "Idempotent-Replayed"}
+	}
+	if config.Server.CORS.MaxAge == 0 {
+		config.Server.CORS.MaxAge = 10 * time.Minute
+	}
+	if err := validateCORS(config.Server.CORS); err != nil {
+		return nil, err
+	}
+	if config.Vault.Token == "" {
+		config.Vault.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.Vault.Timeout == 0 {
+		config.Vault.Timeout = 10 * time.Second
+	}
+	if config.Vault.ResolveMode == "" {
+		config.Vault.ResolveMode = "controller"
+	}
+	if config.Vault.AgentTokenTTL == 0 {
+		config.Vault.AgentTokenTTL = 5 * time.Minute
+	}
+	if config.Security.RedactPatterns == nil {
+		config.Security.RedactPatterns = []string{"PASSWORD", "TOKEN", "KEY"}
+	}
+	if config.AWS.CacheTTL == 0 {
+		config.AWS.CacheTTL = 5 * time.Minute
+	}
+	if config.Vault.ResolveMode != "controller" && config.Vault.ResolveMode != "agent" {
+		return nil, fmt.Errorf("invalid vault.resolve_mode %q: must be controller or agent", config.Vault.ResolveMode)
+	}
 	if config.Database.MaxConns == 0 {
 		config.Database.MaxConns = 100
 	}
+	if config.Database.StatementCacheCapacity == 0 {
+		config.Database.StatementCacheCapacity = 512
+	}
+	if config.Database.IDVersion == 0 {
+		config.Database.IDVersion = 4
+	}
+	if config.Database.QueryExecMode == "" {
+		config.Database.QueryExecMode = "cache_statement"
+	}
+	if config.Database.Local.DataDir == "" {
+		config.Database.Local.DataDir = ".local/postgres"
+	}
+	if config.Database.Local.Port == 0 {
+		config.Database.Local.Port = 5433
+	}
+	if config.Cache.LatestDeploymentsTTL == 0 {
+		config.Cache.LatestDeploymentsTTL = 5 * time.Second
+	}
+	if config.Cache.StatsRefreshInterval == 0 {
+		config.Cache.StatsRefreshInterval = 30 * time.Second
+	}
+	if config.Jobs.Workers == 0 {
+		config.Jobs.Workers = 4
+	}
+	if config.Jobs.PollInterval == 0 {
+		config.Jobs.PollInterval = 5 * time.Second
+	}
+	if config.Jobs.DrainTimeout == 0 {
+		config.Jobs.DrainTimeout = 30 * time.Second
+	}
+	if config.Jobs.MaxAttempts == 0 {
+		config.Jobs.MaxAttempts = 3
+	}
+	if config.Jobs.RetryBackoff == 0 {
+		config.Jobs.RetryBackoff = 30 * time.Second
+	}
+	if config.Jobs.Lease == 0 {
+		config.Jobs.Lease = time.Minute
+	}
+	if config.Schedules.Interval == 0 {
+		config.Schedules.Interval = 30 * time.Second
+	}
+	if config.Leader.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "controller"
+		}
+		config.Leader.InstanceID = hostname + "-" + uuid.NewString()[:8]
+	}
+	if config.Leader.LeaseTTL == 0 {
+		config.Leader.LeaseTTL = 15 * time.Second
+	}
+	if config.GitSync.Branch == "" {
+		config.GitSync.Branch = "main"
+	}
+	if config.GitSync.Interval == 0 {
+		config.GitSync.Interval = time.Minute
+	}
+	if config.GitSync.Dir == "" {
+		config.GitSync.Dir = filepath.Join(os.TempDir(), "deployment-controller-git")
+	}
+	if config.Registry.Timeout == 0 {
+		config.Registry.Timeout = 30 * time.Second
+	}
+	if config.Registry.ImageUpdateInterval == 0 {
+		config.Registry.ImageUpdateInterval = 5 * time.Minute
+	}
+	if config.Registry.DigestCheckInterval == 0 {
+		config.Registry.DigestCheckInterval = 10 * time.Minute
+	}
+	if config.Observed.StaleAfter == 0 {
+		config.Observed.StaleAfter = 5 * time.Minute
+	}
+	if config.Alerts.FailureRateThreshold == 0 {
+		config.Alerts.FailureRateThreshold = 0.5
+	}
+	if config.Alerts.FailureRateThreshold < 0 || config.Alerts.FailureRateThreshold > 1 {
+		return nil, fmt.Errorf("invalid alerts.failure_rate_threshold %v: must be between 0 and 1", config.Alerts.FailureRateThreshold)
+	}
+	if config.Alerts.Window == 0 {
+		config.Alerts.Window = 7 * 24 * time.Hour
+	}
+	if config.Alerts.MinDeployments == 0 {
+		config.Alerts.MinDeployments = 4
+	}
+	if config.Alerts.Interval == 0 {
+		config.Alerts.Interval = 5 * time.Minute
+	}
+	if config.Alerts.RulesInterval == 0 {
+		config.Alerts.RulesInterval = time.Minute
+	}
+	if config.Alerts.RepeatInterval == 0 {
+		config.Alerts.RepeatInterval = 4 * time.Hour
+	}
+	if len(config.SLA.Windows) == 0 {
+		config.SLA.Windows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+	}
+	if config.SLA.Target == 0 {
+		config.SLA.Target = 99.9
+	}
+	if config.SLA.Target < 0 || config.SLA.Target > 100 {
+		return nil, fmt.Errorf("invalid sla.target %v: must be between 0 and 100", config.SLA.Target)
+	}
+	if config.SLA.Retention == 0 {
+		config.SLA.Retention = 90 * 24 * time.Hour
+	}
+	for _, window := range config.SLA.Windows {
+		if window <= 0 || window > config.SLA.Retention {
+			return nil, fmt.Errorf("invalid sla.windows entry %v: must be positive and at most sla.retention", window)
+		}
+	}
+	if config.Watchdog.Deploying == 0 {
+		config.Watchdog.Deploying = time.Hour
+	}
+	if config.Watchdog.Pending < 0 {
+		return nil, fmt.Errorf("invalid watchdog.pending: must not be negative")
+	}
+	if config.Watchdog.Action == "" {
+		config.Watchdog.Action = "stall"
+	}
+	if config.Watchdog.Action != "stall" && config.Watchdog.Action != "fail" {
+		return nil, fmt.Errorf("invalid watchdog.action %q: must be stall or fail", config.Watchdog.Action)
+	}
+	if config.Watchdog.Interval == 0 {
+		config.Watchdog.Interval = time.Minute
+	}
+	if config.Verify.Window == 0 {
+		config.Verify.Window = 5 * time.Minute
+	}
+	if config.Verify.Interval == 0 {
+		config.Verify.Interval = 15 * time.Second
+	}
+	if config.Verify.Timeout == 0 {
+		config.Verify.Timeout = 5 * time.Second
+	}
+	if config.Probes.Scheme == "" {
+		config.Probes.Scheme = "https"
+	}
+	if config.Probes.Scheme != "http" && config.Probes.Scheme != "https" {
+		return nil, fmt.Errorf("invalid probes.scheme %q: must be http or https", config.Probes.Scheme)
+	}
+	if config.Probes.HealthPath == "" {
+		config.Probes.HealthPath = "/healthz"
+	}
+	if config.Probes.Interval == 0 {
+		config.Probes.Interval = 30 * time.Second
+	}
+	if config.Probes.Timeout == 0 {
+		config.Probes.Timeout = 5 * time.Second
+	}
+	if config.Probes.StaleAfter == 0 {
+		config.Probes.StaleAfter = 2 * time.Minute
+	}
+	if config.Smoke.Interval == 0 {
+		config.Smoke.Interval = 15 * time.Second
+	}
+	if config.Smoke.Window == 0 {
+		config.Smoke.Window = time.Hour
+	}
+	if config.Smoke.Timeout == 0 {
+		config.Smoke.Timeout = 10 * time.Second
+	}
+	if config.Smoke.AgentTimeout == 0 {
+		config.Smoke.AgentTimeout = 10 * time.Minute
+	}
+	if config.Logs.MaxChunkBytes == 0 {
+		config.Logs.MaxChunkBytes = 256 << 10
+	}
+	if config.Logs.MaxBytes == 0 {
+		config.Logs.MaxBytes = 10 << 20
+	}
+	if config.Logs.StreamPollInterval == 0 {
+		config.Logs.StreamPollInterval = 5 * time.Second
+	}
+	if config.Retention.Logs < 0 || config.Retention.Events < 0 || config.Retention.VersionsPerApp < 0 || config.Retention.Requests < 0 {
+		return nil, fmt.Errorf("invalid retention: logs, events, versions_per_app and requests must not be negative")
+	}
+	if config.Retention.Interval == 0 {
+		config.Retention.Interval = time.Hour
+	}
+	if config.Orphans.Interval == 0 {
+		config.Orphans.Interval = 6 * time.Hour
+	}
+	if config.Orphans.RegistryGrace == 0 {
+		config.Orphans.RegistryGrace = 24 * time.Hour
+	}
+	if config.Orphans.RegistryGrace < 0 {
+		return nil, fmt.Errorf("invalid orphans.registry_grace: must not be negative")
+	}
+	if config.BlobStore.Provider != "" {
+		if config.BlobStore.Provider != "s3" {
+			return nil, fmt.Errorf("invalid blob_store.provider %q: must be s3", config.BlobStore.Provider)
+		}
+		if config.BlobStore.Bucket == "" {
+			return nil, fmt.Errorf("blob_store.bucket is required")
+		}
+		if endpoint := config.BlobStore.Endpoint; endpoint != "" {
+			if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid blob_store.endpoint %q: must be an http or https URL", endpoint)
+			}
+		}
+		if (config.BlobStore.AccessKeyID == "") != (config.BlobStore.SecretAccessKey == "") {
+			return nil, fmt.Errorf("blob_store.access_key_id and blob_store.secret_access_key must be set together")
+		}
+	}
+	if config.BlobStore.Region == "" {
+		config.BlobStore.Region = "us-east-1"
+	}
+	if config.BlobStore.Timeout == 0 {
+		config.BlobStore.Timeout = 30 * time.Second
+	}
+	if config.Metrics.Job == "" {
+		config.Metrics.Job = "deployment_controller"
+	}
+	if config.Metrics.PushInterval == 0 {
+		config.Metrics.PushInterval = 5 * time.Minute
+	}
+	if config.Validation.MaxEnvVars == 0 {
+		config.Validation.MaxEnvVars = 200
+	}
+	if config.Validation.MaxEnvBytes == 0 {
+		config.Validation.MaxEnvBytes = 64 * 1024
+	}
+	if config.Validation.MaxMetadataBytes == 0 {
+		config.Validation.MaxMetadataBytes = 4 * 1024
+	}
+	if config.Cache.AnalyticsRefreshInterval == 0 {
+		config.Cache.AnalyticsRefreshInterval = 5 * time.Minute
+	}
+	for feature := range config.Features {
+		if _, ok := featureDefaults[feature]; !ok {
+			return nil, fmt.Errorf("unknown feature %q in features", feature)
+		}
+	}
 
 	return &config, nil
 }
+
+// validateCORS checks the CORS policy and each route's policy as it applies
+// once inherited fields are filled in
+func validateCORS(cfg CORSConfig) error {
+	check := func(name string, origins []string, credentials *bool) error {
+		for _, origin := range origins {
+			if origin == "*" {
+				if credentials != nil && *credentials {
+					return fmt.Errorf("invalid %s: the * origin can't be combined with allow_credentials", name)
+				}
+				continue
+			}
+			u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+				return fmt.Errorf("invalid %s origin %q: must be *, or a scheme and host such as https://dash.example.com", name, origin)
+			}
+		}
+		return nil
+	}
+
+	if err := check("server.cors", cfg.AllowedOrigins, cfg.AllowCredentials); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, route := range cfg.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("invalid server.cors.routes path %q: must start with /", route.Path)
+		}
+		path := strings.TrimSuffix(route.Path, "/")
+		if seen[path] {
+			return fmt.Errorf("duplicate server.cors.routes path %q", route.Path)
+		}
+		seen[path] = true
+	}
+
+	resolved := cfg.Resolve()
+	for _, route := range cfg.Routes {
+		policy := resolved[strings.TrimSuffix(route.Path, "/")]
+		if err := check("server.cors.routes["+route.Path+"]", policy.AllowedOrigins, policy.AllowCredentials); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package cors resolves the configured CORS policy for a request and the
+// headers that tell browsers what it allows.
+package cors
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deployment-controller/internal/config"
+)
+
+// Policy is the CORS policy of a set of routes
+type Policy struct {
+	anyOrigin bool
+	origins   map[string]bool
+
+	// suffixes match subdomain origins: https://*.example.com becomes
+	// https:// and .example.com
+	suffixes [][2]string
+
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// Policies is the server's CORS policy and its per-route overrides
+type Policies struct {
+	base   *Policy
+	routes []route
+}
+
+type route struct {
+	path   string
+	policy *Policy
+}
+
+// New resolves cfg, which config.Load has validated, into policies
+func New(cfg config.CORSConfig) *Policies {
+	p := &Policies{base: newPolicy(cfg.CORSPolicy)}
+	for path, policy := range cfg.Resolve() {
+		p.routes = append(p.routes, route{path: path, policy: newPolicy(policy)})
+	}
+
+	// The longest matching prefix wins
+	sort.Slice(p.routes, func(i, j int) bool { return len(p.routes[i].path) > len(p.routes[j].path) })
+	return p
+}
+
+func newPolicy(cfg config.CORSPolicy) *Policy {
+	p := &Policy{
+		origins:     map[string]bool{},
+		methods:     strings.Join(cfg.AllowedMethods, ", "),
+		headers:     strings.Join(cfg.AllowedHeaders, ", "),
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+		credentials: cfg.AllowCredentials != nil && *cfg.AllowCredentials,
+		maxAge:      strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			p.anyOrigin = true
+		} else if scheme, host, ok := strings.Cut(origin, "://*."); ok {
+			p.suffixes = append(p.suffixes, [2]string{scheme + "://", "." + host})
+		} else {
+			p.origins[origin] = true
+		}
+	}
+	return p
+}
+
+// For returns the policy of the route at path: that of the longest route
+// prefix path is under, or the server's
+func (p *Policies) For(path string) *Policy {
+	for _, r := range p.routes {
+		if path == r.path || strings.HasPrefix(path, r.path+"/") {
+			return r.policy
+		}
+	}
+	return p.base
+}
+
+// allows reports whether origin may make cross-origin requests
+func (p *Policy) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, s := range p.suffixes {
+		if host, ok := strings.CutPrefix(origin, s[0]); ok && strings.HasSuffix(host, s[1]) && len(host) > len(s[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns the CORS headers of a response to a request from origin,
+// including those answering a preflight, or false when origin isn't
+// allowed. Responses vary by origin either way.
+func (p *Policy) Headers(origin string, preflight bool) (http.Header, bool) {
+	h := http.Header{}
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if !p.allows(origin) {
+		return h, false
+	}
+
+	// Credentialed responses must name the origin rather than *
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if preflight {
+		if p.methods != "" {
+			h.Set("Access-Control-Allow-Methods", p.methods)
+		}
+		if p.headers != "" {
+			h.Set("Access-Control-Allow-Headers", p.headers)
+		}
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	} else if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+	return h, true
+}
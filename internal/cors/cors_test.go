@@ -0,0 +1,142 @@
+package cors
+
+import (
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+)
+
+func TestPolicyOrigins(t *testing.T) {
+	policies := New(config.CORSConfig{CORSPolicy: config.CORSPolicy{
+		AllowedOrigins: []string{"https://dash.example.com", "https://*.internal.example.com"},
+		ExposedHeaders: []string{"ETag"},
+	}})
+	policy := policies.For("/api/v1/deployments")
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://dash.example.com", true},
+		{"HTTPS://Dash.Example.com", true},
+		{"http://dash.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://a.internal.example.com", true},
+		{"https://a.b.internal.example.com", true},
+		{"https://internal.example.com", false},
+		{"https://evilinternal.example.com", false},
+	}
+	for _, tt := range tests {
+		headers, allowed := policy.Headers(tt.origin, false)
+		if allowed != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.origin, tt.allowed, allowed)
+		}
+		if got := headers.Get("Access-Control-Allow-Origin"); (got == tt.origin) != tt.allowed {
+			t.Errorf("%s: unexpected Access-Control-Allow-Origin %q", tt.origin, got)
+		}
+		if headers.Get("Vary") != "Origin" {
+			t.Errorf("%s: expected responses to vary by origin, got %v", tt.origin, headers.Values("Vary"))
+		}
+	}
+
+	if headers, _ := policy.Headers("https://dash.example.com", false); headers.Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Expected exposed headers, got %v", headers)
+	}
+}
+
+func TestPolicyDefaultsToNoOrigins(t *testing.T) {
+	policy := New(config.CORSConfig{}).For("/api/v1/push")
+	if headers, allowed := policy.Headers("https://dash.example.com", true); allowed || headers.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no origin to be allowed, got %v", headers)
+	}
+}
+
+func TestPolicyRouteOverrides(t *testing.T) {
+	yes := true
+	policies := New(config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Authorization"},
+			MaxAge:         10 * time.Minute,
+		},
+		Routes: []config.CORSRoute{
+			{Path: "/api/v1/agent", CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{}}},
+			{Path: "/api/v1/secrets", CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"https://vault-ui.example.com"}, AllowCredentials: &yes}},
+			{Path: "/api/v1/secrets/payments/", CORSPolicy: config.CORSPolicy{AllowedMethods: []string{"GET"}}},
+		},
+	})
+
+	headers, allowed := policies.For("/api/v1/deployments").Headers("https://any.example.com", true)
+	if !allowed || headers.Get("Access-Control-Allow-Origin") != "*" || headers.Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		headers.Get("Access-Control-Allow-Headers") != "Authorization" || headers.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected the server policy's preflight headers, got %v", headers)
+	}
+
+	if _, allowed := policies.For("/api/v1/agent/claim").Headers("https://any.example.com", true); allowed {
+		t.Error("Expected the agent routes to allow no origins")
+	}
+	if _, allowed := policies.For("/api/v1/agents").Headers("https://any.example.com", true); !allowed {
+		t.Error("Expected route prefixes to match whole path segments")
+	}
+
+	headers, allowed = policies.For("/api/v1/secrets").Headers("https://vault-ui.example.com", false)
+	if !allowed || headers.Get("Access-Control-Allow-Origin") != "https://vault-ui.example.com" || headers.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected a credentialed response naming the origin, got %v", headers)
+	}
+
+	// The longest prefix wins, taking what it leaves unset from the
+	// enclosing route and what that leaves unset from the server
+	headers, allowed = policies.For("/api/v1/secrets/payments/db").Headers("https://vault-ui.example.com", true)
+	if !allowed || headers.Get("Access-Control-Allow-Methods") != "GET" || headers.Get("Access-Control-Allow-Headers") != "Authorization" ||
+		headers.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the nested route's methods with inherited headers and credentials, got %v", headers)
+	}
+	if _, allowed := policies.For("/api/v1/secrets/payments/db").Headers("https://any.example.com", true); allowed {
+		t.Error("Expected the nested route to inherit the enclosing route's origins, not the server's")
+	}
+}
+
+func TestPolicyRouteChain(t *testing.T) {
+	policies := New(config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "DELETE"},
+			MaxAge:         10 * time.Minute,
+		},
+		// Listed child first; a route inherits from its nearest enclosing
+		// route however the config orders them
+		Routes: []config.CORSRoute{
+			{Path: "/api/v1/admin/backups/exports", CORSPolicy: config.CORSPolicy{AllowedMethods: []string{"GET"}}},
+			{Path: "/api/v1/admin", CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"https://ops.example.com"}, MaxAge: time.Minute}},
+		},
+	})
+
+	tests := []struct {
+		path    string
+		origin  string
+		allowed bool
+		methods string
+		maxAge  string
+	}{
+		{"/api/v1/deployments", "https://any.example.com", true, "GET, POST, DELETE", "600"},
+		{"/api/v1/admin/freeze", "https://any.example.com", false, "", ""},
+		{"/api/v1/admin/freeze", "https://ops.example.com", true, "GET, POST, DELETE", "60"},
+		{"/api/v1/admin/backups/exports/latest", "https://any.example.com", false, "", ""},
+		{"/api/v1/admin/backups/exports/latest", "https://ops.example.com", true, "GET", "60"},
+	}
+	for _, tt := range tests {
+		headers, allowed := policies.For(tt.path).Headers(tt.origin, true)
+		if allowed != tt.allowed {
+			t.Errorf("%s from %s: expected allowed=%v, got %v", tt.path, tt.origin, tt.allowed, allowed)
+			continue
+		}
+		if got := headers.Get("Access-Control-Allow-Methods"); got != tt.methods {
+			t.Errorf("%s: expected methods %q, got %q", tt.path, tt.methods, got)
+		}
+		if got := headers.Get("Access-Control-Max-Age"); got != tt.maxAge {
+			t.Errorf("%s: expected max age %q, got %q", tt.path, tt.maxAge, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const alertRuleColumns = `name, kind, domain, app_name, for_seconds, window_seconds, threshold, min_deployments, silenced_until, updated_at`
+
+func scanAlertRule(row pgx.Row, rule *models.AlertRule) error {
+	return row.Scan(&rule.Name, &rule.Kind, &rule.Domain, &rule.AppName, &rule.ForSeconds,
+		&rule.WindowSeconds, &rule.Threshold, &rule.MinDeployments, &rule.SilencedUntil, &rule.UpdatedAt)
+}
+
+const ruleAlertColumns = `rule_name, domain, app_name, value, firing_since, notified_at, acknowledged_at, acknowledged_by`
+
+func scanRuleAlert(row pgx.Row, alert *models.RuleAlert) error {
+	return row.Scan(&alert.Rule, &alert.Domain, &alert.AppName, &alert.Value, &alert.FiringSince,
+		&alert.NotifiedAt, &alert.AcknowledgedAt, &alert.AcknowledgedBy)
+}
+
+// UpsertAlertRule creates or replaces an alert rule, keeping any silence.
+// Alerts it fired that no longer match are resolved on its next evaluation.
+func (db *DB) UpsertAlertRule(ctx context.Context, rule models.AlertRule) (*models.AlertRule, error) {
+	query := `
+		INSERT INTO alert_rules (name, kind, domain, app_name, for_seconds, window_seconds, threshold, min_deployments)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE
+		SET kind = EXCLUDED.kind,
+		    domain = EXCLUDED.domain,
+		    app_name = EXCLUDED.app_name,
+		    for_seconds = EXCLUDED.for_seconds,
+		    window_seconds = EXCLUDED.window_seconds,
+		    threshold = EXCLUDED.threshold,
+		    min_deployments = EXCLUDED.min_deployments,
+		    updated_at = NOW()
+		RETURNING ` + alertRuleColumns
+	stored := &models.AlertRule{}
+	row := db.Pool.QueryRow(ctx, query, rule.Name, rule.Kind, rule.Domain, rule.AppName,
+		rule.ForSeconds, rule.WindowSeconds, rule.Threshold, rule.MinDeployments)
+	if err := scanAlertRule(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to upsert alert rule: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetAlertRule gets an alert rule by name
+func (db *DB) GetAlertRule(ctx context.Context, name string) (*models.AlertRule, error) {
+	rule := &models.AlertRule{}
+	if err := scanAlertRule(db.Pool.QueryRow(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE name = $1`, name), rule); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("alert rule not found")
+		}
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// ListAlertRules lists all alert rules ordered by name
+func (db *DB) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.AlertRule{}
+	for rows.Next() {
+		var rule models.AlertRule
+		if err := scanAlertRule(rows, &rule); err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// DeleteAlertRule deletes an alert rule and its alerts
+func (db *DB) DeleteAlertRule(ctx context.Context, name string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM alert_rules WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("alert rule not found")
+	}
+
+	return nil
+}
+
+// SilenceAlertRule mutes an alert rule's notifications until the given
+// time, or unmutes them when until is nil
+func (db *DB) SilenceAlertRule(ctx context.Context, name string, until *time.Time) (*models.AlertRule, error) {
+	query := `UPDATE alert_rules SET silenced_until = $2 WHERE name = $1 RETURNING ` + alertRuleColumns
+	rule := &models.AlertRule{}
+	if err := scanAlertRule(db.Pool.QueryRow(ctx, query, name, until), rule); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("alert rule not found")
+		}
+		return nil, fmt.Errorf("failed to silence alert rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// ListRuleAlerts lists the firing alerts of every rule ordered by rule,
+// domain and app name
+func (db *DB) ListRuleAlerts(ctx context.Context) ([]models.RuleAlert, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+ruleAlertColumns+` FROM rule_alerts ORDER BY rule_name, domain, app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rule alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.RuleAlert{}
+	for rows.Next() {
+		var alert models.RuleAlert
+		if err := scanRuleAlert(rows, &alert); err != nil {
+			return nil, fmt.Errorf("failed to scan rule alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rule alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// FireRuleAlert records that a rule's alert is firing on an app, updating
+// its value and, when set, when it was last notified
+func (db *DB) FireRuleAlert(ctx context.Context, alert models.RuleAlert) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO rule_alerts (rule_name, domain, app_name, value, notified_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (rule_name, domain, app_name) DO UPDATE
+		SET value = EXCLUDED.value,
+		    notified_at = COALESCE(EXCLUDED.notified_at, rule_alerts.notified_at)
+	`, alert.Rule, alert.Domain, alert.AppName, alert.Value, alert.NotifiedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record rule alert: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveRuleAlert removes a rule's firing alert on an app
+func (db *DB) ResolveRuleAlert(ctx context.Context, rule, domain, appName string) error {
+	_, err := db.Pool.Exec(ctx, "DELETE FROM rule_alerts WHERE rule_name = $1 AND domain = $2 AND app_name = $3",
+		rule, domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve rule alert: %w", err)
+	}
+
+	return nil
+}
+
+// AcknowledgeRuleAlert marks a rule's firing alert on an app acknowledged,
+// stopping its repeated notifications
+func (db *DB) AcknowledgeRuleAlert(ctx context.Context, rule, domain, appName, actor string) (*models.RuleAlert, error) {
+	query := `
+		UPDATE rule_alerts SET acknowledged_at = NOW(), acknowledged_by = $4
+		WHERE rule_name = $1 AND domain = $2 AND app_name = $3
+		RETURNING ` + ruleAlertColumns
+	alert := &models.RuleAlert{}
+	if err := scanRuleAlert(db.Pool.QueryRow(ctx, query, rule, domain, appName, actor), alert); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("alert not found")
+		}
+		return nil, fmt.Errorf("failed to acknowledge rule alert: %w", err)
+	}
+
+	return alert, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+)
+
+// ListFailureRateAlerts lists the firing failure rate alerts ordered by
+// domain and app name
+func (db *DB) ListFailureRateAlerts(ctx context.Context) ([]models.FailureRateAlert, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT domain, app_name, failure_rate, firing_since
+		FROM failure_rate_alerts
+		ORDER BY domain, app_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failure rate alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.FailureRateAlert{}
+	for rows.Next() {
+		var alert models.FailureRateAlert
+		if err := rows.Scan(&alert.Domain, &alert.AppName, &alert.FailureRate, &alert.FiringSince); err != nil {
+			return nil, fmt.Errorf("failed to scan failure rate alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating failure rate alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// FireFailureRateAlert records that an app's failure rate alert fired
+func (db *DB) FireFailureRateAlert(ctx context.Context, domain, appName string, failureRate float64) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO failure_rate_alerts (domain, app_name, failure_rate)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (domain, app_name) DO UPDATE SET failure_rate = EXCLUDED.failure_rate
+	`, domain, appName, failureRate)
+	if err != nil {
+		return fmt.Errorf("failed to record failure rate alert: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveFailureRateAlert removes an app's firing failure rate alert
+func (db *DB) ResolveFailureRateAlert(ctx context.Context, domain, appName string) error {
+	_, err := db.Pool.Exec(ctx, "DELETE FROM failure_rate_alerts WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve failure rate alert: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// RefreshAnalytics recomputes the analytics summary tables. The per-app
+// summary is rebuilt in full; daily counts are recomputed for every day with
+// a deployment whose status changed since the last refresh, so a deployment
+// that fails days after it was created still lands in its day's counts.
+// Days are UTC, whatever the session's time zone.
+func (db *DB) RefreshAnalytics(ctx context.Context) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM app_deployment_summary"); err != nil {
+		return fmt.Errorf("failed to clear app summary: %w", err)
+	}
+
+	query := `
+		INSERT INTO app_deployment_summary
+		(domain, app_name, total_versions, deployed_count, failed_count,
+		 current_version, current_status, last_created_at, last_deployed_at, refreshed_at)
+		SELECT d.domain, d.app_name,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE d.status = 'deployed'),
+		       COUNT(*) FILTER (WHERE d.status = 'failed'),
+		       l.version, l.status,
+		       MAX(d.created_at), MAX(d.deployed_at), NOW()
+		FROM deployments d
+		JOIN latest_deployments l ON l.domain = d.domain AND l.app_name = d.app_name
+		GROUP BY d.domain, d.app_name, l.version, l.status
+	`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to aggregate app summary: %w", err)
+	}
+
+	query = `
+		INSERT INTO deployment_daily_counts
+		(day, domain, app_name, created_count, deployed_count, failed_count, refreshed_at)
+		WITH touched AS (
+			-- The margin covers status changes committed after the last
+			-- refresh read the table but stamped before it did
+			SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date AS day
+			FROM deployments
+			WHERE status_changed_at >= COALESCE(
+				(SELECT MAX(refreshed_at) - INTERVAL '1 hour' FROM deployment_daily_counts),
+				'-infinity'::timestamptz)
+		)
+		SELECT t.day, d.domain, d.app_name,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE d.status = 'deployed'),
+		       COUNT(*) FILTER (WHERE d.status = 'failed'),
+		       NOW()
+		FROM touched t
+		JOIN deployments d
+		  ON d.created_at >= t.day::timestamp AT TIME ZONE 'UTC'
+		 AND d.created_at < (t.day + 1)::timestamp AT TIME ZONE 'UTC'
+		GROUP BY t.day, d.domain, d.app_name
+		ON CONFLICT (day, domain, app_name) DO UPDATE SET
+			created_count = EXCLUDED.created_count,
+			deployed_count = EXCLUDED.deployed_count,
+			failed_count = EXCLUDED.failed_count,
+			refreshed_at = EXCLUDED.refreshed_at
+	`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to aggregate daily counts: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetAppSummaries gets the precomputed per-app deployment summary
+func (db *DB) GetAppSummaries(ctx context.Context) ([]models.AppSummary, error) {
+	query := `
+		SELECT domain, app_name, total_versions, deployed_count, failed_count,
+		       current_version, current_status, last_created_at, last_deployed_at, refreshed_at
+		FROM app_deployment_summary
+		ORDER BY domain, app_name
+	`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query app summary: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []models.AppSummary{}
+	for rows.Next() {
+		var s models.AppSummary
+		err := rows.Scan(
+			&s.Domain, &s.AppName, &s.TotalVersions, &s.DeployedCount, &s.FailedCount,
+			&s.CurrentVersion, &s.CurrentStatus, &s.LastCreatedAt, &s.LastDeployedAt, &s.RefreshedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan app summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, nil
+}
+
+// GetDeploymentTrends gets precomputed daily deployment counts since the given day
+func (db *DB) GetDeploymentTrends(ctx context.Context, since time.Time) ([]models.DailyDeploymentCount, error) {
+	query := `
+		SELECT day, domain, app_name, created_count, deployed_count, failed_count
+		FROM deployment_daily_counts
+		WHERE day >= ($1::timestamptz AT TIME ZONE 'UTC')::date
+		ORDER BY day, domain, app_name
+	`
+	rows, err := db.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment trends: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.DailyDeploymentCount{}
+	for rows.Next() {
+		var count models.DailyDeploymentCount
+		err := rows.Scan(
+			&count.Day, &count.Domain, &count.AppName,
+			&count.CreatedCount, &count.DeployedCount, &count.FailedCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment trend: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
+
+// GetTopApps gets up to limit apps with the most versions pushed (by
+// deploy_count) or failed (by failures) since the given day, from the
+// precomputed daily counts. Apps without any are left out.
+func (db *DB) GetTopApps(ctx context.Context, by string, since time.Time, limit int) ([]models.TopApp, error) {
+	order := "created_count"
+	if by == models.TopByFailures {
+		order = "failed_count"
+	}
+	query := `
+		SELECT domain, app_name,
+		       SUM(created_count) AS created_count,
+		       SUM(deployed_count) AS deployed_count,
+		       SUM(failed_count) AS failed_count
+		FROM deployment_daily_counts
+		WHERE day >= ($1::timestamptz AT TIME ZONE 'UTC')::date
+		GROUP BY domain, app_name
+		HAVING SUM(` + order + `) > 0
+		ORDER BY ` + order + ` DESC, domain, app_name
+		LIMIT $2
+	`
+	rows, err := db.Pool.Query(ctx, query, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top apps: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []models.TopApp{}
+	for rows.Next() {
+		var app models.TopApp
+		err := rows.Scan(&app.Domain, &app.AppName, &app.CreatedCount, &app.DeployedCount, &app.FailedCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan top app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// RecordAuditEvents stores audit events in a single transaction
+func (db *DB) RecordAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, event := range events {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO audit_events (action, resource, actor, client_ip, deployment_id, detail)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''))
+		`, event.Action, event.Resource, event.Actor, event.ClientIP, event.DeploymentID, event.Detail)
+		if err != nil {
+			return fmt.Errorf("failed to record audit event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditEvents lists a resource's audit events, newest first, resuming
+// after the cursor
+func (db *DB) ListAuditEvents(ctx context.Context, resource string, after *models.Cursor, limit int) ([]models.AuditEvent, error) {
+	query := `
+		SELECT id, action, resource, actor, COALESCE(client_ip, ''), deployment_id, COALESCE(detail, ''), created_at
+		FROM audit_events
+		WHERE resource = $1
+		  AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+	var afterCreatedAt *time.Time
+	var afterID *uuid.UUID
+	if after != nil {
+		afterCreatedAt = &after.CreatedAt
+		afterID = &after.ID
+	}
+
+	rows, err := db.Pool.Query(ctx, query, resource, afterCreatedAt, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(&event.ID, &event.Action, &event.Resource, &event.Actor,
+			&event.ClientIP, &event.DeploymentID, &event.Detail, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit events: %w", err)
+	}
+
+	return events, nil
+}
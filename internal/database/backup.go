@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// backupTables lists the tables copied by a backup, each after the tables
+// it references so a restore can insert them in order. Caches, analytics,
+// probes, alerts, logs, jobs and leases are rebuilt or expire on their own
+// and are left out.
+var backupTables = []string{
+	"deployments",
+	"deployment_events",
+	"deployment_checks",
+	"manifest_snapshots",
+	"archived_deployment_logs",
+	"docker_credentials",
+	"secrets",
+	"secret_versions",
+	"schedules",
+	"retry_policies",
+	"rollout_limits",
+	"image_policies",
+	"alert_rules",
+	"health_checks",
+	"smoke_tests",
+	"app_maintenance",
+	"audit_events",
+}
+
+// deploymentChildTables reference deployments by deployment_id; rows whose
+// deployment was skipped on restore are skipped with it
+var deploymentChildTables = map[string]bool{
+	"deployment_events":        true,
+	"deployment_checks":        true,
+	"manifest_snapshots":       true,
+	"archived_deployment_logs": true,
+}
+
+// serialColumns are the BIGSERIAL columns whose sequences are moved past
+// the restored rows
+var serialColumns = map[string]string{
+	"manifest_snapshots": "id",
+}
+
+// Backup copies the rows of every backed-up table as JSON objects, all read
+// from one snapshot so the copy is consistent
+func (db *DB) Backup(ctx context.Context) (map[string][]json.RawMessage, error) {
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tables := make(map[string][]json.RawMessage, len(backupTables))
+	for _, table := range backupTables {
+		query := `SELECT COALESCE(jsonb_agg(t), '[]') FROM ` + pgx.Identifier{table}.Sanitize() + ` t`
+		var rows []json.RawMessage
+		if err := tx.QueryRow(ctx, query).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", table, err)
+		}
+		tables[table] = rows
+	}
+
+	return tables, nil
+}
+
+// RestoreBackup inserts the rows of a backup in one transaction, skipping
+// rows that conflict with existing ones. With failOnConflict any skipped row
+// aborts the restore, and a dry run is always rolled back; both still
+// report what each table would get. Columns missing from the backup take
+// their defaults and columns no longer in the schema are ignored.
+func (db *DB) RestoreBackup(ctx context.Context, tables map[string][]json.RawMessage, failOnConflict, dryRun bool) ([]models.RestoreTableResult, error) {
+	for table := range tables {
+		if !slices.Contains(backupTables, table) {
+			return nil, fmt.Errorf("unknown backup table %q", table)
+		}
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	results := []models.RestoreTableResult{}
+	conflicts := false
+	for _, table := range backupTables {
+		rows, ok := tables[table]
+		if !ok || len(rows) == 0 {
+			continue
+		}
+
+		restored, err := restoreTable(ctx, tx, table, rows)
+		if err != nil {
+			return nil, err
+		}
+		result := models.RestoreTableResult{
+			Table:    table,
+			Rows:     len(rows),
+			Restored: restored,
+			Skipped:  len(rows) - restored,
+		}
+		conflicts = conflicts || result.Skipped > 0
+		results = append(results, result)
+	}
+
+	if failOnConflict && conflicts {
+		return results, fmt.Errorf("backup conflicts with existing rows")
+	}
+	if dryRun {
+		return results, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+// restoreTable inserts one table's rows, returning how many were inserted
+func restoreTable(ctx context.Context, tx pgx.Tx, table string, rows []json.RawMessage) (int, error) {
+	columns, err := restoreColumns(ctx, tx, table, rows[0])
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(rows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s rows: %w", table, err)
+	}
+
+	ident := pgx.Identifier{table}.Sanitize()
+	list := strings.Join(columns, ", ")
+	query := `
+		INSERT INTO ` + ident + ` (` + list + `)
+		SELECT ` + list + ` FROM jsonb_populate_recordset(NULL::` + ident + `, $1::jsonb) r`
+	if deploymentChildTables[table] {
+		query += `
+		WHERE EXISTS (SELECT 1 FROM deployments d WHERE d.id = r.deployment_id)`
+	}
+	query += `
+		ON CONFLICT DO NOTHING`
+
+	tag, err := tx.Exec(ctx, query, string(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore %s: %w", table, err)
+	}
+
+	if column, ok := serialColumns[table]; ok {
+		_, err := tx.Exec(ctx, `
+			SELECT setval(pg_get_serial_sequence($1, $2), GREATEST((SELECT MAX(`+pgx.Identifier{column}.Sanitize()+`) FROM `+ident+`), 1))
+		`, table, column)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reset %s sequence: %w", table, err)
+		}
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// restoreColumns returns the quoted columns of table present in a backed-up
+// row
+func restoreColumns(ctx context.Context, tx pgx.Tx, table string, row json.RawMessage) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return nil, fmt.Errorf("invalid %s row: %w", table, err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("failed to scan %s column: %w", table, err)
+		}
+		if _, ok := fields[column]; ok {
+			columns = append(columns, pgx.Identifier{column}.Sanitize())
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s columns: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("backup rows of %s match none of its columns", table)
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+)
+
+// BatchItemError identifies the item that caused a batch to be rolled back
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// CreateDeploymentBatch creates every deployment in a single transaction.
+// If any item fails the whole batch is rolled back and a *BatchItemError is
+// returned. With skipUnchanged, items identical to their app's latest
+// version return that version flagged Unchanged instead of a new one.
+func (db *DB) CreateDeploymentBatch(ctx context.Context, reqs models.DeploymentPushRequest, requestID string, skipUnchanged bool) ([]models.Deployment, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	deployments := make([]models.Deployment, 0, len(reqs))
+	for i, req := range reqs {
+		if skipUnchanged {
+			latest, err := getLatestDeployment(ctx, tx, req.Domain, req.AppName)
+			if err != nil && err.Error() != "deployment not found" {
+				return nil, &BatchItemError{Index: i, Err: err}
+			}
+			if latest != nil && latest.Matches(req) {
+				latest.Unchanged = true
+				deployments = append(deployments, *latest)
+				continue
+			}
+		}
+
+		id, err := db.newDeploymentID()
+		if err != nil {
+			return nil, &BatchItemError{Index: i, Err: fmt.Errorf("failed to generate deployment ID: %w", err)}
+		}
+
+		deployment, err := db.createDeployment(ctx, tx, id, req, requestID)
+		if err != nil {
+			return nil, &BatchItemError{Index: i, Err: err}
+		}
+		deployments = append(deployments, *deployment)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deployments, nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const deploymentCheckColumns = `name, status, details_url, updated_at`
+
+func scanDeploymentCheck(row pgx.Row, check *models.DeploymentCheck) error {
+	return row.Scan(&check.Name, &check.Status, &check.DetailsURL, &check.UpdatedAt)
+}
+
+// insertDeploymentChecks records the CI checks a new deployment is held on,
+// all pending
+func insertDeploymentChecks(ctx context.Context, q querier, deploymentID uuid.UUID, names []string) error {
+	for _, name := range names {
+		_, err := q.Exec(ctx, `
+			INSERT INTO deployment_checks (deployment_id, name) VALUES ($1, $2)
+		`, deploymentID, name)
+		if err != nil {
+			return fmt.Errorf("failed to insert deployment check: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListDeploymentChecks lists a deployment's CI checks ordered by name
+func (db *DB) ListDeploymentChecks(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentCheck, error) {
+	return listDeploymentChecks(ctx, db.Pool, deploymentID)
+}
+
+func listDeploymentChecks(ctx context.Context, q pgxQuerier, deploymentID uuid.UUID) ([]models.DeploymentCheck, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+deploymentCheckColumns+` FROM deployment_checks
+		WHERE deployment_id = $1
+		ORDER BY name
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment checks: %w", err)
+	}
+	defer rows.Close()
+
+	checks := []models.DeploymentCheck{}
+	for rows.Next() {
+		var check models.DeploymentCheck
+		if err := scanDeploymentCheck(rows, &check); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment check: %w", err)
+		}
+		checks = append(checks, check)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment checks: %w", err)
+	}
+
+	return checks, nil
+}
+
+// UpdateDeploymentChecks records the reported outcome of a deployment's CI
+// checks and returns all of its checks. Reporting a check the deployment
+// was not pushed with fails with "check not found" and changes nothing.
+func (db *DB) UpdateDeploymentChecks(ctx context.Context, deploymentID uuid.UUID, checks []models.CheckStatus) ([]models.DeploymentCheck, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, check := range checks {
+		tag, err := tx.Exec(ctx, `
+			UPDATE deployment_checks
+			SET status = $3, details_url = $4, updated_at = NOW()
+			WHERE deployment_id = $1 AND name = $2
+		`, deploymentID, check.Name, check.Status, check.DetailsURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update deployment check: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, fmt.Errorf("check not found")
+		}
+	}
+
+	updated, err := listDeploymentChecks(ctx, tx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return updated, nil
+}
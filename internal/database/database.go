@@ -5,16 +5,26 @@ import (
 	"fmt"
 	"time"
 
+	"deployment-controller/internal/clock"
 	"deployment-controller/internal/config"
 	"deployment-controller/internal/models"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
 	Pool *pgxpool.Pool
+
+	// idVersion is the UUID version used for new deployment IDs
+	idVersion int
+
+	// clock decides when leases, jobs, idempotency keys, retries and
+	// schedules expire or fall due, and stamps the rows whose timestamps
+	// are set in Go; other timestamps come from the database's NOW()
+	clock clock.Clock
 }
 
 // New creates a new database connection pool
@@ -30,6 +40,14 @@ func New(cfg *config.Config) (*DB, error) {
 	poolConfig.MaxConnLifetime = time.Hour
 	poolConfig.MaxConnIdleTime = time.Minute * 30
 
+	if err := configureStatementCache(poolConfig, cfg.Database); err != nil {
+		return nil, err
+	}
+
+	if cfg.Database.IDVersion != 4 && cfg.Database.IDVersion != 7 {
+		return nil, fmt.Errorf("invalid id_version %d: must be 4 or 7", cfg.Database.IDVersion)
+	}
+
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
@@ -40,7 +58,47 @@ func New(cfg *config.Config) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{Pool: pool}, nil
+	return &DB{Pool: pool, idVersion: cfg.Database.IDVersion, clock: clock.Real}, nil
+}
+
+// SetClock sets the clock that decides expiry and due-ness and stamps the
+// rows whose timestamps are set in Go
+func (db *DB) SetClock(c clock.Clock) {
+	db.clock = c
+}
+
+// newDeploymentID generates an ID for a new deployment. Version 7 IDs sort
+// by creation time, keeping inserts at the right edge of the primary key index.
+func (db *DB) newDeploymentID() (uuid.UUID, error) {
+	if db.idVersion == 7 {
+		return uuid.NewV7()
+	}
+	return uuid.NewRandom()
+}
+
+// queryExecModes maps config names to pgx query execution modes
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// configureStatementCache applies the query execution mode and statement
+// cache sizing. Hot queries (deployment insert, get_next_version, the latest
+// list) are prepared once per connection and reused in cache_statement mode.
+func configureStatementCache(poolConfig *pgxpool.Config, cfg config.DatabaseConfig) error {
+	mode, ok := queryExecModes[cfg.QueryExecMode]
+	if !ok {
+		return fmt.Errorf("invalid query_exec_mode %q", cfg.QueryExecMode)
+	}
+
+	poolConfig.ConnConfig.DefaultQueryExecMode = mode
+	poolConfig.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	poolConfig.ConnConfig.DescriptionCacheCapacity = cfg.StatementCacheCapacity
+
+	return nil
 }
 
 // Close closes the database connection pool
@@ -48,6 +106,46 @@ func (db *DB) Close() {
 	db.Pool.Close()
 }
 
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
+
+// deploymentColumns lists the deployments columns read by scanDeployment
+const deploymentColumns = `id, request_id, domain, app_name, docker_image, port, env, version,
+		       updated_at, deployed_at, status, created_at, secret_error, priority, image_deleted_at,
+		       verification, verified_at, git_sha, git_ref, build_url, builder,
+		       failure_code, failure_message, failure_details, metadata`
+
+// scanDeployment scans a row selected with deploymentColumns
+func scanDeployment(row pgx.Row, deployment *models.Deployment) error {
+	var failure models.DeploymentFailure
+	err := row.Scan(
+		&deployment.ID, &deployment.RequestID, &deployment.Domain, &deployment.AppName,
+		&deployment.DockerImage, &deployment.Port, &deployment.Env, &deployment.Version,
+		&deployment.UpdatedAt, &deployment.DeployedAt, &deployment.Status, &deployment.CreatedAt,
+		&deployment.SecretError, &deployment.Priority, &deployment.ImageDeletedAt,
+		&deployment.Verification, &deployment.VerifiedAt,
+		&deployment.GitSHA, &deployment.GitRef, &deployment.BuildURL, &deployment.Builder,
+		&failure.Code, &failure.Message, &failure.Details, &deployment.Metadata,
+	)
+	if err != nil {
+		return err
+	}
+
+	deployment.Failure = nil
+	if failure.Code != "" {
+		deployment.Failure = &failure
+	}
+	return nil
+}
+
+// querier is implemented by both the pool and transactions
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // CreateDeployment creates a new deployment record with versioning
 func (db *DB) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
 	// Start transaction
@@ -57,9 +155,29 @@ func (db *DB) CreateDeployment(ctx context.Context, req models.DeploymentRequest
 	}
 	defer tx.Rollback(ctx)
 
+	id, err := db.newDeploymentID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate deployment ID: %w", err)
+	}
+
+	deployment, err := db.createDeployment(ctx, tx, id, req, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// createDeployment inserts the next version of an app using q
+func (db *DB) createDeployment(ctx context.Context, q querier, id uuid.UUID, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
 	// Get next version number
 	var version int
-	err = tx.QueryRow(ctx, "SELECT get_next_version($1, $2)", req.Domain, req.AppName).Scan(&version)
+	err := q.QueryRow(ctx, "SELECT get_next_version($1, $2)", req.Domain, req.AppName).Scan(&version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get next version: %w", err)
 	}
@@ -67,11 +185,21 @@ func (db *DB) CreateDeployment(ctx context.Context, req models.DeploymentRequest
 	// Set updated_at if not provided
 	updatedAt := req.UpdatedAt
 	if updatedAt.IsZero() {
-		updatedAt = time.Now()
+		updatedAt = db.clock.Now()
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = models.PriorityNormal
+	}
+
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
 	}
 
 	deployment := &models.Deployment{
-		ID:          uuid.New(),
+		ID:          id,
 		RequestID:   requestID,
 		Domain:      req.Domain,
 		AppName:     req.AppName,
@@ -81,27 +209,31 @@ func (db *DB) CreateDeployment(ctx context.Context, req models.DeploymentRequest
 		Version:     version,
 		UpdatedAt:   updatedAt,
 		Status:      "pending",
-		CreatedAt:   time.Now(),
+		CreatedAt:   db.clock.Now(),
+		Priority:    priority,
+		Metadata:    metadata,
+		BuildInfo:   req.BuildInfo,
 	}
 
 	// Insert deployment
 	query := `
 		INSERT INTO deployments
-		(id, request_id, domain, app_name, docker_image, port, env, version, updated_at, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		(id, request_id, domain, app_name, docker_image, port, env, version, updated_at, status, created_at, priority,
+		 git_sha, git_ref, build_url, builder, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`
-	_, err = tx.Exec(ctx, query,
+	_, err = q.Exec(ctx, query,
 		deployment.ID, deployment.RequestID, deployment.Domain, deployment.AppName,
 		deployment.DockerImage, deployment.Port, deployment.Env, deployment.Version,
-		deployment.UpdatedAt, deployment.Status, deployment.CreatedAt,
+		deployment.UpdatedAt, deployment.Status, deployment.CreatedAt, deployment.Priority,
+		deployment.GitSHA, deployment.GitRef, deployment.BuildURL, deployment.Builder, deployment.Metadata,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert deployment: %w", err)
 	}
 
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := insertDeploymentChecks(ctx, q, deployment.ID, req.Checks); err != nil {
+		return nil, err
 	}
 
 	return deployment, nil
@@ -111,17 +243,12 @@ func (db *DB) CreateDeployment(ctx context.Context, req models.DeploymentRequest
 func (db *DB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
 	deployment := &models.Deployment{}
 	query := `
-		SELECT id, request_id, domain, app_name, docker_image, port, env, version,
-		       updated_at, deployed_at, status, created_at
+		SELECT ` + deploymentColumns + `
 		FROM deployments
 		WHERE id = $1
 	`
 	row := db.Pool.QueryRow(ctx, query, id)
-	err := row.Scan(
-		&deployment.ID, &deployment.RequestID, &deployment.Domain, &deployment.AppName,
-		&deployment.DockerImage, &deployment.Port, &deployment.Env, &deployment.Version,
-		&deployment.UpdatedAt, &deployment.DeployedAt, &deployment.Status, &deployment.CreatedAt,
-	)
+	err := scanDeployment(row, deployment)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, fmt.Errorf("deployment not found")
@@ -132,11 +259,35 @@ func (db *DB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployme
 	return deployment, nil
 }
 
+// GetLatestDeployment gets the latest version of a single app
+func (db *DB) GetLatestDeployment(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	return getLatestDeployment(ctx, db.Pool, domain, appName)
+}
+
+func getLatestDeployment(ctx context.Context, q querier, domain, appName string) (*models.Deployment, error) {
+	deployment := &models.Deployment{}
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE domain = $1 AND app_name = $2
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	err := scanDeployment(q.QueryRow(ctx, query, domain, appName), deployment)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("deployment not found")
+		}
+		return nil, fmt.Errorf("failed to get latest deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
 // GetLatestDeployments gets the latest version of all deployments
 func (db *DB) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
 	query := `
-		SELECT id, request_id, domain, app_name, docker_image, port, env, version,
-		       updated_at, deployed_at, status, created_at
+		SELECT ` + deploymentColumns + `
 		FROM latest_deployments
 		ORDER BY created_at DESC
 	`
@@ -149,35 +300,202 @@ func (db *DB) GetLatestDeployments(ctx context.Context) ([]models.Deployment, er
 	var deployments []models.Deployment
 	for rows.Next() {
 		var deployment models.Deployment
-		err := rows.Scan(
-			&deployment.ID, &deployment.RequestID, &deployment.Domain, &deployment.AppName,
-			&deployment.DockerImage, &deployment.Port, &deployment.Env, &deployment.Version,
-			&deployment.UpdatedAt, &deployment.DeployedAt, &deployment.Status, &deployment.CreatedAt,
-		)
+		err := scanDeployment(rows, &deployment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating latest deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// GetDeploymentHistory gets up to limit versions of an app in the date
+// range and matching the metadata filter, newest first, resuming after the
+// given cursor when it is non-nil
+func (db *DB) GetDeploymentHistory(ctx context.Context, domain, appName string, rng models.DateRange, metadata models.MetadataFilter, after *models.Cursor, limit int) ([]models.Deployment, error) {
+	column := dateRangeColumn(rng)
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE domain = $1 AND app_name = $2
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		  AND ($6::timestamptz IS NULL OR ` + column + ` >= $6)
+		  AND ($7::timestamptz IS NULL OR ` + column + ` < $7)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM jsonb_each_text($8::jsonb) f
+		      WHERE metadata->>f.key IS DISTINCT FROM f.value
+		  )
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5
+	`
+	var afterCreatedAt *time.Time
+	var afterID *uuid.UUID
+	if after != nil {
+		afterCreatedAt = &after.CreatedAt
+		afterID = &after.ID
+	}
+
+	if metadata == nil {
+		metadata = models.MetadataFilter{}
+	}
+
+	rows, err := db.Pool.Query(ctx, query, domain, appName, afterCreatedAt, afterID, limit, rng.From, rng.To, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment history: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []models.Deployment
+	for rows.Next() {
+		var deployment models.Deployment
+		err := scanDeployment(rows, &deployment)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan deployment: %w", err)
 		}
 		deployments = append(deployments, deployment)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment history: %w", err)
+	}
+
 	return deployments, nil
 }
 
-// UpdateDeploymentStatus updates the status of a deployment
-func (db *DB) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, deployedAt *time.Time) error {
+// UpdateDeploymentStatus updates the status of a deployment. When ifMatch is
+// non-nil the update is only applied if the current ETag is one of the given tags.
+// A non-nil failure replaces the reported failure reason; otherwise it is kept
+// while the status is unchanged and cleared when it changes.
+func (db *DB) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row so concurrent updates are serialized against the precondition
+	deployment := &models.Deployment{}
 	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err = scanDeployment(tx.QueryRow(ctx, query, id), deployment)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("deployment not found")
+		}
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	if ifMatch != nil && !etagIn(deployment.ETag(), ifMatch) {
+		return nil, fmt.Errorf("precondition failed")
+	}
+
+	if status != deployment.Status {
+		deployment.Failure = nil
+	}
+	if failure != nil {
+		deployment.Failure = failure
+	}
+	stored := models.DeploymentFailure{}
+	if deployment.Failure != nil {
+		stored = *deployment.Failure
+	}
+
+	query = `
 		UPDATE deployments
-		SET status = $1, deployed_at = $2
+		SET status = $1, deployed_at = $2,
+		    verification = CASE WHEN status = $1 THEN verification ELSE '' END,
+		    verified_at = CASE WHEN status = $1 THEN verified_at END,
+		    failure_code = $4, failure_message = $5, failure_details = $6
 		WHERE id = $3
+		RETURNING deployed_at
 	`
-	_, err := db.Pool.Exec(ctx, query, status, deployedAt, id)
+	// deployed_at is read back as stored, at microsecond precision, so the
+	// returned ETag matches the one later reads compute. The row is locked
+	// above, so the update always finds it; a missing deployment is caught
+	// by the SELECT.
+	var storedDeployedAt *time.Time
+	err = tx.QueryRow(ctx, query, status, deployedAt, id, stored.Code, stored.Message, stored.Details).Scan(&storedDeployedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deployment status: %w", err)
+	}
+
+	if status != deployment.Status {
+		message := fmt.Sprintf("status changed from %s to %s", deployment.Status, status)
+		if deployment.Failure != nil {
+			message += " (" + deployment.Failure.Code + ")"
+		}
+		if err := recordStatusChange(ctx, tx, id, deployment.Status, status, message); err != nil {
+			return nil, err
+		}
+
+		if status == "failed" {
+			if err := scheduleRetry(ctx, tx, deployment, db.clock.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if status != deployment.Status {
+		deployment.Verification, deployment.VerifiedAt = "", nil
+	}
+	deployment.Status = status
+	deployment.DeployedAt = storedDeployedAt
+
+	return deployment, nil
+}
+
+// SetDeploymentSecretError records the outcome of resolving a deployment's
+// secret references; an empty message clears a previous error
+func (db *DB) SetDeploymentSecretError(ctx context.Context, id uuid.UUID, message string) error {
+	tag, err := db.Pool.Exec(ctx, "UPDATE deployments SET secret_error = $1 WHERE id = $2", message, id)
 	if err != nil {
-		return fmt.Errorf("failed to update deployment status: %w", err)
+		return fmt.Errorf("failed to record secret error: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("deployment not found")
 	}
 
 	return nil
 }
 
+// SetDeploymentImageDeleted records when a registry reported the
+// deployment's image deleted; nil clears the flag once the image is pushed
+// again
+func (db *DB) SetDeploymentImageDeleted(ctx context.Context, id uuid.UUID, deletedAt *time.Time) error {
+	tag, err := db.Pool.Exec(ctx, "UPDATE deployments SET image_deleted_at = $1 WHERE id = $2", deletedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to flag deleted image: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	return nil
+}
+
+// etagIn reports whether etag is one of the given tags
+func etagIn(etag string, tags []string) bool {
+	for _, tag := range tags {
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // StoreRegistryCredential stores Docker registry credentials
 func (db *DB) StoreRegistryCredential(ctx context.Context, cred models.RegistryCredentialRequest) error {
 	query := `
@@ -214,22 +532,159 @@ func (db *DB) GetRegistryCredential(ctx context.Context, registry string) (*mode
 	return cred, nil
 }
 
-// GetDeploymentStats gets deployment statistics
-func (db *DB) GetDeploymentStats(ctx context.Context) (*models.DeploymentStats, error) {
+// ListRegistries lists stored registry credentials without their passwords
+func (db *DB) ListRegistries(ctx context.Context) ([]models.RegistryReference, error) {
+	query := `
+		SELECT registry, username
+		FROM docker_credentials
+		ORDER BY registry
+	`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var registries []models.RegistryReference
+	for rows.Next() {
+		var ref models.RegistryReference
+		if err := rows.Scan(&ref.Registry, &ref.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan registry credential: %w", err)
+		}
+		registries = append(registries, ref)
+	}
+
+	return registries, nil
+}
+
+// DeleteRegistryCredential deletes a registry's credentials
+func (db *DB) DeleteRegistryCredential(ctx context.Context, registry string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM docker_credentials WHERE registry = $1", registry)
+	if err != nil {
+		return fmt.Errorf("failed to delete registry credential: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("registry credential not found")
+	}
+
+	return nil
+}
+
+// GetDeploymentStats gets deployment statistics from the deployment_stats
+// and app_deployment_stats materialized views. With a date range they are
+// computed live over the deployments in the range instead.
+func (db *DB) GetDeploymentStats(ctx context.Context, rng models.DateRange) (*models.DeploymentStats, error) {
+	if !rng.IsZero() {
+		return db.getDeploymentStatsInRange(ctx, rng)
+	}
+
 	stats := &models.DeploymentStats{}
 	query := `
-		SELECT
-			COUNT(*) as total,
-			COUNT(CASE WHEN status = 'pending' THEN 1 END) as pending,
-			COUNT(CASE WHEN status = 'deployed' THEN 1 END) as deployed,
-			COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed
-		FROM latest_deployments
+		SELECT total, pending, deployed, failed, refreshed_at
+		FROM deployment_stats
 	`
 	row := db.Pool.QueryRow(ctx, query)
-	err := row.Scan(&stats.TotalDeployments, &stats.PendingCount, &stats.DeployedCount, &stats.FailedCount)
+	err := row.Scan(&stats.TotalDeployments, &stats.PendingCount, &stats.DeployedCount, &stats.FailedCount, &stats.RefreshedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment stats: %w", err)
 	}
 
+	rows, err := db.Pool.Query(ctx, `
+		SELECT domain, app_name, versions, current_version, current_status, last_deployed_at
+		FROM app_deployment_stats
+		ORDER BY domain, app_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query app deployment stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats.Breakdown, err = scanStatsGroups(rows)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getDeploymentStatsInRange computes the stats over the versions whose
+// date falls in the range; each app counts by its latest such version
+func (db *DB) getDeploymentStatsInRange(ctx context.Context, rng models.DateRange) (*models.DeploymentStats, error) {
+	column := dateRangeColumn(rng)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT domain, app_name, COUNT(*),
+		       (ARRAY_AGG(version ORDER BY version DESC))[1],
+		       (ARRAY_AGG(status ORDER BY version DESC))[1],
+		       MAX(deployed_at)
+		FROM deployments
+		WHERE ($1::timestamptz IS NULL OR `+column+` >= $1)
+		  AND ($2::timestamptz IS NULL OR `+column+` < $2)
+		GROUP BY domain, app_name
+		ORDER BY domain, app_name
+	`, rng.From, rng.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &models.DeploymentStats{RefreshedAt: db.clock.Now()}
+	stats.Breakdown, err = scanStatsGroups(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range stats.Breakdown {
+		stats.TotalDeployments += group.TotalDeployments
+		stats.PendingCount += group.PendingCount
+		stats.DeployedCount += group.DeployedCount
+		stats.FailedCount += group.FailedCount
+	}
 	return stats, nil
 }
+
+// scanStatsGroups scans per-app stats rows, counting each app once by the
+// status of its current version
+func scanStatsGroups(rows pgx.Rows) ([]models.StatsGroup, error) {
+	groups := []models.StatsGroup{}
+	for rows.Next() {
+		group := models.StatsGroup{TotalDeployments: 1}
+		err := rows.Scan(&group.Domain, &group.AppName, &group.Versions,
+			&group.CurrentVersion, &group.CurrentStatus, &group.LastDeployedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan app deployment stats: %w", err)
+		}
+		switch group.CurrentStatus {
+		case "pending":
+			group.PendingCount = 1
+		case "deployed":
+			group.DeployedCount = 1
+		case "failed":
+			group.FailedCount = 1
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating app deployment stats: %w", err)
+	}
+	return groups, nil
+}
+
+// dateRangeColumn returns the deployments column a date range applies to
+func dateRangeColumn(rng models.DateRange) string {
+	if rng.Field == models.DateFieldDeployed {
+		return "deployed_at"
+	}
+	return "created_at"
+}
+
+// RefreshDeploymentStats recomputes the deployment_stats and
+// app_deployment_stats materialized views. They are refreshed concurrently,
+// which their unique indexes allow, so reads aren't blocked meanwhile.
+func (db *DB) RefreshDeploymentStats(ctx context.Context) error {
+	for _, view := range []string{"deployment_stats", "app_deployment_stats"} {
+		if _, err := db.Pool.Exec(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+view); err != nil {
+			return fmt.Errorf("failed to refresh %s: %w", view, err)
+		}
+	}
+
+	return nil
+}
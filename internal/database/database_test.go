@@ -0,0 +1,56 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewDeploymentID(t *testing.T) {
+	tests := []struct {
+		name      string
+		idVersion int
+		want      uuid.Version
+	}{
+		{"Version 4", 4, 4},
+		{"Version 7", 7, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{idVersion: tt.idVersion}
+			id, err := db.newDeploymentID()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id.Version() != tt.want || id.Variant() != uuid.RFC4122 {
+				t.Errorf("Expected an RFC 4122 version %d ID, got version %d, variant %s", tt.want, id.Version(), id.Variant())
+			}
+		})
+	}
+}
+
+func TestNewDeploymentIDSortsByCreation(t *testing.T) {
+	db := &DB{idVersion: 7}
+	start := time.Now()
+
+	// Enough IDs that several share a millisecond
+	var previous uuid.UUID
+	for i := 0; i < 1000; i++ {
+		id, err := db.newDeploymentID()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if i > 0 && bytes.Compare(previous[:], id[:]) >= 0 {
+			t.Fatalf("Expected ID %d (%s) to sort after %s", i, id, previous)
+		}
+		previous = id
+	}
+
+	sec, nsec := previous.Time().UnixTime()
+	if created := time.Unix(sec, nsec); created.Before(start.Truncate(time.Millisecond)) || created.After(time.Now().Add(time.Second)) {
+		t.Errorf("Expected the ID's timestamp near its creation at %s, got %s", start, created)
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// ListDeploymentOutcomes lists the deployments pushed since the given time
+// with when they were first deployed, failed and rolled back, ordered by
+// domain, app name and push time. Transitions are read from the statuses
+// recorded on the status_changed events.
+func (db *DB) ListDeploymentOutcomes(ctx context.Context, since time.Time) ([]models.DeploymentOutcome, error) {
+	query := `
+		WITH transitions AS (
+			SELECT e.deployment_id,
+			       MIN(e.created_at) FILTER (WHERE e.to_status = 'deployed') AS deployed_at,
+			       MIN(e.created_at) FILTER (WHERE e.to_status = 'failed') AS failed_at,
+			       MIN(e.created_at) FILTER (WHERE e.to_status = 'rolled_back') AS rolled_back_at
+			FROM deployment_events e
+			JOIN deployments d ON d.id = e.deployment_id
+			WHERE e.type = 'status_changed' AND d.created_at >= $1
+			GROUP BY e.deployment_id
+		)
+		SELECT d.id, d.domain, d.app_name, d.created_at,
+		       t.deployed_at, t.failed_at, t.rolled_back_at,
+		       (SELECT MIN(r.created_at)
+		        FROM deployment_events r
+		        JOIN deployments o ON o.id = r.deployment_id
+		        WHERE o.domain = d.domain AND o.app_name = d.app_name AND o.id <> d.id
+		          AND r.type = 'status_changed' AND r.to_status = 'deployed'
+		          AND r.created_at >= t.rolled_back_at) AS restored_at
+		FROM deployments d
+		LEFT JOIN transitions t ON t.deployment_id = d.id
+		WHERE d.created_at >= $1
+		ORDER BY d.domain, d.app_name, d.created_at
+	`
+	rows, err := db.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment outcomes: %w", err)
+	}
+	defer rows.Close()
+
+	outcomes := []models.DeploymentOutcome{}
+	for rows.Next() {
+		var o models.DeploymentOutcome
+		err := rows.Scan(&o.DeploymentID, &o.Domain, &o.AppName, &o.CreatedAt,
+			&o.DeployedAt, &o.FailedAt, &o.RolledBackAt, &o.RestoredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment outcome: %w", err)
+		}
+		outcomes = append(outcomes, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment outcomes: %w", err)
+	}
+
+	return outcomes, nil
+}
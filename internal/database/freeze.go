@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const writeFreezeColumns = `reason, started_by, started_at`
+
+func scanWriteFreeze(row pgx.Row, f *models.WriteFreeze) error {
+	if err := row.Scan(&f.Reason, &f.StartedBy, &f.StartedAt); err != nil {
+		return err
+	}
+	f.Enabled = true
+	return nil
+}
+
+// checkWriteFreeze locks the freeze for the rest of tx and, when ifMatch is
+// non-nil, checks that its current ETag is one of the given tags. The lock
+// is taken on the freeze rather than its row, which doesn't exist while the
+// freeze is off.
+func checkWriteFreeze(ctx context.Context, tx pgx.Tx, ifMatch []string) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('write_freeze'))"); err != nil {
+		return fmt.Errorf("failed to lock write freeze: %w", err)
+	}
+	if ifMatch == nil {
+		return nil
+	}
+
+	current := &models.WriteFreeze{}
+	if err := scanWriteFreeze(tx.QueryRow(ctx, `SELECT `+writeFreezeColumns+` FROM write_freeze`), current); err != nil {
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("failed to get write freeze: %w", err)
+		}
+		current = &models.WriteFreeze{}
+	}
+	if !etagIn(current.ETag(), ifMatch) {
+		return fmt.Errorf("precondition failed")
+	}
+	return nil
+}
+
+// StartWriteFreeze freezes new deployments; for a freeze already on only the
+// reason changes. When ifMatch is non-nil the change is only applied if the
+// current ETag is one of the given tags.
+func (db *DB) StartWriteFreeze(ctx context.Context, freeze models.WriteFreeze, ifMatch []string) (*models.WriteFreeze, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkWriteFreeze(ctx, tx, ifMatch); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO write_freeze (reason, started_by)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE
+		SET reason = EXCLUDED.reason
+		RETURNING ` + writeFreezeColumns
+	stored := &models.WriteFreeze{}
+	if err := scanWriteFreeze(tx.QueryRow(ctx, query, freeze.Reason, freeze.StartedBy), stored); err != nil {
+		return nil, fmt.Errorf("failed to start write freeze: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stored, nil
+}
+
+// EndWriteFreeze lifts the freeze on new deployments, if any. When ifMatch
+// is non-nil the change is only applied if the current ETag is one of the
+// given tags.
+func (db *DB) EndWriteFreeze(ctx context.Context, ifMatch []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkWriteFreeze(ctx, tx, ifMatch); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM write_freeze"); err != nil {
+		return fmt.Errorf("failed to end write freeze: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetWriteFreeze gets the freeze on new deployments, which is off unless
+// an admin started one
+func (db *DB) GetWriteFreeze(ctx context.Context) (*models.WriteFreeze, error) {
+	f := &models.WriteFreeze{}
+	if err := scanWriteFreeze(db.Pool.QueryRow(ctx, `SELECT `+writeFreezeColumns+` FROM write_freeze`), f); err != nil {
+		if err == pgx.ErrNoRows {
+			return &models.WriteFreeze{}, nil
+		}
+		return nil, fmt.Errorf("failed to get write freeze: %w", err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RecordGitSync stores the outcome of a git sync, replacing the previous
+// outcome for the branch. The declared deployments are kept from the
+// previous sync when status has none, as when the fetch failed.
+func (db *DB) RecordGitSync(ctx context.Context, status models.GitSyncStatus) error {
+	result, err := json.Marshal(status.Deployments)
+	if err != nil {
+		return fmt.Errorf("failed to encode git sync result: %w", err)
+	}
+
+	var declared []byte
+	if status.Declared != nil {
+		if declared, err = json.Marshal(status.Declared); err != nil {
+			return fmt.Errorf("failed to encode git sync declarations: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO git_syncs (branch, commit_sha, synced_at, result, declared, error)
+		VALUES ($1, $2, $3, $4, COALESCE($5, '[]'::jsonb), NULLIF($6, ''))
+		ON CONFLICT (branch) DO UPDATE
+		SET commit_sha = EXCLUDED.commit_sha,
+		    synced_at = EXCLUDED.synced_at,
+		    result = EXCLUDED.result,
+		    declared = COALESCE($5, git_syncs.declared),
+		    error = EXCLUDED.error
+	`
+	_, err = db.Pool.Exec(ctx, query, status.Branch, status.Commit, status.SyncedAt, result, declared, status.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record git sync: %w", err)
+	}
+	return nil
+}
+
+// GetGitSync gets the outcome of the latest git sync of branch
+func (db *DB) GetGitSync(ctx context.Context, branch string) (*models.GitSyncStatus, error) {
+	query := `
+		SELECT branch, commit_sha, synced_at, result, declared, COALESCE(error, '')
+		FROM git_syncs
+		WHERE branch = $1
+	`
+	status := &models.GitSyncStatus{}
+	var result, declared []byte
+	err := db.Pool.QueryRow(ctx, query, branch).Scan(&status.Branch, &status.Commit, &status.SyncedAt, &result, &declared, &status.Error)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("git sync not found")
+		}
+		return nil, fmt.Errorf("failed to get git sync: %w", err)
+	}
+
+	if err := json.Unmarshal(result, &status.Deployments); err != nil {
+		return nil, fmt.Errorf("failed to decode git sync result: %w", err)
+	}
+	if err := json.Unmarshal(declared, &status.Declared); err != nil {
+		return nil, fmt.Errorf("failed to decode git sync declarations: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const healthCheckColumns = `domain, app_name, type, path, port, command, updated_at`
+
+func scanHealthCheck(row pgx.Row, check *models.HealthCheck) error {
+	return row.Scan(&check.Domain, &check.AppName, &check.Type, &check.Path,
+		&check.Port, &check.Command, &check.UpdatedAt)
+}
+
+// UpsertHealthCheck creates or replaces an app's health check
+func (db *DB) UpsertHealthCheck(ctx context.Context, check models.HealthCheck) (*models.HealthCheck, error) {
+	command := check.Command
+	if command == nil {
+		command = []string{}
+	}
+
+	query := `
+		INSERT INTO health_checks (domain, app_name, type, path, port, command)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET type = EXCLUDED.type,
+		    path = EXCLUDED.path,
+		    port = EXCLUDED.port,
+		    command = EXCLUDED.command,
+		    updated_at = NOW()
+		RETURNING ` + healthCheckColumns
+	stored := &models.HealthCheck{}
+	row := db.Pool.QueryRow(ctx, query, check.Domain, check.AppName, check.Type, check.Path, check.Port, command)
+	if err := scanHealthCheck(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to upsert health check: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetHealthCheck gets an app's health check
+func (db *DB) GetHealthCheck(ctx context.Context, domain, appName string) (*models.HealthCheck, error) {
+	query := `SELECT ` + healthCheckColumns + ` FROM health_checks WHERE domain = $1 AND app_name = $2`
+	check := &models.HealthCheck{}
+	if err := scanHealthCheck(db.Pool.QueryRow(ctx, query, domain, appName), check); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("health check not found")
+		}
+		return nil, fmt.Errorf("failed to get health check: %w", err)
+	}
+
+	return check, nil
+}
+
+// ListHealthChecks lists the health checks of a type, or of every type when
+// checkType is empty, ordered by domain and app name
+func (db *DB) ListHealthChecks(ctx context.Context, checkType string) ([]models.HealthCheck, error) {
+	query := `SELECT ` + healthCheckColumns + ` FROM health_checks
+		WHERE $1 = '' OR type = $1
+		ORDER BY domain, app_name`
+	rows, err := db.Pool.Query(ctx, query, checkType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health checks: %w", err)
+	}
+	defer rows.Close()
+
+	checks := []models.HealthCheck{}
+	for rows.Next() {
+		var check models.HealthCheck
+		if err := scanHealthCheck(rows, &check); err != nil {
+			return nil, fmt.Errorf("failed to scan health check: %w", err)
+		}
+		checks = append(checks, check)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating health checks: %w", err)
+	}
+
+	return checks, nil
+}
+
+// DeleteHealthCheck deletes an app's health check
+func (db *DB) DeleteHealthCheck(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM health_checks WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete health check: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("health check not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HotTables are the tables with the most churn, vacuumed and analyzed by
+// housekeeping runs
+var HotTables = []string{
+	"deployments",
+	"deployment_events",
+	"deployment_logs",
+	"deployment_checks",
+	"deployment_retries",
+	"jobs",
+	"idempotency_keys",
+	"health_probes",
+	"observed_states",
+	"audit_events",
+}
+
+// VacuumAnalyze vacuums a table and refreshes its planner statistics. It
+// cannot run inside a transaction, so it runs on its own.
+func (db *DB) VacuumAnalyze(ctx context.Context, table string) error {
+	if _, err := db.Pool.Exec(ctx, "VACUUM (ANALYZE) "+pgx.Identifier{table}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to vacuum %s: %w", table, err)
+	}
+	return nil
+}
+
+// GetTableSizes reports the size, row counts and last vacuum and analyze of
+// every table, largest first, with the size and usage of its indexes
+func (db *DB) GetTableSizes(ctx context.Context) ([]models.TableSize, error) {
+	query := `
+		SELECT relname, n_live_tup, n_dead_tup,
+		       pg_table_size(relid), pg_indexes_size(relid), pg_total_relation_size(relid),
+		       GREATEST(last_vacuum, last_autovacuum), GREATEST(last_analyze, last_autoanalyze)
+		FROM pg_stat_user_tables
+		WHERE schemaname = current_schema()
+		ORDER BY pg_total_relation_size(relid) DESC, relname
+	`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer rows.Close()
+
+	tables := []models.TableSize{}
+	byName := map[string]int{}
+	for rows.Next() {
+		t := models.TableSize{Indexes: []models.IndexSize{}}
+		if err := rows.Scan(&t.Table, &t.LiveRows, &t.DeadRows,
+			&t.TableBytes, &t.IndexBytes, &t.TotalBytes,
+			&t.LastVacuum, &t.LastAnalyze); err != nil {
+			return nil, fmt.Errorf("failed to scan table size: %w", err)
+		}
+		byName[t.Table] = len(tables)
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating table sizes: %w", err)
+	}
+
+	query = `
+		SELECT relname, indexrelname, pg_relation_size(indexrelid), idx_scan
+		FROM pg_stat_user_indexes
+		WHERE schemaname = current_schema()
+		ORDER BY pg_relation_size(indexrelid) DESC, indexrelname
+	`
+	rows, err = db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index sizes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var index models.IndexSize
+		if err := rows.Scan(&table, &index.Name, &index.Bytes, &index.Scans); err != nil {
+			return nil, fmt.Errorf("failed to scan index size: %w", err)
+		}
+		if i, ok := byName[table]; ok {
+			tables[i].Indexes = append(tables[i].Indexes, index)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating index sizes: %w", err)
+	}
+
+	return tables, nil
+}
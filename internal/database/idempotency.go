@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// idempotencyKeyTTL is how long a stored push result can be replayed
+const idempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyLeaseTTL is how long a key stays reserved without a stored
+// result. Requests complete or release their key well within it, so a
+// reservation outliving it was left by a replica that died mid-request.
+const idempotencyLeaseTTL = 2 * time.Minute
+
+// ReserveIdempotencyKey claims an idempotency key for a new request. When the
+// key was already used, the existing record is returned and reserved is false.
+func (db *DB) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, bool, error) {
+	// Expired keys and abandoned reservations may be reused
+	now := db.clock.Now()
+	_, err := db.Pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1
+		  AND (created_at < $2 OR (status_code IS NULL AND created_at < $3))
+	`, key, now.Add(-idempotencyKeyTTL), now.Add(-idempotencyLeaseTTL))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to expire idempotency key: %w", err)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO idempotency_keys (key, request_hash, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING
+	`, key, requestHash, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	if tag.RowsAffected() == 1 {
+		return nil, true, nil
+	}
+
+	record := &models.IdempotencyRecord{}
+	var statusCode *int
+	query := `
+		SELECT key, request_hash, status_code, response, created_at
+		FROM idempotency_keys
+		WHERE key = $1
+	`
+	err = db.Pool.QueryRow(ctx, query, key).Scan(
+		&record.Key, &record.RequestHash, &statusCode, &record.Response, &record.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, false, fmt.Errorf("idempotency key not found")
+		}
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	if statusCode != nil {
+		record.StatusCode = *statusCode
+	}
+
+	return record, false, nil
+}
+
+// CompleteIdempotencyKey stores the response produced for a reserved key
+func (db *DB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $2, response = $3
+		WHERE key = $1
+	`
+	tag, err := db.Pool.Exec(ctx, query, key, statusCode, response)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("idempotency key not found")
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reservation whose request did not complete.
+// Releasing a key that was already completed or expired is a no-op.
+func (db *DB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := db.Pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL", key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const imageDigestColumns = `domain, app_name, deployment_id, docker_image, deployed_digest, registry_digest,
+	(deployed_digest <> '' AND registry_digest <> '' AND deployed_digest <> registry_digest) AS drifted,
+	error, checked_at`
+
+func scanImageDigest(row pgx.Row, digest *models.ImageDigest) error {
+	return row.Scan(&digest.Domain, &digest.AppName, &digest.DeploymentID, &digest.DockerImage,
+		&digest.DeployedDigest, &digest.RegistryDigest, &digest.Drifted, &digest.Error, &digest.CheckedAt)
+}
+
+// RecordImageDigest stores the digests of an app's deployed tag. A
+// non-empty DeployedDigest, recorded when the deployment went live, sets
+// its deployed digest; periodic checks leave it empty to keep the one
+// recorded for the same deployment, and without one nothing drifts. A
+// failed check (empty RegistryDigest) keeps the registry digest of earlier
+// checks.
+func (db *DB) RecordImageDigest(ctx context.Context, digest models.ImageDigest) (*models.ImageDigest, error) {
+	query := `
+		INSERT INTO image_digests AS d (domain, app_name, deployment_id, docker_image, deployed_digest, registry_digest, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET deployed_digest = CASE
+		        WHEN EXCLUDED.deployed_digest <> '' THEN EXCLUDED.deployed_digest
+		        WHEN d.deployment_id = EXCLUDED.deployment_id THEN d.deployed_digest
+		        ELSE ''
+		    END,
+		    registry_digest = CASE
+		        WHEN d.deployment_id = EXCLUDED.deployment_id AND EXCLUDED.registry_digest = '' THEN d.registry_digest
+		        ELSE EXCLUDED.registry_digest
+		    END,
+		    deployment_id = EXCLUDED.deployment_id,
+		    docker_image = EXCLUDED.docker_image,
+		    error = EXCLUDED.error,
+		    checked_at = NOW()
+		RETURNING ` + imageDigestColumns
+	stored := &models.ImageDigest{}
+	row := db.Pool.QueryRow(ctx, query, digest.Domain, digest.AppName, digest.DeploymentID,
+		digest.DockerImage, digest.DeployedDigest, digest.RegistryDigest, digest.Error)
+	if err := scanImageDigest(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to record image digest: %w", err)
+	}
+
+	return stored, nil
+}
+
+// ListImageDigests lists tracked image digests ordered by domain and app
+// name, optionally only those that drifted
+func (db *DB) ListImageDigests(ctx context.Context, driftedOnly bool) ([]models.ImageDigest, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT * FROM (SELECT `+imageDigestColumns+` FROM image_digests) d
+		WHERE NOT $1 OR drifted
+		ORDER BY domain, app_name
+	`, driftedOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query image digests: %w", err)
+	}
+	defer rows.Close()
+
+	digests := []models.ImageDigest{}
+	for rows.Next() {
+		var digest models.ImageDigest
+		if err := scanImageDigest(rows, &digest); err != nil {
+			return nil, fmt.Errorf("failed to scan image digest: %w", err)
+		}
+		digests = append(digests, digest)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image digests: %w", err)
+	}
+
+	return digests, nil
+}
+
+// PruneImageDigests deletes the digests tracked for deployments other than
+// keep, such as superseded versions
+func (db *DB) PruneImageDigests(ctx context.Context, keep []uuid.UUID) error {
+	if _, err := db.Pool.Exec(ctx, "DELETE FROM image_digests WHERE NOT (deployment_id = ANY($1))", keep); err != nil {
+		return fmt.Errorf("failed to prune image digests: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const imagePolicyColumns = `domain, app_name, kind, pattern, last_checked_at, last_image, last_error, updated_at`
+
+func scanImagePolicy(row pgx.Row, policy *models.ImagePolicy) error {
+	return row.Scan(&policy.Domain, &policy.AppName, &policy.Kind, &policy.Pattern,
+		&policy.LastCheckedAt, &policy.LastImage, &policy.LastError, &policy.UpdatedAt)
+}
+
+// UpsertImagePolicy creates or replaces an app's image policy, clearing the
+// outcome of earlier checks
+func (db *DB) UpsertImagePolicy(ctx context.Context, policy models.ImagePolicy) (*models.ImagePolicy, error) {
+	query := `
+		INSERT INTO image_policies (domain, app_name, kind, pattern)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET kind = EXCLUDED.kind,
+		    pattern = EXCLUDED.pattern,
+		    last_checked_at = NULL,
+		    last_image = '',
+		    last_error = '',
+		    updated_at = NOW()
+		RETURNING ` + imagePolicyColumns
+	stored := &models.ImagePolicy{}
+	if err := scanImagePolicy(db.Pool.QueryRow(ctx, query, policy.Domain, policy.AppName, policy.Kind, policy.Pattern), stored); err != nil {
+		return nil, fmt.Errorf("failed to upsert image policy: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetImagePolicy gets an app's image policy
+func (db *DB) GetImagePolicy(ctx context.Context, domain, appName string) (*models.ImagePolicy, error) {
+	query := `SELECT ` + imagePolicyColumns + ` FROM image_policies WHERE domain = $1 AND app_name = $2`
+	policy := &models.ImagePolicy{}
+	if err := scanImagePolicy(db.Pool.QueryRow(ctx, query, domain, appName), policy); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("image policy not found")
+		}
+		return nil, fmt.Errorf("failed to get image policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// ListImagePolicies lists all image policies ordered by domain and app name
+func (db *DB) ListImagePolicies(ctx context.Context) ([]models.ImagePolicy, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+imagePolicyColumns+` FROM image_policies ORDER BY domain, app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query image policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.ImagePolicy{}
+	for rows.Next() {
+		var policy models.ImagePolicy
+		if err := scanImagePolicy(rows, &policy); err != nil {
+			return nil, fmt.Errorf("failed to scan image policy: %w", err)
+		}
+		policies = append(policies, policy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// DeleteImagePolicy deletes an app's image policy
+func (db *DB) DeleteImagePolicy(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM image_policies WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete image policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("image policy not found")
+	}
+
+	return nil
+}
+
+// RecordImagePolicyCheck stores the outcome of checking an image policy:
+// the image it settled on, or why it failed
+func (db *DB) RecordImagePolicyCheck(ctx context.Context, domain, appName, image, errMsg string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE image_policies
+		SET last_checked_at = NOW(),
+		    last_image = CASE WHEN $3 = '' THEN last_image ELSE $3 END,
+		    last_error = $4
+		WHERE domain = $1 AND app_name = $2
+	`, domain, appName, image, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to record image policy check: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// ListIncidents lists incidents newest first, of one app when domain and
+// appName are set, and only those still open when openOnly is set
+func (db *DB) ListIncidents(ctx context.Context, domain, appName string, openOnly bool, limit int) ([]models.Incident, error) {
+	query := `
+		SELECT id, domain, app_name, deployment_id, started_at, resolved_at
+		FROM incidents
+		WHERE ($1 = '' OR (domain = $1 AND app_name = $2))
+		  AND (NOT $3 OR resolved_at IS NULL)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $4
+	`
+	rows, err := db.Pool.Query(ctx, query, domain, appName, openOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := []models.Incident{}
+	for rows.Next() {
+		var i models.Incident
+		if err := rows.Scan(&i.ID, &i.Domain, &i.AppName, &i.DeploymentID, &i.StartedAt, &i.ResolvedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		incidents = append(incidents, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating incidents: %w", err)
+	}
+
+	return incidents, nil
+}
+
+// PruneIncidents deletes the incidents resolved before the given time and
+// returns how many were deleted
+func (db *DB) PruneIncidents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM incidents WHERE resolved_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune incidents: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
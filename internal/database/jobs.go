@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// JobsChannel is notified by a trigger whenever a job is queued
+const JobsChannel = "jobs_queued"
+
+// JobsCancelledChannel is notified with a job's ID when cancelling a running
+// job, so the replica running it can stop it
+const JobsCancelledChannel = "jobs_cancelled"
+
+// jobColumns lists the columns scanned by scanJob
+const jobColumns = `
+	id, type, status, priority, payload, result, total, processed, error,
+	created_at, started_at, finished_at, cancel_requested, attempts, run_after,
+	lease_expires_at
+`
+
+// scanJob scans a row selected with jobColumns
+func scanJob(row pgx.Row) (*models.Job, error) {
+	job := &models.Job{}
+	var errMsg *string
+	err := row.Scan(
+		&job.ID, &job.Type, &job.Status, &job.Priority, &job.Payload, &job.Result, &job.Total, &job.Processed, &errMsg,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.CancelRequested, &job.Attempts, &job.RunAfter,
+		&job.LeaseExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg != nil {
+		job.Error = *errMsg
+	}
+	return job, nil
+}
+
+// EnqueueJob queues a background job for the worker pool; workers take
+// more urgent priorities first
+func (db *DB) EnqueueJob(ctx context.Context, jobType, priority string, payload []byte, total int) (*models.Job, error) {
+	query := `
+		INSERT INTO jobs (id, type, status, priority, payload, total, created_at, run_after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING ` + jobColumns
+	job, err := scanJob(db.Pool.QueryRow(ctx, query, uuid.New(), jobType, models.JobStatusQueued, priority, payload, total, db.clock.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetJob gets a job by ID
+func (db *DB) GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+	job, err := scanJob(db.Pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("job not found")
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+// ClaimJob marks the most urgent, then oldest, job of one of the given types
+// that is queued and due, or running with a lapsed lease, as running under a
+// lease for the given duration, counting the attempt, and returns it, or
+// returns nil when there is nothing to do. SKIP LOCKED lets several workers
+// and replicas claim jobs concurrently without blocking.
+func (db *DB) ClaimJob(ctx context.Context, types []string, lease time.Duration) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = $1, started_at = $5, attempts = attempts + 1,
+		    lease_expires_at = $5::timestamptz + make_interval(secs => $4)
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE type = ANY($3)
+			  AND (status = $2 AND run_after <= $5
+			       OR status = $1 AND lease_expires_at < $5)
+			ORDER BY priority_rank(priority), created_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + jobColumns
+	job, err := scanJob(db.Pool.QueryRow(ctx, query, models.JobStatusRunning, models.JobStatusQueued, types, lease.Seconds(), db.clock.Now()))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return job, nil
+}
+
+// UpdateJobProgress records how many items of a running job have been
+// processed. Like RenewJobLease, it returns "job not found" once attempt is
+// no longer the job's running attempt.
+func (db *DB) UpdateJobProgress(ctx context.Context, id uuid.UUID, attempt, processed int) error {
+	tag, err := db.Pool.Exec(ctx, "UPDATE jobs SET processed = $1 WHERE id = $2 AND attempts = $3 AND status = 'running'", processed, id, attempt)
+	if err != nil {
+		return fmt.Errorf("failed to update job progress: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("job not found")
+	}
+
+	return nil
+}
+
+// RenewJobLease extends the lease of a running job by the given duration.
+// attempt is the attempt the caller is running; once the job has been
+// claimed again, or has finished, it returns "job not found".
+func (db *DB) RenewJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) error {
+	query := `
+		UPDATE jobs SET lease_expires_at = $4::timestamptz + make_interval(secs => $3)
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`
+	tag, err := db.Pool.Exec(ctx, query, id, attempt, lease.Seconds(), db.clock.Now())
+	if err != nil {
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("job not found")
+	}
+
+	return nil
+}
+
+// FinishJob records the outcome of a run and returns the job's new status.
+// A queued status schedules another attempt after retryAfter, keeping the
+// error and result of this one. A job that did not succeed after being asked
+// to stop is recorded as cancelled. Like RenewJobLease, it returns "job not
+// found" once attempt is no longer the job's running attempt, so a run that
+// lost its lease can't overwrite the outcome of the one that replaced it.
+func (db *DB) FinishJob(ctx context.Context, id uuid.UUID, attempt int, status string, result []byte, errMsg string, retryAfter time.Duration) (string, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN cancel_requested AND $1 <> 'succeeded' THEN 'cancelled' ELSE $1 END,
+		    result = $2,
+		    error = NULLIF($3, ''),
+		    processed = CASE WHEN $1 = 'queued' THEN 0 ELSE total END,
+		    finished_at = CASE WHEN $1 = 'queued' THEN NULL ELSE $7::timestamptz END,
+		    run_after = $7::timestamptz + make_interval(secs => $5),
+		    lease_expires_at = NULL
+		WHERE id = $4 AND attempts = $6 AND status = 'running'
+		RETURNING status
+	`
+	var final string
+	err := db.Pool.QueryRow(ctx, query, status, result, errMsg, id, retryAfter.Seconds(), attempt, db.clock.Now()).Scan(&final)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", fmt.Errorf("job not found")
+		}
+		return "", fmt.Errorf("failed to finish job: %w", err)
+	}
+
+	return final, nil
+}
+
+// RequeueJob hands a job interrupted by shutdown back to the queue without
+// using up an attempt, so another replica can run it straight away. A job
+// that was asked to stop is recorded as cancelled instead. Like FinishJob, it
+// only applies to the job's running attempt.
+func (db *DB) RequeueJob(ctx context.Context, id uuid.UUID, attempt int) (string, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'queued' END,
+		    attempts = CASE WHEN cancel_requested THEN attempts ELSE GREATEST(attempts - 1, 0) END,
+		    error = 'interrupted by shutdown',
+		    processed = 0,
+		    finished_at = CASE WHEN cancel_requested THEN $3::timestamptz END,
+		    run_after = $3,
+		    lease_expires_at = NULL
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+		RETURNING status
+	`
+	var final string
+	err := db.Pool.QueryRow(ctx, query, id, attempt, db.clock.Now()).Scan(&final)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", fmt.Errorf("job not found")
+		}
+		return "", fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	return final, nil
+}
+
+// ListJobs lists jobs newest first, optionally filtered by status and type,
+// resuming after the cursor when one is given
+func (db *DB) ListJobs(ctx context.Context, status, jobType string, after *models.Cursor, limit int) ([]models.Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2 = '' OR type = $2)
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5
+	`
+	var afterCreatedAt *time.Time
+	var afterID *uuid.UUID
+	if after != nil {
+		afterCreatedAt = &after.CreatedAt
+		afterID = &after.ID
+	}
+
+	rows, err := db.Pool.Query(ctx, query, status, jobType, afterCreatedAt, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// CancelJob cancels a queued job outright, or asks the replica running a
+// running job to stop it; the job's final status is recorded once it stops
+func (db *DB) CancelJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, "SELECT status FROM jobs WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("job not found")
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	var query string
+	switch status {
+	case models.JobStatusQueued:
+		query = `
+			UPDATE jobs SET status = 'cancelled', error = 'cancelled by request', finished_at = NOW()
+			WHERE id = $1
+			RETURNING ` + jobColumns
+	case models.JobStatusRunning:
+		query = `
+			UPDATE jobs SET cancel_requested = TRUE
+			WHERE id = $1
+			RETURNING ` + jobColumns
+		if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", JobsCancelledChannel, id.String()); err != nil {
+			return nil, fmt.Errorf("failed to notify job cancellation: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("job is not queued or running")
+	}
+
+	job, err := scanJob(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return job, nil
+}
+
+// RetryJob queues a failed, cancelled or dead-lettered job again with its
+// original payload and a fresh set of attempts
+func (db *DB) RetryJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', result = NULL, error = NULL, processed = 0, attempts = 0, run_after = $2,
+		    started_at = NULL, finished_at = NULL, cancel_requested = FALSE
+		WHERE id = $1 AND status IN ('failed', 'cancelled', 'dead')
+		RETURNING ` + jobColumns
+	job, err := scanJob(db.Pool.QueryRow(ctx, query, id, db.clock.Now()))
+	if err == nil {
+		return job, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	// Tell a missing job apart from one in the wrong state
+	if _, err := db.GetJob(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("job is not failed, cancelled or dead")
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AcquireLease takes or renews the named lease for holder, extending it by
+// ttl. The lease can only be taken over once it has expired. It returns the
+// current lease and whether holder now holds it.
+func (db *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*models.Lease, bool, error) {
+	query := `
+		INSERT INTO leases (name, holder, acquired_at, renewed_at, expires_at)
+		VALUES ($1, $2, $4, $4, $4::timestamptz + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+		    acquired_at = CASE WHEN leases.holder = EXCLUDED.holder THEN leases.acquired_at ELSE EXCLUDED.acquired_at END,
+		    renewed_at = EXCLUDED.renewed_at,
+		    expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < EXCLUDED.renewed_at
+		RETURNING name, holder, acquired_at, renewed_at, expires_at
+	`
+	lease, err := scanLease(db.Pool.QueryRow(ctx, query, name, holder, ttl.Seconds(), db.clock.Now()))
+	if err == nil {
+		return lease, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	// Another holder's lease is still live, unless it expired just now
+	lease, err = db.GetLease(ctx, name)
+	if err != nil {
+		if err.Error() == "lease not found" {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return lease, false, nil
+}
+
+// ReleaseLease gives up the named lease if holder holds it, letting another
+// instance take it without waiting for it to expire
+func (db *DB) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := db.Pool.Exec(ctx, "DELETE FROM leases WHERE name = $1 AND holder = $2", name, holder)
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+// GetLease gets the named lease if it has not expired
+func (db *DB) GetLease(ctx context.Context, name string) (*models.Lease, error) {
+	query := `
+		SELECT name, holder, acquired_at, renewed_at, expires_at
+		FROM leases
+		WHERE name = $1 AND expires_at >= $2
+	`
+	lease, err := scanLease(db.Pool.QueryRow(ctx, query, name, db.clock.Now()))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("lease not found")
+		}
+		return nil, fmt.Errorf("failed to get lease: %w", err)
+	}
+	return lease, nil
+}
+
+func scanLease(row pgx.Row) (*models.Lease, error) {
+	lease := &models.Lease{}
+	if err := row.Scan(&lease.Name, &lease.Holder, &lease.AcquiredAt, &lease.RenewedAt, &lease.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// lockNamespace is the first key of the two-key advisory locks taken by
+// WithLock, keeping them apart from the single-key locks used elsewhere
+const lockNamespace = 0x6463 // "dc"
+
+// WithLock runs fn while holding a session-level Postgres advisory lock named
+// name, so it runs on one replica at a time. When another replica holds the
+// lock, fn is not called and WithLock returns false. The lock is held on a
+// dedicated connection, so it is released if this replica dies mid-run.
+func (db *DB) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1, hashtext($2))", lockNamespace, name).Scan(&locked)
+	if err != nil {
+		return false, fmt.Errorf("failed to take lock %s: %w", name, err)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+		// Unlock even if ctx was cancelled; if this fails the connection is
+		// closed instead, which releases the lock
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1, hashtext($2))", lockNamespace, name); err != nil {
+			conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	return true, fn(ctx)
+}
+
+// Exclusive wraps a periodic task so each run happens on only one replica;
+// replicas that find the lock held skip the run
+func (db *DB) Exclusive(name string, logger *slog.Logger, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ran, err := db.WithLock(ctx, "task:"+name, fn)
+		if !ran && err == nil {
+			logger.Debug("Skipped background run held by another replica", "worker", name)
+		}
+		return err
+	}
+}
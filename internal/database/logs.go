@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeploymentLogsChannel is notified with the deployment ID whenever a chunk
+// is appended to a deployment's log
+const DeploymentLogsChannel = "deployment_logs"
+
+const logChunkColumns = `deployment_id, seq, content, agent, created_at`
+
+func scanLogChunk(row pgx.Row, chunk *models.DeploymentLogChunk) error {
+	return row.Scan(&chunk.DeploymentID, &chunk.Seq, &chunk.Content, &chunk.Agent, &chunk.CreatedAt)
+}
+
+// AppendDeploymentLog stores the next chunk of a deployment's log. A chunk
+// repeating a stored one is returned as stored, so agents may retry
+// uploads; chunks that skip ahead, differ from the stored chunk of their
+// seq or grow the log past maxBytes are rejected.
+func (db *DB) AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the deployment so concurrent uploads are numbered in turn
+	var locked uuid.UUID
+	err = tx.QueryRow(ctx, "SELECT id FROM deployments WHERE id = $1 FOR UPDATE", chunk.DeploymentID).Scan(&locked)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("deployment not found")
+		}
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	var archived bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM archived_deployment_logs WHERE deployment_id = $1)", chunk.DeploymentID).Scan(&archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check log archive: %w", err)
+	}
+	if archived {
+		return nil, fmt.Errorf("deployment log is archived")
+	}
+
+	stored := &models.DeploymentLogChunk{}
+	query := `SELECT ` + logChunkColumns + ` FROM deployment_logs WHERE deployment_id = $1 AND seq = $2`
+	err = scanLogChunk(tx.QueryRow(ctx, query, chunk.DeploymentID, chunk.Seq), stored)
+	if err == nil {
+		if stored.Content != chunk.Content {
+			return nil, fmt.Errorf("log chunk conflicts with the stored chunk")
+		}
+		return stored, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to get log chunk: %w", err)
+	}
+
+	var next, size int64
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(seq) + 1, 0), COALESCE(SUM(octet_length(content)), 0)
+		FROM deployment_logs
+		WHERE deployment_id = $1
+	`, chunk.DeploymentID).Scan(&next, &size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to size deployment log: %w", err)
+	}
+	if chunk.Seq != next {
+		return nil, fmt.Errorf("log chunk out of sequence: expected seq %d", next)
+	}
+	if size+int64(len(chunk.Content)) > maxBytes {
+		return nil, fmt.Errorf("log size limit exceeded")
+	}
+
+	query = `
+		INSERT INTO deployment_logs (deployment_id, seq, content, agent)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + logChunkColumns
+	err = scanLogChunk(tx.QueryRow(ctx, query, chunk.DeploymentID, chunk.Seq, chunk.Content, chunk.Agent), stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store log chunk: %w", err)
+	}
+
+	// Wake log streams on every replica once the chunk is committed
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", DeploymentLogsChannel, chunk.DeploymentID.String()); err != nil {
+		return nil, fmt.Errorf("failed to notify log streams: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return stored, nil
+}
+
+// ListDeploymentLogs lists up to limit chunks of a deployment's log from
+// fromSeq, and through toSeq unless it is negative, in order
+func (db *DB) ListDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, error) {
+	query := `
+		SELECT ` + logChunkColumns + `
+		FROM deployment_logs
+		WHERE deployment_id = $1 AND seq >= $2 AND ($3 < 0 OR seq <= $3)
+		ORDER BY seq
+		LIMIT $4
+	`
+	rows, err := db.Pool.Query(ctx, query, deploymentID, fromSeq, toSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment logs: %w", err)
+	}
+	defer rows.Close()
+
+	chunks := []models.DeploymentLogChunk{}
+	for rows.Next() {
+		var chunk models.DeploymentLogChunk
+		if err := scanLogChunk(rows, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to scan log chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment logs: %w", err)
+	}
+
+	return chunks, nil
+}
+
+// ArchiveDeploymentLog records a deployment log as moved to the blob store
+// and deletes its chunks. It fails with "deployment log changed" when the
+// log no longer has exactly archived.Chunks chunks, so none is lost to an
+// upload racing the archive.
+func (db *DB) ArchiveDeploymentLog(ctx context.Context, archived models.ArchivedDeploymentLog) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the deployment against uploads, as AppendDeploymentLog does
+	var locked uuid.UUID
+	err = tx.QueryRow(ctx, "SELECT id FROM deployments WHERE id = $1 FOR UPDATE", archived.DeploymentID).Scan(&locked)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("deployment not found")
+		}
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM deployment_logs WHERE deployment_id = $1", archived.DeploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete archived log chunks: %w", err)
+	}
+	if tag.RowsAffected() != archived.Chunks {
+		return fmt.Errorf("deployment log changed")
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO archived_deployment_logs (deployment_id, object_key, chunks)
+		VALUES ($1, $2, $3)
+	`, archived.DeploymentID, archived.Key, archived.Chunks)
+	if err != nil {
+		return fmt.Errorf("failed to record archived log: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetArchivedDeploymentLog returns where a deployment's log was archived
+func (db *DB) GetArchivedDeploymentLog(ctx context.Context, deploymentID uuid.UUID) (*models.ArchivedDeploymentLog, error) {
+	archived := &models.ArchivedDeploymentLog{}
+	err := db.Pool.QueryRow(ctx, `
+		SELECT deployment_id, object_key, chunks, archived_at
+		FROM archived_deployment_logs
+		WHERE deployment_id = $1
+	`, deploymentID).Scan(&archived.DeploymentID, &archived.Key, &archived.Chunks, &archived.ArchivedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("archived log not found")
+		}
+		return nil, fmt.Errorf("failed to get archived log: %w", err)
+	}
+	return archived, nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const maintenanceColumns = `domain, app_name, reason, started_by, started_at`
+
+func scanMaintenance(row pgx.Row, m *models.AppMaintenance) error {
+	if err := row.Scan(&m.Domain, &m.AppName, &m.Reason, &m.StartedBy, &m.StartedAt); err != nil {
+		return err
+	}
+	m.Enabled = true
+	return nil
+}
+
+// checkMaintenance locks an app's maintenance mode for the rest of tx and,
+// when ifMatch is non-nil, checks that its current ETag is one of the given
+// tags. The lock is taken on the app rather than its row, which doesn't
+// exist while maintenance is off.
+func checkMaintenance(ctx context.Context, tx pgx.Tx, domain, appName string, ifMatch []string) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('maintenance:' || $1 || '/' || $2))", domain, appName); err != nil {
+		return fmt.Errorf("failed to lock maintenance: %w", err)
+	}
+	if ifMatch == nil {
+		return nil
+	}
+
+	current := &models.AppMaintenance{}
+	query := `SELECT ` + maintenanceColumns + ` FROM app_maintenance WHERE domain = $1 AND app_name = $2`
+	if err := scanMaintenance(tx.QueryRow(ctx, query, domain, appName), current); err != nil {
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("failed to get maintenance: %w", err)
+		}
+		current = &models.AppMaintenance{Domain: domain, AppName: appName}
+	}
+	if !etagIn(current.ETag(), ifMatch) {
+		return fmt.Errorf("precondition failed")
+	}
+	return nil
+}
+
+// StartMaintenance puts an app in maintenance; for an app already in
+// maintenance only the reason changes. When ifMatch is non-nil the change is
+// only applied if the current ETag is one of the given tags.
+func (db *DB) StartMaintenance(ctx context.Context, m models.AppMaintenance, ifMatch []string) (*models.AppMaintenance, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkMaintenance(ctx, tx, m.Domain, m.AppName, ifMatch); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO app_maintenance (domain, app_name, reason, started_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET reason = EXCLUDED.reason
+		RETURNING ` + maintenanceColumns
+	stored := &models.AppMaintenance{}
+	if err := scanMaintenance(tx.QueryRow(ctx, query, m.Domain, m.AppName, m.Reason, m.StartedBy), stored); err != nil {
+		return nil, fmt.Errorf("failed to start maintenance: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stored, nil
+}
+
+// EndMaintenance takes an app out of maintenance; apps not in maintenance
+// are left as they are. When ifMatch is non-nil the change is only applied
+// if the current ETag is one of the given tags.
+func (db *DB) EndMaintenance(ctx context.Context, domain, appName string, ifMatch []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkMaintenance(ctx, tx, domain, appName, ifMatch); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM app_maintenance WHERE domain = $1 AND app_name = $2", domain, appName); err != nil {
+		return fmt.Errorf("failed to end maintenance: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetMaintenance gets an app's maintenance mode, which is off unless the
+// app was put in maintenance
+func (db *DB) GetMaintenance(ctx context.Context, domain, appName string) (*models.AppMaintenance, error) {
+	query := `SELECT ` + maintenanceColumns + ` FROM app_maintenance WHERE domain = $1 AND app_name = $2`
+	m := &models.AppMaintenance{}
+	if err := scanMaintenance(db.Pool.QueryRow(ctx, query, domain, appName), m); err != nil {
+		if err == pgx.ErrNoRows {
+			return &models.AppMaintenance{Domain: domain, AppName: appName}, nil
+		}
+		return nil, fmt.Errorf("failed to get maintenance: %w", err)
+	}
+
+	return m, nil
+}
+
+// ListMaintenance lists the apps in maintenance, ordered by domain and app
+// name
+func (db *DB) ListMaintenance(ctx context.Context) ([]models.AppMaintenance, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+maintenanceColumns+` FROM app_maintenance ORDER BY domain, app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance: %w", err)
+	}
+	defer rows.Close()
+
+	apps := []models.AppMaintenance{}
+	for rows.Next() {
+		var m models.AppMaintenance
+		if err := scanMaintenance(rows, &m); err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance: %w", err)
+		}
+		apps = append(apps, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating maintenance: %w", err)
+	}
+
+	return apps, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeploymentsChangedChannel is notified by a trigger whenever deployments change
+const DeploymentsChangedChannel = "deployments_changed"
+
+// listenRetryInterval is how long Listen waits before reconnecting
+const listenRetryInterval = 5 * time.Second
+
+// Listen subscribes to a Postgres NOTIFY channel and calls onNotify for every
+// notification until ctx is cancelled. The connection is re-established after
+// errors, and onNotify is called with an empty payload after each reconnect
+// since notifications may have been missed in between.
+func (db *DB) Listen(ctx context.Context, channel string, onNotify func(payload string), logger *slog.Logger) {
+	for {
+		err := db.listenOnce(ctx, channel, onNotify)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn("Lost database notification listener, reconnecting",
+			"channel", channel,
+			"error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+
+		onNotify("")
+	}
+}
+
+// listenOnce holds a dedicated connection listening on channel until an error occurs
+func (db *DB) listenOnce(ctx context.Context, channel string, onNotify func(payload string)) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+		onNotify(notification.Payload)
+	}
+}
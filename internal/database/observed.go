@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const observedStateColumns = `domain, app_name, deployment_id, docker_image, digest, replicas, agent, reported_at`
+
+func scanObservedState(row pgx.Row, state *models.ObservedState) error {
+	return row.Scan(&state.Domain, &state.AppName, &state.DeploymentID, &state.DockerImage,
+		&state.Digest, &state.Replicas, &state.Agent, &state.ReportedAt)
+}
+
+// RecordObservedState stores an agent's report of what runs for an app,
+// replacing its previous report
+func (db *DB) RecordObservedState(ctx context.Context, state models.ObservedState) (*models.ObservedState, error) {
+	query := `
+		INSERT INTO observed_states (domain, app_name, deployment_id, docker_image, digest, replicas, agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET deployment_id = EXCLUDED.deployment_id,
+		    docker_image = EXCLUDED.docker_image,
+		    digest = EXCLUDED.digest,
+		    replicas = EXCLUDED.replicas,
+		    agent = EXCLUDED.agent,
+		    reported_at = NOW()
+		RETURNING ` + observedStateColumns
+	stored := &models.ObservedState{}
+	row := db.Pool.QueryRow(ctx, query, state.Domain, state.AppName, state.DeploymentID,
+		state.DockerImage, state.Digest, state.Replicas, state.Agent)
+	if err := scanObservedState(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to record observed state: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetObservedState gets the latest report for an app
+func (db *DB) GetObservedState(ctx context.Context, domain, appName string) (*models.ObservedState, error) {
+	query := `SELECT ` + observedStateColumns + ` FROM observed_states WHERE domain = $1 AND app_name = $2`
+	state := &models.ObservedState{}
+	if err := scanObservedState(db.Pool.QueryRow(ctx, query, domain, appName), state); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("observed state not found")
+		}
+		return nil, fmt.Errorf("failed to get observed state: %w", err)
+	}
+
+	return state, nil
+}
+
+// ListObservedStates lists the latest report of every app ordered by domain
+// and app name
+func (db *DB) ListObservedStates(ctx context.Context) ([]models.ObservedState, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+observedStateColumns+` FROM observed_states ORDER BY domain, app_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observed states: %w", err)
+	}
+	defer rows.Close()
+
+	states := []models.ObservedState{}
+	for rows.Next() {
+		var state models.ObservedState
+		if err := scanObservedState(rows, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan observed state: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating observed states: %w", err)
+	}
+
+	return states, nil
+}
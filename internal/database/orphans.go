@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// ListMissingSecretProjects lists up to limit deployments whose env
+// references a secret project that no longer holds any secrets, newest
+// first. Agents fail to resolve those references, so such a deployment
+// cannot be rolled out or rolled back to. External (scheme://) references
+// are not checked.
+func (db *DB) ListMissingSecretProjects(ctx context.Context, limit int) ([]models.MissingSecretProject, error) {
+	query := `
+		SELECT d.id, d.domain, d.app_name, d.version, ref.project
+		FROM deployments d
+		CROSS JOIN LATERAL (
+			SELECT DISTINCT substring(e FROM '=\$\{secret:([^/}:]+)/') AS project
+			FROM unnest(d.env) e
+		) ref
+		WHERE ref.project IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM secrets s WHERE s.project = ref.project)
+		ORDER BY d.created_at DESC, d.id, ref.project
+		LIMIT $1
+	`
+	rows, err := db.Pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missing secret projects: %w", err)
+	}
+	defer rows.Close()
+
+	missing := []models.MissingSecretProject{}
+	for rows.Next() {
+		var m models.MissingSecretProject
+		if err := rows.Scan(&m.DeploymentID, &m.Domain, &m.AppName, &m.Version, &m.Project); err != nil {
+			return nil, fmt.Errorf("failed to scan missing secret project: %w", err)
+		}
+		missing = append(missing, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating missing secret projects: %w", err)
+	}
+	return missing, nil
+}
+
+// ListDeploymentImages lists the distinct images of every deployment
+func (db *DB) ListDeploymentImages(ctx context.Context) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, "SELECT DISTINCT docker_image FROM deployments ORDER BY docker_image")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []string{}
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment image: %w", err)
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment images: %w", err)
+	}
+	return images, nil
+}
+
+// ListStaleRegistries lists the registries whose credentials were last
+// stored before the given time
+func (db *DB) ListStaleRegistries(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, "SELECT registry FROM docker_credentials WHERE updated_at < $1 ORDER BY registry", before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry credentials: %w", err)
+	}
+	defer rows.Close()
+
+	registries := []string{}
+	for rows.Next() {
+		var registry string
+		if err := rows.Scan(&registry); err != nil {
+			return nil, fmt.Errorf("failed to scan registry credential: %w", err)
+		}
+		registries = append(registries, registry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating registry credentials: %w", err)
+	}
+	return registries, nil
+}
+
+// DeleteRegistryCredentials deletes the credentials of the given registries
+// that were last stored before the given time, so credentials stored again
+// since they were listed are kept, and returns how many were deleted
+func (db *DB) DeleteRegistryCredentials(ctx context.Context, registries []string, before time.Time) (int64, error) {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM docker_credentials WHERE registry = ANY($1) AND updated_at < $2", registries, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete registry credentials: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListDanglingLogs lists the deployments whose log was archived but still
+// has chunks in Postgres, with how many. Archiving deletes the chunks, so
+// any left were uploaded after it or restored alongside it.
+func (db *DB) ListDanglingLogs(ctx context.Context) ([]models.DanglingLog, error) {
+	query := `
+		SELECT l.deployment_id, COUNT(*)
+		FROM deployment_logs l
+		JOIN archived_deployment_logs a ON a.deployment_id = l.deployment_id
+		GROUP BY l.deployment_id
+		ORDER BY l.deployment_id
+	`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dangling logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []models.DanglingLog{}
+	for rows.Next() {
+		var l models.DanglingLog
+		if err := rows.Scan(&l.DeploymentID, &l.Chunks); err != nil {
+			return nil, fmt.Errorf("failed to scan dangling log: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating dangling logs: %w", err)
+	}
+	return logs, nil
+}
+
+// DeleteDanglingLogs deletes the chunks of archived deployment logs still
+// in Postgres and returns how many were deleted. While they are left, the
+// log endpoints serve them instead of the archived log.
+func (db *DB) DeleteDanglingLogs(ctx context.Context) (int64, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM deployment_logs l
+		USING archived_deployment_logs a
+		WHERE a.deployment_id = l.deployment_id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dangling logs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// RecordHealthProbe stores the result of an agent's health probe of an app
+// and, when it is the app's latest probe, opens an incident for an unhealthy
+// app or resolves its open incident for a healthy one
+func (db *DB) RecordHealthProbe(ctx context.Context, probe models.HealthProbe) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO health_probes (domain, app_name, deployment_id, healthy, agent, checked_at, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.Exec(ctx, query, probe.Domain, probe.AppName, probe.DeploymentID,
+		probe.Healthy, probe.Agent, probe.CheckedAt, probe.LatencyMs)
+	if err != nil {
+		return fmt.Errorf("failed to record health probe: %w", err)
+	}
+
+	// Probes reported late must not reopen or resolve incidents out of order
+	latest := `NOT EXISTS (
+		SELECT 1 FROM health_probes
+		WHERE domain = $1 AND app_name = $2 AND checked_at > $3
+	)`
+	if probe.Healthy {
+		query = `
+			UPDATE incidents SET resolved_at = $3
+			WHERE domain = $1 AND app_name = $2 AND resolved_at IS NULL AND started_at <= $3
+			  AND ` + latest
+		_, err = tx.Exec(ctx, query, probe.Domain, probe.AppName, probe.CheckedAt)
+	} else {
+		query = `
+			INSERT INTO incidents (domain, app_name, deployment_id, started_at)
+			SELECT $1, $2, $4, $3
+			WHERE ` + latest + `
+			ON CONFLICT (domain, app_name) WHERE resolved_at IS NULL DO NOTHING`
+		_, err = tx.Exec(ctx, query, probe.Domain, probe.AppName, probe.CheckedAt, probe.DeploymentID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update incidents: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListLatestHealthProbes lists the latest health probe of every app
+func (db *DB) ListLatestHealthProbes(ctx context.Context) ([]models.HealthProbe, error) {
+	query := `
+		SELECT DISTINCT ON (domain, app_name) domain, app_name, deployment_id, healthy, agent, checked_at, latency_ms
+		FROM health_probes
+		ORDER BY domain, app_name, checked_at DESC
+	`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health probes: %w", err)
+	}
+	defer rows.Close()
+
+	probes := []models.HealthProbe{}
+	for rows.Next() {
+		var p models.HealthProbe
+		if err := rows.Scan(&p.Domain, &p.AppName, &p.DeploymentID, &p.Healthy, &p.Agent, &p.CheckedAt, &p.LatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan health probe: %w", err)
+		}
+		probes = append(probes, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating health probes: %w", err)
+	}
+
+	return probes, nil
+}
+
+// GetSLACounts counts each app's health probes, pushed deployments and
+// incidents since the given time, ordered by domain and app name. Apps with
+// none are left out.
+func (db *DB) GetSLACounts(ctx context.Context, since time.Time) ([]models.SLACounts, error) {
+	query := `
+		WITH probes AS (
+			SELECT domain, app_name, COUNT(*) AS probes, COUNT(*) FILTER (WHERE healthy) AS healthy_probes
+			FROM health_probes
+			WHERE checked_at >= $1
+			GROUP BY domain, app_name
+		), pushed AS (
+			SELECT domain, app_name, COUNT(*) AS deployments, COUNT(*) FILTER (WHERE status = 'failed') AS failed_deployments
+			FROM deployments
+			WHERE created_at >= $1
+			GROUP BY domain, app_name
+		), down AS (
+			SELECT domain, app_name, COUNT(*) AS incidents,
+			       EXTRACT(EPOCH FROM SUM(COALESCE(resolved_at, NOW()) - GREATEST(started_at, $1)))::float8 AS downtime
+			FROM incidents
+			WHERE COALESCE(resolved_at, NOW()) > $1
+			GROUP BY domain, app_name
+		), apps AS (
+			SELECT domain, app_name FROM probes
+			UNION SELECT domain, app_name FROM pushed
+			UNION SELECT domain, app_name FROM down
+		)
+		SELECT a.domain, a.app_name,
+		       COALESCE(p.probes, 0), COALESCE(p.healthy_probes, 0),
+		       COALESCE(d.deployments, 0), COALESCE(d.failed_deployments, 0),
+		       COALESCE(i.incidents, 0), COALESCE(i.downtime, 0)
+		FROM apps a
+		LEFT JOIN probes p ON p.domain = a.domain AND p.app_name = a.app_name
+		LEFT JOIN pushed d ON d.domain = a.domain AND d.app_name = a.app_name
+		LEFT JOIN down i ON i.domain = a.domain AND i.app_name = a.app_name
+		ORDER BY 1, 2
+	`
+	rows, err := db.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SLA counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.SLACounts{}
+	for rows.Next() {
+		var c models.SLACounts
+		var downtime float64
+		err := rows.Scan(&c.Domain, &c.AppName, &c.Probes, &c.HealthyProbes, &c.Deployments, &c.FailedDeployments,
+			&c.Incidents, &downtime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SLA counts: %w", err)
+		}
+		c.Downtime = time.Duration(downtime * float64(time.Second))
+		counts = append(counts, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating SLA counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// latencyPercentiles selects the sample count and percentiles of the
+// latency_ms of the health probes grouped
+const latencyPercentiles = `COUNT(*),
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY latency_ms),
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY latency_ms),
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY latency_ms)`
+
+// GetLatencySeries computes the latency percentiles of an app's health
+// probes since the given time in steps of the given length, oldest first.
+// Steps without timed probes are left out.
+func (db *DB) GetLatencySeries(ctx context.Context, domain, appName string, since time.Time, step time.Duration) ([]models.LatencyPoint, error) {
+	query := `
+		SELECT to_timestamp(floor(extract(epoch FROM checked_at) / $4) * $4) AS step,
+		       ` + latencyPercentiles + `
+		FROM health_probes
+		WHERE domain = $1 AND app_name = $2 AND checked_at >= $3 AND latency_ms IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1
+	`
+	rows, err := db.Pool.Query(ctx, query, domain, appName, since, step.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latency series: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.LatencyPoint{}
+	for rows.Next() {
+		var p models.LatencyPoint
+		if err := rows.Scan(&p.Time, &p.Samples, &p.P50, &p.P90, &p.P99); err != nil {
+			return nil, fmt.Errorf("failed to scan latency point: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating latency series: %w", err)
+	}
+
+	return points, nil
+}
+
+// GetDeploymentLatencies computes the latency percentiles of an app's
+// health probes since the given time per deployment probed, oldest version
+// first
+func (db *DB) GetDeploymentLatencies(ctx context.Context, domain, appName string, since time.Time) ([]models.DeploymentLatency, error) {
+	query := `
+		SELECT d.id, d.version, d.deployed_at,
+		       ` + latencyPercentiles + `
+		FROM health_probes p
+		JOIN deployments d ON d.id = p.deployment_id
+		WHERE p.domain = $1 AND p.app_name = $2 AND p.checked_at >= $3 AND p.latency_ms IS NOT NULL
+		GROUP BY d.id, d.version, d.deployed_at
+		ORDER BY d.version
+	`
+	rows, err := db.Pool.Query(ctx, query, domain, appName, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment latencies: %w", err)
+	}
+	defer rows.Close()
+
+	latencies := []models.DeploymentLatency{}
+	for rows.Next() {
+		var l models.DeploymentLatency
+		if err := rows.Scan(&l.DeploymentID, &l.Version, &l.DeployedAt, &l.Samples, &l.P50, &l.P90, &l.P99); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment latency: %w", err)
+		}
+		latencies = append(latencies, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment latencies: %w", err)
+	}
+
+	return latencies, nil
+}
+
+// PruneHealthProbes deletes the health probes checked before the given time
+// and returns how many were deleted
+func (db *DB) PruneHealthProbes(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM health_probes WHERE checked_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune health probes: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RecordPushRequest stores a push batch and which of its items failed. A
+// batch processed again, such as a retried push job, replaces its record.
+func (db *DB) RecordPushRequest(ctx context.Context, req models.PushRequest) error {
+	deployments, err := json.Marshal(req.Deployments)
+	if err != nil {
+		return fmt.Errorf("failed to encode push request: %w", err)
+	}
+	options := req.Options
+	if len(options) == 0 {
+		options = json.RawMessage("{}")
+	}
+	failed := req.Failed
+	if failed == nil {
+		failed = []int{}
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO push_requests (request_id, deployments, options, failed, replay_of, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (request_id) DO UPDATE
+		SET deployments = EXCLUDED.deployments, options = EXCLUDED.options, failed = EXCLUDED.failed
+	`, req.RequestID, deployments, []byte(options), failed, req.ReplayOf)
+	if err != nil {
+		return fmt.Errorf("failed to record push request: %w", err)
+	}
+	return nil
+}
+
+// GetPushRequest returns a stored push batch
+func (db *DB) GetPushRequest(ctx context.Context, requestID string) (*models.PushRequest, error) {
+	req := &models.PushRequest{}
+	var deployments, options []byte
+	err := db.Pool.QueryRow(ctx, `
+		SELECT request_id, deployments, options, failed, replay_of, created_at
+		FROM push_requests
+		WHERE request_id = $1
+	`, requestID).Scan(&req.RequestID, &deployments, &options, &req.Failed, &req.ReplayOf, &req.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("push request not found")
+		}
+		return nil, fmt.Errorf("failed to get push request: %w", err)
+	}
+
+	if err := json.Unmarshal(deployments, &req.Deployments); err != nil {
+		return nil, fmt.Errorf("failed to decode push request: %w", err)
+	}
+	req.Options = options
+	return req, nil
+}
+
+// PrunePushRequests deletes the push batches submitted before the given
+// time and returns how many were deleted, or would be with dryRun
+func (db *DB) PrunePushRequests(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	n, err := db.prune(ctx, "push_requests", "created_at < $1", dryRun, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune push requests: %w", err)
+	}
+	return n, nil
+}
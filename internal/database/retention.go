@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// expiredLogs selects the deployments whose last log chunk was uploaded
+// before $1
+const expiredLogs = `
+	SELECT deployment_id FROM deployment_logs
+	GROUP BY deployment_id
+	HAVING MAX(created_at) < $1
+`
+
+// prunableVersions selects every version of each app but its $1 newest, its
+// newest deployed version (what rollbacks return to) and versions still
+// pending or deploying
+const prunableVersions = `
+	SELECT id FROM (
+		SELECT id, version, status,
+		       ROW_NUMBER() OVER (PARTITION BY domain, app_name ORDER BY version DESC) AS rank,
+		       MAX(version) FILTER (WHERE status = 'deployed') OVER (PARTITION BY domain, app_name) AS deployed_version
+		FROM deployments
+	) ranked
+	WHERE rank > $1
+	  AND version <> COALESCE(deployed_version, 0)
+	  AND status NOT IN ('pending', 'deploying')
+`
+
+// PruneDeploymentLogs deletes the logs of deployments whose last chunk was
+// uploaded before the given time and returns how many chunks were deleted.
+// Logs are pruned whole, so none is left without its beginning. With dryRun
+// nothing is deleted and the chunks that would be are counted.
+func (db *DB) PruneDeploymentLogs(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	n, err := db.prune(ctx, "deployment_logs", "deployment_id IN ("+expiredLogs+")", dryRun, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deployment logs: %w", err)
+	}
+	return n, nil
+}
+
+// PruneDeploymentEvents deletes the deployment events recorded before the
+// given time and returns how many were deleted, or would be with dryRun
+func (db *DB) PruneDeploymentEvents(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	n, err := db.prune(ctx, "deployment_events", "created_at < $1", dryRun, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deployment events: %w", err)
+	}
+	return n, nil
+}
+
+// PruneDeploymentVersions deletes every version of each app but its keep
+// newest, its newest deployed version (what rollbacks return to) and
+// versions still pending or deploying, and returns how many were deleted,
+// or would be with dryRun. Their logs, events, checks and retry state go
+// with them.
+func (db *DB) PruneDeploymentVersions(ctx context.Context, keep int, dryRun bool) (int64, error) {
+	n, err := db.prune(ctx, "deployments", "id IN ("+prunableVersions+")", dryRun, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deployment versions: %w", err)
+	}
+	return n, nil
+}
+
+// ListExpiredDeploymentLogs lists up to limit deployments whose last log
+// chunk was uploaded before the given time, for archiving
+func (db *DB) ListExpiredDeploymentLogs(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	rows, err := db.Pool.Query(ctx, expiredLogs+" LIMIT $2", before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired deployment logs: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan expired deployment log: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating expired deployment logs: %w", err)
+	}
+	return ids, nil
+}
+
+// ListPrunableDeploymentVersions lists up to limit of the versions
+// PruneDeploymentVersions would delete, for archiving
+func (db *DB) ListPrunableDeploymentVersions(ctx context.Context, keep, limit int) ([]models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE id IN (` + prunableVersions + `)
+		ORDER BY domain, app_name, version
+		LIMIT $2
+	`
+	rows, err := db.Pool.Query(ctx, query, keep, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prunable versions: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []models.Deployment{}
+	for rows.Next() {
+		var d models.Deployment
+		if err := scanDeployment(rows, &d); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating prunable versions: %w", err)
+	}
+	return deployments, nil
+}
+
+// DeleteDeployment deletes one deployment version with its logs, events,
+// checks and retry state. A non-nil ifMatch makes the delete conditional on
+// the deployment's current ETag being one of the given tags.
+func (db *DB) DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row so a concurrent update can't slip in between the
+	// precondition and the delete
+	deployment := &models.Deployment{}
+	err = scanDeployment(tx.QueryRow(ctx, "SELECT "+deploymentColumns+" FROM deployments WHERE id = $1 FOR UPDATE", id), deployment)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("deployment not found")
+		}
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if ifMatch != nil && !etagIn(deployment.ETag(), ifMatch) {
+		return fmt.Errorf("precondition failed")
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM deployments WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete deployment: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// prune deletes the rows of table matching where and returns how many were
+// deleted; with dryRun it only counts them
+func (db *DB) prune(ctx context.Context, table, where string, dryRun bool, args ...any) (int64, error) {
+	if dryRun {
+		var n int64
+		err := db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&n)
+		return n, err
+	}
+
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM "+table+" WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// UpsertRetryPolicy creates or replaces an app's retry policy
+func (db *DB) UpsertRetryPolicy(ctx context.Context, policy models.RetryPolicy) (*models.RetryPolicy, error) {
+	query := `
+		INSERT INTO retry_policies (domain, app_name, max_attempts, initial_backoff_seconds, max_backoff_seconds, jitter, retry_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET max_attempts = EXCLUDED.max_attempts,
+		    initial_backoff_seconds = EXCLUDED.initial_backoff_seconds,
+		    max_backoff_seconds = EXCLUDED.max_backoff_seconds,
+		    jitter = EXCLUDED.jitter,
+		    retry_on = EXCLUDED.retry_on,
+		    updated_at = NOW()
+		RETURNING updated_at
+	`
+	err := db.Pool.QueryRow(ctx, query, policy.Domain, policy.AppName, policy.MaxAttempts,
+		policy.InitialBackoffSeconds, policy.MaxBackoffSeconds, policy.Jitter, policy.RetryOn).Scan(&policy.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert retry policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// GetRetryPolicy gets an app's retry policy
+func (db *DB) GetRetryPolicy(ctx context.Context, domain, appName string) (*models.RetryPolicy, error) {
+	return getRetryPolicy(ctx, db.Pool, domain, appName)
+}
+
+func getRetryPolicy(ctx context.Context, q querier, domain, appName string) (*models.RetryPolicy, error) {
+	policy := &models.RetryPolicy{}
+	query := `
+		SELECT domain, app_name, max_attempts, initial_backoff_seconds, max_backoff_seconds, jitter, retry_on, updated_at
+		FROM retry_policies
+		WHERE domain = $1 AND app_name = $2
+	`
+	err := q.QueryRow(ctx, query, domain, appName).Scan(&policy.Domain, &policy.AppName, &policy.MaxAttempts,
+		&policy.InitialBackoffSeconds, &policy.MaxBackoffSeconds, &policy.Jitter, &policy.RetryOn, &policy.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("retry policy not found")
+		}
+		return nil, fmt.Errorf("failed to get retry policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// DeleteRetryPolicy deletes an app's retry policy; retries already scheduled
+// still run
+func (db *DB) DeleteRetryPolicy(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM retry_policies WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete retry policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("retry policy not found")
+	}
+
+	return nil
+}
+
+// recordDeploymentEvent adds an entry to a deployment's timeline; attempt 0
+// is stored as NULL
+func recordDeploymentEvent(ctx context.Context, q querier, deploymentID uuid.UUID, eventType, message string, attempt int) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO deployment_events (deployment_id, type, message, attempt)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+	`, deploymentID, eventType, message, attempt)
+	if err != nil {
+		return fmt.Errorf("failed to record deployment event: %w", err)
+	}
+	return nil
+}
+
+// recordStatusChange records a status_changed event on a deployment's
+// timeline with the statuses it moved between
+func recordStatusChange(ctx context.Context, q querier, deploymentID uuid.UUID, from, to, message string) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO deployment_events (deployment_id, type, message, from_status, to_status)
+		VALUES ($1, $2, $3, $4, $5)
+	`, deploymentID, models.EventStatusChanged, message, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to record deployment event: %w", err)
+	}
+	return nil
+}
+
+// AddDeploymentEvent adds an entry to a deployment's timeline
+func (db *DB) AddDeploymentEvent(ctx context.Context, deploymentID uuid.UUID, eventType, message string) error {
+	return recordDeploymentEvent(ctx, db.Pool, deploymentID, eventType, message, 0)
+}
+
+// scheduleRetry schedules the next attempt of a deployment that just failed,
+// if its app has a retry policy with attempts left that retries its failure;
+// the backoff runs from now
+func scheduleRetry(ctx context.Context, q querier, deployment *models.Deployment, now time.Time) error {
+	policy, err := getRetryPolicy(ctx, q, deployment.Domain, deployment.AppName)
+	if err != nil {
+		if err.Error() == "retry policy not found" {
+			return nil
+		}
+		return err
+	}
+
+	if !policy.Retries(deployment.Failure) {
+		message := "retry skipped: failed without an error code"
+		if deployment.Failure != nil {
+			message = "retry skipped: error code " + deployment.Failure.Code + " is not retried by the policy"
+		}
+		return recordDeploymentEvent(ctx, q, deployment.ID, models.EventRetrySkipped, message, 0)
+	}
+
+	var attempts int
+	err = q.QueryRow(ctx, `
+		INSERT INTO deployment_retries (deployment_id) VALUES ($1)
+		ON CONFLICT (deployment_id) DO UPDATE SET attempts = deployment_retries.attempts
+		RETURNING attempts
+	`, deployment.ID).Scan(&attempts)
+	if err != nil {
+		return fmt.Errorf("failed to get retry state: %w", err)
+	}
+
+	if attempts >= policy.MaxAttempts {
+		message := fmt.Sprintf("attempt %d of %d failed; no retries left", attempts, policy.MaxAttempts)
+		return recordDeploymentEvent(ctx, q, deployment.ID, models.EventRetriesExhausted, message, attempts)
+	}
+
+	delay := policy.Backoff(attempts, rand.Float64())
+	_, err = q.Exec(ctx, `
+		UPDATE deployment_retries
+		SET next_retry_at = $2
+		WHERE deployment_id = $1
+	`, deployment.ID, now.Add(delay))
+	if err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+
+	message := fmt.Sprintf("attempt %d of %d failed; retrying in %s", attempts, policy.MaxAttempts, delay.Round(time.Second))
+	return recordDeploymentEvent(ctx, q, deployment.ID, models.EventRetryScheduled, message, attempts)
+}
+
+// RunDueRetries resets failed deployments whose retry is due to pending so
+// agents pick them up again. A retry is skipped when the deployment is no
+// longer failed or a newer version of the app exists. Due rows are locked
+// with SKIP LOCKED, so concurrent replicas never retry the same deployment.
+func (db *DB) RunDueRetries(ctx context.Context) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT r.deployment_id, r.attempts, d.status, d.domain, d.app_name, d.version
+		FROM deployment_retries r
+		JOIN deployments d ON d.id = r.deployment_id
+		WHERE r.next_retry_at <= $1
+		ORDER BY r.next_retry_at
+		FOR UPDATE OF r, d SKIP LOCKED
+		LIMIT 100
+	`, db.clock.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query due retries: %w", err)
+	}
+
+	type dueRetry struct {
+		id       uuid.UUID
+		attempts int
+		status   string
+		domain   string
+		appName  string
+		version  int
+	}
+	var due []dueRetry
+	for rows.Next() {
+		var r dueRetry
+		if err := rows.Scan(&r.id, &r.attempts, &r.status, &r.domain, &r.appName, &r.version); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan retry: %w", err)
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating retries: %w", err)
+	}
+
+	retried := 0
+	for _, r := range due {
+		var latest int
+		err := tx.QueryRow(ctx, "SELECT MAX(version) FROM deployments WHERE domain = $1 AND app_name = $2",
+			r.domain, r.appName).Scan(&latest)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get latest version: %w", err)
+		}
+
+		eventType, attempt := models.EventRetried, r.attempts+1
+		message := fmt.Sprintf("retrying: attempt %d", attempt)
+		switch {
+		case r.status != "failed":
+			eventType, attempt = models.EventRetrySkipped, r.attempts
+			message = "retry skipped: status is now " + r.status
+		case r.version < latest:
+			eventType, attempt = models.EventRetrySkipped, r.attempts
+			message = fmt.Sprintf("retry skipped: superseded by version %d", latest)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE deployment_retries SET attempts = $2, next_retry_at = NULL WHERE deployment_id = $1
+		`, r.id, attempt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update retry state: %w", err)
+		}
+
+		if eventType == models.EventRetried {
+			// Reset like a requeue, so the retried attempt doesn't carry
+			// the failure or verification of the last one
+			_, err := tx.Exec(ctx, `
+				UPDATE deployments
+				SET status = 'pending', deployed_at = NULL, verification = '', verified_at = NULL,
+				    failure_code = '', failure_message = '', failure_details = NULL
+				WHERE id = $1
+			`, r.id)
+			if err != nil {
+				return 0, fmt.Errorf("failed to reset deployment status: %w", err)
+			}
+			retried++
+		}
+
+		if err := recordDeploymentEvent(ctx, tx, r.id, eventType, message, attempt); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return retried, nil
+}
+
+// ListDeploymentEvents lists a deployment's timeline, oldest first
+func (db *DB) ListDeploymentEvents(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, deployment_id, type, message, COALESCE(attempt, 0), created_at,
+		       COALESCE(from_status, ''), COALESCE(to_status, '')
+		FROM deployment_events
+		WHERE deployment_id = $1
+		ORDER BY created_at, id
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.DeploymentEvent{}
+	for rows.Next() {
+		var event models.DeploymentEvent
+		err := rows.Scan(&event.ID, &event.DeploymentID, &event.Type, &event.Message, &event.Attempt, &event.CreatedAt,
+			&event.FromStatus, &event.ToStatus)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment events: %w", err)
+	}
+
+	return events, nil
+}
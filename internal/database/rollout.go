@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rolloutLimits holds the rollout limits and deploying counts that decide
+// which pending deployments may start
+type rolloutLimits struct {
+	// defaultDomain applies to domains without their own limit; 0 means
+	// unlimited
+	defaultDomain int
+
+	limits          map[[2]string]int
+	domainDeploying map[string]int
+	appDeploying    map[[2]string]int
+}
+
+// loadRolloutLimits reads the limits and current deploying counts for the
+// given domains
+func loadRolloutLimits(ctx context.Context, q pgxQuerier, domains []string, defaultDomain int) (*rolloutLimits, error) {
+	r := &rolloutLimits{
+		defaultDomain:   defaultDomain,
+		limits:          map[[2]string]int{},
+		domainDeploying: map[string]int{},
+		appDeploying:    map[[2]string]int{},
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT domain, app_name, max_deploying FROM rollout_limits WHERE domain = ANY($1)
+	`, domains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollout limits: %w", err)
+	}
+	for rows.Next() {
+		var key [2]string
+		var limit int
+		if err := rows.Scan(&key[0], &key[1], &limit); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan rollout limit: %w", err)
+		}
+		r.limits[key] = limit
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rollout limits: %w", err)
+	}
+
+	// Every version still deploying counts, so an app's next version waits
+	// for the previous rollout to finish when its limit is 1
+	rows, err = q.Query(ctx, `
+		SELECT domain, app_name, COUNT(*) FROM deployments
+		WHERE status = 'deploying' AND domain = ANY($1)
+		GROUP BY domain, app_name
+	`, domains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count deploying deployments: %w", err)
+	}
+	for rows.Next() {
+		var key [2]string
+		var count int
+		if err := rows.Scan(&key[0], &key[1], &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan deploying count: %w", err)
+		}
+		r.appDeploying[key] = count
+		r.domainDeploying[key[0]] += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deploying counts: %w", err)
+	}
+
+	return r, nil
+}
+
+// allow reports whether d may start now and, if so, counts it as deploying
+func (r *rolloutLimits) allow(d *models.Deployment) bool {
+	domainLimit, ok := r.limits[[2]string{d.Domain, ""}]
+	if !ok {
+		domainLimit = r.defaultDomain
+	}
+	if domainLimit > 0 && r.domainDeploying[d.Domain] >= domainLimit {
+		return false
+	}
+
+	app := [2]string{d.Domain, d.AppName}
+	if appLimit, ok := r.limits[app]; ok && r.appDeploying[app] >= appLimit {
+		return false
+	}
+
+	r.domainDeploying[d.Domain]++
+	r.appDeploying[app]++
+	return true
+}
+
+// pgxQuerier is implemented by both the pool and transactions
+type pgxQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// pendingDeployments lists the latest versions still pending and not held
+// by CI checks, most urgent priority first and oldest first within a
+// priority
+func pendingDeployments(ctx context.Context, q pgxQuerier, domain string) ([]models.Deployment, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM latest_deployments l
+		WHERE status = 'pending' AND ($1 = '' OR domain = $1)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM deployment_checks c
+		      WHERE c.deployment_id = l.id AND c.status <> 'success'
+		  )
+		ORDER BY priority_rank(priority), created_at, id
+	`, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []models.Deployment{}
+	for rows.Next() {
+		var d models.Deployment
+		if err := scanDeployment(rows, &d); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// domainsOf returns the distinct domains of deployments, sorted
+func domainsOf(deployments []models.Deployment) []string {
+	seen := map[string]bool{}
+	var domains []string
+	for _, d := range deployments {
+		if !seen[d.Domain] {
+			seen[d.Domain] = true
+			domains = append(domains, d.Domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// ListPendingDeployments lists pending deployments that may start now under
+// the rollout limits, by priority and then oldest first; defaultDomainLimit
+// applies to domains without their own limit
+func (db *DB) ListPendingDeployments(ctx context.Context, domain string, defaultDomainLimit int) ([]models.Deployment, error) {
+	pending, err := pendingDeployments(ctx, db.Pool, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := loadRolloutLimits(ctx, db.Pool, domainsOf(pending), defaultDomainLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	startable := []models.Deployment{}
+	for i := range pending {
+		if limits.allow(&pending[i]) {
+			startable = append(startable, pending[i])
+		}
+	}
+
+	return startable, nil
+}
+
+// ClaimDeployments moves up to max pending deployments that may start under
+// the rollout limits to deploying and returns them. A transaction-scoped
+// advisory lock per domain serializes claims across replicas, so two agents
+// claiming at once cannot both take the last slot.
+func (db *DB) ClaimDeployments(ctx context.Context, domain string, max, defaultDomainLimit int) ([]models.Deployment, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	pending, err := pendingDeployments(ctx, tx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := domainsOf(pending)
+	for _, d := range domains {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('rollout:' || $1))", d); err != nil {
+			return nil, fmt.Errorf("failed to lock domain rollouts: %w", err)
+		}
+	}
+
+	// Re-read under the locks, since another claim may have committed while
+	// we waited for them
+	pending, err = pendingDeployments(ctx, tx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := loadRolloutLimits(ctx, tx, domains, defaultDomainLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []models.Deployment{}
+	for i := range pending {
+		if len(claimed) >= max {
+			break
+		}
+		d := &pending[i]
+		if !slices.Contains(domains, d.Domain) || !limits.allow(d) {
+			continue
+		}
+
+		tag, err := tx.Exec(ctx, "UPDATE deployments SET status = 'deploying' WHERE id = $1 AND status = 'pending'", d.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim deployment: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+
+		if err := recordStatusChange(ctx, tx, d.ID, "pending", "deploying", "status changed from pending to deploying (claimed)"); err != nil {
+			return nil, err
+		}
+		d.Status = "deploying"
+		claimed = append(claimed, *d)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// UpsertRolloutLimit creates or replaces a rollout limit; an empty appName
+// sets the domain-wide limit
+func (db *DB) UpsertRolloutLimit(ctx context.Context, limit models.RolloutLimit) (*models.RolloutLimit, error) {
+	query := `
+		INSERT INTO rollout_limits (domain, app_name, max_deploying)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET max_deploying = EXCLUDED.max_deploying, updated_at = NOW()
+		RETURNING updated_at
+	`
+	err := db.Pool.QueryRow(ctx, query, limit.Domain, limit.AppName, limit.MaxDeploying).Scan(&limit.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert rollout limit: %w", err)
+	}
+
+	return &limit, nil
+}
+
+// ListRolloutLimits lists all rollout limits ordered by domain and app name
+func (db *DB) ListRolloutLimits(ctx context.Context) ([]models.RolloutLimit, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT domain, app_name, max_deploying, updated_at FROM rollout_limits ORDER BY domain, app_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollout limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := []models.RolloutLimit{}
+	for rows.Next() {
+		var limit models.RolloutLimit
+		if err := rows.Scan(&limit.Domain, &limit.AppName, &limit.MaxDeploying, &limit.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rollout limit: %w", err)
+		}
+		limits = append(limits, limit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rollout limits: %w", err)
+	}
+
+	return limits, nil
+}
+
+// DeleteRolloutLimit deletes a rollout limit; an empty appName deletes the
+// domain-wide limit
+func (db *DB) DeleteRolloutLimit(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM rollout_limits WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete rollout limit: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("rollout limit not found")
+	}
+
+	return nil
+}
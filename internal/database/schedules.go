@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// scheduleColumns lists the columns scanned by scanSchedule
+const scheduleColumns = `
+	id, domain, app_name, cron, paused, next_run_at, last_run_at,
+	last_deployment_id, last_error, created_at, updated_at
+`
+
+// scanSchedule scans a row selected with scheduleColumns
+func scanSchedule(row pgx.Row) (*models.Schedule, error) {
+	s := &models.Schedule{}
+	err := row.Scan(
+		&s.ID, &s.Domain, &s.AppName, &s.Cron, &s.Paused, &s.NextRunAt, &s.LastRunAt,
+		&s.LastDeploymentID, &s.LastError, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ScheduleRunFunc runs a due schedule and returns the deployment it created
+// (nil on failure), when the schedule should next run, and an error message
+// to record
+type ScheduleRunFunc func(ctx context.Context, schedule *models.Schedule) (deploymentID *uuid.UUID, nextRunAt time.Time, errMsg string)
+
+// UpsertSchedule creates or replaces an app's schedule
+func (db *DB) UpsertSchedule(ctx context.Context, domain, appName, cron string, paused bool, nextRunAt time.Time) (*models.Schedule, error) {
+	query := `
+		INSERT INTO schedules (domain, app_name, cron, paused, next_run_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET cron = EXCLUDED.cron, paused = EXCLUDED.paused, next_run_at = EXCLUDED.next_run_at, updated_at = NOW()
+		RETURNING ` + scheduleColumns
+	schedule, err := scanSchedule(db.Pool.QueryRow(ctx, query, domain, appName, cron, paused, nextRunAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetSchedule gets an app's schedule
+func (db *DB) GetSchedule(ctx context.Context, domain, appName string) (*models.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE domain = $1 AND app_name = $2`
+	schedule, err := scanSchedule(db.Pool.QueryRow(ctx, query, domain, appName))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("schedule not found")
+		}
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// ListSchedules lists all schedules ordered by domain and app name
+func (db *DB) ListSchedules(ctx context.Context) ([]models.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules ORDER BY domain, app_name`
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []models.Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// SetSchedulePaused pauses or resumes an app's schedule. Resuming sets the
+// next run, so runs missed while paused are skipped rather than caught up.
+func (db *DB) SetSchedulePaused(ctx context.Context, domain, appName string, paused bool, nextRunAt time.Time) (*models.Schedule, error) {
+	query := `
+		UPDATE schedules
+		SET paused = $3, next_run_at = CASE WHEN $3 THEN next_run_at ELSE $4 END, updated_at = NOW()
+		WHERE domain = $1 AND app_name = $2
+		RETURNING ` + scheduleColumns
+	schedule, err := scanSchedule(db.Pool.QueryRow(ctx, query, domain, appName, paused, nextRunAt))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("schedule not found")
+		}
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// DeleteSchedule deletes an app's schedule
+func (db *DB) DeleteSchedule(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM schedules WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("schedule not found")
+	}
+
+	return nil
+}
+
+// RecordScheduleRun records the outcome of a manually triggered run; the
+// next scheduled run is left as it was
+func (db *DB) RecordScheduleRun(ctx context.Context, id uuid.UUID, deploymentID *uuid.UUID, errMsg string) (*models.Schedule, error) {
+	query := `
+		UPDATE schedules
+		SET last_run_at = NOW(), last_deployment_id = COALESCE($2, last_deployment_id), last_error = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + scheduleColumns
+	schedule, err := scanSchedule(db.Pool.QueryRow(ctx, query, id, deploymentID, errMsg))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("schedule not found")
+		}
+		return nil, fmt.Errorf("failed to record schedule run: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// RunDueSchedules runs every unpaused schedule whose next run is due and
+// records each outcome. Due rows are locked with SKIP LOCKED, so replicas
+// running the scheduler concurrently never run the same schedule twice.
+func (db *DB) RunDueSchedules(ctx context.Context, run ScheduleRunFunc) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT ` + scheduleColumns + `
+		FROM schedules
+		WHERE NOT paused AND next_run_at <= $1
+		ORDER BY next_run_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 100
+	`
+	rows, err := tx.Query(ctx, query, db.clock.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query due schedules: %w", err)
+	}
+
+	var due []*models.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		due = append(due, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating schedules: %w", err)
+	}
+
+	for _, schedule := range due {
+		deploymentID, nextRunAt, errMsg := run(ctx, schedule)
+		_, err := tx.Exec(ctx, `
+			UPDATE schedules
+			SET next_run_at = $2, last_run_at = NOW(), last_deployment_id = COALESCE($3, last_deployment_id),
+			    last_error = $4, updated_at = NOW()
+			WHERE id = $1
+		`, schedule.ID, nextRunAt, deploymentID, errMsg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record schedule run: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(due), nil
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the Postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+const secretColumns = "project, name, version, created_at, updated_at"
+
+func scanSecret(row pgx.Row) (*models.Secret, error) {
+	secret := &models.Secret{}
+	err := row.Scan(&secret.Project, &secret.Name, &secret.Version, &secret.CreatedAt, &secret.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// insertSecretVersion records the value of a secret version
+func insertSecretVersion(ctx context.Context, q querier, secret *models.Secret, value []byte) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO secret_versions (project, name, version, value)
+		VALUES ($1, $2, $3, $4)
+	`, secret.Project, secret.Name, secret.Version, value)
+	if err != nil {
+		return fmt.Errorf("failed to store secret version: %w", err)
+	}
+	return nil
+}
+
+// CreateSecret stores a new encrypted secret value as version 1
+func (db *DB) CreateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO secrets (project, name)
+		VALUES ($1, $2)
+		RETURNING ` + secretColumns
+	secret, err := scanSecret(tx.QueryRow(ctx, query, project, name))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, fmt.Errorf("secret already exists")
+		}
+		return nil, fmt.Errorf("failed to create secret: %w", err)
+	}
+
+	if err := insertSecretVersion(ctx, tx, secret, value); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return secret, nil
+}
+
+// UpdateSecret stores a new encrypted value as the secret's next version.
+// Earlier versions are kept for deployments that pin them.
+func (db *DB) UpdateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE secrets
+		SET version = version + 1, updated_at = NOW()
+		WHERE project = $1 AND name = $2
+		RETURNING ` + secretColumns
+	secret, err := scanSecret(tx.QueryRow(ctx, query, project, name))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("secret not found")
+		}
+		return nil, fmt.Errorf("failed to update secret: %w", err)
+	}
+
+	if err := insertSecretVersion(ctx, tx, secret, value); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return secret, nil
+}
+
+// GetSecret gets a secret's metadata
+func (db *DB) GetSecret(ctx context.Context, project, name string) (*models.Secret, error) {
+	query := "SELECT " + secretColumns + " FROM secrets WHERE project = $1 AND name = $2"
+	secret, err := scanSecret(db.Pool.QueryRow(ctx, query, project, name))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("secret not found")
+		}
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// ListSecrets lists secret metadata, optionally limited to one project
+func (db *DB) ListSecrets(ctx context.Context, project string) ([]models.Secret, error) {
+	query := `
+		SELECT ` + secretColumns + `
+		FROM secrets
+		WHERE $1 = '' OR project = $1
+		ORDER BY project, name
+	`
+	rows, err := db.Pool.Query(ctx, query, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := []models.Secret{}
+	for rows.Next() {
+		secret, err := scanSecret(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+		secrets = append(secrets, *secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// DeleteSecret removes a secret
+func (db *DB) DeleteSecret(ctx context.Context, project, name string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM secrets WHERE project = $1 AND name = $2", project, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("secret not found")
+	}
+
+	return nil
+}
+
+// GetSecretValue gets the encrypted value of a secret version; version 0
+// means the current version
+func (db *DB) GetSecretValue(ctx context.Context, project, name string, version int) ([]byte, error) {
+	query := `
+		SELECT v.value
+		FROM secrets s
+		JOIN secret_versions v ON v.project = s.project AND v.name = s.name
+		WHERE s.project = $1 AND s.name = $2
+		  AND v.version = CASE WHEN $3 = 0 THEN s.version ELSE $3 END
+	`
+	var value []byte
+	err := db.Pool.QueryRow(ctx, query, project, name, version).Scan(&value)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("secret not found")
+		}
+		return nil, fmt.Errorf("failed to get secret value: %w", err)
+	}
+
+	return value, nil
+}
+
+// ListSecretVersions lists a secret's versions, newest first
+func (db *DB) ListSecretVersions(ctx context.Context, project, name string) ([]models.SecretVersion, error) {
+	query := `
+		SELECT version, created_at
+		FROM secret_versions
+		WHERE project = $1 AND name = $2
+		ORDER BY version DESC
+	`
+	rows, err := db.Pool.Query(ctx, query, project, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secret versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.SecretVersion{}
+	for rows.Next() {
+		var version models.SecretVersion
+		if err := rows.Scan(&version.Version, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secret version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secret versions: %w", err)
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	return versions, nil
+}
+
+// ReencryptSecrets rewrites stored secret values in a single transaction.
+// reencrypt returns the new ciphertext for a value, or nil to leave it as
+// is; the number of rewritten values is returned.
+func (db *DB) ReencryptSecrets(ctx context.Context, reencrypt func(project, name string, value []byte) ([]byte, error)) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	type storedValue struct {
+		project, name string
+		version       int
+		value         []byte
+	}
+
+	rows, err := tx.Query(ctx, "SELECT project, name, version, value FROM secret_versions FOR UPDATE")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query secret versions: %w", err)
+	}
+
+	var values []storedValue
+	for rows.Next() {
+		var v storedValue
+		if err := rows.Scan(&v.project, &v.name, &v.version, &v.value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan secret version: %w", err)
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating secret versions: %w", err)
+	}
+
+	count := 0
+	for _, v := range values {
+		value, err := reencrypt(v.project, v.name, v.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt %s/%s version %d: %w", v.project, v.name, v.version, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE secret_versions SET value = $4
+			WHERE project = $1 AND name = $2 AND version = $3
+		`, v.project, v.name, v.version, value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update secret version: %w", err)
+		}
+		count++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return count, nil
+}
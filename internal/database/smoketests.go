@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const smokeTestColumns = `domain, app_name, type, method, path, expected_status, expected_body, command, rollback, updated_at`
+
+func scanSmokeTest(row pgx.Row, test *models.SmokeTest) error {
+	return row.Scan(&test.Domain, &test.AppName, &test.Type, &test.Method, &test.Path,
+		&test.ExpectedStatus, &test.ExpectedBody, &test.Command, &test.Rollback, &test.UpdatedAt)
+}
+
+const smokeTestResultColumns = `deployment_id, status, message, agent, started_at, finished_at`
+
+func scanSmokeTestResult(row pgx.Row, result *models.SmokeTestResult) error {
+	return row.Scan(&result.DeploymentID, &result.Status, &result.Message, &result.Agent,
+		&result.StartedAt, &result.FinishedAt)
+}
+
+// UpsertSmokeTest creates or replaces an app's smoke test
+func (db *DB) UpsertSmokeTest(ctx context.Context, test models.SmokeTest) (*models.SmokeTest, error) {
+	command := test.Command
+	if command == nil {
+		command = []string{}
+	}
+
+	query := `
+		INSERT INTO smoke_tests (domain, app_name, type, method, path, expected_status, expected_body, command, rollback)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (domain, app_name) DO UPDATE
+		SET type = EXCLUDED.type,
+		    method = EXCLUDED.method,
+		    path = EXCLUDED.path,
+		    expected_status = EXCLUDED.expected_status,
+		    expected_body = EXCLUDED.expected_body,
+		    command = EXCLUDED.command,
+		    rollback = EXCLUDED.rollback,
+		    updated_at = NOW()
+		RETURNING ` + smokeTestColumns
+	stored := &models.SmokeTest{}
+	row := db.Pool.QueryRow(ctx, query, test.Domain, test.AppName, test.Type, test.Method, test.Path,
+		test.ExpectedStatus, test.ExpectedBody, command, test.Rollback)
+	if err := scanSmokeTest(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to upsert smoke test: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetSmokeTest gets an app's smoke test
+func (db *DB) GetSmokeTest(ctx context.Context, domain, appName string) (*models.SmokeTest, error) {
+	query := `SELECT ` + smokeTestColumns + ` FROM smoke_tests WHERE domain = $1 AND app_name = $2`
+	test := &models.SmokeTest{}
+	if err := scanSmokeTest(db.Pool.QueryRow(ctx, query, domain, appName), test); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("smoke test not found")
+		}
+		return nil, fmt.Errorf("failed to get smoke test: %w", err)
+	}
+
+	return test, nil
+}
+
+// DeleteSmokeTest deletes an app's smoke test
+func (db *DB) DeleteSmokeTest(ctx context.Context, domain, appName string) error {
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM smoke_tests WHERE domain = $1 AND app_name = $2", domain, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete smoke test: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("smoke test not found")
+	}
+
+	return nil
+}
+
+// listSmokeTestRuns runs a query selecting a deployment's ID, version and
+// port, its test's started_at, then the app's smoke test columns
+func (db *DB) listSmokeTestRuns(ctx context.Context, query string, args ...any) ([]models.SmokeTestRun, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query smoke test runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.SmokeTestRun{}
+	for rows.Next() {
+		var run models.SmokeTestRun
+		t := &run.Test
+		err := rows.Scan(&run.DeploymentID, &run.Version, &run.Port, &run.StartedAt,
+			&t.Domain, &t.AppName, &t.Type, &t.Method, &t.Path, &t.ExpectedStatus, &t.ExpectedBody,
+			&t.Command, &t.Rollback, &t.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan smoke test run: %w", err)
+		}
+		run.Domain, run.AppName = t.Domain, t.AppName
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating smoke test runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// ListDueSmokeTests lists the deployments deployed since the given time
+// whose app has a smoke test they have not started, oldest first
+func (db *DB) ListDueSmokeTests(ctx context.Context, since time.Time) ([]models.SmokeTestRun, error) {
+	return db.listSmokeTestRuns(ctx, `
+		SELECT d.id, d.version, d.port, NULL::timestamptz,
+		       t.domain, t.app_name, t.type, t.method, t.path, t.expected_status, t.expected_body,
+		       t.command, t.rollback, t.updated_at
+		FROM deployments d
+		JOIN smoke_tests t ON t.domain = d.domain AND t.app_name = d.app_name
+		WHERE d.status = 'deployed' AND d.deployed_at >= $1
+		  AND NOT EXISTS (SELECT 1 FROM smoke_test_results r WHERE r.deployment_id = d.id)
+		ORDER BY d.deployed_at
+	`, since)
+}
+
+// ListRunningSmokeTests lists the running smoke tests of a type, or of
+// every type when testType is empty, oldest first
+func (db *DB) ListRunningSmokeTests(ctx context.Context, testType string) ([]models.SmokeTestRun, error) {
+	return db.listSmokeTestRuns(ctx, `
+		SELECT d.id, d.version, d.port, r.started_at,
+		       t.domain, t.app_name, t.type, t.method, t.path, t.expected_status, t.expected_body,
+		       t.command, t.rollback, t.updated_at
+		FROM smoke_test_results r
+		JOIN deployments d ON d.id = r.deployment_id
+		JOIN smoke_tests t ON t.domain = d.domain AND t.app_name = d.app_name
+		WHERE r.status = 'running' AND ($1 = '' OR t.type = $1)
+		ORDER BY r.started_at
+	`, testType)
+}
+
+// StartSmokeTest records a deployment's smoke test as running, reporting
+// false when it was already started
+func (db *DB) StartSmokeTest(ctx context.Context, deploymentID uuid.UUID, agent string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO smoke_test_results (deployment_id, status, agent)
+		VALUES ($1, 'running', $2)
+		ON CONFLICT (deployment_id) DO NOTHING
+	`, deploymentID, agent)
+	if err != nil {
+		return false, fmt.Errorf("failed to start smoke test: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// FinishSmokeTest records the outcome of a deployment's running smoke test
+// and adds it to the deployment's timeline
+func (db *DB) FinishSmokeTest(ctx context.Context, deploymentID uuid.UUID, status, message, agent string) (*models.SmokeTestResult, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE smoke_test_results
+		SET status = $2, message = $3, agent = $4, finished_at = NOW()
+		WHERE deployment_id = $1 AND status = 'running'
+		RETURNING ` + smokeTestResultColumns
+	result := &models.SmokeTestResult{}
+	if err := scanSmokeTestResult(tx.QueryRow(ctx, query, deploymentID, status, message, agent), result); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("smoke test not running")
+		}
+		return nil, fmt.Errorf("failed to finish smoke test: %w", err)
+	}
+
+	eventType := models.EventSmokePassed
+	if status == models.SmokeFailed {
+		eventType = models.EventSmokeFailed
+	}
+	if err := recordDeploymentEvent(ctx, tx, deploymentID, eventType, message, 0); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetSmokeTestResult gets the outcome of a deployment's smoke test
+func (db *DB) GetSmokeTestResult(ctx context.Context, deploymentID uuid.UUID) (*models.SmokeTestResult, error) {
+	query := `SELECT ` + smokeTestResultColumns + ` FROM smoke_test_results WHERE deployment_id = $1`
+	result := &models.SmokeTestResult{}
+	if err := scanSmokeTestResult(db.Pool.QueryRow(ctx, query, deploymentID), result); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("smoke test result not found")
+		}
+		return nil, fmt.Errorf("failed to get smoke test result: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const manifestSnapshotColumns = `id, deployment_id, format, content, secret_files, content_digest, inline_secrets, maintenance, rendered_by, created_at`
+
+func scanManifestSnapshot(row pgx.Row, snapshot *models.ManifestSnapshot) error {
+	return row.Scan(&snapshot.ID, &snapshot.DeploymentID, &snapshot.Format, &snapshot.Content, &snapshot.SecretFiles,
+		&snapshot.ContentDigest, &snapshot.InlineSecrets, &snapshot.Maintenance, &snapshot.RenderedBy, &snapshot.CreatedAt)
+}
+
+// RecordManifestSnapshot stores a rendered manifest unless the deployment
+// already has a snapshot of the same format and content digest, and
+// returns the stored snapshot
+func (db *DB) RecordManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) (*models.ManifestSnapshot, error) {
+	secretFiles := snapshot.SecretFiles
+	if secretFiles == nil {
+		secretFiles = map[string]string{}
+	}
+
+	// The no-op update makes RETURNING yield the existing row on conflict
+	query := `
+		INSERT INTO manifest_snapshots (deployment_id, format, content, secret_files, content_digest, inline_secrets, maintenance, rendered_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (deployment_id, format, content_digest) DO UPDATE
+		SET deployment_id = manifest_snapshots.deployment_id
+		RETURNING ` + manifestSnapshotColumns
+	stored := &models.ManifestSnapshot{}
+	row := db.Pool.QueryRow(ctx, query, snapshot.DeploymentID, snapshot.Format, snapshot.Content, secretFiles,
+		snapshot.ContentDigest, snapshot.InlineSecrets, snapshot.Maintenance, snapshot.RenderedBy)
+	if err := scanManifestSnapshot(row, stored); err != nil {
+		return nil, fmt.Errorf("failed to record manifest snapshot: %w", err)
+	}
+
+	return stored, nil
+}
+
+// ListManifestSnapshots lists a deployment's manifest snapshots, oldest
+// first, without their content
+func (db *DB) ListManifestSnapshots(ctx context.Context, deploymentID uuid.UUID, format string) ([]models.ManifestSnapshot, error) {
+	query := `
+		SELECT id, deployment_id, format, '', '{}'::jsonb, content_digest, inline_secrets, maintenance, rendered_by, created_at
+		FROM manifest_snapshots
+		WHERE deployment_id = $1 AND ($2 = '' OR format = $2)
+		ORDER BY id
+	`
+	rows, err := db.Pool.Query(ctx, query, deploymentID, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query manifest snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []models.ManifestSnapshot{}
+	for rows.Next() {
+		var snapshot models.ManifestSnapshot
+		if err := scanManifestSnapshot(rows, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to scan manifest snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating manifest snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// GetManifestSnapshot gets one of a deployment's manifest snapshots
+func (db *DB) GetManifestSnapshot(ctx context.Context, deploymentID uuid.UUID, id int64) (*models.ManifestSnapshot, error) {
+	query := `SELECT ` + manifestSnapshotColumns + ` FROM manifest_snapshots WHERE deployment_id = $1 AND id = $2`
+	snapshot := &models.ManifestSnapshot{}
+	if err := scanManifestSnapshot(db.Pool.QueryRow(ctx, query, deploymentID, id), snapshot); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("manifest snapshot not found")
+		}
+		return nil, fmt.Errorf("failed to get manifest snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
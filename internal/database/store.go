@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Store is the persistence interface used by the HTTP handlers
+type Store interface {
+	Ping(ctx context.Context) error
+	CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error)
+	CreateDeploymentBatch(ctx context.Context, reqs models.DeploymentPushRequest, requestID string, skipUnchanged bool) ([]models.Deployment, error)
+	GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error)
+	GetLatestDeployment(ctx context.Context, domain, appName string) (*models.Deployment, error)
+	GetLatestDeployments(ctx context.Context) ([]models.Deployment, error)
+	GetDeploymentHistory(ctx context.Context, domain, appName string, rng models.DateRange, metadata models.MetadataFilter, after *models.Cursor, limit int) ([]models.Deployment, error)
+	UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error)
+	SetDeploymentSecretError(ctx context.Context, id uuid.UUID, message string) error
+	SetDeploymentImageDeleted(ctx context.Context, id uuid.UUID, deletedAt *time.Time) error
+	StoreRegistryCredential(ctx context.Context, cred models.RegistryCredentialRequest) error
+	GetRegistryCredential(ctx context.Context, registry string) (*models.RegistryCredentialResponse, error)
+	ListRegistries(ctx context.Context) ([]models.RegistryReference, error)
+	DeleteRegistryCredential(ctx context.Context, registry string) error
+	CreateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error)
+	UpdateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error)
+	GetSecret(ctx context.Context, project, name string) (*models.Secret, error)
+	GetSecretValue(ctx context.Context, project, name string, version int) ([]byte, error)
+	ListSecretVersions(ctx context.Context, project, name string) ([]models.SecretVersion, error)
+	RecordAuditEvents(ctx context.Context, events []models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, resource string, after *models.Cursor, limit int) ([]models.AuditEvent, error)
+	ReencryptSecrets(ctx context.Context, reencrypt func(project, name string, value []byte) ([]byte, error)) (int, error)
+	ListSecrets(ctx context.Context, project string) ([]models.Secret, error)
+	DeleteSecret(ctx context.Context, project, name string) error
+	UpsertSchedule(ctx context.Context, domain, appName, cron string, paused bool, nextRunAt time.Time) (*models.Schedule, error)
+	GetSchedule(ctx context.Context, domain, appName string) (*models.Schedule, error)
+	ListSchedules(ctx context.Context) ([]models.Schedule, error)
+	SetSchedulePaused(ctx context.Context, domain, appName string, paused bool, nextRunAt time.Time) (*models.Schedule, error)
+	DeleteSchedule(ctx context.Context, domain, appName string) error
+	RecordScheduleRun(ctx context.Context, id uuid.UUID, deploymentID *uuid.UUID, errMsg string) (*models.Schedule, error)
+	RunDueSchedules(ctx context.Context, run ScheduleRunFunc) (int, error)
+	UpsertRetryPolicy(ctx context.Context, policy models.RetryPolicy) (*models.RetryPolicy, error)
+	GetRetryPolicy(ctx context.Context, domain, appName string) (*models.RetryPolicy, error)
+	DeleteRetryPolicy(ctx context.Context, domain, appName string) error
+	RequeueDeployments(ctx context.Context, status string, before time.Time, domain string, limit int, dryRun bool, actor string) ([]models.StuckDeployment, error)
+	MarkStuckDeployments(ctx context.Context, status string, before time.Time, to string, failure *models.DeploymentFailure, limit int) ([]models.StuckDeployment, error)
+	RunDueRetries(ctx context.Context) (int, error)
+	ListDeploymentEvents(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error)
+	AddDeploymentEvent(ctx context.Context, deploymentID uuid.UUID, eventType, message string) error
+	ListDeploymentChecks(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentCheck, error)
+	UpdateDeploymentChecks(ctx context.Context, deploymentID uuid.UUID, checks []models.CheckStatus) ([]models.DeploymentCheck, error)
+	ListPendingDeployments(ctx context.Context, domain string, defaultDomainLimit int) ([]models.Deployment, error)
+	ClaimDeployments(ctx context.Context, domain string, max, defaultDomainLimit int) ([]models.Deployment, error)
+	UpsertRolloutLimit(ctx context.Context, limit models.RolloutLimit) (*models.RolloutLimit, error)
+	ListRolloutLimits(ctx context.Context) ([]models.RolloutLimit, error)
+	DeleteRolloutLimit(ctx context.Context, domain, appName string) error
+	UpsertImagePolicy(ctx context.Context, policy models.ImagePolicy) (*models.ImagePolicy, error)
+	GetImagePolicy(ctx context.Context, domain, appName string) (*models.ImagePolicy, error)
+	ListImagePolicies(ctx context.Context) ([]models.ImagePolicy, error)
+	DeleteImagePolicy(ctx context.Context, domain, appName string) error
+	RecordImagePolicyCheck(ctx context.Context, domain, appName, image, errMsg string) error
+	RecordImageDigest(ctx context.Context, digest models.ImageDigest) (*models.ImageDigest, error)
+	ListImageDigests(ctx context.Context, driftedOnly bool) ([]models.ImageDigest, error)
+	PruneImageDigests(ctx context.Context, keep []uuid.UUID) error
+	RecordObservedState(ctx context.Context, state models.ObservedState) (*models.ObservedState, error)
+	GetObservedState(ctx context.Context, domain, appName string) (*models.ObservedState, error)
+	ListObservedStates(ctx context.Context) ([]models.ObservedState, error)
+	RecordHealthProbe(ctx context.Context, probe models.HealthProbe) error
+	ListLatestHealthProbes(ctx context.Context) ([]models.HealthProbe, error)
+	GetSLACounts(ctx context.Context, since time.Time) ([]models.SLACounts, error)
+	GetLatencySeries(ctx context.Context, domain, appName string, since time.Time, step time.Duration) ([]models.LatencyPoint, error)
+	GetDeploymentLatencies(ctx context.Context, domain, appName string, since time.Time) ([]models.DeploymentLatency, error)
+	PruneHealthProbes(ctx context.Context, before time.Time) (int64, error)
+	ListIncidents(ctx context.Context, domain, appName string, openOnly bool, limit int) ([]models.Incident, error)
+	PruneIncidents(ctx context.Context, before time.Time) (int64, error)
+	PruneDeploymentLogs(ctx context.Context, before time.Time, dryRun bool) (int64, error)
+	PruneDeploymentEvents(ctx context.Context, before time.Time, dryRun bool) (int64, error)
+	PruneDeploymentVersions(ctx context.Context, keep int, dryRun bool) (int64, error)
+	PrunePushRequests(ctx context.Context, before time.Time, dryRun bool) (int64, error)
+	ListExpiredDeploymentLogs(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error)
+	ListPrunableDeploymentVersions(ctx context.Context, keep, limit int) ([]models.Deployment, error)
+	DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch []string) error
+	ListMissingSecretProjects(ctx context.Context, limit int) ([]models.MissingSecretProject, error)
+	ListDeploymentImages(ctx context.Context) ([]string, error)
+	ListStaleRegistries(ctx context.Context, before time.Time) ([]string, error)
+	DeleteRegistryCredentials(ctx context.Context, registries []string, before time.Time) (int64, error)
+	ListDanglingLogs(ctx context.Context) ([]models.DanglingLog, error)
+	DeleteDanglingLogs(ctx context.Context) (int64, error)
+	UpsertAlertRule(ctx context.Context, rule models.AlertRule) (*models.AlertRule, error)
+	GetAlertRule(ctx context.Context, name string) (*models.AlertRule, error)
+	ListAlertRules(ctx context.Context) ([]models.AlertRule, error)
+	DeleteAlertRule(ctx context.Context, name string) error
+	SilenceAlertRule(ctx context.Context, name string, until *time.Time) (*models.AlertRule, error)
+	ListRuleAlerts(ctx context.Context) ([]models.RuleAlert, error)
+	FireRuleAlert(ctx context.Context, alert models.RuleAlert) error
+	ResolveRuleAlert(ctx context.Context, rule, domain, appName string) error
+	AcknowledgeRuleAlert(ctx context.Context, rule, domain, appName, actor string) (*models.RuleAlert, error)
+	AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error)
+	ListDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, error)
+	ArchiveDeploymentLog(ctx context.Context, archived models.ArchivedDeploymentLog) error
+	GetArchivedDeploymentLog(ctx context.Context, deploymentID uuid.UUID) (*models.ArchivedDeploymentLog, error)
+	RecordManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) (*models.ManifestSnapshot, error)
+	ListManifestSnapshots(ctx context.Context, deploymentID uuid.UUID, format string) ([]models.ManifestSnapshot, error)
+	GetManifestSnapshot(ctx context.Context, deploymentID uuid.UUID, id int64) (*models.ManifestSnapshot, error)
+	StartMaintenance(ctx context.Context, m models.AppMaintenance, ifMatch []string) (*models.AppMaintenance, error)
+	EndMaintenance(ctx context.Context, domain, appName string, ifMatch []string) error
+	GetMaintenance(ctx context.Context, domain, appName string) (*models.AppMaintenance, error)
+	ListMaintenance(ctx context.Context) ([]models.AppMaintenance, error)
+	StartWriteFreeze(ctx context.Context, freeze models.WriteFreeze, ifMatch []string) (*models.WriteFreeze, error)
+	EndWriteFreeze(ctx context.Context, ifMatch []string) error
+	GetWriteFreeze(ctx context.Context) (*models.WriteFreeze, error)
+	Backup(ctx context.Context) (map[string][]json.RawMessage, error)
+	RestoreBackup(ctx context.Context, tables map[string][]json.RawMessage, failOnConflict, dryRun bool) ([]models.RestoreTableResult, error)
+	UpsertHealthCheck(ctx context.Context, check models.HealthCheck) (*models.HealthCheck, error)
+	GetHealthCheck(ctx context.Context, domain, appName string) (*models.HealthCheck, error)
+	ListHealthChecks(ctx context.Context, checkType string) ([]models.HealthCheck, error)
+	DeleteHealthCheck(ctx context.Context, domain, appName string) error
+	UpsertSmokeTest(ctx context.Context, test models.SmokeTest) (*models.SmokeTest, error)
+	GetSmokeTest(ctx context.Context, domain, appName string) (*models.SmokeTest, error)
+	DeleteSmokeTest(ctx context.Context, domain, appName string) error
+	ListDueSmokeTests(ctx context.Context, since time.Time) ([]models.SmokeTestRun, error)
+	ListRunningSmokeTests(ctx context.Context, testType string) ([]models.SmokeTestRun, error)
+	StartSmokeTest(ctx context.Context, deploymentID uuid.UUID, agent string) (bool, error)
+	FinishSmokeTest(ctx context.Context, deploymentID uuid.UUID, status, message, agent string) (*models.SmokeTestResult, error)
+	GetSmokeTestResult(ctx context.Context, deploymentID uuid.UUID) (*models.SmokeTestResult, error)
+	ListVerifyingDeployments(ctx context.Context, since time.Time) ([]models.Deployment, error)
+	CountDeploymentProbes(ctx context.Context, id uuid.UUID, from, to time.Time) (total, unhealthy int, err error)
+	SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error
+	GetDeploymentStats(ctx context.Context, rng models.DateRange) (*models.DeploymentStats, error)
+	RefreshDeploymentStats(ctx context.Context) error
+	RefreshAnalytics(ctx context.Context) error
+	VacuumAnalyze(ctx context.Context, table string) error
+	GetTableSizes(ctx context.Context) ([]models.TableSize, error)
+	GetAppSummaries(ctx context.Context) ([]models.AppSummary, error)
+	GetDeploymentTrends(ctx context.Context, since time.Time) ([]models.DailyDeploymentCount, error)
+	GetTopApps(ctx context.Context, by string, since time.Time, limit int) ([]models.TopApp, error)
+	ListDeploymentOutcomes(ctx context.Context, since time.Time) ([]models.DeploymentOutcome, error)
+	ListFailureRateAlerts(ctx context.Context) ([]models.FailureRateAlert, error)
+	FireFailureRateAlert(ctx context.Context, domain, appName string, failureRate float64) error
+	ResolveFailureRateAlert(ctx context.Context, domain, appName string) error
+	EnqueueJob(ctx context.Context, jobType, priority string, payload []byte, total int) (*models.Job, error)
+	GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	ClaimJob(ctx context.Context, types []string, lease time.Duration) (*models.Job, error)
+	RenewJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) error
+	UpdateJobProgress(ctx context.Context, id uuid.UUID, attempt, processed int) error
+	FinishJob(ctx context.Context, id uuid.UUID, attempt int, status string, result []byte, errMsg string, retryAfter time.Duration) (string, error)
+	RequeueJob(ctx context.Context, id uuid.UUID, attempt int) (string, error)
+	ListJobs(ctx context.Context, status, jobType string, after *models.Cursor, limit int) ([]models.Job, error)
+	CancelJob(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	RetryJob(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*models.Lease, bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+	GetLease(ctx context.Context, name string) (*models.Lease, error)
+	RecordGitSync(ctx context.Context, status models.GitSyncStatus) error
+	GetGitSync(ctx context.Context, branch string) (*models.GitSyncStatus, error)
+	WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+	ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	RecordPushRequest(ctx context.Context, req models.PushRequest) error
+	GetPushRequest(ctx context.Context, requestID string) (*models.PushRequest, error)
+}
+
+var _ Store = (*DB)(nil)
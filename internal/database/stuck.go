@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// stuckDeployment is a deployment stuck in a status, with the newest
+// version of its app
+type stuckDeployment struct {
+	models.StuckDeployment
+	latest int
+}
+
+// lockStuckDeployments locks up to limit deployments that have been in status
+// since before the given time, oldest first, going by status_changed_at,
+// which every status change stamps whether or not it records an event. An empty domain matches every
+// domain. Rows are locked with SKIP LOCKED, so a deployment being updated
+// right now is left out.
+func lockStuckDeployments(ctx context.Context, tx pgx.Tx, status string, before time.Time, domain string, limit int) ([]stuckDeployment, error) {
+	query := `
+		SELECT d.id, d.domain, d.app_name, d.version, d.status_changed_at AS since,
+		       (SELECT MAX(n.version) FROM deployments n WHERE n.domain = d.domain AND n.app_name = d.app_name)
+		FROM deployments d
+		WHERE d.status = $1 AND ($3 = '' OR d.domain = $3)
+		  AND d.status_changed_at < $2
+		ORDER BY since, d.id
+		FOR UPDATE OF d SKIP LOCKED
+		LIMIT $4
+	`
+	rows, err := tx.Query(ctx, query, status, before, domain, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stuck deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []stuckDeployment
+	for rows.Next() {
+		var d stuckDeployment
+		if err := rows.Scan(&d.ID, &d.Domain, &d.AppName, &d.Version, &d.StatusSince, &d.latest); err != nil {
+			return nil, fmt.Errorf("failed to scan stuck deployment: %w", err)
+		}
+		d.Status = status
+		deployments = append(deployments, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stuck deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+// RequeueDeployments resets up to limit deployments that have been in status
+// since before the given time back to pending, so agents pick them up again,
+// recording the change on each one's timeline. An empty domain matches every
+// domain. Deployments superseded by a newer version of their app are listed
+// but left alone. With dryRun nothing is changed. Matching rows are locked
+// with SKIP LOCKED, so a deployment being updated right now is left out.
+func (db *DB) RequeueDeployments(ctx context.Context, status string, before time.Time, domain string, limit int, dryRun bool, actor string) ([]models.StuckDeployment, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stuck, err := lockStuckDeployments(ctx, tx, status, before, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := []models.StuckDeployment{}
+	for _, d := range stuck {
+		if d.Version < d.latest {
+			d.Skipped = fmt.Sprintf("superseded by version %d", d.latest)
+		} else if !dryRun {
+			if err := requeueDeployment(ctx, tx, d.ID, status, actor); err != nil {
+				return nil, err
+			}
+		}
+		deployments = append(deployments, d.StuckDeployment)
+	}
+
+	if dryRun {
+		return deployments, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// requeueDeployment resets one deployment to pending
+func requeueDeployment(ctx context.Context, q querier, id uuid.UUID, status, actor string) error {
+	_, err := q.Exec(ctx, `
+		UPDATE deployments
+		SET status = 'pending', deployed_at = NULL, verification = '', verified_at = NULL,
+		    failure_code = '', failure_message = '', failure_details = NULL
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue deployment: %w", err)
+	}
+
+	message := fmt.Sprintf("status changed from %s to pending (requeued)", status)
+	if actor != "" {
+		message = fmt.Sprintf("status changed from %s to pending (requeued by %s)", status, actor)
+	}
+	return recordStatusChange(ctx, q, id, status, "pending", message)
+}
+
+// MarkStuckDeployments moves up to limit deployments that have been in
+// status since before the given time to stalled, or to failed with the given
+// failure, recording the change on each one's timeline. Failed deployments
+// are retried as their app's retry policy says. Matching rows are locked
+// with SKIP LOCKED, so a status reported at the same moment is never
+// overwritten.
+func (db *DB) MarkStuckDeployments(ctx context.Context, status string, before time.Time, to string, failure *models.DeploymentFailure, limit int) ([]models.StuckDeployment, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stuck, err := lockStuckDeployments(ctx, tx, status, before, "", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := models.DeploymentFailure{}
+	if failure != nil {
+		stored = *failure
+	}
+
+	deployments := []models.StuckDeployment{}
+	for _, d := range stuck {
+		_, err := tx.Exec(ctx, `
+			UPDATE deployments
+			SET status = $2, failure_code = $3, failure_message = $4, failure_details = $5
+			WHERE id = $1
+		`, d.ID, to, stored.Code, stored.Message, stored.Details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark stuck deployment: %w", err)
+		}
+
+		message := fmt.Sprintf("status changed from %s to %s (no status update since %s)", status, to, d.StatusSince.UTC().Format(time.RFC3339))
+		if err := recordStatusChange(ctx, tx, d.ID, status, to, message); err != nil {
+			return nil, err
+		}
+
+		if to == "failed" {
+			deployment := &models.Deployment{ID: d.ID, Domain: d.Domain, AppName: d.AppName, Failure: failure}
+			if err := scheduleRetry(ctx, tx, deployment, db.clock.Now()); err != nil {
+				return nil, err
+			}
+		}
+		deployments = append(deployments, d.StuckDeployment)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deployments, nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ListVerifyingDeployments lists the deployed deployments being verified,
+// and those deployed since the given time that are not verified yet
+func (db *DB) ListVerifyingDeployments(ctx context.Context, since time.Time) ([]models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE status = 'deployed'
+		  AND (verification = 'verifying' OR (verification = '' AND deployed_at >= $1))
+		ORDER BY deployed_at
+	`
+	rows, err := db.Pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query verifying deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []models.Deployment{}
+	for rows.Next() {
+		var deployment models.Deployment
+		if err := scanDeployment(rows, &deployment); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating verifying deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// CountDeploymentProbes counts the health probes of a deployment checked in
+// [from, to) and how many of them were unhealthy
+func (db *DB) CountDeploymentProbes(ctx context.Context, id uuid.UUID, from, to time.Time) (total, unhealthy int, err error) {
+	query := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE NOT healthy)
+		FROM health_probes
+		WHERE deployment_id = $1 AND checked_at >= $2 AND checked_at < $3
+	`
+	if err := db.Pool.QueryRow(ctx, query, id, from, to).Scan(&total, &unhealthy); err != nil {
+		return 0, 0, fmt.Errorf("failed to count deployment probes: %w", err)
+	}
+
+	return total, unhealthy, nil
+}
+
+// SetDeploymentVerification moves a deployed deployment to a verification
+// state. Reaching verified or degraded stamps verified_at and records an
+// event with the given message. Deployments no longer deployed are left
+// alone.
+func (db *DB) SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	final := verification != models.VerificationVerifying
+	tag, err := tx.Exec(ctx, `
+		UPDATE deployments
+		SET verification = $2, verified_at = CASE WHEN $3 THEN NOW() END
+		WHERE id = $1 AND status = 'deployed'
+	`, id, verification, final)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment verification: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("deployment not found")
+	}
+
+	if final {
+		eventType := models.EventVerified
+		if verification == models.VerificationDegraded {
+			eventType = models.EventDegraded
+		}
+		if err := recordDeploymentEvent(ctx, tx, id, eventType, message, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
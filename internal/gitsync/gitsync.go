@@ -0,0 +1,216 @@
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Repo keeps a shallow checkout of one branch of a git repository of
+// deployment YAMLs, using the git command line
+type Repo struct {
+	url    string
+	branch string
+	path   string
+	dir    string
+}
+
+// New creates a repo for the configured branch, or returns nil when no
+// repository is configured
+func New(cfg config.GitSyncConfig) *Repo {
+	if cfg.Repo == "" {
+		return nil
+	}
+
+	return &Repo{
+		url:    cfg.Repo,
+		branch: cfg.Branch,
+		path:   cfg.Path,
+		dir:    cfg.Dir,
+	}
+}
+
+// Branch returns the synced branch
+func (r *Repo) Branch() string {
+	return r.branch
+}
+
+// Pull fetches the branch, cloning it on first use, and returns the commit
+// now checked out. Local changes to the checkout are discarded.
+func (r *Repo) Pull(ctx context.Context) (string, error) {
+	_, err := os.Stat(filepath.Join(r.dir, ".git"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := os.MkdirAll(filepath.Dir(r.dir), 0o700); err != nil {
+			return "", fmt.Errorf("failed to create checkout directory: %w", err)
+		}
+		if _, err := r.git(ctx, "", "clone", "--quiet", "--depth", "1", "--single-branch", "--branch", r.branch, r.url, r.dir); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to read checkout: %w", err)
+	default:
+		// The configured URL may have changed, e.g. to rotate credentials
+		if _, err := r.git(ctx, r.dir, "remote", "set-url", "origin", r.url); err != nil {
+			return "", err
+		}
+		if _, err := r.git(ctx, r.dir, "fetch", "--quiet", "--depth", "1", "origin", r.branch); err != nil {
+			return "", err
+		}
+		if _, err := r.git(ctx, r.dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+
+	return r.git(ctx, r.dir, "rev-parse", "HEAD")
+}
+
+// Load reads the deployments declared under the configured path of the
+// checkout
+func (r *Repo) Load() ([]models.DeploymentRequest, error) {
+	return Load(filepath.Join(r.dir, r.path))
+}
+
+// git runs a git command in dir and returns its trimmed output. Errors
+// carry git's message with any credentials in the URL masked.
+func (r *Repo) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], r.redact(msg))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// redact masks the password in the repository URL wherever it appears in s
+func (r *Repo) redact(s string) string {
+	u, err := url.Parse(r.url)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return strings.ReplaceAll(s, r.url, u.Redacted())
+}
+
+// Load reads the deployments declared in the .yaml and .yml files under
+// root. Each file holds one or more YAML documents, each either a single
+// deployment or a list of them, in the push request format. Unknown fields
+// and apps declared more than once are errors.
+func Load(root string) ([]models.DeploymentRequest, error) {
+	reqs := []models.DeploymentRequest{}
+	declared := map[string]string{}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		fileReqs, err := loadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		for _, req := range fileReqs {
+			key := req.Domain + "/" + req.AppName
+			if other, ok := declared[key]; ok {
+				return fmt.Errorf("%s: %s is already declared in %s", rel, key, other)
+			}
+			declared[key] = rel
+		}
+
+		reqs = append(reqs, fileReqs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reqs, nil
+}
+
+// loadFile decodes every document of a YAML file
+func loadFile(path string) ([]models.DeploymentRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs []models.DeploymentRequest
+	decoder := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return reqs, nil
+			}
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		if doc.Content[0].Kind == yaml.SequenceNode {
+			var list []models.DeploymentRequest
+			if err := decodeStrict(&doc, &list); err != nil {
+				return nil, err
+			}
+			reqs = append(reqs, list...)
+			continue
+		}
+
+		var req models.DeploymentRequest
+		if err := decodeStrict(&doc, &req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+// decodeStrict decodes a document rejecting unknown fields, which
+// yaml.Node.Decode does not do on its own
+func decodeStrict(doc *yaml.Node, out interface{}) error {
+	body, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	decoder.KnownFields(true)
+	return decoder.Decode(out)
+}
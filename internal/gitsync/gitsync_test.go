@@ -0,0 +1,67 @@
+package gitsync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "api.yaml", `
+domain: example.com
+app_name: api
+docker_image: example/api:1.2.0
+port: 8080
+env:
+  - LOG_LEVEL=info
+---
+domain: example.com
+app_name: worker
+docker_image: example/worker:1.2.0
+port: 9090
+`)
+	writeFile(t, dir, "team/web.yml", `
+- domain: example.org
+  app_name: web
+  docker_image: example/web:2.0.0
+  port: 80
+  priority: hotfix
+`)
+	writeFile(t, dir, "README.md", "not a deployment")
+
+	reqs, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 deployments, got %d", len(reqs))
+	}
+	if reqs[0].AppName != "api" || len(reqs[0].Env) != 1 || reqs[2].Priority != "hotfix" {
+		t.Errorf("Unexpected deployments: %+v", reqs)
+	}
+
+	// Typos must not be silently dropped
+	writeFile(t, dir, "typo.yaml", "domain: example.net\napp_name: api\ndocker_image: example/api:1\nport: 80\nenvs: []\n")
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "typo.yaml") {
+		t.Errorf("Expected an unknown field error naming typo.yaml, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, "typo.yaml"))
+
+	writeFile(t, dir, "dup.yaml", "domain: example.com\napp_name: api\ndocker_image: example/api:2\nport: 80\n")
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "already declared in api.yaml") {
+		t.Errorf("Expected a duplicate app error, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/leader"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLeader handles GET /api/v1/admin/leader - which instance holds the
+// leader lease, as seen by the instance serving the request
+func (h *Handler) GetLeader(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.elector == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Leader election is not running")
+		return
+	}
+
+	status := models.LeaderStatus{
+		InstanceID: h.elector.ID(),
+		IsLeader:   h.elector.IsLeader(),
+	}
+
+	lease, err := h.db.GetLease(ctx, leader.LeaseName)
+	if err != nil && err.Error() != "lease not found" {
+		h.logger.Error("Failed to get leader lease", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get leader")
+		return
+	}
+	status.Lease = lease
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// ReloadTokens handles POST /api/v1/admin/tokens/reload - re-reads the
+// config file and swaps in its API, reveal and agent tokens. Only the
+// instance serving the request reloads.
+func (h *Handler) ReloadTokens(c *gin.Context) {
+	if h.tokens == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Token reload is not available")
+		return
+	}
+
+	counts, err := h.tokens.Reload()
+	if err != nil {
+		h.logger.Error("Failed to reload tokens", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to reload tokens: "+err.Error())
+		return
+	}
+
+	h.logger.Info("Reloaded tokens",
+		"api", counts.API,
+		"reveal", counts.Reveal,
+		"agent", counts.Agent,
+		"actor", c.GetString(ActorKey))
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Tokens reloaded",
+		Data:    counts,
+	})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/secrets"
+	"deployment-controller/internal/vault"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// resolveSecretRef returns the value of a single secret reference. The
+// returned error message is safe to show to the agent.
+func (h *Handler) resolveSecretRef(ctx context.Context, ref string) (string, int, error) {
+	if secrets.HasScheme(ref) {
+		resolver, scheme, ok := h.resolvers.Lookup(ref)
+		if !ok {
+			return "", http.StatusServiceUnavailable, fmt.Errorf("no resolver configured for %s:// references", scheme)
+		}
+
+		value, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			if err.Error() == "secret not found" {
+				return "", http.StatusUnprocessableEntity, fmt.Errorf("secret %q not found", ref)
+			}
+			return "", http.StatusBadGateway, fmt.Errorf("failed to read %q from %s", ref, scheme)
+		}
+		return value, http.StatusOK, nil
+	}
+
+	if h.cipher == nil {
+		return "", http.StatusServiceUnavailable, fmt.Errorf("secrets are disabled: neither security.encryption_key nor security.kms is usable")
+	}
+
+	project, name, version, _ := models.SplitSecretRef(ref)
+	sealed, err := h.db.GetSecretValue(ctx, project, name, version)
+	if err != nil {
+		if err.Error() == "secret not found" {
+			return "", http.StatusUnprocessableEntity, fmt.Errorf("secret %q not found", ref)
+		}
+		return "", http.StatusInternalServerError, err
+	}
+
+	value, err := h.cipher.Decrypt(sealed, secretRef(project, name))
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return string(value), http.StatusOK, nil
+}
+
+// resolveSecretRefs replaces secret references and sealed values in env with
+// their plaintext values. In vault agent mode, vault:// references are left in
+// place and reported via agentVault so the caller can mint the agent a token
+// instead.
+func (h *Handler) resolveSecretRefs(ctx context.Context, env []string) (resolved []string, agentVault bool, status int, err error) {
+	resolved = make([]string, len(env))
+	for i, entry := range env {
+		if name, sealed, ok := models.ParseSealedValue(entry); ok {
+			value, err := h.openSealed(sealed, name)
+			if err != nil {
+				return nil, false, http.StatusUnprocessableEntity, fmt.Errorf("env[%d]: sealed value %v", i, err)
+			}
+			resolved[i] = name + "=" + string(value)
+			continue
+		}
+
+		name, ref, ok := models.ParseSecretRef(entry)
+		if !ok {
+			resolved[i] = entry
+			continue
+		}
+
+		if _, _, isVault := vault.ParseRef(ref); isVault && h.cfg.Vault.ResolveMode == "agent" {
+			resolved[i] = entry
+			agentVault = true
+			continue
+		}
+
+		value, status, err := h.resolveSecretRef(ctx, ref)
+		if err != nil {
+			return nil, false, status, fmt.Errorf("env[%d]: %w", i, err)
+		}
+		resolved[i] = name + "=" + value
+	}
+
+	return resolved, agentVault, http.StatusOK, nil
+}
+
+// recordSecretError surfaces the latest secret resolution failure on the
+// deployment record, clearing it once resolution succeeds again
+func (h *Handler) recordSecretError(ctx context.Context, deployment *models.Deployment, resolveErr error) {
+	message := ""
+	if resolveErr != nil {
+		message = resolveErr.Error()
+	}
+	if message == deployment.SecretError {
+		return
+	}
+
+	if err := h.db.SetDeploymentSecretError(ctx, deployment.ID, message); err != nil {
+		h.logger.Error("Failed to record deployment secret error", "error", err, "id", deployment.ID)
+		return
+	}
+	deployment.SecretError = message
+}
+
+// GetAgentDeployment handles GET /api/v1/agent/deployments/:id - returns the
+// deployment with secret references resolved to their values for agents
+func (h *Handler) GetAgentDeployment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	deployment, err := h.db.GetDeployment(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment")
+		return
+	}
+
+	env, agentVault, status, err := h.resolveSecretRefs(ctx, deployment.Env)
+	h.recordSecretError(ctx, deployment, err)
+	if err != nil {
+		h.logger.Error("Failed to resolve deployment secrets", "error", err, "id", id)
+
+		if status == http.StatusInternalServerError {
+			RespondError(c, status, "Failed to resolve deployment secrets")
+			return
+		}
+
+		RespondError(c, status, "Failed to resolve deployment secrets: "+err.Error())
+		return
+	}
+	reads := secretReadEvents(deployment, agentVault)
+	deployment.Env = env
+
+	response := models.AgentDeployment{Deployment: *deployment}
+	if agentVault {
+		if h.vault == nil {
+			RespondError(c, http.StatusServiceUnavailable, "Failed to resolve deployment secrets: vault is not configured")
+			return
+		}
+
+		token, expiresAt, err := h.vault.CreateToken(ctx, h.cfg.Vault.AgentTokenTTL, h.cfg.Vault.AgentTokenPolicies)
+		if err != nil {
+			h.logger.Error("Failed to mint vault token for agent", "error", err, "id", id)
+			RespondError(c, http.StatusBadGateway, "Failed to mint vault token for agent")
+			return
+		}
+
+		response.Vault = &models.VaultCredentials{
+			Address:   h.vault.Address(),
+			Token:     token,
+			ExpiresAt: expiresAt,
+		}
+	}
+
+	h.recordAudit(ctx, c, reads)
+
+	h.logger.Info("Agent fetched deployment",
+		"id", id,
+		"domain", deployment.Domain,
+		"app_name", deployment.AppName,
+		"vault_token_issued", agentVault)
+
+	// Resolved secrets must not be stored by intermediaries
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    response,
+	})
+}
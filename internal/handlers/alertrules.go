@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openIncidentLimit bounds the open incidents app_down rules are evaluated
+// against; apps have at most one open incident each
+const openIncidentLimit = 10000
+
+// validateAlertRule applies the failure rate alert defaults to an alert
+// rule request and checks it; fields unused by its kind must be left empty
+func (h *Handler) validateAlertRule(req *models.AlertRuleRequest) []models.FieldError {
+	if !slices.Contains(models.AlertRuleKinds, req.Kind) {
+		return []models.FieldError{{Field: "kind", Message: "must be one of: " + strings.Join(models.AlertRuleKinds, ", ")}}
+	}
+
+	var errs []models.FieldError
+	if req.Domain != "" {
+		domain, err := validation.NormalizeDomain(req.Domain)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "domain", Message: err.Error()})
+		}
+		req.Domain = domain
+	}
+	if req.AppName != "" {
+		if err := validation.ValidateAppName(req.AppName); err != nil {
+			errs = append(errs, models.FieldError{Field: "app_name", Message: err.Error()})
+		}
+	}
+
+	switch req.Kind {
+	case models.AlertRuleAppDown:
+		if req.ForSeconds < 0 {
+			errs = append(errs, models.FieldError{Field: "for_seconds", Message: "must not be negative"})
+		}
+		if req.WindowSeconds != 0 {
+			errs = append(errs, models.FieldError{Field: "window_seconds", Message: "is only used by failure_rate rules"})
+		}
+		if req.Threshold != 0 {
+			errs = append(errs, models.FieldError{Field: "threshold", Message: "is only used by failure_rate rules"})
+		}
+		if req.MinDeployments != 0 {
+			errs = append(errs, models.FieldError{Field: "min_deployments", Message: "is only used by failure_rate rules"})
+		}
+
+	case models.AlertRuleFailureRate:
+		if req.WindowSeconds == 0 {
+			req.WindowSeconds = int(h.cfg.Alerts.Window / time.Second)
+		}
+		if req.MinDeployments == 0 {
+			req.MinDeployments = h.cfg.Alerts.MinDeployments
+		}
+		if req.WindowSeconds < 1 {
+			errs = append(errs, models.FieldError{Field: "window_seconds", Message: "must be positive"})
+		}
+		if req.Threshold <= 0 || req.Threshold > 1 {
+			errs = append(errs, models.FieldError{Field: "threshold", Message: "must be above 0 and at most 1"})
+		}
+		if req.MinDeployments < 1 {
+			errs = append(errs, models.FieldError{Field: "min_deployments", Message: "must be positive"})
+		}
+		if req.ForSeconds != 0 {
+			errs = append(errs, models.FieldError{Field: "for_seconds", Message: "is only used by app_down rules"})
+		}
+	}
+	return errs
+}
+
+// ruleMatches reports whether an alert rule applies to an app
+func ruleMatches(rule models.AlertRule, domain, appName string) bool {
+	return (rule.Domain == "" || rule.Domain == domain) && (rule.AppName == "" || rule.AppName == appName)
+}
+
+// evaluateAlertRule returns the alerts an alert rule raises now, one per
+// app breaking it
+func (h *Handler) evaluateAlertRule(ctx context.Context, rule models.AlertRule, now time.Time) ([]models.RuleAlert, error) {
+	var breaches []models.RuleAlert
+	switch rule.Kind {
+	case models.AlertRuleAppDown:
+		domain, appName := "", ""
+		if rule.Domain != "" && rule.AppName != "" {
+			domain, appName = rule.Domain, rule.AppName
+		}
+		incidents, err := h.db.ListIncidents(ctx, domain, appName, true, openIncidentLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range incidents {
+			down := now.Sub(i.StartedAt)
+			if ruleMatches(rule, i.Domain, i.AppName) && down >= time.Duration(rule.ForSeconds)*time.Second {
+				breaches = append(breaches, models.RuleAlert{Domain: i.Domain, AppName: i.AppName, Value: down.Seconds()})
+			}
+		}
+
+	case models.AlertRuleFailureRate:
+		outcomes, err := h.db.ListDeploymentOutcomes(ctx, now.Add(-time.Duration(rule.WindowSeconds)*time.Second))
+		if err != nil {
+			return nil, err
+		}
+		type counts struct{ changes, failures int }
+		apps := map[[2]string]*counts{}
+		var order [][2]string
+		for _, o := range outcomes {
+			if !o.Finished() || !ruleMatches(rule, o.Domain, o.AppName) {
+				continue
+			}
+			key := [2]string{o.Domain, o.AppName}
+			c, ok := apps[key]
+			if !ok {
+				c = &counts{}
+				apps[key] = c
+				order = append(order, key)
+			}
+			c.changes++
+			if o.Failed() {
+				c.failures++
+			}
+		}
+		for _, key := range order {
+			c := apps[key]
+			rate := float64(c.failures) / float64(c.changes)
+			if c.changes >= rule.MinDeployments && rate >= rule.Threshold {
+				breaches = append(breaches, models.RuleAlert{Domain: key[0], AppName: key[1], Value: rate})
+			}
+		}
+	}
+
+	for i := range breaches {
+		breaches[i].Rule = rule.Name
+	}
+	return breaches, nil
+}
+
+// RunAlertRules evaluates every alert rule, firing an alert on each app
+// breaking it and resolving the alerts of apps that no longer do. Alerts
+// are posted to alerts.webhook_url when they fire and resolve, and again
+// every alerts.repeat_interval until acknowledged, unless their rule is
+// silenced; a notification that fails is retried on the next run. Apps in
+// maintenance neither fire nor resolve alerts. It is run periodically by the
+// alert rule worker.
+func (h *Handler) RunAlertRules(ctx context.Context) error {
+	rules, err := h.db.ListAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	alerts, err := h.db.ListRuleAlerts(ctx)
+	if err != nil {
+		return err
+	}
+
+	maintenance, err := h.maintenanceApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := h.clock.Now()
+	metrics.RuleAlerts.Reset()
+
+	firing := make(map[[3]string]models.RuleAlert, len(alerts))
+	for _, alert := range alerts {
+		key := [3]string{alert.Rule, alert.Domain, alert.AppName}
+		if maintenance[[2]string{alert.Domain, alert.AppName}] {
+			// Alerts of apps in maintenance stay as they are until it ends
+			metrics.RuleAlerts.WithLabelValues(key[0], key[1], key[2]).Set(1)
+			continue
+		}
+		firing[key] = alert
+	}
+
+	var firstErr error
+	fail := func(rule models.AlertRule, domain, appName string, err error) {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s %s/%s: %w", rule.Name, domain, appName, err)
+		}
+	}
+
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		breaches, err := h.evaluateAlertRule(ctx, rule, now)
+		if err != nil {
+			h.logger.Error("Failed to evaluate alert rule", "error", err, "rule", rule.Name)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", rule.Name, err)
+			}
+			// Keep the rule's alerts firing until it can be evaluated
+			for key := range firing {
+				if key[0] == rule.Name {
+					delete(firing, key)
+					metrics.RuleAlerts.WithLabelValues(key[0], key[1], key[2]).Set(1)
+				}
+			}
+			continue
+		}
+
+		for _, alert := range breaches {
+			if maintenance[[2]string{alert.Domain, alert.AppName}] {
+				continue
+			}
+			key := [3]string{alert.Rule, alert.Domain, alert.AppName}
+			existing, ok := firing[key]
+			delete(firing, key)
+
+			if !ok {
+				h.logger.Warn("Alert rule fired",
+					"rule", rule.Name,
+					"kind", rule.Kind,
+					"domain", alert.Domain,
+					"app_name", alert.AppName,
+					"value", alert.Value)
+				existing.FiringSince = now
+			}
+
+			due := existing.AcknowledgedAt == nil &&
+				(existing.NotifiedAt == nil || now.Sub(*existing.NotifiedAt) >= h.cfg.Alerts.RepeatInterval)
+			if due && !rule.Silenced(now) {
+				alert.FiringSince = existing.FiringSince
+				err := h.notifyRuleAlert(ctx, rule, alert, models.AlertFiring, existing.NotifiedAt != nil)
+				if err != nil {
+					fail(rule, alert.Domain, alert.AppName, err)
+				} else {
+					alert.NotifiedAt = &now
+				}
+			}
+
+			if err := h.db.FireRuleAlert(ctx, alert); err != nil {
+				fail(rule, alert.Domain, alert.AppName, err)
+			}
+			metrics.RuleAlerts.WithLabelValues(alert.Rule, alert.Domain, alert.AppName).Set(1)
+		}
+	}
+
+	// The alerts left no longer break their rule
+	byName := make(map[string]models.AlertRule, len(rules))
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+	}
+	for _, alert := range firing {
+		rule := byName[alert.Rule]
+		h.logger.Info("Alert rule resolved",
+			"rule", alert.Rule,
+			"domain", alert.Domain,
+			"app_name", alert.AppName)
+
+		if alert.NotifiedAt != nil && !rule.Silenced(now) {
+			if err := h.notifyRuleAlert(ctx, rule, alert, models.AlertResolved, false); err != nil {
+				fail(rule, alert.Domain, alert.AppName, err)
+				metrics.RuleAlerts.WithLabelValues(alert.Rule, alert.Domain, alert.AppName).Set(1)
+				continue
+			}
+		}
+		if err := h.db.ResolveRuleAlert(ctx, alert.Rule, alert.Domain, alert.AppName); err != nil {
+			fail(rule, alert.Domain, alert.AppName, err)
+		}
+	}
+	return firstErr
+}
+
+// notifyRuleAlert queues an alert rule transition, or a repeat of a firing
+// alert, for delivery to alerts.webhook_url, if set
+func (h *Handler) notifyRuleAlert(ctx context.Context, rule models.AlertRule, alert models.RuleAlert, status string, repeat bool) error {
+	url := h.cfg.Alerts.WebhookURL
+	if url == "" {
+		return nil
+	}
+
+	return h.enqueueWebhook(ctx, url, models.RuleAlertNotification{
+		Event:       "alert_rule",
+		Status:      status,
+		Rule:        rule.Name,
+		Kind:        rule.Kind,
+		Domain:      alert.Domain,
+		AppName:     alert.AppName,
+		Value:       alert.Value,
+		Repeat:      repeat,
+		FiringSince: alert.FiringSince,
+		At:          h.clock.Now().UTC(),
+	})
+}
+
+// ruleFromPath reads and validates the :name path parameter of the alert
+// rule endpoints
+func ruleFromPath(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if err := validation.ValidateSecretName(name); err != nil {
+		RespondValidationError(c, "Invalid alert rule", []models.FieldError{{Field: "name", Message: err.Error()}})
+		return "", false
+	}
+	return name, true
+}
+
+// respondAlertRuleError maps an alert rule lookup error to a response
+func (h *Handler) respondAlertRuleError(c *gin.Context, err error, message string) {
+	if err.Error() == "alert rule not found" {
+		RespondError(c, http.StatusNotFound, "Alert rule not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// ListAlertRules handles GET /api/v1/alert-rules
+func (h *Handler) ListAlertRules(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	rules, err := h.db.ListAlertRules(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list alert rules", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list alert rules")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+// PutAlertRule handles PUT /api/v1/alert-rules/:name
+func (h *Handler) PutAlertRule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.AlertRuleRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid alert rule request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if errs := h.validateAlertRule(&req); len(errs) > 0 {
+		RespondValidationError(c, "Invalid alert rule", errs)
+		return
+	}
+
+	rule, err := h.db.UpsertAlertRule(ctx, models.AlertRule{
+		Name:           name,
+		Kind:           req.Kind,
+		Domain:         req.Domain,
+		AppName:        req.AppName,
+		ForSeconds:     req.ForSeconds,
+		WindowSeconds:  req.WindowSeconds,
+		Threshold:      req.Threshold,
+		MinDeployments: req.MinDeployments,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store alert rule", "error", err, "rule", name)
+		RespondError(c, http.StatusInternalServerError, "Failed to store alert rule")
+		return
+	}
+
+	h.logger.Info("Stored alert rule", "rule", name, "kind", rule.Kind)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule stored successfully",
+		Data:    rule,
+	})
+}
+
+// GetAlertRule handles GET /api/v1/alert-rules/:name
+func (h *Handler) GetAlertRule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.db.GetAlertRule(ctx, name)
+	if err != nil {
+		h.logger.Error("Failed to get alert rule", "error", err, "rule", name)
+		h.respondAlertRuleError(c, err, "Failed to get alert rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    rule,
+	})
+}
+
+// DeleteAlertRule handles DELETE /api/v1/alert-rules/:name - its firing
+// alerts are dropped without notification
+func (h *Handler) DeleteAlertRule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteAlertRule(ctx, name); err != nil {
+		h.logger.Error("Failed to delete alert rule", "error", err, "rule", name)
+		h.respondAlertRuleError(c, err, "Failed to delete alert rule")
+		return
+	}
+
+	h.logger.Info("Deleted alert rule", "rule", name)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule deleted successfully",
+	})
+}
+
+// SilenceAlertRule handles POST /api/v1/alert-rules/:name/silence - mutes
+// the rule's notifications for a duration
+func (h *Handler) SilenceAlertRule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.SilenceRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid silence request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	duration, err := parseWindow(req.Duration)
+	if err != nil {
+		RespondValidationError(c, "Invalid silence", []models.FieldError{{Field: "duration", Message: "must be a duration like 2h, 1d or 1w"}})
+		return
+	}
+
+	until := h.clock.Now().Add(duration)
+	rule, err := h.db.SilenceAlertRule(ctx, name, &until)
+	if err != nil {
+		h.logger.Error("Failed to silence alert rule", "error", err, "rule", name)
+		h.respondAlertRuleError(c, err, "Failed to silence alert rule")
+		return
+	}
+
+	h.logger.Info("Silenced alert rule", "rule", name, "until", until, "actor", c.GetString(ActorKey))
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule silenced successfully",
+		Data:    rule,
+	})
+}
+
+// UnsilenceAlertRule handles DELETE /api/v1/alert-rules/:name/silence
+func (h *Handler) UnsilenceAlertRule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.db.SilenceAlertRule(ctx, name, nil)
+	if err != nil {
+		h.logger.Error("Failed to unsilence alert rule", "error", err, "rule", name)
+		h.respondAlertRuleError(c, err, "Failed to unsilence alert rule")
+		return
+	}
+
+	h.logger.Info("Unsilenced alert rule", "rule", name, "actor", c.GetString(ActorKey))
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule unsilenced successfully",
+		Data:    rule,
+	})
+}
+
+// ListRuleAlerts handles GET /api/v1/alerts - the alerts firing on apps
+// that break an alert rule
+func (h *Handler) ListRuleAlerts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	alerts, err := h.db.ListRuleAlerts(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list rule alerts", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list alerts")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    alerts,
+	})
+}
+
+// AcknowledgeRuleAlert handles POST
+// /api/v1/alerts/:name/:domain/:app_name/ack - stops a firing alert's
+// repeated notifications
+func (h *Handler) AcknowledgeRuleAlert(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	name, ok := ruleFromPath(c)
+	if !ok {
+		return
+	}
+	domain, appName, ok := appFromPath(c, "Invalid alert")
+	if !ok {
+		return
+	}
+
+	actor := c.GetString(ActorKey)
+	alert, err := h.db.AcknowledgeRuleAlert(ctx, name, domain, appName, actor)
+	if err != nil {
+		h.logger.Error("Failed to acknowledge alert", "error", err, "rule", name, "domain", domain, "app_name", appName)
+		if err.Error() == "alert not found" {
+			RespondError(c, http.StatusNotFound, "Alert not found")
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to acknowledge alert")
+		return
+	}
+
+	h.logger.Info("Acknowledged alert", "rule", name, "domain", domain, "app_name", appName, "actor", actor)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert acknowledged successfully",
+		Data:    alert,
+	})
+}
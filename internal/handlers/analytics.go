@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAppAnalytics handles GET /api/v1/analytics/apps
+func (h *Handler) GetAppAnalytics(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	summaries, err := h.db.GetAppSummaries(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get app analytics", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app analytics")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    summaries,
+	})
+}
+
+// GetTrendAnalytics handles GET /api/v1/analytics/trends?days=30
+func (h *Handler) GetTrendAnalytics(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	days, ok := analyticsDays(c)
+	if !ok {
+		return
+	}
+
+	since := h.clock.Now().UTC().AddDate(0, 0, -(days - 1))
+	trends, err := h.db.GetDeploymentTrends(ctx, since)
+	if err != nil {
+		h.logger.Error("Failed to get deployment trends", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment trends")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    trends,
+	})
+}
+
+// analyticsDays parses the days query parameter (default 30), responding
+// when it is out of range
+func analyticsDays(c *gin.Context) (int, bool) {
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		n, err := strconv.Atoi(daysStr)
+		if err != nil || n < 1 || n > 365 {
+			RespondError(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return 0, false
+		}
+		days = n
+	}
+	return days, true
+}
+
+// Top-N report limits
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// GetTopApps handles GET /api/v1/stats/top?by=deploy_count&limit=10&range=7d
+// - the apps with the most versions pushed or failed over the range
+func (h *Handler) GetTopApps(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var errs []models.FieldError
+	by := c.DefaultQuery("by", models.TopByDeployCount)
+	if by != models.TopByDeployCount && by != models.TopByFailures {
+		errs = append(errs, models.FieldError{Field: "by", Message: "must be deploy_count or failures"})
+	}
+	limit := defaultTopLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxTopLimit {
+			errs = append(errs, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxTopLimit)})
+		} else {
+			limit = n
+		}
+	}
+	days, err := parseRangeDays(c.DefaultQuery("range", "7d"))
+	if err != nil {
+		errs = append(errs, models.FieldError{Field: "range", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid top apps query", errs)
+		return
+	}
+
+	since := h.clock.Now().UTC().AddDate(0, 0, -(days - 1))
+	apps, err := h.db.GetTopApps(ctx, by, since, limit)
+	if err != nil {
+		h.logger.Error("Failed to get top apps", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get top apps")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.TopAppsReport{
+			By:    by,
+			Days:  days,
+			Since: since.Truncate(24 * time.Hour),
+			Apps:  apps,
+		},
+	})
+}
+
+// parseRangeDays parses a report range of days ("7d") or weeks ("4w")
+// covering 1 to 365 days
+func parseRangeDays(value string) (int, error) {
+	unit := 0
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 1
+	case strings.HasSuffix(value, "w"):
+		unit = 7
+	}
+	n, err := strconv.Atoi(value[:max(len(value)-1, 0)])
+	if unit == 0 || err != nil || n < 1 || n*unit > 365 {
+		return 0, fmt.Errorf("must be a number of days or weeks, like 7d or 4w, up to 365 days")
+	}
+	return n * unit, nil
+}
+
+// GetDoraAnalytics handles GET /api/v1/analytics/dora?days=30&group_by=app_name
+// - deployment frequency, lead time, change failure rate and time to restore
+// of the deployments pushed in the last days, per app or per domain
+func (h *Handler) GetDoraAnalytics(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	days, ok := analyticsDays(c)
+	if !ok {
+		return
+	}
+	groupBy := c.DefaultQuery("group_by", models.StatsByApp)
+	if groupBy != models.StatsByApp && groupBy != models.StatsByDomain {
+		RespondValidationError(c, "Invalid DORA query", []models.FieldError{{Field: "group_by", Message: "must be app_name or domain"}})
+		return
+	}
+
+	since := h.clock.Now().UTC().AddDate(0, 0, -days)
+	outcomes, err := h.db.ListDeploymentOutcomes(ctx, since)
+	if err != nil {
+		h.logger.Error("Failed to get deployment outcomes", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get DORA metrics")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    doraReport(outcomes, groupBy, days, since),
+	})
+}
+
+// doraGroup accumulates the outcomes of one app or domain
+type doraGroup struct {
+	metrics   models.DoraMetrics
+	leadTimes []float64
+	restores  []float64
+}
+
+func (g *doraGroup) add(o models.DeploymentOutcome) {
+	if o.DeployedAt != nil {
+		g.metrics.Deployments++
+		g.leadTimes = append(g.leadTimes, o.DeployedAt.Sub(o.CreatedAt).Seconds())
+	}
+	if o.Finished() {
+		g.metrics.Changes++
+	}
+	if o.Failed() {
+		g.metrics.FailedChanges++
+	}
+
+	if o.RolledBackAt != nil {
+		g.metrics.Rollbacks++
+		if o.RestoredAt != nil {
+			// The outage started when the bad version went out, or at the
+			// rollback if it never reached deployed
+			start := *o.RolledBackAt
+			if o.DeployedAt != nil && o.DeployedAt.Before(start) {
+				start = *o.DeployedAt
+			}
+			g.restores = append(g.restores, o.RestoredAt.Sub(start).Seconds())
+		}
+	}
+}
+
+func (g *doraGroup) finish(days int) models.DoraMetrics {
+	m := g.metrics
+	m.DeploymentsPerDay = float64(m.Deployments) / float64(days)
+	if len(g.leadTimes) > 0 {
+		sort.Float64s(g.leadTimes)
+		mid := len(g.leadTimes) / 2
+		median := g.leadTimes[mid]
+		if len(g.leadTimes)%2 == 0 {
+			median = (g.leadTimes[mid-1] + median) / 2
+		}
+		m.LeadTimeSeconds = &median
+	}
+	if m.Changes > 0 {
+		rate := float64(m.FailedChanges) / float64(m.Changes)
+		m.ChangeFailureRate = &rate
+	}
+	if len(g.restores) > 0 {
+		var sum float64
+		for _, seconds := range g.restores {
+			sum += seconds
+		}
+		mean := sum / float64(len(g.restores))
+		m.TimeToRestoreSeconds = &mean
+	}
+	return m
+}
+
+// doraReport computes the DORA metrics of outcomes ordered by domain and
+// app name, in total and per group
+func doraReport(outcomes []models.DeploymentOutcome, groupBy string, days int, since time.Time) models.DoraReport {
+	var total doraGroup
+	var groups []*doraGroup
+	for _, o := range outcomes {
+		appName := o.AppName
+		if groupBy == models.StatsByDomain {
+			appName = ""
+		}
+		if len(groups) == 0 || groups[len(groups)-1].metrics.Domain != o.Domain || groups[len(groups)-1].metrics.AppName != appName {
+			groups = append(groups, &doraGroup{metrics: models.DoraMetrics{Domain: o.Domain, AppName: appName}})
+		}
+		groups[len(groups)-1].add(o)
+		total.add(o)
+	}
+
+	report := models.DoraReport{
+		Days:   days,
+		Since:  since,
+		Total:  total.finish(days),
+		Groups: make([]models.DoraMetrics, len(groups)),
+	}
+	for i, g := range groups {
+		report.Groups[i] = g.finish(days)
+	}
+	return report
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// appsPath is where apps are addressed by domain and name
+const appsPath = "/api/v1/apps"
+
+// appState returns the declarative state of an app's latest deployment
+func appState(d *models.Deployment) models.AppState {
+	env := d.Env
+	if env == nil {
+		env = []string{}
+	}
+	return models.AppState{
+		ID:          d.Domain + "/" + d.AppName,
+		Domain:      d.Domain,
+		AppName:     d.AppName,
+		DockerImage: d.DockerImage,
+		Port:        d.Port,
+		Env:         env,
+		Priority:    d.Priority,
+		Version:     d.Version,
+	}
+}
+
+// checkUpsertPreconditions applies the conditional headers of an upsert,
+// responding when they fail: If-None-Match: * only creates (409 when the
+// resource exists) and If-Match only updates (404 when it does not, 412
+// when it no longer has the given ETag)
+func checkUpsertPreconditions(c *gin.Context, exists bool, etag, resource string) bool {
+	if exists && etagMatches(c.GetHeader("If-None-Match"), "*") {
+		RespondError(c, http.StatusConflict, resource+" already exists")
+		return false
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	if !exists {
+		RespondError(c, http.StatusNotFound, resource+" not found")
+		return false
+	}
+	if !etagMatches(ifMatch, etag) {
+		RespondError(c, http.StatusPreconditionFailed, resource+" was modified concurrently; refetch and retry")
+		return false
+	}
+	return true
+}
+
+// ListApps handles GET /api/v1/apps - the state of every app, ordered by
+// domain and app name. The response carries an ETag over the whole list, so
+// unchanged state costs a 304.
+func (h *Handler) ListApps(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain := c.Query("domain")
+	if domain != "" {
+		normalized, err := validation.NormalizeDomain(domain)
+		if err != nil {
+			RespondValidationError(c, "Invalid apps query", []models.FieldError{{Field: "domain", Message: err.Error()}})
+			return
+		}
+		domain = normalized
+	}
+
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get apps", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get apps")
+		return
+	}
+
+	h.redactDeployments(c, deployments)
+	apps := []models.AppState{}
+	for i := range deployments {
+		if domain == "" || deployments[i].Domain == domain {
+			apps = append(apps, appState(&deployments[i]))
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Domain != apps[j].Domain {
+			return apps[i].Domain < apps[j].Domain
+		}
+		return apps[i].AppName < apps[j].AppName
+	})
+
+	body, err := json.Marshal(apps)
+	if err != nil {
+		h.logger.Error("Failed to encode apps", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get apps")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    apps,
+	})
+}
+
+// latestApp returns an app's latest deployment, or nil when the app does
+// not exist
+func (h *Handler) latestApp(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	latest, err := h.db.GetLatestDeployment(ctx, domain, appName)
+	if err != nil {
+		if err.Error() == "deployment not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return latest, nil
+}
+
+// GetApp handles GET /api/v1/apps/:domain/:app_name
+func (h *Handler) GetApp(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	etag := latest.ETag()
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	h.redactDeployment(c, latest)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    appState(latest),
+	})
+}
+
+// PutApp handles PUT /api/v1/apps/:domain/:app_name - creates the app or,
+// when the request differs from its latest deployment, a new version of it
+func (h *Handler) PutApp(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	var body models.AppRequest
+	if err := h.bindJSON(c, &body); err != nil {
+		h.logger.Error("Invalid app request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	req := models.DeploymentRequest{
+		Domain:      domain,
+		AppName:     appName,
+		DockerImage: body.DockerImage,
+		Port:        body.Port,
+		Env:         body.Env,
+		Priority:    body.Priority,
+	}
+	if errs := h.validateDeploymentRequest(&req, nil); len(errs) > 0 {
+		RespondValidationError(c, "Invalid app", errs)
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+
+	etag := ""
+	if latest != nil {
+		etag = latest.ETag()
+	}
+	if !checkUpsertPreconditions(c, latest != nil, etag, "App") {
+		return
+	}
+
+	status := http.StatusOK
+	deployment := latest
+	if latest == nil || !latest.Matches(req) || latest.Priority != req.Priority {
+		deployment, err = h.db.CreateDeployment(ctx, req, uuid.New().String())
+		if err != nil {
+			h.logger.Error("Failed to create deployment", "error", err, "domain", domain, "app_name", appName)
+			RespondError(c, http.StatusInternalServerError, "Failed to create deployment")
+			return
+		}
+		status = http.StatusCreated
+
+		h.logger.Info("Created deployment",
+			"deployment_id", deployment.ID,
+			"domain", domain,
+			"app_name", appName,
+			"version", deployment.Version,
+			"actor", c.GetString(ActorKey))
+	}
+
+	c.Header("ETag", deployment.ETag())
+	c.Header("Location", appsPath+"/"+domain+"/"+appName)
+	h.redactDeployment(c, deployment)
+	c.JSON(status, models.APIResponse{
+		Success: true,
+		Data:    appState(deployment),
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// archiveBatchSize caps the logs and versions one retention run archives;
+// the rest are left to following runs
+const archiveBatchSize = 500
+
+// logArchiveKey is the blob store key of a deployment's archived log
+func logArchiveKey(id uuid.UUID) string {
+	return "logs/" + id.String() + ".json"
+}
+
+// versionArchiveKey is the blob store key of an archived deployment version
+func versionArchiveKey(d *models.Deployment) string {
+	return "versions/" + d.Domain + "/" + d.AppName + "/" + strconv.Itoa(d.Version) + ".json"
+}
+
+// archiveExpiredLogs moves the logs whose last chunk was uploaded before the
+// given time to the blob store and returns how many chunks were moved
+func (h *Handler) archiveExpiredLogs(ctx context.Context, before time.Time) (int64, error) {
+	ids, err := h.db.ListExpiredDeploymentLogs(ctx, before, archiveBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int64
+	for _, id := range ids {
+		n, err := h.archiveDeploymentLog(ctx, id)
+		if err != nil {
+			return archived, err
+		}
+		archived += n
+	}
+	return archived, nil
+}
+
+// archiveDeploymentLog moves a deployment's log to the blob store and
+// returns how many chunks were moved. A log that grew meanwhile is left for
+// the next run.
+func (h *Handler) archiveDeploymentLog(ctx context.Context, id uuid.UUID) (int64, error) {
+	chunks := []models.DeploymentLogChunk{}
+	for {
+		page, err := h.db.ListDeploymentLogs(ctx, id, int64(len(chunks)), -1, maxLogLimit)
+		if err != nil {
+			return 0, err
+		}
+		chunks = append(chunks, page...)
+		if len(page) < maxLogLimit {
+			break
+		}
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	body, err := json.Marshal(chunks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode log: %w", err)
+	}
+	key := logArchiveKey(id)
+	if err := h.blobs.Put(ctx, key, "application/json", body); err != nil {
+		return 0, err
+	}
+
+	err = h.db.ArchiveDeploymentLog(ctx, models.ArchivedDeploymentLog{DeploymentID: id, Key: key, Chunks: int64(len(chunks))})
+	if err != nil {
+		if err.Error() == "deployment log changed" {
+			h.logger.Warn("Deployment log changed while archiving", "id", id)
+			return 0, nil
+		}
+		return 0, err
+	}
+	return int64(len(chunks)), nil
+}
+
+// archivePrunableVersions moves the versions past retention.versions_per_app
+// to the blob store, with their events and logs, and returns how many were
+// moved. Sensitive env values are masked in the archive.
+func (h *Handler) archivePrunableVersions(ctx context.Context, keep int) (int64, error) {
+	deployments, err := h.db.ListPrunableDeploymentVersions(ctx, keep, archiveBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int64
+	for _, d := range deployments {
+		if _, err := h.archiveDeploymentLog(ctx, d.ID); err != nil {
+			return archived, err
+		}
+
+		events, err := h.db.ListDeploymentEvents(ctx, d.ID)
+		if err != nil {
+			return archived, err
+		}
+		d.Env = h.redactor.Env(d.Env)
+		record := models.ArchivedDeployment{Deployment: d, Events: events}
+		if log, err := h.db.GetArchivedDeploymentLog(ctx, d.ID); err == nil {
+			record.LogKey = log.Key
+		} else if err.Error() != "archived log not found" {
+			return archived, err
+		}
+
+		body, err := json.Marshal(record)
+		if err != nil {
+			return archived, fmt.Errorf("failed to encode deployment: %w", err)
+		}
+		if err := h.blobs.Put(ctx, versionArchiveKey(&d), "application/json", body); err != nil {
+			return archived, err
+		}
+
+		if err := h.db.DeleteDeployment(ctx, d.ID, nil); err != nil && err.Error() != "deployment not found" {
+			return archived, err
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// readArchivedLog reads the chunks of an archived deployment log from
+// fromSeq, through toSeq unless it is negative, up to limit. It returns
+// false when the log was not archived.
+func (h *Handler) readArchivedLog(ctx context.Context, id uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, bool, error) {
+	archived, err := h.db.GetArchivedDeploymentLog(ctx, id)
+	if err != nil {
+		if err.Error() == "archived log not found" {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	body, err := h.blobs.Get(ctx, archived.Key)
+	if err != nil {
+		return nil, true, err
+	}
+	var all []models.DeploymentLogChunk
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, true, fmt.Errorf("failed to decode archived log %s: %w", archived.Key, err)
+	}
+
+	chunks := []models.DeploymentLogChunk{}
+	for _, chunk := range all {
+		if chunk.Seq < fromSeq || (toSeq >= 0 && chunk.Seq > toSeq) {
+			continue
+		}
+		if len(chunks) == limit {
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, true, nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ActorKey is the gin context key holding who is making the request,
+	// set by the authentication middleware
+	ActorKey = "actor"
+
+	// AgentIDHeader lets agents identify themselves in the audit trail
+	AgentIDHeader = "X-Agent-ID"
+)
+
+// secretResource names a secret in the audit trail
+func secretResource(ref string) string {
+	return "secret:" + ref
+}
+
+// registryResource names a registry credential in the audit trail
+func registryResource(registry string) string {
+	return "registry:" + registry
+}
+
+// recordAudit stores audit events with the caller's identity. Failures are
+// logged rather than failing the read.
+func (h *Handler) recordAudit(ctx context.Context, c *gin.Context, events []models.AuditEvent) {
+	actor := c.GetString(ActorKey)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	for i := range events {
+		events[i].Actor = actor
+		events[i].ClientIP = c.ClientIP()
+	}
+
+	if err := h.db.RecordAuditEvents(ctx, events); err != nil {
+		h.logger.Error("Failed to record audit events", "error", err, "actor", actor, "count", len(events))
+	}
+}
+
+// secretReadEvents lists the secret reads made when serving a deployment's
+// env to an agent
+func secretReadEvents(deployment *models.Deployment, agentVault bool) []models.AuditEvent {
+	var events []models.AuditEvent
+	for _, entry := range deployment.Env {
+		name, ref, ok := models.ParseSecretRef(entry)
+		if !ok {
+			continue
+		}
+
+		event := models.AuditEvent{
+			Action:       models.AuditSecretRead,
+			Resource:     secretResource(ref),
+			DeploymentID: &deployment.ID,
+			Detail:       "env " + name,
+		}
+		if project, secretName, version, ok := models.SplitSecretRef(ref); ok {
+			event.Resource = secretResource(secretRef(project, secretName))
+			if version > 0 {
+				event.Detail += fmt.Sprintf(" (pinned version %d)", version)
+			}
+		} else if _, _, isVault := vault.ParseRef(ref); isVault && agentVault {
+			event.Detail += " (read by the agent with a minted vault token)"
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// paginateAuditEvents trims a page fetched with limit+1 rows and returns the
+// pagination metadata for it
+func paginateAuditEvents(events []models.AuditEvent, limit int) ([]models.AuditEvent, *models.Pagination) {
+	pagination := &models.Pagination{Limit: limit}
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		pagination.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return events, pagination
+}
+
+// listAuditEvents responds with a page of a resource's audit events, or
+// with all of them from the cursor on as a CSV file named filename
+func (h *Handler) listAuditEvents(c *gin.Context, resource, filename string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	cursor, limit, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+
+	if wantsCSV(c) {
+		h.streamAuditEventsCSV(c, resource, filename, cursor)
+		return
+	}
+
+	events, err := h.db.ListAuditEvents(ctx, resource, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("Failed to list audit events", "error", err, "resource", resource)
+		RespondError(c, http.StatusInternalServerError, "Failed to list audit events")
+		return
+	}
+
+	events, pagination := paginateAuditEvents(events, limit)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success:    true,
+		Data:       events,
+		Pagination: pagination,
+	})
+}
+
+// streamAuditEventsCSV streams a resource's audit events from the cursor on
+// as CSV, fetching them a page at a time so long trails aren't buffered
+func (h *Handler) streamAuditEventsCSV(c *gin.Context, resource, filename string, cursor *models.Cursor) {
+	// Each page gets its own timeout, so only the write deadline of the
+	// stream bounds the whole export
+	fetch := func(after *models.Cursor) ([]models.AuditEvent, error) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		return h.db.ListAuditEvents(ctx, resource, after, maxPageLimit)
+	}
+
+	events, err := fetch(cursor)
+	if err != nil {
+		h.logger.Error("Failed to list audit events", "error", err, "resource", resource)
+		RespondError(c, http.StatusInternalServerError, "Failed to list audit events")
+		return
+	}
+
+	err = streamCSV(c, filename, auditEventsCSVHeader, func(write func([]string) error) error {
+		for len(events) > 0 {
+			for _, event := range events {
+				if err := write(auditEventCSVRecord(event)); err != nil {
+					return err
+				}
+			}
+			if len(events) < maxPageLimit {
+				return nil
+			}
+
+			last := events[len(events)-1]
+			events, err = fetch(&models.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("Failed to write audit events CSV", "error", err, "resource", resource)
+	}
+}
+
+// GetSecretAccessLog handles GET /api/v1/secrets/:project/:name/access
+func (h *Handler) GetSecretAccessLog(c *gin.Context) {
+	h.listAuditEvents(c, secretResource(secretRef(c.Param("project"), c.Param("name"))), "secret-access.csv")
+}
+
+// GetRegistryAccessLog handles GET /api/v1/registry/access
+func (h *Handler) GetRegistryAccessLog(c *gin.Context) {
+	registry := c.Query("registry")
+	if registry == "" {
+		RespondError(c, http.StatusBadRequest, "registry parameter is required")
+		return
+	}
+	h.listAuditEvents(c, registryResource(registry), "registry-access.csv")
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backupFormatVersion is bumped whenever the backup document changes
+// incompatibly
+const backupFormatVersion = 1
+
+// backupTimeout bounds taking, archiving or restoring a backup
+const backupTimeout = 5 * time.Minute
+
+// credentialsTable holds the registry credentials, whose passwords are
+// encrypted in backups
+const credentialsTable = "docker_credentials"
+
+// backupKeyPrefix is where backups are written in the blob store
+const backupKeyPrefix = "backups/"
+
+// CreateBackup takes a consistent backup of the database. Registry
+// passwords are encrypted with the secrets key, or left out without one.
+func (h *Handler) CreateBackup(ctx context.Context) (*models.Backup, error) {
+	tables, err := h.db.Backup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &models.Backup{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     h.clock.Now().UTC(),
+		Tables:        tables,
+	}
+	if h.cipher == nil {
+		delete(tables, credentialsTable)
+		backup.Omitted = []string{credentialsTable}
+	} else {
+		rows, err := h.mapCredentials(tables[credentialsTable], h.encryptCredential)
+		if err != nil {
+			return nil, err
+		}
+		tables[credentialsTable] = rows
+		backup.CredentialsEncrypted = true
+	}
+
+	for _, key := range h.cfg.Security.KMS.DataKeys {
+		backup.DataKeys = append(backup.DataKeys, models.WrappedDataKey{
+			ID:       key.ID,
+			Provider: h.cfg.Security.KMS.Provider,
+			Wrapped:  key.Wrapped,
+		})
+	}
+
+	return backup, nil
+}
+
+// WriteBackup writes a backup to the blob store under backups/
+func (h *Handler) WriteBackup(ctx context.Context, backup *models.Backup) (*models.ArchivedBackup, error) {
+	if h.blobs == nil {
+		return nil, fmt.Errorf("blob store is not configured")
+	}
+
+	body, err := json.Marshal(backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+
+	archived := &models.ArchivedBackup{
+		Key:       backupKeyPrefix + backup.CreatedAt.Format("20060102T150405Z") + ".json",
+		CreatedAt: backup.CreatedAt,
+		Rows:      make(map[string]int, len(backup.Tables)),
+		Omitted:   backup.Omitted,
+	}
+	for table, rows := range backup.Tables {
+		archived.Rows[table] = len(rows)
+	}
+	if err := h.blobs.Put(ctx, archived.Key, "application/json", body); err != nil {
+		return nil, err
+	}
+
+	return archived, nil
+}
+
+// ReadBackup reads a backup written to the blob store by WriteBackup
+func (h *Handler) ReadBackup(ctx context.Context, key string) (*models.Backup, error) {
+	if h.blobs == nil {
+		return nil, fmt.Errorf("blob store is not configured")
+	}
+	if !strings.HasPrefix(key, backupKeyPrefix) {
+		return nil, fmt.Errorf("backup key must start with %s", backupKeyPrefix)
+	}
+
+	body, err := h.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup models.Backup
+	if err := json.Unmarshal(body, &backup); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: %w", key, err)
+	}
+	return &backup, nil
+}
+
+// checkBackup reports why a backup cannot be restored here, if it cannot
+func (h *Handler) checkBackup(backup *models.Backup, conflicts string) string {
+	switch {
+	case backup.FormatVersion == 0 || backup.Tables == nil:
+		return "Not a backup document"
+	case backup.FormatVersion > backupFormatVersion:
+		return "Unsupported backup format version"
+	case conflicts != models.RestoreSkip && conflicts != models.RestoreFail:
+		return "conflicts must be skip or fail"
+	case backup.CredentialsEncrypted && len(backup.Tables[credentialsTable]) > 0 && h.cipher == nil:
+		return "Backup has encrypted registry credentials but no secrets key is configured"
+	}
+	return ""
+}
+
+// RestoreBackup inserts a backup's rows, handling rows that conflict with
+// existing ones as conflicts says. A dry run reports the outcome without
+// changing anything. When conflicts is fail and any row conflicts, the
+// per-table result is returned along with the error.
+func (h *Handler) RestoreBackup(ctx context.Context, backup *models.Backup, conflicts string, dryRun bool) (*models.RestoreResult, error) {
+	if msg := h.checkBackup(backup, conflicts); msg != "" {
+		return nil, fmt.Errorf("%s", strings.ToLower(msg[:1])+msg[1:])
+	}
+
+	tables := maps.Clone(backup.Tables)
+	if backup.CredentialsEncrypted {
+		rows, err := h.mapCredentials(tables[credentialsTable], h.decryptCredential)
+		if err != nil {
+			return nil, err
+		}
+		tables[credentialsTable] = rows
+	}
+
+	restored, err := h.db.RestoreBackup(ctx, tables, conflicts == models.RestoreFail, dryRun)
+	if restored == nil {
+		return nil, err
+	}
+	return &models.RestoreResult{
+		DryRun:    dryRun,
+		Conflicts: conflicts,
+		CreatedAt: backup.CreatedAt,
+		Tables:    restored,
+	}, err
+}
+
+// mapCredentials rewrites the password of every registry credential row
+func (h *Handler) mapCredentials(rows []json.RawMessage, fn func(registry, password string) (string, error)) ([]json.RawMessage, error) {
+	mapped := make([]json.RawMessage, 0, len(rows))
+	for _, row := range rows {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(row, &fields); err != nil {
+			return nil, fmt.Errorf("invalid registry credential: %w", err)
+		}
+		var registry, password string
+		json.Unmarshal(fields["registry"], &registry)
+		if err := json.Unmarshal(fields["password"], &password); err != nil {
+			return nil, fmt.Errorf("registry credential %q has no password", registry)
+		}
+
+		password, err := fn(registry, password)
+		if err != nil {
+			return nil, err
+		}
+		fields["password"], _ = json.Marshal(password)
+
+		row, err = json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		mapped = append(mapped, row)
+	}
+	return mapped, nil
+}
+
+func (h *Handler) encryptCredential(registry, password string) (string, error) {
+	sealed, err := h.cipher.Encrypt([]byte(password), registryResource(registry))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt registry credential %q: %w", registry, err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (h *Handler) decryptCredential(registry, password string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return "", fmt.Errorf("registry credential %q is not encrypted", registry)
+	}
+	plaintext, err := h.cipher.Decrypt(sealed, registryResource(registry))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt registry credential %q; is the secrets key the backup was taken with configured?", registry)
+	}
+	return string(plaintext), nil
+}
+
+// requireReveal responds 403 unless the caller presented the reveal token;
+// backups hold unredacted env values
+func requireReveal(c *gin.Context) bool {
+	if !c.GetBool(RevealScopeKey) {
+		RespondError(c, http.StatusForbidden, "Backups hold unredacted env values; use the reveal token")
+		return false
+	}
+	return true
+}
+
+// Backup handles GET /api/v1/admin/backup - downloads a consistent backup
+// of the controller's database
+func (h *Handler) Backup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), backupTimeout)
+	defer cancel()
+
+	if !requireReveal(c) {
+		return
+	}
+
+	backup, err := h.CreateBackup(ctx)
+	if err != nil {
+		h.logger.Error("Failed to back up controller state", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to back up controller state")
+		return
+	}
+
+	h.recordAudit(ctx, c, []models.AuditEvent{{
+		Action:   models.AuditBackupRead,
+		Resource: "backup",
+	}})
+
+	h.logger.Info("Backed up controller state",
+		"omitted", backup.Omitted,
+		"actor", c.GetString(ActorKey))
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="deployment-controller-backup-`+backup.CreatedAt.Format("20060102T150405Z")+`.json"`)
+	c.JSON(http.StatusOK, backup)
+}
+
+// ArchiveBackup handles POST /api/v1/admin/backup - writes a consistent
+// backup of the controller's database to the blob store under backups/
+func (h *Handler) ArchiveBackup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), backupTimeout)
+	defer cancel()
+
+	if h.blobs == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Blob store is not configured")
+		return
+	}
+	if !requireReveal(c) {
+		return
+	}
+
+	backup, err := h.CreateBackup(ctx)
+	if err != nil {
+		h.logger.Error("Failed to back up controller state", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to back up controller state")
+		return
+	}
+
+	archived, err := h.WriteBackup(ctx, backup)
+	if err != nil {
+		h.logger.Error("Failed to archive backup", "error", err)
+		RespondError(c, http.StatusBadGateway, "Failed to write backup to the blob store")
+		return
+	}
+
+	h.logger.Info("Archived controller backup",
+		"key", archived.Key,
+		"omitted", archived.Omitted,
+		"actor", c.GetString(ActorKey))
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Backup archived",
+		Data:    archived,
+	})
+}
+
+// Restore handles POST /api/v1/admin/restore - restores a backup sent as
+// the body, or read from the blob store with ?key=
+func (h *Handler) Restore(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), backupTimeout)
+	defer cancel()
+
+	dryRun := c.Query("dry_run") == "true"
+	conflicts := c.DefaultQuery("conflicts", models.RestoreSkip)
+	if !dryRun && h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	var backup *models.Backup
+	if key := c.Query("key"); key != "" {
+		if h.blobs == nil {
+			RespondError(c, http.StatusServiceUnavailable, "Blob store is not configured")
+			return
+		}
+		var err error
+		if backup, err = h.ReadBackup(ctx, key); err != nil {
+			h.logger.Error("Failed to read backup", "error", err, "key", key)
+			if err.Error() == "blob not found" {
+				RespondError(c, http.StatusNotFound, "Backup not found")
+				return
+			}
+			RespondError(c, http.StatusBadGateway, "Failed to read backup from the blob store")
+			return
+		}
+	} else {
+		backup = &models.Backup{}
+		if err := json.NewDecoder(c.Request.Body).Decode(backup); err != nil {
+			h.logger.Error("Invalid backup document", "error", err)
+			RespondError(c, http.StatusBadRequest, "Invalid backup document: "+err.Error())
+			return
+		}
+	}
+
+	if msg := h.checkBackup(backup, conflicts); msg != "" {
+		RespondError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := h.RestoreBackup(ctx, backup, conflicts, dryRun)
+	if err != nil && result != nil {
+		RespondErrorWithData(c, http.StatusConflict, "Backup conflicts with existing rows; nothing was restored", result)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to restore backup", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to restore backup: "+err.Error())
+		return
+	}
+
+	h.logger.Info("Restored controller backup",
+		"dry_run", dryRun,
+		"conflicts", conflicts,
+		"created_at", backup.CreatedAt,
+		"actor", c.GetString(ActorKey))
+
+	message := "Backup restored"
+	if dryRun {
+		message = "Restore dry run completed; no changes were made"
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
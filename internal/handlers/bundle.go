@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/manifests"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bundleFile is one file of a deployment bundle
+type bundleFile struct {
+	name    string
+	content []byte
+	secret  bool
+}
+
+// GetDeploymentBundle handles GET /api/v1/deployments/:id/bundle
+// ?exclude_secrets=true - a tar.gz of the deployment JSON, its manifests in
+// every format and a .env file, for applying it by hand on a host when the
+// controller or its agents are unavailable
+func (h *Handler) GetDeploymentBundle(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	excludeSecrets := false
+	if value := c.Query("exclude_secrets"); value != "" {
+		exclude, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "exclude_secrets must be true or false")
+			return
+		}
+		excludeSecrets = exclude
+	}
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to build deployment bundle")
+	if !ok {
+		return
+	}
+
+	// Without secrets there is nothing to resolve, so bundles can be built
+	// even when agents resolve secrets themselves
+	var env []string
+	var secretEnv []manifests.Secret
+	if excludeSecrets {
+		for _, entry := range deployment.Env {
+			if !isSecretEntry(entry) {
+				env = append(env, entry)
+			}
+		}
+	} else if env, secretEnv, ok = h.manifestEnv(ctx, c, deployment); !ok {
+		return
+	}
+
+	maintenance, err := h.db.GetMaintenance(ctx, deployment.Domain, deployment.AppName)
+	if err != nil {
+		h.logger.Error("Failed to get maintenance", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to build deployment bundle")
+		return
+	}
+
+	files, err := h.bundleFiles(c, deployment, env, secretEnv, manifests.Options{
+		InlineSecrets: h.cfg.Manifests.InlineSecrets,
+		Maintenance:   maintenance.Enabled,
+	})
+	if err != nil {
+		h.logger.Error("Failed to build deployment bundle", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to build deployment bundle")
+		return
+	}
+
+	dir := fmt.Sprintf("%s-v%d", deployment.AppName, deployment.Version)
+	body, err := writeBundle(dir, deployment.CreatedAt, files)
+	if err != nil {
+		h.logger.Error("Failed to write deployment bundle", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to build deployment bundle")
+		return
+	}
+
+	if !excludeSecrets {
+		h.recordAudit(ctx, c, secretReadEvents(deployment, false))
+	}
+
+	h.logger.Info("Built deployment bundle",
+		"id", deployment.ID,
+		"app_name", deployment.AppName,
+		"exclude_secrets", excludeSecrets,
+		"actor", c.GetString(ActorKey))
+
+	// Bundles may hold resolved secrets, which intermediaries must not store
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="`+dir+`.tar.gz"`)
+	c.Data(http.StatusOK, "application/gzip", body)
+}
+
+// bundleFiles lists the files of a deployment's bundle: deployment.json as
+// the API returns it, a .env with plain entries and the resolved secrets in
+// the deployment's order, and each format's manifest with its secret files
+// under manifests/<format>/
+func (h *Handler) bundleFiles(c *gin.Context, deployment *models.Deployment, env []string, secretEnv []manifests.Secret, opts manifests.Options) ([]bundleFile, error) {
+	redacted := *deployment
+	h.redactDeployment(c, &redacted)
+	deploymentJSON, err := json.MarshalIndent(redacted, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode deployment: %w", err)
+	}
+
+	var dotenv strings.Builder
+	plain, secrets := env, secretEnv
+	for _, entry := range deployment.Env {
+		if !isSecretEntry(entry) {
+			dotenv.WriteString(plain[0] + "\n")
+			plain = plain[1:]
+		} else if len(secrets) > 0 {
+			dotenv.WriteString(secrets[0].Name + "=" + secrets[0].Value + "\n")
+			secrets = secrets[1:]
+		}
+	}
+
+	files := []bundleFile{
+		{name: "deployment.json", content: append(deploymentJSON, '\n')},
+		{name: ".env", content: []byte(dotenv.String()), secret: true},
+	}
+	for _, format := range manifests.Formats {
+		manifest, err := manifests.Render(format, deployment, env, secretEnv, opts)
+		if err != nil {
+			return nil, err
+		}
+		dir := path.Join("manifests", format)
+		files = append(files, bundleFile{name: path.Join(dir, manifests.FileNames[format]), content: []byte(manifest.Content)})
+
+		names := make([]string, 0, len(manifest.SecretFiles))
+		for name := range manifest.SecretFiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			file := path.Join(dir, name)
+			// Nomad secret files are keyed by variable path, not file name
+			if format == manifests.FormatNomad {
+				file = path.Join(dir, "variable.json")
+			}
+			files = append(files, bundleFile{name: file, content: []byte(manifest.SecretFiles[name]), secret: true})
+		}
+	}
+	return files, nil
+}
+
+// writeBundle writes files into a tar.gz under dir. Files holding secrets
+// are only readable by their owner.
+func writeBundle(dir string, modTime time.Time, files []bundleFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range files {
+		mode := int64(0o644)
+		if file.secret {
+			mode = 0o600
+		}
+		header := &tar.Header{
+			Name:    path.Join(dir, file.name),
+			Mode:    mode,
+			Size:    int64(len(file.content)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// deploymentFromPath parses the :id path parameter and loads the deployment,
+// responding when it is invalid or missing
+func (h *Handler) deploymentFromPath(ctx context.Context, c *gin.Context, failure string) (*models.Deployment, bool) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return nil, false
+	}
+
+	deployment, err := h.db.GetDeployment(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return nil, false
+		}
+
+		RespondError(c, http.StatusInternalServerError, failure)
+		return nil, false
+	}
+
+	return deployment, true
+}
+
+// GetDeploymentChecks handles GET /api/v1/deployments/:id/checks - the CI
+// checks a deployment was pushed with and whether they still hold it
+func (h *Handler) GetDeploymentChecks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to get deployment checks")
+	if !ok {
+		return
+	}
+
+	checks, err := h.db.ListDeploymentChecks(ctx, deployment.ID)
+	if err != nil {
+		h.logger.Error("Failed to list deployment checks", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment checks")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.DeploymentChecks{
+			DeploymentID: deployment.ID,
+			Held:         models.Held(checks),
+			Checks:       checks,
+		},
+	})
+}
+
+// ReportDeploymentChecks handles POST /api/v1/deployments/:id/checks - the
+// CI status callback. Once every check the deployment was pushed with has
+// succeeded, agents may start it.
+func (h *Handler) ReportDeploymentChecks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var req models.CheckStatusRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid check status request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var errs []models.FieldError
+	for i, check := range req.Checks {
+		if !slices.Contains(models.CheckStatuses, check.Status) {
+			errs = append(errs, models.FieldError{
+				Field:   fmt.Sprintf("checks[%d].status", i),
+				Message: "must be one of: " + strings.Join(models.CheckStatuses, ", "),
+			})
+		}
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid check status", errs)
+		return
+	}
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to update deployment checks")
+	if !ok {
+		return
+	}
+
+	checks, err := h.db.UpdateDeploymentChecks(ctx, deployment.ID, req.Checks)
+	if err != nil {
+		if err.Error() == "check not found" {
+			RespondError(c, http.StatusUnprocessableEntity, "Deployment was not pushed with every reported check")
+			return
+		}
+
+		h.logger.Error("Failed to update deployment checks", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to update deployment checks")
+		return
+	}
+
+	held := models.Held(checks)
+	h.logger.Info("Recorded deployment checks",
+		"id", deployment.ID,
+		"domain", deployment.Domain,
+		"app_name", deployment.AppName,
+		"reported", len(req.Checks),
+		"held", held,
+		"actor", c.GetString(ActorKey))
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.DeploymentChecks{
+			DeploymentID: deployment.ID,
+			Held:         held,
+			Checks:       checks,
+		},
+	})
+}
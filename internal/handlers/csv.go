@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsCSV reports whether the client asked for a CSV representation
+func wantsCSV(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/csv")
+}
+
+// streamCSV writes a CSV attachment row by row, flushing as it goes so large
+// result sets are not buffered in memory
+func streamCSV(c *gin.Context, filename string, header []string, rows func(write func([]string) error) error) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	err := rows(func(record []string) error {
+		if err := w.Write(record); err != nil {
+			return err
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// formatCSVTime formats an optional timestamp for CSV output
+func formatCSVTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatCSVMetadata formats deployment metadata as a JSON object for CSV
+// output; empty when there is none
+func formatCSVMetadata(metadata map[string]any) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(metadata)
+	return string(b)
+}
+
+// writeDeploymentsCSV streams deployments as CSV
+func writeDeploymentsCSV(c *gin.Context, filename string, deployments []models.Deployment) error {
+	header := []string{
+		"id", "request_id", "domain", "app_name", "docker_image", "port", "env",
+		"version", "status", "updated_at", "deployed_at", "created_at",
+		"git_sha", "git_ref", "build_url", "builder", "metadata",
+	}
+
+	return streamCSV(c, filename, header, func(write func([]string) error) error {
+		for _, d := range deployments {
+			err := write([]string{
+				d.ID.String(),
+				d.RequestID,
+				d.Domain,
+				d.AppName,
+				d.DockerImage,
+				strconv.Itoa(d.Port),
+				strings.Join(d.Env, ";"),
+				strconv.Itoa(d.Version),
+				d.Status,
+				formatCSVTime(&d.UpdatedAt),
+				formatCSVTime(d.DeployedAt),
+				formatCSVTime(&d.CreatedAt),
+				d.GitSHA,
+				d.GitRef,
+				d.BuildURL,
+				d.Builder,
+				formatCSVMetadata(d.Metadata),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeDeploymentEventsCSV streams a deployment's events as CSV
+func writeDeploymentEventsCSV(c *gin.Context, filename string, events []models.DeploymentEvent) error {
+	header := []string{"id", "deployment_id", "type", "message", "attempt", "created_at"}
+
+	return streamCSV(c, filename, header, func(write func([]string) error) error {
+		for _, e := range events {
+			err := write([]string{
+				e.ID.String(),
+				e.DeploymentID.String(),
+				e.Type,
+				e.Message,
+				strconv.Itoa(e.Attempt),
+				formatCSVTime(&e.CreatedAt),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// auditEventsCSVHeader is the header row of audit event CSV exports
+var auditEventsCSVHeader = []string{"id", "action", "resource", "actor", "client_ip", "deployment_id", "detail", "created_at"}
+
+// auditEventCSVRecord formats an audit event as a CSV row
+func auditEventCSVRecord(e models.AuditEvent) []string {
+	deploymentID := ""
+	if e.DeploymentID != nil {
+		deploymentID = e.DeploymentID.String()
+	}
+	return []string{
+		e.ID.String(),
+		e.Action,
+		e.Resource,
+		e.Actor,
+		e.ClientIP,
+		deploymentID,
+		e.Detail,
+		formatCSVTime(&e.CreatedAt),
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/yaml.v3"
+)
+
+// StrictParsingHeader overrides validation.strict_parsing for a single request
+const StrictParsingHeader = "X-Strict-Parsing"
+
+// strictParsing reports whether unknown fields in the request body should be
+// rejected rather than ignored
+func (h *Handler) strictParsing(c *gin.Context) (bool, error) {
+	value := c.GetHeader(StrictParsingHeader)
+	if value == "" {
+		return h.cfg.Validation.StrictParsing, nil
+	}
+
+	strict, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s header must be true or false", StrictParsingHeader)
+	}
+	return strict, nil
+}
+
+// bindJSON decodes and validates a JSON request body like ShouldBindJSON,
+// rejecting unknown fields in strict mode
+func (h *Handler) bindJSON(c *gin.Context, obj interface{}) error {
+	strict, err := h.strictParsing(c)
+	if err != nil {
+		return err
+	}
+	if !strict {
+		return c.ShouldBindJSON(obj)
+	}
+
+	if c.Request.Body == nil {
+		return fmt.Errorf("missing request body")
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// decodeDocument decodes a JSON or YAML document body, rejecting unknown
+// fields in strict mode
+func (h *Handler) decodeDocument(c *gin.Context, body []byte, isYAML bool, obj interface{}) error {
+	strict, err := h.strictParsing(c)
+	if err != nil {
+		return err
+	}
+
+	if isYAML {
+		decoder := yaml.NewDecoder(bytes.NewReader(body))
+		decoder.KnownFields(strict)
+		return decoder.Decode(obj)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(obj)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/kms"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSecretsCipher builds the cipher for stored secrets. With a KMS provider
+// the data keys are unwrapped by the KMS and the static encryption key, if
+// still set, only decrypts values that predate them. The wrapper is returned
+// even when no data key is configured yet so one can be generated.
+func newSecretsCipher(ctx context.Context, cfg config.SecurityConfig) (*secrets.Cipher, kms.Wrapper, error) {
+	if cfg.KMS.Provider == "" {
+		cipher, err := secrets.NewCipher(cfg.EncryptionKey)
+		return cipher, nil, err
+	}
+
+	wrapper, err := kms.New(ctx, cfg.KMS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(cfg.KMS.DataKeys) == 0 {
+		return nil, wrapper, fmt.Errorf("no security.kms.data_keys configured; generate one with POST /api/v1/encryption/data-keys")
+	}
+
+	keys, err := kms.UnwrapDataKeys(ctx, wrapper, cfg.KMS.DataKeys)
+	if err != nil {
+		return nil, wrapper, err
+	}
+
+	cipher, err := secrets.NewKeyring(keys, cfg.EncryptionKey)
+	return cipher, wrapper, err
+}
+
+// GenerateDataKey handles POST /api/v1/encryption/data-keys - creates a data
+// key wrapped by the KMS for the operator to add to security.kms.data_keys.
+// The plaintext key is never returned or stored.
+func (h *Handler) GenerateDataKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.kms == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Envelope encryption is disabled: security.kms.provider is not configured")
+		return
+	}
+
+	dataKey, err := secrets.GenerateDataKey()
+	if err != nil {
+		h.logger.Error("Failed to generate data key", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to generate data key")
+		return
+	}
+
+	wrapped, err := h.kms.Wrap(ctx, dataKey)
+	if err != nil {
+		h.logger.Error("Failed to wrap data key", "error", err)
+		RespondError(c, http.StatusBadGateway, "Failed to wrap data key with the KMS")
+		return
+	}
+
+	key := models.WrappedDataKey{
+		ID:       "dk-" + h.clock.Now().UTC().Format("20060102150405"),
+		Provider: h.cfg.Security.KMS.Provider,
+		Wrapped:  base64.StdEncoding.EncodeToString(wrapped),
+	}
+
+	h.logger.Info("Generated data key", "key_id", key.ID, "provider", key.Provider)
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Data key generated; add it first in security.kms.data_keys and restart, then re-encrypt",
+		Data:    key,
+	})
+}
+
+// ReencryptSecrets handles POST /api/v1/encryption/reencrypt - rewrites every
+// stored secret value not yet encrypted with the primary data key
+func (h *Handler) ReencryptSecrets(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	if !h.requireCipher(c) {
+		return
+	}
+
+	count, err := h.db.ReencryptSecrets(ctx, func(project, name string, value []byte) ([]byte, error) {
+		if h.cipher.Current(value) {
+			return nil, nil
+		}
+
+		plaintext, err := h.cipher.Decrypt(value, secretRef(project, name))
+		if err != nil {
+			return nil, err
+		}
+		return h.cipher.Encrypt(plaintext, secretRef(project, name))
+	})
+	if err != nil {
+		h.logger.Error("Failed to re-encrypt secrets", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to re-encrypt secrets")
+		return
+	}
+
+	result := models.ReencryptResult{KeyID: h.cipher.PrimaryKeyID(), Reencrypted: count}
+
+	h.logger.Info("Re-encrypted secrets", "key_id", result.KeyID, "count", count)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Secrets re-encrypted",
+		Data:    result,
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseETagList splits an If-Match / If-None-Match header into its entity tags
+func parseETagList(header string) []string {
+	var tags []string
+	for _, part := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(part)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// etagMatches reports whether etag is listed in the header, ignoring weak validators
+func etagMatches(header, etag string) bool {
+	for _, tag := range parseETagList(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch extracts the If-Match preconditions for a write, responding
+// with 428 when the header is missing. A nil slice means any version matches.
+func requireIfMatch(c *gin.Context) ([]string, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		RespondError(c, http.StatusPreconditionRequired, "If-Match header is required")
+		return nil, false
+	}
+
+	tags := parseETagList(header)
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil, true
+		}
+	}
+
+	return tags, true
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// exportFormatVersion is bumped whenever the export document changes incompatibly
+const exportFormatVersion = 1
+
+// wantsYAML reports whether the client asked for a YAML representation
+func wantsYAML(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return format == "yaml" || format == "yml"
+	}
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, "application/yaml") || strings.Contains(accept, "application/x-yaml")
+}
+
+// buildExport collects the latest deployments and registry references into
+// an export document, masking sensitive env values unless reveal is set
+func (h *Handler) buildExport(ctx context.Context, reveal bool) (*models.ControllerExport, error) {
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployments: %w", err)
+	}
+
+	registries, err := h.db.ListRegistries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registries: %w", err)
+	}
+
+	export := &models.ControllerExport{
+		FormatVersion: exportFormatVersion,
+		ExportedAt:    h.clock.Now().UTC(),
+		Deployments:   []models.DeploymentRequest{},
+		Registries:    []models.RegistryReference{},
+	}
+	for _, d := range deployments {
+		// Mark the export if masking changed anything so it is not imported
+		if !reveal {
+			env := h.redactor.Env(d.Env)
+			export.Redacted = export.Redacted || !slices.Equal(env, d.Env)
+			d.Env = env
+		}
+		export.Deployments = append(export.Deployments, models.DeploymentRequest{
+			Domain:      d.Domain,
+			AppName:     d.AppName,
+			DockerImage: d.DockerImage,
+			Port:        d.Port,
+			Env:         d.Env,
+			UpdatedAt:   d.UpdatedAt,
+			Metadata:    d.Metadata,
+			BuildInfo:   d.BuildInfo,
+		})
+	}
+	export.Registries = append(export.Registries, registries...)
+
+	return export, nil
+}
+
+// Export handles GET /api/v1/export - dumps controller state as JSON or YAML
+func (h *Handler) Export(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	export, err := h.buildExport(ctx, c.GetBool(RevealScopeKey))
+	if err != nil {
+		h.logger.Error("Failed to export controller state", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to export controller state")
+		return
+	}
+
+	h.logger.Info("Exported controller state",
+		"deployments", len(export.Deployments),
+		"registries", len(export.Registries))
+
+	if wantsYAML(c) {
+		body, err := yaml.Marshal(export)
+		if err != nil {
+			h.logger.Error("Failed to encode export", "error", err)
+			RespondError(c, http.StatusInternalServerError, "Failed to encode export")
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="deployment-controller-export.yaml"`)
+		c.Data(http.StatusOK, "application/yaml", body)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="deployment-controller-export.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// ArchiveExport handles POST /api/v1/export/archive - writes an export
+// bundle to the blob store under exports/, for backups that outlive the
+// database
+func (h *Handler) ArchiveExport(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	if h.blobs == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Blob store is not configured")
+		return
+	}
+
+	export, err := h.buildExport(ctx, c.GetBool(RevealScopeKey))
+	if err != nil {
+		h.logger.Error("Failed to export controller state", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to export controller state")
+		return
+	}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		h.logger.Error("Failed to encode export", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to encode export")
+		return
+	}
+
+	key := "exports/" + export.ExportedAt.Format("20060102T150405Z") + ".json"
+	if err := h.blobs.Put(ctx, key, "application/json", body); err != nil {
+		h.logger.Error("Failed to archive export", "error", err, "key", key)
+		RespondError(c, http.StatusBadGateway, "Failed to write export to the blob store")
+		return
+	}
+
+	h.logger.Info("Archived controller state",
+		"key", key,
+		"deployments", len(export.Deployments),
+		"registries", len(export.Registries))
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Export archived",
+		Data: models.ArchivedExport{
+			Key:         key,
+			ExportedAt:  export.ExportedAt,
+			Redacted:    export.Redacted,
+			Deployments: len(export.Deployments),
+			Registries:  len(export.Registries),
+		},
+	})
+}
+
+// Import handles POST /api/v1/import - restores state from an export document
+func (h *Handler) Import(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	var export models.ControllerExport
+	if err := h.decodeDocument(c, body, strings.Contains(c.ContentType(), "yaml"), &export); err != nil {
+		h.logger.Error("Invalid import document", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid import document: "+err.Error())
+		return
+	}
+
+	if export.FormatVersion > exportFormatVersion {
+		RespondError(c, http.StatusBadRequest, "Unsupported export format version")
+		return
+	}
+
+	// Importing masked values would overwrite the real ones
+	if export.Redacted {
+		RespondError(c, http.StatusBadRequest, "Export has redacted env values; export again with the reveal token")
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	if !dryRun && h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	result, err := h.importState(ctx, export, dryRun)
+	if err != nil {
+		h.logger.Error("Failed to import controller state", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to import controller state")
+		return
+	}
+
+	h.logger.Info("Imported controller state",
+		"dry_run", dryRun,
+		"request_id", result.RequestID,
+		"deployments", len(result.Deployments),
+		"registries", len(result.Registries))
+
+	message := "Import completed"
+	if dryRun {
+		message = "Import dry run completed; no changes were made"
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// SeedFixtures loads a fixtures file, an export document of deployments and
+// registry credentials, for local development and demos. Deployments that
+// match the latest version are left unchanged and credentials are upserted,
+// so seeding the same file twice changes nothing.
+func (h *Handler) SeedFixtures(ctx context.Context, fixtures models.ControllerExport, dryRun bool) (*models.ImportResult, error) {
+	if fixtures.FormatVersion > exportFormatVersion {
+		return nil, fmt.Errorf("unsupported fixtures format version %d", fixtures.FormatVersion)
+	}
+	if fixtures.Redacted {
+		return nil, fmt.Errorf("fixtures have redacted env values")
+	}
+	return h.importState(ctx, fixtures, dryRun)
+}
+
+// importState applies (or, for a dry run, plans) an export document
+func (h *Handler) importState(ctx context.Context, export models.ControllerExport, dryRun bool) (*models.ImportResult, error) {
+	latest, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*models.Deployment, len(latest))
+	for i := range latest {
+		current[latest[i].Domain+"/"+latest[i].AppName] = &latest[i]
+	}
+
+	registries, err := h.db.ListRegistries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	knownRegistries := make(map[string]bool, len(registries))
+	for _, ref := range registries {
+		knownRegistries[ref.Registry] = true
+	}
+
+	result := &models.ImportResult{
+		DryRun:      dryRun,
+		Deployments: []models.ImportItemResult{},
+		Registries:  []models.ImportItemResult{},
+	}
+	if !dryRun {
+		result.RequestID = uuid.New().String()
+	}
+
+	for _, req := range export.Deployments {
+		item := models.ImportItemResult{Domain: req.Domain, AppName: req.AppName}
+
+		if err := binding.Validator.ValidateStruct(req); err != nil {
+			item.Action = "invalid"
+			item.Error = err.Error()
+		} else if errs := h.validateDeploymentRequest(&req, nil); len(errs) > 0 {
+			item.Action = "invalid"
+			item.Error = errs[0].Field + ": " + errs[0].Message
+		} else if existing, ok := current[req.Domain+"/"+req.AppName]; ok && existing.Matches(req) {
+			item.Action = "unchanged"
+			item.Version = existing.Version
+		} else if dryRun {
+			item.Action = "create"
+		} else if deployment, err := h.db.CreateDeployment(ctx, req, result.RequestID); err != nil {
+			item.Action = "failed"
+			item.Error = err.Error()
+		} else {
+			item.Action = "created"
+			item.Version = deployment.Version
+		}
+
+		result.Deployments = append(result.Deployments, item)
+	}
+
+	for _, ref := range export.Registries {
+		item := models.ImportItemResult{Registry: ref.Registry}
+
+		switch {
+		case ref.Registry == "":
+			item.Action = "invalid"
+			item.Error = "registry is required"
+		case ref.Password == "" && knownRegistries[ref.Registry]:
+			item.Action = "unchanged"
+		case ref.Password == "" || ref.Username == "":
+			item.Action = "skipped"
+			item.Error = "username and password are required to import a new registry credential"
+		case dryRun:
+			item.Action = "store"
+		default:
+			err := h.db.StoreRegistryCredential(ctx, models.RegistryCredentialRequest{
+				Registry: ref.Registry,
+				Username: ref.Username,
+				Password: ref.Password,
+			})
+			if err != nil {
+				item.Action = "failed"
+				item.Error = err.Error()
+			} else {
+				item.Action = "stored"
+			}
+		}
+
+		result.Registries = append(result.Registries, item)
+	}
+
+	return result, nil
+}
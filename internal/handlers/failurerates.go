@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/jobs"
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// failureRateReport computes every app's failure rate over the alert
+// window and the window before it, marking apps whose alert is firing
+func (h *Handler) failureRateReport(ctx context.Context) (models.FailureRateReport, error) {
+	window := h.cfg.Alerts.Window
+	since := h.clock.Now().Add(-window)
+
+	outcomes, err := h.db.ListDeploymentOutcomes(ctx, since.Add(-window))
+	if err != nil {
+		return models.FailureRateReport{}, err
+	}
+	alerts, err := h.db.ListFailureRateAlerts(ctx)
+	if err != nil {
+		return models.FailureRateReport{}, err
+	}
+
+	index := map[[2]string]int{}
+	var apps []models.FailureRate
+	app := func(domain, appName string) *models.FailureRate {
+		key := [2]string{domain, appName}
+		i, ok := index[key]
+		if !ok {
+			i = len(apps)
+			index[key] = i
+			apps = append(apps, models.FailureRate{Domain: domain, AppName: appName})
+		}
+		return &apps[i]
+	}
+
+	previousFailures := map[[2]string]int{}
+	for _, o := range outcomes {
+		if !o.Finished() {
+			continue
+		}
+		rate := app(o.Domain, o.AppName)
+		switch {
+		case !o.CreatedAt.Before(since):
+			rate.Changes++
+			if o.Failed() {
+				rate.Failures++
+			}
+		default:
+			rate.PreviousChanges++
+			if o.Failed() {
+				previousFailures[[2]string{o.Domain, o.AppName}]++
+			}
+		}
+	}
+	for _, alert := range alerts {
+		app(alert.Domain, alert.AppName).FiringSince = &alert.FiringSince
+	}
+
+	for i := range apps {
+		rate := &apps[i]
+		if rate.Changes > 0 {
+			r := float64(rate.Failures) / float64(rate.Changes)
+			rate.FailureRate = &r
+		}
+		if rate.PreviousChanges > 0 {
+			r := float64(previousFailures[[2]string{rate.Domain, rate.AppName}]) / float64(rate.PreviousChanges)
+			rate.PreviousFailureRate = &r
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Domain != apps[j].Domain {
+			return apps[i].Domain < apps[j].Domain
+		}
+		return apps[i].AppName < apps[j].AppName
+	})
+
+	return models.FailureRateReport{
+		Window:         window.String(),
+		Threshold:      h.cfg.Alerts.FailureRateThreshold,
+		MinDeployments: h.cfg.Alerts.MinDeployments,
+		Apps:           apps,
+	}, nil
+}
+
+// breachesThreshold reports whether an app's failure rate should alert
+func (h *Handler) breachesThreshold(rate models.FailureRate) bool {
+	return rate.FailureRate != nil &&
+		rate.Changes >= h.cfg.Alerts.MinDeployments &&
+		*rate.FailureRate >= h.cfg.Alerts.FailureRateThreshold
+}
+
+// RunFailureRateAlerts evaluates every app's failure rate, firing an alert
+// when it crosses alerts.failure_rate_threshold and resolving it once it
+// drops back below. Each transition is logged and posted to
+// alerts.webhook_url; a transition whose notification fails is retried on
+// the next run. The alerts of apps in maintenance keep their state.
+func (h *Handler) RunFailureRateAlerts(ctx context.Context) error {
+	report, err := h.failureRateReport(ctx)
+	if err != nil {
+		return err
+	}
+	maintenance, err := h.maintenanceApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics.DeploymentFailureRate.Reset()
+	metrics.FailureRateAlerts.Reset()
+
+	var firstErr error
+	for _, rate := range report.Apps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if rate.FailureRate != nil {
+			metrics.DeploymentFailureRate.WithLabelValues(rate.Domain, rate.AppName).Set(*rate.FailureRate)
+		}
+
+		var err error
+		firing := rate.FiringSince != nil
+		breach := h.breachesThreshold(rate)
+		switch {
+		case maintenance[[2]string{rate.Domain, rate.AppName}]:
+		case breach && !firing:
+			h.logger.Warn("Deployment failure rate crossed the alert threshold",
+				"domain", rate.Domain,
+				"app_name", rate.AppName,
+				"failure_rate", *rate.FailureRate,
+				"changes", rate.Changes,
+				"threshold", report.Threshold)
+			err = h.notifyFailureRate(ctx, report, rate, models.AlertFiring)
+			if err == nil {
+				err = h.db.FireFailureRateAlert(ctx, rate.Domain, rate.AppName, *rate.FailureRate)
+			}
+			firing = err == nil
+		case breach:
+			err = h.db.FireFailureRateAlert(ctx, rate.Domain, rate.AppName, *rate.FailureRate)
+		case firing:
+			h.logger.Info("Deployment failure rate dropped below the alert threshold",
+				"domain", rate.Domain,
+				"app_name", rate.AppName,
+				"changes", rate.Changes,
+				"threshold", report.Threshold)
+			err = h.notifyFailureRate(ctx, report, rate, models.AlertResolved)
+			if err == nil {
+				err = h.db.ResolveFailureRateAlert(ctx, rate.Domain, rate.AppName)
+			}
+			firing = err != nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s/%s: %w", rate.Domain, rate.AppName, err)
+		}
+
+		if firing {
+			metrics.FailureRateAlerts.WithLabelValues(rate.Domain, rate.AppName).Set(1)
+		} else {
+			metrics.FailureRateAlerts.WithLabelValues(rate.Domain, rate.AppName).Set(0)
+		}
+	}
+	return firstErr
+}
+
+// notifyFailureRate queues an alert transition for delivery to
+// alerts.webhook_url, if set
+func (h *Handler) notifyFailureRate(ctx context.Context, report models.FailureRateReport, rate models.FailureRate, status string) error {
+	url := h.cfg.Alerts.WebhookURL
+	if url == "" {
+		return nil
+	}
+
+	notification := models.FailureRateNotification{
+		Event:     "deployment_failure_rate",
+		Status:    status,
+		Domain:    rate.Domain,
+		AppName:   rate.AppName,
+		Changes:   rate.Changes,
+		Failures:  rate.Failures,
+		Threshold: report.Threshold,
+		Window:    report.Window,
+		At:        h.clock.Now().UTC(),
+	}
+	if rate.FailureRate != nil {
+		notification.FailureRate = *rate.FailureRate
+	}
+	return h.enqueueWebhook(ctx, url, notification)
+}
+
+// webhookJobPayload is the payload stored for webhook delivery jobs
+type webhookJobPayload struct {
+	URL          string          `json:"url"`
+	Notification json.RawMessage `json:"notification"`
+}
+
+// enqueueWebhook queues a notification for delivery to url by the worker
+// pool, which retries it with a backoff until it is delivered or
+// dead-lettered
+func (h *Handler) enqueueWebhook(ctx context.Context, url string, notification any) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(webhookJobPayload{URL: url, Notification: body})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook job: %w", err)
+	}
+
+	if _, err := h.db.EnqueueJob(ctx, models.JobTypeWebhook, models.PriorityNormal, payload, 1); err != nil {
+		return fmt.Errorf("failed to queue webhook: %w", err)
+	}
+	return nil
+}
+
+// RunWebhookJob is the worker pool handler for webhook deliveries
+func (h *Handler) RunWebhookJob(ctx context.Context, job *models.Job, progress jobs.ProgressFunc) (interface{}, error) {
+	var payload webhookJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid webhook job payload: %w", err)
+	}
+	return nil, postWebhook(ctx, payload.URL, payload.Notification)
+}
+
+// postWebhook posts a notification as JSON to url
+func postWebhook(ctx context.Context, url string, notification any) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// GetFailureRates handles GET /api/v1/analytics/failure-rates?alerting=true
+// - every app's rolling deployment failure rate against the alert
+// threshold, optionally only the apps whose alert is firing
+func (h *Handler) GetFailureRates(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	alertingOnly := c.Query("alerting") == "true"
+
+	report, err := h.failureRateReport(ctx)
+	if err != nil {
+		h.logger.Error("Failed to compute failure rates", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get failure rates")
+		return
+	}
+
+	if alertingOnly {
+		firing := []models.FailureRate{}
+		for _, rate := range report.Apps {
+			if rate.FiringSince != nil {
+				firing = append(firing, rate)
+			}
+		}
+		report.Apps = firing
+	}
+	if report.Apps == nil {
+		report.Apps = []models.FailureRate{}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
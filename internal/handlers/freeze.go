@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// frozenMessage is the error returned for writes rejected by a freeze
+func frozenMessage(freeze *models.WriteFreeze) string {
+	if freeze.Reason == "" {
+		return "Deployments are frozen"
+	}
+	return "Deployments are frozen: " + freeze.Reason
+}
+
+// rejectFrozen responds 503 and returns true when new deployments are
+// frozen, so write endpoints can bail out before doing any work
+func (h *Handler) rejectFrozen(ctx context.Context, c *gin.Context) bool {
+	freeze, err := h.db.GetWriteFreeze(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get write freeze", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to check write freeze")
+		return true
+	}
+	if !freeze.Enabled {
+		return false
+	}
+
+	h.logger.Warn("Rejected write during freeze",
+		"path", c.FullPath(),
+		"reason", freeze.Reason,
+		"actor", c.GetString(ActorKey))
+	RespondError(c, http.StatusServiceUnavailable, frozenMessage(freeze))
+	return true
+}
+
+// frozen reports whether new deployments are frozen, for background work
+// that creates them to skip its run
+func (h *Handler) frozen(ctx context.Context) (bool, error) {
+	freeze, err := h.db.GetWriteFreeze(ctx)
+	if err != nil {
+		return false, err
+	}
+	return freeze.Enabled, nil
+}
+
+// GetWriteFreeze handles GET /api/v1/admin/freeze - whether new deployments
+// are frozen
+func (h *Handler) GetWriteFreeze(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	freeze, err := h.db.GetWriteFreeze(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get write freeze", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get write freeze")
+		return
+	}
+
+	c.Header("ETag", freeze.ETag())
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    freeze,
+	})
+}
+
+// SetWriteFreeze handles PATCH /api/v1/admin/freeze - freezing new
+// deployments server-wide, or lifting the freeze, conditional on If-Match
+func (h *Handler) SetWriteFreeze(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	ifMatch, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.MaintenanceRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid write freeze request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if !*req.Enabled && req.Reason != "" {
+		RespondValidationError(c, "Invalid write freeze request", []models.FieldError{{Field: "reason", Message: "is only used when enabling the freeze"}})
+		return
+	}
+
+	actor := c.GetString(ActorKey)
+	freeze := &models.WriteFreeze{}
+	message := "Write freeze lifted"
+	var err error
+	if *req.Enabled {
+		freeze, err = h.db.StartWriteFreeze(ctx, models.WriteFreeze{
+			Reason:    req.Reason,
+			StartedBy: actor,
+		}, ifMatch)
+		message = "Write freeze started"
+	} else {
+		err = h.db.EndWriteFreeze(ctx, ifMatch)
+	}
+	if err != nil {
+		h.logger.Error("Failed to set write freeze", "error", err)
+		if err.Error() == "precondition failed" {
+			RespondError(c, http.StatusPreconditionFailed, "Write freeze was changed concurrently; refetch and retry")
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to set write freeze")
+		return
+	}
+
+	h.logger.Info(message,
+		"reason", req.Reason,
+		"actor", actor)
+
+	c.Header("ETag", freeze.ETag())
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    freeze,
+	})
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/jobs"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gitSyncTimeout bounds one fetch and apply of the git branch
+const gitSyncTimeout = 5 * time.Minute
+
+// gitSyncLock is the advisory lock held by the periodic git sync worker (see
+// database.Exclusive); triggered syncs take it too so runs never overlap
+const gitSyncLock = "task:git-sync"
+
+// RunGitSync pulls the configured branch and pushes every deployment that
+// differs from its app's latest version, recording the outcome; it is run
+// periodically by the git sync worker. It does nothing while deployments
+// are frozen.
+func (h *Handler) RunGitSync(ctx context.Context) error {
+	if frozen, err := h.frozen(ctx); err != nil || frozen {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitSyncTimeout)
+	defer cancel()
+
+	status := models.GitSyncStatus{
+		Branch:      h.git.Branch(),
+		Deployments: []models.ImportItemResult{},
+	}
+	err := h.syncGit(ctx, &status)
+	status.SyncedAt = h.clock.Now().UTC()
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	// Record the outcome even if we are shutting down
+	recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancelRecord()
+	if recordErr := h.db.RecordGitSync(recordCtx, status); recordErr != nil {
+		h.logger.Error("Failed to record git sync", "error", recordErr, "branch", status.Branch)
+	}
+
+	return err
+}
+
+// syncGit pulls the branch and applies its deployments, filling in status
+func (h *Handler) syncGit(ctx context.Context, status *models.GitSyncStatus) error {
+	commit, err := h.git.Pull(ctx)
+	if err != nil {
+		return err
+	}
+	status.Commit = commit
+
+	reqs, err := h.git.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load deployments at %s: %w", commit, err)
+	}
+	status.Declared = reqs
+
+	result, err := h.importState(ctx, models.ControllerExport{Deployments: reqs}, false)
+	if err != nil {
+		return fmt.Errorf("failed to apply deployments at %s: %w", commit, err)
+	}
+	status.Deployments = result.Deployments
+
+	counts := map[string]int{}
+	for _, item := range result.Deployments {
+		counts[item.Action]++
+	}
+	if counts["created"] > 0 || counts["invalid"] > 0 || counts["failed"] > 0 {
+		h.logger.Info("Applied git sync",
+			"branch", status.Branch,
+			"commit", commit,
+			"request_id", result.RequestID,
+			"created", counts["created"],
+			"unchanged", counts["unchanged"],
+			"invalid", counts["invalid"],
+			"failed", counts["failed"])
+	}
+
+	return nil
+}
+
+// GetGitSync handles GET /api/v1/git-sync - the outcome of the latest sync
+// of the configured branch
+func (h *Handler) GetGitSync(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.git == nil {
+		RespondError(c, http.StatusNotFound, "Git sync is not configured")
+		return
+	}
+
+	status, err := h.db.GetGitSync(ctx, h.git.Branch())
+	if err != nil {
+		h.logger.Error("Failed to get git sync", "error", err, "branch", h.git.Branch())
+
+		if err.Error() == "git sync not found" {
+			RespondError(c, http.StatusNotFound, "Git sync has not run yet")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get git sync")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// Reconcile handles POST /api/v1/reconcile - runs a git sync now and returns
+// its outcome
+func (h *Handler) Reconcile(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), gitSyncTimeout)
+	defer cancel()
+
+	if h.git == nil {
+		RespondError(c, http.StatusNotFound, "Git sync is not configured")
+		return
+	}
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	ran, err := h.db.WithLock(ctx, gitSyncLock, h.RunGitSync)
+	if !ran && err == nil {
+		RespondError(c, http.StatusConflict, "Git sync is already running")
+		return
+	}
+
+	status, getErr := h.db.GetGitSync(ctx, h.git.Branch())
+	if getErr != nil {
+		h.logger.Error("Failed to get git sync", "error", getErr, "branch", h.git.Branch())
+		RespondError(c, http.StatusInternalServerError, "Failed to get git sync")
+		return
+	}
+
+	h.logger.Info("Reconciled git sync",
+		"branch", status.Branch,
+		"commit", status.Commit,
+		"error", status.Error,
+		"actor", c.GetString(ActorKey))
+
+	if err != nil {
+		RespondErrorWithData(c, http.StatusBadGateway, "Git sync failed: "+err.Error(), status)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Git sync completed",
+		Data:    status,
+	})
+}
+
+// verifyGitWebhook checks a push webhook against the configured secret,
+// accepting a GitHub HMAC signature or a GitLab token
+func verifyGitWebhook(c *gin.Context, secret string, body []byte) bool {
+	if signature := c.GetHeader("X-Hub-Signature-256"); signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+
+	if token := c.GetHeader("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	return false
+}
+
+// RunGitSyncJob is the worker pool handler for git syncs requested by a push
+// webhook. While another sync runs it fails, so the job is retried after a
+// backoff rather than the push left to a sync that may have fetched before
+// it.
+func (h *Handler) RunGitSyncJob(ctx context.Context, job *models.Job, progress jobs.ProgressFunc) (interface{}, error) {
+	if h.git == nil {
+		return nil, fmt.Errorf("git sync is not configured")
+	}
+
+	ran, err := h.db.WithLock(ctx, gitSyncLock, h.RunGitSync)
+	if err != nil {
+		return nil, err
+	}
+	if !ran {
+		return nil, fmt.Errorf("a git sync is already running")
+	}
+	return nil, nil
+}
+
+// GitWebhook handles POST /api/v1/webhooks/git - a push webhook from GitHub
+// or GitLab that queues a git sync job when the synced branch changes. It is
+// authenticated by git_sync.webhook_secret rather than the bearer token.
+func (h *Handler) GitWebhook(c *gin.Context) {
+	if h.git == nil || h.cfg.GitSync.WebhookSecret == "" {
+		RespondError(c, http.StatusNotFound, "Git webhook is not configured")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	if !verifyGitWebhook(c, h.cfg.GitSync.WebhookSecret, body) {
+		h.logger.Warn("Rejected git webhook with an invalid signature", "ip", c.ClientIP())
+		RespondError(c, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	// Pings and pushes to other branches carry no ref or another ref
+	var event struct {
+		Ref string `json:"ref"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+	if event.Ref != "refs/heads/"+h.git.Branch() {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Ignored event for another ref",
+		})
+		return
+	}
+	if h.rejectFrozen(c.Request.Context(), c) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	job, err := h.db.EnqueueJob(ctx, models.JobTypeGitSync, models.PriorityNormal, nil, 1)
+	if err != nil {
+		h.logger.Error("Failed to queue webhook git sync", "error", err, "branch", h.git.Branch())
+		RespondError(c, http.StatusInternalServerError, "Failed to queue git sync")
+		return
+	}
+	h.logger.Info("Queued webhook git sync", "job_id", job.ID, "branch", h.git.Branch())
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Git sync queued",
+		Data: map[string]interface{}{
+			"job_id": job.ID,
+			"_links": models.Links{
+				"job": {Href: jobsPath + "/" + job.ID.String()},
+			},
+		},
+	})
+}
+
+// addDrift sets the drift of each deployment against its app's declaration
+// at the last git sync. It must run before redaction, which would make
+// every env look changed.
+func (h *Handler) addDrift(ctx context.Context, deployments ...*models.Deployment) {
+	if h.git == nil {
+		return
+	}
+
+	declared := map[string]models.DeploymentRequest{}
+	status, err := h.db.GetGitSync(ctx, h.git.Branch())
+	if err != nil && err.Error() != "git sync not found" {
+		h.logger.Error("Failed to get git sync for drift", "error", err, "branch", h.git.Branch())
+	}
+	if status != nil {
+		for _, req := range status.Declared {
+			declared[req.Domain+"/"+req.AppName] = req
+		}
+	}
+
+	for _, d := range deployments {
+		req, ok := declared[d.Domain+"/"+d.AppName]
+		switch {
+		case !ok:
+			d.Drift = models.DriftUnknown
+		case d.Matches(req):
+			d.Drift = models.DriftInSync
+		default:
+			d.Drift = models.DriftDrifted
+		}
+	}
+}
+
+// addDriftAll sets the drift of every deployment in a slice
+func (h *Handler) addDriftAll(ctx context.Context, deployments []models.Deployment) {
+	ptrs := make([]*models.Deployment, len(deployments))
+	for i := range deployments {
+		ptrs[i] = &deployments[i]
+	}
+	h.addDrift(ctx, ptrs...)
+}
@@ -4,111 +4,166 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"runtime"
+	"slices"
+	"sync/atomic"
 	"time"
 
+	"deployment-controller/internal/auth"
+	"deployment-controller/internal/awssecrets"
+	"deployment-controller/internal/blobstore"
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/config"
 	"deployment-controller/internal/database"
+	"deployment-controller/internal/gitsync"
+	"deployment-controller/internal/kms"
+	"deployment-controller/internal/leader"
+	"deployment-controller/internal/logstream"
 	"deployment-controller/internal/models"
+	"deployment-controller/internal/redact"
+	"deployment-controller/internal/registry"
+	"deployment-controller/internal/secrets"
+	"deployment-controller/internal/vault"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// Version is the version of the controller reported by /healthz and
+// /api/v1/version
+const Version = "1.0.0"
+
 type Handler struct {
-	db     *database.DB
+	db     database.Store
 	logger *slog.Logger
+	cfg    *config.Config
+
+	// clock tells the time for expiry, scheduling and timestamps
+	clock clock.Clock
+
+	// cipher encrypts secret values; nil when no encryption key is configured
+	cipher *secrets.Cipher
+
+	// kms wraps data keys for envelope encryption; nil when not configured
+	kms kms.Wrapper
+
+	// sealer opens values sealed to the controller's public key; nil when no
+	// sealing key is configured
+	sealer *secrets.Sealer
+
+	// vault mints agent tokens in vault agent mode; nil when not configured
+	vault *vault.Client
+
+	// redactor masks sensitive env values in responses
+	redactor *redact.Redactor
+
+	// resolvers resolve secret references to external stores by scheme
+	resolvers secrets.Resolvers
+
+	// git pulls deployment YAMLs for git sync; nil when not configured
+	git *gitsync.Repo
+
+	// registry queries image registries for image policies
+	registry *registry.Client
+
+	// blobs archives logs, pruned versions and exports; nil when no blob
+	// store is configured
+	blobs blobstore.Store
+
+	// elector reports leadership; nil until SetElector is called
+	elector *leader.Elector
+
+	// logs wakes deployment log streams; nil until SetLogHub is called, in
+	// which case streams only poll
+	logs *logstream.Hub
+
+	// tokens are the accepted bearer tokens; nil until SetTokens is called
+	tokens *auth.Tokens
+
+	// draining is set once shutdown begins
+	draining atomic.Bool
 }
 
 // New creates a new handler instance
-func New(db *database.DB, logger *slog.Logger) *Handler {
-	return &Handler{
-		db:     db,
-		logger: logger,
+func New(db database.Store, logger *slog.Logger, cfg *config.Config) *Handler {
+	cipher, kmsWrapper, err := newSecretsCipher(context.Background(), cfg.Security)
+	if err != nil {
+		logger.Warn("Secrets API disabled", "error", err)
 	}
-}
 
-// Push handles POST /api/v1/push - receives deployment changes
-func (h *Handler) Push(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
-	defer cancel()
+	var sealer *secrets.Sealer
+	if cfg.Security.SealingKey != "" {
+		if sealer, err = secrets.NewSealer(cfg.Security.SealingKey); err != nil {
+			logger.Warn("Sealed values disabled", "error", err)
+		}
+	}
 
-	var deploymentRequests models.DeploymentPushRequest
-	if err := c.ShouldBindJSON(&deploymentRequests); err != nil {
-		h.logger.Error("Invalid request body", "error", err)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
-		return
+	h := &Handler{
+		db:        db,
+		logger:    logger,
+		cfg:       cfg,
+		clock:     clock.Real,
+		cipher:    cipher,
+		kms:       kmsWrapper,
+		sealer:    sealer,
+		redactor:  redact.New(cfg.Security.RedactPatterns),
+		vault:     vault.New(cfg.Vault),
+		registry:  registry.New(cfg.Registry),
+		resolvers: secrets.Resolvers{},
 	}
 
-	if len(deploymentRequests) == 0 {
-		h.logger.Error("Empty deployment request")
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "At least one deployment is required",
-		})
-		return
+	if h.vault != nil {
+		h.resolvers["vault"] = h.vault
 	}
 
-	// Generate a unique request ID for this batch
-	requestID := uuid.New().String()
-	h.logger.Info("Processing deployment push",
-		"request_id", requestID,
-		"count", len(deploymentRequests))
+	if cfg.Features.Enabled(config.FeatureGitOps) {
+		h.git = gitsync.New(cfg.GitSync)
+	}
 
-	var createdDeployments []models.Deployment
-	var failedDeployments []map[string]interface{}
+	if h.blobs, err = blobstore.New(context.Background(), cfg.BlobStore); err != nil {
+		logger.Warn("Blob store disabled", "error", err)
+	}
 
-	// Process each deployment request
-	for i, req := range deploymentRequests {
-		deployment, err := h.db.CreateDeployment(ctx, req, requestID)
+	if cfg.AWS.SecretsManager || cfg.AWS.ParameterStore {
+		awsCfg, err := awssecrets.LoadConfig(context.Background(), cfg.AWS.Region)
 		if err != nil {
-			h.logger.Error("Failed to create deployment",
-				"error", err,
-				"domain", req.Domain,
-				"app_name", req.AppName)
-
-			failedDeployments = append(failedDeployments, map[string]interface{}{
-				"index":    i,
-				"domain":   req.Domain,
-				"app_name": req.AppName,
-				"error":    err.Error(),
-			})
-			continue
+			logger.Warn("AWS secret resolvers disabled", "error", err)
+		} else {
+			if cfg.AWS.SecretsManager {
+				h.resolvers[awssecrets.SecretsManagerScheme] = secrets.NewCachingResolver(
+					awssecrets.NewSecretsManagerResolver(awsCfg), cfg.AWS.CacheTTL, h.clock)
+			}
+			if cfg.AWS.ParameterStore {
+				h.resolvers[awssecrets.ParameterStoreScheme] = secrets.NewCachingResolver(
+					awssecrets.NewParameterStoreResolver(awsCfg), cfg.AWS.CacheTTL, h.clock)
+			}
 		}
-
-		createdDeployments = append(createdDeployments, *deployment)
-		h.logger.Info("Created deployment",
-			"deployment_id", deployment.ID,
-			"domain", deployment.Domain,
-			"app_name", deployment.AppName,
-			"version", deployment.Version)
 	}
 
-	// Prepare response
-	responseData := map[string]interface{}{
-		"request_id":          requestID,
-		"processed_count":     len(createdDeployments),
-		"failed_count":        len(failedDeployments),
-		"created_deployments": createdDeployments,
-	}
+	return h
+}
 
-	if len(failedDeployments) > 0 {
-		responseData["failed_deployments"] = failedDeployments
+// SetClock sets the clock used for expiry, scheduling and timestamps
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = c
+	if h.vault != nil {
+		h.vault.SetClock(c)
 	}
+}
 
-	statusCode := http.StatusCreated
-	if len(failedDeployments) > 0 && len(createdDeployments) == 0 {
-		statusCode = http.StatusBadRequest
-	} else if len(failedDeployments) > 0 {
-		statusCode = http.StatusPartialContent
-	}
+// SetElector sets the leader elector reported by the admin endpoints
+func (h *Handler) SetElector(elector *leader.Elector) {
+	h.elector = elector
+}
 
-	c.JSON(statusCode, models.APIResponse{
-		Success: len(createdDeployments) > 0,
-		Message: "Deployment push processed",
-		Data:    responseData,
-	})
+// SetTokens sets the token store reloaded by the admin endpoints
+func (h *Handler) SetTokens(tokens *auth.Tokens) {
+	h.tokens = tokens
+}
+
+// SetLogHub sets the hub that wakes deployment log streams on uploads
+func (h *Handler) SetLogHub(hub *logstream.Hub) {
+	h.logs = hub
 }
 
 // StoreRegistryCredential handles POST /api/v1/registry
@@ -117,12 +172,9 @@ func (h *Handler) StoreRegistryCredential(c *gin.Context) {
 	defer cancel()
 
 	var req models.RegistryCredentialRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := h.bindJSON(c, &req); err != nil {
 		h.logger.Error("Invalid registry credential request", "error", err)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 
@@ -130,10 +182,7 @@ func (h *Handler) StoreRegistryCredential(c *gin.Context) {
 		h.logger.Error("Failed to store registry credential",
 			"error", err,
 			"registry", req.Registry)
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to store registry credential",
-		})
+		RespondError(c, http.StatusInternalServerError, "Failed to store registry credential")
 		return
 	}
 
@@ -152,10 +201,7 @@ func (h *Handler) GetRegistryCredential(c *gin.Context) {
 	registry := c.Query("registry")
 	if registry == "" {
 		h.logger.Error("Missing registry parameter")
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "registry parameter is required",
-		})
+		RespondError(c, http.StatusBadRequest, "registry parameter is required")
 		return
 	}
 
@@ -166,20 +212,19 @@ func (h *Handler) GetRegistryCredential(c *gin.Context) {
 			"registry", registry)
 
 		if err.Error() == "registry credential not found" {
-			c.JSON(http.StatusNotFound, models.APIResponse{
-				Success: false,
-				Error:   "Registry credential not found",
-			})
+			RespondError(c, http.StatusNotFound, "Registry credential not found")
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to get registry credential",
-		})
+		RespondError(c, http.StatusInternalServerError, "Failed to get registry credential")
 		return
 	}
 
+	h.recordAudit(ctx, c, []models.AuditEvent{{
+		Action:   models.AuditRegistryRead,
+		Resource: registryResource(registry),
+	}})
+
 	h.logger.Info("Retrieved registry credential", "registry", registry)
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -192,16 +237,39 @@ func (h *Handler) GetDeployments(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
+	rng, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	metadata, ok := parseMetadataFilter(c)
+	if !ok {
+		return
+	}
+
 	deployments, err := h.db.GetLatestDeployments(ctx)
 	if err != nil {
 		h.logger.Error("Failed to get deployments", "error", err)
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to get deployments",
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployments")
+		return
+	}
+	if !rng.IsZero() || len(metadata) > 0 {
+		// The latest deployments are cached, so filter them here
+		deployments = slices.DeleteFunc(deployments, func(d models.Deployment) bool {
+			return !rng.Contains(d) || !metadata.Matches(d.Metadata)
 		})
+	}
+
+	h.addDriftAll(ctx, deployments)
+	h.addHealthAll(ctx, deployments)
+	h.redactDeployments(c, deployments)
+	if wantsCSV(c) {
+		if err := writeDeploymentsCSV(c, "deployments.csv", deployments); err != nil {
+			h.logger.Error("Failed to write deployments CSV", "error", err)
+		}
 		return
 	}
 
+	addLinksAll(deployments)
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Data:    deployments,
@@ -217,10 +285,7 @@ func (h *Handler) GetDeployment(c *gin.Context) {
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid deployment ID",
-		})
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
 		return
 	}
 
@@ -229,26 +294,87 @@ func (h *Handler) GetDeployment(c *gin.Context) {
 		h.logger.Error("Failed to get deployment", "error", err, "id", id)
 
 		if err.Error() == "deployment not found" {
-			c.JSON(http.StatusNotFound, models.APIResponse{
-				Success: false,
-				Error:   "Deployment not found",
-			})
+			RespondError(c, http.StatusNotFound, "Deployment not found")
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to get deployment",
-		})
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment")
+		return
+	}
+
+	etag := deployment.ETag()
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
+	h.addDrift(ctx, deployment)
+	h.redactDeployment(c, deployment)
+	addLinks(deployment)
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Data:    deployment,
 	})
 }
 
+// GetDeploymentHistory handles GET /api/v1/deployments/:id/history
+func (h *Handler) GetDeploymentHistory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	cursor, limit, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+	rng, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	metadata, ok := parseMetadataFilter(c)
+	if !ok {
+		return
+	}
+
+	deployment, err := h.db.GetDeployment(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment")
+		return
+	}
+
+	history, err := h.db.GetDeploymentHistory(ctx, deployment.Domain, deployment.AppName, rng, metadata, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("Failed to get deployment history", "error", err, "id", id)
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment history")
+		return
+	}
+
+	history, pagination := paginateDeployments(history, limit)
+	h.addDriftAll(ctx, history)
+	h.redactDeployments(c, history)
+	addLinksAll(history)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success:    true,
+		Data:       history,
+		Pagination: pagination,
+	})
+}
+
 // UpdateDeploymentStatus handles PATCH /api/v1/deployments/:id/status
 func (h *Handler) UpdateDeploymentStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
@@ -258,23 +384,19 @@ func (h *Handler) UpdateDeploymentStatus(c *gin.Context) {
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid deployment ID",
-		})
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
 		return
 	}
 
-	var req struct {
-		Status string `json:"status" binding:"required"`
+	ifMatch, ok := requireIfMatch(c)
+	if !ok {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req models.StatusUpdateRequest
+	if err := h.bindJSON(c, &req); err != nil {
 		h.logger.Error("Invalid status update request", "error", err)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 
@@ -289,74 +411,180 @@ func (h *Handler) UpdateDeploymentStatus(c *gin.Context) {
 
 	if !validStatuses[req.Status] {
 		h.logger.Error("Invalid status", "status", req.Status)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "Invalid status. Must be one of: pending, deploying, deployed, failed, rolled_back",
-		})
+		RespondError(c, http.StatusBadRequest, "Invalid status. Must be one of: pending, deploying, deployed, failed, rolled_back")
+		return
+	}
+
+	failure, errs := validateFailure(&req)
+	errs = append(errs, validateImageDigest(&req)...)
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid status update", errs)
 		return
 	}
 
 	var deployedAt *time.Time
 	if req.Status == "deployed" {
-		now := time.Now()
+		now := h.clock.Now()
 		deployedAt = &now
 	}
 
-	if err := h.db.UpdateDeploymentStatus(ctx, id, req.Status, deployedAt); err != nil {
+	deployment, err := h.db.UpdateDeploymentStatus(ctx, id, req.Status, failure, deployedAt, ifMatch)
+	if err != nil {
 		h.logger.Error("Failed to update deployment status",
 			"error", err,
 			"id", id,
 			"status", req.Status)
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to update deployment status",
-		})
+
+		switch err.Error() {
+		case "deployment not found":
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+		case "precondition failed":
+			RespondError(c, http.StatusPreconditionFailed, "Deployment was modified concurrently; refetch and retry")
+		default:
+			RespondError(c, http.StatusInternalServerError, "Failed to update deployment status")
+		}
 		return
 	}
 
 	h.logger.Info("Updated deployment status",
 		"id", id,
-		"status", req.Status)
+		"status", req.Status,
+		"error_code", req.ErrorCode)
+
+	if req.Status == "deployed" {
+		h.recordDeployedDigest(ctx, deployment, req.ImageDigest)
+	}
 
+	c.Header("ETag", deployment.ETag())
+	h.redactDeployment(c, deployment)
+	addLinks(deployment)
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Deployment status updated successfully",
+		Data:    deployment,
 	})
 }
 
-// GetStats handles GET /api/v1/stats
+// DeleteDeployment handles DELETE /api/v1/deployments/:id, purging one
+// version with its logs, events, checks and retry state
+func (h *Handler) DeleteDeployment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	ifMatch, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteDeployment(ctx, id, ifMatch); err != nil {
+		h.logger.Error("Failed to delete deployment", "error", err, "id", id)
+
+		switch err.Error() {
+		case "deployment not found":
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+		case "precondition failed":
+			RespondError(c, http.StatusPreconditionFailed, "Deployment was modified concurrently; refetch and retry")
+		default:
+			RespondError(c, http.StatusInternalServerError, "Failed to delete deployment")
+		}
+		return
+	}
+
+	h.logger.Info("Deleted deployment", "id", id)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Deployment deleted successfully",
+	})
+}
+
+// GetStats handles GET /api/v1/stats?group_by=app_name|domain - the global
+// counters with a breakdown per app (the default) or per domain
 func (h *Handler) GetStats(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	stats, err := h.db.GetDeploymentStats(ctx)
+	groupBy := c.DefaultQuery("group_by", models.StatsByApp)
+	if groupBy != models.StatsByApp && groupBy != models.StatsByDomain {
+		RespondValidationError(c, "Invalid stats query", []models.FieldError{{Field: "group_by", Message: "must be app_name or domain"}})
+		return
+	}
+	rng, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.db.GetDeploymentStats(ctx, rng)
 	if err != nil {
 		h.logger.Error("Failed to get deployment stats", "error", err)
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to get deployment stats",
-		})
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment stats")
 		return
 	}
 
+	if groupBy == models.StatsByDomain {
+		stats.Breakdown = statsByDomain(stats.Breakdown)
+	}
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Data:    stats,
 	})
 }
 
+// statsByDomain sums per-app stats, ordered by domain, into per-domain
+// stats
+func statsByDomain(apps []models.StatsGroup) []models.StatsGroup {
+	domains := []models.StatsGroup{}
+	for _, app := range apps {
+		if len(domains) == 0 || domains[len(domains)-1].Domain != app.Domain {
+			domains = append(domains, models.StatsGroup{Domain: app.Domain})
+		}
+		group := &domains[len(domains)-1]
+		group.TotalDeployments += app.TotalDeployments
+		group.PendingCount += app.PendingCount
+		group.DeployedCount += app.DeployedCount
+		group.FailedCount += app.FailedCount
+		group.Versions += app.Versions
+		if app.LastDeployedAt != nil && (group.LastDeployedAt == nil || app.LastDeployedAt.After(*group.LastDeployedAt)) {
+			group.LastDeployedAt = app.LastDeployedAt
+		}
+	}
+	return domains
+}
+
+// StartDrain marks the instance as shutting down: health checks fail from
+// now on and long-lived requests are turned away with a retry hint
+func (h *Handler) StartDrain() {
+	h.draining.Store(true)
+}
+
+// IsDraining reports whether StartDrain has been called
+func (h *Handler) IsDraining() bool {
+	return h.draining.Load()
+}
+
 // HealthCheck handles GET /healthz
 func (h *Handler) HealthCheck(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
+	// Fail while draining so load balancers stop routing to this instance
+	if h.IsDraining() {
+		RespondError(c, http.StatusServiceUnavailable, "Service is shutting down")
+		return
+	}
+
 	// Test database connection
-	if err := h.db.Pool.Ping(ctx); err != nil {
+	if err := h.db.Ping(ctx); err != nil {
 		h.logger.Error("Database health check failed", "error", err)
-		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
-			Success: false,
-			Error:   "Database connection failed",
-		})
+		RespondError(c, http.StatusServiceUnavailable, "Database connection failed")
 		return
 	}
 
@@ -364,8 +592,26 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 		Success: true,
 		Message: "Service is healthy",
 		Data: map[string]interface{}{
-			"timestamp": time.Now().UTC().Format(time.RFC3339),
-			"version":   "1.0.0",
+			"timestamp": h.clock.Now().UTC().Format(time.RFC3339),
+			"version":   Version,
 		},
 	})
 }
+
+// GetVersion handles GET /api/v1/version - the running version and which
+// features are on
+func (h *Handler) GetVersion(c *gin.Context) {
+	info := models.VersionInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		Features:  map[string]bool{},
+	}
+	for feature, enabled := range h.cfg.Features.All() {
+		info.Features[string(feature)] = enabled
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    info,
+	})
+}
@@ -1,24 +1,104 @@
 package handlers
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/gitsync"
+	"deployment-controller/internal/logstream"
+	"deployment-controller/internal/memstore"
 	"deployment-controller/internal/models"
+	"deployment-controller/internal/redact"
+	"deployment-controller/internal/registry"
+	"deployment-controller/internal/secrets"
 
 	"log/slog"
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// MockDB is a mock database for testing
-type MockDB struct{}
+// MockDB is a mock database for testing. Methods not overridden here
+// fall through to the nil embedded Store and panic if called.
+type MockDB struct {
+	database.Store
+	idempotency map[string]*models.IdempotencyRecord
+	secrets     map[string][]byte
+	audit       []models.AuditEvent
+	snapshots   []models.ManifestSnapshot
+	freeze      *models.WriteFreeze
+	pushes      map[string]models.PushRequest
 
-func (m *MockDB) CreateDeployment(ctx interface{}, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
+	// queued records the jobs enqueued, for tests to run them
+	mu     sync.Mutex
+	queued []models.Job
+}
+
+func (m *MockDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MockDB) GetWriteFreeze(ctx context.Context) (*models.WriteFreeze, error) {
+	if m.freeze == nil {
+		return &models.WriteFreeze{}, nil
+	}
+	freeze := *m.freeze
+	return &freeze, nil
+}
+
+func (m *MockDB) checkWriteFreeze(ctx context.Context, ifMatch []string) error {
+	current, _ := m.GetWriteFreeze(ctx)
+	if ifMatch != nil && !slices.Contains(ifMatch, current.ETag()) {
+		return fmt.Errorf("precondition failed")
+	}
+	return nil
+}
+
+func (m *MockDB) StartWriteFreeze(ctx context.Context, freeze models.WriteFreeze, ifMatch []string) (*models.WriteFreeze, error) {
+	if err := m.checkWriteFreeze(ctx, ifMatch); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	freeze.Enabled = true
+	freeze.StartedAt = &now
+	m.freeze = &freeze
+	return m.GetWriteFreeze(ctx)
+}
+
+func (m *MockDB) EndWriteFreeze(ctx context.Context, ifMatch []string) error {
+	if err := m.checkWriteFreeze(ctx, ifMatch); err != nil {
+		return err
+	}
+	m.freeze = nil
+	return nil
+}
+
+func (m *MockDB) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
 	// Mock implementation
 	return &models.Deployment{
 		Domain:    req.Domain,
@@ -26,23 +106,503 @@ func (m *MockDB) CreateDeployment(ctx interface{}, req models.DeploymentRequest,
 		RequestID: requestID,
 		Version:   1,
 		Status:    "pending",
+		BuildInfo: req.BuildInfo,
+	}, nil
+}
+
+func (m *MockDB) RecordPushRequest(ctx context.Context, req models.PushRequest) error {
+	if m.pushes == nil {
+		m.pushes = map[string]models.PushRequest{}
+	}
+	m.pushes[req.RequestID] = req
+	return nil
+}
+
+func (m *MockDB) GetPushRequest(ctx context.Context, requestID string) (*models.PushRequest, error) {
+	req, ok := m.pushes[requestID]
+	if !ok {
+		return nil, fmt.Errorf("push request not found")
+	}
+	return &req, nil
+}
+
+// CreateDeploymentBatch fails the whole batch when any app is named "fail-app"
+func (m *MockDB) CreateDeploymentBatch(ctx context.Context, reqs models.DeploymentPushRequest, requestID string, skipUnchanged bool) ([]models.Deployment, error) {
+	var deployments []models.Deployment
+	for i, req := range reqs {
+		if req.AppName == "fail-app" {
+			return nil, &database.BatchItemError{Index: i, Err: fmt.Errorf("failed to insert deployment")}
+		}
+		deployment, _ := m.CreateDeployment(ctx, req, requestID)
+		deployments = append(deployments, *deployment)
+	}
+	return deployments, nil
+}
+
+func (m *MockDB) CreateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	if m.secrets == nil {
+		m.secrets = map[string][]byte{}
+	}
+	if _, ok := m.secrets[project+"/"+name]; ok {
+		return nil, fmt.Errorf("secret already exists")
+	}
+
+	m.secrets[project+"/"+name] = value
+	return &models.Secret{Project: project, Name: name, Version: 1}, nil
+}
+
+func (m *MockDB) UpdateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	if _, ok := m.secrets[project+"/"+name]; !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	m.secrets[project+"/"+name] = value
+	return &models.Secret{Project: project, Name: name, Version: 2}, nil
+}
+
+func (m *MockDB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
+	if id == missingDeploymentID {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	return &models.Deployment{
+		ID:      id,
+		Domain:  "test.com",
+		AppName: "test-app",
+		Env:     []string{"MODE=prod", "DB_PASS=${secret:payments/db-pass}"},
+		Version: 1,
+		Status:  "pending",
+	}, nil
+}
+
+func (m *MockDB) GetSecretValue(ctx context.Context, project, name string, version int) ([]byte, error) {
+	value, ok := m.secrets[project+"/"+name]
+	if !ok || version > 1 {
+		return nil, fmt.Errorf("secret not found")
+	}
+	return value, nil
+}
+
+func (m *MockDB) RecordAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	m.audit = append(m.audit, events...)
+	return nil
+}
+
+func (m *MockDB) SetDeploymentSecretError(ctx context.Context, id uuid.UUID, message string) error {
+	return nil
+}
+
+func (m *MockDB) SetDeploymentImageDeleted(ctx context.Context, id uuid.UUID, deletedAt *time.Time) error {
+	return nil
+}
+
+func (m *MockDB) ListImageDigests(ctx context.Context, driftedOnly bool) ([]models.ImageDigest, error) {
+	return []models.ImageDigest{
+		{
+			Domain:         "test.com",
+			AppName:        "test-app",
+			DeploymentID:   uuid.MustParse("5f0c6a7e-4a0b-4c55-8d0e-0d6f4f3f9a11"),
+			DockerImage:    "docker.io/library/test:latest",
+			DeployedDigest: "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		},
+	}, nil
+}
+
+func (m *MockDB) UpdateDeploymentChecks(ctx context.Context, deploymentID uuid.UUID, checks []models.CheckStatus) ([]models.DeploymentCheck, error) {
+	// Deployments are pushed with a build and a test check, both pending
+	stored := []models.DeploymentCheck{{Name: "build", Status: models.CheckPending}, {Name: "test", Status: models.CheckPending}}
+	for _, check := range checks {
+		i := slices.IndexFunc(stored, func(c models.DeploymentCheck) bool { return c.Name == check.Name })
+		if i < 0 {
+			return nil, fmt.Errorf("check not found")
+		}
+		stored[i].Status = check.Status
+	}
+	return stored, nil
+}
+
+func (m *MockDB) GetDeploymentStats(ctx context.Context, rng models.DateRange) (*models.DeploymentStats, error) {
+	earlier := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	return &models.DeploymentStats{
+		TotalDeployments: 3,
+		PendingCount:     1,
+		DeployedCount:    2,
+		Breakdown: []models.StatsGroup{
+			{Domain: "a.com", AppName: "api", TotalDeployments: 1, DeployedCount: 1, Versions: 4, CurrentVersion: 4, CurrentStatus: "deployed", LastDeployedAt: &later},
+			{Domain: "a.com", AppName: "web", TotalDeployments: 1, PendingCount: 1, Versions: 2, CurrentVersion: 2, CurrentStatus: "pending", LastDeployedAt: &earlier},
+			{Domain: "b.com", AppName: "api", TotalDeployments: 1, DeployedCount: 1, Versions: 1, CurrentVersion: 1, CurrentStatus: "deployed"},
+		},
+	}, nil
+}
+
+func (m *MockDB) GetAppSummaries(ctx context.Context) ([]models.AppSummary, error) {
+	deployedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []models.AppSummary{
+		{Domain: "a.com", AppName: "api", TotalVersions: 4, DeployedCount: 3, FailedCount: 1, CurrentVersion: 4, CurrentStatus: "deployed", LastDeployedAt: &deployedAt},
+		{Domain: "a.com", AppName: "web", TotalVersions: 1, CurrentVersion: 1, CurrentStatus: "pending"},
+	}, nil
+}
+
+func (m *MockDB) RecordHealthProbe(ctx context.Context, probe models.HealthProbe) error {
+	return nil
+}
+
+func (m *MockDB) ListLatestHealthProbes(ctx context.Context) ([]models.HealthProbe, error) {
+	return []models.HealthProbe{
+		{Domain: "test.com", AppName: "test-app", Healthy: true, Agent: "controller", CheckedAt: time.Now().Add(-time.Minute)},
+		{Domain: "test.com", AppName: "gone", Healthy: false, Agent: "host-1", CheckedAt: time.Now()},
+	}, nil
+}
+
+func (m *MockDB) GetSLACounts(ctx context.Context, since time.Time) ([]models.SLACounts, error) {
+	if time.Since(since) <= 48*time.Hour {
+		return []models.SLACounts{
+			{Domain: "b.com", AppName: "api", Probes: 100, HealthyProbes: 99, Deployments: 1},
+		}, nil
+	}
+	return []models.SLACounts{
+		{Domain: "a.com", AppName: "web", Deployments: 2, FailedDeployments: 1},
+		{Domain: "b.com", AppName: "api", Probes: 1000, HealthyProbes: 999, Deployments: 3, Incidents: 2, Downtime: 90 * time.Second},
+	}, nil
+}
+
+// GetLatencySeries returns one point per step of the last two steps
+func (m *MockDB) GetLatencySeries(ctx context.Context, domain, appName string, since time.Time, step time.Duration) ([]models.LatencyPoint, error) {
+	now := time.Now().Truncate(step)
+	return []models.LatencyPoint{
+		{Time: now.Add(-step), LatencyPercentiles: models.LatencyPercentiles{Samples: 60, P50: 40, P90: 55, P99: 80}},
+		{Time: now, LatencyPercentiles: models.LatencyPercentiles{Samples: 20, P50: 120, P90: 150, P99: 210}},
+	}, nil
+}
+
+func (m *MockDB) GetDeploymentLatencies(ctx context.Context, domain, appName string, since time.Time) ([]models.DeploymentLatency, error) {
+	return []models.DeploymentLatency{
+		{DeploymentID: uuid.New(), Version: 1, LatencyPercentiles: models.LatencyPercentiles{Samples: 60, P50: 40, P90: 55, P99: 80}},
+		{DeploymentID: uuid.New(), Version: 2, LatencyPercentiles: models.LatencyPercentiles{Samples: 20, P50: 120, P90: 150, P99: 210}},
+	}, nil
+}
+
+func (m *MockDB) ListIncidents(ctx context.Context, domain, appName string, openOnly bool, limit int) ([]models.Incident, error) {
+	started := time.Now().Add(-10 * time.Minute)
+	resolved := started.Add(-time.Hour)
+	incidents := []models.Incident{
+		{ID: 2, Domain: "test.com", AppName: "test-app", StartedAt: started},
+		{ID: 1, Domain: "test.com", AppName: "test-app", StartedAt: resolved.Add(-5 * time.Minute), ResolvedAt: &resolved},
+	}
+	if openOnly {
+		incidents = incidents[:1]
+	}
+	return incidents[:min(limit, len(incidents))], nil
+}
+
+func (m *MockDB) GetTopApps(ctx context.Context, by string, since time.Time, limit int) ([]models.TopApp, error) {
+	apps := []models.TopApp{
+		{Domain: "a.com", AppName: "api", CreatedCount: 9, DeployedCount: 7, FailedCount: 1},
+		{Domain: "b.com", AppName: "api", CreatedCount: 4, DeployedCount: 1, FailedCount: 3},
+		{Domain: "a.com", AppName: "web", CreatedCount: 2, DeployedCount: 2},
+	}
+	if by == models.TopByFailures {
+		apps = []models.TopApp{apps[1], apps[0]}
+	}
+	return apps[:min(limit, len(apps))], nil
+}
+
+func (m *MockDB) ListDeploymentOutcomes(ctx context.Context, since time.Time) ([]models.DeploymentOutcome, error) {
+	at := func(minutes int) *time.Time {
+		t := since.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	return []models.DeploymentOutcome{
+		// a.com/api: deployed in 10m; deployed in 20m then rolled back and
+		// restored 70m after going out; failed
+		{Domain: "a.com", AppName: "api", CreatedAt: *at(0), DeployedAt: at(10)},
+		{Domain: "a.com", AppName: "api", CreatedAt: *at(100), DeployedAt: at(120), RolledBackAt: at(160), RestoredAt: at(190)},
+		{Domain: "a.com", AppName: "api", CreatedAt: *at(300), FailedAt: at(305)},
+		{Domain: "a.com", AppName: "web", CreatedAt: *at(0), DeployedAt: at(30)},
+		{Domain: "b.com", AppName: "api", CreatedAt: *at(0)},
+	}, nil
+}
+
+// missingDeploymentID is a deployment the mock reports as nonexistent
+var missingDeploymentID = uuid.MustParse("00000000-0000-0000-0000-000000000404")
+
+func (m *MockDB) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error) {
+	if id == missingDeploymentID {
+		return nil, fmt.Errorf("deployment not found")
+	}
+
+	current := &models.Deployment{ID: id, Version: 1, Status: "pending"}
+	if ifMatch != nil && ifMatch[0] != current.ETag() {
+		return nil, fmt.Errorf("precondition failed")
+	}
+
+	current.Status = status
+	current.DeployedAt = deployedAt
+	current.Failure = failure
+	return current, nil
+}
+
+func (m *MockDB) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, bool, error) {
+	if m.idempotency == nil {
+		m.idempotency = map[string]*models.IdempotencyRecord{}
+	}
+	if record, ok := m.idempotency[key]; ok {
+		return record, false, nil
+	}
+
+	m.idempotency[key] = &models.IdempotencyRecord{Key: key, RequestHash: requestHash}
+	return nil, true, nil
+}
+
+func (m *MockDB) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.idempotency[key].StatusCode = statusCode
+	m.idempotency[key].Response = response
+	return nil
+}
+
+func (m *MockDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if record, ok := m.idempotency[key]; ok && record.StatusCode == 0 {
+		delete(m.idempotency, key)
+	}
+	return nil
+}
+
+func (m *MockDB) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	return []models.Deployment{
+		{
+			ID:          uuid.MustParse("5f0c6a7e-4a0b-4c55-8d0e-0d6f4f3f9a11"),
+			Domain:      "test.com",
+			AppName:     "test-app",
+			DockerImage: "docker.io/library/test:latest",
+			Port:        3000,
+			Env:         []string{"A=1", "B=2"},
+			Version:     2,
+			Status:      "deployed",
+			Priority:    models.PriorityNormal,
+			CreatedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Metadata:    map[string]any{"ticket": "OPS-42", "attempt": float64(2)},
+		},
+	}, nil
+}
+
+func (m *MockDB) GetLatestDeployment(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	latest, _ := m.GetLatestDeployments(ctx)
+	for _, d := range latest {
+		if d.Domain == domain && d.AppName == appName {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf("deployment not found")
+}
+
+func (m *MockDB) EnqueueJob(ctx context.Context, jobType, priority string, payload []byte, total int) (*models.Job, error) {
+	job := models.Job{ID: uuid.New(), Type: jobType, Status: models.JobStatusQueued, Priority: priority, Payload: payload, Total: total}
+	m.mu.Lock()
+	m.queued = append(m.queued, job)
+	m.mu.Unlock()
+	return &job, nil
+}
+
+// takeJobs removes and returns the queued jobs of jobType
+func (m *MockDB) takeJobs(jobType string) []models.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var taken []models.Job
+	m.queued = slices.DeleteFunc(m.queued, func(job models.Job) bool {
+		if job.Type == jobType {
+			taken = append(taken, job)
+			return true
+		}
+		return false
+	})
+	return taken
+}
+
+// deliverWebhooks runs the queued webhook jobs as the worker pool would,
+// queueing the failed ones again, and returns how many failed
+func deliverWebhooks(handler *Handler, db *MockDB) int {
+	failed := 0
+	for _, job := range db.takeJobs(models.JobTypeWebhook) {
+		job.Attempts++
+		if _, err := handler.RunWebhookJob(context.Background(), &job, func(int) {}); err != nil {
+			failed++
+			db.mu.Lock()
+			db.queued = append(db.queued, job)
+			db.mu.Unlock()
+		}
+	}
+	return failed
+}
+
+func (m *MockDB) CancelJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	return &models.Job{ID: id, Type: models.JobTypePush, Status: models.JobStatusCancelled}, nil
+}
+
+// RetryJob behaves as if every job were still running
+func (m *MockDB) RetryJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	return nil, fmt.Errorf("job is not failed, cancelled or dead")
+}
+
+func (m *MockDB) UpsertSchedule(ctx context.Context, domain, appName, cron string, paused bool, nextRunAt time.Time) (*models.Schedule, error) {
+	return &models.Schedule{ID: uuid.New(), Domain: domain, AppName: appName, Cron: cron, Paused: paused, NextRunAt: nextRunAt}, nil
+}
+
+func (m *MockDB) UpsertRetryPolicy(ctx context.Context, policy models.RetryPolicy) (*models.RetryPolicy, error) {
+	return &policy, nil
+}
+
+func (m *MockDB) UpsertRolloutLimit(ctx context.Context, limit models.RolloutLimit) (*models.RolloutLimit, error) {
+	return &limit, nil
+}
+
+func (m *MockDB) UpsertImagePolicy(ctx context.Context, policy models.ImagePolicy) (*models.ImagePolicy, error) {
+	return &policy, nil
+}
+
+func (m *MockDB) ListImagePolicies(ctx context.Context) ([]models.ImagePolicy, error) {
+	return []models.ImagePolicy{
+		{Domain: "test.com", AppName: "test-app", Kind: models.ImagePolicySemver, Pattern: "^1.0.0"},
 	}, nil
 }
 
+func (m *MockDB) UpsertHealthCheck(ctx context.Context, check models.HealthCheck) (*models.HealthCheck, error) {
+	return &check, nil
+}
+
+func (m *MockDB) ListHealthChecks(ctx context.Context, checkType string) ([]models.HealthCheck, error) {
+	return []models.HealthCheck{}, nil
+}
+
+func (m *MockDB) UpsertAlertRule(ctx context.Context, rule models.AlertRule) (*models.AlertRule, error) {
+	return &rule, nil
+}
+
+func (m *MockDB) UpsertSmokeTest(ctx context.Context, test models.SmokeTest) (*models.SmokeTest, error) {
+	return &test, nil
+}
+
+func (m *MockDB) StartMaintenance(ctx context.Context, maintenance models.AppMaintenance, ifMatch []string) (*models.AppMaintenance, error) {
+	now := time.Now()
+	maintenance.Enabled, maintenance.StartedAt = true, &now
+	return &maintenance, nil
+}
+
+func (m *MockDB) EndMaintenance(ctx context.Context, domain, appName string, ifMatch []string) error {
+	return nil
+}
+
+func (m *MockDB) GetMaintenance(ctx context.Context, domain, appName string) (*models.AppMaintenance, error) {
+	return &models.AppMaintenance{Domain: domain, AppName: appName}, nil
+}
+
+func (m *MockDB) ListMaintenance(ctx context.Context) ([]models.AppMaintenance, error) {
+	return []models.AppMaintenance{}, nil
+}
+
+func (m *MockDB) AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error) {
+	chunk.CreatedAt = time.Now()
+	return &chunk, nil
+}
+
+func (m *MockDB) ListDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, error) {
+	return []models.DeploymentLogChunk{}, nil
+}
+
+func (m *MockDB) RecordManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) (*models.ManifestSnapshot, error) {
+	for _, stored := range m.snapshots {
+		if stored.DeploymentID == snapshot.DeploymentID && stored.Format == snapshot.Format && stored.ContentDigest == snapshot.ContentDigest {
+			return &stored, nil
+		}
+	}
+	snapshot.ID = int64(len(m.snapshots) + 1)
+	m.snapshots = append(m.snapshots, snapshot)
+	return &snapshot, nil
+}
+
+func (m *MockDB) ListManifestSnapshots(ctx context.Context, deploymentID uuid.UUID, format string) ([]models.ManifestSnapshot, error) {
+	snapshots := []models.ManifestSnapshot{}
+	for _, snapshot := range m.snapshots {
+		if snapshot.DeploymentID == deploymentID && (format == "" || snapshot.Format == format) {
+			snapshot.Content, snapshot.SecretFiles = "", nil
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (m *MockDB) GetManifestSnapshot(ctx context.Context, deploymentID uuid.UUID, id int64) (*models.ManifestSnapshot, error) {
+	for _, snapshot := range m.snapshots {
+		if snapshot.DeploymentID == deploymentID && snapshot.ID == id {
+			return &snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("manifest snapshot not found")
+}
+
+func (m *MockDB) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	// Another replica always holds the lock, so triggered syncs never run
+	return false, nil
+}
+
 func setupTestRouter() (*gin.Engine, *Handler) {
 	gin.SetMode(gin.TestMode)
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	// For testing, we'll need to adapt this to use the actual DB interface
-	// This is a simplified version for demonstration
-	handler := &Handler{
-		logger: logger,
-		// db: would need proper interface implementation
+	cfg := &config.Config{
+		Security: config.SecurityConfig{
+			EncryptionKey: "test-encryption-key",
+			SealingKey:    base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+		},
+		Validation: config.ValidationConfig{MaxEnvVars: 200, MaxEnvBytes: 64 * 1024, MaxMetadataBytes: 64},
+		Logs:       config.LogsConfig{MaxChunkBytes: 16, MaxBytes: 32, StreamPollInterval: 10 * time.Millisecond},
 	}
+	handler := New(&MockDB{}, logger, cfg)
 
 	router := gin.New()
 	router.POST("/api/v1/push", handler.Push)
+	router.GET("/api/v1/deployments", handler.GetDeployments)
+	router.PATCH("/api/v1/deployments/:id/status", handler.UpdateDeploymentStatus)
+	router.POST("/api/v1/secrets", handler.CreateSecret)
+	router.GET("/api/v1/sealing/public-key", handler.GetSealingKey)
+	router.GET("/api/v1/agent/deployments/:id", handler.GetAgentDeployment)
+	router.GET("/api/v1/agent/deployments/:id/manifest", handler.GetAgentManifest)
+	router.GET("/api/v1/jobs", handler.ListJobs)
+	router.GET("/api/v1/stats", handler.GetStats)
+	router.GET("/api/v1/stats/top", handler.GetTopApps)
+	router.GET("/api/v1/stats/sla", handler.GetSLAReport)
+	router.GET("/api/v1/stats/latency/:domain/:app_name", handler.GetLatencyReport)
+	router.POST("/api/v1/agent/apps/:domain/:app_name/probes", handler.ReportHealthProbe)
+	router.GET("/api/v1/analytics/dora", handler.GetDoraAnalytics)
+	router.GET("/api/v1/analytics/failure-rates", handler.GetFailureRates)
+	router.POST("/api/v1/jobs/:id/cancel", handler.CancelJob)
+	router.POST("/api/v1/jobs/:id/retry", handler.RetryJob)
+	router.PUT("/api/v1/schedules/:domain/:app_name", handler.PutSchedule)
+	router.PUT("/api/v1/retry-policies/:domain/:app_name", handler.PutRetryPolicy)
+	router.PUT("/api/v1/rollout-limits/:domain", handler.PutRolloutLimit)
+	router.PUT("/api/v1/rollout-limits/:domain/:app_name", handler.PutRolloutLimit)
+	router.PUT("/api/v1/image-policies/:domain/:app_name", handler.PutImagePolicy)
+	router.PUT("/api/v1/health-checks/:domain/:app_name", handler.PutHealthCheck)
+	router.GET("/api/v1/apps/:domain/:app_name/incidents", handler.ListAppIncidents)
+	router.PUT("/api/v1/alert-rules/:name", handler.PutAlertRule)
+	router.GET("/api/v1/status", handler.GetStatus)
+	router.PUT("/api/v1/smoke-tests/:domain/:app_name", handler.PutSmokeTest)
+	router.PATCH("/api/v1/apps/:domain/:app_name/maintenance", handler.SetMaintenance)
+	router.POST("/api/v1/alerts/:name/:domain/:app_name/ack", handler.AcknowledgeRuleAlert)
+	router.GET("/api/v1/health-checks", handler.ListHealthChecks)
+	router.GET("/api/v1/apps/:domain/:app_name", handler.GetApp)
+	router.PUT("/api/v1/apps/:domain/:app_name", handler.PutApp)
+	router.POST("/api/v1/deployments/:id/checks", handler.ReportDeploymentChecks)
+	router.POST("/api/v1/webhooks/git", handler.GitWebhook)
+	router.POST("/api/v1/webhooks/dockerhub", handler.DockerHubWebhook)
+	router.POST("/api/v1/webhooks/harbor", handler.HarborWebhook)
+	router.POST("/api/v1/webhooks/registry", handler.RegistryWebhook)
 
 	return router, handler
 }
@@ -70,6 +630,20 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+func TestHealthCheckDraining(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.GET("/healthz", handler.HealthCheck)
+	handler.StartDrain()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d while draining, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
 func TestPushEndpointValidation(t *testing.T) {
 	router, _ := setupTestRouter()
 
@@ -84,40 +658,5690 @@ func TestPushEndpointValidation(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name: "Valid deployment",
+			name: "Invalid domain and app name",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "not a domain",
+					AppName:     "Test_App",
+					DockerImage: "test:latest",
+					Port:        3000,
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Malformed and duplicate env entries",
 			payload: []models.DeploymentRequest{
 				{
 					Domain:      "test.com",
 					AppName:     "test-app",
 					DockerImage: "test:latest",
 					Port:        3000,
-					Env:         []string{"NODE_ENV=test"},
+					Env:         []string{"NODE_ENV=test", "NO_SEPARATOR", "NODE_ENV=prod"},
 				},
 			},
-			expectedStatus: http.StatusCreated, // This might fail due to DB dependency
+			expectedStatus: http.StatusBadRequest,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			jsonPayload, _ := json.Marshal(tt.payload)
-			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBuffer(jsonPayload))
-			req.Header.Set("Content-Type", "application/json")
-
-			router.ServeHTTP(w, req)
-
-			if w.Code != tt.expectedStatus {
-				t.Errorf("Expected status code %d, got %d. Response: %s",
-					tt.expectedStatus, w.Code, w.Body.String())
-			}
-		})
-	}
-}
-
-// Note: These tests are basic examples. In a real implementation, you would:
-// 1. Create proper interfaces for the database layer
-// 2. Use dependency injection to inject mock implementations
-// 3. Add more comprehensive test cases
-// 4. Test error conditions and edge cases
-// 5. Use testify/mock for more sophisticated mocking
+		{
+			name: "Empty and duplicate checks",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					Checks:      []string{"build", " ", "build"},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Malformed build metadata",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					BuildInfo:   models.BuildInfo{GitSHA: "main", BuildURL: "ci.example.com/runs/42"},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Valid deployment with build metadata",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					BuildInfo: models.BuildInfo{
+						GitSHA:   "3F2A9C1",
+						GitRef:   "refs/heads/main",
+						BuildURL: "https://ci.example.com/runs/42",
+						Builder:  "github-actions",
+					},
+				},
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Invalid metadata key",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					Metadata:    map[string]any{"team/owner": "payments"},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Oversized metadata",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					Metadata:    map[string]any{"notes": strings.Repeat("x", 64)},
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Valid deployment with metadata",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					Metadata:    map[string]any{"ticket": "OPS-42", "attempt": 2},
+				},
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Valid deployment",
+			payload: []models.DeploymentRequest{
+				{
+					Domain:      "test.com",
+					AppName:     "test-app",
+					DockerImage: "test:latest",
+					Port:        3000,
+					Env:         []string{"NODE_ENV=test"},
+				},
+			},
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonPayload, _ := json.Marshal(tt.payload)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBuffer(jsonPayload))
+			req.Header.Set("Content-Type", "application/json")
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s",
+					tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestProblemJSONErrors(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "Default envelope", accept: "", contentType: "application/json; charset=utf-8"},
+		{name: "Problem JSON", accept: "application/problem+json", contentType: ProblemContentType},
+		{name: "Problem JSON among others", accept: "text/html, application/problem+json;q=0.9", contentType: ProblemContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBufferString("[]"))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Expected content type %q, got %q", tt.contentType, got)
+			}
+
+			if tt.contentType != ProblemContentType {
+				return
+			}
+
+			var problem models.ProblemDetails
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Failed to unmarshal problem: %v", err)
+			}
+			if problem.Status != http.StatusBadRequest || problem.Title != "Bad Request" || problem.Instance != "/api/v1/push" {
+				t.Errorf("Unexpected problem body: %+v", problem)
+			}
+		})
+	}
+}
+
+func TestErrorWithData(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/admin/housekeeping", func(c *gin.Context) {
+		RespondErrorWithData(c, http.StatusInternalServerError, "Housekeeping failed 1 of 2 steps", gin.H{"steps": 2})
+	})
+
+	for name, accept := range map[string]string{"Default envelope": "", "Problem JSON": ProblemContentType} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/admin/housekeeping", nil)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+			}
+			var body struct {
+				Error  string         `json:"error"`
+				Detail string         `json:"detail"`
+				Data   map[string]int `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if body.Error+body.Detail != "Housekeeping failed 1 of 2 steps" || body.Data["steps"] != 2 {
+				t.Errorf("Expected the message and data, got %s", w.Body.String())
+			}
+			if isProblem := w.Header().Get("Content-Type") == ProblemContentType; isProblem != (accept != "") {
+				t.Errorf("Expected problem+json only when asked for, got %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestUpdateStatusIfMatch(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	id := uuid.New()
+	current := &models.Deployment{ID: id, Version: 1, Status: "pending"}
+
+	tests := []struct {
+		name           string
+		id             uuid.UUID
+		ifMatch        string
+		expectedStatus int
+	}{
+		{name: "Missing If-Match", id: id, ifMatch: "", expectedStatus: http.StatusPreconditionRequired},
+		{name: "Stale ETag", id: id, ifMatch: `"stale"`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "Current ETag", id: id, ifMatch: current.ETag(), expectedStatus: http.StatusOK},
+		{name: "Wildcard", id: id, ifMatch: "*", expectedStatus: http.StatusOK},
+		{name: "Missing deployment", id: missingDeploymentID, ifMatch: "*", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PATCH", "/api/v1/deployments/"+tt.id.String()+"/status",
+				bytes.NewBufferString(`{"status":"deploying"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s",
+					tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK && w.Header().Get("ETag") == "" {
+				t.Errorf("Expected ETag header on successful update")
+			}
+		})
+	}
+}
+
+func TestPushIdempotencyKey(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	push := func(payload string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "ci-run-42")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	payload := `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000}]`
+
+	first := push(payload)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, first.Code)
+	}
+
+	replay := push(payload)
+	if replay.Code != http.StatusCreated {
+		t.Errorf("Expected replayed status code %d, got %d", http.StatusCreated, replay.Code)
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected Idempotent-Replayed header on replay")
+	}
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed body to match original.\nOriginal: %s\nReplay: %s", first.Body.String(), replay.Body.String())
+	}
+
+	conflict := push(`[{"domain":"test.com","app_name":"other-app","docker_image":"test:latest","port":3000}]`)
+	if conflict.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for reused key, got %d", http.StatusUnprocessableEntity, conflict.Code)
+	}
+}
+
+func TestPushIdempotencyKeyClientGone(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	payload := `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000}]`
+	push := func(ctx context.Context) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/api/v1/push", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "ci-run-43")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The client timed out while the push was processed, so its retry must
+	// get the stored result rather than a conflict
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	push(gone)
+
+	retry := push(context.Background())
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the retry to replay the stored result")
+	}
+}
+
+func TestDeleteDeployment(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.DELETE("/api/v1/deployments/:id", handler.DeleteDeployment)
+
+	req := models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80, Checks: []string{"build"}}
+	kept, err := store.CreateDeployment(ctx, req, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req.DockerImage = "nginx:1.26"
+	d, err := store.CreateDeployment(ctx, req, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Each request runs against what the ones before it left
+	tests := []struct {
+		name         string
+		id           string
+		ifMatch      string
+		expectedCode int
+	}{
+		{name: "Invalid ID", id: "not-a-uuid", ifMatch: "*", expectedCode: http.StatusBadRequest},
+		{name: "Missing If-Match", id: d.ID.String(), expectedCode: http.StatusPreconditionRequired},
+		{name: "Stale ETag", id: d.ID.String(), ifMatch: kept.ETag(), expectedCode: http.StatusPreconditionFailed},
+		{name: "Current ETag", id: d.ID.String(), ifMatch: d.ETag(), expectedCode: http.StatusOK},
+		{name: "Already deleted", id: d.ID.String(), ifMatch: "*", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/api/v1/deployments/"+tt.id, nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if checks, err := store.ListDeploymentChecks(ctx, d.ID); err != nil || len(checks) != 0 {
+		t.Errorf("Expected the deleted version's checks gone, got %+v: %v", checks, err)
+	}
+	if _, err := store.GetDeployment(ctx, kept.ID); err != nil {
+		t.Errorf("Expected the other version kept, got %v", err)
+	}
+}
+
+func TestGetDeploymentsCSV(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/deployments?format=csv", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Expected CSV content type, got %q", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected header and one row, got %d lines: %s", len(lines), w.Body.String())
+	}
+	if !strings.HasPrefix(lines[0], "id,request_id,domain,app_name") {
+		t.Errorf("Unexpected CSV header: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "test.com,test-app,docker.io/library/test:latest,3000,A=1;B=2,2,deployed") {
+		t.Errorf("Unexpected CSV row: %s", lines[1])
+	}
+}
+
+func TestEventsAndAccessLogCSV(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.GET("/api/v1/deployments/:id/events", handler.GetDeploymentEvents)
+	router.GET("/api/v1/registry/access", handler.GetRegistryAccessLog)
+	router.GET("/api/v1/secrets/:project/:name/access", handler.GetSecretAccessLog)
+
+	deployment, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.UpdateDeploymentStatus(ctx, deployment.ID, "deploying", nil, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// More reads than fit in a page, so the export spans several
+	reads := make([]models.AuditEvent, maxPageLimit+1)
+	for i := range reads {
+		reads[i] = models.AuditEvent{Action: models.AuditRegistryRead, Resource: registryResource("ghcr.io"), Actor: "ci"}
+	}
+	if err := store.RecordAuditEvents(ctx, reads); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		header string
+		rows   int
+	}{
+		{"Deployment events", "/api/v1/deployments/" + deployment.ID.String() + "/events?format=csv", "", "id,deployment_id,type,message,attempt,created_at", 1},
+		{"Registry access log", "/api/v1/registry/access?registry=ghcr.io", "text/csv", "id,action,resource,actor,client_ip,deployment_id,detail,created_at", maxPageLimit + 1},
+		{"Empty secret access log", "/api/v1/secrets/payments/db-pass/access?format=csv", "", "id,action,resource,actor,client_ip,deployment_id,detail,created_at", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Expected CSV content type, got %q", got)
+			}
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			if lines[0] != tt.header || len(lines) != tt.rows+1 {
+				t.Errorf("Expected header %q and %d rows, got %q and %d rows", tt.header, tt.rows, lines[0], len(lines)-1)
+			}
+		})
+	}
+}
+
+func TestDeploymentLinks(t *testing.T) {
+	d := models.Deployment{ID: uuid.MustParse("5f0c6a7e-4a0b-4c55-8d0e-0d6f4f3f9a11")}
+	addLinks(&d)
+
+	self := "/api/v1/deployments/5f0c6a7e-4a0b-4c55-8d0e-0d6f4f3f9a11"
+	want := models.Links{
+		"self":     {Href: self},
+		"history":  {Href: self + "/history"},
+		"events":   {Href: self + "/events"},
+		"logs":     {Href: self + "/logs"},
+		"status":   {Href: self + "/status", Method: "PATCH"},
+		"rollback": {Href: self + "/rollback", Method: "POST"},
+	}
+	if !reflect.DeepEqual(d.Links, want) {
+		t.Errorf("Expected links %+v, got %+v", want, d.Links)
+	}
+}
+
+func TestRollbackDeployment(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.POST("/api/v1/deployments/:id/rollback", handler.RollbackDeployment)
+	rollback := func(id uuid.UUID) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/deployments/"+id.String()+"/rollback?reason=bad+release", nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var versions []*models.Deployment
+	for _, image := range []string{"nginx:1.24", "nginx:1.25"} {
+		d, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: image, Port: 80}, "req")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		now := time.Now()
+		if _, err := store.UpdateDeploymentStatus(ctx, d.ID, "deployed", nil, &now, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		versions = append(versions, d)
+	}
+
+	if w := rollback(versions[0].ID); w.Code != http.StatusConflict {
+		t.Errorf("Expected a superseded version to be refused with %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := rollback(uuid.New()); w.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown deployment to get %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := rollback(versions[1].ID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.Deployment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Data.Version != 3 || response.Data.DockerImage != "nginx:1.24" || response.Data.Links["self"].Href == "" {
+		t.Errorf("Expected version 1 restored as version 3, got %+v", response.Data)
+	}
+
+	rolledBack, _ := store.GetDeployment(ctx, versions[1].ID)
+	if rolledBack.Status != "rolled_back" {
+		t.Errorf("Expected version 2 to be rolled back, got %s", rolledBack.Status)
+	}
+}
+
+func TestGetTopApps(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedDays   int
+		expectedApps   []string
+	}{
+		{"Most deployed by default", "", http.StatusOK, 7, []string{"a.com/api", "b.com/api", "a.com/web"}},
+		{"Most failing over four weeks", "?by=failures&range=4w", http.StatusOK, 28, []string{"b.com/api", "a.com/api"}},
+		{"Limited", "?limit=1&range=30d", http.StatusOK, 30, []string{"a.com/api"}},
+		{"Unknown ordering", "?by=rollbacks", http.StatusBadRequest, 0, nil},
+		{"Limit too high", "?limit=1000", http.StatusBadRequest, 0, nil},
+		{"Range without unit", "?range=7", http.StatusBadRequest, 0, nil},
+		{"Range too long", "?range=60w", http.StatusBadRequest, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/stats/top"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.TopAppsReport `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.Days != tt.expectedDays {
+				t.Errorf("Expected %d days, got %d", tt.expectedDays, response.Data.Days)
+			}
+			var apps []string
+			for _, app := range response.Data.Apps {
+				apps = append(apps, app.Domain+"/"+app.AppName)
+			}
+			if !slices.Equal(apps, tt.expectedApps) {
+				t.Errorf("Expected apps %v, got %v", tt.expectedApps, apps)
+			}
+		})
+	}
+}
+
+func TestReportHealthProbe(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.SLA.Retention = 24 * time.Hour
+
+	tests := []struct {
+		name           string
+		app            string
+		body           string
+		expectedStatus int
+	}{
+		{"Healthy", "test.com/test-app", `{"healthy": true}`, http.StatusCreated},
+		{"Unhealthy earlier", "test.com/test-app", `{"healthy": false, "checked_at": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `"}`, http.StatusCreated},
+		{"Missing result", "test.com/test-app", `{}`, http.StatusBadRequest},
+		{"In the future", "test.com/test-app", `{"healthy": true, "checked_at": "` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`, http.StatusBadRequest},
+		{"Past retention", "test.com/test-app", `{"healthy": true, "checked_at": "2024-05-01T12:00:00Z"}`, http.StatusBadRequest},
+		{"Unknown app", "test.com/other", `{"healthy": true}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/agent/apps/"+tt.app+"/probes", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			var response struct {
+				Data models.HealthProbe `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.DeploymentID == nil || response.Data.DeploymentID.String() != "5f0c6a7e-4a0b-4c55-8d0e-0d6f4f3f9a11" {
+				t.Errorf("Expected the probe to default to the latest deployment, got %v", response.Data.DeploymentID)
+			}
+		})
+	}
+}
+
+func TestGetSLAReport(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.SLA = config.SLAConfig{
+		Windows:   []time.Duration{24 * time.Hour, 30 * 24 * time.Hour},
+		Target:    99.5,
+		Retention: 90 * 24 * time.Hour,
+	}
+
+	for _, query := range []string{"?windows=24h,400d", "?windows=7x", "?windows=24h,"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/stats/sla"+query, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/stats/sla", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data models.SLAReport `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	report := response.Data
+	if !slices.Equal(report.Windows, []string{"1d", "30d"}) {
+		t.Fatalf("Unexpected windows %v", report.Windows)
+	}
+	if len(report.Apps) != 2 || report.Apps[0].AppName != "web" || report.Apps[1].Domain != "b.com" {
+		t.Fatalf("Expected a.com/web then b.com/api, got %+v", report.Apps)
+	}
+
+	// a.com/web was deployed but never probed, and not at all in the last day
+	web := report.Apps[0].Windows
+	if len(web) != 2 || web[0].Window != "1d" || web[0].Deployments != 0 || web[1].Deployments != 2 || web[1].Availability != nil {
+		t.Errorf("Unexpected a.com/web windows %+v", web)
+	}
+
+	api := report.Apps[1].Windows
+	if len(api) != 2 || api[0].Availability == nil || *api[0].Availability != 99 || *api[0].MeetsTarget {
+		t.Fatalf("Unexpected b.com/api last day %+v", api)
+	}
+	if api[1].Availability == nil || *api[1].Availability != 99.9 || !*api[1].MeetsTarget || api[1].FailedDeployments != 0 {
+		t.Errorf("Unexpected b.com/api last 30 days %+v", api[1])
+	}
+	if api[1].Incidents != 2 || api[1].DowntimeSeconds != 90 {
+		t.Errorf("Expected 2 incidents and 90s of downtime in the last 30 days, got %+v", api[1])
+	}
+}
+
+func TestGetLatencyReport(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.SLA = config.SLAConfig{Retention: 90 * 24 * time.Hour}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"Default window", "test.com/test-app", http.StatusOK},
+		{"Custom window", "test.com/test-app?window=7d&step=6h", http.StatusOK},
+		{"Unknown app", "test.com/missing-app", http.StatusNotFound},
+		{"Window past retention", "test.com/test-app?window=400d", http.StatusBadRequest},
+		{"Step too short", "test.com/test-app?step=10s", http.StatusBadRequest},
+		{"Too many steps", "test.com/test-app?window=30d&step=1m", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/stats/latency/"+tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.LatencyReport `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			report := response.Data
+			if report.Domain != "test.com" || report.AppName != "test-app" || len(report.Points) != 2 {
+				t.Fatalf("Unexpected report %+v", report)
+			}
+			if len(report.Deployments) != 2 || report.Deployments[1].P99 != 210 || report.Deployments[1].Samples != 20 {
+				t.Errorf("Unexpected deployment latencies %+v", report.Deployments)
+			}
+		})
+	}
+}
+
+func TestListAppIncidents(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedIDs    []int64
+	}{
+		{"All incidents", "test.com/test-app/incidents", http.StatusOK, []int64{2, 1}},
+		{"Open incidents", "test.com/test-app/incidents?open=true", http.StatusOK, []int64{2}},
+		{"Limited", "test.com/test-app/incidents?limit=1", http.StatusOK, []int64{2}},
+		{"Invalid open", "test.com/test-app/incidents?open=maybe", http.StatusBadRequest, nil},
+		{"Invalid limit", "test.com/test-app/incidents?limit=0", http.StatusBadRequest, nil},
+		{"Unknown app", "test.com/missing/incidents", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/apps/"+tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []models.Incident `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			var ids []int64
+			for _, i := range response.Data {
+				ids = append(ids, i.ID)
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Fatalf("Expected incidents %v, got %v", tt.expectedIDs, ids)
+			}
+
+			// The open incident has lasted about 10 minutes so far; the
+			// resolved one lasted 5
+			open := response.Data[0].DurationSeconds
+			if open < 600 || open > 660 {
+				t.Errorf("Unexpected open incident duration %v", open)
+			}
+			if len(response.Data) > 1 && response.Data[1].DurationSeconds != 300 {
+				t.Errorf("Unexpected resolved incident duration %v", response.Data[1].DurationSeconds)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		format   string
+	}{
+		{"24h", 24 * time.Hour, "1d"},
+		{"90m", 90 * time.Minute, "1h30m"},
+		{"30m", 30 * time.Minute, "30m"},
+		{"12h", 12 * time.Hour, "12h"},
+		{"7d", 7 * 24 * time.Hour, "7d"},
+		{"4w", 28 * 24 * time.Hour, "28d"},
+		{"d", 0, ""},
+		{"0d", 0, ""},
+		{"-1h", 0, ""},
+		{"7dw", 0, ""},
+	}
+
+	for _, tt := range tests {
+		window, err := parseWindow(tt.value)
+		if tt.expected == 0 {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.value, window)
+			}
+			continue
+		}
+		if err != nil || window != tt.expected {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.value, tt.expected, window, err)
+		}
+		if got := formatWindow(window); got != tt.format {
+			t.Errorf("%q: expected format %q, got %q", tt.value, tt.format, got)
+		}
+	}
+}
+
+func TestDateRangeFilters(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"No range", "/api/v1/deployments", http.StatusOK, 1},
+		{"Created in month", "/api/v1/deployments?from=2024-05-01&to=2024-05-31", http.StatusOK, 1},
+		{"Created on last day", "/api/v1/deployments?from=2024-04-01&to=2024-05-01", http.StatusOK, 1},
+		{"Created before range", "/api/v1/deployments?from=2024-05-01T12:00:01Z", http.StatusOK, 0},
+		{"Created after range", "/api/v1/deployments?to=2024-05-01T12:00:00Z", http.StatusOK, 0},
+		{"Never deployed", "/api/v1/deployments?from=2024-01-01&date_field=deployed_at", http.StatusOK, 0},
+		{"Unknown field", "/api/v1/deployments?from=2024-01-01&date_field=updated_at", http.StatusBadRequest, 0},
+		{"Malformed bound", "/api/v1/deployments?from=May", http.StatusBadRequest, 0},
+		{"Empty range", "/api/v1/deployments?from=2024-06-01&to=2024-05-01", http.StatusBadRequest, 0},
+		{"Stats malformed bound", "/api/v1/stats?to=2024-13-01", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []models.Deployment `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data) != tt.expectedCount {
+				t.Errorf("Expected %d deployments, got %d", tt.expectedCount, len(response.Data))
+			}
+		})
+	}
+}
+
+func TestWriteFreeze(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.GET("/api/v1/admin/freeze", handler.GetWriteFreeze)
+	router.PATCH("/api/v1/admin/freeze", handler.SetWriteFreeze)
+
+	ifMatch := "*"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if method == "PATCH" && ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	push := `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000}]`
+
+	if w := do("PATCH", "/api/v1/admin/freeze", `{"enabled":false,"reason":"incident"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a reason without enabling, got %d", w.Code)
+	}
+
+	ifMatch = ""
+	if w := do("PATCH", "/api/v1/admin/freeze", `{"enabled":true}`); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected 428 without If-Match, got %d", w.Code)
+	}
+
+	w := do("GET", "/api/v1/admin/freeze", "")
+	off := w.Header().Get("ETag")
+	if off == "" {
+		t.Fatal("Expected an ETag on the freeze")
+	}
+	ifMatch = off
+	w = do("PATCH", "/api/v1/admin/freeze", `{"enabled":true,"reason":"INC-7 database failover"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 starting the freeze, got %d: %s", w.Code, w.Body.String())
+	}
+	on := w.Header().Get("ETag")
+	if on == "" || on == off {
+		t.Fatalf("Expected a new ETag once the freeze started, got %q", on)
+	}
+
+	// A second operator still holding the ETag read before the freeze
+	if w := do("PATCH", "/api/v1/admin/freeze", `{"enabled":false}`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 for a stale ETag, got %d", w.Code)
+	}
+
+	w = do("POST", "/api/v1/push", push)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 pushing while frozen, got %d: %s", w.Code, w.Body.String())
+	}
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Error != "Deployments are frozen: INC-7 database failover" {
+		t.Errorf("Unexpected error %q", response.Error)
+	}
+
+	if w := do("GET", "/api/v1/deployments", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected reads to be served while frozen, got %d", w.Code)
+	}
+
+	var freeze struct {
+		Data models.WriteFreeze `json:"data"`
+	}
+	json.Unmarshal(do("GET", "/api/v1/admin/freeze", "").Body.Bytes(), &freeze)
+	if !freeze.Data.Enabled || freeze.Data.Reason != "INC-7 database failover" || freeze.Data.StartedAt == nil {
+		t.Errorf("Unexpected freeze %+v", freeze.Data)
+	}
+
+	ifMatch = on
+	if w := do("PATCH", "/api/v1/admin/freeze", `{"enabled":false}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 lifting the freeze, got %d", w.Code)
+	}
+	if w := do("POST", "/api/v1/push", push); w.Code != http.StatusCreated {
+		t.Errorf("Expected pushes to resume after the freeze, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMetadataFilters(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"Matching string", "/api/v1/deployments?metadata.ticket=OPS-42", http.StatusOK, 1},
+		{"Matching number", "/api/v1/deployments?metadata.ticket=OPS-42&metadata.attempt=2", http.StatusOK, 1},
+		{"Different value", "/api/v1/deployments?metadata.ticket=OPS-43", http.StatusOK, 0},
+		{"Missing key", "/api/v1/deployments?metadata.release=spring", http.StatusOK, 0},
+		{"With date range", "/api/v1/deployments?metadata.ticket=OPS-42&from=2024-06-01", http.StatusOK, 0},
+		{"Invalid key", "/api/v1/deployments?metadata..ticket=OPS-42", http.StatusBadRequest, 0},
+		{"Repeated key", "/api/v1/deployments?metadata.ticket=OPS-42&metadata.ticket=OPS-43", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data []models.Deployment `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data) != tt.expectedCount {
+				t.Errorf("Expected %d deployments, got %d", tt.expectedCount, len(response.Data))
+			}
+		})
+	}
+}
+
+func TestGetStatsBreakdown(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       []models.StatsGroup
+	}{
+		{
+			name:           "Per app by default",
+			expectedStatus: http.StatusOK,
+			expected: []models.StatsGroup{
+				{Domain: "a.com", AppName: "api", TotalDeployments: 1, DeployedCount: 1, Versions: 4},
+				{Domain: "a.com", AppName: "web", TotalDeployments: 1, PendingCount: 1, Versions: 2},
+				{Domain: "b.com", AppName: "api", TotalDeployments: 1, DeployedCount: 1, Versions: 1},
+			},
+		},
+		{
+			name:           "Per domain",
+			query:          "?group_by=domain",
+			expectedStatus: http.StatusOK,
+			expected: []models.StatsGroup{
+				{Domain: "a.com", TotalDeployments: 2, PendingCount: 1, DeployedCount: 1, Versions: 6},
+				{Domain: "b.com", TotalDeployments: 1, DeployedCount: 1, Versions: 1},
+			},
+		},
+		{
+			name:           "Unknown grouping",
+			query:          "?group_by=status",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/stats"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.DeploymentStats `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data.Breakdown) != len(tt.expected) {
+				t.Fatalf("Expected %d groups, got %+v", len(tt.expected), response.Data.Breakdown)
+			}
+			for i, want := range tt.expected {
+				got := response.Data.Breakdown[i]
+				if got.Domain != want.Domain || got.AppName != want.AppName ||
+					got.TotalDeployments != want.TotalDeployments || got.PendingCount != want.PendingCount ||
+					got.DeployedCount != want.DeployedCount || got.Versions != want.Versions {
+					t.Errorf("Group %d: expected %+v, got %+v", i, want, got)
+				}
+			}
+			if tt.query == "?group_by=domain" {
+				if last := response.Data.Breakdown[0].LastDeployedAt; last == nil || last.Hour() != 13 {
+					t.Errorf("Expected a.com last deployed at 13:00, got %v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestDoraAnalytics(t *testing.T) {
+	router, _ := setupTestRouter()
+	ptr := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       []models.DoraMetrics
+	}{
+		{
+			name:           "Per app",
+			query:          "?days=10",
+			expectedStatus: http.StatusOK,
+			expected: []models.DoraMetrics{
+				{Domain: "a.com", AppName: "api", Deployments: 2, DeploymentsPerDay: 0.2, LeadTimeSeconds: ptr(900),
+					Changes: 3, FailedChanges: 2, ChangeFailureRate: ptr(2.0 / 3), Rollbacks: 1, TimeToRestoreSeconds: ptr(4200)},
+				{Domain: "a.com", AppName: "web", Deployments: 1, DeploymentsPerDay: 0.1, LeadTimeSeconds: ptr(1800),
+					Changes: 1, ChangeFailureRate: ptr(0)},
+				{Domain: "b.com", AppName: "api"},
+			},
+		},
+		{
+			name:           "Per domain",
+			query:          "?days=10&group_by=domain",
+			expectedStatus: http.StatusOK,
+			expected: []models.DoraMetrics{
+				{Domain: "a.com", Deployments: 3, DeploymentsPerDay: 0.3, LeadTimeSeconds: ptr(1200),
+					Changes: 4, FailedChanges: 2, ChangeFailureRate: ptr(0.5), Rollbacks: 1, TimeToRestoreSeconds: ptr(4200)},
+				{Domain: "b.com"},
+			},
+		},
+		{
+			name:           "Too many days",
+			query:          "?days=400",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown grouping",
+			query:          "?group_by=team",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	same := func(a, b *float64) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return math.Abs(*a-*b) < 1e-9
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/analytics/dora"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.DoraReport `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.Total.Deployments != 3 {
+				t.Errorf("Expected 3 deployments in total, got %+v", response.Data.Total)
+			}
+			if len(response.Data.Groups) != len(tt.expected) {
+				t.Fatalf("Expected %d groups, got %+v", len(tt.expected), response.Data.Groups)
+			}
+			for i, want := range tt.expected {
+				got := response.Data.Groups[i]
+				if got.Domain != want.Domain || got.AppName != want.AppName ||
+					got.Deployments != want.Deployments || !same(&got.DeploymentsPerDay, &want.DeploymentsPerDay) ||
+					!same(got.LeadTimeSeconds, want.LeadTimeSeconds) ||
+					got.Changes != want.Changes || got.FailedChanges != want.FailedChanges ||
+					!same(got.ChangeFailureRate, want.ChangeFailureRate) ||
+					got.Rollbacks != want.Rollbacks || !same(got.TimeToRestoreSeconds, want.TimeToRestoreSeconds) {
+					t.Errorf("Group %d: expected %+v, got %+v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+// alertsDB serves deployment outcomes and keeps failure rate alerts for the
+// alert tests
+type alertsDB struct {
+	*MockDB
+	outcomes []models.DeploymentOutcome
+	alerts   map[[2]string]models.FailureRateAlert
+}
+
+func (m *alertsDB) ListDeploymentOutcomes(ctx context.Context, since time.Time) ([]models.DeploymentOutcome, error) {
+	return m.outcomes, nil
+}
+
+func (m *alertsDB) ListFailureRateAlerts(ctx context.Context) ([]models.FailureRateAlert, error) {
+	alerts := []models.FailureRateAlert{}
+	for _, alert := range m.alerts {
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func (m *alertsDB) FireFailureRateAlert(ctx context.Context, domain, appName string, failureRate float64) error {
+	alert, ok := m.alerts[[2]string{domain, appName}]
+	if !ok {
+		alert = models.FailureRateAlert{Domain: domain, AppName: appName, FiringSince: time.Now()}
+	}
+	alert.FailureRate = failureRate
+	m.alerts[[2]string{domain, appName}] = alert
+	return nil
+}
+
+func (m *alertsDB) ResolveFailureRateAlert(ctx context.Context, domain, appName string) error {
+	delete(m.alerts, [2]string{domain, appName})
+	return nil
+}
+
+// ruleDB keeps alert rules, their alerts and open incidents for the alert
+// rule tests
+type ruleDB struct {
+	*alertsDB
+	rules     []models.AlertRule
+	fired     map[[3]string]models.RuleAlert
+	incidents []models.Incident
+}
+
+func (m *ruleDB) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	return m.rules, nil
+}
+
+func (m *ruleDB) ListRuleAlerts(ctx context.Context) ([]models.RuleAlert, error) {
+	alerts := []models.RuleAlert{}
+	for _, alert := range m.fired {
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func (m *ruleDB) FireRuleAlert(ctx context.Context, alert models.RuleAlert) error {
+	key := [3]string{alert.Rule, alert.Domain, alert.AppName}
+	existing, ok := m.fired[key]
+	if !ok {
+		existing = models.RuleAlert{Rule: alert.Rule, Domain: alert.Domain, AppName: alert.AppName, FiringSince: time.Now()}
+	}
+	existing.Value = alert.Value
+	if alert.NotifiedAt != nil {
+		existing.NotifiedAt = alert.NotifiedAt
+	}
+	m.fired[key] = existing
+	return nil
+}
+
+func (m *ruleDB) ResolveRuleAlert(ctx context.Context, rule, domain, appName string) error {
+	delete(m.fired, [3]string{rule, domain, appName})
+	return nil
+}
+
+func (m *ruleDB) AcknowledgeRuleAlert(ctx context.Context, rule, domain, appName, actor string) (*models.RuleAlert, error) {
+	key := [3]string{rule, domain, appName}
+	alert, ok := m.fired[key]
+	if !ok {
+		return nil, fmt.Errorf("alert not found")
+	}
+	now := time.Now()
+	alert.AcknowledgedAt, alert.AcknowledgedBy = &now, actor
+	m.fired[key] = alert
+	return &alert, nil
+}
+
+func (m *ruleDB) ListIncidents(ctx context.Context, domain, appName string, openOnly bool, limit int) ([]models.Incident, error) {
+	return m.incidents, nil
+}
+
+// verifyDB serves deployments and keeps their health probes and
+// verification states for the verification and prober tests
+type verifyDB struct {
+	*MockDB
+	mu          sync.Mutex
+	deployments []models.Deployment
+	probes      []models.HealthProbe
+	checks      []models.HealthCheck
+	maintenance []models.AppMaintenance
+	states      map[uuid.UUID]string
+	messages    map[uuid.UUID]string
+}
+
+func (m *verifyDB) ListMaintenance(ctx context.Context) ([]models.AppMaintenance, error) {
+	return m.maintenance, nil
+}
+
+func (m *verifyDB) ListVerifyingDeployments(ctx context.Context, since time.Time) ([]models.Deployment, error) {
+	return m.deployments, nil
+}
+
+func (m *verifyDB) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	return m.deployments, nil
+}
+
+func (m *verifyDB) ListHealthChecks(ctx context.Context, checkType string) ([]models.HealthCheck, error) {
+	return m.checks, nil
+}
+
+func (m *verifyDB) RecordHealthProbe(ctx context.Context, probe models.HealthProbe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probes = append(m.probes, probe)
+	return nil
+}
+
+func (m *verifyDB) CountDeploymentProbes(ctx context.Context, id uuid.UUID, from, to time.Time) (total, unhealthy int, err error) {
+	for _, p := range m.probes {
+		if *p.DeploymentID == id && !p.CheckedAt.Before(from) && p.CheckedAt.Before(to) {
+			total++
+			if !p.Healthy {
+				unhealthy++
+			}
+		}
+	}
+	return total, unhealthy, nil
+}
+
+func (m *verifyDB) SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error {
+	m.states[id] = verification
+	m.messages[id] = message
+	return nil
+}
+
+func TestRunVerification(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	var probed []string
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = append(probed, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer app.Close()
+
+	handler.cfg.Verify = config.VerifyConfig{
+		Enabled:     true,
+		HealthURL:   app.URL + "/{domain}/{app_name}/healthz",
+		Window:      5 * time.Minute,
+		Timeout:     time.Second,
+		MaxFailures: 1,
+	}
+
+	minutesAgo := func(m int) *time.Time {
+		t := time.Now().Add(-time.Duration(m) * time.Minute)
+		return &t
+	}
+	fresh, healthy, flaky, silent := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	probe := func(id uuid.UUID, minutes int, ok bool) models.HealthProbe {
+		return models.HealthProbe{DeploymentID: &id, Healthy: ok, CheckedAt: *minutesAgo(minutes)}
+	}
+	db := &verifyDB{
+		MockDB: &MockDB{},
+		deployments: []models.Deployment{
+			{ID: fresh, Domain: "a.com", AppName: "api", Status: "deployed", DeployedAt: minutesAgo(1)},
+			{ID: healthy, Domain: "a.com", AppName: "web", Status: "deployed", DeployedAt: minutesAgo(10), Verification: models.VerificationVerifying},
+			{ID: flaky, Domain: "b.com", AppName: "api", Status: "deployed", DeployedAt: minutesAgo(10), Verification: models.VerificationVerifying},
+			{ID: silent, Domain: "b.com", AppName: "web", Status: "deployed", DeployedAt: minutesAgo(10), Verification: models.VerificationVerifying},
+		},
+		probes: []models.HealthProbe{
+			probe(healthy, 9, true), probe(healthy, 8, false), probe(healthy, 7, true),
+			// Failures after the window don't count
+			probe(flaky, 9, false), probe(flaky, 8, false), probe(flaky, 2, false),
+			probe(silent, 1, true),
+		},
+		states:   map[uuid.UUID]string{},
+		messages: map[uuid.UUID]string{},
+	}
+	handler.db = db
+
+	if err := handler.RunVerification(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !slices.Equal(probed, []string{"/a.com/api/healthz"}) {
+		t.Errorf("Expected only the fresh deployment to be probed, got %v", probed)
+	}
+	if last := db.probes[len(db.probes)-1]; *last.DeploymentID != fresh || !last.Healthy || last.Agent != "controller" {
+		t.Errorf("Unexpected controller probe %+v", last)
+	}
+
+	expected := map[uuid.UUID]string{
+		fresh:   models.VerificationVerifying,
+		healthy: models.VerificationVerified,
+		flaky:   models.VerificationDegraded,
+		silent:  models.VerificationDegraded,
+	}
+	for id, want := range expected {
+		if db.states[id] != want {
+			t.Errorf("Expected %s to be %s, got %q (%s)", id, want, db.states[id], db.messages[id])
+		}
+	}
+	if msg := db.messages[flaky]; msg != "degraded: 2 of 2 health probes failed within 5m0s" {
+		t.Errorf("Unexpected degraded message %q", msg)
+	}
+}
+
+func TestRunAlertRules(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	var notifications []models.RuleAlertNotification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n models.RuleAlertNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("Invalid notification: %v", err)
+		}
+		notifications = append(notifications, n)
+	}))
+	defer webhook.Close()
+
+	handler.cfg.Alerts = config.AlertsConfig{WebhookURL: webhook.URL, RepeatInterval: time.Hour}
+
+	ago := func(d time.Duration) time.Time { return time.Now().Add(-d) }
+	silencedUntil := time.Now().Add(time.Hour)
+	notifiedAt := ago(time.Minute)
+	outcome := func(appName string, failed bool) models.DeploymentOutcome {
+		o := models.DeploymentOutcome{Domain: "a.com", AppName: appName, CreatedAt: ago(time.Hour)}
+		at := ago(30 * time.Minute)
+		if failed {
+			o.FailedAt = &at
+		} else {
+			o.DeployedAt = &at
+		}
+		return o
+	}
+	db := &ruleDB{
+		alertsDB: &alertsDB{
+			MockDB: &MockDB{},
+			outcomes: []models.DeploymentOutcome{
+				outcome("api", true),
+				outcome("api", true),
+				outcome("api", false),
+				outcome("web", false),
+				outcome("web", true),
+				{Domain: "b.com", AppName: "api", CreatedAt: ago(time.Hour), FailedAt: &notifiedAt},
+			},
+		},
+		rules: []models.AlertRule{
+			{Name: "down", Kind: models.AlertRuleAppDown, ForSeconds: 300},
+			{Name: "flaky", Kind: models.AlertRuleFailureRate, Domain: "a.com", WindowSeconds: 86400, Threshold: 0.6, MinDeployments: 2},
+			{Name: "quiet", Kind: models.AlertRuleAppDown, SilencedUntil: &silencedUntil},
+		},
+		fired: map[[3]string]models.RuleAlert{
+			{"down", "b.com", "db"}: {Rule: "down", Domain: "b.com", AppName: "db", Value: 900, FiringSince: ago(time.Hour), NotifiedAt: &notifiedAt},
+		},
+		incidents: []models.Incident{
+			{Domain: "a.com", AppName: "api", StartedAt: ago(10 * time.Minute)},
+			{Domain: "a.com", AppName: "web", StartedAt: ago(time.Minute)},
+		},
+	}
+	handler.db = db
+
+	for run := 0; run < 2; run++ {
+		if err := handler.RunAlertRules(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if failed := deliverWebhooks(handler, db.MockDB); failed != 0 {
+		t.Fatalf("Expected every notification delivered, %d failed", failed)
+	}
+
+	// down fires on a.com/api and resolves b.com/db, flaky fires on
+	// a.com/api only, and quiet fires on both apps without notifying
+	var got []string
+	for _, n := range notifications {
+		got = append(got, n.Status+" "+n.Rule+" "+n.Domain+"/"+n.AppName)
+	}
+	slices.Sort(got)
+	expected := []string{"firing down a.com/api", "firing flaky a.com/api", "resolved down b.com/db"}
+	if !slices.Equal(got, expected) {
+		t.Fatalf("Expected notifications %v, got %v", expected, got)
+	}
+	if len(db.fired) != 4 {
+		t.Fatalf("Expected down, flaky and twice quiet to fire, got %+v", db.fired)
+	}
+	if quiet := db.fired[[3]string{"quiet", "a.com", "web"}]; quiet.NotifiedAt != nil {
+		t.Errorf("Silenced alert was notified: %+v", quiet)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/alerts/flaky/a.com/api/ack", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/alerts/flaky/a.com/web/ack", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d acknowledging an alert not firing, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Once the repeat interval passes only the unacknowledged alert repeats
+	notifications = nil
+	past := ago(2 * time.Hour)
+	for key, alert := range db.fired {
+		if alert.NotifiedAt != nil {
+			alert.NotifiedAt = &past
+			db.fired[key] = alert
+		}
+	}
+	if err := handler.RunAlertRules(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deliverWebhooks(handler, db.MockDB)
+	if len(notifications) != 1 || notifications[0].Rule != "down" || !notifications[0].Repeat {
+		t.Errorf("Expected one repeat of down, got %+v", notifications)
+	}
+}
+
+func TestPutAlertRule(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.Alerts.Window = 24 * time.Hour
+	handler.cfg.Alerts.MinDeployments = 4
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expected       models.AlertRule
+	}{
+		{
+			name:           "App down",
+			path:           "api-down",
+			body:           `{"kind":"app_down","domain":"Example.com","for_seconds":300}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.AlertRule{Name: "api-down", Kind: models.AlertRuleAppDown, Domain: "example.com", ForSeconds: 300},
+		},
+		{
+			name:           "Failure rate with defaults",
+			path:           "flaky",
+			body:           `{"kind":"failure_rate","threshold":0.25}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.AlertRule{Name: "flaky", Kind: models.AlertRuleFailureRate, WindowSeconds: 86400, Threshold: 0.25, MinDeployments: 4},
+		},
+		{"Unknown kind", "x", `{"kind":"latency"}`, http.StatusBadRequest, models.AlertRule{}},
+		{"Invalid name", "Bad_Name!", `{"kind":"app_down"}`, http.StatusBadRequest, models.AlertRule{}},
+		{"Threshold on app down", "x", `{"kind":"app_down","threshold":0.5}`, http.StatusBadRequest, models.AlertRule{}},
+		{"Missing threshold", "x", `{"kind":"failure_rate"}`, http.StatusBadRequest, models.AlertRule{}},
+		{"Negative duration", "x", `{"kind":"app_down","for_seconds":-1}`, http.StatusBadRequest, models.AlertRule{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/alert-rules/"+tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.AlertRule `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, response.Data)
+			}
+		})
+	}
+}
+
+func TestEnvironmentStatus(t *testing.T) {
+	health := func(status string) *models.AppHealth { return &models.AppHealth{Status: status} }
+	deployed := func(appName string, h *models.AppHealth) models.Deployment {
+		return models.Deployment{Domain: "a.com", AppName: appName, Version: 2, Status: "deployed", Health: h}
+	}
+
+	tests := []struct {
+		name        string
+		deployments []models.Deployment
+		expected    string
+		pending     int
+		degraded    []string
+	}{
+		{
+			name:        "Operational",
+			deployments: []models.Deployment{deployed("api", health(models.HealthHealthy)), deployed("web", nil)},
+			expected:    models.EnvironmentOperational,
+		},
+		{
+			name: "Deploying",
+			deployments: []models.Deployment{
+				deployed("api", health(models.HealthHealthy)),
+				{Domain: "a.com", AppName: "web", Status: "pending"},
+				{Domain: "a.com", AppName: "worker", Status: "deploying"},
+			},
+			expected: models.EnvironmentDeploying,
+			pending:  2,
+		},
+		{
+			name: "Degraded",
+			deployments: []models.Deployment{
+				deployed("api", health(models.HealthUnhealthy)),
+				deployed("web", health(models.HealthStale)),
+				{Domain: "a.com", AppName: "worker", Status: "failed"},
+				{Domain: "a.com", AppName: "cron", Status: "deployed", Verification: models.VerificationDegraded, Health: health(models.HealthHealthy)},
+				{Domain: "a.com", AppName: "queue", Status: "pending"},
+			},
+			expected: models.EnvironmentDegraded,
+			pending:  1,
+			degraded: []string{"api: unhealthy", "web: stale", "worker: failed", "cron: verification degraded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := environmentStatus("a.com", tt.deployments, time.Now())
+			if status.Status != tt.expected || status.Pending != tt.pending || status.Apps != len(tt.deployments) {
+				t.Errorf("Expected %s with %d pending, got %+v", tt.expected, tt.pending, status)
+			}
+			var degraded []string
+			for _, d := range status.Degraded {
+				degraded = append(degraded, d.AppName+": "+d.Reason)
+			}
+			if !slices.Equal(degraded, tt.degraded) {
+				t.Errorf("Expected degraded %v, got %v", tt.degraded, degraded)
+			}
+		})
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		query          string
+		staleAfter     time.Duration
+		expectedStatus int
+	}{
+		{"All apps", "", 2 * time.Minute, http.StatusOK},
+		{"Domain", "?domain=Test.com", 2 * time.Minute, http.StatusOK},
+		{"Passing gate", "?domain=test.com&gate=true", 2 * time.Minute, http.StatusOK},
+		{"Failing gate", "?domain=test.com&gate=true", 30 * time.Second, http.StatusServiceUnavailable},
+		{"Degraded without gate", "?domain=test.com", 30 * time.Second, http.StatusOK},
+		{"Unknown domain", "?domain=other.com", 2 * time.Minute, http.StatusNotFound},
+		{"Invalid gate", "?gate=maybe", 2 * time.Minute, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.cfg.Probes.StaleAfter = tt.staleAfter
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/status"+tt.query, nil)
+			router.ServeHTTP(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRunHealthProbes(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer app.Close()
+	host := strings.TrimPrefix(app.URL, "http://")
+	_, port, _ := net.SplitHostPort(host)
+	appPort, _ := strconv.Atoi(port)
+
+	handler.cfg.Probes = config.ProbesConfig{
+		Enabled:    true,
+		Scheme:     "http",
+		HealthPath: "/{app_name}/healthz",
+		Timeout:    time.Second,
+	}
+
+	up, down, tcp, closed := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	db := &verifyDB{
+		MockDB: &MockDB{},
+		deployments: []models.Deployment{
+			{ID: up, Domain: host, AppName: "api", Status: "deployed"},
+			{ID: down, Domain: host, AppName: "web", Status: "deployed"},
+			{ID: uuid.New(), Domain: host, AppName: "worker", Status: "pending"},
+			{ID: tcp, Domain: "127.0.0.1", AppName: "db", Port: appPort, Status: "deployed"},
+			{ID: closed, Domain: "127.0.0.1", AppName: "cache", Status: "deployed"},
+			{ID: uuid.New(), Domain: host, AppName: "cron", Status: "deployed"},
+			{ID: uuid.New(), Domain: host, AppName: "legacy", Status: "deployed"},
+		},
+		maintenance: []models.AppMaintenance{{Domain: host, AppName: "legacy", Enabled: true}},
+		checks: []models.HealthCheck{
+			{Domain: "127.0.0.1", AppName: "db", Type: models.HealthCheckTCP},
+			{Domain: "127.0.0.1", AppName: "cache", Type: models.HealthCheckTCP, Port: 1},
+			{Domain: host, AppName: "cron", Type: models.HealthCheckExec, Command: []string{"true"}},
+			{Domain: host, AppName: "web", Type: models.HealthCheckHTTP, Path: "/web/ready"},
+		},
+		states:   map[uuid.UUID]string{},
+		messages: map[uuid.UUID]string{},
+	}
+	handler.db = db
+
+	if err := handler.RunHealthProbes(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(db.probes) != 4 {
+		t.Fatalf("Expected the deployed apps without exec checks or maintenance to be probed, got %+v", db.probes)
+	}
+	healthy := map[uuid.UUID]bool{}
+	for _, p := range db.probes {
+		healthy[*p.DeploymentID] = p.Healthy
+		if p.Agent != "controller" {
+			t.Errorf("Unexpected probe agent %q", p.Agent)
+		}
+		// Only the http checks are timed; both got an answer
+		if timed := *p.DeploymentID == up || *p.DeploymentID == down; timed != (p.LatencyMs != nil) {
+			t.Errorf("Unexpected latency %v for deployment %s", p.LatencyMs, *p.DeploymentID)
+		}
+	}
+	if !healthy[up] || healthy[down] || !healthy[tcp] || healthy[closed] {
+		t.Errorf("Expected api and db healthy, web and cache unhealthy, got %v", healthy)
+	}
+}
+
+func TestDeploymentsHealth(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	tests := []struct {
+		name       string
+		staleAfter time.Duration
+		expected   string
+	}{
+		{"Fresh probe", 2 * time.Minute, models.HealthHealthy},
+		{"Stale probe", 30 * time.Second, models.HealthStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.cfg.Probes.StaleAfter = tt.staleAfter
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/deployments", nil)
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+
+			var response struct {
+				Data []models.Deployment `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data) != 1 || response.Data[0].Health == nil {
+				t.Fatalf("Expected the deployment to carry its health, got %+v", response.Data)
+			}
+			if health := response.Data[0].Health; health.Status != tt.expected || health.Agent != "controller" {
+				t.Errorf("Expected %s health from the controller, got %+v", tt.expected, health)
+			}
+		})
+	}
+}
+
+func TestFailureRateAlerts(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	var notifications []models.FailureRateNotification
+	webhookStatus := http.StatusOK
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n models.FailureRateNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("Invalid notification: %v", err)
+		}
+		if webhookStatus == http.StatusOK {
+			notifications = append(notifications, n)
+		}
+		w.WriteHeader(webhookStatus)
+	}))
+	defer webhook.Close()
+
+	handler.cfg.Alerts = config.AlertsConfig{
+		FailureRateThreshold: 0.5,
+		Window:               24 * time.Hour,
+		MinDeployments:       2,
+		WebhookURL:           webhook.URL,
+	}
+
+	hoursAgo := func(h int) *time.Time {
+		t := time.Now().Add(-time.Duration(h) * time.Hour)
+		return &t
+	}
+	outcome := func(domain, appName string, created int, failed bool) models.DeploymentOutcome {
+		o := models.DeploymentOutcome{Domain: domain, AppName: appName, CreatedAt: *hoursAgo(created)}
+		if failed {
+			o.FailedAt = hoursAgo(created - 1)
+		} else {
+			o.DeployedAt = hoursAgo(created - 1)
+		}
+		return o
+	}
+	db := &alertsDB{
+		MockDB: &MockDB{},
+		outcomes: []models.DeploymentOutcome{
+			// Two of three failed, and none the day before
+			outcome("a.com", "api", 30, false),
+			outcome("a.com", "api", 10, false),
+			outcome("a.com", "api", 6, true),
+			outcome("a.com", "api", 3, true),
+			// Recovered while its alert fires
+			outcome("a.com", "web", 30, true),
+			outcome("a.com", "web", 5, false),
+			outcome("a.com", "web", 4, false),
+			// Too few deployments to alert
+			outcome("b.com", "api", 2, true),
+		},
+		alerts: map[[2]string]models.FailureRateAlert{
+			{"a.com", "web"}: {Domain: "a.com", AppName: "web", FailureRate: 1, FiringSince: *hoursAgo(30)},
+		},
+	}
+	handler.db = db
+
+	// Notifications are queued as jobs, so a failing webhook delays their
+	// delivery but not the alerts
+	webhookStatus = http.StatusInternalServerError
+	if err := handler.RunFailureRateAlerts(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := db.alerts[[2]string{"a.com", "api"}]; !ok {
+		t.Fatal("Expected the alert to fire once its notification was queued")
+	}
+	if failed := deliverWebhooks(handler, db.MockDB); failed != 2 {
+		t.Fatalf("Expected both deliveries to fail, %d failed", failed)
+	}
+
+	webhookStatus = http.StatusOK
+	if err := handler.RunFailureRateAlerts(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if failed := deliverWebhooks(handler, db.MockDB); failed != 0 {
+		t.Fatalf("Expected the retried deliveries to succeed, %d failed", failed)
+	}
+
+	if len(notifications) != 2 {
+		t.Fatalf("Expected a firing and a resolved notification, got %+v", notifications)
+	}
+	if n := notifications[0]; n.Status != models.AlertFiring || n.Domain != "a.com" || n.AppName != "api" || n.Changes != 3 || n.Failures != 2 {
+		t.Errorf("Unexpected firing notification %+v", n)
+	}
+	if n := notifications[1]; n.Status != models.AlertResolved || n.AppName != "web" {
+		t.Errorf("Unexpected resolved notification %+v", n)
+	}
+	if len(db.alerts) != 1 {
+		t.Errorf("Expected only a.com/api to alert, got %+v", db.alerts)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/analytics/failure-rates?alerting=true", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data models.FailureRateReport `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Data.Apps) != 1 {
+		t.Fatalf("Expected one alerting app, got %+v", response.Data.Apps)
+	}
+	rate := response.Data.Apps[0]
+	if rate.AppName != "api" || rate.FailureRate == nil || math.Abs(*rate.FailureRate-2.0/3) > 1e-9 ||
+		rate.PreviousFailureRate == nil || *rate.PreviousFailureRate != 0 || rate.FiringSince == nil {
+		t.Errorf("Unexpected failure rate %+v", rate)
+	}
+}
+
+func TestRunMetricsPush(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	var method, path, user string
+	var body []byte
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		user, _, _ = r.BasicAuth()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	handler.cfg.Metrics = config.MetricsConfig{
+		PushgatewayURL: gateway.URL,
+		Job:            "deployments",
+		Username:       "push",
+		Password:       "secret",
+	}
+	if err := handler.RunMetricsPush(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// PUT replaces the job's metrics, dropping apps that disappeared
+	if method != http.MethodPut || path != "/metrics/job/deployments" || user != "push" {
+		t.Fatalf("Unexpected push %s %s as %q", method, path, user)
+	}
+	if !bytes.Contains(body, []byte("deployment_controller_app_status")) {
+		t.Errorf("Push is missing the app metrics")
+	}
+
+	summaries, _ := handler.db.GetAppSummaries(context.Background())
+	families, err := appMetrics(summaries).Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather app metrics: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			// Labels are sorted by name: app_name, domain, status
+			key := family.GetName()
+			for _, label := range m.GetLabel() {
+				key += " " + label.GetValue()
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"deployment_controller_app_status api a.com deployed":                 1,
+		"deployment_controller_app_status api a.com pending":                  0,
+		"deployment_controller_app_status web a.com pending":                  1,
+		"deployment_controller_app_versions api a.com":                        4,
+		"deployment_controller_app_failed_versions api a.com":                 1,
+		"deployment_controller_app_last_deployed_timestamp_seconds api a.com": 1714564800,
+	}
+	for key, want := range expected {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", key, want, got, ok)
+		}
+	}
+	if _, ok := values["deployment_controller_app_last_deployed_timestamp_seconds web a.com"]; ok {
+		t.Error("Never deployed app has a last deployed time")
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 1, 15, 10, 30, 0, 123456789, time.UTC)
+	id := uuid.New()
+
+	cursor, err := decodeCursor(encodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if !cursor.CreatedAt.Equal(createdAt) || cursor.ID != id {
+		t.Errorf("Cursor mismatch: got %v/%v, want %v/%v", cursor.CreatedAt, cursor.ID, createdAt, id)
+	}
+
+	if _, err := decodeCursor("not-a-cursor"); err == nil {
+		t.Errorf("Expected error decoding malformed cursor")
+	}
+}
+
+func TestAsyncPush(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/push?async=true",
+		bytes.NewBufferString(`[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000}]`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Location"), "/api/v1/jobs/") {
+		t.Errorf("Expected Location header pointing at the job, got %q", w.Header().Get("Location"))
+	}
+
+	var response struct {
+		Data struct {
+			JobID uuid.UUID `json:"job_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Data.JobID == uuid.Nil {
+		t.Fatalf("Expected job_id in response: %s", w.Body.String())
+	}
+
+	// Run the queued job the way the worker pool would
+	payload, _ := json.Marshal(pushJobPayload{
+		RequestID:   "req",
+		Deployments: models.DeploymentPushRequest{{Domain: "test.com", AppName: "test-app", DockerImage: "test:latest", Port: 3000}},
+	})
+	var processed []int
+	result, err := handler.RunPushJob(context.Background(), &models.Job{Payload: payload}, func(n int) {
+		processed = append(processed, n)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected job error: %v", err)
+	}
+	if result.(map[string]interface{})["processed_count"] != 1 || len(processed) != 1 {
+		t.Errorf("Unexpected job result %v / progress %v", result, processed)
+	}
+}
+
+func TestAsyncPushPriority(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name             string
+		priorities       []string
+		expectedStatus   int
+		expectedPriority string
+	}{
+		{
+			name:             "Default priority",
+			priorities:       []string{""},
+			expectedStatus:   http.StatusAccepted,
+			expectedPriority: models.PriorityNormal,
+		},
+		{
+			name:             "Bulk batch",
+			priorities:       []string{"bulk", "bulk"},
+			expectedStatus:   http.StatusAccepted,
+			expectedPriority: models.PriorityBulk,
+		},
+		{
+			name:             "Hotfix in a bulk batch",
+			priorities:       []string{"bulk", "hotfix"},
+			expectedStatus:   http.StatusAccepted,
+			expectedPriority: models.PriorityHotfix,
+		},
+		{
+			name:           "Unknown priority",
+			priorities:     []string{"urgent"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []string
+			for i, priority := range tt.priorities {
+				items = append(items, fmt.Sprintf(`{"domain":"test.com","app_name":"app-%d","docker_image":"test:latest","port":3000,"priority":%q}`, i, priority))
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push?async=true", bytes.NewBufferString("["+strings.Join(items, ",")+"]"))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusAccepted {
+				return
+			}
+
+			var response struct {
+				Data struct {
+					Priority string `json:"priority"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.Priority != tt.expectedPriority {
+				t.Errorf("Expected job priority %q, got %q", tt.expectedPriority, response.Data.Priority)
+			}
+		})
+	}
+}
+
+func TestJobActions(t *testing.T) {
+	router, _ := setupTestRouter()
+	id := uuid.New().String()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"Cancel job", "POST", "/api/v1/jobs/" + id + "/cancel", http.StatusOK},
+		{"Retry running job", "POST", "/api/v1/jobs/" + id + "/retry", http.StatusConflict},
+		{"Invalid job ID", "POST", "/api/v1/jobs/not-a-uuid/cancel", http.StatusBadRequest},
+		{"Unknown status filter", "GET", "/api/v1/jobs?status=paused", http.StatusBadRequest},
+		{"Unknown type filter", "GET", "/api/v1/jobs?type=backup", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSweepJobsListed(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.GET("/api/v1/jobs", handler.ListJobs)
+
+	queue := handler.QueueSweep(models.JobTypeRetention)
+	if err := queue(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Still queued, so the next tick adds nothing
+	if err := queue(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.EnqueueJob(ctx, models.JobTypeWebhook, models.PriorityNormal, []byte(`{}`), 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	list := func(query string) []models.Job {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/jobs"+query, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var response struct {
+			Data []models.Job `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return response.Data
+	}
+
+	if jobs := list(""); len(jobs) != 2 {
+		t.Fatalf("Expected the sweep and the webhook delivery to be listed, got %+v", jobs)
+	}
+	sweeps := list("?type=retention")
+	if len(sweeps) != 1 || sweeps[0].Type != models.JobTypeRetention || sweeps[0].Priority != models.PriorityBulk {
+		t.Fatalf("Expected one bulk retention job, got %+v", sweeps)
+	}
+
+	// Once the sweep has run, the next tick queues another
+	claimed, err := store.ClaimJob(ctx, []string{models.JobTypeRetention}, time.Minute)
+	if err != nil || claimed == nil {
+		t.Fatalf("Expected to claim the sweep, got %v, %v", claimed, err)
+	}
+	if err := queue(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sweeps := list("?type=retention"); len(sweeps) != 1 {
+		t.Fatalf("Expected no sweep queued while one runs, got %d", len(sweeps))
+	}
+	if _, err := store.FinishJob(ctx, claimed.ID, claimed.Attempts, models.JobStatusSucceeded, nil, "", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := queue(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sweeps := list("?type=retention"); len(sweeps) != 2 {
+		t.Errorf("Expected a new sweep queued after the last one finished, got %d", len(sweeps))
+	}
+}
+
+func TestPushBuildInfo(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	body := `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000,
+		"git_sha":" 3F2A9C1E ","git_ref":"refs/tags/v1.3.0","build_url":"https://ci.example.com/runs/42","builder":"github-actions"}]`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			Created []models.Deployment `json:"created_deployments"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	expected := models.BuildInfo{
+		GitSHA:   "3f2a9c1e",
+		GitRef:   "refs/tags/v1.3.0",
+		BuildURL: "https://ci.example.com/runs/42",
+		Builder:  "github-actions",
+	}
+	if len(response.Data.Created) != 1 || response.Data.Created[0].BuildInfo != expected {
+		t.Errorf("Expected the normalized build metadata %+v, got %+v", expected, response.Data.Created)
+	}
+}
+
+func TestPushSkipUnchanged(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		expectedStatus int
+		unchanged      int
+	}{
+		{
+			name:           "Identical push is skipped",
+			query:          "?skip_unchanged=true",
+			body:           `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000,"env":["A=1","B=2"]}]`,
+			expectedStatus: http.StatusOK,
+			unchanged:      1,
+		},
+		{
+			name:           "Same image built from another commit creates a version",
+			query:          "?skip_unchanged=true",
+			body:           `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000,"env":["A=1","B=2"],"git_sha":"3f2a9c1"}]`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Changed env creates a version",
+			query:          "?skip_unchanged=true",
+			body:           `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000,"env":["A=1"]}]`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Disabled by default",
+			body:           `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000,"env":["A=1","B=2"]}]`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Invalid flag",
+			query:          "?skip_unchanged=maybe",
+			body:           `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","port":3000}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			var response struct {
+				Data struct {
+					Unchanged []models.Deployment `json:"unchanged_deployments"`
+				} `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if len(response.Data.Unchanged) != tt.unchanged {
+				t.Errorf("Expected %d unchanged deployments, got %d", tt.unchanged, len(response.Data.Unchanged))
+			}
+			if tt.unchanged > 0 && (!response.Data.Unchanged[0].Unchanged || response.Data.Unchanged[0].Version != 2) {
+				t.Errorf("Expected existing version 2 flagged unchanged, got %+v", response.Data.Unchanged[0])
+			}
+		})
+	}
+}
+
+func TestAtomicPush(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		created        int
+		rolledBack     bool
+	}{
+		{
+			name:           "All items succeed",
+			body:           `[{"domain":"test.com","app_name":"app-one","docker_image":"test:latest","port":3000},{"domain":"test.com","app_name":"app-two","docker_image":"test:latest","port":3000}]`,
+			expectedStatus: http.StatusCreated,
+			created:        2,
+		},
+		{
+			name:           "One failure rolls back the batch",
+			body:           `[{"domain":"test.com","app_name":"app-one","docker_image":"test:latest","port":3000},{"domain":"test.com","app_name":"fail-app","docker_image":"test:latest","port":3000}]`,
+			expectedStatus: http.StatusBadRequest,
+			rolledBack:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push?atomic=true", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			var response struct {
+				Data struct {
+					Created    []models.Deployment      `json:"created_deployments"`
+					Failed     []map[string]interface{} `json:"failed_deployments"`
+					RolledBack bool                     `json:"rolled_back"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data.Created) != tt.created || response.Data.RolledBack != tt.rolledBack {
+				t.Errorf("Unexpected result: %s", w.Body.String())
+			}
+			if tt.rolledBack && (len(response.Data.Failed) != 1 || response.Data.Failed[0]["index"] != float64(1)) {
+				t.Errorf("Expected failing item index 1, got %v", response.Data.Failed)
+			}
+		})
+	}
+}
+
+func TestStrictParsing(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	body := `[{"domain":"test.com","app_name":"test-app","docker_image":"test:latest","docker_img":"typo","port":3000}]`
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Lenient by default", header: "", expectedStatus: http.StatusCreated},
+		{name: "Strict rejects unknown field", header: "true", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid header", header: "sometimes", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/push", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(StrictParsingHeader, tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.header == "true" && !strings.Contains(w.Body.String(), "docker_img") {
+				t.Errorf("Expected error to name the unknown field: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateSecret(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/secrets", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create(`{"project":"payments","name":"db-pass","value":"s3cret"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "s3cret") {
+		t.Errorf("Response must not contain the secret value: %s", w.Body.String())
+	}
+
+	stored := handler.db.(*MockDB).secrets["payments/db-pass"]
+	if bytes.Contains(stored, []byte("s3cret")) {
+		t.Errorf("Secret was stored in plaintext")
+	}
+	if plaintext, err := handler.cipher.Decrypt(stored, "payments/db-pass"); err != nil || string(plaintext) != "s3cret" {
+		t.Errorf("Stored secret does not decrypt: %q, %v", plaintext, err)
+	}
+
+	if w := create(`{"project":"payments","name":"db-pass","value":"other"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for duplicate, got %d", http.StatusConflict, w.Code)
+	}
+	if w := create(`{"project":"payments","name":"DB/PASS","value":"x"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid name, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAgentDeploymentResolvesSecrets(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	fetch := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/agent/deployments/"+uuid.New().String(), nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := fetch(); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status code %d for a missing secret, got %d. Response: %s",
+			http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/secrets",
+		bytes.NewBufferString(`{"project":"payments","name":"db-pass","value":"s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	w = fetch()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control: no-store on resolved deployments")
+	}
+
+	var response struct {
+		Data models.Deployment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Data.Env) != 2 || response.Data.Env[0] != "MODE=prod" || response.Data.Env[1] != "DB_PASS=s3cret" {
+		t.Errorf("Unexpected resolved env: %v", response.Data.Env)
+	}
+
+	audit := handler.db.(*MockDB).audit
+	if len(audit) != 1 || audit[0].Action != models.AuditSecretRead || audit[0].Resource != "secret:payments/db-pass" ||
+		audit[0].DeploymentID == nil || *audit[0].DeploymentID != response.Data.ID {
+		t.Errorf("Expected one audited read of the secret, got %+v", audit)
+	}
+}
+
+func TestAgentManifest(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/secrets",
+		bytes.NewBufferString(`{"project":"payments","name":"db-pass","value":"s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		contains       []string
+		excludes       []string
+	}{
+		{
+			name:           "Kubernetes secret with envFrom",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			contains:       []string{"kind: Secret", "DB_PASS: s3cret", "envFrom:", "- name: MODE"},
+			excludes:       []string{"value: s3cret"},
+		},
+		{
+			name:           "Inlined for simple Docker hosts",
+			query:          "?format=compose&inline_secrets=true",
+			expectedStatus: http.StatusOK,
+			contains:       []string{"- MODE=prod", "- DB_PASS=s3cret"},
+			excludes:       []string{"secrets:"},
+		},
+		{
+			name:           "Unsupported format",
+			query:          "?format=swarm",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid inline flag",
+			query:          "?inline_secrets=maybe",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/agent/deployments/"+uuid.New().String()+"/manifest"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.Manifest `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(response.Data.Content, want) {
+					t.Errorf("Expected manifest to contain %q:\n%s", want, response.Data.Content)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(response.Data.Content, unwanted) {
+					t.Errorf("Expected manifest not to contain %q:\n%s", unwanted, response.Data.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestManifestSnapshots(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.GET("/api/v1/deployments/:id/manifests/snapshots", handler.ListManifestSnapshots)
+	router.GET("/api/v1/deployments/:id/manifests/snapshots/:snapshot_id", handler.GetManifestSnapshot)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/secrets",
+		bytes.NewBufferString(`{"project":"payments","name":"db-pass","value":"s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	id := uuid.New()
+	render := func() (string, models.Manifest) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/agent/deployments/"+id.String()+"/manifest", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data models.Manifest `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return w.Header().Get("X-Manifest-Snapshot"), response.Data
+	}
+
+	snapshotID, manifest := render()
+	if again, _ := render(); snapshotID == "" || again != snapshotID {
+		t.Fatalf("Expected repeated renders to share snapshot %q, got %q", snapshotID, again)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/manifests/snapshots/"+snapshotID, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.ManifestSnapshot `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	snapshot := response.Data
+	sum := sha256.Sum256([]byte(manifest.Content))
+	if snapshot.Format != "kubernetes" || snapshot.ContentDigest != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected snapshot %+v", snapshot)
+	}
+	if strings.Contains(snapshot.Content, "s3cret") || !strings.Contains(snapshot.Content, "DB_PASS: '********'") {
+		t.Errorf("Expected secret values masked in the snapshot:\n%s", snapshot.Content)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/manifests/snapshots?format=kubernetes", nil)
+	router.ServeHTTP(w, req)
+	var list struct {
+		Data []models.ManifestSnapshot `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].Content != "" {
+		t.Errorf("Expected one snapshot without content, got %+v", list.Data)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/manifests/snapshots/99", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown snapshot, got %d", w.Code)
+	}
+}
+
+type bundleDB struct {
+	*MockDB
+}
+
+func (m *bundleDB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
+	deployment, err := m.MockDB.GetDeployment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	deployment.DockerImage = "registry.example.com/test-app:1.0.0"
+	deployment.Port = 8080
+	return deployment, nil
+}
+
+func TestDeploymentBundle(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.db = &bundleDB{MockDB: handler.db.(*MockDB)}
+	router.GET("/api/v1/deployments/:id/bundle", handler.GetDeploymentBundle)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/secrets",
+		bytes.NewBufferString(`{"project":"payments","name":"db-pass","value":"s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	id := uuid.New()
+	bundle := func(query string) map[string]string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/bundle"+query, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="test-app-v1.tar.gz"` {
+			t.Errorf("Unexpected Content-Disposition %q", got)
+		}
+
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Expected a gzip body: %v", err)
+		}
+		files := map[string]string{}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Failed to read bundle: %v", err)
+			}
+			content, _ := io.ReadAll(tr)
+			files[header.Name] = string(content)
+		}
+		return files
+	}
+
+	files := bundle("")
+	if got := files["test-app-v1/.env"]; got != "MODE=prod\nDB_PASS=s3cret\n" {
+		t.Errorf("Unexpected .env %q", got)
+	}
+	if !strings.Contains(files["test-app-v1/deployment.json"], `"app_name": "test-app"`) {
+		t.Errorf("Expected the deployment JSON, got %q", files["test-app-v1/deployment.json"])
+	}
+	for _, name := range []string{"manifests/kubernetes/manifest.yaml", "manifests/compose/docker-compose.yml",
+		"manifests/compose/secrets/DB_PASS", "manifests/nomad/job.nomad.hcl", "manifests/nomad/variable.json",
+		"manifests/helm-values/values.yaml", "manifests/helm-values/secrets.yaml"} {
+		if _, ok := files["test-app-v1/"+name]; !ok {
+			t.Errorf("Expected %s in the bundle, got %v", name, slices.Sorted(maps.Keys(files)))
+		}
+	}
+
+	files = bundle("?exclude_secrets=true")
+	if got := files["test-app-v1/.env"]; got != "MODE=prod\n" {
+		t.Errorf("Expected secrets left out of .env, got %q", got)
+	}
+	for name, content := range files {
+		if strings.Contains(content, "s3cret") {
+			t.Errorf("Expected no secret values in %s", name)
+		}
+	}
+}
+
+type replayDB struct {
+	*MockDB
+	events []models.DeploymentEvent
+}
+
+func (m *replayDB) ListDeploymentEvents(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error) {
+	return m.events, nil
+}
+
+func TestReplayDeploymentEvents(t *testing.T) {
+	router, handler := setupTestRouter()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := &replayDB{MockDB: handler.db.(*MockDB)}
+	for i, eventType := range []string{models.EventStatusChanged, models.EventVerified, models.EventRolledBack} {
+		db.events = append(db.events, models.DeploymentEvent{
+			ID:        uuid.New(),
+			Type:      eventType,
+			Message:   fmt.Sprintf("event %d", i),
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	handler.db = db
+	router.POST("/api/v1/deployments/:id/events/replay", handler.ReplayDeploymentEvents)
+
+	var received []models.EventReplayNotification
+	failAt := -1
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(received) == failAt {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var n models.EventReplayNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("Invalid notification: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer webhook.Close()
+
+	id := uuid.New()
+	replay := func(body string) (int, models.EventReplay) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/deployments/"+id.String()+"/events/replay", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.EventReplay `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	if code, _ := replay(`{"url":"ftp://example.com/hook"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-http URL, got %d", code)
+	}
+
+	failAt = 1
+	code, result := replay(`{"url":"` + webhook.URL + `"}`)
+	if code != http.StatusBadGateway {
+		t.Fatalf("Expected 502 when the webhook fails, got %d", code)
+	}
+	if result.Delivered != 1 || result.Total != 3 || result.ResumeSince == nil || !result.ResumeSince.Equal(db.events[1].CreatedAt) {
+		t.Errorf("Unexpected failed replay %+v", result)
+	}
+
+	failAt = -1
+	code, result = replay(`{"url":"` + webhook.URL + `","since":"` + result.ResumeSince.Format(time.RFC3339) + `"}`)
+	if code != http.StatusOK || result.Delivered != 2 || result.Total != 2 || result.Error != "" {
+		t.Fatalf("Expected the resumed replay to deliver the rest, got %d %+v", code, result)
+	}
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 notifications, got %d", len(received))
+	}
+	for i, n := range received {
+		if n.EventID != db.events[i].ID || !n.Replayed || n.DeploymentID != id || n.AppName != "test-app" || n.Version != 1 {
+			t.Errorf("Unexpected notification %d: %+v", i, n)
+		}
+	}
+}
+
+type backupDB struct {
+	*MockDB
+	tables   map[string][]json.RawMessage
+	restored map[string][]json.RawMessage
+}
+
+func (m *backupDB) Backup(ctx context.Context) (map[string][]json.RawMessage, error) {
+	return maps.Clone(m.tables), nil
+}
+
+func (m *backupDB) RestoreBackup(ctx context.Context, tables map[string][]json.RawMessage, failOnConflict, dryRun bool) ([]models.RestoreTableResult, error) {
+	var results []models.RestoreTableResult
+	conflicts := false
+	for _, table := range slices.Sorted(maps.Keys(tables)) {
+		_, exists := m.tables[table]
+		result := models.RestoreTableResult{Table: table, Rows: len(tables[table]), Restored: len(tables[table])}
+		if exists {
+			result.Skipped, result.Restored = result.Rows, 0
+			conflicts = true
+		}
+		results = append(results, result)
+	}
+	if failOnConflict && conflicts {
+		return results, fmt.Errorf("backup conflicts with existing rows")
+	}
+	if !dryRun {
+		m.restored = tables
+	}
+	return results, nil
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	router, handler := setupTestRouter()
+	db := &backupDB{MockDB: handler.db.(*MockDB), tables: map[string][]json.RawMessage{
+		"deployments":        {json.RawMessage(`{"id":"7f9c0e52-3c5e-4a4b-9a57-0d1c1b0c2d3e","app_name":"test-app"}`)},
+		"docker_credentials": {json.RawMessage(`{"registry":"registry.example.com","username":"ci","password":"hunter2"}`)},
+	}}
+	handler.db = db
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-Test-Reveal") == "true" {
+			c.Set(RevealScopeKey, true)
+		}
+	})
+	router.GET("/api/v1/admin/backup", handler.Backup)
+	router.POST("/api/v1/admin/restore", handler.Restore)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/admin/backup", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without the reveal token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req.Header.Set("X-Test-Reveal", "true")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.Bytes()
+	if bytes.Contains(body, []byte("hunter2")) {
+		t.Errorf("Backup contains a plaintext registry password")
+	}
+	var backup models.Backup
+	if err := json.Unmarshal(body, &backup); err != nil || !backup.CredentialsEncrypted || len(backup.Tables["deployments"]) != 1 {
+		t.Fatalf("Unexpected backup %s: %v", body, err)
+	}
+	if len(db.audit) != 1 || db.audit[0].Action != models.AuditBackupRead {
+		t.Errorf("Expected the backup to be audited, got %+v", db.audit)
+	}
+
+	restore := func(query string, body []byte) (int, models.RestoreResult) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/admin/restore"+query, bytes.NewReader(body))
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.RestoreResult `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	if code, _ := restore("?conflicts=merge", body); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown conflict mode, got %d", code)
+	}
+	if code, _ := restore("", []byte(`{"deployments":[]}`)); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a document that isn't a backup, got %d", code)
+	}
+
+	code, result := restore("?conflicts=fail", body)
+	if code != http.StatusConflict || len(result.Tables) != 2 || result.Tables[0].Skipped != 1 {
+		t.Errorf("Expected 409 with per-table conflicts, got %d %+v", code, result)
+	}
+	if db.restored != nil {
+		t.Errorf("Expected nothing restored on conflict")
+	}
+
+	db.tables = map[string][]json.RawMessage{}
+	code, result = restore("?dry_run=true", body)
+	if code != http.StatusOK || !result.DryRun || result.Tables[0].Restored != 1 || db.restored != nil {
+		t.Errorf("Expected a dry run to change nothing, got %d %+v", code, result)
+	}
+
+	code, _ = restore("", body)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	var credential struct {
+		Password string `json:"password"`
+	}
+	json.Unmarshal(db.restored["docker_credentials"][0], &credential)
+	if credential.Password != "hunter2" {
+		t.Errorf("Expected the registry password decrypted on restore, got %q", credential.Password)
+	}
+
+	db.freeze = &models.WriteFreeze{Enabled: true}
+	if code, _ := restore("", body); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during a write freeze, got %d", code)
+	}
+}
+
+type housekeepingDB struct {
+	*MockDB
+	held     bool
+	vacuumed []string
+}
+
+func (m *housekeepingDB) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	if m.held {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func (m *housekeepingDB) VacuumAnalyze(ctx context.Context, table string) error {
+	if table == "jobs" {
+		return fmt.Errorf("failed to vacuum jobs: lock timeout")
+	}
+	m.vacuumed = append(m.vacuumed, table)
+	return nil
+}
+
+func (m *housekeepingDB) RefreshDeploymentStats(ctx context.Context) error { return nil }
+
+func (m *housekeepingDB) RefreshAnalytics(ctx context.Context) error { return nil }
+
+func (m *housekeepingDB) GetTableSizes(ctx context.Context) ([]models.TableSize, error) {
+	return []models.TableSize{{Table: "deployments", TotalBytes: 8192, Indexes: []models.IndexSize{{Name: "deployments_pkey", Bytes: 4096}}}}, nil
+}
+
+func TestRunHousekeeping(t *testing.T) {
+	router, handler := setupTestRouter()
+	db := &housekeepingDB{MockDB: handler.db.(*MockDB)}
+	handler.db = db
+	router.POST("/api/v1/admin/maintenance", handler.RunHousekeeping)
+
+	run := func() (int, models.HousekeepingReport) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/admin/maintenance", nil)
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.HousekeepingReport `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, report := run()
+	if code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500 when a step fails, got %d", code)
+	}
+	if len(report.Steps) != len(database.HotTables)+2 || len(db.vacuumed) != len(database.HotTables)-1 {
+		t.Errorf("Expected the remaining steps to run after a failure, got %+v", report.Steps)
+	}
+	for _, step := range report.Steps {
+		if (step.Error != "") != (step.Name == "vacuum jobs") {
+			t.Errorf("Unexpected step %+v", step)
+		}
+	}
+	if len(report.Tables) != 1 || report.Tables[0].Indexes[0].Name != "deployments_pkey" {
+		t.Errorf("Expected table sizes in the report, got %+v", report.Tables)
+	}
+
+	db.held = true
+	if code, _ := run(); code != http.StatusConflict {
+		t.Errorf("Expected 409 while another run holds the lock, got %d", code)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.Features = config.FeaturesConfig{config.FeatureImageUpdates: false}
+	router.GET("/api/v1/version", handler.GetVersion)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/version", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Data models.VersionInfo `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	want := map[string]bool{"enable_gitops": true, "enable_image_updates": false}
+	if response.Data.Version != Version || !maps.Equal(response.Data.Features, want) {
+		t.Errorf("Unexpected version info %+v", response.Data)
+	}
+}
+
+type requeueDB struct {
+	*MockDB
+	status string
+	before time.Time
+	dryRun bool
+}
+
+func (m *requeueDB) RequeueDeployments(ctx context.Context, status string, before time.Time, domain string, limit int, dryRun bool, actor string) ([]models.StuckDeployment, error) {
+	m.status, m.before, m.dryRun = status, before, dryRun
+	return []models.StuckDeployment{
+		{ID: uuid.New(), Domain: "test.com", AppName: "test-app", Version: 2, Status: status},
+		{ID: uuid.New(), Domain: "test.com", AppName: "test-app", Version: 1, Status: status, Skipped: "superseded by version 2"},
+	}, nil
+}
+
+func TestRequeueDeployments(t *testing.T) {
+	router, handler := setupTestRouter()
+	db := &requeueDB{MockDB: handler.db.(*MockDB)}
+	handler.db = db
+	router.POST("/api/v1/admin/deployments/requeue", handler.RequeueDeployments)
+
+	requeue := func(query string) (int, models.RequeueResult) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/admin/deployments/requeue"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.RequeueResult `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	for _, query := range []string{"", "?older_than=soon", "?older_than=30m&status=deployed", "?older_than=30m&limit=0"} {
+		if code, _ := requeue(query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, code)
+		}
+	}
+
+	code, result := requeue("?older_than=30m&dry_run=true")
+	if code != http.StatusOK || !result.DryRun || !db.dryRun || db.status != "deploying" {
+		t.Fatalf("Expected a dry run of deploying deployments, got %d %+v", code, result)
+	}
+	if since := time.Since(db.before); since < 30*time.Minute || since > 31*time.Minute {
+		t.Errorf("Expected deployments stuck since 30m ago, got %s", since)
+	}
+	if result.Requeued != 1 || result.Skipped != 1 || result.OlderThan != "30m" {
+		t.Errorf("Unexpected requeue result %+v", result)
+	}
+
+	if code, _ := requeue("?older_than=1d&status=failed"); code != http.StatusOK || db.dryRun || db.status != "failed" {
+		t.Errorf("Expected failed deployments requeued, got %d", code)
+	}
+}
+
+type stuckDB struct {
+	*MockDB
+	marked map[string]string
+	before map[string]time.Time
+}
+
+func (m *stuckDB) MarkStuckDeployments(ctx context.Context, status string, before time.Time, to string, failure *models.DeploymentFailure, limit int) ([]models.StuckDeployment, error) {
+	m.marked[status], m.before[status] = to, before
+	if (to == "failed") != (failure != nil && failure.Code == models.FailureStuck) {
+		return nil, fmt.Errorf("unexpected failure %+v for %s", failure, to)
+	}
+	if status != "deploying" {
+		return []models.StuckDeployment{}, nil
+	}
+	return []models.StuckDeployment{{ID: uuid.New(), Domain: "test.com", AppName: "test-app", Version: 3, Status: status}}, nil
+}
+
+func TestRunWatchdog(t *testing.T) {
+	_, handler := setupTestRouter()
+	db := &stuckDB{MockDB: handler.db.(*MockDB), marked: map[string]string{}, before: map[string]time.Time{}}
+	handler.db = db
+
+	var received []models.StuckDeploymentNotification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n models.StuckDeploymentNotification
+		json.NewDecoder(r.Body).Decode(&n)
+		received = append(received, n)
+	}))
+	defer webhook.Close()
+	handler.cfg.Alerts.WebhookURL = webhook.URL
+	handler.cfg.Watchdog = config.WatchdogConfig{Deploying: time.Hour, Action: "stall"}
+
+	if err := handler.RunWatchdog(context.Background()); err != nil {
+		t.Fatalf("Watchdog failed: %v", err)
+	}
+	deliverWebhooks(handler, db.MockDB)
+	if len(db.marked) != 1 || db.marked["deploying"] != "stalled" {
+		t.Errorf("Expected only deploying checked with pending off, got %v", db.marked)
+	}
+	if since := time.Since(db.before["deploying"]); since < time.Hour || since > time.Hour+time.Minute {
+		t.Errorf("Expected deployments stuck for an hour, got %s", since)
+	}
+	if len(received) != 1 || received[0].Event != "deployment_stuck" || received[0].NewStatus != "stalled" || received[0].Threshold != "1h" {
+		t.Errorf("Unexpected notifications %+v", received)
+	}
+
+	handler.cfg.Watchdog = config.WatchdogConfig{Deploying: time.Hour, Pending: 24 * time.Hour, Action: "fail"}
+	if err := handler.RunWatchdog(context.Background()); err != nil {
+		t.Fatalf("Watchdog failed: %v", err)
+	}
+	if db.marked["deploying"] != "failed" || db.marked["pending"] != "failed" {
+		t.Errorf("Expected stuck deployments failed, got %v", db.marked)
+	}
+}
+
+type orphanDB struct {
+	*MockDB
+	deletedRegistries []string
+	deletedLogs       bool
+
+	// images and stale replace the default deployment images and stale
+	// registries when set
+	images, stale []string
+}
+
+func (m *orphanDB) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	return true, fn(ctx)
+}
+
+func (m *orphanDB) ListMissingSecretProjects(ctx context.Context, limit int) ([]models.MissingSecretProject, error) {
+	return []models.MissingSecretProject{{DeploymentID: uuid.New(), Domain: "test.com", AppName: "test-app", Version: 2, Project: "payments"}}, nil
+}
+
+func (m *orphanDB) ListDeploymentImages(ctx context.Context) ([]string, error) {
+	if m.images != nil {
+		return m.images, nil
+	}
+	return []string{"nginx:1.25", "ghcr.io/org/app:v2", "registry.example.com:5000/Bad Image"}, nil
+}
+
+func (m *orphanDB) ListStaleRegistries(ctx context.Context, before time.Time) ([]string, error) {
+	if m.stale != nil {
+		return m.stale, nil
+	}
+	return []string{"docker.io", "ghcr.io", "quay.io", "registry.example.com:5000"}, nil
+}
+
+func (m *orphanDB) DeleteRegistryCredentials(ctx context.Context, registries []string, before time.Time) (int64, error) {
+	m.deletedRegistries = registries
+	return int64(len(registries)), nil
+}
+
+func (m *orphanDB) ListDanglingLogs(ctx context.Context) ([]models.DanglingLog, error) {
+	return []models.DanglingLog{{DeploymentID: uuid.New(), Chunks: 3}}, nil
+}
+
+func (m *orphanDB) DeleteDanglingLogs(ctx context.Context) (int64, error) {
+	m.deletedLogs = true
+	return 3, nil
+}
+
+func TestUnusedRegistriesNormalizeHosts(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	tests := []struct {
+		name     string
+		images   []string
+		stale    []string
+		expected []string
+	}{
+		{"Docker Hub aliases", []string{"nginx:1.25"}, []string{"index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/"}, []string{}},
+		{"Host case", []string{"GHCR.io/org/app:v2"}, []string{"ghcr.io", "Quay.io"}, []string{"Quay.io"}},
+		{"Stored in upper case", []string{"ghcr.io/org/app:v2"}, []string{"GHCR.IO"}, []string{}},
+		{"Aliased image", []string{"index.docker.io/library/nginx:1.25"}, []string{"docker.io"}, []string{}},
+		{"Unparseable image", []string{"Registry.Example.com:5000/Bad Image"}, []string{"registry.example.com:5000"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.db = &orphanDB{MockDB: &MockDB{}, images: tt.images, stale: tt.stale}
+			unused, err := handler.unusedRegistries(context.Background(), time.Now())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(unused, tt.expected) {
+				t.Errorf("Expected unused %v, got %v", tt.expected, unused)
+			}
+		})
+	}
+}
+
+func TestOrphanedData(t *testing.T) {
+	router, handler := setupTestRouter()
+	db := &orphanDB{MockDB: handler.db.(*MockDB)}
+	handler.db = db
+	router.GET("/api/v1/admin/orphans", handler.GetOrphans)
+	router.POST("/api/v1/admin/orphans/cleanup", handler.CleanOrphans)
+
+	call := func(method, path string) (int, models.OrphanReport) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.OrphanReport `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, report := call("GET", "/api/v1/admin/orphans")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if !slices.Equal(report.UnusedRegistries, []string{"quay.io"}) {
+		t.Errorf("Expected only quay.io unused, got %v", report.UnusedRegistries)
+	}
+	if len(report.MissingProjects) != 1 || len(report.DanglingLogs) != 1 || report.Cleaned {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if db.deletedRegistries != nil || db.deletedLogs {
+		t.Fatal("Expected the report to delete nothing")
+	}
+
+	// The periodic check only reports without orphans.cleanup
+	if err := handler.RunOrphanCheck(context.Background()); err != nil {
+		t.Fatalf("Orphan check failed: %v", err)
+	}
+	if db.deletedRegistries != nil || db.deletedLogs {
+		t.Fatal("Expected no cleanup without orphans.cleanup")
+	}
+
+	code, report = call("POST", "/api/v1/admin/orphans/cleanup")
+	if code != http.StatusOK || !report.Cleaned {
+		t.Fatalf("Expected the cleanup to run, got %d %+v", code, report)
+	}
+	if !slices.Equal(db.deletedRegistries, []string{"quay.io"}) || !db.deletedLogs {
+		t.Errorf("Expected quay.io and the dangling logs deleted, got %v %v", db.deletedRegistries, db.deletedLogs)
+	}
+}
+
+func TestReplayPush(t *testing.T) {
+	router, handler := setupTestRouter()
+	db := handler.db.(*MockDB)
+	router.POST("/api/v1/requests/:request_id/replay", handler.ReplayPush)
+
+	type pushResult struct {
+		RequestID string              `json:"request_id"`
+		ReplayOf  string              `json:"replay_of"`
+		Created   []models.Deployment `json:"created_deployments"`
+		Rolled    bool                `json:"rolled_back"`
+	}
+	send := func(method, path, body string) (int, pushResult) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Data pushResult `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	// A rolled back atomic push is replayed whole, still atomic
+	code, pushed := send("POST", "/api/v1/push?atomic=true", `[{"domain":"test.com","app_name":"app-one","docker_image":"test:latest","port":3000},{"domain":"test.com","app_name":"fail-app","docker_image":"test:latest","port":3000}]`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected the atomic push to fail, got %d", code)
+	}
+	if stored := db.pushes[pushed.RequestID]; len(stored.Deployments) != 2 || !slices.Equal(stored.Failed, []int{0, 1}) {
+		t.Fatalf("Expected the batch stored with every item failed, got %+v", stored)
+	}
+	code, replayed := send("POST", "/api/v1/requests/"+pushed.RequestID+"/replay?failed_only=true", "")
+	if code != http.StatusBadRequest || !replayed.Rolled || replayed.ReplayOf != pushed.RequestID || replayed.RequestID == pushed.RequestID {
+		t.Errorf("Expected an atomic replay under a new request, got %d %+v", code, replayed)
+	}
+
+	// Only the failed items of a partial push are replayed
+	db.pushes["partial"] = models.PushRequest{
+		RequestID: "partial",
+		Deployments: models.DeploymentPushRequest{
+			{Domain: "test.com", AppName: "app-one", DockerImage: "test:latest", Port: 3000},
+			{Domain: "test.com", AppName: "app-two", DockerImage: "test:latest", Port: 3000},
+		},
+		Options: json.RawMessage(`{}`),
+		Failed:  []int{1},
+	}
+	code, replayed = send("POST", "/api/v1/requests/partial/replay?failed_only=true", "")
+	if code != http.StatusCreated || len(replayed.Created) != 1 || replayed.Created[0].AppName != "app-two" {
+		t.Fatalf("Expected only app-two replayed, got %d %+v", code, replayed)
+	}
+	if stored := db.pushes[replayed.RequestID]; stored.ReplayOf != "partial" || len(stored.Deployments) != 1 {
+		t.Errorf("Expected the replay stored as a new request, got %+v", stored)
+	}
+	if code, replayed = send("POST", "/api/v1/requests/partial/replay", ""); code != http.StatusCreated || len(replayed.Created) != 2 {
+		t.Errorf("Expected the whole batch replayed, got %d %+v", code, replayed)
+	}
+
+	if code, _ := send("POST", "/api/v1/requests/"+replayed.RequestID+"/replay?failed_only=true", ""); code != http.StatusConflict {
+		t.Errorf("Expected 409 without failed items, got %d", code)
+	}
+	if code, _ := send("POST", "/api/v1/requests/missing/replay", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request, got %d", code)
+	}
+}
+
+func TestPutSchedule(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Nightly schedule",
+			path:           "/api/v1/schedules/test.com/test-app",
+			body:           `{"cron":"0 3 * * *"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Descriptor",
+			path:           "/api/v1/schedules/TEST.com/test-app",
+			body:           `{"cron":"@daily","paused":true}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid cron expression",
+			path:           "/api/v1/schedules/test.com/test-app",
+			body:           `{"cron":"every night"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown app",
+			path:           "/api/v1/schedules/test.com/other-app",
+			body:           `{"cron":"@daily"}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid app name",
+			path:           "/api/v1/schedules/test.com/Test_App",
+			body:           `{"cron":"@daily"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.Schedule `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.Domain != "test.com" || !response.Data.NextRunAt.After(time.Now()) {
+				t.Errorf("Unexpected schedule: %+v", response.Data)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusFailure(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       *models.DeploymentFailure
+	}{
+		{
+			name:           "Failure with details",
+			body:           `{"status":"failed","error_code":"image_pull_error","error_message":"manifest unknown","details":{"image":"test:latest","attempts":3}}`,
+			expectedStatus: http.StatusOK,
+			expected: &models.DeploymentFailure{Code: "image_pull_error", Message: "manifest unknown",
+				Details: map[string]any{"image": "test:latest", "attempts": float64(3)}},
+		},
+		{
+			name:           "Failure without a reason",
+			body:           `{"status":"failed"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Error code on another status",
+			body:           `{"status":"deployed","error_code":"port_in_use"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Message without a code",
+			body:           `{"status":"failed","error_message":"port 3000 in use"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Malformed code",
+			body:           `{"status":"failed","error_code":"Port In Use"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Details not an object",
+			body:           `{"status":"failed","error_code":"port_in_use","details":[3000]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Oversized details",
+			body:           `{"status":"failed","error_code":"port_in_use","details":{"log":"` + strings.Repeat("x", 20000) + `"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PATCH", "/api/v1/deployments/"+uuid.New().String()+"/status", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", "*")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.Deployment `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Data.Failure, tt.expected) {
+				t.Errorf("Expected failure %+v, got %+v", tt.expected, response.Data.Failure)
+			}
+		})
+	}
+}
+
+func TestPutRetryPolicy(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       models.RetryPolicy
+	}{
+		{
+			name:           "Defaults",
+			body:           `{"max_attempts":3}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.RetryPolicy{MaxAttempts: 3, InitialBackoffSeconds: 30, MaxBackoffSeconds: 3600, RetryOn: []string{}},
+		},
+		{
+			name:           "Explicit backoff and jitter",
+			body:           `{"max_attempts":5,"initial_backoff_seconds":10,"max_backoff_seconds":300,"jitter":0.2}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.RetryPolicy{MaxAttempts: 5, InitialBackoffSeconds: 10, MaxBackoffSeconds: 300, Jitter: 0.2, RetryOn: []string{}},
+		},
+		{
+			name:           "Retried error codes",
+			body:           `{"max_attempts":3,"retry_on":["image_pull_error","health_check_timeout"]}`,
+			expectedStatus: http.StatusOK,
+			expected: models.RetryPolicy{MaxAttempts: 3, InitialBackoffSeconds: 30, MaxBackoffSeconds: 3600,
+				RetryOn: []string{"image_pull_error", "health_check_timeout"}},
+		},
+		{
+			name:           "Malformed error code",
+			body:           `{"max_attempts":3,"retry_on":["ImagePull"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Too many attempts",
+			body:           `{"max_attempts":50}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Max backoff below initial",
+			body:           `{"max_attempts":3,"initial_backoff_seconds":60,"max_backoff_seconds":10}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Jitter out of range",
+			body:           `{"max_attempts":3,"jitter":1.5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/retry-policies/test.com/test-app", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.RetryPolicy `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			tt.expected.Domain, tt.expected.AppName = "test.com", "test-app"
+			if !reflect.DeepEqual(response.Data, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, response.Data)
+			}
+		})
+	}
+}
+
+func TestPutRolloutLimit(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expected       models.RolloutLimit
+	}{
+		{
+			name:           "Domain-wide limit",
+			path:           "/api/v1/rollout-limits/Test.COM",
+			body:           `{"max_deploying":2}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.RolloutLimit{Domain: "test.com", MaxDeploying: 2},
+		},
+		{
+			name:           "App limit",
+			path:           "/api/v1/rollout-limits/test.com/test-app",
+			body:           `{"max_deploying":1}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.RolloutLimit{Domain: "test.com", AppName: "test-app", MaxDeploying: 1},
+		},
+		{
+			name:           "Missing limit",
+			path:           "/api/v1/rollout-limits/test.com",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Negative limit",
+			path:           "/api/v1/rollout-limits/test.com/test-app",
+			body:           `{"max_deploying":-1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid app name",
+			path:           "/api/v1/rollout-limits/test.com/Bad_App",
+			body:           `{"max_deploying":1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.RolloutLimit `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, response.Data)
+			}
+		})
+	}
+}
+
+func TestReportDeploymentChecks(t *testing.T) {
+	router, _ := setupTestRouter()
+	id := uuid.New()
+
+	tests := []struct {
+		name           string
+		id             uuid.UUID
+		body           string
+		expectedStatus int
+		expectedHeld   bool
+	}{
+		{
+			name:           "One check green",
+			id:             id,
+			body:           `{"checks":[{"name":"build","status":"success"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedHeld:   true,
+		},
+		{
+			name:           "All checks green",
+			id:             id,
+			body:           `{"checks":[{"name":"build","status":"success"},{"name":"test","status":"success","details_url":"https://ci.example.com/runs/1"}]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Failed check",
+			id:             id,
+			body:           `{"checks":[{"name":"build","status":"success"},{"name":"test","status":"failure"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedHeld:   true,
+		},
+		{
+			name:           "Unknown status",
+			id:             id,
+			body:           `{"checks":[{"name":"build","status":"green"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Check the deployment was not pushed with",
+			id:             id,
+			body:           `{"checks":[{"name":"lint","status":"success"}]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "No checks",
+			id:             id,
+			body:           `{"checks":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing deployment",
+			id:             missingDeploymentID,
+			body:           `{"checks":[{"name":"build","status":"success"}]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/deployments/"+tt.id.String()+"/checks", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.DeploymentChecks `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.Held != tt.expectedHeld {
+				t.Errorf("Expected held %v, got %+v", tt.expectedHeld, response.Data)
+			}
+		})
+	}
+}
+
+func TestGitWebhook(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.git = gitsync.New(config.GitSyncConfig{Repo: "https://git.example.com/deployments.git", Branch: "main"})
+	handler.cfg.GitSync.WebhookSecret = "webhook-secret"
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("webhook-secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "GitHub push to the synced branch",
+			body:           `{"ref":"refs/heads/main"}`,
+			headers:        map[string]string{"X-Hub-Signature-256": sign(`{"ref":"refs/heads/main"}`)},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "GitLab push to the synced branch",
+			body:           `{"ref":"refs/heads/main"}`,
+			headers:        map[string]string{"X-Gitlab-Token": "webhook-secret"},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Push to another branch",
+			body:           `{"ref":"refs/heads/feature"}`,
+			headers:        map[string]string{"X-Hub-Signature-256": sign(`{"ref":"refs/heads/feature"}`)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Signature for another body",
+			body:           `{"ref":"refs/heads/main"}`,
+			headers:        map[string]string{"X-Hub-Signature-256": sign(`{}`)},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong GitLab token",
+			body:           `{"ref":"refs/heads/main"}`,
+			headers:        map[string]string{"X-Gitlab-Token": "guess"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Unsigned",
+			body:           `{"ref":"refs/heads/main"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/webhooks/git", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Each accepted push queued a sync for the worker pool
+	if queued := handler.db.(*MockDB).takeJobs(models.JobTypeGitSync); len(queued) != 2 {
+		t.Errorf("Expected 2 git sync jobs queued, got %d", len(queued))
+	}
+}
+
+func TestRunGitSyncJobWhileSyncRuns(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.git = gitsync.New(config.GitSyncConfig{Repo: "https://git.example.com/deployments.git", Branch: "main"})
+
+	// The mock's lock is always held elsewhere: the job fails so the pool
+	// retries it, rather than the push being dropped
+	_, err := handler.RunGitSyncJob(context.Background(), &models.Job{ID: uuid.New(), Type: models.JobTypeGitSync}, func(int) {})
+	if err == nil || err.Error() != "a git sync is already running" {
+		t.Errorf("Expected the job to fail while a sync runs, got %v", err)
+	}
+}
+
+func TestDockerHubWebhook(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.Registry.WebhookSecret = "registry-secret"
+
+	tests := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Push to a followed repository",
+			token:          "registry-secret",
+			body:           `{"push_data":{"tag":"1.0.1"},"repository":{"repo_name":"library/test"}}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Push to another repository",
+			token:          "registry-secret",
+			body:           `{"push_data":{"tag":"1.0.1"},"repository":{"repo_name":"acme/other"}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Missing tag",
+			token:          "registry-secret",
+			body:           `{"repository":{"repo_name":"library/test"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Callback outside Docker Hub",
+			token:          "registry-secret",
+			body:           `{"callback_url":"https://internal.example.com/","push_data":{"tag":"1.0.1"},"repository":{"repo_name":"library/test"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong token",
+			token:          "guess",
+			body:           `{"push_data":{"tag":"1.0.1"},"repository":{"repo_name":"library/test"}}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/webhooks/dockerhub?token="+tt.token, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegistryEventWebhooks(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.cfg.Registry.WebhookSecret = "registry-secret"
+	handler.cfg.Registry.FlagDeletedImages = true
+
+	tests := []struct {
+		name           string
+		path           string
+		authorization  string
+		body           string
+		expectedStatus int
+		expectedFlags  int
+	}{
+		{
+			name:           "Harbor push to a followed repository",
+			path:           "/api/v1/webhooks/harbor",
+			authorization:  "registry-secret",
+			body:           `{"type":"PUSH_ARTIFACT","event_data":{"resources":[{"tag":"1.0.1","resource_url":"docker.io/library/test:1.0.1"}],"repository":{"repo_full_name":"library/test"}}}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Harbor deletion of the deployed tag",
+			path:           "/api/v1/webhooks/harbor",
+			authorization:  "registry-secret",
+			body:           `{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"tag":"latest","resource_url":"docker.io/library/test:latest"}],"repository":{"repo_full_name":"library/test"}}}`,
+			expectedStatus: http.StatusOK,
+			expectedFlags:  1,
+		},
+		{
+			name:           "Harbor deletion of another tag",
+			path:           "/api/v1/webhooks/harbor",
+			authorization:  "registry-secret",
+			body:           `{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"tag":"0.9.0","resource_url":"docker.io/library/test:0.9.0"}],"repository":{"repo_full_name":"library/test"}}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Harbor event without images",
+			path:           "/api/v1/webhooks/harbor",
+			authorization:  "registry-secret",
+			body:           `{"type":"SCANNING_COMPLETED"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Harbor with a wrong secret",
+			path:           "/api/v1/webhooks/harbor",
+			authorization:  "guess",
+			body:           `{"type":"PUSH_ARTIFACT"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Deletion of the deployed digest",
+			path:           "/api/v1/webhooks/registry",
+			authorization:  "Bearer registry-secret",
+			body:           `{"events":[{"action":"delete","target":{"repository":"library/test","digest":"sha256:1111111111111111111111111111111111111111111111111111111111111111"},"request":{"host":"docker.io"}}]}`,
+			expectedStatus: http.StatusOK,
+			expectedFlags:  1,
+		},
+		{
+			name:           "Layer push",
+			path:           "/api/v1/webhooks/registry",
+			authorization:  "Bearer registry-secret",
+			body:           `{"events":[{"action":"push","target":{"repository":"library/test","digest":"sha256:2222222222222222222222222222222222222222222222222222222222222222"},"request":{"host":"docker.io"}}]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Tagged manifest push",
+			path:           "/api/v1/webhooks/registry",
+			authorization:  "Bearer registry-secret",
+			body:           `{"events":[{"action":"push","target":{"repository":"library/test","tag":"1.0.1","url":"https://docker.io/v2/library/test/manifests/1.0.1"}}]}`,
+			expectedStatus: http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", tt.authorization)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized {
+				return
+			}
+
+			var response struct {
+				Data models.RegistryWebhookResult `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Data.Flagged) != tt.expectedFlags {
+				t.Errorf("Expected %d flagged deployments, got %v", tt.expectedFlags, response.Data.Flagged)
+			}
+
+			// Pushes followed by a policy are checked by a queued job
+			queued := handler.db.(*MockDB).takeJobs(models.JobTypeImageUpdate)
+			if w.Code == http.StatusAccepted {
+				if len(queued) != 1 || response.Data.JobID == nil || *response.Data.JobID != queued[0].ID {
+					t.Fatalf("Expected the response to name the one queued image update job, got %v and %+v", response.Data.JobID, queued)
+				}
+				var payload imageUpdateJobPayload
+				if err := json.Unmarshal(queued[0].Payload, &payload); err != nil || len(payload.Policies) != len(response.Data.Checking) {
+					t.Errorf("Expected the job to check %v, got %s", response.Data.Checking, queued[0].Payload)
+				}
+			} else if len(queued) != 0 || response.Data.JobID != nil {
+				t.Errorf("Expected no image update job, got %+v", queued)
+			}
+		})
+	}
+}
+
+func TestPutImagePolicy(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       models.ImagePolicy
+	}{
+		{
+			name:           "Semver range",
+			body:           `{"kind":"semver","pattern":"^1.2.0"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.ImagePolicy{Kind: models.ImagePolicySemver, Pattern: "^1.2.0"},
+		},
+		{
+			name:           "Regex",
+			body:           `{"kind":"regex","pattern":"^main-(\\d+)$"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.ImagePolicy{Kind: models.ImagePolicyRegex, Pattern: `^main-(\d+)$`},
+		},
+		{
+			name:           "Digest",
+			body:           `{"kind":"digest"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.ImagePolicy{Kind: models.ImagePolicyDigest},
+		},
+		{
+			name:           "Unknown kind",
+			body:           `{"kind":"newest"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid range",
+			body:           `{"kind":"semver","pattern":">=banana"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid regex",
+			body:           `{"kind":"regex","pattern":"("}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Pattern on digest policy",
+			body:           `{"kind":"digest","pattern":"latest"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/image-policies/test.com/test-app", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.ImagePolicy `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			tt.expected.Domain, tt.expected.AppName = "test.com", "test-app"
+			if response.Data != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, response.Data)
+			}
+		})
+	}
+}
+
+func TestPutHealthCheck(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       models.HealthCheck
+	}{
+		{
+			name:           "HTTP check",
+			body:           `{"type":"http","path":"/ready"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/ready"},
+		},
+		{
+			name:           "TCP check",
+			body:           `{"type":"tcp","port":5432}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.HealthCheck{Type: models.HealthCheckTCP, Port: 5432},
+		},
+		{
+			name:           "Exec check",
+			body:           `{"type":"exec","command":["pg_isready","-q"]}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.HealthCheck{Type: models.HealthCheckExec, Command: []string{"pg_isready", "-q"}},
+		},
+		{
+			name:           "Unknown type",
+			body:           `{"type":"grpc"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Relative path",
+			body:           `{"type":"http","path":"ready"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Port out of range",
+			body:           `{"type":"tcp","port":70000}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Exec without command",
+			body:           `{"type":"exec"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Command on tcp check",
+			body:           `{"type":"tcp","command":["true"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/health-checks/test.com/test-app", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.HealthCheck `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			got := response.Data
+			if got.Domain != "test.com" || got.AppName != "test-app" || got.Type != tt.expected.Type ||
+				got.Path != tt.expected.Path || got.Port != tt.expected.Port || !slices.Equal(got.Command, tt.expected.Command) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/health-checks?type=grpc", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown type filter, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// smokeDB tracks smoke test runs and the deployments rollbacks change
+type smokeDB struct {
+	*MockDB
+	due         []models.SmokeTestRun
+	running     []models.SmokeTestRun
+	deployments []models.Deployment
+	results     map[uuid.UUID]models.SmokeTestResult
+	statuses    map[uuid.UUID]string
+	created     []models.DeploymentRequest
+	events      map[uuid.UUID][]string
+}
+
+func (m *smokeDB) ListDueSmokeTests(ctx context.Context, since time.Time) ([]models.SmokeTestRun, error) {
+	return m.due, nil
+}
+
+func (m *smokeDB) ListRunningSmokeTests(ctx context.Context, testType string) ([]models.SmokeTestRun, error) {
+	return m.running, nil
+}
+
+func (m *smokeDB) StartSmokeTest(ctx context.Context, deploymentID uuid.UUID, agent string) (bool, error) {
+	if _, ok := m.results[deploymentID]; ok {
+		return false, nil
+	}
+	m.results[deploymentID] = models.SmokeTestResult{DeploymentID: deploymentID, Status: models.SmokeRunning, Agent: agent}
+	return true, nil
+}
+
+func (m *smokeDB) FinishSmokeTest(ctx context.Context, deploymentID uuid.UUID, status, message, agent string) (*models.SmokeTestResult, error) {
+	result := models.SmokeTestResult{DeploymentID: deploymentID, Status: status, Message: message, Agent: agent}
+	m.results[deploymentID] = result
+	return &result, nil
+}
+
+func (m *smokeDB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
+	for _, d := range m.deployments {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf("deployment not found")
+}
+
+// GetLatestDeployment treats the first deployment of an app as its latest
+func (m *smokeDB) GetLatestDeployment(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	for _, d := range m.deployments {
+		if d.Domain == domain && d.AppName == appName {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf("deployment not found")
+}
+
+func (m *smokeDB) GetDeploymentHistory(ctx context.Context, domain, appName string, rng models.DateRange, metadata models.MetadataFilter, after *models.Cursor, limit int) ([]models.Deployment, error) {
+	var history []models.Deployment
+	for _, d := range m.deployments {
+		if d.Domain == domain && d.AppName == appName {
+			history = append(history, d)
+		}
+	}
+	return history, nil
+}
+
+func (m *smokeDB) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error) {
+	m.statuses[id] = status
+	return &models.Deployment{ID: id, Status: status, DeployedAt: deployedAt}, nil
+}
+
+func (m *smokeDB) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
+	m.created = append(m.created, req)
+	return &models.Deployment{ID: uuid.New(), Domain: req.Domain, AppName: req.AppName, Version: 4, Status: "pending"}, nil
+}
+
+func (m *smokeDB) AddDeploymentEvent(ctx context.Context, deploymentID uuid.UUID, eventType, message string) error {
+	m.events[deploymentID] = append(m.events[deploymentID], eventType)
+	return nil
+}
+
+func TestRunSmokeTests(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/smoke":
+			fmt.Fprint(w, `{"status":"ok"}`)
+		case "/web/smoke":
+			fmt.Fprint(w, `{"status":"starting"}`)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer app.Close()
+	host := strings.TrimPrefix(app.URL, "http://")
+
+	handler.cfg.Probes = config.ProbesConfig{Scheme: "http"}
+	handler.cfg.Smoke = config.SmokeConfig{Window: time.Hour, Timeout: time.Second, AgentTimeout: 10 * time.Minute}
+
+	deployedAt := time.Now().Add(-time.Minute)
+	api, web, previous, cron, stuck := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	startedAt := time.Now().Add(-time.Hour)
+	db := &smokeDB{
+		MockDB: &MockDB{},
+		due: []models.SmokeTestRun{
+			{DeploymentID: api, Domain: host, AppName: "api", Test: models.SmokeTest{
+				Type: models.SmokeTestHTTP, Method: http.MethodGet, Path: "/{app_name}/smoke", ExpectedBody: "ok", Rollback: true,
+			}},
+			{DeploymentID: web, Domain: host, AppName: "web", Version: 3, Test: models.SmokeTest{
+				Type: models.SmokeTestHTTP, Method: http.MethodGet, Path: "/{app_name}/smoke", ExpectedBody: "ok", Rollback: true,
+			}},
+			{DeploymentID: cron, Domain: host, AppName: "cron", Test: models.SmokeTest{
+				Type: models.SmokeTestExec, Command: []string{"./smoke.sh"},
+			}},
+		},
+		running: []models.SmokeTestRun{
+			{DeploymentID: stuck, Domain: host, AppName: "worker", StartedAt: &startedAt, Test: models.SmokeTest{
+				Type: models.SmokeTestExec, Command: []string{"./smoke.sh"},
+			}},
+		},
+		deployments: []models.Deployment{
+			{ID: web, Domain: host, AppName: "web", DockerImage: "web:3", Port: 8080, Version: 3, Status: "deployed", DeployedAt: &deployedAt},
+			{ID: uuid.New(), Domain: host, AppName: "web", DockerImage: "web:broken", Port: 8080, Version: 2, Status: "failed"},
+			{ID: previous, Domain: host, AppName: "web", DockerImage: "web:1", Port: 8080, Env: []string{"MODE=prod"}, Version: 1, Status: "deployed"},
+		},
+		results:  map[uuid.UUID]models.SmokeTestResult{},
+		statuses: map[uuid.UUID]string{},
+		events:   map[uuid.UUID][]string{},
+	}
+	handler.db = db
+
+	if err := handler.RunSmokeTests(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := db.results[api]; got.Status != models.SmokePassed || got.Agent != "controller" {
+		t.Errorf("Expected the api test to pass, got %+v", got)
+	}
+	if got := db.results[web]; got.Status != models.SmokeFailed || !strings.Contains(got.Message, "without") {
+		t.Errorf("Expected the web test to fail on its body, got %+v", got)
+	}
+	if got := db.results[cron]; got.Status != models.SmokeRunning || got.Agent != "" {
+		t.Errorf("Expected the exec test to be left running for agents, got %+v", got)
+	}
+	if got := db.results[stuck]; got.Status != models.SmokeFailed {
+		t.Errorf("Expected the exec test past the agent timeout to fail, got %+v", got)
+	}
+
+	if db.statuses[web] != "rolled_back" {
+		t.Errorf("Expected the failed deployment to be rolled back, got statuses %v", db.statuses)
+	}
+	if len(db.created) != 1 || db.created[0].DockerImage != "web:1" || !slices.Equal(db.created[0].Env, []string{"MODE=prod"}) {
+		t.Fatalf("Expected the last deployed version to be restored, got %+v", db.created)
+	}
+	if !slices.Equal(db.events[web], []string{models.EventRolledBack}) || len(db.events) != 2 {
+		t.Errorf("Expected both deployments annotated, got %v", db.events)
+	}
+}
+
+// degradedDB verifies smokeDB's deployments, reporting failed probes for
+// those listed in failing and none for the rest
+type degradedDB struct {
+	*smokeDB
+	failing map[uuid.UUID]bool
+	states  map[uuid.UUID]string
+}
+
+func (m *degradedDB) ListVerifyingDeployments(ctx context.Context, since time.Time) ([]models.Deployment, error) {
+	var verifying []models.Deployment
+	for _, d := range m.deployments {
+		if d.Verification == models.VerificationVerifying {
+			verifying = append(verifying, d)
+		}
+	}
+	return verifying, nil
+}
+
+func (m *degradedDB) CountDeploymentProbes(ctx context.Context, id uuid.UUID, from, to time.Time) (total, unhealthy int, err error) {
+	if m.failing[id] {
+		return 3, 3, nil
+	}
+	return 0, 0, nil
+}
+
+func (m *degradedDB) SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error {
+	m.states[id] = verification
+	return nil
+}
+
+func TestVerificationRollback(t *testing.T) {
+	_, handler := setupTestRouter()
+	handler.cfg.Verify = config.VerifyConfig{Enabled: true, Window: 5 * time.Minute, Rollback: true}
+
+	deployedAt := time.Now().Add(-10 * time.Minute)
+	web, silent := uuid.New(), uuid.New()
+	db := &degradedDB{
+		smokeDB: &smokeDB{
+			MockDB: &MockDB{},
+			deployments: []models.Deployment{
+				{ID: web, Domain: "a.com", AppName: "web", DockerImage: "web:2", Version: 2, Status: "deployed",
+					DeployedAt: &deployedAt, Verification: models.VerificationVerifying},
+				{ID: uuid.New(), Domain: "a.com", AppName: "web", DockerImage: "web:1", Version: 1, Status: "deployed"},
+				{ID: silent, Domain: "a.com", AppName: "api", DockerImage: "api:2", Version: 2, Status: "deployed",
+					DeployedAt: &deployedAt, Verification: models.VerificationVerifying},
+				{ID: uuid.New(), Domain: "a.com", AppName: "api", DockerImage: "api:1", Version: 1, Status: "deployed"},
+			},
+			statuses: map[uuid.UUID]string{},
+			events:   map[uuid.UUID][]string{},
+		},
+		failing: map[uuid.UUID]bool{web: true},
+		states:  map[uuid.UUID]string{},
+	}
+	handler.db = db
+
+	if err := handler.RunVerification(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if db.states[web] != models.VerificationDegraded || db.states[silent] != models.VerificationDegraded {
+		t.Fatalf("Expected both deployments degraded, got %v", db.states)
+	}
+	if db.statuses[web] != "rolled_back" || db.statuses[silent] != "" {
+		t.Errorf("Expected only the deployment with failed probes rolled back, got %v", db.statuses)
+	}
+	if len(db.created) != 1 || db.created[0].DockerImage != "web:1" {
+		t.Errorf("Expected web:1 to be restored, got %+v", db.created)
+	}
+	if !slices.Equal(db.events[web], []string{models.EventRolledBack}) {
+		t.Errorf("Expected the degraded deployment annotated, got %v", db.events)
+	}
+}
+
+func TestPutSmokeTest(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       models.SmokeTest
+	}{
+		{
+			name:           "HTTP test",
+			body:           `{"type":"http","path":"/smoke","expected_status":204,"rollback":true}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.SmokeTest{Type: models.SmokeTestHTTP, Method: http.MethodGet, Path: "/smoke", ExpectedStatus: 204, Rollback: true},
+		},
+		{
+			name:           "HTTP test with method and body",
+			body:           `{"type":"http","method":"post","path":"/smoke","expected_body":"ok"}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.SmokeTest{Type: models.SmokeTestHTTP, Method: http.MethodPost, Path: "/smoke", ExpectedBody: "ok"},
+		},
+		{
+			name:           "Exec test",
+			body:           `{"type":"exec","command":["./smoke.sh"]}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.SmokeTest{Type: models.SmokeTestExec, Command: []string{"./smoke.sh"}},
+		},
+		{
+			name:           "Unknown type",
+			body:           `{"type":"grpc"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "HTTP test without path",
+			body:           `{"type":"http"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown method",
+			body:           `{"type":"http","method":"TRACE","path":"/smoke"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Status out of range",
+			body:           `{"type":"http","path":"/smoke","expected_status":42}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Exec without command",
+			body:           `{"type":"exec"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Path on exec test",
+			body:           `{"type":"exec","command":["./smoke.sh"],"path":"/smoke"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/smoke-tests/test.com/test-app", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.SmokeTest `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			got := response.Data
+			if got.Domain != "test.com" || got.AppName != "test-app" || got.Type != tt.expected.Type ||
+				got.Method != tt.expected.Method || got.Path != tt.expected.Path ||
+				got.ExpectedStatus != tt.expected.ExpectedStatus || got.ExpectedBody != tt.expected.ExpectedBody ||
+				got.Rollback != tt.expected.Rollback || !slices.Equal(got.Command, tt.expected.Command) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetMaintenance(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		ifMatch        string
+		expectedStatus int
+		enabled        bool
+	}{
+		{"Start maintenance", "test.com/test-app", `{"enabled":true,"reason":"database migration"}`, "*", http.StatusOK, true},
+		{"End maintenance", "test.com/test-app", `{"enabled":false}`, "*", http.StatusOK, false},
+		{"Missing If-Match", "test.com/test-app", `{"enabled":true}`, "", http.StatusPreconditionRequired, false},
+		{"Missing enabled", "test.com/test-app", `{"reason":"database migration"}`, "*", http.StatusBadRequest, false},
+		{"Reason when ending", "test.com/test-app", `{"enabled":false,"reason":"done"}`, "*", http.StatusBadRequest, false},
+		{"Unknown app", "test.com/missing-app", `{"enabled":true}`, "*", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PATCH", "/api/v1/apps/"+tt.path+"/maintenance", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.AppMaintenance `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			got := response.Data
+			if got.Domain != "test.com" || got.AppName != "test-app" || got.Enabled != tt.enabled || (got.StartedAt != nil) != tt.enabled {
+				t.Errorf("Unexpected maintenance %+v", got)
+			}
+			if tt.enabled && got.Reason != "database migration" {
+				t.Errorf("Expected the reason kept, got %q", got.Reason)
+			}
+		})
+	}
+}
+
+func TestMaintenanceETag(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.GET("/api/v1/apps/:domain/:app_name/maintenance", handler.GetMaintenance)
+	router.PATCH("/api/v1/apps/:domain/:app_name/maintenance", handler.SetMaintenance)
+
+	if _, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	serve := func(method, body, ifMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1/apps/example.com/web/maintenance", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("GET", "", "")
+	off := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || off == "" {
+		t.Fatalf("Expected an ETag on the maintenance mode, got %d with %q", w.Code, off)
+	}
+
+	w = serve("PATCH", `{"enabled":true,"reason":"database migration"}`, off)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	on := w.Header().Get("ETag")
+	if on == "" || on == off {
+		t.Fatalf("Expected a new ETag once maintenance started, got %q", on)
+	}
+
+	// A client still holding the ETag from before maintenance started
+	if w := serve("PATCH", `{"enabled":false}`, off); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale ETag to fail with %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := serve("GET", "", ""); w.Header().Get("ETag") != on {
+		t.Errorf("Expected maintenance left on after the failed precondition, got ETag %q", w.Header().Get("ETag"))
+	}
+
+	if w := serve("PATCH", `{"enabled":false}`, on); w.Code != http.StatusOK || w.Header().Get("ETag") != off {
+		t.Errorf("Expected maintenance to end with the current ETag, got %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestPutApp(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/apps/test.com/test-app", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d. Response: %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+
+	current := `{"docker_image":"test:latest","port":3000,"env":["A=1","B=2"]}`
+	changed := `{"docker_image":"test:v2","port":3000,"env":["A=1","B=2"]}`
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "Unchanged", path: "test.com/test-app", body: current, expectedStatus: http.StatusOK},
+		{name: "Changed", path: "test.com/test-app", body: changed, expectedStatus: http.StatusCreated},
+		{name: "New app", path: "test.com/new-app", body: current, expectedStatus: http.StatusCreated},
+		{name: "Create-only on existing app", path: "test.com/test-app", body: current, headers: map[string]string{"If-None-Match": "*"}, expectedStatus: http.StatusConflict},
+		{name: "Create-only on new app", path: "test.com/new-app", body: current, headers: map[string]string{"If-None-Match": "*"}, expectedStatus: http.StatusCreated},
+		{name: "Update-only on missing app", path: "test.com/new-app", body: current, headers: map[string]string{"If-Match": "*"}, expectedStatus: http.StatusNotFound},
+		{name: "Matching ETag", path: "test.com/test-app", body: changed, headers: map[string]string{"If-Match": etag}, expectedStatus: http.StatusCreated},
+		{name: "Stale ETag", path: "test.com/test-app", body: changed, headers: map[string]string{"If-Match": `"stale"`}, expectedStatus: http.StatusPreconditionFailed},
+		{name: "Invalid image", path: "test.com/test-app", body: `{"docker_image":"Not An Image","port":3000}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/v1/apps/"+tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+				return
+			}
+
+			var response struct {
+				Data models.AppState `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Data.ID != tt.path {
+				t.Errorf("Expected ID %s, got %s", tt.path, response.Data.ID)
+			}
+		})
+	}
+}
+
+func TestCompareObserved(t *testing.T) {
+	now := time.Now()
+	deployment := &models.Deployment{
+		ID:          uuid.New(),
+		Domain:      "test.com",
+		AppName:     "test-app",
+		DockerImage: "docker.io/library/test:latest",
+		Version:     2,
+		Status:      "deployed",
+	}
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tracked := map[string]models.ImageDigest{
+		"test.com/test-app": {DeploymentID: deployment.ID, DeployedDigest: digest},
+	}
+	desired := desiredState(deployment, tracked)
+	if desired.Digest != digest || desired.Replicas != 1 {
+		t.Fatalf("Unexpected desired state %+v", desired)
+	}
+
+	tests := []struct {
+		name       string
+		status     string
+		observed   *models.ObservedState
+		state      string
+		mismatches []string
+	}{
+		{name: "Unreported", status: "deployed", state: models.ObservedUnreported},
+		{
+			name:     "In sync",
+			status:   "deployed",
+			observed: &models.ObservedState{DeploymentID: &deployment.ID, DockerImage: "test:latest", Digest: digest, Replicas: 1, ReportedAt: now},
+			state:    models.ObservedInSync,
+		},
+		{
+			name:       "Tag moved",
+			status:     "deployed",
+			observed:   &models.ObservedState{DockerImage: "test:latest", Digest: "sha256:" + strings.Repeat("b", 64), Replicas: 1, ReportedAt: now},
+			state:      models.ObservedMismatched,
+			mismatches: []string{"digest"},
+		},
+		{
+			name:       "Old version while rolling out",
+			status:     "deploying",
+			observed:   &models.ObservedState{DockerImage: "test:v1", Replicas: 0, ReportedAt: now},
+			state:      models.ObservedRollingOut,
+			mismatches: []string{"docker_image", "replicas"},
+		},
+		{
+			name:     "Stale report",
+			status:   "deployed",
+			observed: &models.ObservedState{DockerImage: "test:latest", Replicas: 1, ReportedAt: now.Add(-time.Hour)},
+			state:    models.ObservedStale,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := desired
+			desired.Status = tt.status
+			comparison := compareObserved(desired, deployment, tt.observed, 5*time.Minute, now)
+
+			if comparison.State != tt.state {
+				t.Errorf("Expected state %s, got %s", tt.state, comparison.State)
+			}
+			var fields []string
+			for _, m := range comparison.Mismatches {
+				fields = append(fields, m.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.mismatches, ",") {
+				t.Errorf("Expected mismatches %v, got %v", tt.mismatches, fields)
+			}
+		})
+	}
+}
+
+func TestSealedValues(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/sealing/public-key", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data models.SealingKey `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(response.Data.PublicKey)
+	if err != nil {
+		t.Fatalf("Invalid public key: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		body           func(sealed string) string
+		context        string
+		expectedStatus int
+	}{
+		{
+			name: "Sealed secret value",
+			path: "/api/v1/secrets",
+			body: func(sealed string) string {
+				return `{"project":"payments","name":"api-key","sealed_value":"` + sealed + `"}`
+			},
+			context:        "payments/api-key",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Secret sealed for another name",
+			path: "/api/v1/secrets",
+			body: func(sealed string) string {
+				return `{"project":"payments","name":"api-key","sealed_value":"` + sealed + `"}`
+			},
+			context:        "payments/other",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Sealed env value",
+			path: "/api/v1/push",
+			body: func(sealed string) string {
+				return `[{"domain":"sealed.example.com","app_name":"app","docker_image":"test:latest","port":8080,"env":[{"name":"API_KEY","sealed_value":"` + sealed + `"}]}]`
+			},
+			context:        "API_KEY",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Env value sealed for another variable",
+			path: "/api/v1/push",
+			body: func(sealed string) string {
+				return `[{"domain":"sealed.example.com","app_name":"app","docker_image":"test:latest","port":8080,"env":[{"name":"API_KEY","sealed_value":"` + sealed + `"}]}]`
+			},
+			context:        "DB_PASS",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := secrets.Seal(publicKey, []byte("s3cret"), tt.context)
+			if err != nil {
+				t.Fatalf("Failed to seal: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body(sealed)))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "s3cret") {
+				t.Errorf("Response leaked the plaintext: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+// rotationMockDB serves a fixed set of latest deployments referencing secrets
+type rotationMockDB struct {
+	*MockDB
+	latest []models.Deployment
+}
+
+func (m *rotationMockDB) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	return append([]models.Deployment(nil), m.latest...), nil
+}
+
+func TestRotateSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := &rotationMockDB{
+		MockDB: &MockDB{secrets: map[string][]byte{"payments/db-pass": []byte("sealed")}},
+		latest: []models.Deployment{
+			{Domain: "a.com", AppName: "floating", Env: []string{"DB_PASS=${secret:payments/db-pass}"}},
+			{Domain: "b.com", AppName: "pinned", Env: []string{"DB_PASS=${secret:payments/db-pass@1}"}},
+			{Domain: "c.com", AppName: "other", Env: []string{"DB_PASS=${secret:payments/other}", "A=1"}},
+		},
+	}
+	handler := New(db, slog.New(slog.NewJSONHandler(os.Stdout, nil)), &config.Config{
+		Security: config.SecurityConfig{EncryptionKey: "test-encryption-key"},
+	})
+
+	router := gin.New()
+	router.POST("/api/v1/secrets/:project/:name/rotate", handler.RotateSecret)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/secrets/payments/db-pass/rotate", bytes.NewBufferString(`{"value":"n3w-s3cret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d. Response: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data models.SecretRotation `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	rotation := response.Data
+	if rotation.Secret.Version != 2 || rotation.RequestID == "" {
+		t.Errorf("Unexpected rotation: %+v", rotation)
+	}
+	if len(rotation.Redeployed) != 1 || rotation.Redeployed[0].AppName != "floating" || rotation.Redeployed[0].RequestID != rotation.RequestID {
+		t.Errorf("Expected only the floating app to be redeployed, got %+v", rotation.Redeployed)
+	}
+	if len(rotation.Pinned) != 1 || rotation.Pinned[0].AppName != "pinned" {
+		t.Errorf("Expected the pinned app to be reported, got %+v", rotation.Pinned)
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := &rotationMockDB{
+		MockDB: &MockDB{},
+		latest: []models.Deployment{
+			{Domain: "a.com", AppName: "app", Env: []string{"MODE=prod", "DB_PASSWORD=hunter2"}},
+		},
+	}
+	handler := New(db, slog.New(slog.NewJSONHandler(os.Stdout, nil)), &config.Config{
+		Security: config.SecurityConfig{RedactPatterns: []string{"PASSWORD", "TOKEN", "KEY"}},
+	})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-Test-Reveal") == "true" {
+			c.Set(RevealScopeKey, true)
+		}
+	})
+	router.GET("/api/v1/deployments", handler.GetDeployments)
+
+	for _, reveal := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/deployments", nil)
+		req.Header.Set("X-Test-Reveal", fmt.Sprint(reveal))
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if leaked := strings.Contains(w.Body.String(), "hunter2"); leaked != reveal {
+			t.Errorf("reveal=%v: unexpected env in response: %s", reveal, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), "MODE=prod") {
+			t.Errorf("reveal=%v: plain value was masked: %s", reveal, w.Body.String())
+		}
+	}
+
+	if db.latest[0].Env[1] != "DB_PASSWORD=hunter2" {
+		t.Errorf("Redaction modified the stored deployment")
+	}
+}
+
+// Note: These tests are basic examples. In a real implementation, you would:
+// 1. Create proper interfaces for the database layer
+// 2. Use dependency injection to inject mock implementations
+// 3. Add more comprehensive test cases
+// 4. Test error conditions and edge cases
+// 5. Use testify/mock for more sophisticated mocking
+
+// logDB keeps deployment log chunks in memory, sequenced like the store
+type logDB struct {
+	*MockDB
+	mu     sync.Mutex
+	chunks []models.DeploymentLogChunk
+	status string
+}
+
+func (m *logDB) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
+	deployment, err := m.MockDB.GetDeployment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status != "" {
+		deployment.Status = m.status
+	}
+	return deployment, nil
+}
+
+func (m *logDB) AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if chunk.DeploymentID == missingDeploymentID {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	var size int64
+	for _, stored := range m.chunks {
+		if stored.Seq == chunk.Seq {
+			if stored.Content != chunk.Content {
+				return nil, fmt.Errorf("log chunk conflicts with the stored chunk")
+			}
+			return &stored, nil
+		}
+		size += int64(len(stored.Content))
+	}
+	if next := int64(len(m.chunks)); chunk.Seq != next {
+		return nil, fmt.Errorf("log chunk out of sequence: expected seq %d", next)
+	}
+	if size+int64(len(chunk.Content)) > maxBytes {
+		return nil, fmt.Errorf("log size limit exceeded")
+	}
+	chunk.CreatedAt = time.Now()
+	m.chunks = append(m.chunks, chunk)
+	return &chunk, nil
+}
+
+func (m *logDB) ListDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chunks := []models.DeploymentLogChunk{}
+	for _, chunk := range m.chunks {
+		if chunk.Seq >= fromSeq && (toSeq < 0 || chunk.Seq <= toSeq) && len(chunks) < limit {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+func TestUploadDeploymentLog(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.db = &logDB{MockDB: &MockDB{}}
+	router.POST("/api/v1/deployments/:id/logs", handler.UploadDeploymentLog)
+
+	id := uuid.New().String()
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{"First chunk", id, `{"seq":0,"content":"pulling image\n"}`, http.StatusCreated},
+		{"Retried chunk", id, `{"seq":0,"content":"pulling image\n"}`, http.StatusCreated},
+		{"Conflicting chunk", id, `{"seq":0,"content":"other\n"}`, http.StatusConflict},
+		{"Skipped seq", id, `{"seq":2,"content":"started\n"}`, http.StatusConflict},
+		{"Next chunk", id, `{"seq":1,"content":"starting\n"}`, http.StatusCreated},
+		{"Log too large", id, `{"seq":2,"content":"health check ok\n"}`, http.StatusRequestEntityTooLarge},
+		{"Chunk too large", id, `{"seq":2,"content":"a much longer line of output\n"}`, http.StatusRequestEntityTooLarge},
+		{"Negative seq", id, `{"seq":-1,"content":"x"}`, http.StatusBadRequest},
+		{"Missing seq", id, `{"content":"x"}`, http.StatusBadRequest},
+		{"Unknown deployment", missingDeploymentID.String(), `{"seq":0,"content":"x"}`, http.StatusNotFound},
+		{"Invalid ID", "not-a-uuid", `{"seq":0,"content":"x"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/deployments/"+tt.id+"/logs", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/deployments/"+id+"/logs", bytes.NewBufferString(`{"seq":5,"content":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "expected seq 2") {
+		t.Errorf("Expected the next seq in the conflict, got %s", w.Body.String())
+	}
+}
+
+func TestGetDeploymentLogs(t *testing.T) {
+	router, handler := setupTestRouter()
+	id := uuid.New()
+	handler.db = &logDB{MockDB: &MockDB{}, chunks: []models.DeploymentLogChunk{
+		{DeploymentID: id, Seq: 0, Content: "pulling\n"},
+		{DeploymentID: id, Seq: 1, Content: "starting\n"},
+		{DeploymentID: id, Seq: 2, Content: "crashed\n"},
+	}}
+	router.GET("/api/v1/deployments/:id/logs", handler.GetDeploymentLogs)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		seqs           []int64
+		next           int64
+	}{
+		{"All chunks", "", http.StatusOK, []int64{0, 1, 2}, 3},
+		{"From seq", "?from_seq=1", http.StatusOK, []int64{1, 2}, 3},
+		{"Range", "?from_seq=1&to_seq=1", http.StatusOK, []int64{1}, 2},
+		{"Limit", "?limit=2", http.StatusOK, []int64{0, 1}, 2},
+		{"Past the end", "?from_seq=7", http.StatusOK, []int64{}, 7},
+		{"Negative from_seq", "?from_seq=-1", http.StatusBadRequest, nil, 0},
+		{"Limit too large", "?limit=5000", http.StatusBadRequest, nil, 0},
+		{"Unknown format", "?format=xml", http.StatusBadRequest, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/logs"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.DeploymentLog `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			seqs := []int64{}
+			for _, chunk := range response.Data.Chunks {
+				seqs = append(seqs, chunk.Seq)
+			}
+			if !slices.Equal(seqs, tt.seqs) || response.Data.NextSeq != tt.next {
+				t.Errorf("Expected seqs %v and next %d, got %v and %d", tt.seqs, tt.next, seqs, response.Data.NextSeq)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/logs?from_seq=1&format=text", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "starting\ncrashed\n" || w.Header().Get("X-Next-Seq") != "3" {
+		t.Errorf("Unexpected text log %d %q (next %q)", w.Code, w.Body.String(), w.Header().Get("X-Next-Seq"))
+	}
+}
+
+func TestStreamDeploymentLogs(t *testing.T) {
+	router, handler := setupTestRouter()
+	id := uuid.New()
+	db := &logDB{MockDB: &MockDB{}, status: "failed", chunks: []models.DeploymentLogChunk{
+		{DeploymentID: id, Seq: 0, Content: "pulling\n"},
+		{DeploymentID: id, Seq: 1, Content: "starting\n"},
+		{DeploymentID: id, Seq: 2, Content: "crashed\n"},
+	}}
+	handler.db = db
+	router.GET("/api/v1/deployments/:id/logs/stream", handler.StreamDeploymentLogs)
+
+	tests := []struct {
+		name           string
+		query          string
+		lastEventID    string
+		expectedStatus int
+		expected       string
+		events         int
+	}{
+		{"Finished deployment", "", "", http.StatusOK,
+			"id: 0\nevent: log\n" + `data: {"deployment_id":"` + id.String() + `","seq":0,"content":"pulling\n"`, 3},
+		{"From seq", "?from_seq=2", "", http.StatusOK, "id: 2\nevent: log\n", 1},
+		{"Resumed", "?from_seq=0", "1", http.StatusOK, "id: 2\nevent: log\n", 1},
+		{"Invalid from_seq", "?from_seq=x", "", http.StatusBadRequest, "", 0},
+		{"Invalid Last-Event-ID", "", "x", http.StatusBadRequest, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/logs/stream"+tt.query, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d. Response: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, tt.expected) || strings.Count(body, "event: log") != tt.events {
+				t.Errorf("Unexpected stream %q", body)
+			}
+			if !strings.HasSuffix(body, "event: end\n"+`data: {"status":"failed","next_seq":3}`+"\n\n") {
+				t.Errorf("Expected the stream to end with the deployment's status, got %q", body)
+			}
+		})
+	}
+}
+
+func TestStreamDeploymentLogsLive(t *testing.T) {
+	router, handler := setupTestRouter()
+	hub := logstream.New()
+	handler.SetLogHub(hub)
+	handler.cfg.Logs.StreamPollInterval = time.Hour
+	id := uuid.New()
+	db := &logDB{MockDB: &MockDB{}}
+	handler.db = db
+	router.GET("/api/v1/deployments/:id/logs/stream", handler.StreamDeploymentLogs)
+
+	go func() {
+		for _, content := range []string{"pulling\n", "started\n"} {
+			time.Sleep(20 * time.Millisecond)
+			db.mu.Lock()
+			db.chunks = append(db.chunks, models.DeploymentLogChunk{DeploymentID: id, Seq: int64(len(db.chunks)), Content: content})
+			if len(db.chunks) == 2 {
+				db.status = "deployed"
+			}
+			db.mu.Unlock()
+			hub.Notify(id.String())
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/logs/stream", nil)
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected uploads to wake the stream without polling")
+	}
+	body := w.Body.String()
+	if strings.Count(body, "event: log") != 2 || !strings.Contains(body, `"content":"started\n"`) ||
+		!strings.Contains(body, `data: {"status":"deployed","next_seq":2}`) {
+		t.Errorf("Unexpected stream %q", body)
+	}
+}
+
+type retentionDB struct {
+	*MockDB
+	dryRuns []bool
+	before  []time.Time
+	keep    int
+}
+
+func (m *retentionDB) PruneDeploymentLogs(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	m.dryRuns = append(m.dryRuns, dryRun)
+	m.before = append(m.before, before)
+	return 3, nil
+}
+
+func (m *retentionDB) PruneDeploymentEvents(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	m.dryRuns = append(m.dryRuns, dryRun)
+	m.before = append(m.before, before)
+	return 5, nil
+}
+
+func (m *retentionDB) PruneDeploymentVersions(ctx context.Context, keep int, dryRun bool) (int64, error) {
+	m.dryRuns = append(m.dryRuns, dryRun)
+	m.keep = keep
+	return 2, nil
+}
+
+func TestPruneRetention(t *testing.T) {
+	_, h := setupTestRouter()
+	db := &retentionDB{MockDB: &MockDB{}}
+	h.db = db
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	report, err := h.pruneRetention(context.Background(), now, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(db.dryRuns) != 0 || report.Logs+report.Events+report.Versions != 0 {
+		t.Errorf("Expected unset retention to keep everything, got %+v", report)
+	}
+
+	h.cfg.Retention = config.RetentionConfig{Logs: 24 * time.Hour, Events: 48 * time.Hour, VersionsPerApp: 10}
+	report, err = h.pruneRetention(context.Background(), now, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !report.DryRun || report.Logs != 3 || report.Events != 5 || report.Versions != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if !reflect.DeepEqual(db.dryRuns, []bool{true, true, true}) {
+		t.Errorf("Expected a dry run of every kind, got %v", db.dryRuns)
+	}
+	if !db.before[0].Equal(now.Add(-24*time.Hour)) || !db.before[1].Equal(now.Add(-48*time.Hour)) || db.keep != 10 {
+		t.Errorf("Unexpected cutoffs %v, keep %d", db.before, db.keep)
+	}
+}
+
+func TestGetRetention(t *testing.T) {
+	_, h := setupTestRouter()
+	h.db = &retentionDB{MockDB: &MockDB{}}
+	h.cfg.Retention = config.RetentionConfig{Logs: 30 * 24 * time.Hour, Interval: time.Hour}
+
+	router := gin.New()
+	router.GET("/api/v1/admin/retention", h.GetRetention)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/admin/retention", nil)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.RetentionStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	policy, preview := resp.Data.Policy, resp.Data.Preview
+	if policy.Logs != "30d" || policy.Events != "" || policy.Interval != "1h" {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+	if !preview.DryRun || preview.Logs != 3 || preview.Events != 0 || preview.Versions != 0 {
+		t.Errorf("Unexpected preview %+v", preview)
+	}
+}
+
+type memBlobs struct {
+	objects map[string][]byte
+}
+
+func (b *memBlobs) Put(ctx context.Context, key, contentType string, body []byte) error {
+	b.objects[key] = body
+	return nil
+}
+
+func (b *memBlobs) Get(ctx context.Context, key string) ([]byte, error) {
+	body, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("blob not found")
+	}
+	return body, nil
+}
+
+type archiveDB struct {
+	*logDB
+	archived map[uuid.UUID]models.ArchivedDeploymentLog
+	pruned   []models.Deployment
+	deleted  []uuid.UUID
+}
+
+func (m *archiveDB) AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error) {
+	if _, ok := m.archived[chunk.DeploymentID]; ok {
+		return nil, fmt.Errorf("deployment log is archived")
+	}
+	return m.logDB.AppendDeploymentLog(ctx, chunk, maxBytes)
+}
+
+func (m *archiveDB) ListExpiredDeploymentLogs(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	if len(m.chunks) == 0 {
+		return []uuid.UUID{}, nil
+	}
+	return []uuid.UUID{m.chunks[0].DeploymentID}, nil
+}
+
+func (m *archiveDB) ArchiveDeploymentLog(ctx context.Context, archived models.ArchivedDeploymentLog) error {
+	if int64(len(m.chunks)) != archived.Chunks {
+		return fmt.Errorf("deployment log changed")
+	}
+	m.chunks = nil
+	m.archived[archived.DeploymentID] = archived
+	return nil
+}
+
+func (m *archiveDB) GetArchivedDeploymentLog(ctx context.Context, deploymentID uuid.UUID) (*models.ArchivedDeploymentLog, error) {
+	archived, ok := m.archived[deploymentID]
+	if !ok {
+		return nil, fmt.Errorf("archived log not found")
+	}
+	return &archived, nil
+}
+
+func (m *archiveDB) ListPrunableDeploymentVersions(ctx context.Context, keep, limit int) ([]models.Deployment, error) {
+	return m.pruned, nil
+}
+
+func (m *archiveDB) ListDeploymentEvents(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error) {
+	return []models.DeploymentEvent{{DeploymentID: deploymentID, Type: "created"}}, nil
+}
+
+func (m *archiveDB) DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch []string) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *archiveDB) ListRegistries(ctx context.Context) ([]models.RegistryReference, error) {
+	return []models.RegistryReference{}, nil
+}
+
+func TestArchiveDeploymentLogs(t *testing.T) {
+	router, handler := setupTestRouter()
+	id := uuid.New()
+	db := &archiveDB{
+		logDB: &logDB{MockDB: &MockDB{}, chunks: []models.DeploymentLogChunk{
+			{DeploymentID: id, Seq: 0, Content: "pulling\n"},
+			{DeploymentID: id, Seq: 1, Content: "starting\n"},
+			{DeploymentID: id, Seq: 2, Content: "crashed\n"},
+		}},
+		archived: map[uuid.UUID]models.ArchivedDeploymentLog{},
+	}
+	blobs := &memBlobs{objects: map[string][]byte{}}
+	handler.db = db
+	handler.blobs = blobs
+	handler.cfg.Retention = config.RetentionConfig{Logs: 24 * time.Hour}
+	router.GET("/api/v1/deployments/:id/logs", handler.GetDeploymentLogs)
+	router.POST("/api/v1/deployments/:id/logs", handler.UploadDeploymentLog)
+
+	report, err := handler.pruneRetention(context.Background(), time.Now(), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Logs != 3 || len(db.chunks) != 0 || db.archived[id].Key != "logs/"+id.String()+".json" {
+		t.Fatalf("Expected the log moved to the blob store, got %+v, %d chunks left", report, len(db.chunks))
+	}
+	if _, ok := blobs.objects["logs/"+id.String()+".json"]; !ok {
+		t.Errorf("Expected the log in the blob store, got %v", blobs.objects)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/deployments/"+id.String()+"/logs?from_seq=1", nil)
+	router.ServeHTTP(w, req)
+	var resp struct {
+		Data models.DeploymentLog `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || !resp.Data.Archived || len(resp.Data.Chunks) != 2 ||
+		resp.Data.Chunks[0].Content != "starting\n" || resp.Data.NextSeq != 3 {
+		t.Errorf("Expected the archived chunks from seq 1, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/deployments/"+id.String()+"/logs", strings.NewReader(`{"seq":3,"content":"late\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 appending to an archived log, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestArchivePrunableVersions(t *testing.T) {
+	_, handler := setupTestRouter()
+	old := models.Deployment{ID: uuid.New(), Domain: "test.com", AppName: "api", Version: 3, Status: "deployed",
+		Env: []string{"MODE=prod", "DB_PASSWORD=hunter2"}}
+	db := &archiveDB{
+		logDB:    &logDB{MockDB: &MockDB{}},
+		archived: map[uuid.UUID]models.ArchivedDeploymentLog{old.ID: {DeploymentID: old.ID, Key: "logs/" + old.ID.String() + ".json"}},
+		pruned:   []models.Deployment{old},
+	}
+	blobs := &memBlobs{objects: map[string][]byte{}}
+	handler.db = db
+	handler.blobs = blobs
+	handler.cfg.Retention = config.RetentionConfig{VersionsPerApp: 2}
+	handler.redactor = redact.New([]string{"PASSWORD"})
+
+	report, err := handler.pruneRetention(context.Background(), time.Now(), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Versions != 1 || len(db.deleted) != 1 || db.deleted[0] != old.ID {
+		t.Fatalf("Expected the version deleted once archived, got %+v, deleted %v", report, db.deleted)
+	}
+
+	var archived models.ArchivedDeployment
+	if err := json.Unmarshal(blobs.objects["versions/test.com/api/3.json"], &archived); err != nil {
+		t.Fatalf("Expected the version in the blob store: %v", err)
+	}
+	if archived.ID != old.ID || len(archived.Events) != 1 || archived.LogKey != "logs/"+old.ID.String()+".json" {
+		t.Errorf("Unexpected archive %+v", archived)
+	}
+	if slices.Contains(archived.Env, "DB_PASSWORD=hunter2") {
+		t.Errorf("Expected sensitive env values masked, got %v", archived.Env)
+	}
+}
+
+func TestArchiveExport(t *testing.T) {
+	router, handler := setupTestRouter()
+	handler.db = &archiveDB{logDB: &logDB{MockDB: &MockDB{}}}
+	router.POST("/api/v1/export/archive", handler.ArchiveExport)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/export/archive", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a blob store, got %d", w.Code)
+	}
+
+	blobs := &memBlobs{objects: map[string][]byte{}}
+	handler.blobs = blobs
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/export/archive", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data models.ArchivedExport `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	var export models.ControllerExport
+	if err := json.Unmarshal(blobs.objects[resp.Data.Key], &export); err != nil {
+		t.Fatalf("Expected the export at %q: %v", resp.Data.Key, err)
+	}
+	if !strings.HasPrefix(resp.Data.Key, "exports/") || resp.Data.Deployments != len(export.Deployments) || len(export.Deployments) == 0 {
+		t.Errorf("Unexpected archived export %+v", resp.Data)
+	}
+}
+
+func TestSeedFixtures(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	fixtures := models.ControllerExport{
+		Deployments: []models.DeploymentRequest{
+			{Domain: "demo.localhost", AppName: "web", DockerImage: "nginx:1.25", Port: 80},
+			{Domain: "demo.localhost", AppName: "bad", DockerImage: "nginx:1.25"},
+		},
+		Registries: []models.RegistryReference{{Registry: "ghcr.io", Username: "demo", Password: "fake"}},
+	}
+
+	// Seeding twice creates the deployment once and upserts the credential
+	for i, want := range []string{"created", "unchanged"} {
+		result, err := handler.SeedFixtures(ctx, fixtures, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Deployments) != 2 || result.Deployments[0].Action != want || result.Deployments[0].Version != 1 {
+			t.Errorf("Run %d: expected web to be %s at version 1, got %+v", i, want, result.Deployments)
+		}
+		if result.Deployments[1].Action != "invalid" {
+			t.Errorf("Run %d: expected the app without a port to be invalid, got %+v", i, result.Deployments[1])
+		}
+		if len(result.Registries) != 1 || result.Registries[0].Action != "stored" {
+			t.Errorf("Run %d: expected the credential to be stored, got %+v", i, result.Registries)
+		}
+	}
+
+	latest, _ := store.GetLatestDeployments(ctx)
+	if len(latest) != 1 {
+		t.Errorf("Expected one seeded deployment, got %+v", latest)
+	}
+	if cred, err := store.GetRegistryCredential(ctx, "ghcr.io"); err != nil || cred.Password != "fake" {
+		t.Errorf("Expected the seeded credential, got %+v: %v", cred, err)
+	}
+
+	fixtures.Redacted = true
+	if _, err := handler.SeedFixtures(ctx, fixtures, false); err == nil {
+		t.Error("Expected redacted fixtures to be rejected")
+	}
+}
+
+func TestUpdateStatusUsesClock(t *testing.T) {
+	router, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pushedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(pushedAt)
+	store.SetClock(clk)
+	handler.SetClock(clk)
+	handler.db = store
+
+	deployment, err := store.CreateDeployment(context.Background(), models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !deployment.CreatedAt.Equal(pushedAt) {
+		t.Errorf("Expected created_at %v, got %v", pushedAt, deployment.CreatedAt)
+	}
+
+	clk.Advance(5 * time.Minute)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/api/v1/deployments/"+deployment.ID.String()+"/status", bytes.NewBufferString(`{"status":"deployed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", "*")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d. Response: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data models.Deployment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Data.DeployedAt == nil || !response.Data.DeployedAt.Equal(pushedAt.Add(5*time.Minute)) {
+		t.Errorf("Expected deployed_at five minutes after the push, got %v", response.Data.DeployedAt)
+	}
+}
+
+func TestDigestDriftBaseline(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	// A registry whose tags all resolve to the current digest
+	var mu sync.Mutex
+	current, lookups := "sha256:"+strings.Repeat("a", 64), 0
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		w.Header().Set("Docker-Content-Digest", current)
+	}))
+	defer reg.Close()
+	host := strings.TrimPrefix(reg.URL, "http://")
+	handler.registry = registry.New(config.RegistryConfig{Timeout: time.Second, Insecure: []string{host}})
+
+	router := gin.New()
+	router.PATCH("/api/v1/deployments/:id/status", handler.UpdateDeploymentStatus)
+
+	create := func(app, image string) uuid.UUID {
+		d, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: app, DockerImage: image, Port: 80}, "req")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return d.ID
+	}
+	setStatus := func(id uuid.UUID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/deployments/"+id.String()+"/status", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	tracked := func() map[string]models.ImageDigest {
+		digests, err := handler.trackedDigests(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return digests
+	}
+
+	reported := "sha256:" + strings.Repeat("c", 64)
+	web := create("web", host+"/web:latest")
+	api := create("api", host+"/api:latest")
+	pinned := create("db", host+"/db:16@sha256:"+strings.Repeat("d", 64))
+
+	t.Run("Invalid image digest", func(t *testing.T) {
+		for _, body := range []string{
+			`{"status":"deployed","image_digest":"latest"}`,
+			`{"status":"deploying","image_digest":"` + reported + `"}`,
+		} {
+			if w := setStatus(web, body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+			}
+		}
+	})
+
+	t.Run("First seen at deploy", func(t *testing.T) {
+		if w := setStatus(web, `{"status":"deployed"}`); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if got := tracked()["example.com/web"]; got.DeploymentID != web || got.DeployedDigest != current || got.Drifted {
+			t.Errorf("Expected the resolved digest as the baseline, got %+v", got)
+		}
+	})
+
+	t.Run("Agent reported digest", func(t *testing.T) {
+		mu.Lock()
+		before := lookups
+		mu.Unlock()
+		if w := setStatus(api, `{"status":"deployed","image_digest":"`+reported+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if lookups != before {
+			t.Error("Expected no registry lookup when the agent reports the digest")
+		}
+		if got := tracked()["example.com/api"]; got.DeployedDigest != reported {
+			t.Errorf("Expected the reported digest as the baseline, got %+v", got)
+		}
+	})
+
+	t.Run("Digest pinned image skipped", func(t *testing.T) {
+		if w := setStatus(pinned, `{"status":"deployed"}`); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if err := handler.RunDigestChecks(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got, ok := tracked()["example.com/db"]; ok {
+			t.Errorf("Expected a pinned image not tracked, got %+v", got)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := handler.RunDigestChecks(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := tracked()["example.com/web"]; got.RegistryDigest != got.DeployedDigest || got.Drifted {
+			t.Errorf("Expected the tag unchanged, got %+v", got)
+		}
+		// The registry never served the reported digest
+		if got := tracked()["example.com/api"]; !got.Drifted {
+			t.Errorf("Expected the agent's digest kept as the baseline, got %+v", got)
+		}
+	})
+
+	t.Run("Drifted", func(t *testing.T) {
+		deployed := current
+		mu.Lock()
+		current = "sha256:" + strings.Repeat("b", 64)
+		mu.Unlock()
+
+		if err := handler.RunDigestChecks(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := tracked()["example.com/web"]; got.DeployedDigest != deployed || got.RegistryDigest != current || !got.Drifted {
+			t.Errorf("Expected the tag drifted from %s, got %+v", deployed, got)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	_, handler := setupTestRouter()
+	store, err := memstore.New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler.db = store
+	ctx := context.Background()
+
+	router := gin.New()
+	router.POST("/api/v1/import", handler.Import)
+
+	document := `{"format_version":1,"deployments":[{"domain":"example.com","app_name":"web","docker_image":"nginx:1.25","port":80}]}`
+	yamlDocument := "format_version: 1\ndeployments:\n  - domain: example.com\n    app_name: api\n    docker_image: nginx:1.25\n    port: 8080\n"
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		frozen      bool
+		want        int
+		action      string
+		deployments int
+	}{
+		{name: "Dry run", query: "?dry_run=true", body: document, want: http.StatusOK, action: "create", deployments: 0},
+		{name: "Redacted", body: `{"format_version":1,"redacted":true,"deployments":[]}`, want: http.StatusBadRequest},
+		{name: "Newer format version", body: `{"format_version":2,"deployments":[]}`, want: http.StatusBadRequest},
+		{name: "YAML", contentType: "application/yaml", body: yamlDocument, want: http.StatusOK, action: "created", deployments: 1},
+		{name: "Frozen", body: document, frozen: true, want: http.StatusServiceUnavailable, deployments: 1},
+		{name: "Frozen dry run", query: "?dry_run=true", body: document, frozen: true, want: http.StatusOK, action: "create", deployments: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.frozen {
+				if _, err := store.StartWriteFreeze(ctx, models.WriteFreeze{Enabled: true, Reason: "release"}, nil); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				defer func() {
+					if err := store.EndWriteFreeze(ctx, nil); err != nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+				}()
+			}
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/import"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.action != "" {
+				var response struct {
+					Data models.ImportResult `json:"data"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Data.Deployments) != 1 || response.Data.Deployments[0].Action != tt.action {
+					t.Errorf("Expected one %q deployment, got %+v", tt.action, response.Data.Deployments)
+				}
+			}
+
+			latest, err := store.GetLatestDeployments(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(latest) != tt.deployments {
+				t.Errorf("Expected %d deployments stored, got %d", tt.deployments, len(latest))
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateHealthCheck checks a health check request; fields unused by its
+// type must be left empty
+func validateHealthCheck(req *models.HealthCheckRequest) []models.FieldError {
+	if !slices.Contains(models.HealthCheckTypes, req.Type) {
+		return []models.FieldError{{Field: "type", Message: "must be one of: " + strings.Join(models.HealthCheckTypes, ", ")}}
+	}
+
+	var errs []models.FieldError
+	if req.Type == models.HealthCheckHTTP {
+		if req.Path != "" && !strings.HasPrefix(req.Path, "/") {
+			errs = append(errs, models.FieldError{Field: "path", Message: "must start with /"})
+		}
+	} else if req.Path != "" {
+		errs = append(errs, models.FieldError{Field: "path", Message: "is only used by http checks"})
+	}
+
+	if req.Type == models.HealthCheckTCP {
+		if req.Port < 0 || req.Port > 65535 {
+			errs = append(errs, models.FieldError{Field: "port", Message: "must be between 1 and 65535, or 0 for the deployment's port"})
+		}
+	} else if req.Port != 0 {
+		errs = append(errs, models.FieldError{Field: "port", Message: "is only used by tcp checks"})
+	}
+
+	if req.Type == models.HealthCheckExec {
+		if len(req.Command) == 0 || req.Command[0] == "" {
+			errs = append(errs, models.FieldError{Field: "command", Message: "is required for exec checks"})
+		}
+	} else if len(req.Command) > 0 {
+		errs = append(errs, models.FieldError{Field: "command", Message: "is only used by exec checks"})
+	}
+	return errs
+}
+
+// respondHealthCheckError maps a health check lookup error to a response
+func (h *Handler) respondHealthCheckError(c *gin.Context, err error, message string) {
+	if err.Error() == "health check not found" {
+		RespondError(c, http.StatusNotFound, "Health check not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// probeTCP reports whether a TCP connection to addr opens within the timeout
+func (h *Handler) probeTCP(ctx context.Context, addr string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		h.logger.Debug("Health probe failed", "addr", addr, "error", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// ListHealthChecks handles GET /api/v1/health-checks and its agent
+// counterpart; ?type=exec lists the checks agents must run
+func (h *Handler) ListHealthChecks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	checkType := c.Query("type")
+	if checkType != "" && !slices.Contains(models.HealthCheckTypes, checkType) {
+		RespondValidationError(c, "Invalid health check type", []models.FieldError{
+			{Field: "type", Message: "must be one of: " + strings.Join(models.HealthCheckTypes, ", ")},
+		})
+		return
+	}
+
+	checks, err := h.db.ListHealthChecks(ctx, checkType)
+	if err != nil {
+		h.logger.Error("Failed to list health checks", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list health checks")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    checks,
+	})
+}
+
+// PutHealthCheck handles PUT /api/v1/health-checks/:domain/:app_name
+func (h *Handler) PutHealthCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid health check")
+	if !ok {
+		return
+	}
+
+	var req models.HealthCheckRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid health check request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if errs := validateHealthCheck(&req); len(errs) > 0 {
+		RespondValidationError(c, "Invalid health check", errs)
+		return
+	}
+
+	check, err := h.db.UpsertHealthCheck(ctx, models.HealthCheck{
+		Domain:  domain,
+		AppName: appName,
+		Type:    req.Type,
+		Path:    req.Path,
+		Port:    req.Port,
+		Command: req.Command,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store health check", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store health check")
+		return
+	}
+
+	h.logger.Info("Stored health check",
+		"domain", domain,
+		"app_name", appName,
+		"type", check.Type)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Health check stored successfully",
+		Data:    check,
+	})
+}
+
+// GetHealthCheck handles GET /api/v1/health-checks/:domain/:app_name
+func (h *Handler) GetHealthCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid health check")
+	if !ok {
+		return
+	}
+
+	check, err := h.db.GetHealthCheck(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get health check", "error", err, "domain", domain, "app_name", appName)
+		h.respondHealthCheckError(c, err, "Failed to get health check")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    check,
+	})
+}
+
+// DeleteHealthCheck handles DELETE /api/v1/health-checks/:domain/:app_name
+func (h *Handler) DeleteHealthCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid health check")
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteHealthCheck(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete health check", "error", err, "domain", domain, "app_name", appName)
+		h.respondHealthCheckError(c, err, "Failed to delete health check")
+		return
+	}
+
+	h.logger.Info("Deleted health check", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Health check deleted successfully",
+	})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// housekeepingTimeout bounds a housekeeping run; vacuuming a large table can
+// take minutes
+const housekeepingTimeout = 10 * time.Minute
+
+// housekeepingLock keeps housekeeping runs from overlapping across replicas
+const housekeepingLock = "housekeeping"
+
+// runHousekeeping vacuums and analyzes the hot tables and refreshes the
+// materialized stats and analytics. A failed step is recorded and the
+// remaining steps still run.
+func (h *Handler) runHousekeeping(ctx context.Context) []models.HousekeepingStep {
+	var steps []models.HousekeepingStep
+	step := func(name string, fn func(ctx context.Context) error) {
+		start := time.Now()
+		err := fn(ctx)
+		s := models.HousekeepingStep{Name: name, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			h.logger.Error("Housekeeping step failed", "step", name, "error", err)
+			s.Error = err.Error()
+		}
+		steps = append(steps, s)
+	}
+
+	for _, table := range database.HotTables {
+		step("vacuum "+table, func(ctx context.Context) error {
+			return h.db.VacuumAnalyze(ctx, table)
+		})
+	}
+	step("refresh deployment stats", h.db.RefreshDeploymentStats)
+	step("refresh analytics", h.db.RefreshAnalytics)
+
+	return steps
+}
+
+// GetHousekeeping handles GET /api/v1/admin/maintenance - the size, row
+// counts and last vacuum and analyze of every table and its indexes
+func (h *Handler) GetHousekeeping(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tables, err := h.db.GetTableSizes(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get table sizes", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get table sizes")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    models.HousekeepingReport{Steps: []models.HousekeepingStep{}, Tables: tables},
+	})
+}
+
+// RunHousekeeping handles POST /api/v1/admin/maintenance - vacuums and
+// analyzes the hot tables, refreshes the materialized stats and analytics,
+// and reports each step and the table sizes afterwards
+func (h *Handler) RunHousekeeping(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), housekeepingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	report := models.HousekeepingReport{RanAt: h.clock.Now()}
+	ran, err := h.db.WithLock(ctx, housekeepingLock, func(ctx context.Context) error {
+		report.Steps = h.runHousekeeping(ctx)
+		return nil
+	})
+	if err != nil {
+		h.logger.Error("Failed to run housekeeping", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to run housekeeping")
+		return
+	}
+	if !ran {
+		RespondError(c, http.StatusConflict, "Housekeeping is already running")
+		return
+	}
+
+	if report.Tables, err = h.db.GetTableSizes(ctx); err != nil {
+		h.logger.Error("Failed to get table sizes", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get table sizes")
+		return
+	}
+
+	failed := 0
+	for _, step := range report.Steps {
+		if step.Error != "" {
+			failed++
+		}
+	}
+
+	h.logger.Info("Ran housekeeping",
+		"steps", len(report.Steps),
+		"failed", failed,
+		"duration", time.Since(start),
+		"actor", c.GetString(ActorKey))
+
+	if failed > 0 {
+		RespondErrorWithData(c, http.StatusInternalServerError,
+			fmt.Sprintf("Housekeeping failed %d of %d steps", failed, len(report.Steps)), report)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Housekeeping completed",
+		Data:    report,
+	})
+}
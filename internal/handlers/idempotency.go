@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader lets clients safely retry POST requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the size of client supplied keys
+const maxIdempotencyKeyLength = 255
+
+// idempotencyFinishTimeout bounds storing or releasing a key's outcome,
+// which outlives the request so a client that gave up doesn't leave the key
+// reserved
+const idempotencyFinishTimeout = 5 * time.Second
+
+// hashPayload returns a stable fingerprint of a parsed request payload
+func hashPayload(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// replayIdempotent reserves the idempotency key for this request. It returns
+// true when a response has already been written, either replaying the stored
+// result of an earlier request or rejecting a conflicting reuse of the key.
+func (h *Handler) replayIdempotent(ctx context.Context, c *gin.Context, key string, payload interface{}) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		RespondError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return true
+	}
+
+	requestHash, err := hashPayload(payload)
+	if err != nil {
+		h.logger.Error("Failed to hash request payload", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to process idempotency key")
+		return true
+	}
+
+	record, reserved, err := h.db.ReserveIdempotencyKey(ctx, key, requestHash)
+	if err != nil {
+		h.logger.Error("Failed to reserve idempotency key", "error", err, "idempotency_key", key)
+		RespondError(c, http.StatusInternalServerError, "Failed to process idempotency key")
+		return true
+	}
+
+	if reserved {
+		return false
+	}
+
+	if record.RequestHash != requestHash {
+		h.logger.Warn("Idempotency key reused with a different payload", "idempotency_key", key)
+		RespondError(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request payload")
+		return true
+	}
+
+	if record.StatusCode == 0 {
+		RespondError(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return true
+	}
+
+	h.logger.Info("Replaying idempotent response", "idempotency_key", key)
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.StatusCode, "application/json; charset=utf-8", record.Response)
+	return true
+}
+
+// completeIdempotent stores the response for a reserved idempotency key and
+// reports whether it was stored
+func (h *Handler) completeIdempotent(ctx context.Context, key string, statusCode int, response models.APIResponse) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyFinishTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(response)
+	if err == nil {
+		err = h.db.CompleteIdempotencyKey(ctx, key, statusCode, body)
+	}
+
+	if err != nil {
+		h.logger.Error("Failed to store idempotent response", "error", err, "idempotency_key", key)
+		return false
+	}
+	return true
+}
+
+// releaseIdempotent frees a reserved key when the request failed before
+// producing a response, so the client can retry with the same key
+func (h *Handler) releaseIdempotent(ctx context.Context, key string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyFinishTimeout)
+	defer cancel()
+
+	if err := h.db.ReleaseIdempotencyKey(ctx, key); err != nil {
+		h.logger.Error("Failed to release idempotency key", "error", err, "idempotency_key", key)
+	}
+}
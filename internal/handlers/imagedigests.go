@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/registry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// recordDeployedDigest records the digest a deployment of a mutable tag went
+// live with, as the baseline of digest drift detection: the one its agent
+// reported or, failing that, what the tag resolves to now. Without one the
+// deployment is not checked for drift.
+func (h *Handler) recordDeployedDigest(ctx context.Context, d *models.Deployment, reported string) {
+	img, err := registry.ParseImage(d.DockerImage)
+	if err != nil || img.Digest != "" {
+		return
+	}
+
+	record := models.ImageDigest{
+		Domain:         d.Domain,
+		AppName:        d.AppName,
+		DeploymentID:   d.ID,
+		DockerImage:    d.DockerImage,
+		DeployedDigest: reported,
+	}
+	if record.DeployedDigest == "" {
+		if record.DeployedDigest, err = h.resolveDigest(ctx, img, map[string]*registry.Credentials{}); err != nil {
+			metrics.ImageDigestCheckErrors.Inc()
+			h.logger.Warn("Failed to resolve deployed image digest", "error", err, "deployment_id", d.ID, "docker_image", d.DockerImage)
+			return
+		}
+	}
+	record.RegistryDigest = record.DeployedDigest
+
+	if _, err := h.db.RecordImageDigest(ctx, record); err != nil {
+		h.logger.Error("Failed to record deployed image digest", "error", err, "deployment_id", d.ID)
+	}
+}
+
+// RunDigestChecks resolves the tag of every deployed app whose image is not
+// pinned to a digest and records whether it still points at the digest it
+// was deployed with; it is run periodically by the digest drift worker
+func (h *Handler) RunDigestChecks(ctx context.Context) error {
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	keep := []uuid.UUID{}
+	creds := map[string]*registry.Credentials{}
+	metrics.ImageDigestDrift.Reset()
+
+	for _, d := range deployments {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.Status != "deployed" {
+			continue
+		}
+		img, err := registry.ParseImage(d.DockerImage)
+		if err != nil || img.Digest != "" {
+			continue
+		}
+		keep = append(keep, d.ID)
+
+		record := models.ImageDigest{
+			Domain:       d.Domain,
+			AppName:      d.AppName,
+			DeploymentID: d.ID,
+			DockerImage:  d.DockerImage,
+		}
+		if record.RegistryDigest, err = h.resolveDigest(ctx, img, creds); err != nil {
+			record.Error = err.Error()
+			metrics.ImageDigestCheckErrors.Inc()
+			h.logger.Warn("Failed to resolve image digest", "error", err, "domain", d.Domain, "app_name", d.AppName, "docker_image", d.DockerImage)
+		}
+
+		stored, err := h.db.RecordImageDigest(ctx, record)
+		if err != nil {
+			h.logger.Error("Failed to record image digest", "error", err, "domain", d.Domain, "app_name", d.AppName)
+			continue
+		}
+
+		drift := 0.0
+		if stored.Drifted {
+			drift = 1
+			h.logger.Warn("Deployed tag points at a new digest",
+				"deployment_id", d.ID,
+				"domain", d.Domain,
+				"app_name", d.AppName,
+				"docker_image", d.DockerImage,
+				"deployed_digest", stored.DeployedDigest,
+				"registry_digest", stored.RegistryDigest)
+		}
+		metrics.ImageDigestDrift.WithLabelValues(d.Domain, d.AppName).Set(drift)
+	}
+
+	return h.db.PruneImageDigests(ctx, keep)
+}
+
+// resolveDigest resolves the digest an image's tag points to, looking up
+// each registry's credentials once per run
+func (h *Handler) resolveDigest(ctx context.Context, img registry.Image, creds map[string]*registry.Credentials) (string, error) {
+	cred, ok := creds[img.Registry]
+	if !ok {
+		var err error
+		if cred, err = h.registryCredentials(ctx, img.Registry); err != nil {
+			return "", err
+		}
+		creds[img.Registry] = cred
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageCheckTimeout)
+	defer cancel()
+	return h.registry.Digest(ctx, img, img.Tag, cred)
+}
+
+// ListImageDigests handles GET /api/v1/image-digests
+func (h *Handler) ListImageDigests(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	driftedOnly := false
+	if v := c.Query("drifted"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			RespondValidationError(c, "Invalid image digest query", []models.FieldError{{Field: "drifted", Message: "must be true or false"}})
+			return
+		}
+		driftedOnly = parsed
+	}
+
+	digests, err := h.db.ListImageDigests(ctx, driftedOnly)
+	if err != nil {
+		h.logger.Error("Failed to list image digests", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list image digests")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    digests,
+	})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"deployment-controller/internal/imagepolicy"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/registry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// imageCheckTimeout bounds the registry calls of one image policy check
+const imageCheckTimeout = time.Minute
+
+// respondImagePolicyError maps an image policy lookup error to a response
+func (h *Handler) respondImagePolicyError(c *gin.Context, err error, message string) {
+	if err.Error() == "image policy not found" {
+		RespondError(c, http.StatusNotFound, "Image policy not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// registryCredentials returns the stored credentials for a registry, or nil
+// to query it anonymously
+func (h *Handler) registryCredentials(ctx context.Context, host string) (*registry.Credentials, error) {
+	cred, err := h.db.GetRegistryCredential(ctx, host)
+	if err != nil {
+		if err.Error() == "registry credential not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &registry.Credentials{Username: cred.Username, Password: cred.Password}, nil
+}
+
+// imageUpdatesLock is the lock held by image update runs, on the periodic
+// worker or after a registry webhook
+const imageUpdatesLock = "task:image-updates"
+
+// RunImageUpdates checks every image policy and deploys the images they
+// select; it is run periodically by the image update worker
+func (h *Handler) RunImageUpdates(ctx context.Context) error {
+	policies, err := h.db.ListImagePolicies(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h.applyImagePolicy(ctx, policy)
+	}
+	return nil
+}
+
+// applyImagePolicy checks one image policy, deploys the image it selects
+// and records the outcome, returning the check's error
+func (h *Handler) applyImagePolicy(ctx context.Context, policy models.ImagePolicy) error {
+	image, deployment, err := h.checkImagePolicy(ctx, policy)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+		h.logger.Warn("Image policy check failed", "error", err, "domain", policy.Domain, "app_name", policy.AppName)
+	}
+	if deployment != nil {
+		h.logger.Info("Deployed image update",
+			"deployment_id", deployment.ID,
+			"domain", deployment.Domain,
+			"app_name", deployment.AppName,
+			"docker_image", deployment.DockerImage,
+			"version", deployment.Version,
+			"policy", policy.Kind)
+	}
+
+	if err := h.db.RecordImagePolicyCheck(ctx, policy.Domain, policy.AppName, image, errMsg); err != nil {
+		h.logger.Error("Failed to record image policy check", "error", err, "domain", policy.Domain, "app_name", policy.AppName)
+	}
+	return err
+}
+
+// checkImagePolicy resolves the image a policy wants deployed and, when it
+// differs from the app's latest deployment, deploys it as a new version. It
+// returns the selected image and the new deployment, if any.
+func (h *Handler) checkImagePolicy(ctx context.Context, policy models.ImagePolicy) (string, *models.Deployment, error) {
+	ctx, cancel := context.WithTimeout(ctx, imageCheckTimeout)
+	defer cancel()
+
+	latest, err := h.db.GetLatestDeployment(ctx, policy.Domain, policy.AppName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	img, err := registry.ParseImage(latest.DockerImage)
+	if err != nil {
+		return "", nil, err
+	}
+	creds, err := h.registryCredentials(ctx, img.Registry)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var next string
+	switch policy.Kind {
+	case models.ImagePolicyDigest:
+		if img.Tag == "" {
+			return "", nil, errors.New("image has no tag to follow")
+		}
+		digest, err := h.registry.Digest(ctx, img, img.Tag, creds)
+		if err != nil {
+			return "", nil, err
+		}
+		if digest == img.Digest {
+			return latest.DockerImage, nil, nil
+		}
+		if next, err = img.WithDigest(digest); err != nil {
+			return "", nil, err
+		}
+
+	default:
+		tags, err := h.registry.Tags(ctx, img, creds)
+		if err != nil {
+			return "", nil, err
+		}
+		tag, newer, err := imagepolicy.LatestTag(policy, img.Tag, tags)
+		if err != nil {
+			return "", nil, err
+		}
+		if tag == "" {
+			return "", nil, fmt.Errorf("no tag of %s matches %q", img.Repository, policy.Pattern)
+		}
+		if !newer {
+			return latest.DockerImage, nil, nil
+		}
+		if next, err = img.WithTag(tag); err != nil {
+			return "", nil, err
+		}
+	}
+
+	req := models.DeploymentRequest{
+		Domain:      latest.Domain,
+		AppName:     latest.AppName,
+		DockerImage: next,
+		Port:        latest.Port,
+		Env:         latest.Env,
+		Priority:    latest.Priority,
+		Metadata:    latest.Metadata,
+	}
+	if errs := h.validateDeploymentRequest(&req, nil); len(errs) > 0 {
+		return "", nil, fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+
+	// Record the image the policy selected; it is deployed once the freeze
+	// is lifted
+	if frozen, err := h.frozen(ctx); err != nil || frozen {
+		if frozen {
+			err = fmt.Errorf("deployments are frozen")
+		}
+		return req.DockerImage, nil, err
+	}
+
+	deployment, err := h.db.CreateDeployment(ctx, req, uuid.New().String())
+	if err != nil {
+		return "", nil, err
+	}
+	return req.DockerImage, deployment, nil
+}
+
+// ListImagePolicies handles GET /api/v1/image-policies
+func (h *Handler) ListImagePolicies(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	policies, err := h.db.ListImagePolicies(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list image policies", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list image policies")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    policies,
+	})
+}
+
+// PutImagePolicy handles PUT /api/v1/image-policies/:domain/:app_name
+func (h *Handler) PutImagePolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid image policy")
+	if !ok {
+		return
+	}
+
+	var req models.ImagePolicyRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid image policy request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := imagepolicy.Validate(req.Kind, req.Pattern); err != nil {
+		field := "pattern"
+		if !slices.Contains(models.ImagePolicyKinds, req.Kind) {
+			field = "kind"
+		}
+		RespondValidationError(c, "Invalid image policy", []models.FieldError{{Field: field, Message: err.Error()}})
+		return
+	}
+
+	policy, err := h.db.UpsertImagePolicy(ctx, models.ImagePolicy{
+		Domain:  domain,
+		AppName: appName,
+		Kind:    req.Kind,
+		Pattern: req.Pattern,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store image policy", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store image policy")
+		return
+	}
+
+	h.logger.Info("Stored image policy",
+		"domain", domain,
+		"app_name", appName,
+		"kind", policy.Kind,
+		"pattern", policy.Pattern)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Image policy stored successfully",
+		Data:    policy,
+	})
+}
+
+// GetImagePolicy handles GET /api/v1/image-policies/:domain/:app_name
+func (h *Handler) GetImagePolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid image policy")
+	if !ok {
+		return
+	}
+
+	policy, err := h.db.GetImagePolicy(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get image policy", "error", err, "domain", domain, "app_name", appName)
+		h.respondImagePolicyError(c, err, "Failed to get image policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    policy,
+	})
+}
+
+// DeleteImagePolicy handles DELETE /api/v1/image-policies/:domain/:app_name
+func (h *Handler) DeleteImagePolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid image policy")
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteImagePolicy(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete image policy", "error", err, "domain", domain, "app_name", appName)
+		h.respondImagePolicyError(c, err, "Failed to delete image policy")
+		return
+	}
+
+	h.logger.Info("Deleted image policy", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Image policy deleted successfully",
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Incident list defaults and limits
+const (
+	defaultIncidentLimit = 50
+	maxIncidentLimit     = 500
+)
+
+// parseIncidentQuery reads the open and limit query parameters of the
+// incident endpoints
+func parseIncidentQuery(c *gin.Context) (openOnly bool, limit int, errs []models.FieldError) {
+	if v := c.Query("open"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "open", Message: "must be true or false"})
+		}
+		openOnly = parsed
+	}
+	limit = defaultIncidentLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxIncidentLimit {
+			errs = append(errs, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxIncidentLimit)})
+		} else {
+			limit = n
+		}
+	}
+	return openOnly, limit, errs
+}
+
+// withDurations sets how long each incident lasted, or has lasted so far
+func withDurations(incidents []models.Incident, now time.Time) []models.Incident {
+	for i := range incidents {
+		end := now
+		if incidents[i].ResolvedAt != nil {
+			end = *incidents[i].ResolvedAt
+		}
+		incidents[i].DurationSeconds = end.Sub(incidents[i].StartedAt).Seconds()
+	}
+	return incidents
+}
+
+// ListIncidents handles GET /api/v1/incidents?open=true - incidents of
+// every app, newest first
+func (h *Handler) ListIncidents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	openOnly, limit, errs := parseIncidentQuery(c)
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid incident query", errs)
+		return
+	}
+
+	incidents, err := h.db.ListIncidents(ctx, "", "", openOnly, limit)
+	if err != nil {
+		h.logger.Error("Failed to list incidents", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list incidents")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    withDurations(incidents, h.clock.Now()),
+	})
+}
+
+// ListAppIncidents handles GET /api/v1/apps/:domain/:app_name/incidents -
+// an app's incidents, newest first
+func (h *Handler) ListAppIncidents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	openOnly, limit, errs := parseIncidentQuery(c)
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid incident query", errs)
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	incidents, err := h.db.ListIncidents(ctx, domain, appName, openOnly, limit)
+	if err != nil {
+		h.logger.Error("Failed to list incidents", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to list incidents")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    withDurations(incidents, h.clock.Now()),
+	})
+}
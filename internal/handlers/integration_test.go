@@ -0,0 +1,618 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// pushResult is the data of a push response
+type pushResult struct {
+	RequestID string              `json:"request_id"`
+	Created   []models.Deployment `json:"created_deployments"`
+	Unchanged []models.Deployment `json:"unchanged_deployments"`
+	Failed    []map[string]any    `json:"failed_deployments"`
+}
+
+func TestIntegrationPush(t *testing.T) {
+	env := testutil.New(t, nil)
+	env.Router.POST("/api/v1/push", env.Handler.Push)
+	env.Router.GET("/api/v1/deployments/:id", env.Handler.GetDeployment)
+	env.Router.PATCH("/api/v1/deployments/:id/status", env.Handler.UpdateDeploymentStatus)
+
+	api := func(image string) models.DeploymentRequest {
+		return models.DeploymentRequest{Domain: "test.com", AppName: "api", DockerImage: image, Port: 8080, Env: models.EnvList{"MODE=test"}}
+	}
+	worker := models.DeploymentRequest{Domain: "test.com", AppName: "worker", DockerImage: "worker:1", Port: 9090}
+
+	// Each push builds on the versions created by the ones before it
+	tests := []struct {
+		name      string
+		query     string
+		batch     models.DeploymentPushRequest
+		status    int
+		versions  []int
+		unchanged int
+	}{
+		{name: "first version", batch: models.DeploymentPushRequest{api("api:1")}, status: http.StatusCreated, versions: []int{1}},
+		{name: "next version", batch: models.DeploymentPushRequest{api("api:2")}, status: http.StatusCreated, versions: []int{2}},
+		{name: "unchanged skipped", query: "?skip_unchanged=true", batch: models.DeploymentPushRequest{api("api:2")}, status: http.StatusOK, unchanged: 1},
+		{name: "batch", batch: models.DeploymentPushRequest{api("api:3"), worker}, status: http.StatusCreated, versions: []int{3, 1}},
+		{name: "atomic batch", query: "?atomic=true", batch: models.DeploymentPushRequest{api("api:4"), worker}, status: http.StatusCreated, versions: []int{4, 2}},
+	}
+
+	var latest models.Deployment
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result pushResult
+			testutil.Decode(t, env.Do(t, "POST", "/api/v1/push"+tt.query, tt.batch), tt.status, &result)
+
+			if len(result.Created) != len(tt.versions) || len(result.Unchanged) != tt.unchanged {
+				t.Fatalf("expected %d created and %d unchanged, got %+v", len(tt.versions), tt.unchanged, result)
+			}
+			for i, d := range result.Created {
+				if d.Version != tt.versions[i] || d.RequestID != result.RequestID || d.Status != "pending" {
+					t.Errorf("unexpected deployment %d: %+v", i, d)
+				}
+				if d.AppName == "api" {
+					latest = d
+				}
+			}
+		})
+	}
+
+	w := env.DoWithHeader(t, "PATCH", "/api/v1/deployments/"+latest.ID.String()+"/status", models.StatusUpdateRequest{Status: "deployed"}, ifMatch("*"))
+	testutil.Decode(t, w, http.StatusOK, nil)
+
+	var stored models.Deployment
+	testutil.Decode(t, env.Do(t, "GET", "/api/v1/deployments/"+latest.ID.String(), nil), http.StatusOK, &stored)
+	if stored.Status != "deployed" || stored.DeployedAt == nil || stored.Version != 4 {
+		t.Errorf("expected version 4 deployed, got %+v", stored)
+	}
+}
+
+// ifMatch returns an If-Match header for etag
+func ifMatch(etag string) http.Header {
+	return http.Header{"If-Match": {etag}}
+}
+
+func TestIntegrationStatusETagRoundTrip(t *testing.T) {
+	env := testutil.New(t, nil)
+	env.Router.POST("/api/v1/push", env.Handler.Push)
+	env.Router.GET("/api/v1/deployments/:id", env.Handler.GetDeployment)
+	env.Router.PATCH("/api/v1/deployments/:id/status", env.Handler.UpdateDeploymentStatus)
+
+	var result pushResult
+	testutil.Decode(t, env.Do(t, "POST", "/api/v1/push", models.DeploymentPushRequest{
+		{Domain: "test.com", AppName: "api", DockerImage: "api:1", Port: 8080},
+	}), http.StatusCreated, &result)
+	path := "/api/v1/deployments/" + result.Created[0].ID.String()
+
+	w := env.Do(t, "GET", path, nil)
+	testutil.Decode(t, w, http.StatusOK, nil)
+	etag := w.Header().Get("ETag")
+
+	// Each update is conditional on the ETag the last successful one
+	// returned unless it sends one of its own; deployed sets deployed_at,
+	// which the database stores at a coarser precision than the clock reads
+	tests := []struct {
+		name    string
+		path    string
+		status  string
+		ifMatch string
+		code    int
+	}{
+		{name: "deploying", status: "deploying", code: http.StatusOK},
+		{name: "deployed", status: "deployed", code: http.StatusOK},
+		{name: "stale etag", status: "rolled_back", ifMatch: `"stale"`, code: http.StatusPreconditionFailed},
+		{name: "no if-match", status: "rolled_back", ifMatch: "-", code: http.StatusPreconditionRequired},
+		{name: "rolled back", status: "rolled_back", code: http.StatusOK},
+		{name: "any etag", status: "deployed", ifMatch: "*", code: http.StatusOK},
+		{name: "unknown deployment", path: "/api/v1/deployments/" + uuid.NewString(), status: "deployed", ifMatch: "*", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, header := path, ifMatch(etag)
+			if tt.path != "" {
+				target = tt.path
+			}
+			switch tt.ifMatch {
+			case "":
+			case "-":
+				header = nil
+			default:
+				header = ifMatch(tt.ifMatch)
+			}
+
+			w := env.DoWithHeader(t, "PATCH", target+"/status", models.StatusUpdateRequest{Status: tt.status}, header)
+			testutil.Decode(t, w, tt.code, nil)
+			if tt.code != http.StatusOK {
+				return
+			}
+			etag = w.Header().Get("ETag")
+
+			w = env.Do(t, "GET", path, nil)
+			var stored models.Deployment
+			testutil.Decode(t, w, http.StatusOK, &stored)
+			if got := w.Header().Get("ETag"); got != etag || stored.Status != tt.status {
+				t.Fatalf("PATCH returned ETag %s, GET returned %s with status %s", etag, got, stored.Status)
+			}
+		})
+	}
+}
+
+func TestIntegrationPushIdempotency(t *testing.T) {
+	env := testutil.New(t, nil)
+	env.Router.POST("/api/v1/push", env.Handler.Push)
+
+	api := func(image string) models.DeploymentPushRequest {
+		return models.DeploymentPushRequest{{Domain: "test.com", AppName: "api", DockerImage: image, Port: 8080}}
+	}
+
+	// Each push runs after the ones before it, so replays find the
+	// responses stored by earlier cases
+	tests := []struct {
+		name     string
+		key      string
+		batch    models.DeploymentPushRequest
+		status   int
+		replayed bool
+		version  int
+	}{
+		{name: "first use", key: "ci-run-1", batch: api("api:1"), status: http.StatusCreated, version: 1},
+		{name: "replay", key: "ci-run-1", batch: api("api:1"), status: http.StatusCreated, replayed: true, version: 1},
+		{name: "reused with another payload", key: "ci-run-1", batch: api("api:2"), status: http.StatusUnprocessableEntity},
+		{name: "new key", key: "ci-run-2", batch: api("api:2"), status: http.StatusCreated, version: 2},
+		{name: "no key", batch: api("api:3"), status: http.StatusCreated, version: 3},
+	}
+
+	bodies := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			if tt.key != "" {
+				header = http.Header{handlers.IdempotencyKeyHeader: {tt.key}}
+			}
+			w := env.DoWithHeader(t, "POST", "/api/v1/push", tt.batch, header)
+			body := w.Body.String()
+
+			var result pushResult
+			testutil.Decode(t, w, tt.status, &result)
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("expected replayed %v, got %v", tt.replayed, replayed)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			if len(result.Created) != 1 || result.Created[0].Version != tt.version {
+				t.Fatalf("expected version %d created, got %+v", tt.version, result)
+			}
+			if tt.replayed && body != bodies[tt.key] {
+				t.Errorf("expected the stored response replayed, got %s", body)
+			}
+			bodies[tt.key] = body
+		})
+	}
+
+	var count int
+	if err := env.DB.Pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM deployments").Scan(&count); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 deployments created, got %d", count)
+	}
+}
+
+func TestIntegrationJobLeases(t *testing.T) {
+	env := testutil.New(t, nil)
+	ctx := context.Background()
+
+	// expire makes a column of the job lie in the past, as if time had passed
+	expire := func(t *testing.T, job *models.Job, column string) {
+		t.Helper()
+		if _, err := env.DB.Pool.Exec(ctx, "UPDATE jobs SET "+column+" = NOW() - INTERVAL '1 second' WHERE id = $1", job.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Each case claims a job of a type of its own, so cases don't see each
+	// other's jobs; claimed is the job after its first claim
+	tests := []struct {
+		name string
+		run  func(t *testing.T, types []string, claimed *models.Job)
+	}{
+		{
+			name: "held lease blocks a second claim",
+			run: func(t *testing.T, types []string, claimed *models.Job) {
+				if job, err := env.DB.ClaimJob(ctx, types, time.Minute); err != nil || job != nil {
+					t.Fatalf("expected nothing to claim, got %+v, %v", job, err)
+				}
+				if err := env.DB.RenewJobLease(ctx, claimed.ID, claimed.Attempts, time.Minute); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				status, err := env.DB.FinishJob(ctx, claimed.ID, claimed.Attempts, models.JobStatusSucceeded, nil, "", 0)
+				if err != nil || status != models.JobStatusSucceeded {
+					t.Fatalf("expected succeeded, got %s, %v", status, err)
+				}
+				if err := env.DB.RenewJobLease(ctx, claimed.ID, claimed.Attempts, time.Minute); err == nil || err.Error() != "job not found" {
+					t.Errorf("expected a finished job's lease not to renew, got %v", err)
+				}
+			},
+		},
+		{
+			name: "lapsed lease is reclaimed",
+			run: func(t *testing.T, types []string, claimed *models.Job) {
+				expire(t, claimed, "lease_expires_at")
+				job, err := env.DB.ClaimJob(ctx, types, time.Minute)
+				if err != nil || job == nil || job.ID != claimed.ID || job.Attempts != 2 {
+					t.Fatalf("expected the job reclaimed on attempt 2, got %+v, %v", job, err)
+				}
+				if err := env.DB.RenewJobLease(ctx, claimed.ID, claimed.Attempts, time.Minute); err == nil || err.Error() != "job not found" {
+					t.Errorf("expected the first attempt's lease not to renew, got %v", err)
+				}
+
+				// The first attempt's writes must not touch the second
+				if err := env.DB.UpdateJobProgress(ctx, claimed.ID, claimed.Attempts, 1); err == nil || err.Error() != "job not found" {
+					t.Errorf("expected the first attempt's progress rejected, got %v", err)
+				}
+				if _, err := env.DB.FinishJob(ctx, claimed.ID, claimed.Attempts, models.JobStatusFailed, nil, "stale", 0); err == nil || err.Error() != "job not found" {
+					t.Errorf("expected the first attempt's outcome rejected, got %v", err)
+				}
+				if _, err := env.DB.RequeueJob(ctx, claimed.ID, claimed.Attempts); err == nil || err.Error() != "job not found" {
+					t.Errorf("expected the first attempt's requeue rejected, got %v", err)
+				}
+				status, err := env.DB.FinishJob(ctx, job.ID, job.Attempts, models.JobStatusSucceeded, nil, "", 0)
+				if err != nil || status != models.JobStatusSucceeded {
+					t.Errorf("expected the second attempt's outcome recorded, got %s, %v", status, err)
+				}
+			},
+		},
+		{
+			name: "requeue gives the attempt back",
+			run: func(t *testing.T, types []string, claimed *models.Job) {
+				status, err := env.DB.RequeueJob(ctx, claimed.ID, claimed.Attempts)
+				if err != nil || status != models.JobStatusQueued {
+					t.Fatalf("expected queued, got %s, %v", status, err)
+				}
+				job, err := env.DB.ClaimJob(ctx, types, time.Minute)
+				if err != nil || job == nil || job.Attempts != 1 || job.Error != "interrupted by shutdown" {
+					t.Fatalf("expected the job claimed again on attempt 1, got %+v, %v", job, err)
+				}
+			},
+		},
+		{
+			name: "failed attempt waits for run_after",
+			run: func(t *testing.T, types []string, claimed *models.Job) {
+				status, err := env.DB.FinishJob(ctx, claimed.ID, claimed.Attempts, models.JobStatusQueued, nil, "boom", time.Hour)
+				if err != nil || status != models.JobStatusQueued {
+					t.Fatalf("expected queued, got %s, %v", status, err)
+				}
+				if job, err := env.DB.ClaimJob(ctx, types, time.Minute); err != nil || job != nil {
+					t.Fatalf("expected nothing due, got %+v, %v", job, err)
+				}
+				expire(t, claimed, "run_after")
+				job, err := env.DB.ClaimJob(ctx, types, time.Minute)
+				if err != nil || job == nil || job.Attempts != 2 || job.Error != "boom" {
+					t.Fatalf("expected the job retried on attempt 2, got %+v, %v", job, err)
+				}
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types := []string{fmt.Sprintf("test-%d", i)}
+			if _, err := env.DB.EnqueueJob(ctx, types[0], models.PriorityBulk, nil, 0); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			hotfix, err := env.DB.EnqueueJob(ctx, types[0], models.PriorityHotfix, nil, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The newer hotfix job goes first; the bulk one is claimed
+			// out of the way so only the hotfix job is left to reclaim
+			claimed, err := env.DB.ClaimJob(ctx, types, time.Minute)
+			if err != nil || claimed == nil || claimed.ID != hotfix.ID || claimed.Attempts != 1 || claimed.LeaseExpiresAt == nil {
+				t.Fatalf("expected the hotfix job claimed under a lease, got %+v, %v", claimed, err)
+			}
+			if bulk, err := env.DB.ClaimJob(ctx, types, time.Hour); err != nil || bulk == nil {
+				t.Fatalf("expected the bulk job claimed, got %+v, %v", bulk, err)
+			}
+
+			tt.run(t, types, claimed)
+		})
+	}
+}
+
+func TestIntegrationRetries(t *testing.T) {
+	env := testutil.New(t, nil)
+	ctx := context.Background()
+
+	imagePull := &models.DeploymentFailure{Code: models.FailureImagePull, Message: "pull failed"}
+
+	// Backoffs are zero, so a scheduled retry is due straight away
+	tests := []struct {
+		name        string
+		maxAttempts int
+		retryOn     []string
+		failures    int
+		superseded  bool
+		status      string
+		event       string
+	}{
+		{name: "retried", maxAttempts: 3, failures: 1, status: "pending", event: models.EventRetried},
+		{name: "code not retried", maxAttempts: 3, retryOn: []string{models.FailureHealthCheckTimeout}, failures: 1, status: "failed", event: models.EventRetrySkipped},
+		{name: "superseded", maxAttempts: 3, failures: 1, superseded: true, status: "failed", event: models.EventRetrySkipped},
+		{name: "exhausted", maxAttempts: 2, failures: 2, status: "failed", event: models.EventRetriesExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := models.DeploymentRequest{Domain: "test.com", AppName: tt.name, DockerImage: "app:1", Port: 80}
+			if _, err := env.DB.UpsertRetryPolicy(ctx, models.RetryPolicy{Domain: req.Domain, AppName: req.AppName, MaxAttempts: tt.maxAttempts, RetryOn: append([]string{}, tt.retryOn...)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			d, err := env.DB.CreateDeployment(ctx, req, "req")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for range tt.failures {
+				if _, err := env.DB.UpdateDeploymentStatus(ctx, d.ID, "deploying", nil, nil, nil); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if _, err := env.DB.UpdateDeploymentStatus(ctx, d.ID, "failed", imagePull, nil, nil); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tt.superseded {
+					req.DockerImage = "app:2"
+					if _, err := env.DB.CreateDeployment(ctx, req, "req"); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+				if _, err := env.DB.RunDueRetries(ctx); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			stored, err := env.DB.GetDeployment(ctx, d.ID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stored.Status != tt.status {
+				t.Errorf("expected status %s, got %s", tt.status, stored.Status)
+			}
+			if stored.Status == "pending" && stored.Failure != nil {
+				t.Errorf("expected the retry to clear the failure, got %+v", stored.Failure)
+			}
+
+			events, err := env.DB.ListDeploymentEvents(ctx, d.ID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Events of one transaction share a timestamp, so their order
+			// is not checked
+			if !slices.ContainsFunc(events, func(e models.DeploymentEvent) bool { return e.Type == tt.event }) {
+				t.Errorf("expected a %s event, got %+v", tt.event, events)
+			}
+		})
+	}
+}
+
+func TestIntegrationDailyCountsFollowStatusChanges(t *testing.T) {
+	env := testutil.New(t, nil)
+	ctx := context.Background()
+
+	web, err := env.DB.CreateDeployment(ctx, models.DeploymentRequest{Domain: "test.com", AppName: "web", DockerImage: "web:1", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Three days old, so a newer day is counted after it
+	if _, err := env.DB.Pool.Exec(ctx, "UPDATE deployments SET created_at = NOW() - INTERVAL '3 days' WHERE id = $1", web.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := env.DB.CreateDeployment(ctx, models.DeploymentRequest{Domain: "test.com", AppName: "api", DockerImage: "api:1", Port: 80}, "req"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := env.DB.RefreshAnalytics(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := env.DB.UpdateDeploymentStatus(ctx, web.ID, "failed", nil, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := env.DB.RefreshAnalytics(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	counts, err := env.DB.GetDeploymentTrends(ctx, time.Now().AddDate(0, 0, -5))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed := map[string]int{}
+	for _, count := range counts {
+		failed[count.AppName] += count.FailedCount
+	}
+	if len(counts) != 2 || failed["web"] != 1 {
+		t.Errorf("expected web's failure counted on its creation day, got %+v", counts)
+	}
+}
+
+func TestIntegrationDeploymentOutcomes(t *testing.T) {
+	env := testutil.New(t, nil)
+	ctx := context.Background()
+	since := time.Now().AddDate(0, 0, -1)
+
+	// Each case pushes versions of an app of its own and walks each through
+	// its statuses, in order
+	tests := []struct {
+		name     string
+		versions [][]string
+
+		// outcomes has a letter per version for each transition reached:
+		// deployed, failed, rolled back and restored
+		outcomes []string
+	}{
+		{name: "deployed", versions: [][]string{{"deploying", "deployed"}}, outcomes: []string{"d"}},
+		{name: "failed", versions: [][]string{{"deploying", "failed"}}, outcomes: []string{"f"}},
+		{name: "pending", versions: [][]string{{}}, outcomes: []string{""}},
+		{name: "redeployed", versions: [][]string{{"deploying", "deployed", "deploying", "deployed"}}, outcomes: []string{"d"}},
+		{
+			name:     "rolled back and restored",
+			versions: [][]string{{"deploying", "deployed", "rolled_back"}, {"deploying", "deployed"}},
+			outcomes: []string{"drs", "d"},
+		},
+		{
+			name:     "rolled back, next failed",
+			versions: [][]string{{"deploying", "deployed", "rolled_back"}, {"deploying", "failed"}},
+			outcomes: []string{"dr", "f"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, statuses := range tt.versions {
+				d, err := env.DB.CreateDeployment(ctx, models.DeploymentRequest{Domain: "test.com", AppName: tt.name, DockerImage: fmt.Sprintf("app:%d", i+1), Port: 80}, "req")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, status := range statuses {
+					if _, err := env.DB.UpdateDeploymentStatus(ctx, d.ID, status, nil, nil, nil); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+			}
+
+			outcomes, err := env.DB.ListDeploymentOutcomes(ctx, since)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, o := range outcomes {
+				if o.AppName != tt.name {
+					continue
+				}
+				reached := ""
+				for _, tr := range []struct {
+					letter string
+					at     *time.Time
+				}{{"d", o.DeployedAt}, {"f", o.FailedAt}, {"r", o.RolledBackAt}, {"s", o.RestoredAt}} {
+					if tr.at != nil {
+						reached += tr.letter
+					}
+				}
+				got = append(got, reached)
+			}
+			if !slices.Equal(got, tt.outcomes) {
+				t.Errorf("expected outcomes %v, got %v", tt.outcomes, got)
+			}
+		})
+	}
+}
+
+func TestIntegrationClockDrivesExpiry(t *testing.T) {
+	env := testutil.New(t, nil)
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+	env.DB.SetClock(clk)
+
+	// Each case checks something is live, moves the database's clock past
+	// its expiry or due time, and checks again; nothing waits in real time
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		expired func(t *testing.T) bool
+	}{
+		{
+			name: "leader lease",
+			setup: func(t *testing.T) {
+				if _, held, err := env.DB.AcquireLease(ctx, "leader", "a", time.Minute); err != nil || !held {
+					t.Fatalf("expected a to take the lease, got %v, %v", held, err)
+				}
+			},
+			expired: func(t *testing.T) bool {
+				_, held, err := env.DB.AcquireLease(ctx, "leader", "b", time.Minute)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return held
+			},
+		},
+		{
+			name: "job lease",
+			setup: func(t *testing.T) {
+				if _, err := env.DB.EnqueueJob(ctx, "clock", models.PriorityNormal, nil, 0); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if job, err := env.DB.ClaimJob(ctx, []string{"clock"}, time.Minute); err != nil || job == nil {
+					t.Fatalf("expected the job claimed, got %+v, %v", job, err)
+				}
+			},
+			expired: func(t *testing.T) bool {
+				job, err := env.DB.ClaimJob(ctx, []string{"clock"}, time.Minute)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return job != nil && job.Attempts == 2
+			},
+		},
+		{
+			name: "idempotency reservation",
+			setup: func(t *testing.T) {
+				if _, reserved, err := env.DB.ReserveIdempotencyKey(ctx, "clock", "hash"); err != nil || !reserved {
+					t.Fatalf("expected the key reserved, got %v, %v", reserved, err)
+				}
+			},
+			expired: func(t *testing.T) bool {
+				_, reserved, err := env.DB.ReserveIdempotencyKey(ctx, "clock", "hash")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return reserved
+			},
+		},
+		{
+			name: "schedule",
+			setup: func(t *testing.T) {
+				if _, err := env.DB.UpsertSchedule(ctx, "test.com", "nightly", "0 3 * * *", false, clk.Now().Add(time.Minute)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+			expired: func(t *testing.T) bool {
+				ran, err := env.DB.RunDueSchedules(ctx, func(ctx context.Context, schedule *models.Schedule) (*uuid.UUID, time.Time, string) {
+					return nil, clk.Now().Add(24 * time.Hour), ""
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return ran == 1
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			if tt.expired(t) {
+				t.Fatal("expected it live before the clock moved")
+			}
+			clk.Advance(5 * time.Minute)
+			if !tt.expired(t) {
+				t.Error("expected it expired or due once the clock moved past it")
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/jobs"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// jobsPath is the base path of the jobs resource
+const jobsPath = "/api/v1/jobs"
+
+// pushJobPayload is the payload stored for async push jobs
+type pushJobPayload struct {
+	RequestID   string                       `json:"request_id"`
+	Deployments models.DeploymentPushRequest `json:"deployments"`
+	Options     pushOptions                  `json:"options"`
+}
+
+// enqueuePush queues a validated push batch for the worker pool
+func (h *Handler) enqueuePush(ctx context.Context, deploymentRequests models.DeploymentPushRequest, opts pushOptions) (*models.Job, string, error) {
+	requestID := uuid.New().String()
+
+	payload, err := json.Marshal(pushJobPayload{
+		RequestID:   requestID,
+		Deployments: deploymentRequests,
+		Options:     opts,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode push job: %w", err)
+	}
+
+	// The batch is queued at its most urgent item's priority, so a hotfix
+	// is not stuck behind a bulk import
+	priority := models.PriorityBulk
+	for _, req := range deploymentRequests {
+		if models.PriorityRank(req.Priority) < models.PriorityRank(priority) {
+			priority = req.Priority
+		}
+	}
+
+	job, err := h.db.EnqueueJob(ctx, models.JobTypePush, priority, payload, len(deploymentRequests))
+	if err != nil {
+		return nil, "", err
+	}
+
+	h.logger.Info("Queued async deployment push",
+		"job_id", job.ID,
+		"request_id", requestID,
+		"priority", priority,
+		"count", len(deploymentRequests))
+
+	return job, requestID, nil
+}
+
+// pushJobResponse builds the 202 response for a queued push
+func pushJobResponse(job *models.Job, requestID string) models.APIResponse {
+	return models.APIResponse{
+		Success: true,
+		Message: "Deployment push queued",
+		Data: map[string]interface{}{
+			"job_id":     job.ID,
+			"request_id": requestID,
+			"status":     job.Status,
+			"priority":   job.Priority,
+			"total":      job.Total,
+			"_links": models.Links{
+				"job": {Href: jobsPath + "/" + job.ID.String()},
+			},
+		},
+	}
+}
+
+// RunPushJob is the worker pool handler for async push jobs
+func (h *Handler) RunPushJob(ctx context.Context, job *models.Job, progress jobs.ProgressFunc) (interface{}, error) {
+	var payload pushJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid push job payload: %w", err)
+	}
+
+	opts := payload.Options
+	opts.Progress = progress
+
+	_, response := h.processPush(ctx, payload.Deployments, payload.RequestID, opts)
+	if !response.Success {
+		return response.Data, fmt.Errorf("no deployments were created")
+	}
+
+	return response.Data, nil
+}
+
+// jobStatuses lists the job statuses accepted by the list filter
+var jobStatuses = []string{
+	models.JobStatusQueued,
+	models.JobStatusRunning,
+	models.JobStatusSucceeded,
+	models.JobStatusFailed,
+	models.JobStatusCancelled,
+	models.JobStatusDead,
+}
+
+// jobTypes lists the job types accepted by the list filter
+var jobTypes = []string{
+	models.JobTypePush,
+	models.JobTypeGitSync,
+	models.JobTypeImageUpdate,
+	models.JobTypeWebhook,
+	models.JobTypeRetention,
+	models.JobTypeOrphans,
+}
+
+// QueueSweep returns a periodic task that queues a job of jobType for the
+// worker pool unless one is already queued or running, so each sweep shows
+// up under /api/v1/jobs, where it can be cancelled or retried
+func (h *Handler) QueueSweep(jobType string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for _, status := range []string{models.JobStatusQueued, models.JobStatusRunning} {
+			active, err := h.db.ListJobs(ctx, status, jobType, nil, 1)
+			if err != nil {
+				return err
+			}
+			if len(active) > 0 {
+				h.logger.Debug("Skipped queueing a sweep that is still pending", "type", jobType, "job_id", active[0].ID)
+				return nil
+			}
+		}
+		_, err := h.db.EnqueueJob(ctx, jobType, models.PriorityBulk, nil, 1)
+		return err
+	}
+}
+
+// RunSweepJob runs a sweep queued by QueueSweep
+func RunSweepJob(sweep func(ctx context.Context) error) jobs.HandlerFunc {
+	return func(ctx context.Context, job *models.Job, progress jobs.ProgressFunc) (interface{}, error) {
+		if err := sweep(ctx); err != nil {
+			return nil, err
+		}
+		progress(1)
+		return nil, nil
+	}
+}
+
+// jobIDFromPath parses the :id path param, responding with 400 when invalid
+func (h *Handler) jobIDFromPath(c *gin.Context) (uuid.UUID, bool) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid job ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid job ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// respondJobError maps a job lookup or action error to a response
+func (h *Handler) respondJobError(c *gin.Context, err error, message string) {
+	switch err.Error() {
+	case "job not found":
+		RespondError(c, http.StatusNotFound, "Job not found")
+	case "job is not queued or running":
+		RespondError(c, http.StatusConflict, "Only queued or running jobs can be cancelled")
+	case "job is not failed, cancelled or dead":
+		RespondError(c, http.StatusConflict, "Only failed, cancelled or dead jobs can be retried")
+	default:
+		RespondError(c, http.StatusInternalServerError, message)
+	}
+}
+
+// paginateJobs trims a page fetched with limit+1 rows and returns the
+// pagination metadata for it
+func paginateJobs(jobs []models.Job, limit int) ([]models.Job, *models.Pagination) {
+	pagination := &models.Pagination{Limit: limit}
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		last := jobs[len(jobs)-1]
+		pagination.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return jobs, pagination
+}
+
+// ListJobs handles GET /api/v1/jobs - background jobs newest first,
+// filtered by ?status= and ?type=
+func (h *Handler) ListJobs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	status := c.Query("status")
+	if status != "" && !slices.Contains(jobStatuses, status) {
+		RespondError(c, http.StatusBadRequest, "status must be one of: "+strings.Join(jobStatuses, ", "))
+		return
+	}
+	jobType := c.Query("type")
+	if jobType != "" && !slices.Contains(jobTypes, jobType) {
+		RespondError(c, http.StatusBadRequest, "type must be one of: "+strings.Join(jobTypes, ", "))
+		return
+	}
+
+	cursor, limit, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+
+	jobs, err := h.db.ListJobs(ctx, status, jobType, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("Failed to list jobs", "error", err, "status", status, "type", jobType)
+		RespondError(c, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+
+	jobs, pagination := paginateJobs(jobs, limit)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success:    true,
+		Data:       jobs,
+		Pagination: pagination,
+	})
+}
+
+// GetJob handles GET /api/v1/jobs/:id
+func (h *Handler) GetJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	id, ok := h.jobIDFromPath(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.db.GetJob(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get job", "error", err, "id", id)
+		h.respondJobError(c, err, "Failed to get job")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// CancelJob handles POST /api/v1/jobs/:id/cancel - queued jobs are cancelled
+// at once; running jobs are asked to stop and report cancel_requested until
+// they do
+func (h *Handler) CancelJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	id, ok := h.jobIDFromPath(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.db.CancelJob(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to cancel job", "error", err, "id", id)
+		h.respondJobError(c, err, "Failed to cancel job")
+		return
+	}
+
+	h.logger.Info("Cancelled job",
+		"id", id,
+		"type", job.Type,
+		"status", job.Status,
+		"actor", c.GetString(ActorKey))
+
+	message := "Job cancelled successfully"
+	if job.Status == models.JobStatusRunning {
+		message = "Job cancellation requested"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    job,
+	})
+}
+
+// RetryJob handles POST /api/v1/jobs/:id/retry - queues a failed, cancelled
+// or dead-lettered job again with its original payload
+func (h *Handler) RetryJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	id, ok := h.jobIDFromPath(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.db.RetryJob(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to retry job", "error", err, "id", id)
+		h.respondJobError(c, err, "Failed to retry job")
+		return
+	}
+
+	h.logger.Info("Requeued job", "id", id, "type", job.Type, "actor", c.GetString(ActorKey))
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Job queued for retry",
+		Data:    job,
+	})
+}
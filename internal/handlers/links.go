@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"deployment-controller/internal/models"
+)
+
+// deploymentsPath is the base path of the deployments resource
+const deploymentsPath = "/api/v1/deployments"
+
+// addLinks attaches hypermedia links for related resources to a deployment
+func addLinks(d *models.Deployment) {
+	self := deploymentsPath + "/" + d.ID.String()
+	d.Links = models.Links{
+		"self":     {Href: self},
+		"history":  {Href: self + "/history"},
+		"events":   {Href: self + "/events"},
+		"logs":     {Href: self + "/logs"},
+		"status":   {Href: self + "/status", Method: "PATCH"},
+		"rollback": {Href: self + "/rollback", Method: "POST"},
+	}
+}
+
+// addLinksAll attaches hypermedia links to every deployment in a list
+func addLinksAll(deployments []models.Deployment) {
+	for i := range deployments {
+		addLinks(&deployments[i])
+	}
+}
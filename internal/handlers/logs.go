@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Deployment log page sizes, in chunks
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+)
+
+// UploadDeploymentLog handles POST /api/v1/deployments/:id/logs and its
+// agent counterpart - the next chunk of a deployment's log. Chunks are
+// numbered from 0; re-sending a stored chunk is a no-op, so uploads can be
+// retried.
+func (h *Handler) UploadDeploymentLog(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to store log chunk")
+	if !ok {
+		return
+	}
+
+	var req models.DeploymentLogRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid log chunk", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if *req.Seq < 0 {
+		RespondValidationError(c, "Invalid log chunk", []models.FieldError{{Field: "seq", Message: "must not be negative"}})
+		return
+	}
+	if limit := h.cfg.Logs.MaxChunkBytes; len(req.Content) > limit {
+		RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Log chunk exceeds the %d byte limit", limit))
+		return
+	}
+
+	chunk, err := h.db.AppendDeploymentLog(ctx, models.DeploymentLogChunk{
+		DeploymentID: deployment.ID,
+		Seq:          *req.Seq,
+		Content:      req.Content,
+		Agent:        c.GetString(ActorKey),
+	}, h.cfg.Logs.MaxBytes)
+	if err != nil {
+		h.logger.Error("Failed to store log chunk", "error", err, "id", deployment.ID, "seq", *req.Seq)
+		switch {
+		case err.Error() == "deployment not found":
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+		case err.Error() == "log chunk conflicts with the stored chunk":
+			RespondError(c, http.StatusConflict, "Log chunk conflicts with the stored chunk of the same seq")
+		case strings.HasPrefix(err.Error(), "log chunk out of sequence"):
+			RespondError(c, http.StatusConflict, "Log chunk out of sequence"+strings.TrimPrefix(err.Error(), "log chunk out of sequence"))
+		case err.Error() == "deployment log is archived":
+			RespondError(c, http.StatusConflict, "Deployment log is archived and can no longer be appended to")
+		case err.Error() == "log size limit exceeded":
+			RespondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Deployment log exceeds the %d byte limit", h.cfg.Logs.MaxBytes))
+		default:
+			RespondError(c, http.StatusInternalServerError, "Failed to store log chunk")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    chunk,
+	})
+}
+
+// GetDeploymentLogs handles GET /api/v1/deployments/:id/logs
+// ?from_seq=0&to_seq=&limit=100 - a range of a deployment's log chunks, or
+// their content as plain text with format=text
+func (h *Handler) GetDeploymentLogs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var errs []models.FieldError
+	seqParam := func(name string, def int64) int64 {
+		value := c.Query(name)
+		if value == "" {
+			return def
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			errs = append(errs, models.FieldError{Field: name, Message: "must be a non-negative integer"})
+		}
+		return n
+	}
+	fromSeq := seqParam("from_seq", 0)
+	toSeq := seqParam("to_seq", -1)
+	limit := defaultLogLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLogLimit {
+			errs = append(errs, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxLogLimit)})
+		}
+		limit = n
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "text" {
+		errs = append(errs, models.FieldError{Field: "format", Message: "must be json or text"})
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid log query", errs)
+		return
+	}
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to get deployment logs")
+	if !ok {
+		return
+	}
+
+	chunks, archived, err := h.listDeploymentLogs(ctx, deployment.ID, fromSeq, toSeq, limit)
+	if err != nil {
+		h.logger.Error("Failed to list deployment logs", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment logs")
+		return
+	}
+
+	next := fromSeq
+	if len(chunks) > 0 {
+		next = chunks[len(chunks)-1].Seq + 1
+	}
+
+	if format == "text" {
+		var b strings.Builder
+		for _, chunk := range chunks {
+			b.WriteString(chunk.Content)
+		}
+		c.Header("X-Next-Seq", strconv.FormatInt(next, 10))
+		c.String(http.StatusOK, b.String())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.DeploymentLog{
+			DeploymentID: deployment.ID,
+			Chunks:       chunks,
+			NextSeq:      next,
+			Archived:     archived,
+		},
+	})
+}
+
+// listDeploymentLogs lists a range of a deployment's log chunks like
+// ListDeploymentLogs, reading them from the blob store once the log has been
+// archived there; it reports whether it did
+func (h *Handler) listDeploymentLogs(ctx context.Context, id uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, bool, error) {
+	chunks, err := h.db.ListDeploymentLogs(ctx, id, fromSeq, toSeq, limit)
+	if err != nil || len(chunks) > 0 || h.blobs == nil {
+		return chunks, false, err
+	}
+
+	archived, ok, err := h.readArchivedLog(ctx, id, fromSeq, toSeq, limit)
+	if err != nil || !ok {
+		return chunks, false, err
+	}
+	return archived, true, nil
+}
+
+// finishedStatuses end a deployment's log stream once its log is drained
+var finishedStatuses = map[string]bool{
+	"deployed":    true,
+	"failed":      true,
+	"rolled_back": true,
+}
+
+// logStreamEnd is the data of the end event closing a log stream
+type logStreamEnd struct {
+	Status  string `json:"status"`
+	NextSeq int64  `json:"next_seq"`
+}
+
+// StreamDeploymentLogs handles GET /api/v1/deployments/:id/logs/stream - a
+// Server-Sent Events stream of the deployment's log chunks from from_seq,
+// relayed as agents upload them. Each chunk is a log event whose id is its
+// seq, so reconnecting clients resume through Last-Event-ID. The stream ends
+// with an end event once the deployment has finished and its log is drained.
+func (h *Handler) StreamDeploymentLogs(c *gin.Context) {
+	var next int64
+	if last := c.GetHeader("Last-Event-ID"); last != "" {
+		seq, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || seq < 0 {
+			RespondError(c, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		next = seq + 1
+	} else if value := c.Query("from_seq"); value != "" {
+		seq, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seq < 0 {
+			RespondValidationError(c, "Invalid log query", []models.FieldError{{Field: "from_seq", Message: "must be a non-negative integer"}})
+			return
+		}
+		next = seq
+	}
+
+	ctx := c.Request.Context()
+	lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	deployment, ok := h.deploymentFromPath(lookupCtx, c, "Failed to stream deployment logs")
+	cancel()
+	if !ok {
+		return
+	}
+
+	// Subscribe before the first read so no upload falls in between
+	var wake <-chan struct{}
+	if h.logs != nil {
+		var unsubscribe func()
+		wake, unsubscribe = h.logs.Subscribe(deployment.ID)
+		defer unsubscribe()
+	}
+	ticker := time.NewTicker(h.cfg.Logs.StreamPollInterval)
+	defer ticker.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	status := deployment.Status
+	for {
+		chunks, _, err := h.listDeploymentLogs(ctx, deployment.ID, next, -1, maxLogLimit)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Error("Failed to stream deployment logs", "error", err, "id", deployment.ID)
+			}
+			return
+		}
+		for _, chunk := range chunks {
+			if err := writeEvent(c.Writer, strconv.FormatInt(chunk.Seq, 10), "log", chunk); err != nil {
+				return
+			}
+			next = chunk.Seq + 1
+		}
+		if len(chunks) == maxLogLimit {
+			continue
+		}
+
+		// The status is read before the chunks, so every chunk uploaded
+		// before the deployment finished has been sent
+		if finishedStatuses[status] {
+			writeEvent(c.Writer, "", "end", logStreamEnd{Status: status, NextSeq: next})
+			c.Writer.Flush()
+			return
+		}
+		c.Writer.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+			// Hand clients over to another replica while draining
+			if h.IsDraining() {
+				return
+			}
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+
+		latest, err := h.db.GetDeployment(ctx, deployment.ID)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Error("Failed to get deployment", "error", err, "id", deployment.ID)
+			}
+			return
+		}
+		status = latest.Status
+	}
+}
+
+// writeEvent writes one server-sent event with JSON data, omitting the id
+// when it is empty
+func writeEvent(w io.Writer, id, event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+	return err
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceApps returns the apps in maintenance, keyed by domain and app
+// name
+func (h *Handler) maintenanceApps(ctx context.Context) (map[[2]string]bool, error) {
+	list, err := h.db.ListMaintenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apps := make(map[[2]string]bool, len(list))
+	for _, m := range list {
+		apps[[2]string{m.Domain, m.AppName}] = true
+	}
+	return apps, nil
+}
+
+// ListMaintenance handles GET /api/v1/maintenance - the apps in maintenance
+func (h *Handler) ListMaintenance(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	apps, err := h.db.ListMaintenance(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list maintenance", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list maintenance")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    apps,
+	})
+}
+
+// GetMaintenance handles GET /api/v1/apps/:domain/:app_name/maintenance
+func (h *Handler) GetMaintenance(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	m, err := h.db.GetMaintenance(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get maintenance", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get maintenance")
+		return
+	}
+
+	c.Header("ETag", m.ETag())
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    m,
+	})
+}
+
+// SetMaintenance handles PATCH /api/v1/apps/:domain/:app_name/maintenance -
+// turning an app's maintenance mode on or off, conditional on If-Match
+func (h *Handler) SetMaintenance(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.MaintenanceRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid maintenance request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if !*req.Enabled && req.Reason != "" {
+		RespondValidationError(c, "Invalid maintenance request", []models.FieldError{{Field: "reason", Message: "is only used when enabling maintenance"}})
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to set maintenance")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	actor := c.GetString(ActorKey)
+	m := &models.AppMaintenance{Domain: domain, AppName: appName}
+	message := "Maintenance ended"
+	if *req.Enabled {
+		m, err = h.db.StartMaintenance(ctx, models.AppMaintenance{
+			Domain:    domain,
+			AppName:   appName,
+			Reason:    req.Reason,
+			StartedBy: actor,
+		}, ifMatch)
+		message = "Maintenance started"
+	} else {
+		err = h.db.EndMaintenance(ctx, domain, appName, ifMatch)
+	}
+	if err != nil {
+		h.logger.Error("Failed to set maintenance", "error", err, "domain", domain, "app_name", appName)
+		if err.Error() == "precondition failed" {
+			RespondError(c, http.StatusPreconditionFailed, "Maintenance was changed concurrently; refetch and retry")
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to set maintenance")
+		return
+	}
+
+	h.logger.Info(message,
+		"domain", domain,
+		"app_name", appName,
+		"reason", req.Reason,
+		"actor", actor)
+
+	c.Header("ETag", m.ETag())
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    m,
+	})
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/manifests"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/redact"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetAgentManifest handles GET /api/v1/agent/deployments/:id/manifest -
+// renders the deployment as Kubernetes, compose, Nomad or Helm values
+// configuration with its secrets materialized as the format's native secret
+// construct
+func (h *Handler) GetAgentManifest(c *gin.Context) {
+	h.renderManifest(c, manifests.FormatKubernetes, "Agent rendered manifest")
+}
+
+// GetDeploymentManifest handles GET /api/v1/deployments/:id/manifests -
+// renders the deployment like the agent endpoint, defaulting to Helm values
+// for teams deploying it with their own chart
+func (h *Handler) GetDeploymentManifest(c *gin.Context) {
+	h.renderManifest(c, manifests.FormatHelmValues, "Rendered manifest")
+}
+
+// renderManifest renders the :id deployment in the ?format= format, or
+// defaultFormat, resolving and auditing its secrets
+func (h *Handler) renderManifest(c *gin.Context, defaultFormat, logMessage string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	format := c.DefaultQuery("format", defaultFormat)
+	if !slices.Contains(manifests.Formats, format) {
+		RespondError(c, http.StatusBadRequest, "format must be one of: "+strings.Join(manifests.Formats, ", "))
+		return
+	}
+	opts := manifests.Options{InlineSecrets: h.cfg.Manifests.InlineSecrets}
+	if value := c.Query("inline_secrets"); value != "" {
+		inline, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "inline_secrets must be true or false")
+			return
+		}
+		opts.InlineSecrets = inline
+	}
+
+	deployment, err := h.db.GetDeployment(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment")
+		return
+	}
+
+	env, secretEnv, ok := h.manifestEnv(ctx, c, deployment)
+	if !ok {
+		return
+	}
+
+	maintenance, err := h.db.GetMaintenance(ctx, deployment.Domain, deployment.AppName)
+	if err != nil {
+		h.logger.Error("Failed to get maintenance", "error", err, "id", id)
+		RespondError(c, http.StatusInternalServerError, "Failed to render manifest")
+		return
+	}
+	opts.Maintenance = maintenance.Enabled
+
+	manifest, err := manifests.Render(format, deployment, env, secretEnv, opts)
+	if err != nil {
+		h.logger.Error("Failed to render manifest", "error", err, "id", id, "format", format)
+		RespondError(c, http.StatusInternalServerError, "Failed to render manifest")
+		return
+	}
+
+	h.recordAudit(ctx, c, secretReadEvents(deployment, false))
+	if snapshot := h.recordManifestSnapshot(ctx, c, deployment, manifest, env, secretEnv, opts); snapshot != nil {
+		c.Header("X-Manifest-Snapshot", strconv.FormatInt(snapshot.ID, 10))
+	}
+
+	h.logger.Info(logMessage,
+		"id", id,
+		"app_name", deployment.AppName,
+		"format", format,
+		"inline_secrets", opts.InlineSecrets,
+		"actor", c.GetString(ActorKey))
+
+	// Resolved secrets must not be stored by intermediaries
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    manifest,
+	})
+}
+
+// manifestEnv resolves a deployment's secrets for rendering, responding
+// when they cannot be. Entries that were secret references or sealed values
+// become secrets; the rest stay plain env.
+func (h *Handler) manifestEnv(ctx context.Context, c *gin.Context, deployment *models.Deployment) ([]string, []manifests.Secret, bool) {
+	resolved, agentVault, status, err := h.resolveSecretRefs(ctx, deployment.Env)
+	h.recordSecretError(ctx, deployment, err)
+	if err != nil {
+		h.logger.Error("Failed to resolve deployment secrets", "error", err, "id", deployment.ID)
+
+		if status == http.StatusInternalServerError {
+			RespondError(c, status, "Failed to resolve deployment secrets")
+			return nil, nil, false
+		}
+
+		RespondError(c, status, "Failed to resolve deployment secrets: "+err.Error())
+		return nil, nil, false
+	}
+	if agentVault {
+		RespondError(c, http.StatusConflict, "Manifests need secrets resolved by the controller; vault.resolve_mode is agent")
+		return nil, nil, false
+	}
+
+	var env []string
+	var secretEnv []manifests.Secret
+	for i, entry := range deployment.Env {
+		if !isSecretEntry(entry) {
+			env = append(env, entry)
+			continue
+		}
+
+		name, value, _ := strings.Cut(resolved[i], "=")
+		secretEnv = append(secretEnv, manifests.Secret{Name: name, Value: value})
+	}
+	return env, secretEnv, true
+}
+
+// isSecretEntry reports whether an env entry is a secret reference or a
+// sealed value rather than plain env
+func isSecretEntry(entry string) bool {
+	_, _, isRef := models.ParseSecretRef(entry)
+	_, _, isSealed := models.ParseSealedValue(entry)
+	return isRef || isSealed
+}
+
+// recordManifestSnapshot stores what was rendered for a deployment, so it can
+// be seen later what an agent was told to apply. The snapshot is rendered
+// again with sensitive env and all secret values masked; its digest is that
+// of the manifest as served. Failures are logged and leave the response be.
+func (h *Handler) recordManifestSnapshot(ctx context.Context, c *gin.Context, deployment *models.Deployment, manifest *models.Manifest,
+	env []string, secretEnv []manifests.Secret, opts manifests.Options) *models.ManifestSnapshot {
+	masked := make([]manifests.Secret, len(secretEnv))
+	for i, secret := range secretEnv {
+		masked[i] = manifests.Secret{Name: secret.Name, Value: redact.Mask}
+	}
+	rendered, err := manifests.Render(manifest.Format, deployment, h.redactor.Env(env), masked, opts)
+	if err != nil {
+		h.logger.Error("Failed to render manifest snapshot", "error", err, "id", deployment.ID, "format", manifest.Format)
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(manifest.Content))
+	snapshot, err := h.db.RecordManifestSnapshot(ctx, models.ManifestSnapshot{
+		DeploymentID:  deployment.ID,
+		Format:        manifest.Format,
+		Content:       rendered.Content,
+		SecretFiles:   rendered.SecretFiles,
+		ContentDigest: "sha256:" + hex.EncodeToString(sum[:]),
+		InlineSecrets: opts.InlineSecrets,
+		Maintenance:   opts.Maintenance,
+		RenderedBy:    c.GetString(ActorKey),
+	})
+	if err != nil {
+		h.logger.Error("Failed to record manifest snapshot", "error", err, "id", deployment.ID, "format", manifest.Format)
+		return nil
+	}
+	return snapshot
+}
+
+// ListManifestSnapshots handles GET /api/v1/deployments/:id/manifests/snapshots
+// ?format= - the distinct manifests rendered for a deployment, oldest first,
+// without their content
+func (h *Handler) ListManifestSnapshots(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	format := c.Query("format")
+	if format != "" && !slices.Contains(manifests.Formats, format) {
+		RespondError(c, http.StatusBadRequest, "format must be one of: "+strings.Join(manifests.Formats, ", "))
+		return
+	}
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to list manifest snapshots")
+	if !ok {
+		return
+	}
+
+	snapshots, err := h.db.ListManifestSnapshots(ctx, deployment.ID, format)
+	if err != nil {
+		h.logger.Error("Failed to list manifest snapshots", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to list manifest snapshots")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    snapshots,
+	})
+}
+
+// GetManifestSnapshot handles GET
+// /api/v1/deployments/:id/manifests/snapshots/:snapshot_id - one manifest
+// snapshot with its content
+func (h *Handler) GetManifestSnapshot(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	snapshotID, err := strconv.ParseInt(c.Param("snapshot_id"), 10, 64)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid snapshot ID")
+		return
+	}
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to get manifest snapshot")
+	if !ok {
+		return
+	}
+
+	snapshot, err := h.db.GetManifestSnapshot(ctx, deployment.ID, snapshotID)
+	if err != nil {
+		if err.Error() == "manifest snapshot not found" {
+			RespondError(c, http.StatusNotFound, "Manifest snapshot not found")
+			return
+		}
+		h.logger.Error("Failed to get manifest snapshot", "error", err, "id", deployment.ID, "snapshot_id", snapshotID)
+		RespondError(c, http.StatusInternalServerError, "Failed to get manifest snapshot")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    snapshot,
+	})
+}
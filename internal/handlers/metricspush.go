@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// metricsPushTimeout bounds one push to the Pushgateway
+const metricsPushTimeout = 10 * time.Second
+
+// appStatuses are the statuses exported by the app_status metric
+var appStatuses = []string{"pending", "deploying", "deployed", "failed", "rolled_back", "stalled"}
+
+// RunMetricsPush pushes the per-app deployment metrics, built from the
+// precomputed app summaries, to metrics.pushgateway_url. Each push replaces
+// the job's metrics, so apps that disappeared stop being reported.
+func (h *Handler) RunMetricsPush(ctx context.Context) error {
+	summaries, err := h.db.GetAppSummaries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get app summaries: %w", err)
+	}
+
+	pusher := push.New(h.cfg.Metrics.PushgatewayURL, h.cfg.Metrics.Job).
+		Gatherer(appMetrics(summaries).Registry)
+	if h.cfg.Metrics.Username != "" {
+		pusher = pusher.BasicAuth(h.cfg.Metrics.Username, h.cfg.Metrics.Password)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, metricsPushTimeout)
+	defer cancel()
+	if err := pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+
+	h.logger.Debug("Pushed app metrics", "apps", len(summaries))
+	return nil
+}
+
+// appMetrics sets the per-app deployment metrics from the app summaries
+func appMetrics(summaries []models.AppSummary) *metrics.Apps {
+	apps := metrics.NewApps()
+	for _, s := range summaries {
+		for _, status := range appStatuses {
+			value := 0.0
+			if s.CurrentStatus == status {
+				value = 1
+			}
+			apps.Status.WithLabelValues(s.Domain, s.AppName, status).Set(value)
+		}
+		apps.Versions.WithLabelValues(s.Domain, s.AppName).Set(float64(s.TotalVersions))
+		apps.DeployedVersions.WithLabelValues(s.Domain, s.AppName).Set(float64(s.DeployedCount))
+		apps.FailedVersions.WithLabelValues(s.Domain, s.AppName).Set(float64(s.FailedCount))
+		apps.CurrentVersion.WithLabelValues(s.Domain, s.AppName).Set(float64(s.CurrentVersion))
+		if s.LastDeployedAt != nil {
+			apps.LastDeployed.WithLabelValues(s.Domain, s.AppName).Set(float64(s.LastDeployedAt.Unix()))
+		}
+	}
+	return apps
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/manifests"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/registry"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opencontainers/go-digest"
+)
+
+// desiredState returns the desired state of an app's latest deployment,
+// taking the digest of a mutable tag from the digests tracked for drift
+// detection
+func desiredState(d *models.Deployment, tracked map[string]models.ImageDigest) models.DesiredState {
+	desired := models.DesiredState{
+		DeploymentID: d.ID,
+		Version:      d.Version,
+		Status:       d.Status,
+		DockerImage:  d.DockerImage,
+		Replicas:     manifests.Replicas,
+	}
+	if img, err := registry.ParseImage(d.DockerImage); err == nil && img.Digest != "" {
+		desired.Digest = img.Digest
+	} else if t, ok := tracked[d.Domain+"/"+d.AppName]; ok && t.DeploymentID == d.ID {
+		desired.Digest = t.DeployedDigest
+	}
+	return desired
+}
+
+// imageName returns an image reference without its digest, or the
+// reference itself when it does not parse
+func imageName(image string) string {
+	img, err := registry.ParseImage(image)
+	if err != nil {
+		return image
+	}
+	return img.Registry + "/" + img.Repository + ":" + img.Tag
+}
+
+// compareObserved compares what an agent reported running for an app with
+// its desired state
+func compareObserved(desired models.DesiredState, d *models.Deployment, observed *models.ObservedState, staleAfter time.Duration, now time.Time) models.AppComparison {
+	comparison := models.AppComparison{
+		ID:         d.Domain + "/" + d.AppName,
+		Domain:     d.Domain,
+		AppName:    d.AppName,
+		Desired:    desired,
+		Observed:   observed,
+		Mismatches: []models.Mismatch{},
+	}
+	if observed == nil {
+		comparison.State = models.ObservedUnreported
+		return comparison
+	}
+
+	mismatch := func(field, desired, observed string) {
+		comparison.Mismatches = append(comparison.Mismatches, models.Mismatch{Field: field, Desired: desired, Observed: observed})
+	}
+
+	if observed.DeploymentID != nil && *observed.DeploymentID != desired.DeploymentID {
+		mismatch("deployment_id", desired.DeploymentID.String(), observed.DeploymentID.String())
+	}
+	if imageName(observed.DockerImage) != imageName(desired.DockerImage) {
+		mismatch("docker_image", desired.DockerImage, observed.DockerImage)
+	}
+
+	observedDigest := observed.Digest
+	if img, err := registry.ParseImage(observed.DockerImage); err == nil && observedDigest == "" {
+		observedDigest = img.Digest
+	}
+	if desired.Digest != "" && observedDigest != "" && observedDigest != desired.Digest {
+		mismatch("digest", desired.Digest, observedDigest)
+	}
+
+	if observed.Replicas != desired.Replicas {
+		mismatch("replicas", strconv.Itoa(desired.Replicas), strconv.Itoa(observed.Replicas))
+	}
+
+	switch {
+	case now.Sub(observed.ReportedAt) > staleAfter:
+		comparison.State = models.ObservedStale
+	case len(comparison.Mismatches) == 0:
+		comparison.State = models.ObservedInSync
+	case desired.Status == "pending" || desired.Status == "deploying":
+		comparison.State = models.ObservedRollingOut
+	default:
+		comparison.State = models.ObservedMismatched
+	}
+	return comparison
+}
+
+// trackedDigests returns the digests tracked for drift detection keyed by
+// domain/app_name
+func (h *Handler) trackedDigests(ctx context.Context) (map[string]models.ImageDigest, error) {
+	digests, err := h.db.ListImageDigests(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]models.ImageDigest, len(digests))
+	for _, d := range digests {
+		tracked[d.Domain+"/"+d.AppName] = d
+	}
+	return tracked, nil
+}
+
+// compareApp compares an app's latest report with its latest deployment
+func (h *Handler) compareApp(ctx context.Context, latest *models.Deployment) (*models.AppComparison, error) {
+	tracked, err := h.trackedDigests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	observed, err := h.db.GetObservedState(ctx, latest.Domain, latest.AppName)
+	if err != nil {
+		if err.Error() != "observed state not found" {
+			return nil, err
+		}
+		observed = nil
+	}
+
+	comparison := compareObserved(desiredState(latest, tracked), latest, observed, h.cfg.Observed.StaleAfter, h.clock.Now())
+	return &comparison, nil
+}
+
+// ReportObservedState handles POST /api/v1/agent/apps/:domain/:app_name/observed
+// - an agent reports what actually runs for an app
+func (h *Handler) ReportObservedState(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid observed state")
+	if !ok {
+		return
+	}
+
+	var req models.ObservedStateRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid observed state request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var errs []models.FieldError
+	image, err := validation.NormalizeImage(req.DockerImage)
+	if err != nil {
+		errs = append(errs, models.FieldError{Field: "docker_image", Message: err.Error()})
+	}
+	if req.Digest != "" {
+		if _, err := digest.Parse(req.Digest); err != nil {
+			errs = append(errs, models.FieldError{Field: "digest", Message: "must be a digest such as sha256:<hex>"})
+		}
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid observed state", errs)
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	_, err = h.db.RecordObservedState(ctx, models.ObservedState{
+		Domain:       domain,
+		AppName:      appName,
+		DeploymentID: req.DeploymentID,
+		DockerImage:  image,
+		Digest:       req.Digest,
+		Replicas:     req.Replicas,
+		Agent:        c.GetString(ActorKey),
+	})
+	if err != nil {
+		h.logger.Error("Failed to record observed state", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to record observed state")
+		return
+	}
+
+	comparison, err := h.compareApp(ctx, latest)
+	if err != nil {
+		h.logger.Error("Failed to compare observed state", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to compare observed state")
+		return
+	}
+
+	if comparison.State == models.ObservedMismatched {
+		h.logger.Warn("Observed state differs from desired deployment",
+			"domain", domain,
+			"app_name", appName,
+			"deployment_id", latest.ID,
+			"mismatches", len(comparison.Mismatches),
+			"actor", c.GetString(ActorKey))
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    comparison,
+	})
+}
+
+// GetAppComparison handles GET /api/v1/apps/:domain/:app_name/observed
+func (h *Handler) GetAppComparison(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid app")
+	if !ok {
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	comparison, err := h.compareApp(ctx, latest)
+	if err != nil {
+		h.logger.Error("Failed to compare observed state", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to compare observed state")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    comparison,
+	})
+}
+
+// ListAppComparisons handles GET /api/v1/observed - every app's comparison,
+// optionally only those in one state such as mismatched
+func (h *Handler) ListAppComparisons(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	state := c.Query("state")
+	switch state {
+	case "", models.ObservedInSync, models.ObservedMismatched, models.ObservedRollingOut, models.ObservedStale, models.ObservedUnreported:
+	default:
+		RespondValidationError(c, "Invalid observed query", []models.FieldError{{Field: "state", Message: "must be one of: in_sync, mismatched, rolling_out, stale, unreported"}})
+		return
+	}
+
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get deployments", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to compare observed state")
+		return
+	}
+	tracked, err := h.trackedDigests(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list image digests", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to compare observed state")
+		return
+	}
+	states, err := h.db.ListObservedStates(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list observed states", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to compare observed state")
+		return
+	}
+
+	observed := make(map[string]*models.ObservedState, len(states))
+	for i := range states {
+		observed[states[i].Domain+"/"+states[i].AppName] = &states[i]
+	}
+
+	now := h.clock.Now()
+	comparisons := []models.AppComparison{}
+	for i := range deployments {
+		d := &deployments[i]
+		comparison := compareObserved(desiredState(d, tracked), d, observed[d.Domain+"/"+d.AppName], h.cfg.Observed.StaleAfter, now)
+		if state == "" || comparison.State == state {
+			comparisons = append(comparisons, comparison)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    comparisons,
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orphansLock is the lock held by orphaned data cleanups, on the periodic
+// worker or through the API
+const orphansLock = "task:orphans"
+
+// orphanReportLimit caps how many deployments referencing deleted secret
+// projects a report lists
+const orphanReportLimit = 1000
+
+// findOrphans reports the data left inconsistent by deletions as of now
+func (h *Handler) findOrphans(ctx context.Context, now time.Time) (*models.OrphanReport, error) {
+	report := &models.OrphanReport{CheckedAt: now}
+
+	var err error
+	if report.MissingProjects, err = h.db.ListMissingSecretProjects(ctx, orphanReportLimit); err != nil {
+		return nil, err
+	}
+	if report.UnusedRegistries, err = h.unusedRegistries(ctx, now); err != nil {
+		return nil, err
+	}
+	if report.DanglingLogs, err = h.db.ListDanglingLogs(ctx); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// unusedRegistries lists the registries with stored credentials that no
+// deployment's image is pulled from, any version of any app counting so
+// rollbacks keep working, and that have not been stored for
+// orphans.registry_grace. Hosts are compared normalized, so credentials
+// stored as INDEX.docker.io still count as used by nginx; the stored names
+// are listed as they are, for deletion.
+func (h *Handler) unusedRegistries(ctx context.Context, now time.Time) ([]string, error) {
+	images, err := h.db.ListDeploymentImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, image := range images {
+		img, err := registry.ParseImage(image)
+		if err != nil {
+			// Keep whatever host the image may name rather than guess
+			// its credentials are unused
+			host, _, _ := strings.Cut(image, "/")
+			used[registry.NormalizeHost(host)] = true
+			continue
+		}
+		used[registry.NormalizeHost(img.Registry)] = true
+	}
+
+	stale, err := h.db.ListStaleRegistries(ctx, now.Add(-h.cfg.Orphans.RegistryGrace))
+	if err != nil {
+		return nil, err
+	}
+
+	unused := []string{}
+	for _, r := range stale {
+		if !used[registry.NormalizeHost(r)] {
+			unused = append(unused, r)
+		}
+	}
+	return unused, nil
+}
+
+// cleanOrphans deletes the unused registry credentials and dangling log
+// chunks of a report, returning how many of each were deleted. Deployments
+// referencing deleted secret projects are left for a person to fix.
+func (h *Handler) cleanOrphans(ctx context.Context, report *models.OrphanReport) (registries, chunks int64, err error) {
+	if len(report.UnusedRegistries) > 0 {
+		before := report.CheckedAt.Add(-h.cfg.Orphans.RegistryGrace)
+		if registries, err = h.db.DeleteRegistryCredentials(ctx, report.UnusedRegistries, before); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(report.DanglingLogs) > 0 {
+		if chunks, err = h.db.DeleteDanglingLogs(ctx); err != nil {
+			return registries, 0, err
+		}
+	}
+	report.Cleaned = true
+	return registries, chunks, nil
+}
+
+// recordOrphanMetrics exports the counts of a report
+func recordOrphanMetrics(report *models.OrphanReport) {
+	var chunks int64
+	for _, l := range report.DanglingLogs {
+		chunks += l.Chunks
+	}
+	metrics.OrphanedRecords.WithLabelValues("missing_secret_projects").Set(float64(len(report.MissingProjects)))
+	metrics.OrphanedRecords.WithLabelValues("unused_registries").Set(float64(len(report.UnusedRegistries)))
+	metrics.OrphanedRecords.WithLabelValues("dangling_log_chunks").Set(float64(chunks))
+}
+
+// RunOrphanCheck reports the data left inconsistent by deletions and, with
+// orphans.cleanup, deletes the unused registry credentials and dangling log
+// chunks; it is run periodically by the orphans worker
+func (h *Handler) RunOrphanCheck(ctx context.Context) error {
+	report, err := h.findOrphans(ctx, h.clock.Now())
+	if err != nil {
+		return err
+	}
+	recordOrphanMetrics(report)
+
+	if len(report.MissingProjects)+len(report.UnusedRegistries)+len(report.DanglingLogs) == 0 {
+		return nil
+	}
+	h.logger.Warn("Found orphaned data",
+		"missing_secret_projects", len(report.MissingProjects),
+		"unused_registries", len(report.UnusedRegistries),
+		"dangling_logs", len(report.DanglingLogs))
+
+	if !h.cfg.Orphans.Cleanup {
+		return nil
+	}
+	registries, chunks, err := h.cleanOrphans(ctx, report)
+	if err != nil {
+		return err
+	}
+	if registries+chunks > 0 {
+		h.logger.Info("Cleaned up orphaned data", "registries", registries, "log_chunks", chunks)
+	}
+	return nil
+}
+
+// GetOrphans handles GET /api/v1/admin/orphans - the deployments
+// referencing deleted secret projects, the credentials of registries no
+// deployment uses and the archived logs with chunks left in Postgres
+func (h *Handler) GetOrphans(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	report, err := h.findOrphans(ctx, h.clock.Now())
+	if err != nil {
+		h.logger.Error("Failed to find orphaned data", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to find orphaned data")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// CleanOrphans handles POST /api/v1/admin/orphans/cleanup - deletes the
+// unused registry credentials and dangling log chunks now, whether or not
+// orphans.cleanup is set, and reports what was found
+func (h *Handler) CleanOrphans(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var report *models.OrphanReport
+	var registries, chunks int64
+	ran, err := h.db.WithLock(ctx, orphansLock, func(ctx context.Context) error {
+		var err error
+		if report, err = h.findOrphans(ctx, h.clock.Now()); err != nil {
+			return err
+		}
+		registries, chunks, err = h.cleanOrphans(ctx, report)
+		return err
+	})
+	if err != nil {
+		h.logger.Error("Failed to clean up orphaned data", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to clean up orphaned data")
+		return
+	}
+	if !ran {
+		RespondError(c, http.StatusConflict, "Orphaned data cleanup is already running")
+		return
+	}
+	recordOrphanMetrics(&models.OrphanReport{MissingProjects: report.MissingProjects})
+
+	h.logger.Info("Cleaned up orphaned data",
+		"registries", registries,
+		"log_chunks", chunks,
+		"missing_secret_projects", len(report.MissingProjects),
+		"actor", c.GetString(ActorKey))
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Deleted %d registry credentials and %d log chunks", registries, chunks),
+		Data:    report,
+	})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// encodeCursor returns an opaque cursor pointing after the given record
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (*models.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	createdAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	return &models.Cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// parsePageParams reads the limit and cursor query parameters, responding
+// with 400 when they are invalid
+func parsePageParams(c *gin.Context) (*models.Cursor, int, bool) {
+	limit := defaultPageLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxPageLimit {
+			RespondError(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return nil, 0, false
+		}
+		limit = n
+	}
+
+	var cursor *models.Cursor
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		var err error
+		cursor, err = decodeCursor(cursorStr)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid cursor")
+			return nil, 0, false
+		}
+	}
+
+	return cursor, limit, true
+}
+
+// paginateDeployments trims a page fetched with limit+1 rows and returns the
+// pagination metadata for it
+func paginateDeployments(deployments []models.Deployment, limit int) ([]models.Deployment, *models.Pagination) {
+	pagination := &models.Pagination{Limit: limit}
+	if len(deployments) > limit {
+		deployments = deployments[:limit]
+		last := deployments[len(deployments)-1]
+		pagination.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return deployments, pagination
+}
+
+// parseDateRange reads the from, to and date_field query parameters,
+// responding with 400 when they are invalid. Bounds are RFC 3339 timestamps
+// or dates; a date in to covers that whole day.
+func parseDateRange(c *gin.Context) (models.DateRange, bool) {
+	rng := models.DateRange{Field: c.DefaultQuery("date_field", models.DateFieldCreated)}
+	var errs []models.FieldError
+	if rng.Field != models.DateFieldCreated && rng.Field != models.DateFieldDeployed {
+		errs = append(errs, models.FieldError{Field: "date_field", Message: "must be created_at or deployed_at"})
+	}
+
+	parse := func(field string, endOfDay bool) *time.Time {
+		value := c.Query(field)
+		if value == "" {
+			return nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: field, Message: "must be an RFC 3339 timestamp or a YYYY-MM-DD date"})
+			return nil
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t
+	}
+	rng.From = parse("from", false)
+	rng.To = parse("to", true)
+	if rng.From != nil && rng.To != nil && !rng.From.Before(*rng.To) {
+		errs = append(errs, models.FieldError{Field: "to", Message: "must be after from"})
+	}
+
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid date range", errs)
+		return models.DateRange{}, false
+	}
+	return rng, true
+}
+
+// metadataQueryPrefix prefixes the query parameters filtering deployments by
+// metadata, as in ?metadata.ticket=OPS-42
+const metadataQueryPrefix = "metadata."
+
+// parseMetadataFilter reads the metadata.<key>=value query parameters,
+// responding with a validation error when a key is invalid or repeated
+func parseMetadataFilter(c *gin.Context) (models.MetadataFilter, bool) {
+	var filter models.MetadataFilter
+	var errs []models.FieldError
+	for param, values := range c.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, metadataQueryPrefix)
+		if !ok {
+			continue
+		}
+		if err := validation.ValidateMetadataKey(key); err != nil {
+			errs = append(errs, models.FieldError{Field: param, Message: err.Error()})
+			continue
+		}
+		if len(values) > 1 {
+			errs = append(errs, models.FieldError{Field: param, Message: "must be given at most once"})
+			continue
+		}
+		if filter == nil {
+			filter = models.MetadataFilter{}
+		}
+		filter[key] = values[0]
+	}
+
+	if len(errs) > 0 {
+		slices.SortFunc(errs, func(a, b models.FieldError) int { return strings.Compare(a.Field, b.Field) })
+		RespondValidationError(c, "Invalid metadata filter", errs)
+		return nil, false
+	}
+	return filter, true
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+)
+
+// probeConcurrency bounds how many apps are probed at once
+const probeConcurrency = 8
+
+// RunHealthProbes probes the domain of every deployed app with its health
+// check, or a request for probes.health_path when it has none, and records
+// the results, with the response time of http checks, as health probes of
+// its latest deployment; apps with exec checks are left to their agents, and
+// apps in maintenance are skipped. It is run periodically by the prober.
+func (h *Handler) RunHealthProbes(ctx context.Context) error {
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	list, err := h.db.ListHealthChecks(ctx, "")
+	if err != nil {
+		return err
+	}
+	checks := make(map[string]models.HealthCheck, len(list))
+	for _, check := range list {
+		checks[check.Domain+"/"+check.AppName] = check
+	}
+	maintenance, err := h.maintenanceApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics.AppHealthy.Reset()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for _, d := range deployments {
+		check, ok := checks[d.Domain+"/"+d.AppName]
+		if !ok {
+			check = models.HealthCheck{Type: models.HealthCheckHTTP}
+		}
+		if d.Status != "deployed" || check.Type == models.HealthCheckExec || maintenance[[2]string{d.Domain, d.AppName}] {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d models.Deployment, check models.HealthCheck) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			healthy, latency := h.probeApp(ctx, d, check)
+			err := h.db.RecordHealthProbe(ctx, models.HealthProbe{
+				Domain:       d.Domain,
+				AppName:      d.AppName,
+				DeploymentID: &d.ID,
+				Healthy:      healthy,
+				Agent:        controllerAgent,
+				CheckedAt:    h.clock.Now(),
+				LatencyMs:    latency,
+			})
+			if err != nil {
+				h.logger.Error("Failed to record health probe", "error", err, "domain", d.Domain, "app_name", d.AppName)
+			}
+
+			value := 0.0
+			if healthy {
+				value = 1
+			}
+			metrics.AppHealthy.WithLabelValues(d.Domain, d.AppName).Set(value)
+		}(d, check)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// probeApp runs an http or tcp health check against a deployment's domain,
+// returning the latency of http checks that were answered
+func (h *Handler) probeApp(ctx context.Context, d models.Deployment, check models.HealthCheck) (bool, *float64) {
+	cfg := h.cfg.Probes
+	if check.Type == models.HealthCheckTCP {
+		port := check.Port
+		if port == 0 {
+			port = d.Port
+		}
+		return h.probeTCP(ctx, net.JoinHostPort(d.Domain, strconv.Itoa(port)), cfg.Timeout), nil
+	}
+
+	path := check.Path
+	if path == "" {
+		path = cfg.HealthPath
+	}
+	return h.probeHealth(ctx, cfg.Scheme+"://"+d.Domain+healthURL(path, d), cfg.Timeout)
+}
+
+// addHealthAll sets the health of every deployment in a slice from its
+// app's latest health probe, reported by the prober or an agent
+func (h *Handler) addHealthAll(ctx context.Context, deployments []models.Deployment) {
+	probes, err := h.db.ListLatestHealthProbes(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list health probes", "error", err)
+		return
+	}
+
+	latest := make(map[string]models.HealthProbe, len(probes))
+	for _, p := range probes {
+		latest[p.Domain+"/"+p.AppName] = p
+	}
+
+	now := h.clock.Now()
+	for i := range deployments {
+		d := &deployments[i]
+		p, ok := latest[d.Domain+"/"+d.AppName]
+		if !ok {
+			continue
+		}
+		health := &models.AppHealth{Status: models.HealthUnhealthy, CheckedAt: p.CheckedAt, Agent: p.Agent}
+		switch {
+		case now.Sub(p.CheckedAt) > h.cfg.Probes.StaleAfter:
+			health.Status = models.HealthStale
+		case p.Healthy:
+			health.Status = models.HealthHealthy
+		}
+		d.Health = health
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the RFC 7807 media type for error bodies
+const ProblemContentType = "application/problem+json"
+
+// wantsProblemJSON reports whether the client's Accept header asks for problem+json
+func wantsProblemJSON(c *gin.Context) bool {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// RespondError writes an error response, negotiating between the standard
+// APIResponse envelope and an RFC 7807 problem+json body via the Accept header
+func RespondError(c *gin.Context, status int, message string) {
+	respondErrors(c, status, message, nil, nil)
+}
+
+// RespondErrorWithData writes an error response that also carries the
+// outcome of a partly failed operation, such as a report of the steps that
+// ran; problem+json bodies carry it as a data extension member
+func RespondErrorWithData(c *gin.Context, status int, message string, data interface{}) {
+	respondErrors(c, status, message, nil, data)
+}
+
+// RespondValidationError writes a 400 response listing field-level errors
+func RespondValidationError(c *gin.Context, message string, errs []models.FieldError) {
+	respondErrors(c, http.StatusBadRequest, message, errs, nil)
+}
+
+// respondErrors writes an error response with optional field-level errors
+// and data
+func respondErrors(c *gin.Context, status int, message string, errs []models.FieldError, data interface{}) {
+	if !wantsProblemJSON(c) {
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Error:   message,
+			Errors:  errs,
+			Data:    data,
+		})
+		return
+	}
+
+	problem := models.ProblemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   message,
+		Instance: c.Request.URL.RequestURI(),
+		Errors:   errs,
+		Data:     data,
+	}
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(status, ProblemContentType, body)
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// pushOptions controls how a push batch is applied
+type pushOptions struct {
+	// SkipUnchanged returns the app's current version instead of creating a
+	// new one when a request is identical to it (same image, port and env)
+	SkipUnchanged bool `json:"skip_unchanged,omitempty"`
+
+	// Atomic applies the whole batch in one transaction, rolling everything
+	// back if any item fails
+	Atomic bool `json:"atomic,omitempty"`
+
+	// Progress, when non-nil, is called before each item with the number of
+	// items processed so far
+	Progress func(processed int) `json:"-"`
+
+	// ReplayOf is the request a replayed batch was first pushed as
+	ReplayOf string `json:"replay_of,omitempty"`
+}
+
+// parsePushOptions reads push options from the query string, falling back to
+// the configured defaults
+func (h *Handler) parsePushOptions(c *gin.Context) (pushOptions, bool) {
+	opts := pushOptions{SkipUnchanged: h.cfg.Push.SkipUnchanged}
+
+	if value := c.Query("skip_unchanged"); value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "skip_unchanged must be true or false")
+			return opts, false
+		}
+		opts.SkipUnchanged = skip
+	}
+
+	if value := c.Query("atomic"); value != "" {
+		atomic, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "atomic must be true or false")
+			return opts, false
+		}
+		opts.Atomic = atomic
+	}
+
+	return opts, true
+}
+
+// Push handles POST /api/v1/push - receives deployment changes
+func (h *Handler) Push(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	var deploymentRequests models.DeploymentPushRequest
+	if err := h.bindJSON(c, &deploymentRequests); err != nil {
+		h.logger.Error("Invalid request body", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if len(deploymentRequests) == 0 {
+		h.logger.Error("Empty deployment request")
+		RespondError(c, http.StatusBadRequest, "At least one deployment is required")
+		return
+	}
+
+	if errs := h.validateDeploymentRequests(deploymentRequests); len(errs) > 0 {
+		h.logger.Warn("Deployment request failed validation", "errors", len(errs))
+		RespondValidationError(c, "Invalid deployment request", errs)
+		return
+	}
+
+	opts, ok := h.parsePushOptions(c)
+	if !ok {
+		return
+	}
+
+	// Replay the stored result when a client retries with the same key
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	completed := false
+	if idempotencyKey != "" {
+		fingerprint := map[string]interface{}{"deployments": deploymentRequests, "options": opts}
+		if h.replayIdempotent(ctx, c, idempotencyKey, fingerprint) {
+			return
+		}
+
+		// Released unless its response was stored, also when the push
+		// panics, so retries aren't turned away as still being processed
+		defer func() {
+			if !completed {
+				h.releaseIdempotent(ctx, idempotencyKey)
+			}
+		}()
+	}
+
+	var statusCode int
+	var response models.APIResponse
+	if c.Query("async") == "true" {
+		job, requestID, err := h.enqueuePush(ctx, deploymentRequests, opts)
+		if err != nil {
+			h.logger.Error("Failed to queue deployment push", "error", err)
+			RespondError(c, http.StatusInternalServerError, "Failed to queue deployment push")
+			return
+		}
+
+		c.Header("Location", jobsPath+"/"+job.ID.String())
+		statusCode, response = http.StatusAccepted, pushJobResponse(job, requestID)
+	} else {
+		// Generate a unique request ID for this batch
+		requestID := uuid.New().String()
+		h.logger.Info("Processing deployment push",
+			"request_id", requestID,
+			"count", len(deploymentRequests))
+
+		statusCode, response = h.processPush(ctx, deploymentRequests, requestID, opts)
+	}
+
+	if idempotencyKey != "" {
+		completed = h.completeIdempotent(ctx, idempotencyKey, statusCode, response)
+	}
+
+	c.JSON(statusCode, response)
+}
+
+// unchangedDeployment returns the app's latest deployment when it already
+// matches req, or nil when a new version is needed
+func (h *Handler) unchangedDeployment(ctx context.Context, req models.DeploymentRequest) (*models.Deployment, error) {
+	latest, err := h.db.GetLatestDeployment(ctx, req.Domain, req.AppName)
+	if err != nil {
+		if err.Error() == "deployment not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !latest.Matches(req) {
+		return nil, nil
+	}
+
+	latest.Unchanged = true
+	return latest, nil
+}
+
+// processPush creates a deployment for every request in the batch and
+// builds the push response
+func (h *Handler) processPush(ctx context.Context, deploymentRequests models.DeploymentPushRequest, requestID string, opts pushOptions) (int, models.APIResponse) {
+	if opts.Atomic {
+		return h.processPushAtomic(ctx, deploymentRequests, requestID, opts)
+	}
+
+	var createdDeployments []models.Deployment
+	var unchangedDeployments []models.Deployment
+	var failedDeployments []map[string]interface{}
+	var failed []int
+
+	// Process each deployment request
+	for i, req := range deploymentRequests {
+		if opts.Progress != nil {
+			opts.Progress(i)
+		}
+
+		var deployment *models.Deployment
+		var err error
+		if opts.SkipUnchanged {
+			deployment, err = h.unchangedDeployment(ctx, req)
+		}
+		if err == nil && deployment == nil {
+			deployment, err = h.db.CreateDeployment(ctx, req, requestID)
+		}
+
+		if err != nil {
+			h.logger.Error("Failed to create deployment",
+				"error", err,
+				"domain", req.Domain,
+				"app_name", req.AppName)
+
+			failedDeployments = append(failedDeployments, map[string]interface{}{
+				"index":    i,
+				"domain":   req.Domain,
+				"app_name": req.AppName,
+				"error":    err.Error(),
+			})
+			failed = append(failed, i)
+			continue
+		}
+
+		h.redactDeployment(nil, deployment)
+		addLinks(deployment)
+
+		if deployment.Unchanged {
+			unchangedDeployments = append(unchangedDeployments, *deployment)
+			h.logger.Info("Skipped unchanged deployment",
+				"deployment_id", deployment.ID,
+				"domain", deployment.Domain,
+				"app_name", deployment.AppName,
+				"version", deployment.Version)
+			continue
+		}
+
+		createdDeployments = append(createdDeployments, *deployment)
+		h.logger.Info("Created deployment",
+			"deployment_id", deployment.ID,
+			"domain", deployment.Domain,
+			"app_name", deployment.AppName,
+			"version", deployment.Version)
+	}
+
+	h.recordPushRequest(ctx, deploymentRequests, requestID, opts, failed)
+	return pushResponse(requestID, createdDeployments, unchangedDeployments, failedDeployments, opts)
+}
+
+// processPushAtomic creates the whole batch in one transaction; a failing
+// item rolls back every other item in the batch
+func (h *Handler) processPushAtomic(ctx context.Context, deploymentRequests models.DeploymentPushRequest, requestID string, opts pushOptions) (int, models.APIResponse) {
+	if opts.Progress != nil {
+		opts.Progress(0)
+	}
+
+	deployments, err := h.db.CreateDeploymentBatch(ctx, deploymentRequests, requestID, opts.SkipUnchanged)
+	if err != nil {
+		h.logger.Error("Atomic deployment push rolled back", "request_id", requestID, "error", err)
+
+		failed := map[string]interface{}{"error": err.Error()}
+		var itemErr *database.BatchItemError
+		if errors.As(err, &itemErr) {
+			req := deploymentRequests[itemErr.Index]
+			failed = map[string]interface{}{
+				"index":    itemErr.Index,
+				"domain":   req.Domain,
+				"app_name": req.AppName,
+				"error":    itemErr.Err.Error(),
+			}
+		}
+
+		// Nothing was applied, so every item counts as failed for replays
+		all := make([]int, len(deploymentRequests))
+		for i := range all {
+			all[i] = i
+		}
+		h.recordPushRequest(ctx, deploymentRequests, requestID, opts, all)
+		return pushResponse(requestID, nil, nil, []map[string]interface{}{failed}, opts)
+	}
+
+	h.recordPushRequest(ctx, deploymentRequests, requestID, opts, nil)
+
+	var createdDeployments []models.Deployment
+	var unchangedDeployments []models.Deployment
+	h.redactDeployments(nil, deployments)
+	for i := range deployments {
+		addLinks(&deployments[i])
+		if deployments[i].Unchanged {
+			unchangedDeployments = append(unchangedDeployments, deployments[i])
+		} else {
+			createdDeployments = append(createdDeployments, deployments[i])
+		}
+	}
+
+	h.logger.Info("Applied atomic deployment push",
+		"request_id", requestID,
+		"created", len(createdDeployments),
+		"unchanged", len(unchangedDeployments))
+
+	return pushResponse(requestID, createdDeployments, unchangedDeployments, nil, opts)
+}
+
+// recordPushRequest stores a processed push batch so it can be replayed. A
+// batch that can't be stored was still applied; only its replay is lost.
+func (h *Handler) recordPushRequest(ctx context.Context, deploymentRequests models.DeploymentPushRequest, requestID string, opts pushOptions, failed []int) {
+	options, err := json.Marshal(opts)
+	if err == nil {
+		err = h.db.RecordPushRequest(ctx, models.PushRequest{
+			RequestID:   requestID,
+			Deployments: deploymentRequests,
+			Options:     options,
+			Failed:      failed,
+			ReplayOf:    opts.ReplayOf,
+		})
+	}
+	if err != nil {
+		h.logger.Error("Failed to record push request", "error", err, "request_id", requestID)
+	}
+}
+
+// pushResponse builds the push response and status code from the outcome of
+// each item
+func pushResponse(requestID string, createdDeployments, unchangedDeployments []models.Deployment, failedDeployments []map[string]interface{}, opts pushOptions) (int, models.APIResponse) {
+	processed := len(createdDeployments) + len(unchangedDeployments)
+
+	// Prepare response
+	responseData := map[string]interface{}{
+		"request_id":          requestID,
+		"processed_count":     processed,
+		"failed_count":        len(failedDeployments),
+		"created_deployments": createdDeployments,
+	}
+
+	if opts.SkipUnchanged {
+		responseData["unchanged_count"] = len(unchangedDeployments)
+		responseData["unchanged_deployments"] = unchangedDeployments
+	}
+
+	if len(failedDeployments) > 0 {
+		responseData["failed_deployments"] = failedDeployments
+	}
+
+	if opts.Atomic {
+		responseData["rolled_back"] = len(failedDeployments) > 0
+	}
+
+	if opts.ReplayOf != "" {
+		responseData["replay_of"] = opts.ReplayOf
+	}
+
+	statusCode := http.StatusCreated
+	if len(failedDeployments) > 0 && processed == 0 {
+		statusCode = http.StatusBadRequest
+	} else if len(failedDeployments) > 0 {
+		statusCode = http.StatusPartialContent
+	} else if len(createdDeployments) == 0 {
+		statusCode = http.StatusOK
+	}
+
+	return statusCode, models.APIResponse{
+		Success: processed > 0,
+		Message: "Deployment push processed",
+		Data:    responseData,
+	}
+}
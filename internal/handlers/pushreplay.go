@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReplayPush handles POST /api/v1/requests/:request_id/replay - submits a
+// stored push batch again as a new request, with the options it was first
+// pushed with. With failed_only=true only the items that failed are
+// submitted, and async=true queues the replay like an async push.
+func (h *Handler) ReplayPush(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	failedOnly := false
+	if value := c.Query("failed_only"); value != "" {
+		var err error
+		if failedOnly, err = strconv.ParseBool(value); err != nil {
+			RespondError(c, http.StatusBadRequest, "failed_only must be true or false")
+			return
+		}
+	}
+
+	original, err := h.db.GetPushRequest(ctx, c.Param("request_id"))
+	if err != nil {
+		if err.Error() == "push request not found" {
+			RespondError(c, http.StatusNotFound, "Push request not found")
+			return
+		}
+		h.logger.Error("Failed to get push request", "error", err, "request_id", c.Param("request_id"))
+		RespondError(c, http.StatusInternalServerError, "Failed to get push request")
+		return
+	}
+
+	deploymentRequests := original.Deployments
+	if failedOnly {
+		deploymentRequests = nil
+		for _, i := range original.Failed {
+			if i >= 0 && i < len(original.Deployments) {
+				deploymentRequests = append(deploymentRequests, original.Deployments[i])
+			}
+		}
+		if len(deploymentRequests) == 0 {
+			RespondError(c, http.StatusConflict, "Push request has no failed items")
+			return
+		}
+	}
+
+	// The batch is checked again, since validation limits and keys may
+	// have changed since it was pushed
+	if errs := h.validateDeploymentRequests(deploymentRequests); len(errs) > 0 {
+		h.logger.Warn("Replayed push failed validation", "request_id", original.RequestID, "errors", len(errs))
+		RespondValidationError(c, "Invalid deployment request", errs)
+		return
+	}
+
+	var opts pushOptions
+	if err := json.Unmarshal(original.Options, &opts); err != nil {
+		h.logger.Error("Invalid push request options", "error", err, "request_id", original.RequestID)
+		RespondError(c, http.StatusInternalServerError, "Failed to get push request")
+		return
+	}
+	opts.ReplayOf = original.RequestID
+
+	if c.Query("async") == "true" {
+		job, requestID, err := h.enqueuePush(ctx, deploymentRequests, opts)
+		if err != nil {
+			h.logger.Error("Failed to queue deployment push", "error", err)
+			RespondError(c, http.StatusInternalServerError, "Failed to queue deployment push")
+			return
+		}
+
+		c.Header("Location", jobsPath+"/"+job.ID.String())
+		c.JSON(http.StatusAccepted, pushJobResponse(job, requestID))
+		return
+	}
+
+	requestID := uuid.New().String()
+	h.logger.Info("Replaying deployment push",
+		"request_id", requestID,
+		"replay_of", original.RequestID,
+		"failed_only", failedOnly,
+		"count", len(deploymentRequests),
+		"actor", c.GetString(ActorKey))
+
+	statusCode, response := h.processPush(ctx, deploymentRequests, requestID, opts)
+	c.JSON(statusCode, response)
+}
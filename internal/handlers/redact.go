@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RevealScopeKey is the gin context key set for callers allowed to see
+// sensitive env values unredacted
+const RevealScopeKey = "reveal_secrets"
+
+// redactDeployment masks sensitive env values unless the caller has the
+// reveal scope. A nil context always redacts, for responses that are stored
+// (idempotent replays, job results). Env is replaced rather than modified
+// since cached deployments share it.
+func (h *Handler) redactDeployment(c *gin.Context, d *models.Deployment) {
+	if c != nil && c.GetBool(RevealScopeKey) {
+		return
+	}
+	d.Env = h.redactor.Env(d.Env)
+}
+
+// redactDeployments masks sensitive env values in every deployment in a list
+func (h *Handler) redactDeployments(c *gin.Context, deployments []models.Deployment) {
+	for i := range deployments {
+		h.redactDeployment(c, &deployments[i])
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registryFromPath reads the :registry path param, responding on
+// validation errors
+func registryFromPath(c *gin.Context) (string, bool) {
+	registry := c.Param("registry")
+	if registry == "" || strings.ContainsAny(registry, " \t/") {
+		RespondValidationError(c, "Invalid registry", []models.FieldError{{Field: "registry", Message: "must be a registry host, e.g. ghcr.io or registry.example.com:5000"}})
+		return "", false
+	}
+	return registry, true
+}
+
+// registryReference looks up a registry without its password, returning
+// nil when no credentials are stored for it
+func (h *Handler) registryReference(ctx context.Context, registry string) (*models.RegistryReference, error) {
+	cred, err := h.db.GetRegistryCredential(ctx, registry)
+	if err != nil {
+		if err.Error() == "registry credential not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &models.RegistryReference{Registry: cred.Registry, Username: cred.Username}, nil
+}
+
+// ListRegistries handles GET /api/v1/registries - the registries with
+// stored credentials, without their passwords
+func (h *Handler) ListRegistries(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	registries, err := h.db.ListRegistries(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list registries", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list registries")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    registries,
+	})
+}
+
+// GetRegistry handles GET /api/v1/registries/:registry - a registry's
+// username, without the password
+func (h *Handler) GetRegistry(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	registry, ok := registryFromPath(c)
+	if !ok {
+		return
+	}
+
+	ref, err := h.registryReference(ctx, registry)
+	if err != nil {
+		h.logger.Error("Failed to get registry", "error", err, "registry", registry)
+		RespondError(c, http.StatusInternalServerError, "Failed to get registry")
+		return
+	}
+	if ref == nil {
+		RespondError(c, http.StatusNotFound, "Registry credential not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    ref,
+	})
+}
+
+// PutRegistry handles PUT /api/v1/registries/:registry - stores or
+// replaces a registry's credentials
+func (h *Handler) PutRegistry(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	registry, ok := registryFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.RegistryCredentialUpdate
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid registry credential request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	existing, err := h.registryReference(ctx, registry)
+	if err != nil {
+		h.logger.Error("Failed to get registry", "error", err, "registry", registry)
+		RespondError(c, http.StatusInternalServerError, "Failed to get registry")
+		return
+	}
+	if !checkUpsertPreconditions(c, existing != nil, "", "Registry credential") {
+		return
+	}
+
+	err = h.db.StoreRegistryCredential(ctx, models.RegistryCredentialRequest{
+		Registry: registry,
+		Username: req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store registry credential", "error", err, "registry", registry)
+		RespondError(c, http.StatusInternalServerError, "Failed to store registry credential")
+		return
+	}
+
+	status := http.StatusOK
+	if existing == nil {
+		status = http.StatusCreated
+	}
+
+	h.logger.Info("Stored registry credential", "registry", registry)
+	c.JSON(status, models.APIResponse{
+		Success: true,
+		Message: "Registry credential stored successfully",
+		Data:    models.RegistryReference{Registry: registry, Username: req.Username},
+	})
+}
+
+// DeleteRegistry handles DELETE /api/v1/registries/:registry
+func (h *Handler) DeleteRegistry(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	registry, ok := registryFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteRegistryCredential(ctx, registry); err != nil {
+		h.logger.Error("Failed to delete registry credential", "error", err, "registry", registry)
+
+		if err.Error() == "registry credential not found" {
+			RespondError(c, http.StatusNotFound, "Registry credential not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to delete registry credential")
+		return
+	}
+
+	h.logger.Info("Deleted registry credential", "registry", registry)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Registry credential deleted successfully",
+	})
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"deployment-controller/internal/jobs"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/registry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// dockerHubEvent is the payload of a Docker Hub push webhook
+type dockerHubEvent struct {
+	CallbackURL string `json:"callback_url"`
+	PushData    struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+// harborEvent is the payload of a Harbor webhook
+type harborEvent struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// distributionEnvelope is the payload of a registry notification in the
+// format of the CNCF distribution registry, which other OCI registries
+// emit as well
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Digest     string `json:"digest"`
+			Tag        string `json:"tag"`
+			URL        string `json:"url"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// Registry event actions
+const (
+	registryPush   = "push"
+	registryDelete = "delete"
+)
+
+// registryEvent is an image pushed to or deleted from a registry
+type registryEvent struct {
+	Action string
+	Image  registry.Image
+}
+
+// eventImage builds the image of a registry event from the registry host,
+// repository, and the tag and digest the event carries
+func eventImage(host, repository, tag, digest string) (registry.Image, error) {
+	img, err := registry.ParseImage(host + "/" + repository)
+	if err != nil {
+		return registry.Image{}, err
+	}
+	img.Tag = tag
+	img.Digest = digest
+	return img, nil
+}
+
+// followingPolicies returns the image policies of apps whose latest
+// deployment uses the repository of a pushed image
+func (h *Handler) followingPolicies(ctx context.Context, events []registryEvent) ([]models.ImagePolicy, error) {
+	pushed := make(map[string]bool)
+	for _, event := range events {
+		if event.Action == registryPush {
+			pushed[event.Image.Registry+"/"+event.Image.Repository] = true
+		}
+	}
+	if len(pushed) == 0 {
+		return nil, nil
+	}
+
+	policies, err := h.db.ListImagePolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var following []models.ImagePolicy
+	for _, policy := range policies {
+		latest, err := h.db.GetLatestDeployment(ctx, policy.Domain, policy.AppName)
+		if err != nil {
+			if err.Error() == "deployment not found" {
+				continue
+			}
+			return nil, err
+		}
+		current, err := registry.ParseImage(latest.DockerImage)
+		if err != nil {
+			continue
+		}
+		if pushed[current.Registry+"/"+current.Repository] {
+			following = append(following, policy)
+		}
+	}
+	return following, nil
+}
+
+// eventMatches reports whether a registry event concerns the image of a
+// deployment, by tag or by digest. deployedDigest is what a mutable tag
+// resolved to when the deployment was checked for digest drift.
+func eventMatches(event, deployed registry.Image, deployedDigest string) bool {
+	if event.Registry != deployed.Registry || event.Repository != deployed.Repository {
+		return false
+	}
+	if event.Digest != "" && (event.Digest == deployed.Digest || event.Digest == deployedDigest) {
+		return true
+	}
+	return event.Tag != "" && event.Tag == deployed.Tag && deployed.Digest == ""
+}
+
+// flagDeletedImages flags the latest deployments whose image a registry
+// reported deleted, and clears the flag of flagged deployments whose image
+// was pushed again. It returns the newly flagged deployments.
+func (h *Handler) flagDeletedImages(ctx context.Context, events []registryEvent) ([]uuid.UUID, error) {
+	latest, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := h.db.ListImageDigests(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	deployedDigests := make(map[uuid.UUID]string, len(digests))
+	for _, digest := range digests {
+		deployedDigests[digest.DeploymentID] = digest.DeployedDigest
+	}
+
+	var flagged []uuid.UUID
+	now := h.clock.Now()
+	for _, deployment := range latest {
+		deployed, err := registry.ParseImage(deployment.DockerImage)
+		if err != nil {
+			continue
+		}
+		for _, event := range events {
+			if !eventMatches(event.Image, deployed, deployedDigests[deployment.ID]) {
+				continue
+			}
+			switch {
+			case event.Action == registryDelete && deployment.ImageDeletedAt == nil:
+				if err := h.db.SetDeploymentImageDeleted(ctx, deployment.ID, &now); err != nil {
+					return flagged, err
+				}
+				deployment.ImageDeletedAt = &now
+				flagged = append(flagged, deployment.ID)
+				h.logger.Warn("Deployed image was deleted from its registry",
+					"deployment_id", deployment.ID,
+					"domain", deployment.Domain,
+					"app_name", deployment.AppName,
+					"image", deployment.DockerImage)
+			case event.Action == registryPush && deployment.ImageDeletedAt != nil:
+				if err := h.db.SetDeploymentImageDeleted(ctx, deployment.ID, nil); err != nil {
+					return flagged, err
+				}
+				deployment.ImageDeletedAt = nil
+				h.logger.Info("Deleted image was pushed again",
+					"deployment_id", deployment.ID,
+					"image", deployment.DockerImage)
+			}
+		}
+	}
+	return flagged, nil
+}
+
+// applyPushedImage checks the given image policies after a push, under the
+// image update lock so it never races the periodic worker, and returns the
+// first failure. When a periodic run holds the lock, that run or the next
+// one picks the push up.
+func (h *Handler) applyPushedImage(ctx context.Context, policies []models.ImagePolicy) error {
+	var firstErr error
+	ran, err := h.db.WithLock(ctx, imageUpdatesLock, func(ctx context.Context) error {
+		for _, policy := range policies {
+			if err := h.applyImagePolicy(ctx, policy); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%s/%s: %w", policy.Domain, policy.AppName, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ran {
+		h.logger.Info("Left pushed image to the running image update pass", "apps", len(policies))
+	}
+	return firstErr
+}
+
+// imageUpdateJobPayload is the payload stored for image update jobs
+type imageUpdateJobPayload struct {
+	Source      string               `json:"source"`
+	Policies    []models.ImagePolicy `json:"policies"`
+	CallbackURL string               `json:"callback_url,omitempty"`
+}
+
+// enqueueImageUpdate queues a job checking the given image policies and
+// reporting the outcome to callbackURL when set
+func (h *Handler) enqueueImageUpdate(ctx context.Context, source string, policies []models.ImagePolicy, callbackURL string) (*models.Job, error) {
+	payload, err := json.Marshal(imageUpdateJobPayload{Source: source, Policies: policies, CallbackURL: callbackURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image update job: %w", err)
+	}
+	return h.db.EnqueueJob(ctx, models.JobTypeImageUpdate, models.PriorityNormal, payload, len(policies))
+}
+
+// RunImageUpdateJob is the worker pool handler for the image policy checks
+// queued by registry webhooks. A Docker Hub callback is told the outcome
+// once: when the checks succeed or on the job's last attempt.
+func (h *Handler) RunImageUpdateJob(ctx context.Context, job *models.Job, progress jobs.ProgressFunc) (interface{}, error) {
+	var payload imageUpdateJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid image update job payload: %w", err)
+	}
+
+	var applyErr error
+	if len(payload.Policies) > 0 {
+		applyErr = h.applyPushedImage(ctx, payload.Policies)
+	}
+	if payload.CallbackURL != "" && (applyErr == nil || job.Attempts >= h.cfg.Jobs.MaxAttempts) {
+		h.reportDockerHub(ctx, payload.CallbackURL, applyErr)
+	}
+
+	return models.RegistryWebhookResult{Checking: policyIDs(payload.Policies)}, applyErr
+}
+
+// policyIDs returns the app IDs of image policies
+func policyIDs(policies []models.ImagePolicy) []string {
+	ids := make([]string, len(policies))
+	for i, policy := range policies {
+		ids[i] = policy.Domain + "/" + policy.AppName
+	}
+	return ids
+}
+
+// verifyRegistryWebhook checks a registry webhook's token, responding when
+// webhooks are disabled or the token is wrong
+func (h *Handler) verifyRegistryWebhook(c *gin.Context, token string) bool {
+	secret := h.cfg.Registry.WebhookSecret
+	if secret == "" {
+		RespondError(c, http.StatusNotFound, "Registry webhooks are not configured")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		h.logger.Warn("Rejected registry webhook with an invalid token", "path", c.Request.URL.Path, "ip", c.ClientIP())
+		RespondError(c, http.StatusUnauthorized, "Invalid webhook token")
+		return false
+	}
+	return true
+}
+
+// dockerHubCallback validates the callback URL of a Docker Hub webhook, so
+// the controller only ever posts results back to Docker Hub
+func dockerHubCallback(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || (u.Hostname() != "docker.com" && !strings.HasSuffix(u.Hostname(), ".docker.com")) {
+		return "", errors.New("callback_url must be an https URL on docker.com")
+	}
+	return u.String(), nil
+}
+
+// reportDockerHub posts the outcome of a push to its Docker Hub callback
+// URL, which marks the webhook delivery, and any chained webhooks, as
+// succeeded or failed
+func (h *Handler) reportDockerHub(ctx context.Context, callbackURL string, applyErr error) {
+	result := map[string]string{
+		"state":       "success",
+		"description": "Image policies checked",
+		"context":     "deployment-controller",
+	}
+	if applyErr != nil {
+		result["state"] = "failure"
+		result["description"] = applyErr.Error()
+	}
+	body, _ := json.Marshal(result)
+
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Registry.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		h.logger.Error("Failed to build Docker Hub callback", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.logger.Warn("Docker Hub callback failed", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		h.logger.Warn("Docker Hub callback was rejected", "status", resp.StatusCode)
+	}
+}
+
+// DockerHubWebhook handles POST /api/v1/webhooks/dockerhub?token=... - a
+// Docker Hub push webhook that checks, in the background, the image
+// policies of the apps using the pushed repository. Docker Hub does not
+// sign webhooks, so the URL carries registry.webhook_secret as its token.
+func (h *Handler) DockerHubWebhook(c *gin.Context) {
+	if !h.verifyRegistryWebhook(c, c.Query("token")) {
+		return
+	}
+
+	var event dockerHubEvent
+	if err := json.NewDecoder(c.Request.Body).Decode(&event); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+	if event.Repository.RepoName == "" || event.PushData.Tag == "" {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: repository.repo_name and push_data.tag are required")
+		return
+	}
+	callbackURL, err := dockerHubCallback(event.CallbackURL)
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+
+	img, err := eventImage("docker.io", event.Repository.RepoName, event.PushData.Tag, "")
+	if err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+
+	h.handleRegistryEvents(c, "dockerhub", []registryEvent{{Action: registryPush, Image: img}}, callbackURL)
+}
+
+// HarborWebhook handles POST /api/v1/webhooks/harbor - artifact push and
+// delete events of a Harbor webhook policy, whose auth header must be
+// registry.webhook_secret
+func (h *Handler) HarborWebhook(c *gin.Context) {
+	if !h.verifyRegistryWebhook(c, bearerToken(c)) {
+		return
+	}
+
+	var payload harborEvent
+	if err := json.NewDecoder(c.Request.Body).Decode(&payload); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+
+	var action string
+	switch payload.Type {
+	case "PUSH_ARTIFACT":
+		action = registryPush
+	case "DELETE_ARTIFACT":
+		action = registryDelete
+	default:
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Ignored Harbor event " + payload.Type,
+		})
+		return
+	}
+
+	var events []registryEvent
+	for _, resource := range payload.EventData.Resources {
+		host, _, _ := strings.Cut(resource.ResourceURL, "/")
+		img, err := eventImage(host, payload.EventData.Repository.RepoFullName, resource.Tag, resource.Digest)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+			return
+		}
+		events = append(events, registryEvent{Action: action, Image: img})
+	}
+
+	h.handleRegistryEvents(c, "harbor", events, "")
+}
+
+// RegistryWebhook handles POST /api/v1/webhooks/registry - push and delete
+// notifications in the CNCF distribution format, sent with
+// registry.webhook_secret as the Authorization header. Pushes of layers
+// and untagged manifests are skipped.
+func (h *Handler) RegistryWebhook(c *gin.Context) {
+	if !h.verifyRegistryWebhook(c, bearerToken(c)) {
+		return
+	}
+
+	var envelope distributionEnvelope
+	if err := json.NewDecoder(c.Request.Body).Decode(&envelope); err != nil {
+		RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+		return
+	}
+
+	var events []registryEvent
+	for _, event := range envelope.Events {
+		target := event.Target
+		switch {
+		case event.Action == registryPush && target.Tag != "":
+		case event.Action == registryDelete && (target.Tag != "" || target.Digest != ""):
+		default:
+			continue
+		}
+
+		host := event.Request.Host
+		if host == "" {
+			if u, err := url.Parse(target.URL); err == nil {
+				host = u.Host
+			}
+		}
+		img, err := eventImage(host, target.Repository, target.Tag, target.Digest)
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "Invalid webhook payload: "+err.Error())
+			return
+		}
+		events = append(events, registryEvent{Action: event.Action, Image: img})
+	}
+
+	h.handleRegistryEvents(c, "registry", events, "")
+}
+
+// bearerToken returns the Authorization header, without a Bearer prefix
+func bearerToken(c *gin.Context) string {
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// handleRegistryEvents flags deployments of deleted images, if enabled,
+// and queues a job checking the image policies following pushed images,
+// which reports its outcome to callbackURL when set
+func (h *Handler) handleRegistryEvents(c *gin.Context, source string, events []registryEvent, callbackURL string) {
+	ctx := c.Request.Context()
+
+	result := models.RegistryWebhookResult{Checking: []string{}}
+	if h.cfg.Registry.FlagDeletedImages {
+		flagged, err := h.flagDeletedImages(ctx, events)
+		if err != nil {
+			h.logger.Error("Failed to flag deleted images", "error", err, "source", source)
+			RespondError(c, http.StatusInternalServerError, "Failed to flag deleted images")
+			return
+		}
+		result.Flagged = flagged
+	}
+
+	policies, err := h.followingPolicies(ctx, events)
+	if err != nil {
+		h.logger.Error("Failed to match pushed images", "error", err, "source", source)
+		RespondError(c, http.StatusInternalServerError, "Failed to match pushed images")
+		return
+	}
+	result.Checking = policyIDs(policies)
+
+	h.logger.Info("Received registry events",
+		"source", source,
+		"events", len(events),
+		"apps", len(policies),
+		"flagged", len(result.Flagged))
+
+	if len(policies) > 0 || callbackURL != "" {
+		job, err := h.enqueueImageUpdate(ctx, source, policies, callbackURL)
+		if err != nil {
+			h.logger.Error("Failed to queue image policy checks", "error", err, "source", source)
+			RespondError(c, http.StatusInternalServerError, "Failed to queue image policy checks")
+			return
+		}
+		result.JobID = &job.ID
+	}
+
+	if len(policies) == 0 {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "No image policy follows the pushed images",
+			Data:    result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Image policies are being checked",
+		Data:    result,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replayTimeout bounds a whole replay; each delivery is also bounded by
+// webhookTimeout
+const replayTimeout = 60 * time.Second
+
+// ReplayDeploymentEvents handles POST /api/v1/deployments/:id/events/replay
+// - posts the deployment's events, oldest first, to a given webhook so a
+// downstream system can catch up after an outage on its side. Delivery stops
+// at the first failure, reporting where to resume from.
+func (h *Handler) ReplayDeploymentEvents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), replayTimeout)
+	defer cancel()
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to replay deployment events")
+	if !ok {
+		return
+	}
+
+	var req models.EventReplayRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid event replay request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := validation.ValidateWebhookURL(req.URL); err != nil {
+		RespondValidationError(c, "Invalid event replay", []models.FieldError{{Field: "url", Message: err.Error()}})
+		return
+	}
+
+	events, err := h.db.ListDeploymentEvents(ctx, deployment.ID)
+	if err != nil {
+		h.logger.Error("Failed to list deployment events", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to replay deployment events")
+		return
+	}
+
+	replay := models.EventReplay{DeploymentID: deployment.ID, URL: req.URL}
+	for _, event := range events {
+		if req.Since != nil && event.CreatedAt.Before(*req.Since) {
+			continue
+		}
+		replay.Total++
+		if replay.Error != "" {
+			continue
+		}
+
+		err := postWebhook(ctx, req.URL, models.EventReplayNotification{
+			Event:        "deployment_event",
+			Replayed:     true,
+			EventID:      event.ID,
+			DeploymentID: deployment.ID,
+			Domain:       deployment.Domain,
+			AppName:      deployment.AppName,
+			Version:      deployment.Version,
+			Type:         event.Type,
+			Message:      event.Message,
+			Attempt:      event.Attempt,
+			At:           event.CreatedAt,
+		})
+		if err != nil {
+			at := event.CreatedAt
+			replay.Error = err.Error()
+			replay.ResumeSince = &at
+			continue
+		}
+		replay.Delivered++
+	}
+
+	h.logger.Info("Replayed deployment events",
+		"id", deployment.ID,
+		"url", req.URL,
+		"delivered", replay.Delivered,
+		"total", replay.Total,
+		"error", replay.Error,
+		"actor", c.GetString(ActorKey))
+
+	if replay.Error != "" {
+		RespondErrorWithData(c, http.StatusBadGateway,
+			fmt.Sprintf("Event replay failed after %d of %d events: %s", replay.Delivered, replay.Total, replay.Error), replay)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Replayed %d deployment events", replay.Delivered),
+		Data:    replay,
+	})
+}
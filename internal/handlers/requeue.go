@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRequeueLimit = 100
+	maxRequeueLimit     = 1000
+)
+
+// requeueStatuses are the statuses a requeue may reset to pending
+var requeueStatuses = map[string]bool{"deploying": true, "failed": true, "stalled": true}
+
+// RequeueDeployments handles POST /api/v1/admin/deployments/requeue - resets
+// deployments stuck in a status (deploying by default) for longer than
+// older_than back to pending, so agents deploy them again after the agent
+// host rolling them out died. Narrow it with domain and limit, and preview
+// it with dry_run=true.
+func (h *Handler) RequeueDeployments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var errs []models.FieldError
+	status := c.DefaultQuery("status", "deploying")
+	if !requeueStatuses[status] {
+		errs = append(errs, models.FieldError{Field: "status", Message: "must be deploying, failed or stalled"})
+	}
+	olderThan, err := parseWindow(c.Query("older_than"))
+	if err != nil {
+		errs = append(errs, models.FieldError{Field: "older_than", Message: "is required and must be a duration such as 30m, or a number of days (1d)"})
+	}
+	limit := defaultRequeueLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRequeueLimit {
+			errs = append(errs, models.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", maxRequeueLimit)})
+		} else {
+			limit = n
+		}
+	}
+	dryRun := c.Query("dry_run") == "true"
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid requeue", errs)
+		return
+	}
+
+	actor := c.GetString(ActorKey)
+	deployments, err := h.db.RequeueDeployments(ctx, status, h.clock.Now().Add(-olderThan), c.Query("domain"), limit, dryRun, actor)
+	if err != nil {
+		h.logger.Error("Failed to requeue deployments", "error", err, "status", status)
+		RespondError(c, http.StatusInternalServerError, "Failed to requeue deployments")
+		return
+	}
+
+	result := models.RequeueResult{
+		DryRun:      dryRun,
+		Status:      status,
+		OlderThan:   formatWindow(olderThan),
+		Deployments: deployments,
+	}
+	for _, d := range deployments {
+		if d.Skipped != "" {
+			result.Skipped++
+		} else {
+			result.Requeued++
+		}
+	}
+
+	h.logger.Info("Requeued stuck deployments",
+		"status", status,
+		"older_than", result.OlderThan,
+		"domain", c.Query("domain"),
+		"requeued", result.Requeued,
+		"skipped", result.Skipped,
+		"dry_run", dryRun,
+		"actor", actor)
+
+	message := fmt.Sprintf("Requeued %d deployments", result.Requeued)
+	if dryRun {
+		message = fmt.Sprintf("Requeue dry run: %d deployments would be requeued", result.Requeued)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pruneRetention deletes the deployment logs, events, versions and push
+// requests past the retention config as of now, or with dryRun only counts them. Logs and
+// versions are moved to the blob store instead when one is configured.
+func (h *Handler) pruneRetention(ctx context.Context, now time.Time, dryRun bool) (*models.RetentionReport, error) {
+	cfg := h.cfg.Retention
+	report := &models.RetentionReport{DryRun: dryRun, RanAt: now}
+
+	// With a blob store, logs and versions are archived there before they
+	// leave Postgres
+	archive := h.blobs != nil && !dryRun
+
+	var err error
+	if cfg.Logs > 0 {
+		if archive {
+			report.Logs, err = h.archiveExpiredLogs(ctx, now.Add(-cfg.Logs))
+		} else {
+			report.Logs, err = h.db.PruneDeploymentLogs(ctx, now.Add(-cfg.Logs), dryRun)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Events > 0 {
+		if report.Events, err = h.db.PruneDeploymentEvents(ctx, now.Add(-cfg.Events), dryRun); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.VersionsPerApp > 0 {
+		if archive {
+			report.Versions, err = h.archivePrunableVersions(ctx, cfg.VersionsPerApp)
+		} else {
+			report.Versions, err = h.db.PruneDeploymentVersions(ctx, cfg.VersionsPerApp, dryRun)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Requests > 0 {
+		if report.Requests, err = h.db.PrunePushRequests(ctx, now.Add(-cfg.Requests), dryRun); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// RunRetention prunes the deployment data past the retention config, or only
+// reports it with retention.dry_run; it is run periodically by the retention
+// worker
+func (h *Handler) RunRetention(ctx context.Context) error {
+	dryRun := h.cfg.Retention.DryRun
+	report, err := h.pruneRetention(ctx, h.clock.Now(), dryRun)
+	if err != nil {
+		return err
+	}
+
+	for kind, n := range map[string]int64{"logs": report.Logs, "events": report.Events, "versions": report.Versions, "requests": report.Requests} {
+		metrics.RetentionPrunable.WithLabelValues(kind).Set(float64(n))
+		if !dryRun {
+			metrics.RetentionPruned.WithLabelValues(kind).Add(float64(n))
+		}
+	}
+
+	switch {
+	case dryRun:
+		h.logger.Info("Retention dry run",
+			"logs", report.Logs,
+			"events", report.Events,
+			"versions", report.Versions,
+			"requests", report.Requests)
+	case report.Logs+report.Events+report.Versions+report.Requests > 0:
+		h.logger.Info("Pruned deployment data",
+			"logs", report.Logs,
+			"events", report.Events,
+			"versions", report.Versions,
+			"requests", report.Requests)
+	}
+	return nil
+}
+
+// GetRetention handles GET /api/v1/admin/retention - the retention policy
+// with a dry run of it, counting what the next run would prune
+func (h *Handler) GetRetention(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	preview, err := h.pruneRetention(ctx, h.clock.Now(), true)
+	if err != nil {
+		h.logger.Error("Failed to preview retention", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to preview retention")
+		return
+	}
+
+	cfg := h.cfg.Retention
+	policy := models.RetentionPolicy{
+		VersionsPerApp: cfg.VersionsPerApp,
+		Interval:       formatWindow(cfg.Interval),
+		DryRun:         cfg.DryRun,
+	}
+	if cfg.Logs > 0 {
+		policy.Logs = formatWindow(cfg.Logs)
+	}
+	if cfg.Events > 0 {
+		policy.Events = formatWindow(cfg.Events)
+	}
+	if cfg.Requests > 0 {
+		policy.Requests = formatWindow(cfg.Requests)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    models.RetentionStatus{Policy: policy, Preview: *preview},
+	})
+}
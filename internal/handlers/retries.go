@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Retry policy defaults and limits
+const (
+	defaultInitialBackoffSeconds = 30
+	defaultMaxBackoffSeconds     = 3600
+	maxRetryAttempts             = 20
+)
+
+// validateRetryPolicy applies defaults to a retry policy request and checks it
+func validateRetryPolicy(req *models.RetryPolicyRequest) []models.FieldError {
+	if req.InitialBackoffSeconds == 0 {
+		req.InitialBackoffSeconds = defaultInitialBackoffSeconds
+	}
+	if req.MaxBackoffSeconds == 0 {
+		req.MaxBackoffSeconds = max(defaultMaxBackoffSeconds, req.InitialBackoffSeconds)
+	}
+	if req.RetryOn == nil {
+		req.RetryOn = []string{}
+	}
+
+	var errs []models.FieldError
+	if req.MaxAttempts < 1 || req.MaxAttempts > maxRetryAttempts {
+		errs = append(errs, models.FieldError{Field: "max_attempts", Message: "must be between 1 and 20"})
+	}
+	if req.InitialBackoffSeconds < 1 {
+		errs = append(errs, models.FieldError{Field: "initial_backoff_seconds", Message: "must be positive"})
+	}
+	if req.MaxBackoffSeconds < req.InitialBackoffSeconds {
+		errs = append(errs, models.FieldError{Field: "max_backoff_seconds", Message: "must not be less than initial_backoff_seconds"})
+	}
+	if req.Jitter < 0 || req.Jitter > 1 {
+		errs = append(errs, models.FieldError{Field: "jitter", Message: "must be between 0 and 1"})
+	}
+	for i, code := range req.RetryOn {
+		if err := validation.ValidateErrorCode(code); err != nil {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("retry_on[%d]", i), Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// respondRetryPolicyError maps a retry policy lookup error to a response
+func (h *Handler) respondRetryPolicyError(c *gin.Context, err error, message string) {
+	if err.Error() == "retry policy not found" {
+		RespondError(c, http.StatusNotFound, "Retry policy not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// RunRetries resets failed deployments whose retry is due; it is run
+// periodically by the scheduler worker
+func (h *Handler) RunRetries(ctx context.Context) error {
+	retried, err := h.db.RunDueRetries(ctx)
+	if err != nil {
+		return err
+	}
+
+	if retried > 0 {
+		h.logger.Info("Retried failed deployments", "count", retried)
+	}
+	return nil
+}
+
+// PutRetryPolicy handles PUT /api/v1/retry-policies/:domain/:app_name
+func (h *Handler) PutRetryPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid retry policy")
+	if !ok {
+		return
+	}
+
+	var req models.RetryPolicyRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid retry policy request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if errs := validateRetryPolicy(&req); len(errs) > 0 {
+		RespondValidationError(c, "Invalid retry policy", errs)
+		return
+	}
+
+	policy, err := h.db.UpsertRetryPolicy(ctx, models.RetryPolicy{
+		Domain:                domain,
+		AppName:               appName,
+		MaxAttempts:           req.MaxAttempts,
+		InitialBackoffSeconds: req.InitialBackoffSeconds,
+		MaxBackoffSeconds:     req.MaxBackoffSeconds,
+		Jitter:                req.Jitter,
+		RetryOn:               req.RetryOn,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store retry policy", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store retry policy")
+		return
+	}
+
+	h.logger.Info("Stored retry policy",
+		"domain", domain,
+		"app_name", appName,
+		"max_attempts", policy.MaxAttempts)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retry policy stored successfully",
+		Data:    policy,
+	})
+}
+
+// GetRetryPolicy handles GET /api/v1/retry-policies/:domain/:app_name
+func (h *Handler) GetRetryPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid retry policy")
+	if !ok {
+		return
+	}
+
+	policy, err := h.db.GetRetryPolicy(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get retry policy", "error", err, "domain", domain, "app_name", appName)
+		h.respondRetryPolicyError(c, err, "Failed to get retry policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    policy,
+	})
+}
+
+// DeleteRetryPolicy handles DELETE /api/v1/retry-policies/:domain/:app_name
+func (h *Handler) DeleteRetryPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid retry policy")
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteRetryPolicy(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete retry policy", "error", err, "domain", domain, "app_name", appName)
+		h.respondRetryPolicyError(c, err, "Failed to delete retry policy")
+		return
+	}
+
+	h.logger.Info("Deleted retry policy", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retry policy deleted successfully",
+	})
+}
+
+// GetDeploymentEvents handles GET /api/v1/deployments/:id/events - the
+// deployment's timeline of status changes and retries
+func (h *Handler) GetDeploymentEvents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	if _, err := h.db.GetDeployment(ctx, id); err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment events")
+		return
+	}
+
+	events, err := h.db.ListDeploymentEvents(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to list deployment events", "error", err, "id", id)
+		RespondError(c, http.StatusInternalServerError, "Failed to get deployment events")
+		return
+	}
+
+	if wantsCSV(c) {
+		if err := writeDeploymentEventsCSV(c, "deployment-"+id.String()+"-events.csv", events); err != nil {
+			h.logger.Error("Failed to write deployment events CSV", "error", err, "id", id)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    events,
+	})
+}
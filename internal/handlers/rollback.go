@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// rollbackHistoryLimit bounds how many earlier versions are searched for
+// one to roll back to
+const rollbackHistoryLimit = 50
+
+// manualRollback is the trigger of rollbacks requested through the API,
+// which aren't counted as automatic
+const manualRollback = "manual"
+
+var (
+	// errRollbackSuperseded is returned when rolling back a version that is
+	// no longer its app's latest
+	errRollbackSuperseded = errors.New("superseded")
+
+	// errNoRollbackTarget is returned when the app has no earlier deployed
+	// version
+	errNoRollbackTarget = errors.New("no earlier deployed version to roll back to")
+)
+
+// RollbackDeployment handles POST /api/v1/deployments/:id/rollback - rolls
+// an app's latest version back, restoring its previous deployed version as
+// a new version. ?reason= is recorded on both versions' timelines.
+func (h *Handler) RollbackDeployment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Error("Invalid deployment ID", "error", err, "id", idStr)
+		RespondError(c, http.StatusBadRequest, "Invalid deployment ID")
+		return
+	}
+
+	d, err := h.db.GetDeployment(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to get deployment", "error", err, "id", id)
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to roll back deployment")
+		return
+	}
+
+	reason := c.Query("reason")
+	if reason == "" {
+		actor := c.GetString(ActorKey)
+		if actor == "" {
+			actor = "anonymous"
+		}
+		reason = "requested by " + actor
+	}
+
+	restored, err := h.rollBack(ctx, *d, manualRollback, reason)
+	if err != nil {
+		h.logger.Error("Failed to roll back deployment", "error", err, "id", id)
+		if errors.Is(err, errRollbackSuperseded) || errors.Is(err, errNoRollbackTarget) {
+			RespondError(c, http.StatusConflict, "Cannot roll back: "+err.Error())
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to roll back deployment")
+		return
+	}
+
+	c.Header("ETag", restored.ETag())
+	h.redactDeployment(c, restored)
+	addLinks(restored)
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Rolled back version %d", d.Version),
+		Data:    restored,
+	})
+}
+
+// rollBack marks a deployment rolled back and restores the app's previous
+// deployed version as a new version, recording the reason on both. The
+// trigger, such as smoke_test, labels the rollback metric unless it is
+// manualRollback. Deployments that are no longer their app's latest version
+// are left alone.
+func (h *Handler) rollBack(ctx context.Context, d models.Deployment, trigger, reason string) (*models.Deployment, error) {
+	latest, err := h.db.GetLatestDeployment(ctx, d.Domain, d.AppName)
+	if err != nil {
+		return nil, err
+	}
+	if latest.ID != d.ID {
+		return nil, fmt.Errorf("%w: version %d was superseded by version %d", errRollbackSuperseded, d.Version, latest.Version)
+	}
+
+	history, err := h.db.GetDeploymentHistory(ctx, d.Domain, d.AppName, models.DateRange{}, nil, nil, rollbackHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	var previous *models.Deployment
+	for i := range history {
+		if history[i].Version < d.Version && history[i].Status == "deployed" {
+			previous = &history[i]
+			break
+		}
+	}
+	if previous == nil {
+		return nil, errNoRollbackTarget
+	}
+
+	if _, err := h.db.UpdateDeploymentStatus(ctx, d.ID, "rolled_back", nil, d.DeployedAt, nil); err != nil {
+		return nil, err
+	}
+
+	// The previous version was normalized when it was pushed, so it is
+	// restored as is rather than revalidated
+	req := models.DeploymentRequest{
+		Domain:      previous.Domain,
+		AppName:     previous.AppName,
+		DockerImage: previous.DockerImage,
+		Port:        previous.Port,
+		Env:         previous.Env,
+		Priority:    previous.Priority,
+		Metadata:    previous.Metadata,
+		BuildInfo:   previous.BuildInfo,
+	}
+	restored, err := h.db.CreateDeployment(ctx, req, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("rolled back to version %d, restored as version %d: %s", previous.Version, restored.Version, reason)
+	if err := h.db.AddDeploymentEvent(ctx, d.ID, models.EventRolledBack, message); err != nil {
+		h.logger.Error("Failed to record rollback", "error", err, "deployment_id", d.ID)
+	}
+	message = fmt.Sprintf("restores version %d after rolling back version %d: %s", previous.Version, d.Version, reason)
+	if err := h.db.AddDeploymentEvent(ctx, restored.ID, models.EventRollback, message); err != nil {
+		h.logger.Error("Failed to record rollback", "error", err, "deployment_id", restored.ID)
+	}
+
+	if trigger != manualRollback {
+		metrics.AutoRollbacks.WithLabelValues(trigger).Inc()
+	}
+	h.logger.Warn("Rolled back deployment",
+		"domain", d.Domain,
+		"app_name", d.AppName,
+		"deployment_id", d.ID,
+		"version", d.Version,
+		"restored_version", previous.Version,
+		"rollback_id", restored.ID,
+		"reason", reason)
+	return restored, nil
+}
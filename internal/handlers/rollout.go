@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxClaimLimit caps how many deployments one claim may start
+const maxClaimLimit = 100
+
+// ListPendingDeployments handles GET /api/v1/agent/pending - the pending
+// deployments agents may start now under the rollout limits, oldest first
+func (h *Handler) ListPendingDeployments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain := c.Query("domain")
+	if domain != "" {
+		normalized, err := validation.NormalizeDomain(domain)
+		if err != nil {
+			RespondValidationError(c, "Invalid pending query", []models.FieldError{{Field: "domain", Message: err.Error()}})
+			return
+		}
+		domain = normalized
+	}
+
+	deployments, err := h.db.ListPendingDeployments(ctx, domain, h.cfg.Rollout.MaxDeployingPerDomain)
+	if err != nil {
+		h.logger.Error("Failed to list pending deployments", "error", err, "domain", domain)
+		RespondError(c, http.StatusInternalServerError, "Failed to list pending deployments")
+		return
+	}
+
+	h.redactDeployments(c, deployments)
+	addLinksAll(deployments)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    deployments,
+	})
+}
+
+// ClaimDeployments handles POST /api/v1/agent/claim - moves pending
+// deployments to deploying, within the rollout limits, for the calling agent
+func (h *Handler) ClaimDeployments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var req models.ClaimRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid claim request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var errs []models.FieldError
+	if req.Domain != "" {
+		normalized, err := validation.NormalizeDomain(req.Domain)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "domain", Message: err.Error()})
+		}
+		req.Domain = normalized
+	}
+	if req.Limit == 0 {
+		req.Limit = 1
+	}
+	if req.Limit < 1 || req.Limit > maxClaimLimit {
+		errs = append(errs, models.FieldError{Field: "limit", Message: "must be between 1 and 100"})
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid claim", errs)
+		return
+	}
+
+	deployments, err := h.db.ClaimDeployments(ctx, req.Domain, req.Limit, h.cfg.Rollout.MaxDeployingPerDomain)
+	if err != nil {
+		h.logger.Error("Failed to claim deployments", "error", err, "domain", req.Domain)
+		RespondError(c, http.StatusInternalServerError, "Failed to claim deployments")
+		return
+	}
+
+	for _, d := range deployments {
+		h.logger.Info("Claimed deployment",
+			"id", d.ID,
+			"domain", d.Domain,
+			"app_name", d.AppName,
+			"version", d.Version,
+			"actor", c.GetString(ActorKey))
+	}
+
+	h.redactDeployments(c, deployments)
+	addLinksAll(deployments)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    deployments,
+	})
+}
+
+// rolloutLimitFromPath reads the :domain and optional :app_name path params
+// of a rollout limit route, responding on validation errors
+func rolloutLimitFromPath(c *gin.Context) (domain, appName string, ok bool) {
+	if c.Param("app_name") != "" {
+		return appFromPath(c, "Invalid rollout limit")
+	}
+
+	domain, err := validation.NormalizeDomain(c.Param("domain"))
+	if err != nil {
+		RespondValidationError(c, "Invalid rollout limit", []models.FieldError{{Field: "domain", Message: err.Error()}})
+		return "", "", false
+	}
+	return domain, "", true
+}
+
+// ListRolloutLimits handles GET /api/v1/rollout-limits
+func (h *Handler) ListRolloutLimits(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	limits, err := h.db.ListRolloutLimits(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list rollout limits", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list rollout limits")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    limits,
+	})
+}
+
+// PutRolloutLimit handles PUT /api/v1/rollout-limits/:domain and
+// PUT /api/v1/rollout-limits/:domain/:app_name
+func (h *Handler) PutRolloutLimit(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := rolloutLimitFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.RolloutLimitRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid rollout limit request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if req.MaxDeploying < 1 {
+		RespondValidationError(c, "Invalid rollout limit", []models.FieldError{{Field: "max_deploying", Message: "must be positive"}})
+		return
+	}
+
+	limit, err := h.db.UpsertRolloutLimit(ctx, models.RolloutLimit{
+		Domain:       domain,
+		AppName:      appName,
+		MaxDeploying: req.MaxDeploying,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store rollout limit", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store rollout limit")
+		return
+	}
+
+	h.logger.Info("Stored rollout limit",
+		"domain", domain,
+		"app_name", appName,
+		"max_deploying", limit.MaxDeploying)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Rollout limit stored successfully",
+		Data:    limit,
+	})
+}
+
+// DeleteRolloutLimit handles DELETE /api/v1/rollout-limits/:domain and
+// DELETE /api/v1/rollout-limits/:domain/:app_name
+func (h *Handler) DeleteRolloutLimit(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := rolloutLimitFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteRolloutLimit(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete rollout limit", "error", err, "domain", domain, "app_name", appName)
+
+		if err.Error() == "rollout limit not found" {
+			RespondError(c, http.StatusNotFound, "Rollout limit not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to delete rollout limit")
+		return
+	}
+
+	h.logger.Info("Deleted rollout limit", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Rollout limit deleted successfully",
+	})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// secretImpact finds the latest deployments that reference a secret, split
+// into those floating on its current version and those pinning a version
+func (h *Handler) secretImpact(ctx context.Context, secret *models.Secret) (*models.SecretImpact, error) {
+	deployments, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	impact := &models.SecretImpact{
+		Secret:   *secret,
+		Redeploy: []models.Deployment{},
+		Pinned:   []models.Deployment{},
+	}
+	for _, deployment := range deployments {
+		floating, pinned := false, false
+		for _, entry := range deployment.Env {
+			_, ref, ok := models.ParseSecretRef(entry)
+			if !ok {
+				continue
+			}
+			project, name, version, ok := models.SplitSecretRef(ref)
+			if !ok || project != secret.Project || name != secret.Name {
+				continue
+			}
+			if version == 0 {
+				floating = true
+			} else {
+				pinned = true
+			}
+		}
+
+		switch {
+		case floating:
+			impact.Redeploy = append(impact.Redeploy, deployment)
+		case pinned:
+			impact.Pinned = append(impact.Pinned, deployment)
+		}
+	}
+
+	return impact, nil
+}
+
+// respondSecretError maps a secret lookup error to a response
+func (h *Handler) respondSecretError(c *gin.Context, err error, message string) {
+	if err.Error() == "secret not found" {
+		RespondError(c, http.StatusNotFound, "Secret not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// ListSecretVersions handles GET /api/v1/secrets/:project/:name/versions
+func (h *Handler) ListSecretVersions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	project, name := c.Param("project"), c.Param("name")
+	versions, err := h.db.ListSecretVersions(ctx, project, name)
+	if err != nil {
+		h.logger.Error("Failed to list secret versions", "error", err, "project", project, "name", name)
+		h.respondSecretError(c, err, "Failed to list secret versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    versions,
+	})
+}
+
+// GetSecretImpact handles GET /api/v1/secrets/:project/:name/impact - a
+// preview of which apps a rotation would redeploy
+func (h *Handler) GetSecretImpact(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	project, name := c.Param("project"), c.Param("name")
+	secret, err := h.db.GetSecret(ctx, project, name)
+	if err != nil {
+		h.logger.Error("Failed to get secret", "error", err, "project", project, "name", name)
+		h.respondSecretError(c, err, "Failed to get secret")
+		return
+	}
+
+	impact, err := h.secretImpact(ctx, secret)
+	if err != nil {
+		h.logger.Error("Failed to get secret impact", "error", err, "project", project, "name", name)
+		RespondError(c, http.StatusInternalServerError, "Failed to get secret impact")
+		return
+	}
+
+	h.redactDeployments(c, impact.Redeploy)
+	h.redactDeployments(c, impact.Pinned)
+	addLinksAll(impact.Redeploy)
+	addLinksAll(impact.Pinned)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    impact,
+	})
+}
+
+// RotateSecret handles POST /api/v1/secrets/:project/:name/rotate - stores a
+// new version and redeploys every app floating on the secret
+func (h *Handler) RotateSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	if !h.requireCipher(c) {
+		return
+	}
+
+	// Rotation redeploys the apps floating on the secret
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	project, name := c.Param("project"), c.Param("name")
+
+	var req models.SecretUpdateRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid secret rotation request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	plaintext, errs := h.secretValue(req.Value, req.SealedValue, secretRef(project, name))
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid secret", errs)
+		return
+	}
+
+	value, err := h.cipher.Encrypt(plaintext, secretRef(project, name))
+	if err != nil {
+		h.logger.Error("Failed to encrypt secret", "error", err, "project", project, "name", name)
+		RespondError(c, http.StatusInternalServerError, "Failed to rotate secret")
+		return
+	}
+
+	secret, err := h.db.UpdateSecret(ctx, project, name, value)
+	if err != nil {
+		h.logger.Error("Failed to rotate secret", "error", err, "project", project, "name", name)
+		h.respondSecretError(c, err, "Failed to rotate secret")
+		return
+	}
+
+	impact, err := h.secretImpact(ctx, secret)
+	if err != nil {
+		h.logger.Error("Failed to get secret impact", "error", err, "project", project, "name", name)
+		RespondError(c, http.StatusInternalServerError, "Secret rotated but failed to redeploy referencing apps")
+		return
+	}
+
+	rotation := models.SecretRotation{
+		Secret:     *secret,
+		Redeployed: []models.Deployment{},
+		Pinned:     impact.Pinned,
+	}
+
+	if len(impact.Redeploy) > 0 {
+		reqs := make(models.DeploymentPushRequest, 0, len(impact.Redeploy))
+		for _, d := range impact.Redeploy {
+			reqs = append(reqs, models.DeploymentRequest{
+				Domain:      d.Domain,
+				AppName:     d.AppName,
+				DockerImage: d.DockerImage,
+				Port:        d.Port,
+				Env:         d.Env,
+				Metadata:    d.Metadata,
+				BuildInfo:   d.BuildInfo,
+			})
+		}
+
+		rotation.RequestID = uuid.New().String()
+		redeployed, err := h.db.CreateDeploymentBatch(ctx, reqs, rotation.RequestID, false)
+		if err != nil {
+			h.logger.Error("Failed to redeploy apps after secret rotation",
+				"error", err,
+				"project", project,
+				"name", name,
+				"version", secret.Version)
+			RespondError(c, http.StatusInternalServerError, "Secret rotated but failed to redeploy referencing apps")
+			return
+		}
+		rotation.Redeployed = redeployed
+	}
+
+	h.logger.Info("Rotated secret",
+		"project", project,
+		"name", name,
+		"version", secret.Version,
+		"request_id", rotation.RequestID,
+		"redeployed", len(rotation.Redeployed),
+		"pinned", len(rotation.Pinned))
+
+	h.redactDeployments(c, rotation.Redeployed)
+	h.redactDeployments(c, rotation.Pinned)
+	addLinksAll(rotation.Redeployed)
+	addLinksAll(rotation.Pinned)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Secret rotated successfully",
+		Data:    rotation,
+	})
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// scheduleRetryDelay is when a schedule whose cron expression no longer
+// parses is retried
+const scheduleRetryDelay = time.Hour
+
+// appFromPath reads and normalizes the :domain and :app_name path params,
+// responding with message on validation errors
+func appFromPath(c *gin.Context, message string) (domain, appName string, ok bool) {
+	var errs []models.FieldError
+	domain, err := validation.NormalizeDomain(c.Param("domain"))
+	if err != nil {
+		errs = append(errs, models.FieldError{Field: "domain", Message: err.Error()})
+	}
+	appName = c.Param("app_name")
+	if err := validation.ValidateAppName(appName); err != nil {
+		errs = append(errs, models.FieldError{Field: "app_name", Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, message, errs)
+		return "", "", false
+	}
+	return domain, appName, true
+}
+
+// nextScheduleRun returns a schedule's next run after now
+func nextScheduleRun(expr string, now time.Time) (time.Time, error) {
+	schedule, err := validation.ParseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(now), nil
+}
+
+// respondScheduleError maps a schedule lookup error to a response
+func (h *Handler) respondScheduleError(c *gin.Context, err error, message string) {
+	if err.Error() == "schedule not found" {
+		RespondError(c, http.StatusNotFound, "Schedule not found")
+		return
+	}
+	RespondError(c, http.StatusInternalServerError, message)
+}
+
+// redeployLatest re-creates an app's latest deployment as a new version
+func (h *Handler) redeployLatest(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	latest, err := h.db.GetLatestDeployment(ctx, domain, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	req := models.DeploymentRequest{
+		Domain:      latest.Domain,
+		AppName:     latest.AppName,
+		DockerImage: latest.DockerImage,
+		Port:        latest.Port,
+		Env:         latest.Env,
+		Metadata:    latest.Metadata,
+		BuildInfo:   latest.BuildInfo,
+	}
+	return h.db.CreateDeployment(ctx, req, uuid.New().String())
+}
+
+// RunSchedules redeploys every app whose schedule is due; it is run
+// periodically by the scheduler worker. While deployments are frozen due
+// schedules are left due, to run once the freeze is lifted.
+func (h *Handler) RunSchedules(ctx context.Context) error {
+	if frozen, err := h.frozen(ctx); err != nil || frozen {
+		return err
+	}
+
+	ran, err := h.db.RunDueSchedules(ctx, func(ctx context.Context, s *models.Schedule) (*uuid.UUID, time.Time, string) {
+		now := h.clock.Now()
+		next, err := nextScheduleRun(s.Cron, now)
+		if err != nil {
+			h.logger.Error("Invalid stored cron expression", "error", err, "domain", s.Domain, "app_name", s.AppName)
+			return nil, now.Add(scheduleRetryDelay), "cron " + err.Error()
+		}
+
+		deployment, err := h.redeployLatest(ctx, s.Domain, s.AppName)
+		if err != nil {
+			h.logger.Error("Scheduled redeploy failed", "error", err, "domain", s.Domain, "app_name", s.AppName)
+			return nil, next, err.Error()
+		}
+
+		h.logger.Info("Scheduled redeploy",
+			"domain", s.Domain,
+			"app_name", s.AppName,
+			"version", deployment.Version,
+			"next_run_at", next)
+		return &deployment.ID, next, ""
+	})
+	if err != nil {
+		return err
+	}
+
+	if ran > 0 {
+		h.logger.Info("Ran due schedules", "count", ran)
+	}
+	return nil
+}
+
+// PutSchedule handles PUT /api/v1/schedules/:domain/:app_name - creates or
+// replaces an app's schedule
+func (h *Handler) PutSchedule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid schedule")
+	if !ok {
+		return
+	}
+
+	var req models.ScheduleRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid schedule request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	next, err := nextScheduleRun(req.Cron, h.clock.Now())
+	if err != nil {
+		RespondValidationError(c, "Invalid schedule", []models.FieldError{{Field: "cron", Message: err.Error()}})
+		return
+	}
+
+	// Only existing apps can be scheduled, since runs copy the latest version
+	if _, err := h.db.GetLatestDeployment(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to get latest deployment", "error", err, "domain", domain, "app_name", appName)
+
+		if err.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to store schedule")
+		return
+	}
+
+	schedule, err := h.db.UpsertSchedule(ctx, domain, appName, req.Cron, req.Paused, next)
+	if err != nil {
+		h.logger.Error("Failed to store schedule", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store schedule")
+		return
+	}
+
+	h.logger.Info("Stored schedule",
+		"domain", domain,
+		"app_name", appName,
+		"cron", req.Cron,
+		"paused", req.Paused,
+		"next_run_at", next)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedule stored successfully",
+		Data:    schedule,
+	})
+}
+
+// ListSchedules handles GET /api/v1/schedules
+func (h *Handler) ListSchedules(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	schedules, err := h.db.ListSchedules(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list schedules", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list schedules")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    schedules,
+	})
+}
+
+// GetSchedule handles GET /api/v1/schedules/:domain/:app_name
+func (h *Handler) GetSchedule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid schedule")
+	if !ok {
+		return
+	}
+
+	schedule, err := h.db.GetSchedule(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get schedule", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to get schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    schedule,
+	})
+}
+
+// DeleteSchedule handles DELETE /api/v1/schedules/:domain/:app_name
+func (h *Handler) DeleteSchedule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid schedule")
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteSchedule(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete schedule", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to delete schedule")
+		return
+	}
+
+	h.logger.Info("Deleted schedule", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedule deleted successfully",
+	})
+}
+
+// PauseSchedule handles POST /api/v1/schedules/:domain/:app_name/pause
+func (h *Handler) PauseSchedule(c *gin.Context) {
+	h.setSchedulePaused(c, true)
+}
+
+// ResumeSchedule handles POST /api/v1/schedules/:domain/:app_name/resume
+func (h *Handler) ResumeSchedule(c *gin.Context) {
+	h.setSchedulePaused(c, false)
+}
+
+func (h *Handler) setSchedulePaused(c *gin.Context, paused bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid schedule")
+	if !ok {
+		return
+	}
+
+	current, err := h.db.GetSchedule(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get schedule", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to update schedule")
+		return
+	}
+
+	next, err := nextScheduleRun(current.Cron, h.clock.Now())
+	if err != nil {
+		h.logger.Error("Invalid stored cron expression", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to update schedule")
+		return
+	}
+
+	schedule, err := h.db.SetSchedulePaused(ctx, domain, appName, paused, next)
+	if err != nil {
+		h.logger.Error("Failed to update schedule", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to update schedule")
+		return
+	}
+
+	message := "Schedule resumed successfully"
+	if paused {
+		message = "Schedule paused successfully"
+	}
+
+	h.logger.Info("Updated schedule", "domain", domain, "app_name", appName, "paused", paused)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    schedule,
+	})
+}
+
+// TriggerSchedule handles POST /api/v1/schedules/:domain/:app_name/trigger -
+// runs a schedule now, even if paused, without moving its next run
+func (h *Handler) TriggerSchedule(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if h.rejectFrozen(ctx, c) {
+		return
+	}
+
+	domain, appName, ok := appFromPath(c, "Invalid schedule")
+	if !ok {
+		return
+	}
+
+	schedule, err := h.db.GetSchedule(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get schedule", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to trigger schedule")
+		return
+	}
+
+	deployment, runErr := h.redeployLatest(ctx, domain, appName)
+	var deploymentID *uuid.UUID
+	errMsg := ""
+	if runErr != nil {
+		h.logger.Error("Triggered redeploy failed", "error", runErr, "domain", domain, "app_name", appName)
+		errMsg = runErr.Error()
+	} else {
+		deploymentID = &deployment.ID
+	}
+
+	schedule, err = h.db.RecordScheduleRun(ctx, schedule.ID, deploymentID, errMsg)
+	if err != nil {
+		h.logger.Error("Failed to record schedule run", "error", err, "domain", domain, "app_name", appName)
+		h.respondScheduleError(c, err, "Failed to trigger schedule")
+		return
+	}
+
+	if runErr != nil {
+		if runErr.Error() == "deployment not found" {
+			RespondError(c, http.StatusNotFound, "Deployment not found")
+			return
+		}
+		RespondError(c, http.StatusInternalServerError, "Failed to trigger schedule")
+		return
+	}
+
+	h.logger.Info("Triggered schedule", "domain", domain, "app_name", appName, "version", deployment.Version)
+
+	h.redactDeployment(c, deployment)
+	addLinks(deployment)
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Schedule triggered successfully",
+		Data:    models.ScheduleRun{Schedule: *schedule, Deployment: deployment},
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSealingKey handles GET /api/v1/sealing/public-key
+func (h *Handler) GetSealingKey(c *gin.Context) {
+	if h.sealer == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Sealed values are disabled: security.sealing_key is not configured")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.SealingKey{
+			Algorithm: secrets.SealingAlgorithm,
+			KeyID:     h.sealer.KeyID(),
+			PublicKey: base64.StdEncoding.EncodeToString(h.sealer.PublicKey()),
+		},
+	})
+}
+
+// openSealed decrypts a sealed value bound to context; the error message is
+// safe to return to the client
+func (h *Handler) openSealed(sealed, context string) ([]byte, error) {
+	if h.sealer == nil {
+		return nil, fmt.Errorf("sealed values are disabled: security.sealing_key is not configured")
+	}
+
+	plaintext, err := h.sealer.Open(sealed, context)
+	if err != nil {
+		return nil, fmt.Errorf("cannot be opened; seal it to the current public key with context %q", context)
+	}
+	return plaintext, nil
+}
+
+// secretValue returns the plaintext of a secret request, opening it if it
+// was sealed to the secret's project/name
+func (h *Handler) secretValue(value, sealed, ref string) ([]byte, []models.FieldError) {
+	if (value == "") == (sealed == "") {
+		return nil, []models.FieldError{{Field: "value", Message: "exactly one of value and sealed_value is required"}}
+	}
+
+	plaintext := []byte(value)
+	if sealed != "" {
+		var err error
+		if plaintext, err = h.openSealed(sealed, ref); err != nil {
+			return nil, []models.FieldError{{Field: "sealed_value", Message: err.Error()}}
+		}
+	}
+
+	if len(plaintext) > maxSecretBytes {
+		return nil, []models.FieldError{{Field: "value", Message: "must be at most 65536 bytes"}}
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSecretBytes caps the size of a single secret value
+const maxSecretBytes = 64 * 1024
+
+// secretRef returns the "project/name" reference of a secret, which is also
+// bound into its ciphertext
+func secretRef(project, name string) string {
+	return project + "/" + name
+}
+
+// requireCipher responds 503 when no encryption key is configured
+func (h *Handler) requireCipher(c *gin.Context) bool {
+	if h.cipher == nil {
+		RespondError(c, http.StatusServiceUnavailable, "Secrets are disabled: neither security.encryption_key nor security.kms is usable")
+		return false
+	}
+	return true
+}
+
+// validateSecretPath checks the project and name of a secret
+func validateSecretPath(project, name string) []models.FieldError {
+	var errs []models.FieldError
+	if err := validation.ValidateSecretName(project); err != nil {
+		errs = append(errs, models.FieldError{Field: "project", Message: err.Error()})
+	}
+	if err := validation.ValidateSecretName(name); err != nil {
+		errs = append(errs, models.FieldError{Field: "name", Message: err.Error()})
+	}
+	return errs
+}
+
+// CreateSecret handles POST /api/v1/secrets
+func (h *Handler) CreateSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if !h.requireCipher(c) {
+		return
+	}
+
+	var req models.SecretRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid secret request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	errs := validateSecretPath(req.Project, req.Name)
+	plaintext, valueErrs := h.secretValue(req.Value, req.SealedValue, secretRef(req.Project, req.Name))
+	errs = append(errs, valueErrs...)
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid secret", errs)
+		return
+	}
+
+	value, err := h.cipher.Encrypt(plaintext, secretRef(req.Project, req.Name))
+	if err != nil {
+		h.logger.Error("Failed to encrypt secret", "error", err, "project", req.Project, "name", req.Name)
+		RespondError(c, http.StatusInternalServerError, "Failed to store secret")
+		return
+	}
+
+	secret, err := h.db.CreateSecret(ctx, req.Project, req.Name, value)
+	if err != nil {
+		h.logger.Error("Failed to create secret", "error", err, "project", req.Project, "name", req.Name)
+
+		if err.Error() == "secret already exists" {
+			RespondError(c, http.StatusConflict, "Secret already exists; use PUT to replace its value")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to store secret")
+		return
+	}
+
+	h.logger.Info("Created secret", "project", secret.Project, "name", secret.Name)
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Secret stored successfully",
+		Data:    secret,
+	})
+}
+
+// ListSecrets handles GET /api/v1/secrets
+func (h *Handler) ListSecrets(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	secrets, err := h.db.ListSecrets(ctx, c.Query("project"))
+	if err != nil {
+		h.logger.Error("Failed to list secrets", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list secrets")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    secrets,
+	})
+}
+
+// GetSecret handles GET /api/v1/secrets/:project/:name
+func (h *Handler) GetSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	project, name := c.Param("project"), c.Param("name")
+	secret, err := h.db.GetSecret(ctx, project, name)
+	if err != nil {
+		h.logger.Error("Failed to get secret", "error", err, "project", project, "name", name)
+
+		if err.Error() == "secret not found" {
+			RespondError(c, http.StatusNotFound, "Secret not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to get secret")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    secret,
+	})
+}
+
+// UpdateSecret handles PUT /api/v1/secrets/:project/:name
+func (h *Handler) UpdateSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if !h.requireCipher(c) {
+		return
+	}
+
+	project, name := c.Param("project"), c.Param("name")
+
+	var req models.SecretUpdateRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid secret update request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	plaintext, errs := h.secretValue(req.Value, req.SealedValue, secretRef(project, name))
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid secret", errs)
+		return
+	}
+
+	value, err := h.cipher.Encrypt(plaintext, secretRef(project, name))
+	if err != nil {
+		h.logger.Error("Failed to encrypt secret", "error", err, "project", project, "name", name)
+		RespondError(c, http.StatusInternalServerError, "Failed to update secret")
+		return
+	}
+
+	secret, err := h.db.UpdateSecret(ctx, project, name, value)
+	if err != nil {
+		h.logger.Error("Failed to update secret", "error", err, "project", project, "name", name)
+
+		if err.Error() == "secret not found" {
+			RespondError(c, http.StatusNotFound, "Secret not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to update secret")
+		return
+	}
+
+	h.logger.Info("Updated secret", "project", project, "name", name, "version", secret.Version)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Secret updated successfully",
+		Data:    secret,
+	})
+}
+
+// DeleteSecret handles DELETE /api/v1/secrets/:project/:name
+func (h *Handler) DeleteSecret(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	project, name := c.Param("project"), c.Param("name")
+	if err := h.db.DeleteSecret(ctx, project, name); err != nil {
+		h.logger.Error("Failed to delete secret", "error", err, "project", project, "name", name)
+
+		if err.Error() == "secret not found" {
+			RespondError(c, http.StatusNotFound, "Secret not found")
+			return
+		}
+
+		RespondError(c, http.StatusInternalServerError, "Failed to delete secret")
+		return
+	}
+
+	h.logger.Info("Deleted secret", "project", project, "name", name)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Secret deleted successfully",
+	})
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportHealthProbe handles POST /api/v1/agent/apps/:domain/:app_name/probes
+// - an agent reports the result of a health probe of an app. Probes of apps
+// in maintenance are not recorded.
+func (h *Handler) ReportHealthProbe(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid health probe")
+	if !ok {
+		return
+	}
+
+	var req models.HealthProbeRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid health probe request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	now := h.clock.Now()
+	checkedAt := now
+	if req.CheckedAt != nil {
+		if req.CheckedAt.After(now.Add(time.Minute)) || now.Sub(*req.CheckedAt) > h.cfg.SLA.Retention {
+			RespondValidationError(c, "Invalid health probe", []models.FieldError{{Field: "checked_at", Message: "must not be in the future or older than sla.retention"}})
+			return
+		}
+		checkedAt = *req.CheckedAt
+	}
+	if req.LatencyMs != nil && *req.LatencyMs < 0 {
+		RespondValidationError(c, "Invalid health probe", []models.FieldError{{Field: "latency_ms", Message: "must not be negative"}})
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get app")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	maintenance, err := h.db.GetMaintenance(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get maintenance", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to record health probe")
+		return
+	}
+	if maintenance.Enabled {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "App is in maintenance; health probe not recorded",
+		})
+		return
+	}
+
+	probe := models.HealthProbe{
+		Domain:       domain,
+		AppName:      appName,
+		DeploymentID: req.DeploymentID,
+		Healthy:      *req.Healthy,
+		Agent:        c.GetString(ActorKey),
+		CheckedAt:    checkedAt,
+		LatencyMs:    req.LatencyMs,
+	}
+	if probe.DeploymentID == nil {
+		probe.DeploymentID = &latest.ID
+	}
+	if err := h.db.RecordHealthProbe(ctx, probe); err != nil {
+		h.logger.Error("Failed to record health probe", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to record health probe")
+		return
+	}
+
+	if !probe.Healthy {
+		h.logger.Warn("App failed a health probe",
+			"domain", domain,
+			"app_name", appName,
+			"deployment_id", probe.DeploymentID,
+			"actor", probe.Agent)
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Data:    probe,
+	})
+}
+
+// GetSLAReport handles GET /api/v1/stats/sla?windows=24h,7d,30d - each app's
+// availability, from its health probes, and deployments over each window
+func (h *Handler) GetSLAReport(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	windows := h.cfg.SLA.Windows
+	if value := c.Query("windows"); value != "" {
+		windows = nil
+		for _, part := range strings.Split(value, ",") {
+			window, err := parseWindow(strings.TrimSpace(part))
+			if err != nil || window > h.cfg.SLA.Retention {
+				RespondValidationError(c, "Invalid SLA query", []models.FieldError{{
+					Field:   "windows",
+					Message: fmt.Sprintf("must be durations like 24h, 7d or 4w, up to %s", formatWindow(h.cfg.SLA.Retention)),
+				}})
+				return
+			}
+			windows = append(windows, window)
+		}
+	}
+
+	now := h.clock.Now()
+	counts := make([][]models.SLACounts, len(windows))
+	for i, window := range windows {
+		var err error
+		counts[i], err = h.db.GetSLACounts(ctx, now.Add(-window))
+		if err != nil {
+			h.logger.Error("Failed to get SLA counts", "error", err)
+			RespondError(c, http.StatusInternalServerError, "Failed to get SLA report")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    slaReport(windows, counts, h.cfg.SLA.Target),
+	})
+}
+
+// maxLatencyPoints caps the steps of a latency time series
+const maxLatencyPoints = 1000
+
+// GetLatencyReport handles GET /api/v1/stats/latency/:domain/:app_name
+// ?window=24h&step=1h - percentiles of the response times of an app's http
+// health probes over the window, per step and per deployment probed
+func (h *Handler) GetLatencyReport(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid latency query")
+	if !ok {
+		return
+	}
+
+	var errs []models.FieldError
+	window, err := parseWindow(c.DefaultQuery("window", "24h"))
+	if err != nil || window > h.cfg.SLA.Retention {
+		errs = append(errs, models.FieldError{
+			Field:   "window",
+			Message: fmt.Sprintf("must be a duration like 24h, 7d or 4w, up to %s", formatWindow(h.cfg.SLA.Retention)),
+		})
+	}
+	step, err := parseWindow(c.DefaultQuery("step", "1h"))
+	if err != nil || step < time.Minute {
+		errs = append(errs, models.FieldError{Field: "step", Message: "must be a duration of at least 1m"})
+	} else if window/step > maxLatencyPoints {
+		errs = append(errs, models.FieldError{Field: "step", Message: fmt.Sprintf("must divide the window into at most %d steps", maxLatencyPoints)})
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid latency query", errs)
+		return
+	}
+
+	latest, err := h.latestApp(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get app", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get latency report")
+		return
+	}
+	if latest == nil {
+		RespondError(c, http.StatusNotFound, "App not found")
+		return
+	}
+
+	since := h.clock.Now().Add(-window)
+	points, err := h.db.GetLatencySeries(ctx, domain, appName, since, step)
+	if err != nil {
+		h.logger.Error("Failed to get latency series", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get latency report")
+		return
+	}
+	deployments, err := h.db.GetDeploymentLatencies(ctx, domain, appName, since)
+	if err != nil {
+		h.logger.Error("Failed to get deployment latencies", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to get latency report")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.LatencyReport{
+			Domain:      domain,
+			AppName:     appName,
+			Window:      formatWindow(window),
+			Step:        formatWindow(step),
+			Since:       since,
+			Points:      points,
+			Deployments: deployments,
+		},
+	})
+}
+
+// slaReport combines the counts of each window, ordered by domain and app
+// name, into per-app availability. Apps missing from a window get empty
+// counts in it.
+func slaReport(windows []time.Duration, counts [][]models.SLACounts, target float64) models.SLAReport {
+	report := models.SLAReport{Target: target, Apps: []models.AppSLA{}}
+	apps := map[string]int{}
+	for i, window := range windows {
+		report.Windows = append(report.Windows, formatWindow(window))
+		for _, count := range counts[i] {
+			key := count.Domain + "/" + count.AppName
+			idx, ok := apps[key]
+			if !ok {
+				idx = len(report.Apps)
+				apps[key] = idx
+				app := models.AppSLA{Domain: count.Domain, AppName: count.AppName}
+				for _, label := range report.Windows[:i] {
+					app.Windows = append(app.Windows, models.SLAWindow{Window: label})
+				}
+				report.Apps = append(report.Apps, app)
+			}
+
+			w := models.SLAWindow{
+				Window:            report.Windows[i],
+				Probes:            count.Probes,
+				HealthyProbes:     count.HealthyProbes,
+				Deployments:       count.Deployments,
+				FailedDeployments: count.FailedDeployments,
+				Incidents:         count.Incidents,
+				DowntimeSeconds:   count.Downtime.Seconds(),
+			}
+			if count.Probes > 0 {
+				availability := 100 * float64(count.HealthyProbes) / float64(count.Probes)
+				meets := availability >= target
+				w.Availability, w.MeetsTarget = &availability, &meets
+			}
+			report.Apps[idx].Windows = append(report.Apps[idx].Windows, w)
+		}
+		for idx := range report.Apps {
+			if len(report.Apps[idx].Windows) == i {
+				report.Apps[idx].Windows = append(report.Apps[idx].Windows, models.SLAWindow{Window: report.Windows[i]})
+			}
+		}
+	}
+
+	slices.SortFunc(report.Apps, func(a, b models.AppSLA) int {
+		return cmp.Or(cmp.Compare(a.Domain, b.Domain), cmp.Compare(a.AppName, b.AppName))
+	})
+	return report
+}
+
+// windowUnits are the units a report window may be given in besides those
+// of time.ParseDuration
+var windowUnits = map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+
+// parseWindow parses a report window: a duration such as 24h, or a number
+// of days (7d) or weeks (4w)
+func parseWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, fmt.Errorf("empty window")
+	}
+	window, err := time.ParseDuration(value)
+	if unit, ok := windowUnits[value[len(value)-1]]; ok {
+		var n int
+		n, err = strconv.Atoi(value[:len(value)-1])
+		window = time.Duration(n) * unit
+	}
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+	return window, nil
+}
+
+// formatWindow formats a report window in days when it is whole days
+func formatWindow(window time.Duration) string {
+	if window%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(window/(24*time.Hour))) + "d"
+	}
+	s := window.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// RunHealthProbeRetention deletes the health probes, and the incidents
+// resolved, longer than sla.retention ago
+func (h *Handler) RunHealthProbeRetention(ctx context.Context) error {
+	before := h.clock.Now().Add(-h.cfg.SLA.Retention)
+	pruned, err := h.db.PruneHealthProbes(ctx, before)
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		h.logger.Info("Pruned health probes", "count", pruned)
+	}
+
+	pruned, err = h.db.PruneIncidents(ctx, before)
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		h.logger.Info("Pruned incidents", "count", pruned)
+	}
+	return nil
+}
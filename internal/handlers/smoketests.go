@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// smokeTestMethods are the request methods http smoke tests may use
+var smokeTestMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// smokeTestBodyLimit bounds how much of a response is searched for an http
+// test's expected body
+const smokeTestBodyLimit = 1 << 20
+
+// validateSmokeTest checks a smoke test request and defaults the method of
+// http tests to GET; fields unused by its type must be left empty
+func validateSmokeTest(req *models.SmokeTestRequest) []models.FieldError {
+	if !slices.Contains(models.SmokeTestTypes, req.Type) {
+		return []models.FieldError{{Field: "type", Message: "must be one of: " + strings.Join(models.SmokeTestTypes, ", ")}}
+	}
+
+	var errs []models.FieldError
+	if req.Type == models.SmokeTestHTTP {
+		req.Method = strings.ToUpper(req.Method)
+		if req.Method == "" {
+			req.Method = http.MethodGet
+		}
+		if !slices.Contains(smokeTestMethods, req.Method) {
+			errs = append(errs, models.FieldError{Field: "method", Message: "must be one of: " + strings.Join(smokeTestMethods, ", ")})
+		}
+		if !strings.HasPrefix(req.Path, "/") {
+			errs = append(errs, models.FieldError{Field: "path", Message: "is required and must start with /"})
+		}
+		if req.ExpectedStatus != 0 && (req.ExpectedStatus < 100 || req.ExpectedStatus > 599) {
+			errs = append(errs, models.FieldError{Field: "expected_status", Message: "must be between 100 and 599, or 0 for any 2xx"})
+		}
+		if len(req.Command) > 0 {
+			errs = append(errs, models.FieldError{Field: "command", Message: "is only used by exec tests"})
+		}
+		return errs
+	}
+
+	if len(req.Command) == 0 || req.Command[0] == "" {
+		errs = append(errs, models.FieldError{Field: "command", Message: "is required for exec tests"})
+	}
+	if req.Method != "" || req.Path != "" || req.ExpectedStatus != 0 || req.ExpectedBody != "" {
+		errs = append(errs, models.FieldError{Field: "type", Message: "method, path, expected_status and expected_body are only used by http tests"})
+	}
+	return errs
+}
+
+// respondSmokeTestError maps a smoke test lookup error to a response
+func (h *Handler) respondSmokeTestError(c *gin.Context, err error, message string) {
+	switch err.Error() {
+	case "smoke test not found":
+		RespondError(c, http.StatusNotFound, "Smoke test not found")
+	case "smoke test result not found":
+		RespondError(c, http.StatusNotFound, "Deployment has no smoke test result")
+	case "smoke test not running":
+		RespondError(c, http.StatusConflict, "Deployment has no running smoke test")
+	default:
+		RespondError(c, http.StatusInternalServerError, message)
+	}
+}
+
+// RunSmokeTests starts the smoke tests of deployments deployed within
+// smoke.window, running http tests itself and leaving exec tests to
+// agents, then fails the tests still running after smoke.agent_timeout.
+// It is run periodically.
+func (h *Handler) RunSmokeTests(ctx context.Context) error {
+	cfg := h.cfg.Smoke
+	due, err := h.db.ListDueSmokeTests(ctx, h.clock.Now().Add(-cfg.Window))
+	if err != nil {
+		return err
+	}
+
+	for _, run := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		agent := ""
+		if run.Test.Type == models.SmokeTestHTTP {
+			agent = controllerAgent
+		}
+		started, err := h.db.StartSmokeTest(ctx, run.DeploymentID, agent)
+		if err != nil {
+			h.logger.Error("Failed to start smoke test", "error", err, "deployment_id", run.DeploymentID)
+			continue
+		}
+		if !started || run.Test.Type != models.SmokeTestHTTP {
+			continue
+		}
+
+		passed, message := h.runHTTPSmokeTest(ctx, run)
+		if _, err := h.finishSmokeTest(ctx, run, passed, message, controllerAgent); err != nil {
+			h.logger.Error("Failed to record smoke test", "error", err, "deployment_id", run.DeploymentID)
+		}
+	}
+
+	running, err := h.db.ListRunningSmokeTests(ctx, "")
+	if err != nil {
+		return err
+	}
+	now := h.clock.Now()
+	for _, run := range running {
+		if run.StartedAt == nil || now.Sub(*run.StartedAt) < cfg.AgentTimeout {
+			continue
+		}
+		message := fmt.Sprintf("no result reported within %s", cfg.AgentTimeout)
+		if _, err := h.finishSmokeTest(ctx, run, false, message, ""); err != nil {
+			h.logger.Error("Failed to record smoke test", "error", err, "deployment_id", run.DeploymentID)
+		}
+	}
+	return nil
+}
+
+// runHTTPSmokeTest makes an http test's request to the deployment's domain,
+// reporting whether it passed and why
+func (h *Handler) runHTTPSmokeTest(ctx context.Context, run models.SmokeTestRun) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Smoke.Timeout)
+	defer cancel()
+
+	test := run.Test
+	d := models.Deployment{Domain: run.Domain, AppName: run.AppName, Port: run.Port}
+	path := healthURL(test.Path, d)
+	req, err := http.NewRequestWithContext(ctx, test.Method, h.cfg.Probes.Scheme+"://"+run.Domain+path, nil)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Sprintf("%s %s failed: %v", test.Method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if test.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return false, fmt.Sprintf("%s %s answered %d, expected 2xx", test.Method, path, resp.StatusCode)
+	}
+	if test.ExpectedStatus != 0 && resp.StatusCode != test.ExpectedStatus {
+		return false, fmt.Sprintf("%s %s answered %d, expected %d", test.Method, path, resp.StatusCode, test.ExpectedStatus)
+	}
+
+	if test.ExpectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, smokeTestBodyLimit))
+		if err != nil {
+			return false, fmt.Sprintf("%s %s failed reading the body: %v", test.Method, path, err)
+		}
+		if !strings.Contains(string(body), test.ExpectedBody) {
+			return false, fmt.Sprintf("%s %s answered %d without %q in the body", test.Method, path, resp.StatusCode, test.ExpectedBody)
+		}
+	}
+	return true, fmt.Sprintf("%s %s answered %d", test.Method, path, resp.StatusCode)
+}
+
+// finishSmokeTest records the outcome of a running smoke test, rolling the
+// deployment back when it failed and its test asks for that
+func (h *Handler) finishSmokeTest(ctx context.Context, run models.SmokeTestRun, passed bool, message, agent string) (*models.SmokeTestResult, error) {
+	status := models.SmokePassed
+	if !passed {
+		status = models.SmokeFailed
+	}
+	result, err := h.db.FinishSmokeTest(ctx, run.DeploymentID, status, message, agent)
+	if err != nil {
+		return nil, err
+	}
+	metrics.SmokeTests.WithLabelValues(status).Inc()
+
+	if passed {
+		h.logger.Info("Smoke test passed",
+			"domain", run.Domain,
+			"app_name", run.AppName,
+			"deployment_id", run.DeploymentID,
+			"message", message)
+		return result, nil
+	}
+	h.logger.Warn("Smoke test failed",
+		"domain", run.Domain,
+		"app_name", run.AppName,
+		"deployment_id", run.DeploymentID,
+		"message", message)
+
+	if !run.Test.Rollback {
+		return result, nil
+	}
+	d, err := h.db.GetDeployment(ctx, run.DeploymentID)
+	if err != nil {
+		h.logger.Error("Failed to get deployment to roll back", "error", err, "deployment_id", run.DeploymentID)
+		return result, nil
+	}
+	restored, err := h.rollBack(ctx, *d, "smoke_test", "smoke test failed: "+message)
+	if err != nil {
+		h.logger.Warn("Not rolling back deployment", "reason", err, "deployment_id", run.DeploymentID)
+		return result, nil
+	}
+	result.RollbackID = &restored.ID
+	return result, nil
+}
+
+// PutSmokeTest handles PUT /api/v1/smoke-tests/:domain/:app_name
+func (h *Handler) PutSmokeTest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid smoke test")
+	if !ok {
+		return
+	}
+
+	var req models.SmokeTestRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid smoke test request", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if errs := validateSmokeTest(&req); len(errs) > 0 {
+		RespondValidationError(c, "Invalid smoke test", errs)
+		return
+	}
+
+	test, err := h.db.UpsertSmokeTest(ctx, models.SmokeTest{
+		Domain:         domain,
+		AppName:        appName,
+		Type:           req.Type,
+		Method:         req.Method,
+		Path:           req.Path,
+		ExpectedStatus: req.ExpectedStatus,
+		ExpectedBody:   req.ExpectedBody,
+		Command:        req.Command,
+		Rollback:       req.Rollback,
+	})
+	if err != nil {
+		h.logger.Error("Failed to store smoke test", "error", err, "domain", domain, "app_name", appName)
+		RespondError(c, http.StatusInternalServerError, "Failed to store smoke test")
+		return
+	}
+
+	h.logger.Info("Stored smoke test",
+		"domain", domain,
+		"app_name", appName,
+		"type", test.Type,
+		"rollback", test.Rollback)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Smoke test stored successfully",
+		Data:    test,
+	})
+}
+
+// GetSmokeTest handles GET /api/v1/smoke-tests/:domain/:app_name
+func (h *Handler) GetSmokeTest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid smoke test")
+	if !ok {
+		return
+	}
+
+	test, err := h.db.GetSmokeTest(ctx, domain, appName)
+	if err != nil {
+		h.logger.Error("Failed to get smoke test", "error", err, "domain", domain, "app_name", appName)
+		h.respondSmokeTestError(c, err, "Failed to get smoke test")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    test,
+	})
+}
+
+// DeleteSmokeTest handles DELETE /api/v1/smoke-tests/:domain/:app_name
+func (h *Handler) DeleteSmokeTest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	domain, appName, ok := appFromPath(c, "Invalid smoke test")
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteSmokeTest(ctx, domain, appName); err != nil {
+		h.logger.Error("Failed to delete smoke test", "error", err, "domain", domain, "app_name", appName)
+		h.respondSmokeTestError(c, err, "Failed to delete smoke test")
+		return
+	}
+
+	h.logger.Info("Deleted smoke test", "domain", domain, "app_name", appName)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Smoke test deleted successfully",
+	})
+}
+
+// GetSmokeTestResult handles GET /api/v1/deployments/:id/smoke-test
+func (h *Handler) GetSmokeTestResult(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to get smoke test result")
+	if !ok {
+		return
+	}
+
+	result, err := h.db.GetSmokeTestResult(ctx, deployment.ID)
+	if err != nil {
+		h.logger.Error("Failed to get smoke test result", "error", err, "id", deployment.ID)
+		h.respondSmokeTestError(c, err, "Failed to get smoke test result")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// ListAgentSmokeTests handles GET /api/v1/agent/smoke-tests - the running
+// exec tests agents must run and report
+func (h *Handler) ListAgentSmokeTests(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	runs, err := h.db.ListRunningSmokeTests(ctx, models.SmokeTestExec)
+	if err != nil {
+		h.logger.Error("Failed to list smoke tests", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to list smoke tests")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    runs,
+	})
+}
+
+// ReportSmokeTest handles POST /api/v1/agent/deployments/:id/smoke-test -
+// an agent reporting the outcome of a deployment's exec test
+func (h *Handler) ReportSmokeTest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	deployment, ok := h.deploymentFromPath(ctx, c, "Failed to record smoke test")
+	if !ok {
+		return
+	}
+
+	var req models.SmokeTestReport
+	if err := h.bindJSON(c, &req); err != nil {
+		h.logger.Error("Invalid smoke test report", "error", err)
+		RespondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// A test deleted since it started still records its outcome, but no
+	// longer rolls back
+	run := models.SmokeTestRun{
+		DeploymentID: deployment.ID,
+		Domain:       deployment.Domain,
+		AppName:      deployment.AppName,
+		Version:      deployment.Version,
+		Port:         deployment.Port,
+	}
+	test, err := h.db.GetSmokeTest(ctx, deployment.Domain, deployment.AppName)
+	if err != nil && err.Error() != "smoke test not found" {
+		h.logger.Error("Failed to get smoke test", "error", err, "id", deployment.ID)
+		RespondError(c, http.StatusInternalServerError, "Failed to record smoke test")
+		return
+	}
+	if test != nil {
+		run.Test = *test
+	}
+
+	result, err := h.finishSmokeTest(ctx, run, *req.Passed, req.Message, c.GetString(ActorKey))
+	if err != nil {
+		h.logger.Error("Failed to record smoke test", "error", err, "id", deployment.ID)
+		h.respondSmokeTestError(c, err, "Failed to record smoke test")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Smoke test recorded successfully",
+		Data:    result,
+	})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// environmentStatus rolls up the latest deployments of an environment, with
+// their health set. Failed, rolled back, stalled and unhealthy apps are
+// degraded, as are deployed apps whose probes went stale or that failed
+// verification; deployed apps never probed are not, since probing may be off.
+func environmentStatus(domain string, deployments []models.Deployment, now time.Time) models.EnvironmentStatus {
+	status := models.EnvironmentStatus{
+		Domain:    domain,
+		Apps:      len(deployments),
+		Degraded:  []models.DegradedApp{},
+		CheckedAt: now,
+	}
+
+	for _, d := range deployments {
+		reason := ""
+		switch d.Status {
+		case "pending", "deploying":
+			status.Pending++
+		case "failed", "rolled_back", "stalled":
+			reason = d.Status
+		case "deployed":
+			switch {
+			case d.Verification == models.VerificationDegraded:
+				reason = "verification degraded"
+			case d.Health == nil:
+				status.Unprobed++
+			case d.Health.Status == models.HealthHealthy:
+				status.Healthy++
+			default:
+				reason = d.Health.Status
+			}
+		}
+		if reason != "" {
+			status.Degraded = append(status.Degraded, models.DegradedApp{
+				Domain:  d.Domain,
+				AppName: d.AppName,
+				Version: d.Version,
+				Status:  d.Status,
+				Reason:  reason,
+			})
+		}
+	}
+
+	switch {
+	case len(status.Degraded) > 0:
+		status.Status = models.EnvironmentDegraded
+	case status.Pending > 0:
+		status.Status = models.EnvironmentDeploying
+	default:
+		status.Status = models.EnvironmentOperational
+	}
+	return status
+}
+
+// GetStatus handles GET /api/v1/status?domain=foo.com - a rollup of the
+// latest deployments of a domain, or of every app. With ?gate=true it
+// responds 503 unless the environment is operational, for pre-release
+// checks.
+func (h *Handler) GetStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var errs []models.FieldError
+	domain := c.Query("domain")
+	if domain != "" {
+		normalized, err := validation.NormalizeDomain(domain)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "domain", Message: err.Error()})
+		}
+		domain = normalized
+	}
+	gate := false
+	if v := c.Query("gate"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "gate", Message: "must be true or false"})
+		}
+		gate = parsed
+	}
+	if len(errs) > 0 {
+		RespondValidationError(c, "Invalid status query", errs)
+		return
+	}
+
+	latest, err := h.db.GetLatestDeployments(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get deployments", "error", err)
+		RespondError(c, http.StatusInternalServerError, "Failed to get status")
+		return
+	}
+
+	deployments := latest
+	if domain != "" {
+		deployments = nil
+		for _, d := range latest {
+			if d.Domain == domain {
+				deployments = append(deployments, d)
+			}
+		}
+		if len(deployments) == 0 {
+			RespondError(c, http.StatusNotFound, "Domain not found")
+			return
+		}
+	}
+
+	h.addHealthAll(ctx, deployments)
+	status := environmentStatus(domain, deployments, h.clock.Now())
+
+	code := http.StatusOK
+	if gate && status.Status != models.EnvironmentOperational {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, models.APIResponse{
+		Success: code == http.StatusOK,
+		Data:    status,
+	})
+}
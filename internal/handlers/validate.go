@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/validation"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// maxCheckNameLength caps the length of a CI check name
+const maxCheckNameLength = 200
+
+// maxBuildFieldLength caps the length of a git ref, build URL or builder
+const maxBuildFieldLength = 500
+
+// Limits on the failure reported with a failed status
+const (
+	maxErrorMessageLength = 2000
+	maxErrorDetailsBytes  = 16 << 10
+)
+
+// validateDeploymentRequest checks the format of a single deployment request
+// and normalizes it in place
+func (h *Handler) validateDeploymentRequest(req *models.DeploymentRequest, index *int) []models.FieldError {
+	var errs []models.FieldError
+
+	domain, err := validation.NormalizeDomain(req.Domain)
+	if err != nil {
+		errs = append(errs, models.FieldError{Index: index, Field: "domain", Message: err.Error()})
+	} else {
+		req.Domain = domain
+	}
+
+	if err := validation.ValidateAppName(req.AppName); err != nil {
+		errs = append(errs, models.FieldError{Index: index, Field: "app_name", Message: err.Error()})
+	}
+
+	image, err := validation.NormalizeImage(req.DockerImage)
+	if err != nil {
+		errs = append(errs, models.FieldError{Index: index, Field: "docker_image", Message: err.Error()})
+	} else {
+		req.DockerImage = image
+	}
+
+	if req.Priority == "" {
+		req.Priority = models.PriorityNormal
+	} else if !slices.Contains(models.Priorities, req.Priority) {
+		errs = append(errs, models.FieldError{Index: index, Field: "priority", Message: "must be one of: " + strings.Join(models.Priorities, ", ")})
+	}
+
+	seen := make(map[string]bool, len(req.Checks))
+	for i, name := range req.Checks {
+		name = strings.TrimSpace(name)
+		req.Checks[i] = name
+		field := fmt.Sprintf("checks[%d]", i)
+		switch {
+		case name == "":
+			errs = append(errs, models.FieldError{Index: index, Field: field, Message: "must not be empty"})
+		case len(name) > maxCheckNameLength:
+			errs = append(errs, models.FieldError{Index: index, Field: field, Message: fmt.Sprintf("must be at most %d characters", maxCheckNameLength)})
+		case seen[name]:
+			errs = append(errs, models.FieldError{Index: index, Field: field, Message: "duplicate check " + name})
+		}
+		seen[name] = true
+	}
+
+	errs = append(errs, validateBuildInfo(&req.BuildInfo, index)...)
+
+	limits := h.cfg.Validation
+	errs = append(errs, validateMetadata(req.Metadata, limits.MaxMetadataBytes, index)...)
+	for _, envErr := range validation.ValidateEnv(req.Env, limits.MaxEnvVars, limits.MaxEnvBytes) {
+		field := "env"
+		if envErr.Entry >= 0 {
+			field = fmt.Sprintf("env[%d]", envErr.Entry)
+		}
+		errs = append(errs, models.FieldError{Index: index, Field: field, Message: envErr.Message})
+	}
+
+	for i, entry := range req.Env {
+		if _, ref, ok := models.ParseSecretRef(entry); ok {
+			if err := validation.ValidateSecretRef(ref); err != nil {
+				errs = append(errs, models.FieldError{Index: index, Field: fmt.Sprintf("env[%d].secret_ref", i), Message: err.Error()})
+			}
+		}
+
+		// Reject sealed values the agent fetch would be unable to open
+		if name, sealed, ok := models.ParseSealedValue(entry); ok {
+			if _, err := h.openSealed(sealed, name); err != nil {
+				errs = append(errs, models.FieldError{Index: index, Field: fmt.Sprintf("env[%d].sealed_value", i), Message: err.Error()})
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateBuildInfo checks a deployment's build metadata and normalizes it in
+// place; every field may be empty
+func validateBuildInfo(build *models.BuildInfo, index *int) []models.FieldError {
+	var errs []models.FieldError
+
+	build.GitSHA = strings.TrimSpace(build.GitSHA)
+	if build.GitSHA != "" {
+		sha, err := validation.NormalizeGitSHA(build.GitSHA)
+		if err != nil {
+			errs = append(errs, models.FieldError{Index: index, Field: "git_sha", Message: err.Error()})
+		} else {
+			build.GitSHA = sha
+		}
+	}
+
+	build.GitRef = strings.TrimSpace(build.GitRef)
+	build.BuildURL = strings.TrimSpace(build.BuildURL)
+	build.Builder = strings.TrimSpace(build.Builder)
+	for _, field := range []struct{ name, value string }{
+		{"git_ref", build.GitRef},
+		{"build_url", build.BuildURL},
+		{"builder", build.Builder},
+	} {
+		if len(field.value) > maxBuildFieldLength {
+			errs = append(errs, models.FieldError{Index: index, Field: field.name, Message: fmt.Sprintf("must be at most %d characters", maxBuildFieldLength)})
+		}
+	}
+	if build.BuildURL != "" {
+		if err := validation.ValidateBuildURL(build.BuildURL); err != nil {
+			errs = append(errs, models.FieldError{Index: index, Field: "build_url", Message: err.Error()})
+		}
+	}
+
+	return errs
+}
+
+// validateMetadata checks the keys of a deployment's metadata and that it
+// encodes to at most maxBytes of JSON (zero disables the limit)
+func validateMetadata(metadata map[string]any, maxBytes int, index *int) []models.FieldError {
+	var errs []models.FieldError
+
+	keys := slices.Sorted(maps.Keys(metadata))
+	for _, key := range keys {
+		if err := validation.ValidateMetadataKey(key); err != nil {
+			errs = append(errs, models.FieldError{Index: index, Field: "metadata." + key, Message: err.Error()})
+		}
+	}
+
+	if maxBytes > 0 && len(metadata) > 0 {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			errs = append(errs, models.FieldError{Index: index, Field: "metadata", Message: "must be a JSON object"})
+		} else if len(encoded) > maxBytes {
+			errs = append(errs, models.FieldError{Index: index, Field: "metadata", Message: fmt.Sprintf("must be at most %d bytes of JSON, got %d", maxBytes, len(encoded))})
+		}
+	}
+
+	return errs
+}
+
+// validateFailure checks the error fields of a status update and returns the
+// failure they describe; nil when none were given
+func validateFailure(req *models.StatusUpdateRequest) (*models.DeploymentFailure, []models.FieldError) {
+	req.ErrorCode = strings.TrimSpace(req.ErrorCode)
+	if req.ErrorCode == "" && req.ErrorMessage == "" && req.Details == nil {
+		return nil, nil
+	}
+
+	var errs []models.FieldError
+	if req.Status != "failed" {
+		errs = append(errs, models.FieldError{Field: "error_code", Message: "may only be reported with status failed"})
+		return nil, errs
+	}
+	if req.ErrorCode == "" {
+		errs = append(errs, models.FieldError{Field: "error_code", Message: "is required with error_message or details"})
+	} else if err := validation.ValidateErrorCode(req.ErrorCode); err != nil {
+		errs = append(errs, models.FieldError{Field: "error_code", Message: err.Error()})
+	}
+	if len(req.ErrorMessage) > maxErrorMessageLength {
+		errs = append(errs, models.FieldError{Field: "error_message", Message: fmt.Sprintf("must be at most %d characters", maxErrorMessageLength)})
+	}
+	if details, err := json.Marshal(req.Details); err != nil || len(details) > maxErrorDetailsBytes {
+		errs = append(errs, models.FieldError{Field: "details", Message: fmt.Sprintf("must be a JSON object of at most %d bytes", maxErrorDetailsBytes)})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &models.DeploymentFailure{Code: req.ErrorCode, Message: req.ErrorMessage, Details: req.Details}, nil
+}
+
+// validateImageDigest checks the image digest of a status update, which
+// only a deployed status may carry
+func validateImageDigest(req *models.StatusUpdateRequest) []models.FieldError {
+	switch {
+	case req.ImageDigest == "":
+		return nil
+	case req.Status != "deployed":
+		return []models.FieldError{{Field: "image_digest", Message: "may only be reported with status deployed"}}
+	}
+	if _, err := digest.Parse(req.ImageDigest); err != nil {
+		return []models.FieldError{{Field: "image_digest", Message: "must be a digest such as sha256:<hex>"}}
+	}
+	return nil
+}
+
+// validateDeploymentRequests validates and normalizes every request in a batch
+func (h *Handler) validateDeploymentRequests(reqs models.DeploymentPushRequest) []models.FieldError {
+	var errs []models.FieldError
+	for i := range reqs {
+		index := i
+		errs = append(errs, h.validateDeploymentRequest(&reqs[i], &index)...)
+	}
+	return errs
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+)
+
+// controllerAgent names the controller as the reporter of its own probes
+const controllerAgent = "controller"
+
+// RunVerification health checks the deployments agents reported deployed.
+// Within verify.window of being deployed each is probed at verify.health_url,
+// if set; agents may report probes too. Once the window has passed, a
+// deployment whose probes failed at most verify.max_failures times is
+// verified, and one with more failures, or no probes at all, is degraded.
+// With verify.rollback, deployments degraded by failed probes are rolled
+// back. Apps in maintenance are neither probed nor rolled back.
+func (h *Handler) RunVerification(ctx context.Context) error {
+	cfg := h.cfg.Verify
+	now := h.clock.Now()
+	deployments, err := h.db.ListVerifyingDeployments(ctx, now.Add(-cfg.Window))
+	if err != nil {
+		return err
+	}
+	maintenance, err := h.maintenanceApps(ctx)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, d := range deployments {
+		inMaintenance := maintenance[[2]string{d.Domain, d.AppName}]
+		if err := h.verifyDeployment(ctx, d, now, inMaintenance); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s/%s: %w", d.Domain, d.AppName, err)
+		}
+	}
+	return firstErr
+}
+
+// verifyDeployment probes a deployment under verification, or settles its
+// verification once the window has passed
+func (h *Handler) verifyDeployment(ctx context.Context, d models.Deployment, now time.Time, inMaintenance bool) error {
+	cfg := h.cfg.Verify
+	if d.DeployedAt == nil {
+		return nil
+	}
+	if d.Verification == "" {
+		if err := h.db.SetDeploymentVerification(ctx, d.ID, models.VerificationVerifying, ""); err != nil {
+			return err
+		}
+	}
+
+	end := d.DeployedAt.Add(cfg.Window)
+	if now.Before(end) {
+		if cfg.HealthURL == "" || inMaintenance {
+			return nil
+		}
+		healthy, latency := h.probeHealth(ctx, healthURL(cfg.HealthURL, d), cfg.Timeout)
+		return h.db.RecordHealthProbe(ctx, models.HealthProbe{
+			Domain:       d.Domain,
+			AppName:      d.AppName,
+			DeploymentID: &d.ID,
+			Healthy:      healthy,
+			Agent:        controllerAgent,
+			CheckedAt:    now,
+			LatencyMs:    latency,
+		})
+	}
+
+	total, unhealthy, err := h.db.CountDeploymentProbes(ctx, d.ID, *d.DeployedAt, end)
+	if err != nil {
+		return err
+	}
+
+	verification := models.VerificationVerified
+	if total == 0 || unhealthy > cfg.MaxFailures {
+		verification = models.VerificationDegraded
+	}
+	message := fmt.Sprintf("%s: %d of %d health probes failed within %s", verification, unhealthy, total, cfg.Window)
+	if total == 0 {
+		message = fmt.Sprintf("%s: no health probes within %s", verification, cfg.Window)
+	}
+	if err := h.db.SetDeploymentVerification(ctx, d.ID, verification, message); err != nil {
+		return err
+	}
+
+	metrics.DeploymentVerifications.WithLabelValues(verification).Inc()
+	if verification == models.VerificationDegraded {
+		h.logger.Warn("Deployment degraded after deploying",
+			"domain", d.Domain,
+			"app_name", d.AppName,
+			"deployment_id", d.ID,
+			"probes", total,
+			"failed_probes", unhealthy)
+
+		// Without probes there is no evidence against the deployment, so
+		// only failed probes roll it back
+		if cfg.Rollback && total > 0 && !inMaintenance {
+			if _, err := h.rollBack(ctx, d, "verification", message); err != nil {
+				h.logger.Warn("Not rolling back deployment", "reason", err, "deployment_id", d.ID)
+			}
+		}
+	} else {
+		h.logger.Info("Deployment verified",
+			"domain", d.Domain,
+			"app_name", d.AppName,
+			"deployment_id", d.ID,
+			"probes", total)
+	}
+	return nil
+}
+
+// healthURL expands a health check URL template for a deployment
+func healthURL(template string, d models.Deployment) string {
+	return strings.NewReplacer(
+		"{domain}", d.Domain,
+		"{app_name}", d.AppName,
+		"{port}", strconv.Itoa(d.Port),
+	).Replace(template)
+}
+
+// probeHealth reports whether a GET of url answers 2xx within the timeout,
+// and how many milliseconds the answer took; the latency is nil without one
+func (h *Handler) probeHealth(ctx context.Context, url string, timeout time.Duration) (bool, *float64) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, nil
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.logger.Debug("Health probe failed", "url", url, "error", err)
+		return false, nil
+	}
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300, &latency
+}
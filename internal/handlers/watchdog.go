@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+)
+
+// watchdogBatch caps how many deployments of each status one watchdog run
+// marks; the rest are marked on the next runs
+const watchdogBatch = 100
+
+// RunWatchdog marks the deployments stuck deploying or pending longer than
+// the watchdog thresholds as stalled, or fails them with watchdog.action
+// fail, and alerts on each one. It is run periodically by the watchdog
+// worker.
+func (h *Handler) RunWatchdog(ctx context.Context) error {
+	cfg := h.cfg.Watchdog
+	to := "stalled"
+	var failure *models.DeploymentFailure
+	if cfg.Action == "fail" {
+		to = "failed"
+	}
+
+	var firstErr error
+	for status, threshold := range map[string]time.Duration{"deploying": cfg.Deploying, "pending": cfg.Pending} {
+		if threshold <= 0 {
+			continue
+		}
+		if to == "failed" {
+			failure = &models.DeploymentFailure{
+				Code:    models.FailureStuck,
+				Message: fmt.Sprintf("no status update for %s while %s", formatWindow(threshold), status),
+			}
+		}
+
+		stuck, err := h.db.MarkStuckDeployments(ctx, status, h.clock.Now().Add(-threshold), to, failure, watchdogBatch)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		for _, d := range stuck {
+			metrics.StuckDeployments.WithLabelValues(status, cfg.Action).Inc()
+			h.logger.Warn("Deployment is stuck",
+				"id", d.ID,
+				"domain", d.Domain,
+				"app_name", d.AppName,
+				"version", d.Version,
+				"status", status,
+				"status_since", d.StatusSince,
+				"new_status", to)
+
+			if err := h.notifyStuckDeployment(ctx, d, to, threshold); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%s/%s: %w", d.Domain, d.AppName, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// notifyStuckDeployment queues a stuck deployment notification for delivery
+// to alerts.webhook_url, if set
+func (h *Handler) notifyStuckDeployment(ctx context.Context, d models.StuckDeployment, to string, threshold time.Duration) error {
+	url := h.cfg.Alerts.WebhookURL
+	if url == "" {
+		return nil
+	}
+
+	return h.enqueueWebhook(ctx, url, models.StuckDeploymentNotification{
+		Event:        "deployment_stuck",
+		DeploymentID: d.ID,
+		Domain:       d.Domain,
+		AppName:      d.AppName,
+		Version:      d.Version,
+		Status:       d.Status,
+		NewStatus:    to,
+		StatusSince:  d.StatusSince,
+		Threshold:    formatWindow(threshold),
+		At:           h.clock.Now().UTC(),
+	})
+}
@@ -0,0 +1,100 @@
+package imagepolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"deployment-controller/internal/models"
+)
+
+// Validate checks a policy's pattern for its kind
+func Validate(kind, pattern string) error {
+	switch kind {
+	case models.ImagePolicySemver:
+		if pattern == "" {
+			return fmt.Errorf("pattern is required for semver policies")
+		}
+		_, err := ParseRange(pattern)
+		return err
+	case models.ImagePolicyRegex:
+		if pattern == "" {
+			return fmt.Errorf("pattern is required for regex policies")
+		}
+		_, err := regexp.Compile(pattern)
+		return err
+	case models.ImagePolicyDigest:
+		if pattern != "" {
+			return fmt.Errorf("pattern is not used by digest policies")
+		}
+		return nil
+	}
+	return fmt.Errorf("kind must be one of: %s", strings.Join(models.ImagePolicyKinds, ", "))
+}
+
+// LatestTag returns the highest of tags selected by a semver or regex
+// policy, and whether it is newer than current. Semver policies order tags
+// as versions. Regex policies order by the first capture group, or the whole
+// tag without one, as versions when both parse as versions, as numbers when
+// both are numbers and alphabetically otherwise. A current tag the policy
+// does not select is always superseded.
+func LatestTag(policy models.ImagePolicy, current string, tags []string) (string, bool, error) {
+	var key func(tag string) (string, bool)
+	switch policy.Kind {
+	case models.ImagePolicySemver:
+		r, err := ParseRange(policy.Pattern)
+		if err != nil {
+			return "", false, err
+		}
+		key = func(tag string) (string, bool) {
+			v, ok := ParseVersion(tag)
+			return tag, ok && r.Contains(v)
+		}
+	case models.ImagePolicyRegex:
+		re, err := regexp.Compile(policy.Pattern)
+		if err != nil {
+			return "", false, err
+		}
+		key = func(tag string) (string, bool) {
+			m := re.FindStringSubmatch(tag)
+			switch {
+			case m == nil:
+				return "", false
+			case len(m) > 1:
+				return m[1], true
+			}
+			return tag, true
+		}
+	default:
+		return "", false, fmt.Errorf("%s policies do not select tags", policy.Kind)
+	}
+
+	best, bestKey := "", ""
+	for _, tag := range tags {
+		if k, ok := key(tag); ok && (best == "" || compareKeys(k, bestKey) > 0) {
+			best, bestKey = tag, k
+		}
+	}
+	if best == "" {
+		return "", false, nil
+	}
+
+	currentKey, ok := key(current)
+	return best, !ok || compareKeys(bestKey, currentKey) > 0, nil
+}
+
+// compareKeys orders two sort keys of tags
+func compareKeys(a, b string) int {
+	if va, ok := ParseVersion(a); ok {
+		if vb, ok := ParseVersion(b); ok {
+			return va.Compare(vb)
+		}
+	}
+	if na, err := strconv.ParseInt(a, 10, 64); err == nil {
+		if nb, err := strconv.ParseInt(b, 10, 64); err == nil {
+			return cmp(int(na), int(nb))
+		}
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,69 @@
+package imagepolicy
+
+import (
+	"testing"
+
+	"deployment-controller/internal/models"
+)
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{"^1.2.0", "1.9.3", true},
+		{"^1.2.0", "2.0.0", false},
+		{"~1.2.0", "1.2.9", true},
+		{"~1.2.0", "1.3.0", false},
+		{">=1.0.0 <2.0.0", "v1.5.0", true},
+		{"1.x", "1.4.0", true},
+		{"1.x", "1.4.0-rc.1", false},
+		{">=1.4.0-rc.0 <1.5.0", "1.4.0-rc.1", true},
+		{"<1.0.0 || >=3.0.0", "3.1.0", true},
+		{"<1.0.0 || >=3.0.0", "2.0.0", false},
+		{"*", "0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Fatalf("ParseRange(%q) failed: %v", tt.rng, err)
+		}
+		v, ok := ParseVersion(tt.version)
+		if !ok {
+			t.Fatalf("ParseVersion(%q) failed", tt.version)
+		}
+		if got := r.Contains(v); got != tt.want {
+			t.Errorf("%q contains %q = %v, want %v", tt.rng, tt.version, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRange(">=banana"); err == nil {
+		t.Error("Expected an invalid range to be rejected")
+	}
+}
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"1.9.0", "1.10.0", "2.0.0", "1.10.1-rc.1", "latest", "build-7", "build-12"}
+
+	tag, newer, err := LatestTag(models.ImagePolicy{Kind: models.ImagePolicySemver, Pattern: "^1.0.0"}, "1.9.0", tags)
+	if err != nil || tag != "1.10.0" || !newer {
+		t.Errorf("Expected 1.10.0 to be newer, got %q %v (%v)", tag, newer, err)
+	}
+
+	tag, newer, err = LatestTag(models.ImagePolicy{Kind: models.ImagePolicySemver, Pattern: "^1.0.0"}, "1.10.0", tags)
+	if err != nil || tag != "1.10.0" || newer {
+		t.Errorf("Expected 1.10.0 to be current, got %q %v (%v)", tag, newer, err)
+	}
+
+	tag, newer, err = LatestTag(models.ImagePolicy{Kind: models.ImagePolicyRegex, Pattern: `^build-(\d+)$`}, "latest", tags)
+	if err != nil || tag != "build-12" || !newer {
+		t.Errorf("Expected build-12 to be newer, got %q %v (%v)", tag, newer, err)
+	}
+
+	tag, _, err = LatestTag(models.ImagePolicy{Kind: models.ImagePolicyRegex, Pattern: `^release-`}, "latest", tags)
+	if err != nil || tag != "" {
+		t.Errorf("Expected no matching tag, got %q (%v)", tag, err)
+	}
+}
@@ -0,0 +1,236 @@
+package imagepolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version; build metadata is ignored
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseVersion parses a version such as 1.2.3, v1.2 or 2.0.0-rc.1. Missing
+// minor and patch numbers are zero.
+func ParseVersion(s string) (Version, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, _ := strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Version{}, false
+	}
+	nums := [3]int{}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return Version{}, false
+		}
+		nums[i] = n
+	}
+
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2], Pre: pre}, true
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, equal to or newer than o.
+// A prerelease is older than its release.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			return cmp(d[0], d[1])
+		}
+	}
+
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+
+	// Dot-separated identifiers compare numerically when both are numbers
+	a, b := strings.Split(v.Pre, "."), strings.Split(o.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		switch {
+		case errA == nil && errB == nil:
+			return cmp(na, nb)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return cmp(len(a), len(b))
+}
+
+func cmp(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparator is one bound of a range, such as >=1.2.0
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (c comparator) matches(v Version) bool {
+	n := v.Compare(c.version)
+	switch c.op {
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	}
+	return n == 0
+}
+
+// Range is a semver range: alternatives separated by ||, each a
+// space-separated list of bounds that must all hold
+type Range struct {
+	alternatives [][]comparator
+
+	// pre allows prereleases; they only match when the range itself names
+	// one
+	pre bool
+}
+
+// ParseRange parses ranges such as ">=1.2.0 <2", "^1.4", "~2.3.1", "1.x",
+// "1.2.*" or "*". Partial versions in a comparison are padded with zeros.
+func ParseRange(s string) (Range, error) {
+	var r Range
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(alt)
+		if len(fields) == 0 {
+			return Range{}, fmt.Errorf("empty range in %q", s)
+		}
+
+		var bounds []comparator
+		for _, field := range fields {
+			b, err := parseBound(field)
+			if err != nil {
+				return Range{}, err
+			}
+			for _, c := range b {
+				r.pre = r.pre || c.version.Pre != ""
+			}
+			bounds = append(bounds, b...)
+		}
+		r.alternatives = append(r.alternatives, bounds)
+	}
+	return r, nil
+}
+
+// parseBound expands one term of a range into comparators
+func parseBound(term string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op, term = prefix, term[len(prefix):]
+			break
+		}
+	}
+
+	// Wildcards and partial versions without an operator match the whole
+	// series they name
+	parts := strings.Split(strings.TrimPrefix(term, "v"), ".")
+	specified := 0
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		specified++
+	}
+	if specified == 0 {
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("invalid range term %q", op+term)
+		}
+		return nil, nil
+	}
+
+	v, ok := ParseVersion(strings.Join(parts[:specified], "."))
+	if !ok {
+		return nil, fmt.Errorf("invalid version %q in range", term)
+	}
+
+	switch op {
+	case "", "=":
+		if specified >= 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", bump(v, specified)}}, nil
+	case "~":
+		return []comparator{{">=", v}, {"<", bump(v, min(specified, 2))}}, nil
+	case "^":
+		// The first non-zero number may not change
+		level := 1
+		switch {
+		case v.Major == 0 && v.Minor == 0 && specified == 3:
+			level = 3
+		case v.Major == 0 && specified >= 2:
+			level = 2
+		}
+		return []comparator{{">=", v}, {"<", bump(v, level)}}, nil
+	}
+	return []comparator{{op, v}}, nil
+}
+
+// bump returns the lowest version after the series v names at level
+// (1 = major, 2 = minor, 3 = patch)
+func bump(v Version, level int) Version {
+	switch level {
+	case 1:
+		return Version{Major: v.Major + 1}
+	case 2:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	}
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// Contains reports whether v is in the range
+func (r Range) Contains(v Version) bool {
+	if v.Pre != "" && !r.pre {
+		return false
+	}
+	for _, bounds := range r.alternatives {
+		ok := true
+		for _, c := range bounds {
+			if !c.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
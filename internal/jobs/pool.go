@@ -0,0 +1,395 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"deployment-controller/internal/metrics"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Store is the persistence used by the worker pool
+type Store interface {
+	ClaimJob(ctx context.Context, types []string, lease time.Duration) (*models.Job, error)
+	RenewJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) error
+	UpdateJobProgress(ctx context.Context, id uuid.UUID, attempt, processed int) error
+	FinishJob(ctx context.Context, id uuid.UUID, attempt int, status string, result []byte, errMsg string, retryAfter time.Duration) (string, error)
+	RequeueJob(ctx context.Context, id uuid.UUID, attempt int) (string, error)
+}
+
+// Retry configures how failed jobs are retried before being dead-lettered
+type Retry struct {
+	// MaxAttempts is how many times a job runs before it is dead-lettered
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubled for each
+	// further attempt up to maxRetryBackoff
+	Backoff time.Duration
+}
+
+// maxRetryBackoff caps the delay between attempts of a failing job
+const maxRetryBackoff = time.Hour
+
+// delay returns the backoff before retrying a job that has run attempts times
+func (r Retry) delay(attempts int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// ProgressFunc reports how many items of a job have been processed so far
+type ProgressFunc func(processed int)
+
+// HandlerFunc performs a job. The returned result is stored as JSON on the
+// job; a non-nil error marks the job failed.
+type HandlerFunc func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error)
+
+// progressInterval throttles progress writes for large jobs
+const progressInterval = time.Second
+
+// errCancelled is the cause of a running job's context when an operator
+// cancels it
+var errCancelled = errors.New("cancelled by request")
+
+// errLeaseLost is the cause of a running job's context when another replica
+// has claimed it again, its lease having lapsed
+var errLeaseLost = errors.New("job lease lost")
+
+// Pool runs queued jobs. Each job type has its own workers, so a burst of
+// one type (say, webhook deliveries) cannot starve the others.
+type Pool struct {
+	store        Store
+	logger       *slog.Logger
+	workers      int
+	concurrency  map[string]int
+	pollInterval time.Duration
+	lease        time.Duration
+	retry        Retry
+
+	handlers map[string]HandlerFunc
+	wake     map[string]chan struct{}
+
+	// jobCtx is passed to running jobs; it outlives Run's context so jobs
+	// can finish while the pool drains, and is cancelled by Drain on timeout
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+	done       chan struct{}
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelCauseFunc
+}
+
+// NewPool creates a worker pool running up to workers jobs of each type at
+// once, or concurrency[type] where set, each under a lease renewed while it
+// runs; register handlers before calling Run
+func NewPool(store Store, logger *slog.Logger, workers int, concurrency map[string]int, pollInterval, lease time.Duration, retry Retry) *Pool {
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	return &Pool{
+		store:        store,
+		logger:       logger,
+		workers:      workers,
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+		lease:        lease,
+		retry:        retry,
+		handlers:     map[string]HandlerFunc{},
+		wake:         map[string]chan struct{}{},
+		jobCtx:       jobCtx,
+		cancelJobs:   cancelJobs,
+		done:         make(chan struct{}),
+		running:      map[uuid.UUID]context.CancelCauseFunc{},
+	}
+}
+
+// Register sets the handler for a job type
+func (p *Pool) Register(jobType string, handler HandlerFunc) {
+	p.handlers[jobType] = handler
+	p.wake[jobType] = make(chan struct{}, 1)
+}
+
+// Notify wakes an idle worker for jobType to look for queued jobs; an empty
+// or unknown type wakes one worker of every type
+func (p *Pool) Notify(jobType string) {
+	if wake, ok := p.wake[jobType]; ok {
+		signal(wake)
+		return
+	}
+	for _, wake := range p.wake {
+		signal(wake)
+	}
+}
+
+// Cancel cancels a job if this pool is running it; payload is the job ID as
+// sent on the jobs cancelled channel, and anything else is ignored
+func (p *Pool) Cancel(payload string) {
+	id, err := uuid.Parse(payload)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	cancel, ok := p.running[id]
+	p.mu.Unlock()
+
+	if ok {
+		p.logger.Info("Cancelling job", "job_id", id)
+		cancel(errCancelled)
+	}
+}
+
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and they have
+// finished their current jobs. Cancelling ctx stops new jobs from being
+// claimed; see Drain for bounding how long running jobs may take.
+func (p *Pool) Run(ctx context.Context) {
+	defer close(p.done)
+
+	types := make([]string, 0, len(p.handlers))
+	for jobType := range p.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+
+	var wg sync.WaitGroup
+	for _, jobType := range types {
+		workers := p.workers
+		if n, ok := p.concurrency[jobType]; ok && n > 0 {
+			workers = n
+		}
+
+		p.logger.Info("Starting job workers", "type", jobType, "workers", workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.work(ctx, jobType)
+			}()
+		}
+	}
+	wg.Wait()
+
+	p.logger.Info("Stopped job worker pool")
+}
+
+// Drain waits for workers to finish their current jobs once Run's context
+// has been cancelled. If ctx expires first, the running jobs are cancelled
+// and Drain waits for their outcome to be recorded.
+func (p *Pool) Drain(ctx context.Context) {
+	select {
+	case <-p.done:
+		return
+	case <-ctx.Done():
+	}
+
+	p.logger.Warn("Job drain timed out, cancelling running jobs")
+	p.cancelJobs()
+	<-p.done
+}
+
+// work claims and runs jobs of one type until ctx is cancelled, sleeping
+// when idle
+func (p *Pool) work(ctx context.Context, jobType string) {
+	types := []string{jobType}
+	for ctx.Err() == nil {
+		job, err := p.store.ClaimJob(ctx, types, p.lease)
+		if err != nil && ctx.Err() == nil {
+			p.logger.Error("Failed to claim job", "error", err, "type", jobType)
+		}
+
+		if job != nil {
+			p.run(job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake[jobType]:
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// run executes a single claimed job and records its outcome
+func (p *Pool) run(job *models.Job) {
+	ctx, cancel := context.WithCancelCause(p.jobCtx)
+	defer cancel(nil)
+
+	p.mu.Lock()
+	p.running[job.ID] = cancel
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, job.ID)
+		p.mu.Unlock()
+	}()
+
+	logger := p.logger.With("job_id", job.ID, "job_type", job.Type)
+	logger.Info("Running job", "total", job.Total, "attempt", job.Attempts)
+
+	var lastProgress time.Time
+	progress := func(processed int) {
+		if time.Since(lastProgress) < progressInterval {
+			return
+		}
+		lastProgress = time.Now()
+		err := p.store.UpdateJobProgress(ctx, job.ID, job.Attempts, processed)
+		switch {
+		case leaseLost(err):
+			cancel(errLeaseLost)
+		case err != nil:
+			logger.Warn("Failed to update job progress", "error", err)
+		}
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		p.heartbeat(heartbeatCtx, job, cancel, logger)
+	}()
+
+	var result interface{}
+	var err error
+	if job.CancelRequested {
+		// Claimed again after its replica died while it was being cancelled
+		cancel(errCancelled)
+		err = errCancelled
+	} else {
+		result, err = p.handlers[job.Type](ctx, job, progress)
+	}
+	stopHeartbeat()
+	<-heartbeatDone
+
+	// Another replica runs the job now and records its outcome
+	if errors.Is(context.Cause(ctx), errLeaseLost) {
+		logger.Warn("Job claimed again by another replica, dropping this run", "error", err)
+		return
+	}
+
+	// A job interrupted by shutdown is checkpointed back to the queue
+	// without using up an attempt, so a rolling restart never dead-letters it
+	if err != nil && ctx.Err() != nil && !errors.Is(context.Cause(ctx), errCancelled) {
+		p.requeue(ctx, job, logger)
+		return
+	}
+
+	// Failed jobs are queued again after a backoff until they run out of
+	// attempts, then dead-lettered for an operator to inspect and requeue
+	status := models.JobStatusSucceeded
+	errMsg := ""
+	var retryAfter time.Duration
+	if err != nil {
+		status = models.JobStatusQueued
+		errMsg = err.Error()
+		if errors.Is(context.Cause(ctx), errCancelled) {
+			status = models.JobStatusCancelled
+			errMsg = errCancelled.Error()
+		}
+		if status == models.JobStatusQueued {
+			if job.Attempts >= p.retry.MaxAttempts {
+				status = models.JobStatusDead
+			} else {
+				retryAfter = p.retry.delay(job.Attempts)
+			}
+		}
+	}
+
+	var body []byte
+	if result != nil {
+		var marshalErr error
+		if body, marshalErr = json.Marshal(result); marshalErr != nil {
+			logger.Error("Failed to encode job result", "error", marshalErr)
+		}
+	}
+
+	// Record the outcome even if we are shutting down
+	finishCtx, cancelFinish := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancelFinish()
+
+	status, err = p.store.FinishJob(finishCtx, job.ID, job.Attempts, status, body, errMsg, retryAfter)
+	if leaseLost(err) {
+		logger.Warn("Job claimed again by another replica, dropping this run's outcome", "error", errMsg)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to record job outcome", "error", err)
+		return
+	}
+
+	switch status {
+	case models.JobStatusQueued:
+		logger.Warn("Job failed, retrying", "error", errMsg, "attempt", job.Attempts, "retry_after", retryAfter)
+	case models.JobStatusDead:
+		metrics.JobsDeadLettered.WithLabelValues(job.Type).Inc()
+		logger.Error("Job dead-lettered", "error", errMsg, "attempts", job.Attempts)
+	default:
+		logger.Info("Finished job", "status", status, "error", errMsg)
+	}
+}
+
+// heartbeat renews a running job's lease every third of it until ctx is
+// done. Once another replica has claimed the job again the run is cancelled
+// with errLeaseLost; other failures are retried on the next beat, so the
+// lease only lapses if the store stays unreachable.
+func (p *Pool) heartbeat(ctx context.Context, job *models.Job, cancel context.CancelCauseFunc, logger *slog.Logger) {
+	ticker := time.NewTicker(p.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := p.store.RenewJobLease(ctx, job.ID, job.Attempts, p.lease)
+		switch {
+		case err == nil:
+		case leaseLost(err):
+			cancel(errLeaseLost)
+			return
+		case ctx.Err() == nil:
+			logger.Warn("Failed to renew job lease", "error", err)
+		}
+	}
+}
+
+// requeue records that a running job was interrupted by shutdown
+func (p *Pool) requeue(ctx context.Context, job *models.Job, logger *slog.Logger) {
+	requeueCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	status, err := p.store.RequeueJob(requeueCtx, job.ID, job.Attempts)
+	if leaseLost(err) {
+		logger.Warn("Job claimed again by another replica, not requeueing it")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to requeue interrupted job", "error", err)
+		return
+	}
+	logger.Warn("Job interrupted by shutdown", "status", status)
+}
+
+// leaseLost reports whether a store write failed because the job is no
+// longer running the attempt that made it: another replica claimed it again
+// after its lease lapsed, or it finished
+func leaseLost(err error) bool {
+	return err != nil && err.Error() == "job not found"
+}
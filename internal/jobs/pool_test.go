@@ -0,0 +1,327 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memStore is an in-memory Store; jobs finished as queued are requeued
+// without waiting for their backoff, and jobs in reclaimed have lost their
+// lease to another replica
+type memStore struct {
+	mu        sync.Mutex
+	queued    []*models.Job
+	jobs      map[uuid.UUID]*models.Job
+	finished  map[uuid.UUID]string
+	reclaimed map[uuid.UUID]bool
+}
+
+func (s *memStore) ClaimJob(ctx context.Context, types []string, lease time.Duration) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.queued {
+		for _, t := range types {
+			if job.Type == t {
+				s.queued = append(s.queued[:i], s.queued[i+1:]...)
+				job.Attempts++
+				return job, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *memStore) RenewJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reclaimed[id] {
+		return errors.New("job not found")
+	}
+	return nil
+}
+
+func (s *memStore) UpdateJobProgress(ctx context.Context, id uuid.UUID, attempt, processed int) error {
+	return nil
+}
+
+func (s *memStore) FinishJob(ctx context.Context, id uuid.UUID, attempt int, status string, result []byte, errMsg string, retryAfter time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reclaimed[id] {
+		return "", errors.New("job not found")
+	}
+	s.finished[id] = status
+	if status == models.JobStatusQueued {
+		s.queued = append(s.queued, s.jobs[id])
+	}
+	return status, nil
+}
+
+func (s *memStore) RequeueJob(ctx context.Context, id uuid.UUID, attempt int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reclaimed[id] {
+		return "", errors.New("job not found")
+	}
+	job := s.jobs[id]
+	job.Attempts--
+	s.finished[id] = models.JobStatusQueued
+	s.queued = append(s.queued, job)
+	return models.JobStatusQueued, nil
+}
+
+func newMemStore(jobs ...*models.Job) *memStore {
+	store := &memStore{jobs: map[uuid.UUID]*models.Job{}, finished: map[uuid.UUID]string{}, reclaimed: map[uuid.UUID]bool{}}
+	for _, job := range jobs {
+		store.queued = append(store.queued, job)
+		store.jobs[job.ID] = job
+	}
+	return store
+}
+
+func newTestPool(store *memStore, concurrency map[string]int) *Pool {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewPool(store, logger, 1, concurrency, 10*time.Millisecond, 30*time.Millisecond, Retry{MaxAttempts: 2, Backoff: time.Second})
+}
+
+func TestPoolPerTypeConcurrency(t *testing.T) {
+	var queued []*models.Job
+	for i := 0; i < 6; i++ {
+		queued = append(queued, &models.Job{ID: uuid.New(), Type: "slow"})
+	}
+	queued = append(queued, &models.Job{ID: uuid.New(), Type: "fast"})
+	store := newMemStore(queued...)
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+
+	pool := newTestPool(store, map[string]int{"slow": 3})
+	pool.Register("slow", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, nil
+	})
+	pool.Register("fast", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		close(fastDone)
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+
+	// The fast job must not wait behind the blocked slow ones
+	select {
+	case <-fastDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the fast job to run while slow jobs are blocked")
+	}
+
+	close(release)
+	cancel()
+	pool.Drain(context.Background())
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 slow jobs at once, got %d", peak)
+	}
+}
+
+func TestPoolDrainCancelsAfterTimeout(t *testing.T) {
+	job := &models.Job{ID: uuid.New(), Type: "stuck"}
+	store := newMemStore(job)
+
+	started := make(chan struct{})
+	pool := newTestPool(store, nil)
+	pool.Register("stuck", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+	<-started
+
+	// Cancelling Run's context alone must not interrupt the running job
+	cancel()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelDrain()
+	pool.Drain(drainCtx)
+
+	// The interrupted job is queued for another replica rather than lost,
+	// and the interrupted run does not count as an attempt
+	if status := store.finished[job.ID]; status != models.JobStatusQueued {
+		t.Errorf("Expected the interrupted job to be requeued, got %q", status)
+	}
+	if job.Attempts != 0 {
+		t.Errorf("Expected the interrupted run not to use up an attempt, got %d attempts", job.Attempts)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	job := &models.Job{ID: uuid.New(), Type: "stuck"}
+	store := newMemStore(job)
+
+	started := make(chan struct{})
+	pool := newTestPool(store, nil)
+	pool.Register("stuck", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+	<-started
+
+	// Unknown IDs and reconnect notifications are ignored
+	pool.Cancel("")
+	pool.Cancel(uuid.NewString())
+	pool.Cancel(job.ID.String())
+
+	cancel()
+	pool.Drain(context.Background())
+
+	if status := store.finished[job.ID]; status != models.JobStatusCancelled {
+		t.Errorf("Expected the job to be marked cancelled, got %q", status)
+	}
+}
+
+func TestPoolLeaseLost(t *testing.T) {
+	job := &models.Job{ID: uuid.New(), Type: "stuck"}
+	store := newMemStore(job)
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	pool := newTestPool(store, nil)
+	pool.Register("stuck", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- context.Cause(ctx)
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+	<-started
+
+	// Another replica claims the job once its lease has lapsed
+	store.mu.Lock()
+	store.reclaimed[job.ID] = true
+	store.mu.Unlock()
+
+	select {
+	case cause := <-stopped:
+		if !errors.Is(cause, errLeaseLost) {
+			t.Errorf("Expected the run to be stopped for losing its lease, got %v", cause)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the run to stop once its lease could not be renewed")
+	}
+	cancel()
+	pool.Drain(context.Background())
+
+	// The replica now running the job records its outcome, not this one
+	if status, ok := store.finished[job.ID]; ok {
+		t.Errorf("Expected no outcome recorded for the dropped run, got %q", status)
+	}
+}
+
+func TestPoolReclaimedCancelledJob(t *testing.T) {
+	job := &models.Job{ID: uuid.New(), Type: "export", CancelRequested: true}
+	store := newMemStore(job)
+
+	pool := newTestPool(store, nil)
+	pool.Register("export", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		t.Error("Expected a job already asked to stop not to run again")
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.Lock()
+		status := store.finished[job.ID]
+		store.mu.Unlock()
+		if status != "" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	pool.Drain(context.Background())
+
+	if status := store.finished[job.ID]; status != models.JobStatusCancelled {
+		t.Errorf("Expected the job to be recorded cancelled, got %q", status)
+	}
+}
+
+func TestPoolDeadLetter(t *testing.T) {
+	job := &models.Job{ID: uuid.New(), Type: "broken"}
+	store := newMemStore(job)
+
+	var mu sync.Mutex
+	runs := 0
+	dead := make(chan struct{})
+	pool := newTestPool(store, nil)
+	pool.Register("broken", func(ctx context.Context, job *models.Job, progress ProgressFunc) (interface{}, error) {
+		mu.Lock()
+		runs++
+		if runs == 2 {
+			close(dead)
+		}
+		mu.Unlock()
+		return nil, errors.New("registry unreachable")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pool.Run(ctx)
+
+	select {
+	case <-dead:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the failing job to be retried")
+	}
+	cancel()
+	pool.Drain(context.Background())
+
+	if runs != 2 {
+		t.Errorf("Expected 2 attempts, got %d", runs)
+	}
+	if status := store.finished[job.ID]; status != models.JobStatusDead {
+		t.Errorf("Expected the job to be dead-lettered, got %q", status)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	retry := Retry{MaxAttempts: 10, Backoff: 30 * time.Second}
+	for attempts, expected := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		20: maxRetryBackoff,
+	} {
+		if delay := retry.delay(attempts); delay != expected {
+			t.Errorf("Expected delay %s after %d attempts, got %s", expected, attempts, delay)
+		}
+	}
+}
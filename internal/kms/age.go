@@ -0,0 +1,70 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// AgeWrapper wraps data keys with age, for deployments without a cloud KMS.
+// The identity should live on a tmpfs or hardware-backed mount rather than
+// the controller's disk.
+type AgeWrapper struct {
+	recipient  age.Recipient
+	identities []age.Identity
+}
+
+// NewAgeWrapper creates a wrapper from an identity file. recipient may be
+// empty when the file holds a single X25519 identity.
+func NewAgeWrapper(recipient, identityFile string) (*AgeWrapper, error) {
+	f, err := os.Open(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age identity file: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity file: %w", err)
+	}
+
+	w := &AgeWrapper{identities: identities}
+	if recipient != "" {
+		if w.recipient, err = age.ParseX25519Recipient(recipient); err != nil {
+			return nil, fmt.Errorf("invalid age recipient: %w", err)
+		}
+	} else if identity, ok := identities[0].(*age.X25519Identity); ok && len(identities) == 1 {
+		w.recipient = identity.Recipient()
+	} else {
+		return nil, fmt.Errorf("key_id must name the age recipient")
+	}
+
+	return w, nil
+}
+
+func (w *AgeWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := age.Encrypt(&buf, w.recipient)
+	if err != nil {
+		return nil, fmt.Errorf("age encrypt failed: %w", err)
+	}
+	if _, err := writer.Write(dataKey); err != nil {
+		return nil, fmt.Errorf("age encrypt failed: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("age encrypt failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *AgeWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	reader, err := age.Decrypt(bytes.NewReader(wrapped), w.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("age decrypt failed: %w", err)
+	}
+	return io.ReadAll(reader)
+}
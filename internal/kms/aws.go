@@ -0,0 +1,42 @@
+package kms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// awsAPI is the subset of the AWS KMS client used here
+type awsAPI interface {
+	Encrypt(ctx context.Context, params *awskms.EncryptInput, optFns ...func(*awskms.Options)) (*awskms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *awskms.DecryptInput, optFns ...func(*awskms.Options)) (*awskms.DecryptOutput, error)
+}
+
+// AWSWrapper wraps data keys with an AWS KMS key
+type AWSWrapper struct {
+	client awsAPI
+	keyID  string
+}
+
+// NewAWSWrapper creates a wrapper for the KMS key ID, ARN or alias
+func NewAWSWrapper(cfg aws.Config, keyID string) *AWSWrapper {
+	return &AWSWrapper{client: awskms.NewFromConfig(cfg), keyID: keyID}
+}
+
+func (w *AWSWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	out, err := w.client.Encrypt(ctx, &awskms.EncryptInput{KeyId: aws.String(w.keyID), Plaintext: dataKey})
+	if err != nil {
+		return nil, fmt.Errorf("aws kms encrypt failed: %w", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (w *AWSWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	out, err := w.client.Decrypt(ctx, &awskms.DecryptInput{KeyId: aws.String(w.keyID), CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("aws kms decrypt failed: %w", err)
+	}
+	return out.Plaintext, nil
+}
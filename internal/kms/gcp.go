@@ -0,0 +1,84 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2/google"
+)
+
+// gcpEndpoint is the Cloud KMS REST API
+const gcpEndpoint = "https://cloudkms.googleapis.com"
+
+// GCPWrapper wraps data keys with a Cloud KMS symmetric key, authenticating
+// with Application Default Credentials
+type GCPWrapper struct {
+	client   *http.Client
+	endpoint string
+	keyName  string
+}
+
+// NewGCPWrapper creates a wrapper for a key named
+// projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>
+func NewGCPWrapper(ctx context.Context, keyName string) (*GCPWrapper, error) {
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloudkms")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GCP credentials: %w", err)
+	}
+	return &GCPWrapper{client: client, endpoint: gcpEndpoint, keyName: keyName}, nil
+}
+
+func (w *GCPWrapper) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	if err := w.call(ctx, "encrypt", map[string][]byte{"plaintext": dataKey}, &out); err != nil {
+		return nil, err
+	}
+	return out.Ciphertext, nil
+}
+
+func (w *GCPWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := w.call(ctx, "decrypt", map[string][]byte{"ciphertext": wrapped}, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// call invokes a cryptoKeys method; []byte fields travel as base64 in JSON
+func (w *GCPWrapper) call(ctx context.Context, method string, in map[string][]byte, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	url := w.endpoint + "/v1/" + w.keyName + ":" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcp kms %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("gcp kms %s failed: %s: %s", method, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gcp kms %s: invalid response: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"deployment-controller/internal/awssecrets"
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/secrets"
+)
+
+// Wrapper encrypts (wraps) and decrypts (unwraps) data keys with a master
+// key that never leaves the key management service
+type Wrapper interface {
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// New creates the wrapper for the configured provider
+func New(ctx context.Context, cfg config.KMSConfig) (Wrapper, error) {
+	switch cfg.Provider {
+	case "aws":
+		awsCfg, err := awssecrets.LoadConfig(ctx, cfg.Region)
+		if err != nil {
+			return nil, err
+		}
+		return NewAWSWrapper(awsCfg, cfg.KeyID), nil
+	case "gcp":
+		return NewGCPWrapper(ctx, cfg.KeyID)
+	case "age":
+		return NewAgeWrapper(cfg.KeyID, cfg.AgeIdentityFile)
+	default:
+		return nil, fmt.Errorf("unsupported KMS provider %q: must be aws, gcp or age", cfg.Provider)
+	}
+}
+
+// UnwrapDataKeys unwraps the configured data keys, newest first
+func UnwrapDataKeys(ctx context.Context, wrapper Wrapper, dataKeys []config.DataKeyConfig) ([]secrets.DataKey, error) {
+	keys := make([]secrets.DataKey, 0, len(dataKeys))
+	for _, dataKey := range dataKeys {
+		wrapped, err := base64.StdEncoding.DecodeString(dataKey.Wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("data key %q: wrapped key must be base64: %w", dataKey.ID, err)
+		}
+
+		key, err := wrapper.Unwrap(ctx, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("data key %q: %w", dataKey.ID, err)
+		}
+		keys = append(keys, secrets.DataKey{ID: dataKey.ID, Key: key})
+	}
+	return keys, nil
+}
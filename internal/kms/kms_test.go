@@ -0,0 +1,112 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deployment-controller/internal/config"
+
+	"filippo.io/age"
+	awskms "github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// testWrap round-trips a data key through a wrapper
+func testWrap(t *testing.T, w Wrapper) {
+	t.Helper()
+
+	dataKey := []byte("0123456789abcdef0123456789ABCDEF")
+	wrapped, err := w.Wrap(context.Background(), dataKey)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Fatalf("Wrapped key contains the plaintext key")
+	}
+
+	keys, err := UnwrapDataKeys(context.Background(), w, []config.DataKeyConfig{
+		{ID: "k1", Wrapped: base64.StdEncoding.EncodeToString(wrapped)},
+	})
+	if err != nil {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != "k1" || !bytes.Equal(keys[0].Key, dataKey) {
+		t.Errorf("Unexpected data keys: %+v", keys)
+	}
+}
+
+func TestAgeWrapper(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "age.key")
+	if err := os.WriteFile(path, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewAgeWrapper("", path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testWrap(t, w)
+
+	if _, err := NewAgeWrapper("not-a-recipient", path); err == nil {
+		t.Errorf("Expected error for an invalid recipient")
+	}
+}
+
+// fakeAWSKMS "encrypts" by reversing the bytes
+type fakeAWSKMS struct{}
+
+func reversed(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+func (fakeAWSKMS) Encrypt(ctx context.Context, in *awskms.EncryptInput, _ ...func(*awskms.Options)) (*awskms.EncryptOutput, error) {
+	return &awskms.EncryptOutput{CiphertextBlob: append([]byte("wrapped:"), reversed(in.Plaintext)...)}, nil
+}
+
+func (fakeAWSKMS) Decrypt(ctx context.Context, in *awskms.DecryptInput, _ ...func(*awskms.Options)) (*awskms.DecryptOutput, error) {
+	return &awskms.DecryptOutput{Plaintext: reversed(bytes.TrimPrefix(in.CiphertextBlob, []byte("wrapped:")))}, nil
+}
+
+func TestAWSWrapper(t *testing.T) {
+	testWrap(t, &AWSWrapper{client: fakeAWSKMS{}, keyID: "alias/controller"})
+}
+
+func TestGCPWrapper(t *testing.T) {
+	const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string][]byte
+		json.NewDecoder(r.Body).Decode(&in)
+
+		switch r.URL.Path {
+		case "/v1/" + keyName + ":encrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": reversed(in["plaintext"])})
+		case "/v1/" + keyName + ":decrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"plaintext": reversed(in["ciphertext"])})
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	testWrap(t, &GCPWrapper{client: server.Client(), endpoint: server.URL, keyName: keyName})
+
+	bad := &GCPWrapper{client: server.Client(), endpoint: server.URL, keyName: "projects/other"}
+	if _, err := bad.Wrap(context.Background(), []byte("key")); err == nil {
+		t.Errorf("Expected error for an unknown key")
+	}
+}
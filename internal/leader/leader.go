@@ -0,0 +1,165 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/models"
+)
+
+// LeaseName is the lease held by the leader
+const LeaseName = "leader"
+
+// Store is the persistence used by the elector
+type Store interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*models.Lease, bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Elector campaigns for the leader lease on behalf of one controller
+// instance. The leader runs the background subsystems; followers serve the
+// API as usual and leave background work to the leader.
+type Elector struct {
+	store  Store
+	logger *slog.Logger
+	id     string
+	ttl    time.Duration
+	clock  clock.Clock
+
+	mu sync.RWMutex
+
+	// leaderUntil is when our lease expires as far as we know; we stop
+	// acting as leader then even if renewing fails, before another
+	// instance can take over
+	leaderUntil time.Time
+
+	// done is closed when Run returns, after the lease has been released
+	done chan struct{}
+}
+
+// New creates an elector for the instance id holding leases for ttl
+func New(store Store, logger *slog.Logger, id string, ttl time.Duration) *Elector {
+	return &Elector{
+		store:  store,
+		logger: logger,
+		id:     id,
+		ttl:    ttl,
+		clock:  clock.Real,
+		done:   make(chan struct{}),
+	}
+}
+
+// SetClock sets the clock the lease expiry is measured with
+func (e *Elector) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// ID returns the instance ID the elector campaigns as
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this instance currently holds the leader lease
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.clock.Now().Before(e.leaderUntil)
+}
+
+// Run campaigns for and renews the leader lease every third of its TTL until
+// ctx is cancelled, then releases it so another instance can take over
+// without waiting for it to expire
+func (e *Elector) Run(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	e.logger.Info("Starting leader election", "instance_id", e.id, "lease_ttl", e.ttl)
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.Release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wait blocks until Run has returned and released the lease, or ctx expires
+func (e *Elector) Wait(ctx context.Context) {
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		e.logger.Warn("Timed out waiting to release leader lease", "instance_id", e.id)
+	}
+}
+
+// campaign tries once to take or renew the lease
+func (e *Elector) campaign(ctx context.Context) {
+	start := e.clock.Now()
+	wasLeader := e.IsLeader()
+
+	lease, held, err := e.store.AcquireLease(ctx, LeaseName, e.id, e.ttl)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Error("Failed to renew leader lease", "error", err, "instance_id", e.id)
+		}
+		return
+	}
+
+	e.mu.Lock()
+	if held {
+		// Measured from before the request, so we never outlive the lease
+		e.leaderUntil = start.Add(e.ttl)
+	} else {
+		e.leaderUntil = time.Time{}
+	}
+	e.mu.Unlock()
+
+	switch {
+	case held && !wasLeader:
+		e.logger.Info("Became leader", "instance_id", e.id)
+	case !held && wasLeader:
+		e.logger.Warn("Lost leadership", "instance_id", e.id)
+	case !held && lease != nil:
+		e.logger.Debug("Following leader", "instance_id", e.id, "leader", lease.Holder)
+	}
+}
+
+// Release gives up leadership, if held, and releases the lease
+func (e *Elector) Release() {
+	e.mu.Lock()
+	wasLeader := e.clock.Now().Before(e.leaderUntil)
+	e.leaderUntil = time.Time{}
+	e.mu.Unlock()
+
+	if !wasLeader {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.store.ReleaseLease(ctx, LeaseName, e.id); err != nil {
+		e.logger.Error("Failed to release leader lease", "error", err, "instance_id", e.id)
+		return
+	}
+	e.logger.Info("Released leadership", "instance_id", e.id)
+}
+
+// LeaderOnly wraps a periodic task so it only runs while this instance is
+// the leader; followers skip it
+func (e *Elector) LeaderOnly(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !e.IsLeader() {
+			return nil
+		}
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/models"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	lease *models.Lease
+}
+
+func (s *memStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*models.Lease, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	if s.lease == nil || s.lease.Holder == holder || s.lease.ExpiresAt.Before(now) {
+		s.lease = &models.Lease{Name: name, Holder: holder, RenewedAt: now, ExpiresAt: now.Add(ttl)}
+		return s.lease, true, nil
+	}
+	return s.lease, false, nil
+}
+
+func (s *memStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease != nil && s.lease.Holder == holder {
+		s.lease = nil
+	}
+	return nil
+}
+
+func TestElectorFailover(t *testing.T) {
+	store := &memStore{clock: clock.Real}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	first := New(store, logger, "first", time.Minute)
+	second := New(store, logger, "second", time.Minute)
+
+	ctx := context.Background()
+	first.campaign(ctx)
+	second.campaign(ctx)
+
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("Expected only the first instance to lead, got first=%v second=%v", first.IsLeader(), second.IsLeader())
+	}
+
+	ran := false
+	task := second.LeaderOnly(func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	task(ctx)
+	if ran {
+		t.Error("Expected a follower to skip leader-only tasks")
+	}
+
+	// Releasing hands over leadership without waiting for the lease to expire
+	first.Release()
+	second.campaign(ctx)
+
+	if first.IsLeader() || !second.IsLeader() {
+		t.Fatalf("Expected the second instance to take over, got first=%v second=%v", first.IsLeader(), second.IsLeader())
+	}
+
+	task(ctx)
+	if !ran {
+		t.Error("Expected the leader to run leader-only tasks")
+	}
+}
+
+func TestElectorLeaseExpiry(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := &memStore{clock: clk}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	first := New(store, logger, "first", time.Minute)
+	first.SetClock(clk)
+	second := New(store, logger, "second", time.Minute)
+	second.SetClock(clk)
+
+	ctx := context.Background()
+	first.campaign(ctx)
+	clk.Advance(59 * time.Second)
+	second.campaign(ctx)
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("Expected the first instance to lead until its lease expires, got first=%v second=%v", first.IsLeader(), second.IsLeader())
+	}
+
+	// Without renewing, the first instance steps down when its lease expires
+	clk.Advance(2 * time.Second)
+	if first.IsLeader() {
+		t.Error("Expected the first instance to stop leading once its lease expired")
+	}
+	second.campaign(ctx)
+	if !second.IsLeader() {
+		t.Error("Expected the second instance to take over the expired lease")
+	}
+}
@@ -0,0 +1,239 @@
+// Package localpg runs a PostgreSQL server from the binaries installed on
+// the machine, in a data directory of its own, so the controller can run
+// against a real database on a laptop or in CI without docker.
+package localpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"deployment-controller/db"
+	"deployment-controller/internal/config"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// user is the superuser initdb creates; the server trusts local
+// connections, so it has no password
+const user = "postgres"
+
+// startupTimeout bounds how long the server may take to accept connections
+const startupTimeout = 30 * time.Second
+
+// stopTimeout bounds how long a fast shutdown may take before the server is
+// killed
+const stopTimeout = 30 * time.Second
+
+// Server is a running PostgreSQL server
+type Server struct {
+	cmd    *exec.Cmd
+	port   int
+	logger *slog.Logger
+
+	// exited is closed once the server process has exited
+	exited chan struct{}
+}
+
+// Start initializes the data directory of dbCfg.Local if it is new, starts
+// the server and creates the database dbCfg.Name, applying the schema, if
+// it doesn't exist yet
+func Start(ctx context.Context, dbCfg config.DatabaseConfig, logger *slog.Logger) (*Server, error) {
+	cfg := dbCfg.Local
+
+	// PostgreSQL refuses to run as root, so fail with a clearer message
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("local postgres cannot run as root")
+	}
+
+	initdb, err := findBinary(cfg.BinDir, "initdb")
+	if err != nil {
+		return nil, err
+	}
+	postgres, err := findBinary(cfg.BinDir, "postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir, err := filepath.Abs(cfg.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local postgres data_dir: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "PG_VERSION")); errors.Is(err, os.ErrNotExist) {
+		logger.Info("Initializing local postgres data directory", "data_dir", dataDir)
+		if err := os.MkdirAll(dataDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create local postgres data_dir: %w", err)
+		}
+		out, err := exec.CommandContext(ctx, initdb, "-D", dataDir, "-U", user, "-A", "trust", "-E", "UTF8", "--no-locale").CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("initdb failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dataDir, "postgres.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local postgres log: %w", err)
+	}
+	defer logFile.Close()
+
+	// Only TCP on loopback: no Unix socket, whose path length is limited.
+	// Connections leave room for psql beside a full pool.
+	cmd := exec.Command(postgres, "-D", dataDir, "-p", strconv.Itoa(cfg.Port),
+		"-c", "listen_addresses=127.0.0.1", "-c", "unix_socket_directories=",
+		"-c", "max_connections="+strconv.Itoa(dbCfg.MaxConns+10))
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	// In its own process group, so a Ctrl+C reaches only the controller,
+	// which stops the server once it has shut down
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start local postgres: %w", err)
+	}
+
+	s := &Server{cmd: cmd, port: cfg.Port, logger: logger, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(s.exited)
+	}()
+	logger.Info("Started local postgres", "data_dir", dataDir, "port", cfg.Port, "pid", cmd.Process.Pid)
+
+	if err := s.createDatabase(ctx, dbCfg.Name); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("%w; see %s", err, logFile.Name())
+	}
+	return s, nil
+}
+
+// Configure points the database config at the server
+func (s *Server) Configure(cfg *config.DatabaseConfig) {
+	cfg.Host, cfg.Port, cfg.User, cfg.Password = "127.0.0.1", s.port, user, ""
+}
+
+// Stop shuts the server down, killing it if a fast shutdown takes too long
+func (s *Server) Stop() {
+	// SIGINT is PostgreSQL's fast shutdown: clients are disconnected and
+	// the server checkpoints and exits
+	if err := s.cmd.Process.Signal(os.Interrupt); err != nil {
+		select {
+		case <-s.exited:
+			return
+		default:
+		}
+		s.logger.Error("Failed to stop local postgres", "error", err)
+	}
+
+	select {
+	case <-s.exited:
+		s.logger.Info("Stopped local postgres")
+	case <-time.After(stopTimeout):
+		s.logger.Warn("Local postgres did not stop in time, killing it")
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
+
+// createDatabase waits for the server to accept connections, then creates
+// the database and applies the schema unless it already exists
+func (s *Server) createDatabase(ctx context.Context, name string) error {
+	conn, err := s.connect(ctx, "postgres")
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up database %s: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	created, err := s.connect(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer created.Close(ctx)
+
+	// Without arguments the schema is sent over the simple protocol, which
+	// runs every statement in it
+	if _, err := created.Exec(ctx, db.Schema); err != nil {
+		// Dropped so the next start retries instead of finding an
+		// existing, empty database
+		created.Close(ctx)
+		if _, dropErr := conn.Exec(ctx, "DROP DATABASE "+pgx.Identifier{name}.Sanitize()); dropErr != nil {
+			s.logger.Error("Failed to drop database after applying the schema failed", "database", name, "error", dropErr)
+		}
+		return fmt.Errorf("failed to apply schema to %s: %w", name, err)
+	}
+	s.logger.Info("Created database with schema applied", "database", name)
+	return nil
+}
+
+// connect connects to database on the server, retrying until it accepts
+// connections
+func (s *Server) connect(ctx context.Context, database string) (*pgx.Conn, error) {
+	url := fmt.Sprintf("postgres://%s@127.0.0.1:%d/%s?sslmode=disable", user, s.port, database)
+
+	ctx, cancel := context.WithTimeout(ctx, startupTimeout)
+	defer cancel()
+	for {
+		conn, err := pgx.Connect(ctx, url)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-s.exited:
+			return nil, fmt.Errorf("local postgres exited during startup")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("local postgres did not accept connections: %w", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// findBinary finds a PostgreSQL binary in binDir if set, otherwise on the
+// PATH or in the newest /usr/lib/postgresql/<version>/bin
+func findBinary(binDir, name string) (string, error) {
+	if binDir != "" {
+		path := filepath.Join(binDir, name)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("%s not found in local postgres bin_dir: %w", name, err)
+		}
+		return path, nil
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+
+	// Debian and Ubuntu keep the server binaries off the PATH
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	slices.SortFunc(dirs, func(a, b string) int {
+		return majorVersion(b) - majorVersion(a)
+	})
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found: install PostgreSQL or set database.local.bin_dir", name)
+}
+
+// majorVersion parses the version out of /usr/lib/postgresql/<version>/bin
+func majorVersion(binDir string) int {
+	version, _ := strconv.Atoi(filepath.Base(filepath.Dir(binDir)))
+	return version
+}
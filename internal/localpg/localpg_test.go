@@ -0,0 +1,76 @@
+package localpg
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deployment-controller/internal/config"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestFindBinaryInBinDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "initdb"), nil, 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if path, err := findBinary(dir, "initdb"); err != nil || path != filepath.Join(dir, "initdb") {
+		t.Errorf("Expected initdb in the bin dir, got %q: %v", path, err)
+	}
+	if _, err := findBinary(dir, "postgres"); err == nil {
+		t.Error("Expected an error for a binary missing from the bin dir")
+	}
+}
+
+func TestMajorVersion(t *testing.T) {
+	if v := majorVersion("/usr/lib/postgresql/15/bin"); v != 15 {
+		t.Errorf("Expected version 15, got %d", v)
+	}
+}
+
+// TestStart runs a server from the installed binaries; it is skipped when
+// PostgreSQL isn't installed or the test runs as root
+func TestStart(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("PostgreSQL cannot run as root")
+	}
+	if _, err := findBinary("", "postgres"); err != nil {
+		t.Skip(err)
+	}
+
+	cfg := config.DatabaseConfig{
+		Name:     "deployment_controller",
+		MaxConns: 10,
+		Local:    config.LocalPostgresConfig{DataDir: t.TempDir(), Port: 55433},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	// The second start reuses the data directory and the database
+	for i := 0; i < 2; i++ {
+		server, err := Start(ctx, cfg, logger)
+		if err != nil {
+			t.Fatalf("Start %d: unexpected error: %v", i, err)
+		}
+
+		dbCfg := cfg
+		server.Configure(&dbCfg)
+		conn, err := pgx.Connect(ctx, (&config.Config{Database: dbCfg}).GetDatabaseURL())
+		if err != nil {
+			server.Stop()
+			t.Fatalf("Start %d: unexpected error: %v", i, err)
+		}
+		var tables int
+		err = conn.QueryRow(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_name = 'deployments'").Scan(&tables)
+		conn.Close(ctx)
+		server.Stop()
+		if err != nil || tables != 1 {
+			t.Fatalf("Start %d: expected the schema to be applied, got %d tables: %v", i, tables, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package logstream
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Hub wakes the log streams of a deployment when chunks are appended to its
+// log. It carries no log content: woken streams read the new chunks from the
+// database, so a Hub fed by a LISTEN/NOTIFY subscription serves streams for
+// uploads made to any replica.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+// New creates an empty hub
+func New() *Hub {
+	return &Hub{subs: map[uuid.UUID]map[chan struct{}]struct{}{}}
+}
+
+// Subscribe returns a channel that receives a value after chunks are
+// appended to the deployment's log, and a function that unsubscribes it.
+// Wakeups coalesce, so a slow reader sees at most one pending value.
+func (h *Hub) Subscribe(deploymentID uuid.UUID) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subs[deploymentID] == nil {
+		h.subs[deploymentID] = map[chan struct{}]struct{}{}
+	}
+	h.subs[deploymentID][wake] = struct{}{}
+	h.mu.Unlock()
+
+	return wake, func() {
+		h.mu.Lock()
+		delete(h.subs[deploymentID], wake)
+		if len(h.subs[deploymentID]) == 0 {
+			delete(h.subs, deploymentID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Notify wakes the streams of the deployment whose ID is payload, as sent on
+// the deployment logs channel; an empty or invalid payload wakes every
+// stream, since notifications may have been missed
+func (h *Hub) Notify(payload string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if id, err := uuid.Parse(payload); err == nil {
+		for wake := range h.subs[id] {
+			signal(wake)
+		}
+		return
+	}
+	for _, subs := range h.subs {
+		for wake := range subs {
+			signal(wake)
+		}
+	}
+}
+
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,48 @@
+package logstream
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func woken(wake <-chan struct{}) bool {
+	select {
+	case <-wake:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestHubNotify(t *testing.T) {
+	hub := New()
+	a, b := uuid.New(), uuid.New()
+
+	wakeA, unsubscribeA := hub.Subscribe(a)
+	wakeB, unsubscribeB := hub.Subscribe(b)
+	defer unsubscribeB()
+
+	hub.Notify(a.String())
+	hub.Notify(a.String())
+	if !woken(wakeA) || woken(wakeA) {
+		t.Error("Expected one coalesced wakeup for the notified deployment")
+	}
+	if woken(wakeB) {
+		t.Error("Expected other deployments' streams to stay asleep")
+	}
+
+	hub.Notify("")
+	if !woken(wakeA) || !woken(wakeB) {
+		t.Error("Expected an empty payload to wake every stream")
+	}
+
+	unsubscribeA()
+	hub.Notify(a.String())
+	if woken(wakeA) {
+		t.Error("Expected no wakeups after unsubscribing")
+	}
+	if len(hub.subs) != 1 {
+		t.Errorf("Expected only the subscribed deployment to be tracked, got %d", len(hub.subs))
+	}
+}
@@ -0,0 +1,77 @@
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"deployment-controller/internal/models"
+)
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+	Secrets  map[string]composeSecret  `yaml:"secrets,omitempty"`
+}
+
+type composeService struct {
+	Image       string   `yaml:"image"`
+	Ports       []string `yaml:"ports,omitempty"`
+	Environment []string `yaml:"environment,omitempty"`
+	Secrets     []string `yaml:"secrets,omitempty"`
+
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type composeSecret struct {
+	File string `yaml:"file"`
+}
+
+// renderCompose renders a single-service compose file. Secrets are mounted
+// at /run/secrets/<NAME> from files under ./secrets, which are returned in
+// SecretFiles, and <NAME>_FILE points the app at them. In maintenance, the
+// service is labeled with MaintenanceKey.
+func renderCompose(d *models.Deployment, env []string, secrets []Secret, maintenance bool) (*models.Manifest, error) {
+	service := composeService{
+		Image: d.DockerImage,
+		Ports: []string{strconv.Itoa(d.Port) + ":" + strconv.Itoa(d.Port)},
+	}
+	if maintenance {
+		service.Labels = map[string]string{MaintenanceKey: "true"}
+	}
+	for _, entry := range env {
+		// Compose interpolates $ in values; $$ is a literal dollar sign
+		service.Environment = append(service.Environment, strings.ReplaceAll(entry, "$", "$$"))
+	}
+
+	file := composeFile{Services: map[string]composeService{}}
+	manifest := &models.Manifest{Format: FormatCompose}
+	if len(secrets) > 0 {
+		file.Secrets = make(map[string]composeSecret, len(secrets))
+		manifest.SecretFiles = make(map[string]string, len(secrets))
+	}
+	for _, secret := range secrets {
+		path := "secrets/" + secret.Name
+		file.Secrets[secret.Name] = composeSecret{File: "./" + path}
+		manifest.SecretFiles[path] = secret.Value
+
+		service.Secrets = append(service.Secrets, secret.Name)
+		service.Environment = append(service.Environment, secret.Name+"_FILE=/run/secrets/"+secret.Name)
+	}
+	file.Services[d.AppName] = service
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	manifest.Content = buf.String()
+	return manifest, nil
+}
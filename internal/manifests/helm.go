@@ -0,0 +1,120 @@
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/distribution/reference"
+	"gopkg.in/yaml.v3"
+
+	"deployment-controller/internal/models"
+)
+
+// HelmSecretsFile is the values file holding secret env values, kept apart
+// from values.yaml so the latter can be stored or reviewed safely
+const HelmSecretsFile = "secrets.yaml"
+
+type helmValues struct {
+	NameOverride   string            `yaml:"nameOverride"`
+	ReplicaCount   int               `yaml:"replicaCount"`
+	Image          helmImage         `yaml:"image"`
+	PodAnnotations map[string]string `yaml:"podAnnotations"`
+	Service        helmService       `yaml:"service"`
+	Env            []k8sEnvVar       `yaml:"env"`
+	Resources      map[string]any    `yaml:"resources"`
+}
+
+type helmImage struct {
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag"`
+	Digest     string `yaml:"digest,omitempty"`
+	PullPolicy string `yaml:"pullPolicy"`
+}
+
+type helmService struct {
+	Type string `yaml:"type"`
+	Port int    `yaml:"port"`
+}
+
+type helmSecretValues struct {
+	SecretEnv map[string]string `yaml:"secretEnv"`
+}
+
+// renderHelmValues renders a values.yaml in the layout of charts created by
+// helm create, plus env and secretEnv lists. Secrets go into a separate
+// values file returned in SecretFiles, for helm upgrade -f values.yaml -f
+// secrets.yaml; the chart is expected to store secretEnv in a Secret.
+// resources is left empty for teams to set in their own values. In
+// maintenance, the pods are annotated with MaintenanceKey.
+func renderHelmValues(d *models.Deployment, env []string, secrets []Secret, maintenance bool) (*models.Manifest, error) {
+	named, err := reference.ParseNormalizedNamed(d.DockerImage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %w", d.DockerImage, err)
+	}
+
+	image := helmImage{Repository: reference.FamiliarName(named), PullPolicy: "IfNotPresent"}
+	if tagged, ok := named.(reference.Tagged); ok {
+		image.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		image.Digest = digested.Digest().String()
+	}
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = "latest"
+	}
+
+	values := helmValues{
+		NameOverride: d.AppName,
+		ReplicaCount: Replicas,
+		Image:        image,
+		PodAnnotations: map[string]string{
+			"deployment-controller/deployment-id": d.ID.String(),
+			"deployment-controller/version":       strconv.Itoa(d.Version),
+		},
+		Service:   helmService{Type: "ClusterIP", Port: d.Port},
+		Env:       []k8sEnvVar{},
+		Resources: map[string]any{},
+	}
+	if maintenance {
+		values.PodAnnotations[MaintenanceKey] = "true"
+	}
+	names, envValues := splitEnv(env)
+	for i, name := range names {
+		values.Env = append(values.Env, k8sEnvVar{Name: name, Value: envValues[i]})
+	}
+
+	content, err := encodeYAML(values)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &models.Manifest{Format: FormatHelmValues, Content: content}
+
+	if len(secrets) > 0 {
+		secretValues := helmSecretValues{SecretEnv: make(map[string]string, len(secrets))}
+		for _, secret := range secrets {
+			secretValues.SecretEnv[secret.Name] = secret.Value
+		}
+		content, err := encodeYAML(secretValues)
+		if err != nil {
+			return nil, err
+		}
+		manifest.SecretFiles = map[string]string{HelmSecretsFile: content}
+	}
+
+	return manifest, nil
+}
+
+// encodeYAML encodes v as a YAML document indented by two spaces
+func encodeYAML(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,141 @@
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"deployment-controller/internal/models"
+)
+
+type k8sMeta struct {
+	Name        string            `yaml:"name"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type k8sObject struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMeta           `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+	Spec       any               `yaml:"spec,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type k8sEnvFrom struct {
+	SecretRef struct {
+		Name string `yaml:"name"`
+	} `yaml:"secretRef"`
+}
+
+type k8sContainer struct {
+	Name    string       `yaml:"name"`
+	Image   string       `yaml:"image"`
+	Ports   []k8sPort    `yaml:"ports,omitempty"`
+	Env     []k8sEnvVar  `yaml:"env,omitempty"`
+	EnvFrom []k8sEnvFrom `yaml:"envFrom,omitempty"`
+}
+
+type k8sPort struct {
+	ContainerPort int `yaml:"containerPort"`
+}
+
+type k8sDeploymentSpec struct {
+	Replicas int `yaml:"replicas"`
+	Selector struct {
+		MatchLabels map[string]string `yaml:"matchLabels"`
+	} `yaml:"selector"`
+	Template struct {
+		Metadata k8sMeta `yaml:"metadata"`
+		Spec     struct {
+			Containers []k8sContainer `yaml:"containers"`
+		} `yaml:"spec"`
+	} `yaml:"template"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Port       int `yaml:"port"`
+	TargetPort int `yaml:"targetPort"`
+}
+
+// renderKubernetes renders a Deployment and Service; secrets go into an
+// Opaque Secret named "<app>-secrets" that the container loads with envFrom.
+// In maintenance, the Service is annotated with MaintenanceKey.
+func renderKubernetes(d *models.Deployment, env []string, secrets []Secret, maintenance bool) (*models.Manifest, error) {
+	labels := map[string]string{"app": d.AppName}
+	secretName := d.AppName + "-secrets"
+	var annotations map[string]string
+	if maintenance {
+		annotations = map[string]string{MaintenanceKey: "true"}
+	}
+
+	container := k8sContainer{
+		Name:  d.AppName,
+		Image: d.DockerImage,
+		Ports: []k8sPort{{ContainerPort: d.Port}},
+	}
+	names, values := splitEnv(env)
+	for i, name := range names {
+		container.Env = append(container.Env, k8sEnvVar{Name: name, Value: values[i]})
+	}
+
+	var objects []k8sObject
+	if len(secrets) > 0 {
+		data := make(map[string]string, len(secrets))
+		for _, secret := range secrets {
+			data[secret.Name] = secret.Value
+		}
+		objects = append(objects, k8sObject{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   k8sMeta{Name: secretName, Labels: labels},
+			Type:       "Opaque",
+			StringData: data,
+		})
+
+		var envFrom k8sEnvFrom
+		envFrom.SecretRef.Name = secretName
+		container.EnvFrom = []k8sEnvFrom{envFrom}
+	}
+
+	var deployment k8sDeploymentSpec
+	deployment.Replicas = Replicas
+	deployment.Selector.MatchLabels = labels
+	deployment.Template.Metadata = k8sMeta{Name: d.AppName, Labels: labels}
+	deployment.Template.Spec.Containers = []k8sContainer{container}
+
+	var service k8sServiceSpec
+	service.Selector = labels
+	service.Ports = []k8sServicePort{{Port: d.Port, TargetPort: d.Port}}
+
+	objects = append(objects,
+		k8sObject{APIVersion: "apps/v1", Kind: "Deployment", Metadata: k8sMeta{Name: d.AppName, Labels: labels}, Spec: deployment},
+		k8sObject{APIVersion: "v1", Kind: "Service", Metadata: k8sMeta{Name: d.AppName, Labels: labels, Annotations: annotations}, Spec: service},
+	)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, object := range objects {
+		if err := enc.Encode(object); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", object.Kind, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return &models.Manifest{Format: FormatKubernetes, Content: buf.String()}, nil
+}
@@ -0,0 +1,89 @@
+// Package manifests renders deployments as Kubernetes, Docker Compose,
+// Nomad and Helm values configuration for agents that hand them to an
+// orchestrator
+package manifests
+
+import (
+	"fmt"
+	"strings"
+
+	"deployment-controller/internal/models"
+)
+
+// Supported output formats
+const (
+	FormatKubernetes = "kubernetes"
+	FormatCompose    = "compose"
+	FormatNomad      = "nomad"
+	FormatHelmValues = "helm-values"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatKubernetes, FormatCompose, FormatNomad, FormatHelmValues}
+
+// FileNames are the file names each format's content is conventionally
+// saved under
+var FileNames = map[string]string{
+	FormatKubernetes: "manifest.yaml",
+	FormatCompose:    "docker-compose.yml",
+	FormatNomad:      "job.nomad.hcl",
+	FormatHelmValues: "values.yaml",
+}
+
+// Replicas is how many instances of an app the rendered manifests run
+const Replicas = 1
+
+// MaintenanceKey is the annotation, label or meta key set to "true" on the
+// manifests of apps in maintenance, for proxies to serve a maintenance page
+const MaintenanceKey = "deployment-controller/maintenance"
+
+// Secret is a resolved secret env variable
+type Secret struct {
+	Name  string
+	Value string
+}
+
+// Options control how a deployment is rendered
+type Options struct {
+	// InlineSecrets writes secret values into the container environment
+	// like plain env vars, for simple Docker hosts without a secret store
+	InlineSecrets bool
+
+	// Maintenance marks the app in maintenance with MaintenanceKey
+	Maintenance bool
+}
+
+// Render renders a deployment in format. env holds the plain "KEY=value"
+// entries and secrets the resolved secret ones; unless opts.InlineSecrets is
+// set, secrets become the format's native construct rather than plain env.
+func Render(format string, d *models.Deployment, env []string, secrets []Secret, opts Options) (*models.Manifest, error) {
+	if opts.InlineSecrets {
+		for _, secret := range secrets {
+			env = append(env, secret.Name+"="+secret.Value)
+		}
+		secrets = nil
+	}
+
+	switch format {
+	case FormatKubernetes:
+		return renderKubernetes(d, env, secrets, opts.Maintenance)
+	case FormatCompose:
+		return renderCompose(d, env, secrets, opts.Maintenance)
+	case FormatNomad:
+		return renderNomad(d, env, secrets, opts.Maintenance)
+	case FormatHelmValues:
+		return renderHelmValues(d, env, secrets, opts.Maintenance)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format %q (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// splitEnv splits "KEY=value" entries into ordered names and values
+func splitEnv(env []string) (names, values []string) {
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		names = append(names, name)
+		values = append(values, value)
+	}
+	return names, values
+}
@@ -0,0 +1,128 @@
+package manifests
+
+import (
+	"strings"
+	"testing"
+
+	"deployment-controller/internal/models"
+)
+
+var testDeployment = &models.Deployment{AppName: "api", DockerImage: "nginx:1.25", Port: 8080}
+
+func TestRenderMaterializesSecrets(t *testing.T) {
+	env := []string{"MODE=prod", "GREETING=${HOME}"}
+	secrets := []Secret{{Name: "DB_PASS", Value: "s3cret"}}
+
+	tests := []struct {
+		format      string
+		contains    []string
+		secretFiles map[string]string
+	}{
+		{
+			format: FormatKubernetes,
+			contains: []string{
+				"kind: Secret", "name: api-secrets", "DB_PASS: s3cret",
+				"kind: Deployment", "envFrom:", "- name: MODE\n", "kind: Service", "containerPort: 8080",
+			},
+		},
+		{
+			format: FormatCompose,
+			contains: []string{
+				"image: nginx:1.25", "- 8080:8080", "- MODE=prod", "- GREETING=$${HOME}",
+				"- DB_PASS_FILE=/run/secrets/DB_PASS", "file: ./secrets/DB_PASS",
+			},
+			secretFiles: map[string]string{"secrets/DB_PASS": "s3cret"},
+		},
+		{
+			format: FormatNomad,
+			contains: []string{
+				`job "api"`, `image = "nginx:1.25"`, `"MODE" = "prod"`, `"GREETING" = "$${HOME}"`,
+				`nomadVar "nomad/jobs/api/api/api"`, "env         = true",
+			},
+			secretFiles: map[string]string{"nomad/jobs/api/api/api": `{"Items":{"DB_PASS":"s3cret"}}`},
+		},
+		{
+			format: FormatHelmValues,
+			contains: []string{
+				"nameOverride: api", "replicaCount: 1", "repository: nginx\n", `tag: "1.25"`,
+				"port: 8080", "- name: MODE\n", "resources: {}",
+			},
+			secretFiles: map[string]string{HelmSecretsFile: "secretEnv:\n  DB_PASS: s3cret\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			manifest, err := Render(tt.format, testDeployment, env, secrets, Options{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(manifest.Content, want) {
+					t.Errorf("Expected manifest to contain %q:\n%s", want, manifest.Content)
+				}
+			}
+			if tt.format != FormatKubernetes && strings.Contains(manifest.Content, "s3cret") {
+				t.Errorf("Expected the secret value to stay out of the manifest:\n%s", manifest.Content)
+			}
+
+			if len(manifest.SecretFiles) != len(tt.secretFiles) {
+				t.Fatalf("Expected secret files %v, got %v", tt.secretFiles, manifest.SecretFiles)
+			}
+			for path, content := range tt.secretFiles {
+				if manifest.SecretFiles[path] != content {
+					t.Errorf("Expected %s to contain %q, got %q", path, content, manifest.SecretFiles[path])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderInlineSecrets(t *testing.T) {
+	secrets := []Secret{{Name: "DB_PASS", Value: "s3cret"}}
+
+	for _, format := range Formats {
+		manifest, err := Render(format, testDeployment, []string{"MODE=prod"}, secrets, Options{InlineSecrets: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !strings.Contains(manifest.Content, "s3cret") {
+			t.Errorf("%s: expected the secret value inlined:\n%s", format, manifest.Content)
+		}
+		if len(manifest.SecretFiles) != 0 || strings.Contains(manifest.Content, "kind: Secret") {
+			t.Errorf("%s: expected no secret objects when inlining:\n%s", format, manifest.Content)
+		}
+	}
+
+	if _, err := Render("swarm", testDeployment, nil, nil, Options{}); err == nil {
+		t.Errorf("Expected an error for an unsupported format")
+	}
+}
+
+func TestRenderMaintenance(t *testing.T) {
+	expected := map[string]string{
+		FormatKubernetes: "deployment-controller/maintenance: \"true\"",
+		FormatCompose:    "deployment-controller/maintenance: \"true\"",
+		FormatNomad:      `"deployment-controller/maintenance" = "true"`,
+		FormatHelmValues: "deployment-controller/maintenance: \"true\"",
+	}
+
+	for _, format := range Formats {
+		manifest, err := Render(format, testDeployment, nil, nil, Options{Maintenance: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !strings.Contains(manifest.Content, expected[format]) {
+			t.Errorf("%s: expected the maintenance marker:\n%s", format, manifest.Content)
+		}
+
+		manifest, err = Render(format, testDeployment, nil, nil, Options{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if strings.Contains(manifest.Content, MaintenanceKey) {
+			t.Errorf("%s: expected no maintenance marker outside maintenance:\n%s", format, manifest.Content)
+		}
+	}
+}
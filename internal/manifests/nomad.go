@@ -0,0 +1,101 @@
+package manifests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"deployment-controller/internal/models"
+)
+
+// nomadSecretsTemplate renders every item of the task's Nomad variable as
+// env, so secret values stay out of the job specification
+const nomadSecretsTemplate = `{{ with nomadVar "%s" }}{{ range .Tuples }}{{ .K }}={{ .V | toJSON }}
+{{ end }}{{ end }}`
+
+// renderNomad renders a Docker job. Secrets are read from the Nomad variable
+// at nomad/jobs/<app>/<app>/<app>, which tasks can read with their workload
+// identity; its items are returned in SecretFiles as JSON for "nomad var put".
+// In maintenance, the group's meta sets MaintenanceKey.
+func renderNomad(d *models.Deployment, env []string, secrets []Secret, maintenance bool) (*models.Manifest, error) {
+	manifest := &models.Manifest{Format: FormatNomad}
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "job %s {\n", hclString(d.AppName))
+	b.WriteString("  datacenters = [\"*\"]\n\n")
+	fmt.Fprintf(&b, "  group %s {\n", hclString(d.AppName))
+	if maintenance {
+		fmt.Fprintf(&b, "    meta {\n      %s = \"true\"\n    }\n\n", hclString(MaintenanceKey))
+	}
+	b.WriteString("    network {\n")
+	fmt.Fprintf(&b, "      port \"http\" {\n        to = %d\n      }\n", d.Port)
+	b.WriteString("    }\n\n")
+	fmt.Fprintf(&b, "    task %s {\n", hclString(d.AppName))
+	b.WriteString("      driver = \"docker\"\n\n")
+	b.WriteString("      config {\n")
+	fmt.Fprintf(&b, "        image = %s\n", hclString(d.DockerImage))
+	b.WriteString("        ports = [\"http\"]\n")
+	b.WriteString("      }\n")
+
+	if len(env) > 0 {
+		b.WriteString("\n      env {\n")
+		names, values := splitEnv(env)
+		for i, name := range names {
+			fmt.Fprintf(&b, "        %s = %s\n", hclString(name), hclString(values[i]))
+		}
+		b.WriteString("      }\n")
+	}
+
+	if len(secrets) > 0 {
+		path := "nomad/jobs/" + d.AppName + "/" + d.AppName + "/" + d.AppName
+		items := make(map[string]string, len(secrets))
+		for _, secret := range secrets {
+			items[secret.Name] = secret.Value
+		}
+		payload, err := json.Marshal(map[string]any{"Items": items})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode nomad variable: %w", err)
+		}
+		manifest.SecretFiles = map[string]string{path: string(payload)}
+
+		b.WriteString("\n      template {\n")
+		b.WriteString("        destination = \"secrets/env\"\n")
+		b.WriteString("        env         = true\n")
+		fmt.Fprintf(&b, "        data        = <<EOT\n%s\nEOT\n", fmt.Sprintf(nomadSecretsTemplate, path))
+		b.WriteString("      }\n")
+	}
+
+	b.WriteString("    }\n  }\n}\n")
+
+	manifest.Content = b.String()
+	return manifest, nil
+}
+
+// hclString quotes s as an HCL string literal, escaping interpolation
+// sequences so values are taken literally
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$', '%':
+			b.WriteByte(c)
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,348 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// cloneAlertRule copies an alert rule so callers never share its pointers
+func cloneAlertRule(rule models.AlertRule) *models.AlertRule {
+	rule.SilencedUntil = cloneTime(rule.SilencedUntil)
+	return &rule
+}
+
+// cloneRuleAlert copies a rule alert so callers never share its pointers
+func cloneRuleAlert(alert *models.RuleAlert) *models.RuleAlert {
+	c := *alert
+	c.NotifiedAt = cloneTime(alert.NotifiedAt)
+	c.AcknowledgedAt = cloneTime(alert.AcknowledgedAt)
+	return &c
+}
+
+// UpsertAlertRule creates or replaces an alert rule, keeping any silence.
+// Alerts it fired that no longer match are resolved on its next evaluation.
+func (s *Store) UpsertAlertRule(ctx context.Context, rule models.AlertRule) (*models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule.SilencedUntil = nil
+	if existing, ok := s.alertRules[rule.Name]; ok {
+		rule.SilencedUntil = existing.SilencedUntil
+	}
+	rule.UpdatedAt = s.clock.Now()
+	s.alertRules[rule.Name] = rule
+	return cloneAlertRule(rule), nil
+}
+
+// GetAlertRule gets an alert rule by name
+func (s *Store) GetAlertRule(ctx context.Context, name string) (*models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.alertRules[name]
+	if !ok {
+		return nil, fmt.Errorf("alert rule not found")
+	}
+	return cloneAlertRule(rule), nil
+}
+
+// ListAlertRules lists all alert rules ordered by name
+func (s *Store) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := []models.AlertRule{}
+	for _, rule := range s.alertRules {
+		rules = append(rules, *cloneAlertRule(rule))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// DeleteAlertRule deletes an alert rule and its alerts
+func (s *Store) DeleteAlertRule(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.alertRules[name]; !ok {
+		return fmt.Errorf("alert rule not found")
+	}
+	delete(s.alertRules, name)
+	for key := range s.ruleAlerts {
+		if key.rule == name {
+			delete(s.ruleAlerts, key)
+		}
+	}
+	return nil
+}
+
+// SilenceAlertRule mutes an alert rule's notifications until the given
+// time, or unmutes them when until is nil
+func (s *Store) SilenceAlertRule(ctx context.Context, name string, until *time.Time) (*models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.alertRules[name]
+	if !ok {
+		return nil, fmt.Errorf("alert rule not found")
+	}
+	rule.SilencedUntil = cloneTime(until)
+	s.alertRules[name] = rule
+	return cloneAlertRule(rule), nil
+}
+
+// ListRuleAlerts lists the firing alerts of every rule ordered by rule,
+// domain and app name
+func (s *Store) ListRuleAlerts(ctx context.Context) ([]models.RuleAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alerts := []models.RuleAlert{}
+	for _, alert := range s.ruleAlerts {
+		alerts = append(alerts, *cloneRuleAlert(alert))
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.AppName < b.AppName
+	})
+	return alerts, nil
+}
+
+// FireRuleAlert records that a rule's alert is firing on an app, updating
+// its value and, when set, when it was last notified
+func (s *Store) FireRuleAlert(ctx context.Context, alert models.RuleAlert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.alertRules[alert.Rule]; !ok {
+		return fmt.Errorf("failed to record rule alert: alert rule not found")
+	}
+
+	key := ruleAlertKey{alert.Rule, alert.Domain, alert.AppName}
+	stored, ok := s.ruleAlerts[key]
+	if !ok {
+		stored = &models.RuleAlert{Rule: alert.Rule, Domain: alert.Domain, AppName: alert.AppName, FiringSince: s.clock.Now()}
+		s.ruleAlerts[key] = stored
+	}
+	stored.Value = alert.Value
+	if alert.NotifiedAt != nil {
+		stored.NotifiedAt = cloneTime(alert.NotifiedAt)
+	}
+	return nil
+}
+
+// ResolveRuleAlert removes a rule's firing alert on an app
+func (s *Store) ResolveRuleAlert(ctx context.Context, rule, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.ruleAlerts, ruleAlertKey{rule, domain, appName})
+	return nil
+}
+
+// AcknowledgeRuleAlert marks a rule's firing alert on an app acknowledged,
+// stopping its repeated notifications
+func (s *Store) AcknowledgeRuleAlert(ctx context.Context, rule, domain, appName, actor string) (*models.RuleAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert, ok := s.ruleAlerts[ruleAlertKey{rule, domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("alert not found")
+	}
+	now := s.clock.Now()
+	alert.AcknowledgedAt, alert.AcknowledgedBy = &now, actor
+	return cloneRuleAlert(alert), nil
+}
+
+// ListFailureRateAlerts lists the firing failure rate alerts ordered by
+// domain and app name
+func (s *Store) ListFailureRateAlerts(ctx context.Context) ([]models.FailureRateAlert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alerts := []models.FailureRateAlert{}
+	for _, key := range sortedKeys(s.failureRateAlerts) {
+		alerts = append(alerts, s.failureRateAlerts[key])
+	}
+	return alerts, nil
+}
+
+// FireFailureRateAlert records that an app's failure rate alert fired
+func (s *Store) FireFailureRateAlert(ctx context.Context, domain, appName string, failureRate float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	alert, ok := s.failureRateAlerts[key]
+	if !ok {
+		alert = models.FailureRateAlert{Domain: domain, AppName: appName, FiringSince: s.clock.Now()}
+	}
+	alert.FailureRate = failureRate
+	s.failureRateAlerts[key] = alert
+	return nil
+}
+
+// ResolveFailureRateAlert removes an app's firing failure rate alert
+func (s *Store) ResolveFailureRateAlert(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failureRateAlerts, appKey{domain, appName})
+	return nil
+}
+
+// maintenanceMatches reports whether the ETag of an app's maintenance mode
+// is one of ifMatch, or ifMatch is nil
+func (s *Store) maintenanceMatches(domain, appName string, ifMatch []string) bool {
+	if ifMatch == nil {
+		return true
+	}
+	current, ok := s.maintenance[appKey{domain, appName}]
+	if !ok {
+		current = models.AppMaintenance{Domain: domain, AppName: appName}
+	}
+	return slices.Contains(ifMatch, current.ETag())
+}
+
+// StartMaintenance puts an app in maintenance; for an app already in
+// maintenance only the reason changes. When ifMatch is non-nil the change is
+// only applied if the current ETag is one of the given tags.
+func (s *Store) StartMaintenance(ctx context.Context, m models.AppMaintenance, ifMatch []string) (*models.AppMaintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.maintenanceMatches(m.Domain, m.AppName, ifMatch) {
+		return nil, fmt.Errorf("precondition failed")
+	}
+
+	key := appKey{m.Domain, m.AppName}
+	stored, ok := s.maintenance[key]
+	if !ok {
+		now := s.clock.Now()
+		stored = models.AppMaintenance{Domain: m.Domain, AppName: m.AppName, Enabled: true, StartedBy: m.StartedBy, StartedAt: &now}
+	}
+	stored.Reason = m.Reason
+	s.maintenance[key] = stored
+
+	stored.StartedAt = cloneTime(stored.StartedAt)
+	return &stored, nil
+}
+
+// EndMaintenance takes an app out of maintenance; apps not in maintenance
+// are left as they are. When ifMatch is non-nil the change is only applied
+// if the current ETag is one of the given tags.
+func (s *Store) EndMaintenance(ctx context.Context, domain, appName string, ifMatch []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.maintenanceMatches(domain, appName, ifMatch) {
+		return fmt.Errorf("precondition failed")
+	}
+	delete(s.maintenance, appKey{domain, appName})
+	return nil
+}
+
+// GetMaintenance gets an app's maintenance mode, which is off unless the
+// app was put in maintenance
+func (s *Store) GetMaintenance(ctx context.Context, domain, appName string) (*models.AppMaintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.maintenance[appKey{domain, appName}]
+	if !ok {
+		return &models.AppMaintenance{Domain: domain, AppName: appName}, nil
+	}
+	m.StartedAt = cloneTime(m.StartedAt)
+	return &m, nil
+}
+
+// ListMaintenance lists the apps in maintenance, ordered by domain and app
+// name
+func (s *Store) ListMaintenance(ctx context.Context) ([]models.AppMaintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps := []models.AppMaintenance{}
+	for _, key := range sortedKeys(s.maintenance) {
+		m := s.maintenance[key]
+		m.StartedAt = cloneTime(m.StartedAt)
+		apps = append(apps, m)
+	}
+	return apps, nil
+}
+
+// writeFreezeMatches reports whether the ETag of the freeze is one of
+// ifMatch, or ifMatch is nil
+func (s *Store) writeFreezeMatches(ifMatch []string) bool {
+	if ifMatch == nil {
+		return true
+	}
+	current := &models.WriteFreeze{}
+	if s.freeze != nil {
+		current = s.freeze
+	}
+	return slices.Contains(ifMatch, current.ETag())
+}
+
+// StartWriteFreeze freezes new deployments; for a freeze already on only the
+// reason changes. When ifMatch is non-nil the change is only applied if the
+// current ETag is one of the given tags.
+func (s *Store) StartWriteFreeze(ctx context.Context, freeze models.WriteFreeze, ifMatch []string) (*models.WriteFreeze, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.writeFreezeMatches(ifMatch) {
+		return nil, fmt.Errorf("precondition failed")
+	}
+
+	if s.freeze == nil {
+		now := s.clock.Now()
+		s.freeze = &models.WriteFreeze{Enabled: true, StartedBy: freeze.StartedBy, StartedAt: &now}
+	}
+	s.freeze.Reason = freeze.Reason
+
+	stored := *s.freeze
+	stored.StartedAt = cloneTime(s.freeze.StartedAt)
+	return &stored, nil
+}
+
+// EndWriteFreeze lifts the freeze on new deployments, if any. When ifMatch
+// is non-nil the change is only applied if the current ETag is one of the
+// given tags.
+func (s *Store) EndWriteFreeze(ctx context.Context, ifMatch []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.writeFreezeMatches(ifMatch) {
+		return fmt.Errorf("precondition failed")
+	}
+
+	s.freeze = nil
+	return nil
+}
+
+// GetWriteFreeze gets the freeze on new deployments, which is off unless
+// an admin started one
+func (s *Store) GetWriteFreeze(ctx context.Context) (*models.WriteFreeze, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.freeze == nil {
+		return &models.WriteFreeze{}, nil
+	}
+	stored := *s.freeze
+	stored.StartedAt = cloneTime(s.freeze.StartedAt)
+	return &stored, nil
+}
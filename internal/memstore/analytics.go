@@ -0,0 +1,271 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// errNotSupported is returned by the operations that only make sense
+// against Postgres
+var errNotSupported = fmt.Errorf("not supported by the in-memory store")
+
+// day truncates t to its UTC calendar day, like a Postgres ::date cast
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// RefreshAnalytics recomputes the analytics summaries. The per-app summary
+// is rebuilt in full; daily counts are recomputed for every UTC day with a
+// deployment whose status changed since the last refresh, as in Postgres.
+func (s *Store) RefreshAnalytics(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	summaries := map[appKey]*models.AppSummary{}
+	for _, d := range s.deployments {
+		key := appKey{d.Domain, d.AppName}
+		summary := summaries[key]
+		if summary == nil {
+			summary = &models.AppSummary{Domain: d.Domain, AppName: d.AppName, RefreshedAt: now}
+			summaries[key] = summary
+		}
+		summary.TotalVersions++
+		switch d.Status {
+		case "deployed":
+			summary.DeployedCount++
+		case "failed":
+			summary.FailedCount++
+		}
+		if d.CreatedAt.After(summary.LastCreatedAt) {
+			summary.LastCreatedAt = d.CreatedAt
+		}
+		if d.DeployedAt != nil && (summary.LastDeployedAt == nil || d.DeployedAt.After(*summary.LastDeployedAt)) {
+			summary.LastDeployedAt = cloneTime(d.DeployedAt)
+		}
+	}
+	for _, latest := range s.latestDeployments() {
+		if summary := summaries[appKey{latest.Domain, latest.AppName}]; summary != nil {
+			summary.CurrentVersion, summary.CurrentStatus = latest.Version, latest.Status
+		}
+	}
+
+	s.summaries = []models.AppSummary{}
+	for _, key := range sortedKeys(summaries) {
+		s.summaries = append(s.summaries, *summaries[key])
+	}
+
+	touched := map[time.Time]bool{}
+	for _, d := range s.deployments {
+		if !s.statusChangedAt[d.ID].Before(s.dailyCountsRefreshedAt) {
+			touched[day(d.CreatedAt)] = true
+		}
+	}
+	s.dailyCountsRefreshedAt = now
+
+	counts := map[dailyKey]models.DailyDeploymentCount{}
+	for _, d := range s.deployments {
+		if !touched[day(d.CreatedAt)] {
+			continue
+		}
+		key := dailyKey{day(d.CreatedAt), appKey{d.Domain, d.AppName}}
+		count := counts[key]
+		count.Day, count.Domain, count.AppName = key.day, d.Domain, d.AppName
+		count.CreatedCount++
+		switch d.Status {
+		case "deployed":
+			count.DeployedCount++
+		case "failed":
+			count.FailedCount++
+		}
+		counts[key] = count
+	}
+	for key, count := range counts {
+		s.dailyCounts[key] = count
+	}
+	return nil
+}
+
+// GetAppSummaries gets the per-app deployment summary as of the last
+// RefreshAnalytics
+func (s *Store) GetAppSummaries(ctx context.Context) ([]models.AppSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := []models.AppSummary{}
+	for _, summary := range s.summaries {
+		summary.LastDeployedAt = cloneTime(summary.LastDeployedAt)
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// GetDeploymentTrends gets the daily deployment counts since the given day
+func (s *Store) GetDeploymentTrends(ctx context.Context, since time.Time) ([]models.DailyDeploymentCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := []models.DailyDeploymentCount{}
+	for key, count := range s.dailyCounts {
+		if !key.day.Before(day(since)) {
+			counts = append(counts, count)
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.AppName < b.AppName
+	})
+	return counts, nil
+}
+
+// GetTopApps gets up to limit apps with the most versions pushed (by
+// deploy_count) or failed (by failures) since the given day, from the
+// daily counts. Apps without any are left out.
+func (s *Store) GetTopApps(ctx context.Context, by string, since time.Time, limit int) ([]models.TopApp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := map[appKey]*models.TopApp{}
+	for key, count := range s.dailyCounts {
+		if key.day.Before(day(since)) {
+			continue
+		}
+		app := totals[key.app]
+		if app == nil {
+			app = &models.TopApp{Domain: count.Domain, AppName: count.AppName}
+			totals[key.app] = app
+		}
+		app.CreatedCount += count.CreatedCount
+		app.DeployedCount += count.DeployedCount
+		app.FailedCount += count.FailedCount
+	}
+
+	value := func(app models.TopApp) int { return app.CreatedCount }
+	if by == models.TopByFailures {
+		value = func(app models.TopApp) int { return app.FailedCount }
+	}
+
+	apps := []models.TopApp{}
+	for _, key := range sortedKeys(totals) {
+		if app := *totals[key]; value(app) > 0 {
+			apps = append(apps, app)
+		}
+	}
+	sort.SliceStable(apps, func(i, j int) bool { return value(apps[i]) > value(apps[j]) })
+	return apps[:min(len(apps), limit)], nil
+}
+
+// ListDeploymentOutcomes lists the deployments pushed since the given time
+// with when they were first deployed, failed and rolled back, ordered by
+// domain, app name and push time. Transitions are read from the statuses
+// recorded on the status_changed events.
+func (s *Store) ListDeploymentOutcomes(ctx context.Context, since time.Time) ([]models.DeploymentOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// first holds the earliest time each deployment reached each status
+	first := map[string]map[uuid.UUID]time.Time{"deployed": {}, "failed": {}, "rolled_back": {}}
+	for _, e := range s.events {
+		if e.Type != models.EventStatusChanged {
+			continue
+		}
+		times, ok := first[e.ToStatus]
+		if !ok {
+			continue
+		}
+		if t, ok := times[e.DeploymentID]; !ok || e.CreatedAt.Before(t) {
+			times[e.DeploymentID] = e.CreatedAt
+		}
+	}
+	at := func(status string, id uuid.UUID) *time.Time {
+		if t, ok := first[status][id]; ok {
+			return &t
+		}
+		return nil
+	}
+
+	var deployments []*models.Deployment
+	for _, d := range s.deployments {
+		if !d.CreatedAt.Before(since) {
+			deployments = append(deployments, d)
+		}
+	}
+	sort.SliceStable(deployments, func(i, j int) bool {
+		a, b := deployments[i], deployments[j]
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.AppName != b.AppName {
+			return a.AppName < b.AppName
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	outcomes := []models.DeploymentOutcome{}
+	for _, d := range deployments {
+		o := models.DeploymentOutcome{
+			DeploymentID: d.ID,
+			Domain:       d.Domain,
+			AppName:      d.AppName,
+			CreatedAt:    d.CreatedAt,
+			DeployedAt:   at("deployed", d.ID),
+			FailedAt:     at("failed", d.ID),
+			RolledBackAt: at("rolled_back", d.ID),
+		}
+
+		// The app is restored when another of its versions is deployed
+		// after the rollback
+		if o.RolledBackAt != nil {
+			for _, e := range s.events {
+				if e.Type != models.EventStatusChanged || e.DeploymentID == d.ID || e.ToStatus != "deployed" ||
+					e.CreatedAt.Before(*o.RolledBackAt) {
+					continue
+				}
+				other := s.findDeployment(e.DeploymentID)
+				if other == nil || other.Domain != d.Domain || other.AppName != d.AppName {
+					continue
+				}
+				if o.RestoredAt == nil || e.CreatedAt.Before(*o.RestoredAt) {
+					restoredAt := e.CreatedAt
+					o.RestoredAt = &restoredAt
+				}
+			}
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, nil
+}
+
+// VacuumAnalyze is a no-op; there is nothing to vacuum in memory
+func (s *Store) VacuumAnalyze(ctx context.Context, table string) error {
+	return nil
+}
+
+// GetTableSizes reports no tables; sizes are only tracked by Postgres
+func (s *Store) GetTableSizes(ctx context.Context) ([]models.TableSize, error) {
+	return []models.TableSize{}, nil
+}
+
+// Backup is not supported; the in-memory store is lost on restart anyway
+func (s *Store) Backup(ctx context.Context) (map[string][]json.RawMessage, error) {
+	return nil, fmt.Errorf("failed to back up: %w", errNotSupported)
+}
+
+// RestoreBackup is not supported; restore into a Postgres-backed server
+func (s *Store) RestoreBackup(ctx context.Context, tables map[string][]json.RawMessage, failOnConflict, dryRun bool) ([]models.RestoreTableResult, error) {
+	return nil, fmt.Errorf("failed to restore backup: %w", errNotSupported)
+}
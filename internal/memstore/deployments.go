@@ -0,0 +1,552 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newDeploymentID generates an ID for a new deployment
+func (s *Store) newDeploymentID() (uuid.UUID, error) {
+	if s.idVersion == 7 {
+		return uuid.NewV7()
+	}
+	return uuid.NewRandom()
+}
+
+// cloneDeployment copies a deployment so callers never share the store's
+// slices and maps
+func cloneDeployment(d *models.Deployment) models.Deployment {
+	c := *d
+	c.Env = slices.Clone(d.Env)
+	c.Metadata = cloneJSON(d.Metadata)
+	if d.Failure != nil {
+		failure := *d.Failure
+		failure.Details = cloneJSON(d.Failure.Details)
+		c.Failure = &failure
+	}
+	c.DeployedAt = cloneTime(d.DeployedAt)
+	c.ImageDeletedAt = cloneTime(d.ImageDeletedAt)
+	c.VerifiedAt = cloneTime(d.VerifiedAt)
+	return c
+}
+
+// cloneJSON deep-copies a JSON object the way a JSONB round trip would
+func cloneJSON(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return maps.Clone(m)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(data, &c); err != nil {
+		return maps.Clone(m)
+	}
+	return c
+}
+
+// cloneTime copies an optional timestamp
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// setStatus moves a deployment to status, stamping when it did if the
+// status changed
+func (s *Store) setStatus(d *models.Deployment, status string) {
+	if d.Status != status {
+		s.statusChangedAt[d.ID] = s.clock.Now()
+	}
+	d.Status = status
+}
+
+// findDeployment returns the stored deployment with the given ID, or nil
+func (s *Store) findDeployment(id uuid.UUID) *models.Deployment {
+	for _, d := range s.deployments {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// latestDeployment returns the stored latest version of an app, or nil
+func (s *Store) latestDeployment(domain, appName string) *models.Deployment {
+	var latest *models.Deployment
+	for _, d := range s.deployments {
+		if d.Domain == domain && d.AppName == appName && (latest == nil || d.Version > latest.Version) {
+			latest = d
+		}
+	}
+	return latest
+}
+
+// latestDeployments returns the stored latest version of every app
+func (s *Store) latestDeployments() []*models.Deployment {
+	latest := map[appKey]*models.Deployment{}
+	for _, d := range s.deployments {
+		key := appKey{d.Domain, d.AppName}
+		if l, ok := latest[key]; !ok || d.Version > l.Version {
+			latest[key] = d
+		}
+	}
+
+	deployments := slices.Collect(maps.Values(latest))
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].Domain < deployments[j].Domain ||
+			deployments[i].Domain == deployments[j].Domain && deployments[i].AppName < deployments[j].AppName
+	})
+	return deployments
+}
+
+// createDeployment stores the next version of an app
+func (s *Store) createDeployment(id uuid.UUID, req models.DeploymentRequest, requestID string) *models.Deployment {
+	version := 1
+	if latest := s.latestDeployment(req.Domain, req.AppName); latest != nil {
+		version = latest.Version + 1
+	}
+
+	updatedAt := req.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = s.clock.Now()
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = models.PriorityNormal
+	}
+
+	metadata := cloneJSON(req.Metadata)
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	deployment := &models.Deployment{
+		ID:          id,
+		RequestID:   requestID,
+		Domain:      req.Domain,
+		AppName:     req.AppName,
+		DockerImage: req.DockerImage,
+		Port:        req.Port,
+		Env:         slices.Clone([]string(req.Env)),
+		Version:     version,
+		UpdatedAt:   updatedAt,
+		Status:      "pending",
+		CreatedAt:   s.clock.Now(),
+		Priority:    priority,
+		Metadata:    metadata,
+		BuildInfo:   req.BuildInfo,
+	}
+	s.deployments = append(s.deployments, deployment)
+	s.statusChangedAt[id] = deployment.CreatedAt
+
+	for _, name := range req.Checks {
+		s.checks[id] = append(s.checks[id], models.DeploymentCheck{
+			Name: name, Status: models.CheckPending, UpdatedAt: s.clock.Now(),
+		})
+	}
+
+	return deployment
+}
+
+// CreateDeployment creates the next version of an app
+func (s *Store) CreateDeployment(ctx context.Context, req models.DeploymentRequest, requestID string) (*models.Deployment, error) {
+	id, err := s.newDeploymentID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate deployment ID: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployment := cloneDeployment(s.createDeployment(id, req, requestID))
+	s.notify(database.DeploymentsChangedChannel, "INSERT")
+	return &deployment, nil
+}
+
+// CreateDeploymentBatch creates every deployment at once; the IDs are
+// generated first, so an error leaves nothing created
+func (s *Store) CreateDeploymentBatch(ctx context.Context, reqs models.DeploymentPushRequest, requestID string, skipUnchanged bool) ([]models.Deployment, error) {
+	ids := make([]uuid.UUID, len(reqs))
+	for i := range reqs {
+		id, err := s.newDeploymentID()
+		if err != nil {
+			return nil, &database.BatchItemError{Index: i, Err: fmt.Errorf("failed to generate deployment ID: %w", err)}
+		}
+		ids[i] = id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments := make([]models.Deployment, 0, len(reqs))
+	for i, req := range reqs {
+		if skipUnchanged {
+			if latest := s.latestDeployment(req.Domain, req.AppName); latest != nil && latest.Matches(req) {
+				deployment := cloneDeployment(latest)
+				deployment.Unchanged = true
+				deployments = append(deployments, deployment)
+				continue
+			}
+		}
+		deployments = append(deployments, cloneDeployment(s.createDeployment(ids[i], req, requestID)))
+	}
+
+	s.notify(database.DeploymentsChangedChannel, "INSERT")
+	return deployments, nil
+}
+
+// GetDeployment gets a deployment by ID
+func (s *Store) GetDeployment(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	deployment := cloneDeployment(d)
+	return &deployment, nil
+}
+
+// GetLatestDeployment gets the latest version of a single app
+func (s *Store) GetLatestDeployment(ctx context.Context, domain, appName string) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.latestDeployment(domain, appName)
+	if d == nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	deployment := cloneDeployment(d)
+	return &deployment, nil
+}
+
+// GetLatestDeployments gets the latest version of every app, newest first
+func (s *Store) GetLatestDeployments(ctx context.Context) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deployments []models.Deployment
+	for _, d := range s.latestDeployments() {
+		deployments = append(deployments, cloneDeployment(d))
+	}
+	sort.SliceStable(deployments, func(i, j int) bool {
+		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
+	})
+	return deployments, nil
+}
+
+// before reports whether (createdAt, id) sorts before the cursor
+func before(createdAt time.Time, id uuid.UUID, after *models.Cursor) bool {
+	if after == nil {
+		return true
+	}
+	if !createdAt.Equal(after.CreatedAt) {
+		return createdAt.Before(after.CreatedAt)
+	}
+	return id.String() < after.ID.String()
+}
+
+// newestFirst orders by (createdAt, id) descending
+func newestFirst(createdAt1 time.Time, id1 uuid.UUID, createdAt2 time.Time, id2 uuid.UUID) bool {
+	if !createdAt1.Equal(createdAt2) {
+		return createdAt1.After(createdAt2)
+	}
+	return id1.String() > id2.String()
+}
+
+// GetDeploymentHistory gets up to limit versions of an app in the date
+// range and matching the metadata filter, newest first, resuming after the
+// given cursor when it is non-nil
+func (s *Store) GetDeploymentHistory(ctx context.Context, domain, appName string, rng models.DateRange, metadata models.MetadataFilter, after *models.Cursor, limit int) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deployments []models.Deployment
+	for _, d := range s.deployments {
+		if d.Domain == domain && d.AppName == appName && before(d.CreatedAt, d.ID, after) &&
+			rng.Contains(*d) && metadata.Matches(d.Metadata) {
+			deployments = append(deployments, cloneDeployment(d))
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return newestFirst(deployments[i].CreatedAt, deployments[i].ID, deployments[j].CreatedAt, deployments[j].ID)
+	})
+	if len(deployments) > limit {
+		deployments = deployments[:limit]
+	}
+	return deployments, nil
+}
+
+// UpdateDeploymentStatus updates the status of a deployment. When ifMatch is
+// non-nil the update is only applied if the current ETag is one of the given
+// tags. A non-nil failure replaces the reported failure reason; otherwise it
+// is kept while the status is unchanged and cleared when it changes.
+func (s *Store) UpdateDeploymentStatus(ctx context.Context, id uuid.UUID, status string, failure *models.DeploymentFailure, deployedAt *time.Time, ifMatch []string) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+
+	if ifMatch != nil && !slices.Contains(ifMatch, d.ETag()) {
+		return nil, fmt.Errorf("precondition failed")
+	}
+
+	previous := d.Status
+	if status != previous {
+		d.Failure = nil
+		d.Verification, d.VerifiedAt = "", nil
+	}
+	if failure != nil {
+		c := *failure
+		c.Details = cloneJSON(failure.Details)
+		d.Failure = &c
+	}
+	s.setStatus(d, status)
+	d.DeployedAt = cloneTime(deployedAt)
+
+	if status != previous {
+		message := fmt.Sprintf("status changed from %s to %s", previous, status)
+		if d.Failure != nil {
+			message += " (" + d.Failure.Code + ")"
+		}
+		s.recordStatusChange(id, previous, status, message)
+
+		if status == "failed" {
+			s.scheduleRetry(d)
+		}
+	}
+
+	s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	deployment := cloneDeployment(d)
+	return &deployment, nil
+}
+
+// SetDeploymentSecretError records the outcome of resolving a deployment's
+// secret references; an empty message clears a previous error
+func (s *Store) SetDeploymentSecretError(ctx context.Context, id uuid.UUID, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	d.SecretError = message
+	s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	return nil
+}
+
+// SetDeploymentImageDeleted records when a registry reported the
+// deployment's image deleted; nil clears the flag
+func (s *Store) SetDeploymentImageDeleted(ctx context.Context, id uuid.UUID, deletedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	d.ImageDeletedAt = cloneTime(deletedAt)
+	s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	return nil
+}
+
+// DeleteDeployment deletes a deployment version along with its checks,
+// events, retries, logs and smoke test result
+func (s *Store) DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	if ifMatch != nil && !slices.Contains(ifMatch, d.ETag()) {
+		return fmt.Errorf("precondition failed")
+	}
+	s.deleteDeployments(map[uuid.UUID]bool{id: true})
+	s.notify(database.DeploymentsChangedChannel, "DELETE")
+	return nil
+}
+
+// deleteDeployments deletes the given versions and everything that
+// cascades from them
+func (s *Store) deleteDeployments(ids map[uuid.UUID]bool) {
+	s.deployments = slices.DeleteFunc(s.deployments, func(d *models.Deployment) bool { return ids[d.ID] })
+	s.events = slices.DeleteFunc(s.events, func(e models.DeploymentEvent) bool { return ids[e.DeploymentID] })
+	s.snapshots = slices.DeleteFunc(s.snapshots, func(m models.ManifestSnapshot) bool { return ids[m.DeploymentID] })
+	for id := range ids {
+		delete(s.checks, id)
+		delete(s.retries, id)
+		delete(s.statusChangedAt, id)
+		delete(s.logs, id)
+		delete(s.archivedLogs, id)
+		delete(s.smokeResults, id)
+	}
+}
+
+// StoreRegistryCredential stores Docker registry credentials
+func (s *Store) StoreRegistryCredential(ctx context.Context, cred models.RegistryCredentialRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	stored, ok := s.registries[cred.Registry]
+	if !ok {
+		stored.CreatedAt = now
+	}
+	stored.Registry, stored.Username, stored.Password, stored.UpdatedAt = cred.Registry, cred.Username, cred.Password, now
+	s.registries[cred.Registry] = stored
+	return nil
+}
+
+// GetRegistryCredential gets Docker registry credentials
+func (s *Store) GetRegistryCredential(ctx context.Context, registry string) (*models.RegistryCredentialResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cred, ok := s.registries[registry]
+	if !ok {
+		return nil, fmt.Errorf("registry credential not found")
+	}
+	return &models.RegistryCredentialResponse{Registry: cred.Registry, Username: cred.Username, Password: cred.Password}, nil
+}
+
+// ListRegistries lists stored registry credentials without their passwords
+func (s *Store) ListRegistries(ctx context.Context) ([]models.RegistryReference, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var registries []models.RegistryReference
+	for _, registry := range slices.Sorted(maps.Keys(s.registries)) {
+		registries = append(registries, models.RegistryReference{Registry: registry, Username: s.registries[registry].Username})
+	}
+	return registries, nil
+}
+
+// DeleteRegistryCredential deletes a registry's credentials
+func (s *Store) DeleteRegistryCredential(ctx context.Context, registry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.registries[registry]; !ok {
+		return fmt.Errorf("registry credential not found")
+	}
+	delete(s.registries, registry)
+	return nil
+}
+
+// GetDeploymentStats gets the deployment statistics as of the last
+// RefreshDeploymentStats, like the materialized views. With a date range
+// they are computed live over the deployments in the range instead.
+func (s *Store) GetDeploymentStats(ctx context.Context, rng models.DateRange) (*models.DeploymentStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !rng.IsZero() {
+		stats := s.computeStats(func(d *models.Deployment) bool { return rng.Contains(*d) })
+		for _, group := range stats.Breakdown {
+			stats.TotalDeployments += group.TotalDeployments
+			stats.PendingCount += group.PendingCount
+			stats.DeployedCount += group.DeployedCount
+			stats.FailedCount += group.FailedCount
+		}
+		return stats, nil
+	}
+
+	if s.stats == nil {
+		s.refreshStats()
+	}
+	stats := *s.stats
+	stats.Breakdown = slices.Clone(s.stats.Breakdown)
+	return &stats, nil
+}
+
+// computeStats computes the per-app stats over the versions matching
+// include; each app counts by its latest such version
+func (s *Store) computeStats(include func(d *models.Deployment) bool) *models.DeploymentStats {
+	groups := map[appKey]*models.StatsGroup{}
+	for _, d := range s.deployments {
+		if !include(d) {
+			continue
+		}
+		key := appKey{d.Domain, d.AppName}
+		group, ok := groups[key]
+		if !ok {
+			group = &models.StatsGroup{Domain: d.Domain, AppName: d.AppName, TotalDeployments: 1}
+			groups[key] = group
+		}
+		group.Versions++
+		if d.Version > group.CurrentVersion {
+			group.CurrentVersion, group.CurrentStatus = d.Version, d.Status
+		}
+		if d.DeployedAt != nil && (group.LastDeployedAt == nil || d.DeployedAt.After(*group.LastDeployedAt)) {
+			group.LastDeployedAt = cloneTime(d.DeployedAt)
+		}
+	}
+
+	stats := &models.DeploymentStats{RefreshedAt: s.clock.Now(), Breakdown: []models.StatsGroup{}}
+	for _, key := range sortedKeys(groups) {
+		group := *groups[key]
+		switch group.CurrentStatus {
+		case "pending":
+			group.PendingCount = 1
+		case "deployed":
+			group.DeployedCount = 1
+		case "failed":
+			group.FailedCount = 1
+		}
+		stats.Breakdown = append(stats.Breakdown, group)
+	}
+	return stats
+}
+
+// refreshStats recomputes the stats served without a date range
+func (s *Store) refreshStats() {
+	stats := s.computeStats(func(*models.Deployment) bool { return true })
+	stats.TotalDeployments = len(stats.Breakdown)
+	for _, group := range stats.Breakdown {
+		stats.PendingCount += group.PendingCount
+		stats.DeployedCount += group.DeployedCount
+		stats.FailedCount += group.FailedCount
+	}
+	s.stats = stats
+}
+
+// RefreshDeploymentStats recomputes the deployment stats
+func (s *Store) RefreshDeploymentStats(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshStats()
+	return nil
+}
+
+// sortedKeys returns the keys of an app-keyed map ordered by domain and app
+// name
+func sortedKeys[V any](m map[appKey]V) []appKey {
+	keys := slices.Collect(maps.Keys(m))
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].domain < keys[j].domain || keys[i].domain == keys[j].domain && keys[i].appName < keys[j].appName
+	})
+	return keys
+}
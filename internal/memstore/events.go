@@ -0,0 +1,359 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recordEvent adds an entry to a deployment's timeline
+func (s *Store) recordEvent(deploymentID uuid.UUID, eventType, message string, attempt int) {
+	s.events = append(s.events, models.DeploymentEvent{
+		ID:           uuid.New(),
+		DeploymentID: deploymentID,
+		Type:         eventType,
+		Message:      message,
+		Attempt:      attempt,
+		CreatedAt:    s.clock.Now(),
+	})
+}
+
+// recordStatusChange records a status_changed event on a deployment's
+// timeline with the statuses it moved between
+func (s *Store) recordStatusChange(deploymentID uuid.UUID, from, to, message string) {
+	s.events = append(s.events, models.DeploymentEvent{
+		ID:           uuid.New(),
+		DeploymentID: deploymentID,
+		Type:         models.EventStatusChanged,
+		Message:      message,
+		CreatedAt:    s.clock.Now(),
+		FromStatus:   from,
+		ToStatus:     to,
+	})
+}
+
+// AddDeploymentEvent adds an entry to a deployment's timeline
+func (s *Store) AddDeploymentEvent(ctx context.Context, deploymentID uuid.UUID, eventType, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findDeployment(deploymentID) == nil {
+		return fmt.Errorf("failed to record deployment event: deployment %s does not exist", deploymentID)
+	}
+	s.recordEvent(deploymentID, eventType, message, 0)
+	return nil
+}
+
+// ListDeploymentEvents lists a deployment's timeline, oldest first
+func (s *Store) ListDeploymentEvents(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []models.DeploymentEvent{}
+	for _, event := range s.events {
+		if event.DeploymentID == deploymentID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// PruneDeploymentEvents deletes the deployment events recorded before the
+// given time and returns how many were deleted, or would be with dryRun
+func (s *Store) PruneDeploymentEvents(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := func(e models.DeploymentEvent) bool { return e.CreatedAt.Before(before) }
+	n := int64(countFunc(s.events, expired))
+	if !dryRun {
+		s.events = slices.DeleteFunc(s.events, expired)
+	}
+	return n, nil
+}
+
+// countFunc counts the elements of items matching f
+func countFunc[T any](items []T, f func(T) bool) int {
+	n := 0
+	for _, item := range items {
+		if f(item) {
+			n++
+		}
+	}
+	return n
+}
+
+// ListDeploymentChecks lists a deployment's CI checks ordered by name
+func (s *Store) ListDeploymentChecks(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listChecks(deploymentID), nil
+}
+
+func (s *Store) listChecks(deploymentID uuid.UUID) []models.DeploymentCheck {
+	checks := append([]models.DeploymentCheck{}, s.checks[deploymentID]...)
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// UpdateDeploymentChecks records the reported outcome of a deployment's CI
+// checks and returns all of its checks. Reporting a check the deployment
+// was not pushed with fails with "check not found" and changes nothing.
+func (s *Store) UpdateDeploymentChecks(ctx context.Context, deploymentID uuid.UUID, checks []models.CheckStatus) ([]models.DeploymentCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := slices.Clone(s.checks[deploymentID])
+	for _, check := range checks {
+		i := slices.IndexFunc(stored, func(c models.DeploymentCheck) bool { return c.Name == check.Name })
+		if i < 0 {
+			return nil, fmt.Errorf("check not found")
+		}
+		stored[i].Status, stored[i].DetailsURL, stored[i].UpdatedAt = check.Status, check.DetailsURL, s.clock.Now()
+	}
+	s.checks[deploymentID] = stored
+
+	return s.listChecks(deploymentID), nil
+}
+
+// UpsertRetryPolicy creates or replaces an app's retry policy
+func (s *Store) UpsertRetryPolicy(ctx context.Context, policy models.RetryPolicy) (*models.RetryPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy.RetryOn = append([]string{}, policy.RetryOn...)
+	policy.UpdatedAt = s.clock.Now()
+	s.retryPolicies[appKey{policy.Domain, policy.AppName}] = policy
+	return &policy, nil
+}
+
+// GetRetryPolicy gets an app's retry policy
+func (s *Store) GetRetryPolicy(ctx context.Context, domain, appName string) (*models.RetryPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.retryPolicies[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("retry policy not found")
+	}
+	policy.RetryOn = append([]string{}, policy.RetryOn...)
+	return &policy, nil
+}
+
+// DeleteRetryPolicy deletes an app's retry policy; retries already scheduled
+// still run
+func (s *Store) DeleteRetryPolicy(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.retryPolicies[key]; !ok {
+		return fmt.Errorf("retry policy not found")
+	}
+	delete(s.retryPolicies, key)
+	return nil
+}
+
+// scheduleRetry schedules the next attempt of a deployment that just failed,
+// if its app has a retry policy with attempts left that retries its failure
+func (s *Store) scheduleRetry(d *models.Deployment) {
+	policy, ok := s.retryPolicies[appKey{d.Domain, d.AppName}]
+	if !ok {
+		return
+	}
+
+	if !policy.Retries(d.Failure) {
+		message := "retry skipped: failed without an error code"
+		if d.Failure != nil {
+			message = "retry skipped: error code " + d.Failure.Code + " is not retried by the policy"
+		}
+		s.recordEvent(d.ID, models.EventRetrySkipped, message, 0)
+		return
+	}
+
+	state, ok := s.retries[d.ID]
+	if !ok {
+		state = &retryState{attempts: 1}
+		s.retries[d.ID] = state
+	}
+
+	if state.attempts >= policy.MaxAttempts {
+		message := fmt.Sprintf("attempt %d of %d failed; no retries left", state.attempts, policy.MaxAttempts)
+		s.recordEvent(d.ID, models.EventRetriesExhausted, message, state.attempts)
+		return
+	}
+
+	delay := policy.Backoff(state.attempts, rand.Float64())
+	next := s.clock.Now().Add(delay)
+	state.nextRetryAt = &next
+
+	message := fmt.Sprintf("attempt %d of %d failed; retrying in %s", state.attempts, policy.MaxAttempts, delay.Round(time.Second))
+	s.recordEvent(d.ID, models.EventRetryScheduled, message, state.attempts)
+}
+
+// RunDueRetries resets failed deployments whose retry is due to pending so
+// agents pick them up again. A retry is skipped when the deployment is no
+// longer failed or a newer version of the app exists.
+func (s *Store) RunDueRetries(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	var due []uuid.UUID
+	for id, state := range s.retries {
+		if state.nextRetryAt != nil && !state.nextRetryAt.After(now) {
+			due = append(due, id)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return s.retries[due[i]].nextRetryAt.Before(*s.retries[due[j]].nextRetryAt) })
+	if len(due) > 100 {
+		due = due[:100]
+	}
+
+	retried := 0
+	for _, id := range due {
+		state := s.retries[id]
+		d := s.findDeployment(id)
+		latest := s.latestDeployment(d.Domain, d.AppName).Version
+
+		eventType, attempt := models.EventRetried, state.attempts+1
+		message := fmt.Sprintf("retrying: attempt %d", attempt)
+		switch {
+		case d.Status != "failed":
+			eventType, attempt = models.EventRetrySkipped, state.attempts
+			message = "retry skipped: status is now " + d.Status
+		case d.Version < latest:
+			eventType, attempt = models.EventRetrySkipped, state.attempts
+			message = fmt.Sprintf("retry skipped: superseded by version %d", latest)
+		}
+
+		state.attempts, state.nextRetryAt = attempt, nil
+		if eventType == models.EventRetried {
+			s.setStatus(d, "pending")
+			d.DeployedAt, d.Verification, d.VerifiedAt, d.Failure = nil, "", nil, nil
+			retried++
+		}
+		s.recordEvent(id, eventType, message, attempt)
+	}
+
+	if retried > 0 {
+		s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	}
+	return retried, nil
+}
+
+// statusSince is when a deployment entered its current status, as stamped
+// by every status change
+func (s *Store) statusSince(d *models.Deployment) time.Time {
+	return s.statusChangedAt[d.ID]
+}
+
+// stuckDeployments lists up to limit deployments that have been in status
+// since before the given time, oldest first. An empty domain matches every
+// domain.
+func (s *Store) stuckDeployments(status string, before time.Time, domain string, limit int) []*models.Deployment {
+	var stuck []*models.Deployment
+	since := map[uuid.UUID]time.Time{}
+	for _, d := range s.deployments {
+		if d.Status != status || domain != "" && d.Domain != domain {
+			continue
+		}
+		if at := s.statusSince(d); at.Before(before) {
+			since[d.ID] = at
+			stuck = append(stuck, d)
+		}
+	}
+	sort.Slice(stuck, func(i, j int) bool {
+		a, b := since[stuck[i].ID], since[stuck[j].ID]
+		return a.Before(b) || a.Equal(b) && stuck[i].ID.String() < stuck[j].ID.String()
+	})
+	if len(stuck) > limit {
+		stuck = stuck[:limit]
+	}
+	return stuck
+}
+
+// stuckDeployment describes a stuck deployment before its status changes
+func (s *Store) stuckDeployment(d *models.Deployment) models.StuckDeployment {
+	return models.StuckDeployment{
+		ID: d.ID, Domain: d.Domain, AppName: d.AppName, Version: d.Version,
+		Status: d.Status, StatusSince: s.statusSince(d),
+	}
+}
+
+// RequeueDeployments resets up to limit deployments that have been in status
+// since before the given time back to pending, recording the change on each
+// one's timeline. An empty domain matches every domain. Deployments
+// superseded by a newer version of their app are listed but left alone. With
+// dryRun nothing is changed.
+func (s *Store) RequeueDeployments(ctx context.Context, status string, before time.Time, domain string, limit int, dryRun bool, actor string) ([]models.StuckDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments := []models.StuckDeployment{}
+	for _, d := range s.stuckDeployments(status, before, domain, limit) {
+		stuck := s.stuckDeployment(d)
+		if latest := s.latestDeployment(d.Domain, d.AppName).Version; d.Version < latest {
+			stuck.Skipped = fmt.Sprintf("superseded by version %d", latest)
+		} else if !dryRun {
+			s.setStatus(d, "pending")
+			d.DeployedAt, d.Verification, d.VerifiedAt, d.Failure = nil, "", nil, nil
+
+			message := fmt.Sprintf("status changed from %s to pending (requeued)", status)
+			if actor != "" {
+				message = fmt.Sprintf("status changed from %s to pending (requeued by %s)", status, actor)
+			}
+			s.recordStatusChange(d.ID, status, "pending", message)
+		}
+		deployments = append(deployments, stuck)
+	}
+
+	if !dryRun && len(deployments) > 0 {
+		s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	}
+	return deployments, nil
+}
+
+// MarkStuckDeployments moves up to limit deployments that have been in
+// status since before the given time to stalled, or to failed with the given
+// failure, recording the change on each one's timeline. Failed deployments
+// are retried as their app's retry policy says.
+func (s *Store) MarkStuckDeployments(ctx context.Context, status string, before time.Time, to string, failure *models.DeploymentFailure, limit int) ([]models.StuckDeployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments := []models.StuckDeployment{}
+	for _, d := range s.stuckDeployments(status, before, "", limit) {
+		stuck := s.stuckDeployment(d)
+
+		s.setStatus(d, to)
+		d.Failure = nil
+		if failure != nil {
+			c := *failure
+			c.Details = cloneJSON(failure.Details)
+			d.Failure = &c
+		}
+
+		message := fmt.Sprintf("status changed from %s to %s (no status update since %s)", status, to, stuck.StatusSince.UTC().Format(time.RFC3339))
+		s.recordStatusChange(d.ID, status, to, message)
+
+		if to == "failed" {
+			s.scheduleRetry(d)
+		}
+		deployments = append(deployments, stuck)
+	}
+
+	if len(deployments) > 0 {
+		s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	}
+	return deployments, nil
+}
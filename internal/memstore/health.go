@@ -0,0 +1,576 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// UpsertHealthCheck creates or replaces an app's health check
+func (s *Store) UpsertHealthCheck(ctx context.Context, check models.HealthCheck) (*models.HealthCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check.Command = append([]string{}, check.Command...)
+	check.UpdatedAt = s.clock.Now()
+	s.healthChecks[appKey{check.Domain, check.AppName}] = check
+
+	check.Command = slices.Clone(check.Command)
+	return &check, nil
+}
+
+// GetHealthCheck gets an app's health check
+func (s *Store) GetHealthCheck(ctx context.Context, domain, appName string) (*models.HealthCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check, ok := s.healthChecks[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("health check not found")
+	}
+	check.Command = slices.Clone(check.Command)
+	return &check, nil
+}
+
+// ListHealthChecks lists the health checks of a type, or of every type when
+// checkType is empty, ordered by domain and app name
+func (s *Store) ListHealthChecks(ctx context.Context, checkType string) ([]models.HealthCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checks := []models.HealthCheck{}
+	for _, key := range sortedKeys(s.healthChecks) {
+		if check := s.healthChecks[key]; checkType == "" || check.Type == checkType {
+			check.Command = slices.Clone(check.Command)
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// DeleteHealthCheck deletes an app's health check
+func (s *Store) DeleteHealthCheck(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.healthChecks[key]; !ok {
+		return fmt.Errorf("health check not found")
+	}
+	delete(s.healthChecks, key)
+	return nil
+}
+
+// cloneProbe copies a health probe so callers never share its pointers
+func cloneProbe(probe models.HealthProbe) models.HealthProbe {
+	if probe.DeploymentID != nil {
+		id := *probe.DeploymentID
+		probe.DeploymentID = &id
+	}
+	if probe.LatencyMs != nil {
+		latency := *probe.LatencyMs
+		probe.LatencyMs = &latency
+	}
+	return probe
+}
+
+// openIncident returns an app's open incident, or nil
+func (s *Store) openIncident(domain, appName string) *models.Incident {
+	for _, incident := range s.incidents {
+		if incident.Domain == domain && incident.AppName == appName && incident.ResolvedAt == nil {
+			return incident
+		}
+	}
+	return nil
+}
+
+// RecordHealthProbe stores the result of an agent's health probe of an app
+// and, when it is the app's latest probe, opens an incident for an unhealthy
+// app or resolves its open incident for a healthy one
+func (s *Store) RecordHealthProbe(ctx context.Context, probe models.HealthProbe) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probe = cloneProbe(probe)
+	s.probes = append(s.probes, probe)
+
+	// Probes reported late must not reopen or resolve incidents out of order
+	for _, p := range s.probes {
+		if p.Domain == probe.Domain && p.AppName == probe.AppName && p.CheckedAt.After(probe.CheckedAt) {
+			return nil
+		}
+	}
+
+	open := s.openIncident(probe.Domain, probe.AppName)
+	switch {
+	case probe.Healthy && open != nil && !open.StartedAt.After(probe.CheckedAt):
+		resolvedAt := probe.CheckedAt
+		open.ResolvedAt = &resolvedAt
+	case !probe.Healthy && open == nil:
+		s.nextIncidentID++
+		incident := &models.Incident{
+			ID:        s.nextIncidentID,
+			Domain:    probe.Domain,
+			AppName:   probe.AppName,
+			StartedAt: probe.CheckedAt,
+		}
+		if probe.DeploymentID != nil {
+			id := *probe.DeploymentID
+			incident.DeploymentID = &id
+		}
+		s.incidents = append(s.incidents, incident)
+	}
+	return nil
+}
+
+// ListLatestHealthProbes lists the latest health probe of every app
+func (s *Store) ListLatestHealthProbes(ctx context.Context) ([]models.HealthProbe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := map[appKey]models.HealthProbe{}
+	for _, probe := range s.probes {
+		key := appKey{probe.Domain, probe.AppName}
+		if current, ok := latest[key]; !ok || probe.CheckedAt.After(current.CheckedAt) {
+			latest[key] = probe
+		}
+	}
+
+	probes := []models.HealthProbe{}
+	for _, key := range sortedKeys(latest) {
+		probes = append(probes, cloneProbe(latest[key]))
+	}
+	return probes, nil
+}
+
+// GetSLACounts counts each app's health probes, pushed deployments and
+// incidents since the given time, ordered by domain and app name. Apps with
+// none are left out.
+func (s *Store) GetSLACounts(ctx context.Context, since time.Time) ([]models.SLACounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps := map[appKey]*models.SLACounts{}
+	counts := func(domain, appName string) *models.SLACounts {
+		key := appKey{domain, appName}
+		if apps[key] == nil {
+			apps[key] = &models.SLACounts{Domain: domain, AppName: appName}
+		}
+		return apps[key]
+	}
+
+	for _, probe := range s.probes {
+		if !probe.CheckedAt.Before(since) {
+			c := counts(probe.Domain, probe.AppName)
+			c.Probes++
+			if probe.Healthy {
+				c.HealthyProbes++
+			}
+		}
+	}
+	for _, d := range s.deployments {
+		if !d.CreatedAt.Before(since) {
+			c := counts(d.Domain, d.AppName)
+			c.Deployments++
+			if d.Status == "failed" {
+				c.FailedDeployments++
+			}
+		}
+	}
+
+	now := s.clock.Now()
+	for _, incident := range s.incidents {
+		end := now
+		if incident.ResolvedAt != nil {
+			end = *incident.ResolvedAt
+		}
+		if end.After(since) {
+			c := counts(incident.Domain, incident.AppName)
+			c.Incidents++
+			c.Downtime += end.Sub(maxTime(incident.StartedAt, since))
+		}
+	}
+
+	result := []models.SLACounts{}
+	for _, key := range sortedKeys(apps) {
+		result = append(result, *apps[key])
+	}
+	return result, nil
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// latencyPercentiles computes the sample count and percentiles of
+// latencies, interpolating like Postgres's percentile_cont
+func latencyPercentiles(latencies []float64) models.LatencyPercentiles {
+	slices.Sort(latencies)
+	percentile := func(p float64) float64 {
+		pos := p * float64(len(latencies)-1)
+		lower := int(math.Floor(pos))
+		upper := min(lower+1, len(latencies)-1)
+		return latencies[lower] + (latencies[upper]-latencies[lower])*(pos-float64(lower))
+	}
+	return models.LatencyPercentiles{
+		Samples: len(latencies),
+		P50:     percentile(0.5),
+		P90:     percentile(0.9),
+		P99:     percentile(0.99),
+	}
+}
+
+// GetLatencySeries computes the latency percentiles of an app's health
+// probes since the given time in steps of the given length, oldest first.
+// Steps without timed probes are left out.
+func (s *Store) GetLatencySeries(ctx context.Context, domain, appName string, since time.Time, step time.Duration) ([]models.LatencyPoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Steps are aligned to the Unix epoch, as in Postgres
+	steps := map[float64][]float64{}
+	for _, probe := range s.probes {
+		if probe.Domain == domain && probe.AppName == appName && !probe.CheckedAt.Before(since) && probe.LatencyMs != nil {
+			epoch := float64(probe.CheckedAt.UnixNano()) / float64(time.Second)
+			start := math.Floor(epoch/step.Seconds()) * step.Seconds()
+			steps[start] = append(steps[start], *probe.LatencyMs)
+		}
+	}
+
+	points := []models.LatencyPoint{}
+	for _, start := range slices.Sorted(maps.Keys(steps)) {
+		points = append(points, models.LatencyPoint{
+			Time:               time.Unix(0, int64(start*float64(time.Second))),
+			LatencyPercentiles: latencyPercentiles(steps[start]),
+		})
+	}
+	return points, nil
+}
+
+// GetDeploymentLatencies computes the latency percentiles of an app's
+// health probes since the given time per deployment probed, oldest version
+// first
+func (s *Store) GetDeploymentLatencies(ctx context.Context, domain, appName string, since time.Time) ([]models.DeploymentLatency, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byDeployment := map[uuid.UUID][]float64{}
+	for _, probe := range s.probes {
+		if probe.Domain == domain && probe.AppName == appName && !probe.CheckedAt.Before(since) &&
+			probe.LatencyMs != nil && probe.DeploymentID != nil {
+			byDeployment[*probe.DeploymentID] = append(byDeployment[*probe.DeploymentID], *probe.LatencyMs)
+		}
+	}
+
+	latencies := []models.DeploymentLatency{}
+	for id, samples := range byDeployment {
+		d := s.findDeployment(id)
+		if d == nil {
+			continue
+		}
+		latencies = append(latencies, models.DeploymentLatency{
+			DeploymentID:       d.ID,
+			Version:            d.Version,
+			DeployedAt:         cloneTime(d.DeployedAt),
+			LatencyPercentiles: latencyPercentiles(samples),
+		})
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].Version < latencies[j].Version })
+	return latencies, nil
+}
+
+// PruneHealthProbes deletes the health probes checked before the given time
+// and returns how many were deleted
+func (s *Store) PruneHealthProbes(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.probes)
+	s.probes = slices.DeleteFunc(s.probes, func(p models.HealthProbe) bool { return p.CheckedAt.Before(before) })
+	return int64(n - len(s.probes)), nil
+}
+
+// ListIncidents lists incidents newest first, of one app when domain and
+// appName are set, and only those still open when openOnly is set
+func (s *Store) ListIncidents(ctx context.Context, domain, appName string, openOnly bool, limit int) ([]models.Incident, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	incidents := []models.Incident{}
+	for _, incident := range s.incidents {
+		if (domain == "" || incident.Domain == domain && incident.AppName == appName) && (!openOnly || incident.ResolvedAt == nil) {
+			i := *incident
+			i.ResolvedAt = cloneTime(incident.ResolvedAt)
+			if incident.DeploymentID != nil {
+				id := *incident.DeploymentID
+				i.DeploymentID = &id
+			}
+			incidents = append(incidents, i)
+		}
+	}
+	sort.Slice(incidents, func(i, j int) bool {
+		a, b := incidents[i], incidents[j]
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.After(b.StartedAt)
+		}
+		return a.ID > b.ID
+	})
+	return incidents[:min(len(incidents), limit)], nil
+}
+
+// PruneIncidents deletes the incidents resolved before the given time and
+// returns how many were deleted
+func (s *Store) PruneIncidents(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.incidents)
+	s.incidents = slices.DeleteFunc(s.incidents, func(i *models.Incident) bool {
+		return i.ResolvedAt != nil && i.ResolvedAt.Before(before)
+	})
+	return int64(n - len(s.incidents)), nil
+}
+
+// UpsertSmokeTest creates or replaces an app's smoke test
+func (s *Store) UpsertSmokeTest(ctx context.Context, test models.SmokeTest) (*models.SmokeTest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	test.Command = append([]string{}, test.Command...)
+	test.UpdatedAt = s.clock.Now()
+	s.smokeTests[appKey{test.Domain, test.AppName}] = test
+
+	test.Command = slices.Clone(test.Command)
+	return &test, nil
+}
+
+// GetSmokeTest gets an app's smoke test
+func (s *Store) GetSmokeTest(ctx context.Context, domain, appName string) (*models.SmokeTest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	test, ok := s.smokeTests[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("smoke test not found")
+	}
+	test.Command = slices.Clone(test.Command)
+	return &test, nil
+}
+
+// DeleteSmokeTest deletes an app's smoke test
+func (s *Store) DeleteSmokeTest(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.smokeTests[key]; !ok {
+		return fmt.Errorf("smoke test not found")
+	}
+	delete(s.smokeTests, key)
+	return nil
+}
+
+// smokeTestRun describes the run of an app's smoke test against d
+func smokeTestRun(d *models.Deployment, test models.SmokeTest, startedAt *time.Time) models.SmokeTestRun {
+	test.Command = slices.Clone(test.Command)
+	return models.SmokeTestRun{
+		DeploymentID: d.ID,
+		Domain:       d.Domain,
+		AppName:      d.AppName,
+		Version:      d.Version,
+		Port:         d.Port,
+		Test:         test,
+		StartedAt:    cloneTime(startedAt),
+	}
+}
+
+// ListDueSmokeTests lists the deployments deployed since the given time
+// whose app has a smoke test they have not started, oldest first
+func (s *Store) ListDueSmokeTests(ctx context.Context, since time.Time) ([]models.SmokeTestRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*models.Deployment
+	for _, d := range s.deployments {
+		if d.Status != "deployed" || d.DeployedAt == nil || d.DeployedAt.Before(since) || s.smokeResults[d.ID] != nil {
+			continue
+		}
+		if _, ok := s.smokeTests[appKey{d.Domain, d.AppName}]; ok {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].DeployedAt.Before(*due[j].DeployedAt) })
+
+	runs := []models.SmokeTestRun{}
+	for _, d := range due {
+		runs = append(runs, smokeTestRun(d, s.smokeTests[appKey{d.Domain, d.AppName}], nil))
+	}
+	return runs, nil
+}
+
+// ListRunningSmokeTests lists the running smoke tests of a type, or of
+// every type when testType is empty, oldest first
+func (s *Store) ListRunningSmokeTests(ctx context.Context, testType string) ([]models.SmokeTestRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []models.SmokeTestRun{}
+	for id, result := range s.smokeResults {
+		if result.Status != models.SmokeRunning {
+			continue
+		}
+		d := s.findDeployment(id)
+		if d == nil {
+			continue
+		}
+		if test, ok := s.smokeTests[appKey{d.Domain, d.AppName}]; ok && (testType == "" || test.Type == testType) {
+			runs = append(runs, smokeTestRun(d, test, &result.StartedAt))
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.Before(*runs[j].StartedAt) })
+	return runs, nil
+}
+
+// StartSmokeTest records a deployment's smoke test as running, reporting
+// false when it was already started
+func (s *Store) StartSmokeTest(ctx context.Context, deploymentID uuid.UUID, agent string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.smokeResults[deploymentID] != nil {
+		return false, nil
+	}
+	if s.findDeployment(deploymentID) == nil {
+		return false, fmt.Errorf("failed to start smoke test: deployment not found")
+	}
+
+	s.smokeResults[deploymentID] = &models.SmokeTestResult{
+		DeploymentID: deploymentID,
+		Status:       models.SmokeRunning,
+		Agent:        agent,
+		StartedAt:    s.clock.Now(),
+	}
+	return true, nil
+}
+
+// FinishSmokeTest records the outcome of a deployment's running smoke test
+// and adds it to the deployment's timeline
+func (s *Store) FinishSmokeTest(ctx context.Context, deploymentID uuid.UUID, status, message, agent string) (*models.SmokeTestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.smokeResults[deploymentID]
+	if result == nil || result.Status != models.SmokeRunning {
+		return nil, fmt.Errorf("smoke test not running")
+	}
+
+	now := s.clock.Now()
+	result.Status, result.Message, result.Agent, result.FinishedAt = status, message, agent, &now
+
+	eventType := models.EventSmokePassed
+	if status == models.SmokeFailed {
+		eventType = models.EventSmokeFailed
+	}
+	s.recordEvent(deploymentID, eventType, message, 0)
+
+	c := *result
+	c.FinishedAt = cloneTime(result.FinishedAt)
+	return &c, nil
+}
+
+// GetSmokeTestResult gets the outcome of a deployment's smoke test
+func (s *Store) GetSmokeTestResult(ctx context.Context, deploymentID uuid.UUID) (*models.SmokeTestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.smokeResults[deploymentID]
+	if result == nil {
+		return nil, fmt.Errorf("smoke test result not found")
+	}
+	c := *result
+	c.FinishedAt = cloneTime(result.FinishedAt)
+	return &c, nil
+}
+
+// ListVerifyingDeployments lists the deployed deployments being verified,
+// and those deployed since the given time that are not verified yet
+func (s *Store) ListVerifyingDeployments(ctx context.Context, since time.Time) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments := []models.Deployment{}
+	for _, d := range s.deployments {
+		if d.Status != "deployed" {
+			continue
+		}
+		if d.Verification == models.VerificationVerifying ||
+			d.Verification == "" && d.DeployedAt != nil && !d.DeployedAt.Before(since) {
+			deployments = append(deployments, cloneDeployment(d))
+		}
+	}
+	sort.SliceStable(deployments, func(i, j int) bool {
+		a, b := deployments[i].DeployedAt, deployments[j].DeployedAt
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	return deployments, nil
+}
+
+// CountDeploymentProbes counts the health probes of a deployment checked in
+// [from, to) and how many of them were unhealthy
+func (s *Store) CountDeploymentProbes(ctx context.Context, id uuid.UUID, from, to time.Time) (total, unhealthy int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, probe := range s.probes {
+		if probe.DeploymentID != nil && *probe.DeploymentID == id && !probe.CheckedAt.Before(from) && probe.CheckedAt.Before(to) {
+			total++
+			if !probe.Healthy {
+				unhealthy++
+			}
+		}
+	}
+	return total, unhealthy, nil
+}
+
+// SetDeploymentVerification moves a deployed deployment to a verification
+// state. Reaching verified or degraded stamps verified_at and records an
+// event with the given message. Deployments no longer deployed are left
+// alone.
+func (s *Store) SetDeploymentVerification(ctx context.Context, id uuid.UUID, verification, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.findDeployment(id)
+	if d == nil || d.Status != "deployed" {
+		return fmt.Errorf("deployment not found")
+	}
+
+	final := verification != models.VerificationVerifying
+	d.Verification, d.VerifiedAt = verification, nil
+	if final {
+		now := s.clock.Now()
+		d.VerifiedAt = &now
+
+		eventType := models.EventVerified
+		if verification == models.VerificationDegraded {
+			eventType = models.EventDegraded
+		}
+		s.recordEvent(id, eventType, message, 0)
+	}
+
+	s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	return nil
+}
@@ -0,0 +1,199 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// UpsertImagePolicy creates or replaces an app's image policy, clearing the
+// outcome of earlier checks
+func (s *Store) UpsertImagePolicy(ctx context.Context, policy models.ImagePolicy) (*models.ImagePolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := models.ImagePolicy{
+		Domain:    policy.Domain,
+		AppName:   policy.AppName,
+		Kind:      policy.Kind,
+		Pattern:   policy.Pattern,
+		UpdatedAt: s.clock.Now(),
+	}
+	s.imagePolicies[appKey{policy.Domain, policy.AppName}] = stored
+	return &stored, nil
+}
+
+// GetImagePolicy gets an app's image policy
+func (s *Store) GetImagePolicy(ctx context.Context, domain, appName string) (*models.ImagePolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.imagePolicies[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("image policy not found")
+	}
+	policy.LastCheckedAt = cloneTime(policy.LastCheckedAt)
+	return &policy, nil
+}
+
+// ListImagePolicies lists all image policies ordered by domain and app name
+func (s *Store) ListImagePolicies(ctx context.Context) ([]models.ImagePolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies := []models.ImagePolicy{}
+	for _, key := range sortedKeys(s.imagePolicies) {
+		policy := s.imagePolicies[key]
+		policy.LastCheckedAt = cloneTime(policy.LastCheckedAt)
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// DeleteImagePolicy deletes an app's image policy
+func (s *Store) DeleteImagePolicy(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.imagePolicies[key]; !ok {
+		return fmt.Errorf("image policy not found")
+	}
+	delete(s.imagePolicies, key)
+	return nil
+}
+
+// RecordImagePolicyCheck stores the outcome of checking an image policy:
+// the image it settled on, or why it failed
+func (s *Store) RecordImagePolicyCheck(ctx context.Context, domain, appName, image, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	policy, ok := s.imagePolicies[key]
+	if !ok {
+		return nil
+	}
+
+	now := s.clock.Now()
+	policy.LastCheckedAt, policy.LastError = &now, errMsg
+	if image != "" {
+		policy.LastImage = image
+	}
+	s.imagePolicies[key] = policy
+	return nil
+}
+
+// RecordImageDigest stores the digests of an app's deployed tag. A
+// non-empty DeployedDigest, recorded when the deployment went live, sets
+// its deployed digest; periodic checks leave it empty to keep the one
+// recorded for the same deployment, and without one nothing drifts. A
+// failed check (empty RegistryDigest) keeps the registry digest of earlier
+// checks.
+func (s *Store) RecordImageDigest(ctx context.Context, digest models.ImageDigest) (*models.ImageDigest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{digest.Domain, digest.AppName}
+	stored := models.ImageDigest{
+		Domain:         digest.Domain,
+		AppName:        digest.AppName,
+		DeployedDigest: digest.DeployedDigest,
+		RegistryDigest: digest.RegistryDigest,
+	}
+	if previous, ok := s.imageDigests[key]; ok && previous.DeploymentID == digest.DeploymentID {
+		if stored.DeployedDigest == "" {
+			stored.DeployedDigest = previous.DeployedDigest
+		}
+		if digest.RegistryDigest == "" {
+			stored.RegistryDigest = previous.RegistryDigest
+		}
+	}
+
+	stored.DeploymentID, stored.DockerImage, stored.Error, stored.CheckedAt = digest.DeploymentID, digest.DockerImage, digest.Error, s.clock.Now()
+	stored.Drifted = stored.DeployedDigest != "" && stored.RegistryDigest != "" && stored.DeployedDigest != stored.RegistryDigest
+	s.imageDigests[key] = stored
+	return &stored, nil
+}
+
+// ListImageDigests lists tracked image digests ordered by domain and app
+// name, optionally only those that drifted
+func (s *Store) ListImageDigests(ctx context.Context, driftedOnly bool) ([]models.ImageDigest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digests := []models.ImageDigest{}
+	for _, key := range sortedKeys(s.imageDigests) {
+		if digest := s.imageDigests[key]; !driftedOnly || digest.Drifted {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+// PruneImageDigests deletes the digests tracked for deployments other than
+// keep, such as superseded versions
+func (s *Store) PruneImageDigests(ctx context.Context, keep []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, digest := range s.imageDigests {
+		if !slices.Contains(keep, digest.DeploymentID) {
+			delete(s.imageDigests, key)
+		}
+	}
+	return nil
+}
+
+// cloneObservedState copies a report so callers never share its pointers
+func cloneObservedState(state models.ObservedState) models.ObservedState {
+	if state.DeploymentID != nil {
+		id := *state.DeploymentID
+		state.DeploymentID = &id
+	}
+	return state
+}
+
+// RecordObservedState stores an agent's report of what runs for an app,
+// replacing its previous report
+func (s *Store) RecordObservedState(ctx context.Context, state models.ObservedState) (*models.ObservedState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state = cloneObservedState(state)
+	state.ReportedAt = s.clock.Now()
+	s.observed[appKey{state.Domain, state.AppName}] = state
+
+	stored := cloneObservedState(state)
+	return &stored, nil
+}
+
+// GetObservedState gets the latest report for an app
+func (s *Store) GetObservedState(ctx context.Context, domain, appName string) (*models.ObservedState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.observed[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("observed state not found")
+	}
+	state = cloneObservedState(state)
+	return &state, nil
+}
+
+// ListObservedStates lists the latest report of every app ordered by domain
+// and app name
+func (s *Store) ListObservedStates(ctx context.Context) ([]models.ObservedState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := []models.ObservedState{}
+	for _, key := range sortedKeys(s.observed) {
+		states = append(states, cloneObservedState(s.observed[key]))
+	}
+	return states, nil
+}
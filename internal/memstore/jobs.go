@@ -0,0 +1,377 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// cloneJob copies a job so callers never share its slices or pointers
+func cloneJob(job *models.Job) *models.Job {
+	c := *job
+	c.Payload = slices.Clone(job.Payload)
+	c.Result = slices.Clone(job.Result)
+	c.StartedAt = cloneTime(job.StartedAt)
+	c.FinishedAt = cloneTime(job.FinishedAt)
+	c.LeaseExpiresAt = cloneTime(job.LeaseExpiresAt)
+	return &c
+}
+
+// findJob returns the stored job with the given ID, or nil
+func (s *Store) findJob(id uuid.UUID) *models.Job {
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// runningJob returns the stored job with the given ID if it is running the
+// given attempt, or nil
+func (s *Store) runningJob(id uuid.UUID, attempt int) *models.Job {
+	job := s.findJob(id)
+	if job == nil || job.Attempts != attempt || job.Status != models.JobStatusRunning {
+		return nil
+	}
+	return job
+}
+
+// EnqueueJob queues a background job for the worker pool; workers take
+// more urgent priorities first
+func (s *Store) EnqueueJob(ctx context.Context, jobType, priority string, payload []byte, total int) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	job := &models.Job{
+		ID:        uuid.New(),
+		Type:      jobType,
+		Status:    models.JobStatusQueued,
+		Priority:  priority,
+		Payload:   slices.Clone(payload),
+		Total:     total,
+		CreatedAt: now,
+		RunAfter:  now,
+	}
+	s.jobs = append(s.jobs, job)
+	s.notify(database.JobsChannel, jobType)
+	return cloneJob(job), nil
+}
+
+// GetJob gets a job by ID
+func (s *Store) GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.findJob(id)
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+	return cloneJob(job), nil
+}
+
+// ClaimJob marks the most urgent, then oldest, job of one of the given types
+// that is queued and due, or running with a lapsed lease, as running under a
+// lease for the given duration, counting the attempt, and returns it, or
+// returns nil when there is nothing to do
+func (s *Store) ClaimJob(ctx context.Context, types []string, lease time.Duration) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	var claimed *models.Job
+	for _, job := range s.jobs {
+		due := job.Status == models.JobStatusQueued && !job.RunAfter.After(now)
+		lapsed := job.Status == models.JobStatusRunning && job.LeaseExpiresAt != nil && job.LeaseExpiresAt.Before(now)
+		if !due && !lapsed || !slices.Contains(types, job.Type) {
+			continue
+		}
+		if claimed == nil {
+			claimed = job
+			continue
+		}
+		if ra, rb := models.PriorityRank(job.Priority), models.PriorityRank(claimed.Priority); ra < rb || ra == rb && job.CreatedAt.Before(claimed.CreatedAt) {
+			claimed = job
+		}
+	}
+	if claimed == nil {
+		return nil, nil
+	}
+
+	expires := now.Add(lease)
+	claimed.Status, claimed.StartedAt, claimed.LeaseExpiresAt = models.JobStatusRunning, &now, &expires
+	claimed.Attempts++
+	return cloneJob(claimed), nil
+}
+
+// RenewJobLease extends the lease of a running job by the given duration.
+// attempt is the attempt the caller is running; once the job has been
+// claimed again, or has finished, it returns "job not found".
+func (s *Store) RenewJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.runningJob(id, attempt)
+	if job == nil {
+		return fmt.Errorf("job not found")
+	}
+	expires := s.clock.Now().Add(lease)
+	job.LeaseExpiresAt = &expires
+	return nil
+}
+
+// UpdateJobProgress records how many items of a running job have been
+// processed. Like RenewJobLease, it returns "job not found" once attempt is
+// no longer the job's running attempt.
+func (s *Store) UpdateJobProgress(ctx context.Context, id uuid.UUID, attempt, processed int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.runningJob(id, attempt)
+	if job == nil {
+		return fmt.Errorf("job not found")
+	}
+	job.Processed = processed
+	return nil
+}
+
+// FinishJob records the outcome of a run and returns the job's new status.
+// A queued status schedules another attempt after retryAfter, keeping the
+// error and result of this one. A job that did not succeed after being asked
+// to stop is recorded as cancelled. Like RenewJobLease, it returns "job not
+// found" once attempt is no longer the job's running attempt, so a run that
+// lost its lease can't overwrite the outcome of the one that replaced it.
+func (s *Store) FinishJob(ctx context.Context, id uuid.UUID, attempt int, status string, result []byte, errMsg string, retryAfter time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.runningJob(id, attempt)
+	if job == nil {
+		return "", fmt.Errorf("job not found")
+	}
+
+	now := s.clock.Now()
+	job.Status = status
+	if job.CancelRequested && status != models.JobStatusSucceeded {
+		job.Status = models.JobStatusCancelled
+	}
+	job.Result, job.Error = slices.Clone(result), errMsg
+	job.RunAfter, job.LeaseExpiresAt = now.Add(retryAfter), nil
+	if status == models.JobStatusQueued {
+		job.Processed, job.FinishedAt = 0, nil
+	} else {
+		job.Processed, job.FinishedAt = job.Total, &now
+	}
+
+	if job.Status == models.JobStatusQueued {
+		s.notify(database.JobsChannel, job.Type)
+	}
+	return job.Status, nil
+}
+
+// RequeueJob hands a job interrupted by shutdown back to the queue without
+// using up an attempt. A job that was asked to stop is recorded as cancelled
+// instead. Like FinishJob, it only applies to the job's running attempt.
+func (s *Store) RequeueJob(ctx context.Context, id uuid.UUID, attempt int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.runningJob(id, attempt)
+	if job == nil {
+		return "", fmt.Errorf("job not found")
+	}
+
+	now := s.clock.Now()
+	job.Error, job.Processed, job.RunAfter, job.LeaseExpiresAt = "interrupted by shutdown", 0, now, nil
+	if job.CancelRequested {
+		job.Status, job.FinishedAt = models.JobStatusCancelled, &now
+		return job.Status, nil
+	}
+
+	job.Status, job.FinishedAt = models.JobStatusQueued, nil
+	job.Attempts = max(job.Attempts-1, 0)
+	s.notify(database.JobsChannel, job.Type)
+	return job.Status, nil
+}
+
+// ListJobs lists jobs newest first, optionally filtered by status and type,
+// resuming after the cursor when one is given
+func (s *Store) ListJobs(ctx context.Context, status, jobType string, after *models.Cursor, limit int) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := []models.Job{}
+	for _, job := range s.jobs {
+		if (status == "" || job.Status == status) && (jobType == "" || job.Type == jobType) && before(job.CreatedAt, job.ID, after) {
+			jobs = append(jobs, *cloneJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return newestFirst(jobs[i].CreatedAt, jobs[i].ID, jobs[j].CreatedAt, jobs[j].ID)
+	})
+	return jobs[:min(len(jobs), limit)], nil
+}
+
+// CancelJob cancels a queued job outright, or asks the worker running a
+// running job to stop it; the job's final status is recorded once it stops
+func (s *Store) CancelJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.findJob(id)
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+
+	switch job.Status {
+	case models.JobStatusQueued:
+		now := s.clock.Now()
+		job.Status, job.Error, job.FinishedAt = models.JobStatusCancelled, "cancelled by request", &now
+	case models.JobStatusRunning:
+		job.CancelRequested = true
+		s.notify(database.JobsCancelledChannel, job.ID.String())
+	default:
+		return nil, fmt.Errorf("job is not queued or running")
+	}
+	return cloneJob(job), nil
+}
+
+// RetryJob queues a failed, cancelled or dead-lettered job again with its
+// original payload and a fresh set of attempts
+func (s *Store) RetryJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.findJob(id)
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+	switch job.Status {
+	case models.JobStatusFailed, models.JobStatusCancelled, models.JobStatusDead:
+	default:
+		return nil, fmt.Errorf("job is not failed, cancelled or dead")
+	}
+
+	job.Status, job.Result, job.Error = models.JobStatusQueued, nil, ""
+	job.Processed, job.Attempts, job.RunAfter = 0, 0, s.clock.Now()
+	job.StartedAt, job.FinishedAt, job.CancelRequested = nil, nil, false
+	s.notify(database.JobsChannel, job.Type)
+	return cloneJob(job), nil
+}
+
+// AcquireLease takes or renews the named lease for holder, extending it by
+// ttl. The lease can only be taken over once it has expired. It returns the
+// current lease and whether holder now holds it.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*models.Lease, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	lease, ok := s.leases[name]
+	if ok && lease.Holder != holder && !lease.ExpiresAt.Before(now) {
+		return &lease, false, nil
+	}
+
+	if !ok || lease.Holder != holder {
+		lease = models.Lease{Name: name, Holder: holder, AcquiredAt: now}
+	}
+	lease.RenewedAt, lease.ExpiresAt = now, now.Add(ttl)
+	s.leases[name] = lease
+	return &lease, true, nil
+}
+
+// ReleaseLease gives up the named lease if holder holds it
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lease, ok := s.leases[name]; ok && lease.Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// GetLease gets the named lease if it has not expired
+func (s *Store) GetLease(ctx context.Context, name string) (*models.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[name]
+	if !ok || lease.ExpiresAt.Before(s.clock.Now()) {
+		return nil, fmt.Errorf("lease not found")
+	}
+	return &lease, nil
+}
+
+// cloneGitSync copies a git sync outcome through JSON, keeping the
+// declarations that are not part of its JSON form
+func cloneGitSync(status models.GitSyncStatus) (models.GitSyncStatus, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return models.GitSyncStatus{}, err
+	}
+	var c models.GitSyncStatus
+	if err := json.Unmarshal(data, &c); err != nil {
+		return models.GitSyncStatus{}, err
+	}
+
+	if status.Declared != nil {
+		if data, err = json.Marshal(status.Declared); err != nil {
+			return models.GitSyncStatus{}, err
+		}
+		if err := json.Unmarshal(data, &c.Declared); err != nil {
+			return models.GitSyncStatus{}, err
+		}
+	}
+	return c, nil
+}
+
+// RecordGitSync stores the outcome of a git sync, replacing the previous
+// outcome for the branch. The declared deployments are kept from the
+// previous sync when status has none, as when the fetch failed.
+func (s *Store) RecordGitSync(ctx context.Context, status models.GitSyncStatus) error {
+	stored, err := cloneGitSync(status)
+	if err != nil {
+		return fmt.Errorf("failed to encode git sync result: %w", err)
+	}
+	if stored.Deployments == nil {
+		stored.Deployments = []models.ImportItemResult{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored.Declared == nil {
+		stored.Declared = s.gitSyncs[status.Branch].Declared
+		if stored.Declared == nil {
+			stored.Declared = []models.DeploymentRequest{}
+		}
+	}
+	s.gitSyncs[status.Branch] = stored
+	return nil
+}
+
+// GetGitSync gets the outcome of the latest git sync of branch
+func (s *Store) GetGitSync(ctx context.Context, branch string) (*models.GitSyncStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.gitSyncs[branch]
+	if !ok {
+		return nil, fmt.Errorf("git sync not found")
+	}
+	status, err := cloneGitSync(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode git sync result: %w", err)
+	}
+	return &status, nil
+}
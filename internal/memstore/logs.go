@@ -0,0 +1,399 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// secretProjectRef matches the project of a ${secret:project/name}
+// reference in an env entry, like the pattern ListMissingSecretProjects
+// uses in Postgres
+var secretProjectRef = regexp.MustCompile(`=\$\{secret:([^/}:]+)/`)
+
+// AppendDeploymentLog stores the next chunk of a deployment's log. A chunk
+// repeating a stored one is returned as stored, so agents may retry
+// uploads; chunks that skip ahead, differ from the stored chunk of their
+// seq or grow the log past maxBytes are rejected.
+func (s *Store) AppendDeploymentLog(ctx context.Context, chunk models.DeploymentLogChunk, maxBytes int64) (*models.DeploymentLogChunk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findDeployment(chunk.DeploymentID) == nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	if _, ok := s.archivedLogs[chunk.DeploymentID]; ok {
+		return nil, fmt.Errorf("deployment log is archived")
+	}
+
+	chunks := s.logs[chunk.DeploymentID]
+	var size int64
+	for _, stored := range chunks {
+		if stored.Seq == chunk.Seq {
+			if stored.Content != chunk.Content {
+				return nil, fmt.Errorf("log chunk conflicts with the stored chunk")
+			}
+			return &stored, nil
+		}
+		size += int64(len(stored.Content))
+	}
+
+	if next := int64(len(chunks)); chunk.Seq != next {
+		return nil, fmt.Errorf("log chunk out of sequence: expected seq %d", next)
+	}
+	if size+int64(len(chunk.Content)) > maxBytes {
+		return nil, fmt.Errorf("log size limit exceeded")
+	}
+
+	chunk.CreatedAt = s.clock.Now()
+	s.logs[chunk.DeploymentID] = append(chunks, chunk)
+	s.notify(database.DeploymentLogsChannel, chunk.DeploymentID.String())
+	return &chunk, nil
+}
+
+// ListDeploymentLogs lists up to limit chunks of a deployment's log from
+// fromSeq, and through toSeq unless it is negative, in order
+func (s *Store) ListDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fromSeq, toSeq int64, limit int) ([]models.DeploymentLogChunk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chunks := []models.DeploymentLogChunk{}
+	for _, chunk := range s.logs[deploymentID] {
+		if len(chunks) >= limit {
+			break
+		}
+		if chunk.Seq >= fromSeq && (toSeq < 0 || chunk.Seq <= toSeq) {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// ArchiveDeploymentLog records a deployment log as moved to the blob store
+// and deletes its chunks. It fails with "deployment log changed" when the
+// log no longer has exactly archived.Chunks chunks.
+func (s *Store) ArchiveDeploymentLog(ctx context.Context, archived models.ArchivedDeploymentLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findDeployment(archived.DeploymentID) == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	if int64(len(s.logs[archived.DeploymentID])) != archived.Chunks {
+		return fmt.Errorf("deployment log changed")
+	}
+	if _, ok := s.archivedLogs[archived.DeploymentID]; ok {
+		return fmt.Errorf("failed to record archived log: deployment log is archived")
+	}
+
+	delete(s.logs, archived.DeploymentID)
+	archived.ArchivedAt = s.clock.Now()
+	s.archivedLogs[archived.DeploymentID] = archived
+	return nil
+}
+
+// GetArchivedDeploymentLog returns where a deployment's log was archived
+func (s *Store) GetArchivedDeploymentLog(ctx context.Context, deploymentID uuid.UUID) (*models.ArchivedDeploymentLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	archived, ok := s.archivedLogs[deploymentID]
+	if !ok {
+		return nil, fmt.Errorf("archived log not found")
+	}
+	return &archived, nil
+}
+
+// expiredLogs lists the deployments whose last log chunk was uploaded
+// before the given time, in ID order
+func (s *Store) expiredLogs(before time.Time) []uuid.UUID {
+	var ids []uuid.UUID
+	for id, chunks := range s.logs {
+		if len(chunks) > 0 && chunks[len(chunks)-1].CreatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+// prunableVersions lists every version of each app but its keep newest,
+// its newest deployed version and versions still pending or deploying, by
+// domain, app name and version
+func (s *Store) prunableVersions(keep int) []*models.Deployment {
+	byApp := map[appKey][]*models.Deployment{}
+	for _, d := range s.deployments {
+		key := appKey{d.Domain, d.AppName}
+		byApp[key] = append(byApp[key], d)
+	}
+
+	var prunable []*models.Deployment
+	for _, key := range sortedKeys(byApp) {
+		versions := byApp[key]
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+
+		deployedVersion := 0
+		for _, d := range versions {
+			if d.Status == "deployed" {
+				deployedVersion = d.Version
+				break
+			}
+		}
+
+		// Walk oldest first so the result is in version order
+		for rank := len(versions) - 1; rank >= keep; rank-- {
+			d := versions[rank]
+			if d.Version != deployedVersion && d.Status != "pending" && d.Status != "deploying" {
+				prunable = append(prunable, d)
+			}
+		}
+	}
+	return prunable
+}
+
+// PruneDeploymentLogs deletes the logs of deployments whose last chunk was
+// uploaded before the given time and returns how many chunks were deleted,
+// or would be with dryRun. Logs are pruned whole.
+func (s *Store) PruneDeploymentLogs(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, id := range s.expiredLogs(before) {
+		n += int64(len(s.logs[id]))
+		if !dryRun {
+			delete(s.logs, id)
+		}
+	}
+	return n, nil
+}
+
+// PruneDeploymentVersions deletes every version of each app but its keep
+// newest, its newest deployed version and versions still pending or
+// deploying, and returns how many were deleted, or would be with dryRun
+func (s *Store) PruneDeploymentVersions(ctx context.Context, keep int, dryRun bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prunable := s.prunableVersions(keep)
+	if dryRun || len(prunable) == 0 {
+		return int64(len(prunable)), nil
+	}
+
+	ids := map[uuid.UUID]bool{}
+	for _, d := range prunable {
+		ids[d.ID] = true
+	}
+	s.deleteDeployments(ids)
+	s.notify(database.DeploymentsChangedChannel, "DELETE")
+	return int64(len(ids)), nil
+}
+
+// ListExpiredDeploymentLogs lists up to limit deployments whose last log
+// chunk was uploaded before the given time, for archiving
+func (s *Store) ListExpiredDeploymentLogs(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := append([]uuid.UUID{}, s.expiredLogs(before)...)
+	return ids[:min(len(ids), limit)], nil
+}
+
+// ListPrunableDeploymentVersions lists up to limit of the versions
+// PruneDeploymentVersions would delete, for archiving
+func (s *Store) ListPrunableDeploymentVersions(ctx context.Context, keep, limit int) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments := []models.Deployment{}
+	for _, d := range s.prunableVersions(keep) {
+		if len(deployments) >= limit {
+			break
+		}
+		deployments = append(deployments, cloneDeployment(d))
+	}
+	return deployments, nil
+}
+
+// ListMissingSecretProjects lists up to limit deployments whose env
+// references a secret project that no longer holds any secrets, newest
+// first
+func (s *Store) ListMissingSecretProjects(ctx context.Context, limit int) ([]models.MissingSecretProject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projects := map[string]bool{}
+	for key := range s.secrets {
+		projects[key.project] = true
+	}
+
+	deployments := slices.Clone(s.deployments)
+	sort.Slice(deployments, func(i, j int) bool {
+		a, b := deployments[i], deployments[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+
+	missing := []models.MissingSecretProject{}
+	for _, d := range deployments {
+		refs := map[string]bool{}
+		for _, e := range d.Env {
+			if m := secretProjectRef.FindStringSubmatch(e); m != nil && !projects[m[1]] {
+				refs[m[1]] = true
+			}
+		}
+		for _, project := range slices.Sorted(maps.Keys(refs)) {
+			if len(missing) >= limit {
+				return missing, nil
+			}
+			missing = append(missing, models.MissingSecretProject{
+				DeploymentID: d.ID, Domain: d.Domain, AppName: d.AppName, Version: d.Version, Project: project,
+			})
+		}
+	}
+	return missing, nil
+}
+
+// ListDeploymentImages lists the distinct images of every deployment
+func (s *Store) ListDeploymentImages(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	images := map[string]bool{}
+	for _, d := range s.deployments {
+		images[d.DockerImage] = true
+	}
+	return append([]string{}, slices.Sorted(maps.Keys(images))...), nil
+}
+
+// ListStaleRegistries lists the registries whose credentials were last
+// stored before the given time
+func (s *Store) ListStaleRegistries(ctx context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registries := []string{}
+	for _, registry := range slices.Sorted(maps.Keys(s.registries)) {
+		if s.registries[registry].UpdatedAt.Before(before) {
+			registries = append(registries, registry)
+		}
+	}
+	return registries, nil
+}
+
+// DeleteRegistryCredentials deletes the credentials of the given registries
+// that were last stored before the given time and returns how many were
+// deleted
+func (s *Store) DeleteRegistryCredentials(ctx context.Context, registries []string, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, registry := range registries {
+		if cred, ok := s.registries[registry]; ok && cred.UpdatedAt.Before(before) {
+			delete(s.registries, registry)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ListDanglingLogs lists the deployments whose log was archived but still
+// has chunks, with how many
+func (s *Store) ListDanglingLogs(ctx context.Context) ([]models.DanglingLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logs := []models.DanglingLog{}
+	for id := range s.archivedLogs {
+		if chunks := len(s.logs[id]); chunks > 0 {
+			logs = append(logs, models.DanglingLog{DeploymentID: id, Chunks: int64(chunks)})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].DeploymentID.String() < logs[j].DeploymentID.String() })
+	return logs, nil
+}
+
+// DeleteDanglingLogs deletes the chunks of archived deployment logs and
+// returns how many were deleted
+func (s *Store) DeleteDanglingLogs(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id := range s.archivedLogs {
+		n += int64(len(s.logs[id]))
+		delete(s.logs, id)
+	}
+	return n, nil
+}
+
+// RecordManifestSnapshot stores a rendered manifest unless the deployment
+// already has a snapshot of the same format and content digest, and
+// returns the stored snapshot
+func (s *Store) RecordManifestSnapshot(ctx context.Context, snapshot models.ManifestSnapshot) (*models.ManifestSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.snapshots {
+		if stored.DeploymentID == snapshot.DeploymentID && stored.Format == snapshot.Format && stored.ContentDigest == snapshot.ContentDigest {
+			stored.SecretFiles = maps.Clone(stored.SecretFiles)
+			return &stored, nil
+		}
+	}
+	if s.findDeployment(snapshot.DeploymentID) == nil {
+		return nil, fmt.Errorf("failed to record manifest snapshot: deployment not found")
+	}
+
+	s.nextSnapshotID++
+	snapshot.ID, snapshot.CreatedAt = s.nextSnapshotID, s.clock.Now()
+	snapshot.SecretFiles = maps.Clone(snapshot.SecretFiles)
+	if snapshot.SecretFiles == nil {
+		snapshot.SecretFiles = map[string]string{}
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+
+	snapshot.SecretFiles = maps.Clone(snapshot.SecretFiles)
+	return &snapshot, nil
+}
+
+// ListManifestSnapshots lists a deployment's manifest snapshots, oldest
+// first, without their content
+func (s *Store) ListManifestSnapshots(ctx context.Context, deploymentID uuid.UUID, format string) ([]models.ManifestSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots := []models.ManifestSnapshot{}
+	for _, snapshot := range s.snapshots {
+		if snapshot.DeploymentID == deploymentID && (format == "" || snapshot.Format == format) {
+			snapshot.Content, snapshot.SecretFiles = "", map[string]string{}
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// GetManifestSnapshot gets one of a deployment's manifest snapshots
+func (s *Store) GetManifestSnapshot(ctx context.Context, deploymentID uuid.UUID, id int64) (*models.ManifestSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, snapshot := range s.snapshots {
+		if snapshot.DeploymentID == deploymentID && snapshot.ID == id {
+			snapshot.SecretFiles = maps.Clone(snapshot.SecretFiles)
+			return &snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("manifest snapshot not found")
+}
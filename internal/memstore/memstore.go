@@ -0,0 +1,243 @@
+// Package memstore implements database.Store in memory, for running the
+// controller without PostgreSQL in development. Everything is lost when the
+// process exits, and locks and notifications only reach this process.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// appKey identifies an app, or a domain when the app name is empty
+type appKey struct {
+	domain  string
+	appName string
+}
+
+// secretKey identifies a secret
+type secretKey struct {
+	project string
+	name    string
+}
+
+// secretEntry is a secret with the values of all its versions
+type secretEntry struct {
+	secret models.Secret
+	values []secretValue
+}
+
+// secretValue is the encrypted value of one secret version
+type secretValue struct {
+	version   int
+	value     []byte
+	createdAt time.Time
+}
+
+// ruleAlertKey identifies a rule's alert on an app
+type ruleAlertKey struct {
+	rule    string
+	domain  string
+	appName string
+}
+
+// dailyKey identifies an app's deployment counts for one day
+type dailyKey struct {
+	day time.Time
+	app appKey
+}
+
+// retryState tracks the retries of a failed deployment
+type retryState struct {
+	attempts    int
+	nextRetryAt *time.Time
+}
+
+// Store is an in-memory database.Store. All state is guarded by one mutex,
+// so every method is atomic like a Postgres transaction.
+type Store struct {
+	mu sync.Mutex
+
+	// idVersion is the UUID version used for new deployment IDs
+	idVersion int
+
+	// clock stamps records and decides expiry, as NOW() does in Postgres
+	clock clock.Clock
+
+	// deployments holds every version in insertion order
+	deployments []*models.Deployment
+	checks      map[uuid.UUID][]models.DeploymentCheck
+	events      []models.DeploymentEvent
+	retries     map[uuid.UUID]*retryState
+
+	// statusChangedAt is when each deployment entered its current status,
+	// as the status_changed_at trigger keeps it in Postgres
+	statusChangedAt map[uuid.UUID]time.Time
+
+	registries  map[string]models.RegistryCredential
+	secrets     map[secretKey]*secretEntry
+	audit       []models.AuditEvent
+	idempotency map[string]*models.IdempotencyRecord
+	pushes      map[string]models.PushRequest
+
+	schedules      map[appKey]*models.Schedule
+	retryPolicies  map[appKey]models.RetryPolicy
+	rolloutLimits  map[appKey]models.RolloutLimit
+	imagePolicies  map[appKey]models.ImagePolicy
+	imageDigests   map[appKey]models.ImageDigest
+	observed       map[appKey]models.ObservedState
+	healthChecks   map[appKey]models.HealthCheck
+	smokeTests     map[appKey]models.SmokeTest
+	smokeResults   map[uuid.UUID]*models.SmokeTestResult
+	maintenance    map[appKey]models.AppMaintenance
+	freeze         *models.WriteFreeze
+	probes         []models.HealthProbe
+	incidents      []*models.Incident
+	nextIncidentID int64
+
+	alertRules        map[string]models.AlertRule
+	ruleAlerts        map[ruleAlertKey]*models.RuleAlert
+	failureRateAlerts map[appKey]models.FailureRateAlert
+	logs              map[uuid.UUID][]models.DeploymentLogChunk
+	archivedLogs      map[uuid.UUID]models.ArchivedDeploymentLog
+	snapshots         []models.ManifestSnapshot
+	nextSnapshotID    int64
+	jobs              []*models.Job
+	leases            map[string]models.Lease
+	gitSyncs          map[string]models.GitSyncStatus
+	locks             map[string]bool
+	stats             *models.DeploymentStats
+	summaries         []models.AppSummary
+	dailyCounts       map[dailyKey]models.DailyDeploymentCount
+
+	// dailyCountsRefreshedAt is when RefreshAnalytics last ran
+	dailyCountsRefreshedAt time.Time
+
+	// listeners are the callbacks registered with Listen, by channel
+	listeners map[string]map[int]func(payload string)
+	nextID    int
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New creates an empty store; idVersion is the UUID version of new
+// deployment IDs, 4 or 7
+func New(idVersion int) (*Store, error) {
+	if idVersion != 4 && idVersion != 7 {
+		return nil, fmt.Errorf("invalid id_version %d: must be 4 or 7", idVersion)
+	}
+
+	return &Store{
+		idVersion:         idVersion,
+		clock:             clock.Real,
+		checks:            map[uuid.UUID][]models.DeploymentCheck{},
+		retries:           map[uuid.UUID]*retryState{},
+		statusChangedAt:   map[uuid.UUID]time.Time{},
+		registries:        map[string]models.RegistryCredential{},
+		secrets:           map[secretKey]*secretEntry{},
+		idempotency:       map[string]*models.IdempotencyRecord{},
+		pushes:            map[string]models.PushRequest{},
+		schedules:         map[appKey]*models.Schedule{},
+		retryPolicies:     map[appKey]models.RetryPolicy{},
+		rolloutLimits:     map[appKey]models.RolloutLimit{},
+		imagePolicies:     map[appKey]models.ImagePolicy{},
+		imageDigests:      map[appKey]models.ImageDigest{},
+		observed:          map[appKey]models.ObservedState{},
+		healthChecks:      map[appKey]models.HealthCheck{},
+		smokeTests:        map[appKey]models.SmokeTest{},
+		smokeResults:      map[uuid.UUID]*models.SmokeTestResult{},
+		maintenance:       map[appKey]models.AppMaintenance{},
+		alertRules:        map[string]models.AlertRule{},
+		ruleAlerts:        map[ruleAlertKey]*models.RuleAlert{},
+		failureRateAlerts: map[appKey]models.FailureRateAlert{},
+		logs:              map[uuid.UUID][]models.DeploymentLogChunk{},
+		archivedLogs:      map[uuid.UUID]models.ArchivedDeploymentLog{},
+		leases:            map[string]models.Lease{},
+		gitSyncs:          map[string]models.GitSyncStatus{},
+		locks:             map[string]bool{},
+		dailyCounts:       map[dailyKey]models.DailyDeploymentCount{},
+		listeners:         map[string]map[int]func(payload string){},
+	}, nil
+}
+
+// SetClock sets the clock the store stamps records and decides expiry with
+func (s *Store) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+// Close is a no-op; it matches database.DB so the server can close either
+func (s *Store) Close() {}
+
+// Ping always succeeds
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Listen calls onNotify for every notification the store sends on channel
+// until ctx is cancelled, like database.DB.Listen does for Postgres NOTIFY
+func (s *Store) Listen(ctx context.Context, channel string, onNotify func(payload string), logger *slog.Logger) {
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	if s.listeners[channel] == nil {
+		s.listeners[channel] = map[int]func(payload string){}
+	}
+	s.listeners[channel][id] = onNotify
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.listeners[channel], id)
+	s.mu.Unlock()
+}
+
+// notify queues a notification for channel's listeners; it is called with
+// the lock held, so the callbacks run on their own goroutine
+func (s *Store) notify(channel, payload string) {
+	for _, onNotify := range s.listeners[channel] {
+		go onNotify(payload)
+	}
+}
+
+// WithLock runs fn unless another caller in this process holds the named
+// lock, in which case fn is not called and WithLock returns false
+func (s *Store) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	s.mu.Lock()
+	if s.locks[name] {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.locks[name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.locks, name)
+		s.mu.Unlock()
+	}()
+
+	return true, fn(ctx)
+}
+
+// Exclusive wraps a periodic task so runs never overlap, like
+// database.DB.Exclusive
+func (s *Store) Exclusive(name string, logger *slog.Logger, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ran, err := s.WithLock(ctx, "task:"+name, fn)
+		if !ran && err == nil {
+			logger.Debug("Skipped background run still in progress", "worker", name)
+		}
+		return err
+	}
+}
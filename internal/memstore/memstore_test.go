@@ -0,0 +1,430 @@
+package memstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := New(4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestNewRejectsInvalidIDVersion(t *testing.T) {
+	if _, err := New(5); err == nil {
+		t.Error("Expected an error for id_version 5")
+	}
+}
+
+func TestDeploymentVersions(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	for _, image := range []string{"nginx:1.24", "nginx:1.25"} {
+		req := models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: image, Port: 80}
+		if _, err := store.CreateDeployment(ctx, req, "req"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	latest, err := store.GetLatestDeployments(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(latest) != 1 || latest[0].Version != 2 || latest[0].DockerImage != "nginx:1.25" {
+		t.Fatalf("Expected version 2 of web to be latest, got %+v", latest)
+	}
+
+	latest[0].DockerImage = "mutated"
+	history, err := store.GetDeploymentHistory(ctx, "example.com", "web", models.DateRange{}, nil, nil, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 {
+		t.Fatalf("Expected both versions newest first, got %+v", history)
+	}
+	if history[0].DockerImage != "nginx:1.25" {
+		t.Errorf("Expected stored data to be isolated from callers, got %q", history[0].DockerImage)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	store := newStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queued := make(chan string, 1)
+	go store.Listen(ctx, database.JobsChannel, func(payload string) { queued <- payload }, nil)
+
+	// Wait for the listener to register before enqueueing
+	for {
+		store.mu.Lock()
+		registered := len(store.listeners[database.JobsChannel]) == 1
+		store.mu.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	job, err := store.EnqueueJob(ctx, "export", models.PriorityNormal, nil, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case payload := <-queued:
+		if payload != "export" {
+			t.Errorf("Expected notification payload export, got %q", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a notification for the queued job")
+	}
+
+	claimed, err := store.ClaimJob(ctx, []string{"export"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claimed == nil || claimed.ID != job.ID || claimed.Status != models.JobStatusRunning || claimed.Attempts != 1 {
+		t.Fatalf("Expected the job to be claimed, got %+v", claimed)
+	}
+	if again, _ := store.ClaimJob(ctx, []string{"export"}, time.Minute); again != nil {
+		t.Errorf("Expected a running job not to be claimed again, got %+v", again)
+	}
+
+	status, err := store.FinishJob(ctx, job.ID, claimed.Attempts, models.JobStatusSucceeded, []byte(`{}`), "", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status != models.JobStatusSucceeded {
+		t.Errorf("Expected status succeeded, got %q", status)
+	}
+}
+
+func TestJobLeaseReclaim(t *testing.T) {
+	store := newStore(t)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	job, err := store.EnqueueJob(ctx, "export", models.PriorityNormal, nil, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if claimed, _ := store.ClaimJob(ctx, []string{"export"}, time.Minute); claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("Expected the job to be claimed, got %+v", claimed)
+	}
+
+	// Renewed leases keep the job with its replica
+	clk.Advance(50 * time.Second)
+	if err := store.RenewJobLease(ctx, job.ID, 1, time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	clk.Advance(50 * time.Second)
+	if again, _ := store.ClaimJob(ctx, []string{"export"}, time.Minute); again != nil {
+		t.Fatalf("Expected a job with a live lease not to be claimed again, got %+v", again)
+	}
+
+	// Its replica dies: the lease lapses and the job runs again
+	clk.Advance(11 * time.Second)
+	reclaimed, err := store.ClaimJob(ctx, []string{"export"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reclaimed == nil || reclaimed.ID != job.ID || reclaimed.Attempts != 2 || !reclaimed.StartedAt.Equal(clk.Now()) {
+		t.Fatalf("Expected the job to be claimed again as its second attempt, got %+v", reclaimed)
+	}
+	if err := store.RenewJobLease(ctx, job.ID, 1, time.Minute); err == nil || err.Error() != "job not found" {
+		t.Errorf("Expected the first attempt's lease renewal to fail, got %v", err)
+	}
+
+	// The first attempt's replica was only slow: its writes must not touch
+	// the second attempt
+	if err := store.UpdateJobProgress(ctx, job.ID, 1, 1); err == nil || err.Error() != "job not found" {
+		t.Errorf("Expected the first attempt's progress to be rejected, got %v", err)
+	}
+	if _, err := store.FinishJob(ctx, job.ID, 1, models.JobStatusFailed, nil, "stale", 0); err == nil || err.Error() != "job not found" {
+		t.Errorf("Expected the first attempt's outcome to be rejected, got %v", err)
+	}
+	if _, err := store.RequeueJob(ctx, job.ID, 1); err == nil || err.Error() != "job not found" {
+		t.Errorf("Expected the first attempt's requeue to be rejected, got %v", err)
+	}
+	if stored, _ := store.GetJob(ctx, job.ID); stored.Status != models.JobStatusRunning || stored.Error != "" {
+		t.Fatalf("Expected the second attempt still running, got %+v", stored)
+	}
+	if status, err := store.FinishJob(ctx, job.ID, 2, models.JobStatusSucceeded, nil, "", 0); err != nil || status != models.JobStatusSucceeded {
+		t.Errorf("Expected the second attempt's outcome recorded, got %q, %v", status, err)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	if _, held, _ := store.AcquireLease(ctx, "leader", "a", time.Minute); !held {
+		t.Fatal("Expected a to take the free lease")
+	}
+	if lease, held, _ := store.AcquireLease(ctx, "leader", "b", time.Minute); held || lease.Holder != "a" {
+		t.Fatalf("Expected b not to take a's lease, got %+v", lease)
+	}
+
+	if err := store.ReleaseLease(ctx, "leader", "a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, held, _ := store.AcquireLease(ctx, "leader", "b", time.Minute); !held {
+		t.Error("Expected b to take the released lease")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	store := newStore(t)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	if _, held, _ := store.AcquireLease(ctx, "leader", "a", time.Minute); !held {
+		t.Fatal("Expected a to take the free lease")
+	}
+	clk.Advance(59 * time.Second)
+	if lease, held, _ := store.AcquireLease(ctx, "leader", "b", time.Minute); held || !lease.ExpiresAt.Equal(clk.Now().Add(time.Second)) {
+		t.Fatalf("Expected a to hold the lease for another second, got %+v", lease)
+	}
+
+	clk.Advance(2 * time.Second)
+	lease, held, _ := store.AcquireLease(ctx, "leader", "b", time.Minute)
+	if !held || !lease.RenewedAt.Equal(clk.Now()) {
+		t.Errorf("Expected b to take the expired lease, got %+v", lease)
+	}
+}
+
+func TestIdempotencyReservationLease(t *testing.T) {
+	store := newStore(t)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	if _, reserved, _ := store.ReserveIdempotencyKey(ctx, "abandoned", "hash"); !reserved {
+		t.Fatal("Expected the new key to be reserved")
+	}
+	if _, reserved, _ := store.ReserveIdempotencyKey(ctx, "completed", "hash"); !reserved {
+		t.Fatal("Expected the new key to be reserved")
+	}
+	if err := store.CompleteIdempotencyKey(ctx, "completed", 201, []byte(`{}`)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	clk.Advance(time.Minute)
+	if record, reserved, _ := store.ReserveIdempotencyKey(ctx, "abandoned", "hash"); reserved || record.StatusCode != 0 {
+		t.Fatalf("Expected the key to still be in flight, got %+v", record)
+	}
+
+	clk.Advance(2 * time.Minute)
+	if _, reserved, _ := store.ReserveIdempotencyKey(ctx, "abandoned", "hash"); !reserved {
+		t.Error("Expected the abandoned reservation to be reusable once its lease expired")
+	}
+	if record, reserved, _ := store.ReserveIdempotencyKey(ctx, "completed", "hash"); reserved || record.StatusCode != 201 {
+		t.Errorf("Expected the completed key to replay for the full TTL, got %+v", record)
+	}
+}
+
+func TestDailyCountsFollowStatusChanges(t *testing.T) {
+	store := newStore(t)
+	// Just after midnight two hours east of UTC, still the 1st in UTC
+	clk := clock.NewFake(time.Date(2024, 1, 2, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	web, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.RefreshAnalytics(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The deployment fails days later, once newer days have been counted
+	clk.Advance(72 * time.Hour)
+	if _, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "api", DockerImage: "api:1.0", Port: 80}, "req"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.RefreshAnalytics(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.UpdateDeploymentStatus(ctx, web.ID, "failed", nil, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.RefreshAnalytics(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	counts, err := store.GetDeploymentTrends(ctx, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("Expected two days of counts, got %+v", counts)
+	}
+	if got := counts[0]; !got.Day.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || got.CreatedCount != 1 || got.FailedCount != 1 {
+		t.Errorf("Expected the failure counted on its UTC creation day, 2024-01-01, got %+v", got)
+	}
+}
+
+func TestDeploymentOutcomesWithFailureCodes(t *testing.T) {
+	store := newStore(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	push := func(image string) *models.Deployment {
+		d, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: image, Port: 80}, "req")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return d
+	}
+	update := func(d *models.Deployment, status string, failure *models.DeploymentFailure) {
+		clk.Advance(time.Minute)
+		if _, err := store.UpdateDeploymentStatus(ctx, d.ID, status, failure, nil, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// The failure code is appended to the event message, which must not
+	// hide the transition
+	broken := push("nginx:1.24")
+	update(broken, "deploying", nil)
+	update(broken, "failed", &models.DeploymentFailure{Code: "image_pull_failed"})
+	failedAt := clk.Now()
+
+	good := push("nginx:1.25")
+	update(good, "deploying", nil)
+	update(good, "deployed", nil)
+	deployedAt := clk.Now()
+
+	outcomes, err := store.ListDeploymentOutcomes(ctx, start)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(outcomes) != 2 {
+		t.Fatalf("Expected two outcomes, got %+v", outcomes)
+	}
+	if got := outcomes[0]; got.FailedAt == nil || !got.FailedAt.Equal(failedAt) || got.DeployedAt != nil {
+		t.Errorf("Expected the first version failed at %s, got %+v", failedAt, got)
+	}
+	if got := outcomes[1]; got.DeployedAt == nil || !got.DeployedAt.Equal(deployedAt) || got.FailedAt != nil {
+		t.Errorf("Expected the second version deployed at %s, got %+v", deployedAt, got)
+	}
+}
+
+func TestRetryClearsLastAttempt(t *testing.T) {
+	store := newStore(t)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	if _, err := store.UpsertRetryPolicy(ctx, models.RetryPolicy{Domain: "example.com", AppName: "web", MaxAttempts: 3, InitialBackoffSeconds: 60, MaxBackoffSeconds: 60}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.UpdateDeploymentStatus(ctx, d.ID, "failed", &models.DeploymentFailure{Code: "image_pull_failed", Message: "not found"}, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	clk.Advance(2 * time.Minute)
+	if retried, err := store.RunDueRetries(ctx); err != nil || retried != 1 {
+		t.Fatalf("Expected one retry, got %d, %v", retried, err)
+	}
+	got, err := store.GetDeployment(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Status != "pending" || got.Failure != nil || got.Verification != "" || got.VerifiedAt != nil {
+		t.Errorf("Expected a clean pending deployment, got status %s with failure %+v", got.Status, got.Failure)
+	}
+}
+
+func TestStuckCountsFromRetry(t *testing.T) {
+	store := newStore(t)
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store.SetClock(clk)
+	ctx := context.Background()
+
+	if _, err := store.UpsertRetryPolicy(ctx, models.RetryPolicy{Domain: "example.com", AppName: "web", MaxAttempts: 3, InitialBackoffSeconds: 3600, MaxBackoffSeconds: 3600}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d, err := store.CreateDeployment(ctx, models.DeploymentRequest{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}, "req")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.UpdateDeploymentStatus(ctx, d.ID, "failed", &models.DeploymentFailure{Code: "image_pull_failed"}, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The retry moves the deployment back to pending without a
+	// status_changed event; it has been pending for a minute, not an hour
+	clk.Advance(2 * time.Hour)
+	if retried, err := store.RunDueRetries(ctx); err != nil || retried != 1 {
+		t.Fatalf("Expected one retry, got %d, %v", retried, err)
+	}
+	clk.Advance(time.Minute)
+
+	stuck, err := store.MarkStuckDeployments(ctx, "pending", clk.Now().Add(-30*time.Minute), "stalled", nil, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stuck) != 0 {
+		t.Errorf("Expected the retried deployment not to count as stuck, got %+v", stuck)
+	}
+}
+
+func TestRecordImageDigest(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	first, second := uuid.New(), uuid.New()
+
+	// Each step records in turn, as the deploy-time baseline does (with a
+	// deployed digest) or a periodic check does (without one)
+	steps := []struct {
+		name               string
+		record             models.ImageDigest
+		deployed, registry string
+		drifted            bool
+	}{
+		{"check before any baseline", models.ImageDigest{DeploymentID: first, RegistryDigest: "sha256:a"}, "", "sha256:a", false},
+		{"first seen at deploy", models.ImageDigest{DeploymentID: first, DeployedDigest: "sha256:a", RegistryDigest: "sha256:a"}, "sha256:a", "sha256:a", false},
+		{"unchanged", models.ImageDigest{DeploymentID: first, RegistryDigest: "sha256:a"}, "sha256:a", "sha256:a", false},
+		{"drifted", models.ImageDigest{DeploymentID: first, RegistryDigest: "sha256:b"}, "sha256:a", "sha256:b", true},
+		{"failed check keeps digests", models.ImageDigest{DeploymentID: first, Error: "timeout"}, "sha256:a", "sha256:b", true},
+		{"new deployment without baseline", models.ImageDigest{DeploymentID: second, RegistryDigest: "sha256:b"}, "", "sha256:b", false},
+		{"new deployment baseline", models.ImageDigest{DeploymentID: second, DeployedDigest: "sha256:b", RegistryDigest: "sha256:b"}, "sha256:b", "sha256:b", false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.record.Domain, step.record.AppName, step.record.DockerImage = "example.com", "web", "example/web:latest"
+			stored, err := store.RecordImageDigest(ctx, step.record)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stored.DeployedDigest != step.deployed || stored.RegistryDigest != step.registry || stored.Drifted != step.drifted {
+				t.Errorf("Expected deployed %q, registry %q, drifted %v, got %q, %q, %v",
+					step.deployed, step.registry, step.drifted, stored.DeployedDigest, stored.RegistryDigest, stored.Drifted)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// cloneSchedule copies a schedule so callers never share its pointers
+func cloneSchedule(schedule *models.Schedule) *models.Schedule {
+	c := *schedule
+	c.LastRunAt = cloneTime(schedule.LastRunAt)
+	if schedule.LastDeploymentID != nil {
+		id := *schedule.LastDeploymentID
+		c.LastDeploymentID = &id
+	}
+	return &c
+}
+
+// UpsertSchedule creates or replaces an app's schedule
+func (s *Store) UpsertSchedule(ctx context.Context, domain, appName, cron string, paused bool, nextRunAt time.Time) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	key := appKey{domain, appName}
+	schedule, ok := s.schedules[key]
+	if !ok {
+		schedule = &models.Schedule{ID: uuid.New(), Domain: domain, AppName: appName, CreatedAt: now}
+		s.schedules[key] = schedule
+	}
+	schedule.Cron, schedule.Paused, schedule.NextRunAt, schedule.UpdatedAt = cron, paused, nextRunAt, now
+	return cloneSchedule(schedule), nil
+}
+
+// GetSchedule gets an app's schedule
+func (s *Store) GetSchedule(ctx context.Context, domain, appName string) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	return cloneSchedule(schedule), nil
+}
+
+// ListSchedules lists all schedules ordered by domain and app name
+func (s *Store) ListSchedules(ctx context.Context) ([]models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := []models.Schedule{}
+	for _, key := range sortedKeys(s.schedules) {
+		schedules = append(schedules, *cloneSchedule(s.schedules[key]))
+	}
+	return schedules, nil
+}
+
+// SetSchedulePaused pauses or resumes an app's schedule. Resuming sets the
+// next run, so runs missed while paused are skipped rather than caught up.
+func (s *Store) SetSchedulePaused(ctx context.Context, domain, appName string, paused bool, nextRunAt time.Time) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[appKey{domain, appName}]
+	if !ok {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	schedule.Paused, schedule.UpdatedAt = paused, s.clock.Now()
+	if !paused {
+		schedule.NextRunAt = nextRunAt
+	}
+	return cloneSchedule(schedule), nil
+}
+
+// DeleteSchedule deletes an app's schedule
+func (s *Store) DeleteSchedule(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.schedules[key]; !ok {
+		return fmt.Errorf("schedule not found")
+	}
+	delete(s.schedules, key)
+	return nil
+}
+
+// findSchedule returns the stored schedule with the given ID, or nil
+func (s *Store) findSchedule(id uuid.UUID) *models.Schedule {
+	for _, schedule := range s.schedules {
+		if schedule.ID == id {
+			return schedule
+		}
+	}
+	return nil
+}
+
+// recordRun records the outcome of a schedule run
+func (s *Store) recordRun(schedule *models.Schedule, deploymentID *uuid.UUID, errMsg string) {
+	now := s.clock.Now()
+	schedule.LastRunAt, schedule.LastError, schedule.UpdatedAt = &now, errMsg, now
+	if deploymentID != nil {
+		id := *deploymentID
+		schedule.LastDeploymentID = &id
+	}
+}
+
+// RecordScheduleRun records the outcome of a manually triggered run; the
+// next scheduled run is left as it was
+func (s *Store) RecordScheduleRun(ctx context.Context, id uuid.UUID, deploymentID *uuid.UUID, errMsg string) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(id)
+	if schedule == nil {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	s.recordRun(schedule, deploymentID, errMsg)
+	return cloneSchedule(schedule), nil
+}
+
+// RunDueSchedules runs every unpaused schedule whose next run is due and
+// records each outcome. run usually creates deployments through the store,
+// so it is called without the lock held; a schedule deleted meanwhile is
+// not recorded.
+func (s *Store) RunDueSchedules(ctx context.Context, run database.ScheduleRunFunc) (int, error) {
+	s.mu.Lock()
+	now := s.clock.Now()
+	var due []*models.Schedule
+	for _, schedule := range s.schedules {
+		if !schedule.Paused && !schedule.NextRunAt.After(now) {
+			due = append(due, cloneSchedule(schedule))
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(due[j].NextRunAt) })
+	due = due[:min(len(due), 100)]
+
+	for _, schedule := range due {
+		deploymentID, nextRunAt, errMsg := run(ctx, schedule)
+
+		s.mu.Lock()
+		if stored := s.findSchedule(schedule.ID); stored != nil {
+			s.recordRun(stored, deploymentID, errMsg)
+			stored.NextRunAt = nextRunAt
+		}
+		s.mu.Unlock()
+	}
+
+	return len(due), nil
+}
+
+// rolloutLimits holds the rollout limits and deploying counts that decide
+// which pending deployments may start
+type rolloutLimits struct {
+	// defaultDomain applies to domains without their own limit; 0 means
+	// unlimited
+	defaultDomain int
+
+	limits          map[appKey]int
+	domainDeploying map[string]int
+	appDeploying    map[appKey]int
+}
+
+// loadRolloutLimits reads the limits and current deploying counts
+func (s *Store) loadRolloutLimits(defaultDomain int) *rolloutLimits {
+	r := &rolloutLimits{
+		defaultDomain:   defaultDomain,
+		limits:          map[appKey]int{},
+		domainDeploying: map[string]int{},
+		appDeploying:    map[appKey]int{},
+	}
+	for key, limit := range s.rolloutLimits {
+		r.limits[key] = limit.MaxDeploying
+	}
+
+	// Every version still deploying counts, so an app's next version waits
+	// for the previous rollout to finish when its limit is 1
+	for _, d := range s.deployments {
+		if d.Status == "deploying" {
+			r.appDeploying[appKey{d.Domain, d.AppName}]++
+			r.domainDeploying[d.Domain]++
+		}
+	}
+	return r
+}
+
+// allow reports whether d may start now and, if so, counts it as deploying
+func (r *rolloutLimits) allow(d *models.Deployment) bool {
+	domainLimit, ok := r.limits[appKey{d.Domain, ""}]
+	if !ok {
+		domainLimit = r.defaultDomain
+	}
+	if domainLimit > 0 && r.domainDeploying[d.Domain] >= domainLimit {
+		return false
+	}
+
+	app := appKey{d.Domain, d.AppName}
+	if appLimit, ok := r.limits[app]; ok && r.appDeploying[app] >= appLimit {
+		return false
+	}
+
+	r.domainDeploying[d.Domain]++
+	r.appDeploying[app]++
+	return true
+}
+
+// pendingDeployments lists the latest versions still pending and not held
+// by CI checks, most urgent priority first and oldest first within a
+// priority
+func (s *Store) pendingDeployments(domain string) []*models.Deployment {
+	var pending []*models.Deployment
+	for _, d := range s.latestDeployments() {
+		if d.Status == "pending" && (domain == "" || d.Domain == domain) && !models.Held(s.checks[d.ID]) {
+			pending = append(pending, d)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if ra, rb := models.PriorityRank(a.Priority), models.PriorityRank(b.Priority); ra != rb {
+			return ra < rb
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+	return pending
+}
+
+// ListPendingDeployments lists pending deployments that may start now under
+// the rollout limits, by priority and then oldest first; defaultDomainLimit
+// applies to domains without their own limit
+func (s *Store) ListPendingDeployments(ctx context.Context, domain string, defaultDomainLimit int) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := s.loadRolloutLimits(defaultDomainLimit)
+	startable := []models.Deployment{}
+	for _, d := range s.pendingDeployments(domain) {
+		if limits.allow(d) {
+			startable = append(startable, cloneDeployment(d))
+		}
+	}
+	return startable, nil
+}
+
+// ClaimDeployments moves up to max pending deployments that may start under
+// the rollout limits to deploying and returns them
+func (s *Store) ClaimDeployments(ctx context.Context, domain string, max, defaultDomainLimit int) ([]models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := s.loadRolloutLimits(defaultDomainLimit)
+	claimed := []models.Deployment{}
+	for _, d := range s.pendingDeployments(domain) {
+		if len(claimed) >= max {
+			break
+		}
+		if !limits.allow(d) {
+			continue
+		}
+
+		s.setStatus(d, "deploying")
+		s.recordStatusChange(d.ID, "pending", "deploying", "status changed from pending to deploying (claimed)")
+		claimed = append(claimed, cloneDeployment(d))
+	}
+
+	if len(claimed) > 0 {
+		s.notify(database.DeploymentsChangedChannel, "UPDATE")
+	}
+	return claimed, nil
+}
+
+// UpsertRolloutLimit creates or replaces a rollout limit; an empty appName
+// sets the domain-wide limit
+func (s *Store) UpsertRolloutLimit(ctx context.Context, limit models.RolloutLimit) (*models.RolloutLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit.UpdatedAt = s.clock.Now()
+	s.rolloutLimits[appKey{limit.Domain, limit.AppName}] = limit
+	return &limit, nil
+}
+
+// ListRolloutLimits lists all rollout limits ordered by domain and app name
+func (s *Store) ListRolloutLimits(ctx context.Context) ([]models.RolloutLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := []models.RolloutLimit{}
+	for _, key := range sortedKeys(s.rolloutLimits) {
+		limits = append(limits, s.rolloutLimits[key])
+	}
+	return limits, nil
+}
+
+// DeleteRolloutLimit deletes a rollout limit; an empty appName deletes the
+// domain-wide limit
+func (s *Store) DeleteRolloutLimit(ctx context.Context, domain, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := appKey{domain, appName}
+	if _, ok := s.rolloutLimits[key]; !ok {
+		return fmt.Errorf("rollout limit not found")
+	}
+	delete(s.rolloutLimits, key)
+	return nil
+}
@@ -0,0 +1,331 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// idempotencyKeyTTL is how long a stored push result can be replayed
+const idempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyLeaseTTL is how long a key stays reserved without a stored
+// result
+const idempotencyLeaseTTL = 2 * time.Minute
+
+// CreateSecret stores a new encrypted secret value as version 1
+func (s *Store) CreateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := secretKey{project, name}
+	if _, ok := s.secrets[key]; ok {
+		return nil, fmt.Errorf("secret already exists")
+	}
+
+	now := s.clock.Now()
+	entry := &secretEntry{
+		secret: models.Secret{Project: project, Name: name, Version: 1, CreatedAt: now, UpdatedAt: now},
+		values: []secretValue{{version: 1, value: slices.Clone(value), createdAt: now}},
+	}
+	s.secrets[key] = entry
+
+	secret := entry.secret
+	return &secret, nil
+}
+
+// UpdateSecret stores a new encrypted value as the secret's next version.
+// Earlier versions are kept for deployments that pin them.
+func (s *Store) UpdateSecret(ctx context.Context, project, name string, value []byte) (*models.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.secrets[secretKey{project, name}]
+	if !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	now := s.clock.Now()
+	entry.secret.Version++
+	entry.secret.UpdatedAt = now
+	entry.values = append(entry.values, secretValue{version: entry.secret.Version, value: slices.Clone(value), createdAt: now})
+
+	secret := entry.secret
+	return &secret, nil
+}
+
+// GetSecret gets a secret's metadata
+func (s *Store) GetSecret(ctx context.Context, project, name string) (*models.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.secrets[secretKey{project, name}]
+	if !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+	secret := entry.secret
+	return &secret, nil
+}
+
+// ListSecrets lists secret metadata, optionally limited to one project
+func (s *Store) ListSecrets(ctx context.Context, project string) ([]models.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets := []models.Secret{}
+	for _, entry := range s.secrets {
+		if project == "" || entry.secret.Project == project {
+			secrets = append(secrets, entry.secret)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Project < secrets[j].Project ||
+			secrets[i].Project == secrets[j].Project && secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// DeleteSecret removes a secret with all its versions
+func (s *Store) DeleteSecret(ctx context.Context, project, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := secretKey{project, name}
+	if _, ok := s.secrets[key]; !ok {
+		return fmt.Errorf("secret not found")
+	}
+	delete(s.secrets, key)
+	return nil
+}
+
+// GetSecretValue gets the encrypted value of a secret version; version 0
+// means the current version
+func (s *Store) GetSecretValue(ctx context.Context, project, name string, version int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.secrets[secretKey{project, name}]
+	if !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+	if version == 0 {
+		version = entry.secret.Version
+	}
+	for _, v := range entry.values {
+		if v.version == version {
+			return slices.Clone(v.value), nil
+		}
+	}
+	return nil, fmt.Errorf("secret not found")
+}
+
+// ListSecretVersions lists a secret's versions, newest first
+func (s *Store) ListSecretVersions(ctx context.Context, project, name string) ([]models.SecretVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.secrets[secretKey{project, name}]
+	if !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	versions := []models.SecretVersion{}
+	for i := len(entry.values) - 1; i >= 0; i-- {
+		versions = append(versions, models.SecretVersion{Version: entry.values[i].version, CreatedAt: entry.values[i].createdAt})
+	}
+	return versions, nil
+}
+
+// ReencryptSecrets rewrites stored secret values all at once. reencrypt
+// returns the new ciphertext for a value, or nil to leave it as is; the
+// number of rewritten values is returned. Nothing is changed if any value
+// fails.
+func (s *Store) ReencryptSecrets(ctx context.Context, reencrypt func(project, name string, value []byte) ([]byte, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type rewrite struct {
+		entry *secretEntry
+		index int
+		value []byte
+	}
+
+	var rewrites []rewrite
+	for _, entry := range s.secrets {
+		for i, v := range entry.values {
+			value, err := reencrypt(entry.secret.Project, entry.secret.Name, v.value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to re-encrypt %s/%s version %d: %w", entry.secret.Project, entry.secret.Name, v.version, err)
+			}
+			if value != nil {
+				rewrites = append(rewrites, rewrite{entry, i, value})
+			}
+		}
+	}
+
+	for _, r := range rewrites {
+		r.entry.values[r.index].value = slices.Clone(r.value)
+	}
+	return len(rewrites), nil
+}
+
+// RecordAuditEvents stores audit events
+func (s *Store) RecordAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		event.ID, event.CreatedAt = uuid.New(), s.clock.Now()
+		if event.DeploymentID != nil {
+			id := *event.DeploymentID
+			event.DeploymentID = &id
+		}
+		s.audit = append(s.audit, event)
+	}
+	return nil
+}
+
+// ListAuditEvents lists a resource's audit events, newest first, resuming
+// after the cursor
+func (s *Store) ListAuditEvents(ctx context.Context, resource string, after *models.Cursor, limit int) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []models.AuditEvent{}
+	for _, event := range s.audit {
+		if event.Resource == resource && before(event.CreatedAt, event.ID, after) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return newestFirst(events[i].CreatedAt, events[i].ID, events[j].CreatedAt, events[j].ID)
+	})
+	return events[:min(len(events), limit)], nil
+}
+
+// ReserveIdempotencyKey claims an idempotency key for a new request. When the
+// key was already used, the existing record is returned and reserved is false.
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired keys and abandoned reservations may be reused
+	if record, ok := s.idempotency[key]; ok {
+		age := s.clock.Now().Sub(record.CreatedAt)
+		if age > idempotencyKeyTTL || (record.StatusCode == 0 && age > idempotencyLeaseTTL) {
+			delete(s.idempotency, key)
+		}
+	}
+
+	if record, ok := s.idempotency[key]; ok {
+		c := *record
+		c.Response = slices.Clone(record.Response)
+		return &c, false, nil
+	}
+
+	s.idempotency[key] = &models.IdempotencyRecord{Key: key, RequestHash: requestHash, CreatedAt: s.clock.Now()}
+	return nil, true, nil
+}
+
+// CompleteIdempotencyKey stores the response produced for a reserved key
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.idempotency[key]
+	if !ok {
+		return fmt.Errorf("idempotency key not found")
+	}
+	record.StatusCode, record.Response = statusCode, slices.Clone(response)
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reservation whose request did not complete.
+// Releasing a key that was already completed or expired is a no-op.
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.idempotency[key]; ok && record.StatusCode == 0 {
+		delete(s.idempotency, key)
+	}
+	return nil
+}
+
+// RecordPushRequest stores a push batch and which of its items failed. A
+// batch processed again, such as a retried push job, replaces its record.
+func (s *Store) RecordPushRequest(ctx context.Context, req models.PushRequest) error {
+	// Round trip the batch through JSON like the push_requests table, so
+	// the stored copy shares nothing with the caller's
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode push request: %w", err)
+	}
+	var stored models.PushRequest
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to encode push request: %w", err)
+	}
+	if len(stored.Options) == 0 {
+		stored.Options = json.RawMessage("{}")
+	}
+	if stored.Failed == nil {
+		stored.Failed = []int{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.pushes[req.RequestID]; ok {
+		stored.ReplayOf, stored.CreatedAt = existing.ReplayOf, existing.CreatedAt
+	} else {
+		stored.CreatedAt = s.clock.Now()
+	}
+	s.pushes[req.RequestID] = stored
+	return nil
+}
+
+// GetPushRequest returns a stored push batch
+func (s *Store) GetPushRequest(ctx context.Context, requestID string) (*models.PushRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.pushes[requestID]
+	if !ok {
+		return nil, fmt.Errorf("push request not found")
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode push request: %w", err)
+	}
+	req := &models.PushRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("failed to decode push request: %w", err)
+	}
+	return req, nil
+}
+
+// PrunePushRequests deletes the push batches submitted before the given
+// time and returns how many were deleted, or would be with dryRun
+func (s *Store) PrunePushRequests(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, req := range s.pushes {
+		if req.CreatedAt.Before(before) {
+			n++
+			if !dryRun {
+				delete(s.pushes, id)
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Apps holds per-app deployment metrics. They live in their own registry,
+// pushed to a Pushgateway, so /metrics keeps exposing only the controller's
+// internals and each push replaces the previous set of apps.
+type Apps struct {
+	Registry *prometheus.Registry
+
+	// Status reports, per app and status, whether it is the status of the
+	// app's latest version (1) or not (0)
+	Status *prometheus.GaugeVec
+
+	// Versions counts the versions pushed for an app
+	Versions *prometheus.GaugeVec
+
+	// DeployedVersions and FailedVersions count an app's versions currently
+	// deployed or failed
+	DeployedVersions *prometheus.GaugeVec
+	FailedVersions   *prometheus.GaugeVec
+
+	// CurrentVersion is the version number of an app's latest version
+	CurrentVersion *prometheus.GaugeVec
+
+	// LastDeployed is when a version of an app was last deployed
+	LastDeployed *prometheus.GaugeVec
+}
+
+// NewApps returns an empty set of per-app deployment metrics
+func NewApps() *Apps {
+	labels := []string{"domain", "app_name"}
+	a := &Apps{
+		Registry: prometheus.NewRegistry(),
+		Status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_status",
+			Help:      "Whether the status is that of the app's latest version (1) or not (0).",
+		}, append(labels, "status")),
+		Versions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_versions",
+			Help:      "Number of versions pushed for the app.",
+		}, labels),
+		DeployedVersions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_deployed_versions",
+			Help:      "Number of the app's versions whose status is deployed.",
+		}, labels),
+		FailedVersions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_failed_versions",
+			Help:      "Number of the app's versions whose status is failed.",
+		}, labels),
+		CurrentVersion: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_current_version",
+			Help:      "Version number of the app's latest version.",
+		}, labels),
+		LastDeployed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "app_last_deployed_timestamp_seconds",
+			Help:      "Unix time a version of the app was last deployed.",
+		}, labels),
+	}
+	a.Registry.MustRegister(a.Status, a.Versions, a.DeployedVersions, a.FailedVersions, a.CurrentVersion, a.LastDeployed)
+	return a
+}
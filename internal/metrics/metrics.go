@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exported by the controller
+const namespace = "deployment_controller"
+
+var (
+	// CacheHits counts lookups served from an in-process cache
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Number of lookups served from an in-process cache.",
+	}, []string{"cache"})
+
+	// CacheMisses counts lookups that had to go to the database
+	CacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "Number of cache lookups that fell through to the database.",
+	}, []string{"cache"})
+
+	// CacheInvalidations counts explicit cache invalidations by source
+	CacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_invalidations_total",
+		Help:      "Number of cache invalidations, by cache and source.",
+	}, []string{"cache", "source"})
+)
+
+var (
+	// InFlightRequests tracks API requests currently being served per route class
+	InFlightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_requests",
+		Help:      "Number of API requests currently being served, by route class.",
+	}, []string{"class"})
+
+	// ShedRequests counts requests rejected because a concurrency cap was reached
+	ShedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shed_requests_total",
+		Help:      "Number of API requests rejected with 503 by the concurrency limiter, by route class.",
+	}, []string{"class"})
+)
+
+var (
+	// JobsDeadLettered counts jobs that ran out of attempts
+	JobsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_dead_lettered_total",
+		Help:      "Number of background jobs dead-lettered after exhausting their attempts, by type.",
+	}, []string{"type"})
+)
+
+var (
+	// ImageDigestDrift reports, per app, whether its deployed mutable tag
+	// now points at another digest
+	ImageDigestDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "image_digest_drift",
+		Help:      "Whether an app's deployed mutable tag now resolves to a different digest (1) or not (0).",
+	}, []string{"domain", "app_name"})
+
+	// ImageDigestCheckErrors counts failed digest resolutions
+	ImageDigestCheckErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_digest_check_errors_total",
+		Help:      "Number of deployed tags whose digest could not be resolved.",
+	})
+)
+
+var (
+	// DeploymentFailureRate reports each app's rolling deployment failure
+	// rate, evaluated for failure rate alerts
+	DeploymentFailureRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "deployment_failure_rate",
+		Help:      "Share of an app's deployments finished within the alert window that failed or were rolled back.",
+	}, []string{"domain", "app_name"})
+
+	// FailureRateAlerts reports, per app, whether its failure rate alert is
+	// firing
+	FailureRateAlerts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "failure_rate_alert",
+		Help:      "Whether an app's deployment failure rate alert is firing (1) or not (0).",
+	}, []string{"domain", "app_name"})
+
+	// StuckDeployments counts the deployments the watchdog found stuck
+	StuckDeployments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stuck_deployments_total",
+		Help:      "Deployments marked stalled or failed by the watchdog, by the status they were stuck in.",
+	}, []string{"status", "action"})
+
+	// RuleAlerts reports the alerts firing on apps that break an alert rule
+	RuleAlerts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rule_alert",
+		Help:      "Alerts of operator-defined alert rules firing on apps (1 while firing).",
+	}, []string{"rule", "domain", "app_name"})
+)
+
+var (
+	// AppHealthy reports, per deployed app, whether its latest controller
+	// probe succeeded
+	AppHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "app_healthy",
+		Help:      "Whether a deployed app answered its latest health probe (1) or not (0).",
+	}, []string{"domain", "app_name"})
+)
+
+var (
+	// DeploymentVerifications counts finished post-deploy verifications
+	DeploymentVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deployment_verifications_total",
+		Help:      "Number of deployments verified or degraded after being deployed, by result.",
+	}, []string{"result"})
+
+	// SmokeTests counts finished smoke tests
+	SmokeTests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "smoke_tests_total",
+		Help:      "Number of smoke tests run after deployments, by result.",
+	}, []string{"result"})
+
+	// AutoRollbacks counts deployments rolled back automatically
+	AutoRollbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auto_rollbacks_total",
+		Help:      "Number of deployments rolled back automatically, by what triggered the rollback.",
+	}, []string{"trigger"})
+
+	// RetentionPruned counts rows deleted by the retention job
+	RetentionPruned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_pruned_total",
+		Help:      "Number of log chunks, events, versions and push requests deleted by the retention job, by kind.",
+	}, []string{"kind"})
+
+	// RetentionPrunable reports what the last retention run deleted, or would
+	// have deleted in a dry run
+	RetentionPrunable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "retention_prunable",
+		Help:      "Number of log chunks, events, versions and push requests past retention at the last retention run, by kind.",
+	}, []string{"kind"})
+
+	// OrphanedRecords reports what the last orphaned data check found
+	OrphanedRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orphaned_records",
+		Help:      "Number of deployments referencing deleted secret projects, unused registry credentials and dangling log chunks at the last orphaned data check, by kind.",
+	}, []string{"kind"})
+)
+
+// Handler returns the HTTP handler exposing metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvList is a deployment's env array of "KEY=value" entries. In requests an
+// entry may instead be a secret reference object such as
+// {"name":"DB_PASS","secret_ref":"payments/db-pass"}; it is stored as
+// "DB_PASS=${secret:payments/db-pass}" and resolved only for agents. A
+// {"name","sealed_value"} object holds a value sealed to the controller's
+// public key and is stored as "DB_PASS=${sealed:...}".
+type EnvList []string
+
+// SecretEnvVar is an env entry whose value is read from a stored secret or
+// sealed to the controller's public key; exactly one of SecretRef and
+// SealedValue is set
+type SecretEnvVar struct {
+	Name        string `json:"name" yaml:"name"`
+	SecretRef   string `json:"secret_ref,omitempty" yaml:"secret_ref,omitempty"`
+	SealedValue string `json:"sealed_value,omitempty" yaml:"sealed_value,omitempty"`
+}
+
+// secretRefValue matches the stored form of a secret reference value
+var secretRefValue = regexp.MustCompile(`^\$\{secret:([^}]*)\}$`)
+
+// sealedValue matches the stored form of a sealed value
+var sealedValue = regexp.MustCompile(`^\$\{sealed:([^}]*)\}$`)
+
+// SealedEntry formats a sealed value as an env entry
+func SealedEntry(name, sealed string) string {
+	return name + "=${sealed:" + sealed + "}"
+}
+
+// ParseSealedValue returns the variable name and sealed value of an env
+// entry, or ok=false if the entry is not sealed
+func ParseSealedValue(entry string) (name, sealed string, ok bool) {
+	name, value, found := strings.Cut(entry, "=")
+	if !found {
+		return "", "", false
+	}
+
+	match := sealedValue.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", false
+	}
+	return name, match[1], true
+}
+
+// SecretRefEntry formats a secret reference as an env entry
+func SecretRefEntry(name, ref string) string {
+	return name + "=${secret:" + ref + "}"
+}
+
+// ParseSecretRef returns the variable name and secret reference of an env
+// entry, or ok=false if the entry holds a plain value
+func ParseSecretRef(entry string) (name, ref string, ok bool) {
+	name, value, found := strings.Cut(entry, "=")
+	if !found {
+		return "", "", false
+	}
+
+	match := secretRefValue.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", false
+	}
+	return name, match[1], true
+}
+
+// SplitSecretRef splits a stored secret reference "project/name[@version]"
+// into its parts; version is 0 when the reference floats on the current
+// version. ok is false for external (scheme://) references and malformed
+// input.
+func SplitSecretRef(ref string) (project, name string, version int, ok bool) {
+	if strings.Contains(ref, "://") {
+		return "", "", 0, false
+	}
+
+	project, name, found := strings.Cut(ref, "/")
+	if !found {
+		return "", "", 0, false
+	}
+
+	if base, v, pinned := strings.Cut(name, "@"); pinned {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return "", "", 0, false
+		}
+		name, version = base, n
+	}
+
+	return project, name, version, true
+}
+
+// UnmarshalJSON accepts both string entries and secret reference objects
+func (l *EnvList) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if items == nil {
+		*l = nil
+		return nil
+	}
+
+	entries := make(EnvList, 0, len(items))
+	for i, item := range items {
+		var entry string
+		if err := json.Unmarshal(item, &entry); err == nil {
+			entries = append(entries, entry)
+			continue
+		}
+
+		// Secret reference objects are always decoded strictly
+		var ref SecretEnvVar
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&ref); err != nil {
+			return fmt.Errorf("env[%d]: must be a \"KEY=value\" string or a {\"name\", \"secret_ref\"|\"sealed_value\"} object", i)
+		}
+		if err := ref.validate(); err != nil {
+			return fmt.Errorf("env[%d]: %w", i, err)
+		}
+		entries = append(entries, ref.entry())
+	}
+
+	*l = entries
+	return nil
+}
+
+// UnmarshalYAML accepts both string entries and secret reference mappings
+func (l *EnvList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.SequenceNode {
+		return fmt.Errorf("env must be a list")
+	}
+
+	entries := make(EnvList, 0, len(value.Content))
+	for i, item := range value.Content {
+		if item.Kind == yaml.MappingNode {
+			var ref SecretEnvVar
+			if err := item.Decode(&ref); err != nil {
+				return fmt.Errorf("env[%d]: %w", i, err)
+			}
+			if err := ref.validate(); err != nil {
+				return fmt.Errorf("env[%d]: %w", i, err)
+			}
+			entries = append(entries, ref.entry())
+			continue
+		}
+
+		var entry string
+		if err := item.Decode(&entry); err != nil {
+			return fmt.Errorf("env[%d]: %w", i, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	*l = entries
+	return nil
+}
+
+func (v SecretEnvVar) validate() error {
+	if v.Name == "" {
+		return fmt.Errorf("secret references require a name")
+	}
+	if (v.SecretRef == "") == (v.SealedValue == "") {
+		return fmt.Errorf("exactly one of secret_ref and sealed_value is required")
+	}
+	if strings.ContainsAny(v.SecretRef+v.SealedValue, "{}") {
+		return fmt.Errorf("secret_ref and sealed_value must not contain braces")
+	}
+	return nil
+}
+
+// entry returns the stored form of the env entry
+func (v SecretEnvVar) entry() string {
+	if v.SealedValue != "" {
+		return SealedEntry(v.Name, v.SealedValue)
+	}
+	return SecretRefEntry(v.Name, v.SecretRef)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnvListUnmarshal(t *testing.T) {
+	want := EnvList{"MODE=prod", "DB_PASS=${secret:payments/db-pass}"}
+
+	var fromJSON EnvList
+	err := json.Unmarshal([]byte(`["MODE=prod",{"name":"DB_PASS","secret_ref":"payments/db-pass"}]`), &fromJSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var fromYAML EnvList
+	err = yaml.Unmarshal([]byte("- MODE=prod\n- name: DB_PASS\n  secret_ref: payments/db-pass\n"), &fromYAML)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, got := range []EnvList{fromJSON, fromYAML} {
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("Got %v, want %v", got, want)
+		}
+	}
+
+	name, ref, ok := ParseSecretRef(want[1])
+	if !ok || name != "DB_PASS" || ref != "payments/db-pass" {
+		t.Errorf("ParseSecretRef(%q) = %q, %q, %v", want[1], name, ref, ok)
+	}
+	if _, _, ok := ParseSecretRef(want[0]); ok {
+		t.Errorf("Expected %q not to be a secret reference", want[0])
+	}
+
+	var sealed EnvList
+	if err := json.Unmarshal([]byte(`[{"name":"API_KEY","sealed_value":"c2VhbGVk"}]`), &sealed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	name, value, ok := ParseSealedValue(sealed[0])
+	if !ok || name != "API_KEY" || value != "c2VhbGVk" {
+		t.Errorf("ParseSealedValue(%q) = %q, %q, %v", sealed[0], name, value, ok)
+	}
+	if _, _, ok := ParseSecretRef(sealed[0]); ok {
+		t.Errorf("Expected %q not to be a secret reference", sealed[0])
+	}
+
+	for _, bad := range []string{`[{"name":"DB_PASS"}]`, `[{"name":"X","secret_ref":"a/b","value":"leak"}]`, `[{"name":"X","secret_ref":"a/b","sealed_value":"c2VhbGVk"}]`, `[42]`} {
+		var env EnvList
+		if err := json.Unmarshal([]byte(bad), &env); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
+
+func TestSplitSecretRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		project string
+		name    string
+		version int
+		ok      bool
+	}{
+		{ref: "payments/db-pass", project: "payments", name: "db-pass", ok: true},
+		{ref: "payments/db-pass@3", project: "payments", name: "db-pass", version: 3, ok: true},
+		{ref: "payments/db-pass@0"},
+		{ref: "payments/db-pass@latest"},
+		{ref: "db-pass"},
+		{ref: "vault://secret/data/payments#db_pass"},
+	}
+
+	for _, tt := range tests {
+		project, name, version, ok := SplitSecretRef(tt.ref)
+		if ok != tt.ok || project != tt.project || name != tt.name || version != tt.version {
+			t.Errorf("SplitSecretRef(%q) = %q, %q, %d, %v", tt.ref, project, name, version, ok)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,17 +13,125 @@ import (
 
 // DeploymentRequest represents the incoming deployment request
 type DeploymentRequest struct {
-	Domain      string    `json:"domain" binding:"required"`
-	AppName     string    `json:"app_name" binding:"required"`
-	DockerImage string    `json:"docker_image" binding:"required"`
-	Port        int       `json:"port" binding:"required,min=1,max=65535"`
-	Env         []string  `json:"env"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	Domain      string    `json:"domain" yaml:"domain" binding:"required"`
+	AppName     string    `json:"app_name" yaml:"app_name" binding:"required"`
+	DockerImage string    `json:"docker_image" yaml:"docker_image" binding:"required"`
+	Port        int       `json:"port" yaml:"port" binding:"required,min=1,max=65535"`
+	Env         EnvList   `json:"env" yaml:"env,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at" yaml:"updated_at,omitempty"`
+
+	// Priority orders the deployment for agents and the async push queue;
+	// empty means normal
+	Priority string `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// Checks names the CI checks (e.g. GitHub check runs) that must succeed
+	// before agents may start the deployment
+	Checks []string `json:"checks,omitempty" yaml:"checks,omitempty"`
+
+	// Metadata is free-form context such as ticket IDs or release names,
+	// queryable with ?metadata.<key>=value filters
+	Metadata map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	BuildInfo `yaml:",inline"`
+}
+
+// BuildInfo traces a deployment back to the commit and CI run that built
+// its image; every field is optional
+type BuildInfo struct {
+	GitSHA   string `json:"git_sha,omitempty" yaml:"git_sha,omitempty" db:"git_sha"`
+	GitRef   string `json:"git_ref,omitempty" yaml:"git_ref,omitempty" db:"git_ref"`
+	BuildURL string `json:"build_url,omitempty" yaml:"build_url,omitempty" db:"build_url"`
+	Builder  string `json:"builder,omitempty" yaml:"builder,omitempty" db:"builder"`
+}
+
+// Deployment priorities, most urgent first
+const (
+	PriorityHotfix = "hotfix"
+	PriorityNormal = "normal"
+	PriorityBulk   = "bulk"
+)
+
+// Priorities lists the deployment priorities, most urgent first
+var Priorities = []string{PriorityHotfix, PriorityNormal, PriorityBulk}
+
+// PriorityRank orders priorities, lower being more urgent; unknown
+// priorities rank as normal
+func PriorityRank(priority string) int {
+	for i, p := range Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// CI check statuses
+const (
+	CheckPending = "pending"
+	CheckSuccess = "success"
+	CheckFailure = "failure"
+)
+
+// CheckStatuses lists the statuses a CI check may report
+var CheckStatuses = []string{CheckPending, CheckSuccess, CheckFailure}
+
+// DeploymentCheck is a CI check a deployment is held on until it succeeds
+type DeploymentCheck struct {
+	Name       string    `json:"name" db:"name"`
+	Status     string    `json:"status" db:"status"`
+	DetailsURL string    `json:"details_url,omitempty" db:"details_url"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CheckStatus reports the outcome of one CI check
+type CheckStatus struct {
+	Name       string `json:"name" binding:"required"`
+	Status     string `json:"status" binding:"required"`
+	DetailsURL string `json:"details_url"`
+}
+
+// CheckStatusRequest is the body of POST /deployments/:id/checks
+type CheckStatusRequest struct {
+	Checks []CheckStatus `json:"checks" binding:"required,min=1,dive"`
+}
+
+// DeploymentChecks reports the CI checks of a deployment. Held is set while
+// any of them has not succeeded, keeping the deployment from agents.
+type DeploymentChecks struct {
+	DeploymentID uuid.UUID         `json:"deployment_id"`
+	Held         bool              `json:"held"`
+	Checks       []DeploymentCheck `json:"checks"`
+}
+
+// Held reports whether any check has not succeeded yet
+func Held(checks []DeploymentCheck) bool {
+	for _, check := range checks {
+		if check.Status != CheckSuccess {
+			return true
+		}
+	}
+	return false
 }
 
 // DeploymentPushRequest represents the array of deployment changes
 type DeploymentPushRequest []DeploymentRequest
 
+// PushRequest is a push batch as submitted, kept so it can be replayed
+type PushRequest struct {
+	RequestID   string                `json:"request_id"`
+	Deployments DeploymentPushRequest `json:"deployments"`
+
+	// Options are the push options the batch was applied with
+	Options json.RawMessage `json:"options"`
+
+	// Failed holds the indexes of the items that failed
+	Failed []int `json:"failed"`
+
+	// ReplayOf is the request the batch replayed, if any
+	ReplayOf  string    `json:"replay_of,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Deployment represents a deployment record in the database
 type Deployment struct {
 	ID          uuid.UUID  `json:"id" db:"id"`
@@ -33,6 +146,150 @@ type Deployment struct {
 	DeployedAt  *time.Time `json:"deployed_at,omitempty" db:"deployed_at"`
 	Status      string     `json:"status" db:"status"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	Priority    string     `json:"priority" db:"priority"`
+	Links       Links      `json:"_links,omitempty" db:"-"`
+
+	// Metadata is the free-form context set on push
+	Metadata map[string]any `json:"metadata,omitempty" db:"metadata"`
+
+	BuildInfo
+
+	// SecretError is the last error resolving this deployment's secret
+	// references for an agent; empty once they resolve
+	SecretError string `json:"secret_error,omitempty" db:"secret_error"`
+
+	// ImageDeletedAt is when a registry webhook reported the deployment's
+	// image deleted; agents pulling it again will fail
+	ImageDeletedAt *time.Time `json:"image_deleted_at,omitempty" db:"image_deleted_at"`
+
+	// Verification is the outcome of health checking the deployment once
+	// deployed, and VerifiedAt when it was reached; empty when unverified
+	Verification string     `json:"verification,omitempty" db:"verification"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+
+	// Unchanged is set on push responses when the request matched this
+	// existing version and no new version was created
+	Unchanged bool `json:"unchanged,omitempty" db:"-"`
+
+	// Drift compares the deployment with its app's declaration in the git
+	// sync branch; empty when git sync is not configured
+	Drift string `json:"drift,omitempty" db:"-"`
+
+	// Health is the outcome of the app's latest health probe, set on the
+	// deployments list; nil when the app was never probed
+	Health *AppHealth `json:"health,omitempty" db:"-"`
+
+	// Failure is why the deployment failed, as reported with its failed
+	// status; nil when none was reported or the status has changed since
+	Failure *DeploymentFailure `json:"failure,omitempty" db:"-"`
+}
+
+// Well-known deployment failure codes; agents may report others
+const (
+	FailureImagePull          = "image_pull_error"
+	FailurePortInUse          = "port_in_use"
+	FailureHealthCheckTimeout = "health_check_timeout"
+
+	// FailureStuck is set by the watchdog on deployments it fails for
+	// getting no status update in time
+	FailureStuck = "stuck"
+)
+
+// DeploymentFailure is a machine-readable reason for a failed deployment
+type DeploymentFailure struct {
+	Code    string         `json:"error_code" db:"failure_code"`
+	Message string         `json:"error_message,omitempty" db:"failure_message"`
+	Details map[string]any `json:"details,omitempty" db:"failure_details"`
+}
+
+// StatusUpdateRequest changes a deployment's status; the error fields
+// describe a failed status
+type StatusUpdateRequest struct {
+	Status       string         `json:"status" binding:"required"`
+	ErrorCode    string         `json:"error_code"`
+	ErrorMessage string         `json:"error_message"`
+	Details      map[string]any `json:"details"`
+
+	// ImageDigest is the digest of the image the agent started, reported
+	// with status deployed; digest drift detection compares against it
+	ImageDigest string `json:"image_digest"`
+}
+
+// Drift states of a deployment against the git sync branch
+const (
+	// DriftInSync means the deployment matches the declaration
+	DriftInSync = "in_sync"
+	// DriftDrifted means the deployment differs from the declaration
+	DriftDrifted = "drifted"
+	// DriftUnknown means the app is not declared, or the branch has not
+	// been synced yet
+	DriftUnknown = "unknown"
+)
+
+// AgentDeployment is a deployment as served to agents, with secret
+// references resolved
+type AgentDeployment struct {
+	Deployment
+
+	// Vault is set when vault:// references were left for the agent to
+	// resolve with a short-lived token
+	Vault *VaultCredentials `json:"vault,omitempty"`
+}
+
+// VaultCredentials lets an agent read Vault secrets referenced by a deployment
+type VaultCredentials struct {
+	Address   string    `json:"address"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Link represents a hypermedia link to a related resource
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+// Links maps link relations to their targets
+type Links map[string]Link
+
+// ETag returns a strong entity tag that changes whenever the deployment's
+// version, status or deployment time changes
+func (d *Deployment) ETag() string {
+	deployedAt := ""
+	if d.DeployedAt != nil {
+		deployedAt = d.DeployedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", d.ID, d.Version, d.Status, deployedAt)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Matches reports whether the deployment already has the image, port and env
+// of req, built from the same commit and with the same metadata when req
+// names them
+func (d *Deployment) Matches(req DeploymentRequest) bool {
+	if d.DockerImage != req.DockerImage || d.Port != req.Port || len(d.Env) != len(req.Env) {
+		return false
+	}
+	if req.GitSHA != "" && req.GitSHA != d.GitSHA {
+		return false
+	}
+	if req.Metadata != nil {
+		want, _ := json.Marshal(req.Metadata)
+		have, _ := json.Marshal(d.Metadata)
+		if len(d.Metadata) == 0 {
+			have = []byte("{}")
+		}
+		if string(want) != string(have) {
+			return false
+		}
+	}
+	for i := range d.Env {
+		if d.Env[i] != req.Env[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // RegistryCredential represents Docker registry credentials
@@ -51,6 +308,907 @@ type RegistryCredentialRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// Secret is the metadata of a stored secret; the value is never returned
+type Secret struct {
+	Project   string    `json:"project" db:"project"`
+	Name      string    `json:"name" db:"name"`
+	Version   int       `json:"version" db:"version"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SecretVersion is the metadata of one value a secret has held
+type SecretVersion struct {
+	Version   int       `json:"version" db:"version"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SecretImpact lists the latest deployments that reference a secret. Those
+// floating on its current version are redeployed when it is rotated; pinned
+// ones are left alone.
+type SecretImpact struct {
+	Secret   Secret       `json:"secret"`
+	Redeploy []Deployment `json:"redeploy"`
+	Pinned   []Deployment `json:"pinned"`
+}
+
+// SecretRotation is the result of rotating a secret
+type SecretRotation struct {
+	Secret     Secret       `json:"secret"`
+	RequestID  string       `json:"request_id,omitempty"`
+	Redeployed []Deployment `json:"redeployed"`
+	Pinned     []Deployment `json:"pinned"`
+}
+
+// Audit actions
+const (
+	AuditSecretRead   = "secret.read"
+	AuditRegistryRead = "registry.read"
+	AuditBackupRead   = "backup.read"
+)
+
+// AuditEvent records a read of sensitive data: who read which resource,
+// when, and for which deployment
+type AuditEvent struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	Action       string     `json:"action" db:"action"`
+	Resource     string     `json:"resource" db:"resource"`
+	Actor        string     `json:"actor" db:"actor"`
+	ClientIP     string     `json:"client_ip,omitempty" db:"client_ip"`
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty" db:"deployment_id"`
+	Detail       string     `json:"detail,omitempty" db:"detail"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Schedule re-creates an app's latest deployment as a new version on a cron
+// cadence, e.g. to pick up a rebuilt :latest image nightly
+type Schedule struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	Domain           string     `json:"domain" db:"domain"`
+	AppName          string     `json:"app_name" db:"app_name"`
+	Cron             string     `json:"cron" db:"cron"`
+	Paused           bool       `json:"paused" db:"paused"`
+	NextRunAt        time.Time  `json:"next_run_at" db:"next_run_at"`
+	LastRunAt        *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastDeploymentID *uuid.UUID `json:"last_deployment_id,omitempty" db:"last_deployment_id"`
+	LastError        string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ScheduleRequest creates or replaces an app's schedule
+type ScheduleRequest struct {
+	// Cron is a standard five-field expression or a descriptor such as
+	// "@daily", evaluated in UTC
+	Cron   string `json:"cron" binding:"required"`
+	Paused bool   `json:"paused"`
+}
+
+// ScheduleRun is the outcome of running a schedule
+type ScheduleRun struct {
+	Schedule   Schedule    `json:"schedule"`
+	Deployment *Deployment `json:"deployment,omitempty"`
+}
+
+// Deployment event types
+const (
+	EventStatusChanged    = "status_changed"
+	EventRetryScheduled   = "retry_scheduled"
+	EventRetried          = "retried"
+	EventRetrySkipped     = "retry_skipped"
+	EventRetriesExhausted = "retries_exhausted"
+	EventVerified         = "verified"
+	EventDegraded         = "degraded"
+	EventSmokePassed      = "smoke_test_passed"
+	EventSmokeFailed      = "smoke_test_failed"
+
+	// EventRolledBack marks a deployment rolled back automatically, and
+	// EventRollback the new version restoring the previous one
+	EventRolledBack = "rolled_back"
+	EventRollback   = "rollback"
+)
+
+// Verification states of a deployed deployment
+const (
+	// VerificationVerifying means the deployment is being health checked
+	VerificationVerifying = "verifying"
+	// VerificationVerified means it stayed healthy through the window
+	VerificationVerified = "verified"
+	// VerificationDegraded means it failed too many health checks, or none
+	// reported
+	VerificationDegraded = "degraded"
+)
+
+// DeploymentEvent is an entry on a deployment's timeline
+type DeploymentEvent struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	Type         string    `json:"type" db:"type"`
+	Message      string    `json:"message" db:"message"`
+	Attempt      int       `json:"attempt,omitempty" db:"attempt"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	// FromStatus and ToStatus are set on status_changed events, so status
+	// transitions are queried without parsing messages
+	FromStatus string `json:"from_status,omitempty" db:"from_status"`
+	ToStatus   string `json:"to_status,omitempty" db:"to_status"`
+}
+
+// EventReplayRequest is the body of POST /deployments/:id/events/replay.
+// Since, when set, skips the events recorded before it.
+type EventReplayRequest struct {
+	URL   string     `json:"url" binding:"required"`
+	Since *time.Time `json:"since"`
+}
+
+// EventReplayNotification is posted to the replay URL for each event of a
+// deployment, oldest first
+type EventReplayNotification struct {
+	Event        string    `json:"event"`
+	Replayed     bool      `json:"replayed"`
+	EventID      uuid.UUID `json:"event_id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Domain       string    `json:"domain"`
+	AppName      string    `json:"app_name"`
+	Version      int       `json:"version"`
+	Type         string    `json:"type"`
+	Message      string    `json:"message"`
+	Attempt      int       `json:"attempt,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// EventReplay reports how far a replay got. When a delivery fails, Error
+// says why and ResumeSince is the since to replay the rest with.
+type EventReplay struct {
+	DeploymentID uuid.UUID  `json:"deployment_id"`
+	URL          string     `json:"url"`
+	Total        int        `json:"total"`
+	Delivered    int        `json:"delivered"`
+	Error        string     `json:"error,omitempty"`
+	ResumeSince  *time.Time `json:"resume_since,omitempty"`
+}
+
+// RetryPolicy makes the scheduler retry an app's failed deployments, resetting
+// them to pending after an exponential backoff
+type RetryPolicy struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+
+	// MaxAttempts counts the first attempt, so 1 disables retries
+	MaxAttempts           int `json:"max_attempts" db:"max_attempts"`
+	InitialBackoffSeconds int `json:"initial_backoff_seconds" db:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int `json:"max_backoff_seconds" db:"max_backoff_seconds"`
+
+	// Jitter randomizes each backoff by up to this fraction either way
+	Jitter float64 `json:"jitter" db:"jitter"`
+
+	// RetryOn limits retries to failures reported with one of these error
+	// codes; empty retries every failure
+	RetryOn   []string  `json:"retry_on" db:"retry_on"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RetryPolicyRequest creates or replaces an app's retry policy; zero
+// backoffs take the defaults
+type RetryPolicyRequest struct {
+	MaxAttempts           int     `json:"max_attempts" binding:"required"`
+	InitialBackoffSeconds int     `json:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int     `json:"max_backoff_seconds"`
+	Jitter                float64 `json:"jitter"`
+
+	// RetryOn lists the error codes worth retrying; empty retries every
+	// failure
+	RetryOn []string `json:"retry_on"`
+}
+
+// Retries reports whether the policy retries a deployment that failed for
+// the given reason; nil is a failure without an error code
+func (p RetryPolicy) Retries(failure *DeploymentFailure) bool {
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	return failure != nil && slices.Contains(p.RetryOn, failure.Code)
+}
+
+// Backoff returns the delay before retrying after the given number of failed
+// attempts: the initial backoff doubled per attempt, capped at the maximum
+// and spread by jitter. r is a random number in [0, 1).
+func (p RetryPolicy) Backoff(attempts int, r float64) time.Duration {
+	delay := time.Duration(p.InitialBackoffSeconds) * time.Second
+	limit := time.Duration(p.MaxBackoffSeconds) * time.Second
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	return time.Duration(float64(delay) * (1 + p.Jitter*(2*r-1)))
+}
+
+// Image policy kinds
+const (
+	// ImagePolicySemver follows the highest tag in a semver range
+	ImagePolicySemver = "semver"
+	// ImagePolicyRegex follows the highest tag matching a regular expression
+	ImagePolicyRegex = "regex"
+	// ImagePolicyDigest follows the digest of the deployed tag, for mutable
+	// tags such as latest
+	ImagePolicyDigest = "digest"
+)
+
+// ImagePolicyKinds lists the image policy kinds
+var ImagePolicyKinds = []string{ImagePolicySemver, ImagePolicyRegex, ImagePolicyDigest}
+
+// ImagePolicy makes the controller watch an app's image repository and
+// deploy new versions of the image as the registry publishes them
+type ImagePolicy struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+	Kind    string `json:"kind" db:"kind"`
+
+	// Pattern is the semver range or regular expression tags must match;
+	// unused by digest policies
+	Pattern string `json:"pattern,omitempty" db:"pattern"`
+
+	// LastCheckedAt, LastImage and LastError describe the latest check:
+	// the image it settled on, or why it failed
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty" db:"last_checked_at"`
+	LastImage     string     `json:"last_image,omitempty" db:"last_image"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ImagePolicyRequest creates or replaces an app's image policy
+type ImagePolicyRequest struct {
+	Kind    string `json:"kind" binding:"required"`
+	Pattern string `json:"pattern"`
+}
+
+// ImageDigest tracks the digest behind an app's deployed mutable tag, such
+// as latest, to detect the tag moving after the deployment
+type ImageDigest struct {
+	Domain       string    `json:"domain" db:"domain"`
+	AppName      string    `json:"app_name" db:"app_name"`
+	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	DockerImage  string    `json:"docker_image" db:"docker_image"`
+
+	// DeployedDigest is the digest the deployment went live with, as its
+	// agent reported or the tag resolved to when it was marked deployed;
+	// RegistryDigest is what the tag resolves to now
+	DeployedDigest string `json:"deployed_digest,omitempty" db:"deployed_digest"`
+	RegistryDigest string `json:"registry_digest,omitempty" db:"registry_digest"`
+
+	// Drifted is set once the tag no longer points at the deployed digest
+	Drifted bool `json:"drifted" db:"drifted"`
+
+	// Error is why the latest check failed, if it did
+	Error     string    `json:"error,omitempty" db:"error"`
+	CheckedAt time.Time `json:"checked_at" db:"checked_at"`
+}
+
+// ObservedState is what an agent last reported actually running for an app
+type ObservedState struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+
+	// DeploymentID is the deployment the agent believes it runs, if known
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty" db:"deployment_id"`
+
+	DockerImage string `json:"docker_image" db:"docker_image"`
+	Digest      string `json:"digest,omitempty" db:"digest"`
+	Replicas    int    `json:"replicas" db:"replicas"`
+
+	// Agent is the reporting agent, as named by its X-Agent-ID header
+	Agent      string    `json:"agent" db:"agent"`
+	ReportedAt time.Time `json:"reported_at" db:"reported_at"`
+}
+
+// ObservedStateRequest reports what is running for an app
+type ObservedStateRequest struct {
+	DeploymentID *uuid.UUID `json:"deployment_id"`
+	DockerImage  string     `json:"docker_image" binding:"required"`
+	Digest       string     `json:"digest"`
+	Replicas     int        `json:"replicas" binding:"min=0"`
+}
+
+// HealthProbe is the result of an agent's health probe of an app
+type HealthProbe struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+
+	// DeploymentID is the deployment probed, defaulting to the app's latest
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty" db:"deployment_id"`
+
+	Healthy   bool      `json:"healthy" db:"healthy"`
+	Agent     string    `json:"agent" db:"agent"`
+	CheckedAt time.Time `json:"checked_at" db:"checked_at"`
+
+	// LatencyMs is how long an http probe took to answer, in milliseconds;
+	// nil for other probes and probes that got no answer
+	LatencyMs *float64 `json:"latency_ms,omitempty" db:"latency_ms"`
+}
+
+// App health states
+const (
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	// HealthStale means the latest probe is too old to trust
+	HealthStale = "stale"
+)
+
+// AppHealth is an app's health according to its latest probe
+type AppHealth struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Agent     string    `json:"agent"`
+}
+
+// HealthProbeRequest reports the result of a health probe of an app;
+// CheckedAt defaults to now
+type HealthProbeRequest struct {
+	DeploymentID *uuid.UUID `json:"deployment_id"`
+	Healthy      *bool      `json:"healthy" binding:"required"`
+	CheckedAt    *time.Time `json:"checked_at"`
+	LatencyMs    *float64   `json:"latency_ms"`
+}
+
+// Incident is a span during which an app's health probes were failing; it
+// is open until a healthy probe resolves it
+type Incident struct {
+	ID           int64      `json:"id" db:"id"`
+	Domain       string     `json:"domain" db:"domain"`
+	AppName      string     `json:"app_name" db:"app_name"`
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty" db:"deployment_id"`
+	StartedAt    time.Time  `json:"started_at" db:"started_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+
+	// DurationSeconds runs until now while the incident is open
+	DurationSeconds float64 `json:"duration_seconds" db:"-"`
+}
+
+// Environment states
+const (
+	// EnvironmentOperational means every app is deployed and none is
+	// degraded
+	EnvironmentOperational = "operational"
+	// EnvironmentDeploying means apps are pending or deploying and none is
+	// degraded
+	EnvironmentDeploying = "deploying"
+	// EnvironmentDegraded means some app failed or is unhealthy
+	EnvironmentDegraded = "degraded"
+)
+
+// DegradedApp is an app counted against an environment's status, with why
+type DegradedApp struct {
+	Domain  string `json:"domain"`
+	AppName string `json:"app_name"`
+	Version int    `json:"version"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+}
+
+// EnvironmentStatus rolls up the latest deployments of a domain, or of
+// every app, for status pages and pre-release gates
+type EnvironmentStatus struct {
+	Domain string `json:"domain,omitempty"`
+	Status string `json:"status"`
+
+	// Apps counts the apps, Healthy those deployed with a healthy latest
+	// probe and Unprobed those deployed but never probed
+	Apps     int `json:"apps"`
+	Healthy  int `json:"healthy"`
+	Unprobed int `json:"unprobed"`
+	Pending  int `json:"pending"`
+
+	Degraded  []DegradedApp `json:"degraded"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// Health check types
+const (
+	// HealthCheckHTTP requests a path on the app's domain and expects 2xx
+	HealthCheckHTTP = "http"
+	// HealthCheckTCP connects to a port on the app's domain
+	HealthCheckTCP = "tcp"
+	// HealthCheckExec runs a command on the app's agent, which reports the
+	// result as a health probe; exit status 0 is healthy
+	HealthCheckExec = "exec"
+)
+
+// HealthCheckTypes lists the health check types
+var HealthCheckTypes = []string{HealthCheckHTTP, HealthCheckTCP, HealthCheckExec}
+
+// HealthCheck overrides how an app's health is probed; apps without one get
+// the prober's default HTTP check
+type HealthCheck struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+	Type    string `json:"type" db:"type"`
+
+	// Path is requested by http checks, defaulting to probes.health_path
+	Path string `json:"path,omitempty" db:"path"`
+
+	// Port is connected to by tcp checks, defaulting to the deployment's port
+	Port int `json:"port,omitempty" db:"port"`
+
+	// Command is run by the agent for exec checks
+	Command []string `json:"command,omitempty" db:"command"`
+
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// HealthCheckRequest creates or replaces an app's health check
+type HealthCheckRequest struct {
+	Type    string   `json:"type" binding:"required"`
+	Path    string   `json:"path"`
+	Port    int      `json:"port"`
+	Command []string `json:"command"`
+}
+
+// Smoke test types
+const (
+	// SmokeTestHTTP makes a request to the app's domain and checks the
+	// response
+	SmokeTestHTTP = "http"
+	// SmokeTestExec runs a command on the app's agent, which reports the
+	// outcome; exit status 0 passes
+	SmokeTestExec = "exec"
+)
+
+// SmokeTestTypes lists the smoke test types
+var SmokeTestTypes = []string{SmokeTestHTTP, SmokeTestExec}
+
+// Smoke test result states
+const (
+	SmokeRunning = "running"
+	SmokePassed  = "passed"
+	SmokeFailed  = "failed"
+)
+
+// SmokeTest is run once after each deployment of an app is deployed
+type SmokeTest struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+	Type    string `json:"type" db:"type"`
+
+	// Method and Path make the request of http tests; {app_name} and
+	// {port} in the path are replaced from the deployment
+	Method string `json:"method,omitempty" db:"method"`
+	Path   string `json:"path,omitempty" db:"path"`
+
+	// ExpectedStatus is the status http tests must answer, any 2xx when 0,
+	// and ExpectedBody a string their body must contain
+	ExpectedStatus int    `json:"expected_status,omitempty" db:"expected_status"`
+	ExpectedBody   string `json:"expected_body,omitempty" db:"expected_body"`
+
+	// Command is run by the agent for exec tests
+	Command []string `json:"command,omitempty" db:"command"`
+
+	// Rollback rolls a deployment failing the test back to the app's
+	// previous deployed version
+	Rollback bool `json:"rollback" db:"rollback"`
+
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SmokeTestRequest creates or replaces an app's smoke test
+type SmokeTestRequest struct {
+	Type           string   `json:"type" binding:"required"`
+	Method         string   `json:"method"`
+	Path           string   `json:"path"`
+	ExpectedStatus int      `json:"expected_status"`
+	ExpectedBody   string   `json:"expected_body"`
+	Command        []string `json:"command"`
+	Rollback       bool     `json:"rollback"`
+}
+
+// SmokeTestRun is a deployment due a smoke test, or running one, with the
+// app's test
+type SmokeTestRun struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Domain       string    `json:"domain"`
+	AppName      string    `json:"app_name"`
+	Version      int       `json:"version"`
+	Port         int       `json:"port"`
+	Test         SmokeTest `json:"test"`
+
+	// StartedAt is when a running test started
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// SmokeTestResult is the outcome of a deployment's smoke test
+type SmokeTestResult struct {
+	DeploymentID uuid.UUID  `json:"deployment_id" db:"deployment_id"`
+	Status       string     `json:"status" db:"status"`
+	Message      string     `json:"message,omitempty" db:"message"`
+	Agent        string     `json:"agent,omitempty" db:"agent"`
+	StartedAt    time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+
+	// RollbackID is the version restoring the previous one when the
+	// failure rolled the deployment back
+	RollbackID *uuid.UUID `json:"rollback_id,omitempty" db:"-"`
+}
+
+// SmokeTestReport reports the outcome of an exec smoke test
+type SmokeTestReport struct {
+	Passed  *bool  `json:"passed" binding:"required"`
+	Message string `json:"message"`
+}
+
+// DeploymentLogChunk is one chunk of a deployment's log, uploaded by its
+// agent; chunks are numbered from 0 in upload order
+type DeploymentLogChunk struct {
+	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	Seq          int64     `json:"seq" db:"seq"`
+	Content      string    `json:"content" db:"content"`
+	Agent        string    `json:"agent,omitempty" db:"agent"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// DeploymentLogRequest uploads the next chunk of a deployment's log
+type DeploymentLogRequest struct {
+	Seq     *int64 `json:"seq" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
+
+// DeploymentLog is a range of a deployment's log chunks. NextSeq is the
+// chunk to read from next, to page through the log or follow it.
+type DeploymentLog struct {
+	DeploymentID uuid.UUID            `json:"deployment_id"`
+	Chunks       []DeploymentLogChunk `json:"chunks"`
+	NextSeq      int64                `json:"next_seq"`
+	Archived     bool                 `json:"archived,omitempty"`
+}
+
+// ArchivedDeploymentLog records a deployment log moved to the blob store
+// under Key; its chunks are read back from there
+type ArchivedDeploymentLog struct {
+	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	Key          string    `json:"key" db:"object_key"`
+	Chunks       int64     `json:"chunks" db:"chunks"`
+	ArchivedAt   time.Time `json:"archived_at" db:"archived_at"`
+}
+
+// AppMaintenance is an app's maintenance mode. While it is on, the app is
+// not probed or alerted on, and its rendered manifests are marked.
+type AppMaintenance struct {
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+	Enabled bool   `json:"enabled" db:"-"`
+
+	// Reason, StartedBy and StartedAt describe maintenance that is on
+	Reason    string     `json:"reason,omitempty" db:"reason"`
+	StartedBy string     `json:"started_by,omitempty" db:"started_by"`
+	StartedAt *time.Time `json:"started_at,omitempty" db:"started_at"`
+}
+
+// ETag returns a strong entity tag that changes whenever the app enters or
+// leaves maintenance or its reason changes
+func (m *AppMaintenance) ETag() string {
+	startedAt := ""
+	if m.StartedAt != nil {
+		startedAt = m.StartedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%t|%s|%s|%s", m.Domain, m.AppName, m.Enabled, m.Reason, m.StartedBy, startedAt)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// MaintenanceRequest turns an app's maintenance mode on or off
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Reason  string `json:"reason"`
+}
+
+// WriteFreeze is the server-wide freeze on new deployments. While it is on,
+// pushes and automation creating deployments are rejected or paused.
+type WriteFreeze struct {
+	Enabled bool `json:"enabled" db:"-"`
+
+	// Reason, StartedBy and StartedAt describe a freeze that is on
+	Reason    string     `json:"reason,omitempty" db:"reason"`
+	StartedBy string     `json:"started_by,omitempty" db:"started_by"`
+	StartedAt *time.Time `json:"started_at,omitempty" db:"started_at"`
+}
+
+// ETag returns a strong entity tag that changes whenever the freeze starts
+// or is lifted, or its reason changes
+func (f *WriteFreeze) ETag() string {
+	startedAt := ""
+	if f.StartedAt != nil {
+		startedAt = f.StartedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%t|%s|%s|%s", f.Enabled, f.Reason, f.StartedBy, startedAt)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Comparison states of an app's observed and desired state
+const (
+	// ObservedInSync means the agent runs the desired deployment
+	ObservedInSync = "in_sync"
+	// ObservedMismatched means the agent runs something else
+	ObservedMismatched = "mismatched"
+	// ObservedRollingOut means the agent runs something else while the
+	// desired deployment is still pending or deploying
+	ObservedRollingOut = "rolling_out"
+	// ObservedStale means the agent's latest report is too old to trust
+	ObservedStale = "stale"
+	// ObservedUnreported means no agent has reported on the app
+	ObservedUnreported = "unreported"
+)
+
+// DesiredState is what the controller wants running for an app: its latest
+// deployment
+type DesiredState struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Version      int       `json:"version"`
+	Status       string    `json:"status"`
+	DockerImage  string    `json:"docker_image"`
+
+	// Digest is the digest pinned in the image or, for a mutable tag, the
+	// one tracked by digest drift detection; empty when neither is known
+	Digest   string `json:"digest,omitempty"`
+	Replicas int    `json:"replicas"`
+}
+
+// Mismatch is a field whose observed value differs from the desired one
+type Mismatch struct {
+	Field    string `json:"field"`
+	Desired  string `json:"desired"`
+	Observed string `json:"observed"`
+}
+
+// AppComparison compares what an agent reports running for an app with its
+// desired state
+type AppComparison struct {
+	ID         string         `json:"id"`
+	Domain     string         `json:"domain"`
+	AppName    string         `json:"app_name"`
+	State      string         `json:"state"`
+	Desired    DesiredState   `json:"desired"`
+	Observed   *ObservedState `json:"observed,omitempty"`
+	Mismatches []Mismatch     `json:"mismatches"`
+}
+
+// RolloutLimit caps how many of a domain's apps, or how many versions of one
+// app, agents may have in the deploying state at once
+type RolloutLimit struct {
+	Domain string `json:"domain" db:"domain"`
+
+	// AppName is empty for a domain-wide limit
+	AppName      string    `json:"app_name,omitempty" db:"app_name"`
+	MaxDeploying int       `json:"max_deploying" db:"max_deploying"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RolloutLimitRequest sets a rollout limit
+type RolloutLimitRequest struct {
+	MaxDeploying int `json:"max_deploying" binding:"required"`
+}
+
+// ClaimRequest asks for pending deployments to start; they are moved to
+// deploying within the rollout limits
+type ClaimRequest struct {
+	// Domain restricts the claim to one domain's apps
+	Domain string `json:"domain"`
+
+	// Limit is the most deployments to claim, defaulting to 1
+	Limit int `json:"limit"`
+}
+
+// Lease is a named, expiring claim held by one controller instance
+type Lease struct {
+	Name       string    `json:"name" db:"name"`
+	Holder     string    `json:"holder" db:"holder"`
+	AcquiredAt time.Time `json:"acquired_at" db:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at" db:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// VersionInfo describes the running server and which features are on
+type VersionInfo struct {
+	Version   string          `json:"version"`
+	GoVersion string          `json:"go_version"`
+	Features  map[string]bool `json:"features"`
+}
+
+// TokenCounts is how many API, reveal and agent tokens are accepted
+type TokenCounts struct {
+	API    int `json:"api"`
+	Reveal int `json:"reveal"`
+	Agent  int `json:"agent"`
+}
+
+// LeaderStatus describes leadership as seen by the instance serving the
+// request
+type LeaderStatus struct {
+	InstanceID string `json:"instance_id"`
+	IsLeader   bool   `json:"is_leader"`
+
+	// Lease is the current leader lease; nil when no instance holds it
+	Lease *Lease `json:"lease"`
+}
+
+// RetentionPolicy is the configured retention of deployment data; an empty
+// age or zero count keeps that data forever
+type RetentionPolicy struct {
+	Logs           string `json:"logs,omitempty"`
+	Events         string `json:"events,omitempty"`
+	VersionsPerApp int    `json:"versions_per_app,omitempty"`
+	Requests       string `json:"requests,omitempty"`
+	Interval       string `json:"interval"`
+	DryRun         bool   `json:"dry_run"`
+}
+
+// RetentionReport counts the log chunks, events, versions and push requests
+// a retention run pruned, or would have pruned in a dry run
+type RetentionReport struct {
+	DryRun   bool      `json:"dry_run"`
+	Logs     int64     `json:"logs"`
+	Events   int64     `json:"events"`
+	Versions int64     `json:"versions"`
+	Requests int64     `json:"requests"`
+	RanAt    time.Time `json:"ran_at"`
+}
+
+// MissingSecretProject is a deployment whose env references a secret
+// project that no longer holds any secrets
+type MissingSecretProject struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Domain       string    `json:"domain"`
+	AppName      string    `json:"app_name"`
+	Version      int       `json:"version"`
+	Project      string    `json:"project"`
+}
+
+// DanglingLog is an archived deployment log with chunks still in Postgres
+type DanglingLog struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Chunks       int64     `json:"chunks"`
+}
+
+// OrphanReport lists the data left inconsistent by deletions: deployments
+// referencing deleted secret projects, credentials of registries no
+// deployment uses and archived logs with chunks left in Postgres. With
+// Cleaned the registries and logs were deleted; deployments are never
+// changed.
+type OrphanReport struct {
+	Cleaned          bool                   `json:"cleaned"`
+	MissingProjects  []MissingSecretProject `json:"missing_projects"`
+	UnusedRegistries []string               `json:"unused_registries"`
+	DanglingLogs     []DanglingLog          `json:"dangling_logs"`
+	CheckedAt        time.Time              `json:"checked_at"`
+}
+
+// ArchivedDeployment is a pruned deployment version as archived to the blob
+// store, with its timeline and where its log was archived, if it had one
+type ArchivedDeployment struct {
+	Deployment
+	Events []DeploymentEvent `json:"events"`
+	LogKey string            `json:"log_key,omitempty"`
+}
+
+// RetentionStatus is the retention policy with a dry run of it
+type RetentionStatus struct {
+	Policy  RetentionPolicy `json:"policy"`
+	Preview RetentionReport `json:"preview"`
+}
+
+// GitSyncStatus is the outcome of the latest sync of a git branch of
+// deployment YAMLs
+type GitSyncStatus struct {
+	Branch   string    `json:"branch" db:"branch"`
+	Commit   string    `json:"commit,omitempty" db:"commit_sha"`
+	SyncedAt time.Time `json:"synced_at" db:"synced_at"`
+
+	// Deployments is the per-app outcome, as for an import
+	Deployments []ImportItemResult `json:"deployments" db:"result"`
+
+	// Error is why the sync failed as a whole, such as a failed fetch or an
+	// unreadable file; no deployments are applied then
+	Error string `json:"error,omitempty" db:"error"`
+
+	// Declared is the deployments declared at the last commit read
+	// successfully, used to report drift; it is not served since env values
+	// are unredacted
+	Declared []DeploymentRequest `json:"-" db:"declared"`
+}
+
+// WrappedDataKey is a new data key wrapped by the KMS master key
+type WrappedDataKey struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Wrapped  string `json:"wrapped"`
+}
+
+// ReencryptResult reports a re-encryption of stored secrets
+type ReencryptResult struct {
+	KeyID       string `json:"key_id"`
+	Reencrypted int    `json:"reencrypted"`
+}
+
+// SecretRequest represents the request to create a secret. Exactly one of
+// Value and SealedValue (sealed to the controller's public key) is set.
+type SecretRequest struct {
+	Project     string `json:"project" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	Value       string `json:"value"`
+	SealedValue string `json:"sealed_value"`
+}
+
+// SecretUpdateRequest represents the request to replace a secret's value
+type SecretUpdateRequest struct {
+	Value       string `json:"value"`
+	SealedValue string `json:"sealed_value"`
+}
+
+// SealingKey is the controller's public key for sealing values client-side
+type SealingKey struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// Manifest is a deployment rendered for an orchestrator
+type Manifest struct {
+	Format  string `json:"format"`
+	Content string `json:"content"`
+
+	// SecretFiles holds secret material the format keeps outside Content,
+	// keyed by where the agent should put it: compose secret files relative
+	// to the project directory, or Nomad variable paths
+	SecretFiles map[string]string `json:"secret_files,omitempty"`
+}
+
+// ManifestSnapshot is a manifest as it was rendered for a deployment. Secret
+// values are masked in Content and SecretFiles; ContentDigest is the SHA-256
+// of the unmasked content as served, so an applied copy can be checked
+// against it. The list endpoint leaves out Content and SecretFiles.
+type ManifestSnapshot struct {
+	ID            int64             `json:"id" db:"id"`
+	DeploymentID  uuid.UUID         `json:"deployment_id" db:"deployment_id"`
+	Format        string            `json:"format" db:"format"`
+	Content       string            `json:"content,omitempty" db:"content"`
+	SecretFiles   map[string]string `json:"secret_files,omitempty" db:"secret_files"`
+	ContentDigest string            `json:"content_digest" db:"content_digest"`
+	InlineSecrets bool              `json:"inline_secrets" db:"inline_secrets"`
+	Maintenance   bool              `json:"maintenance" db:"maintenance"`
+	RenderedBy    string            `json:"rendered_by,omitempty" db:"rendered_by"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+}
+
+// AppState is an app's latest deployment keyed by its stable ID,
+// domain/app_name. It leaves out status and timestamps, which change without
+// the app being changed, so declarative clients such as a Terraform provider
+// only see a diff when the app itself changes.
+type AppState struct {
+	ID          string   `json:"id"`
+	Domain      string   `json:"domain"`
+	AppName     string   `json:"app_name"`
+	DockerImage string   `json:"docker_image"`
+	Port        int      `json:"port"`
+	Env         []string `json:"env"`
+	Priority    string   `json:"priority"`
+	Version     int      `json:"version"`
+}
+
+// AppRequest creates or updates an app addressed by domain and app name
+type AppRequest struct {
+	DockerImage string  `json:"docker_image" binding:"required"`
+	Port        int     `json:"port" binding:"required,min=1,max=65535"`
+	Env         EnvList `json:"env"`
+	Priority    string  `json:"priority,omitempty"`
+}
+
+// RegistryCredentialUpdate sets the credentials of a registry addressed by
+// host
+type RegistryCredentialUpdate struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 // RegistryCredentialResponse represents the response when getting registry credentials
 type RegistryCredentialResponse struct {
 	Registry string `json:"registry"`
@@ -60,10 +1218,304 @@ type RegistryCredentialResponse struct {
 
 // APIResponse represents a standard API response
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success    bool         `json:"success"`
+	Message    string       `json:"message,omitempty"`
+	Data       interface{}  `json:"data,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	Pagination *Pagination  `json:"pagination,omitempty"`
+}
+
+// FieldError describes a validation failure for a single request field.
+// Index identifies the item for batch requests.
+type FieldError struct {
+	Index   *int   `json:"index,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Pagination describes how to fetch the next page of a cursor-paginated list
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Cursor is a keyset pagination position; lists are ordered by
+// (created_at, id) descending and resume strictly after the cursor
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Date range fields
+const (
+	DateFieldCreated  = "created_at"
+	DateFieldDeployed = "deployed_at"
+)
+
+// DateRange restricts lists and stats to deployments whose Field falls in
+// [From, To). A nil bound is open; deployments never deployed fall outside
+// any range on deployed_at.
+type DateRange struct {
+	Field string
+	From  *time.Time
+	To    *time.Time
+}
+
+// IsZero reports whether the range has no bounds
+func (r DateRange) IsZero() bool {
+	return r.From == nil && r.To == nil
+}
+
+// Contains reports whether the deployment falls in the range
+func (r DateRange) Contains(d Deployment) bool {
+	if r.IsZero() {
+		return true
+	}
+	at := &d.CreatedAt
+	if r.Field == DateFieldDeployed {
+		at = d.DeployedAt
+	}
+	if at == nil {
+		return false
+	}
+	if r.From != nil && at.Before(*r.From) {
+		return false
+	}
+	return r.To == nil || at.Before(*r.To)
+}
+
+// MetadataFilter restricts lists to deployments whose metadata holds every
+// key with the given value, compared as text
+type MetadataFilter map[string]string
+
+// Matches reports whether the metadata holds every key of the filter
+func (f MetadataFilter) Matches(metadata map[string]any) bool {
+	for key, want := range f {
+		value, ok := metadata[key]
+		if !ok || value == nil || MetadataText(value) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// MetadataText renders a metadata value the way filters compare it: strings
+// as is and anything else as JSON, like Postgres' ->> operator
+func MetadataText(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// IdempotencyRecord represents the stored outcome of a request made with an Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string    `json:"key" db:"key"`
+	RequestHash string    `json:"request_hash" db:"request_hash"`
+	StatusCode  int       `json:"status_code" db:"status_code"`
+	Response    []byte    `json:"response" db:"response"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// RegistryReference identifies a stored registry credential in exports.
+// Password is only set when importing credentials from another source.
+type RegistryReference struct {
+	Registry string `json:"registry" yaml:"registry" binding:"required"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// RegistryWebhookResult reports what a registry webhook triggered
+type RegistryWebhookResult struct {
+	// Checking lists the apps (domain/app_name) whose image policies are
+	// checked for the pushed images
+	Checking []string `json:"checking"`
+
+	// Flagged lists the deployments whose image was reported deleted
+	Flagged []uuid.UUID `json:"flagged,omitempty"`
+
+	// JobID is the job checking the image policies, when one was queued
+	JobID *uuid.UUID `json:"job_id,omitempty"`
+}
+
+// ControllerExport represents a portable snapshot of controller state
+type ControllerExport struct {
+	FormatVersion int                 `json:"format_version" yaml:"format_version"`
+	ExportedAt    time.Time           `json:"exported_at" yaml:"exported_at"`
+	Redacted      bool                `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+	Deployments   []DeploymentRequest `json:"deployments" yaml:"deployments"`
+	Registries    []RegistryReference `json:"registries" yaml:"registries"`
+}
+
+// ArchivedExport is an export bundle written to the blob store under Key
+type ArchivedExport struct {
+	Key         string    `json:"key"`
+	ExportedAt  time.Time `json:"exported_at"`
+	Redacted    bool      `json:"redacted,omitempty"`
+	Deployments int       `json:"deployments"`
+	Registries  int       `json:"registries"`
+}
+
+// Backup is a consistent logical copy of the controller's database, taken
+// with GET /api/v1/admin/backup or `server backup` and restored with POST
+// /api/v1/admin/restore or `server restore`
+type Backup struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Tables holds every backed-up table's rows as JSON objects
+	Tables map[string][]json.RawMessage `json:"tables"`
+
+	// CredentialsEncrypted is set when registry passwords in the backup are
+	// encrypted with the controller's secrets key, as they always are;
+	// without a key registry credentials are left out and listed in Omitted
+	CredentialsEncrypted bool     `json:"credentials_encrypted,omitempty"`
+	Omitted              []string `json:"omitted,omitempty"`
+
+	// DataKeys are the KMS-wrapped data keys secret values are encrypted
+	// under, to configure on the controller the backup is restored into
+	DataKeys []WrappedDataKey `json:"data_keys,omitempty"`
+}
+
+// ArchivedBackup is a backup written to the blob store under Key
+type ArchivedBackup struct {
+	Key       string         `json:"key"`
+	CreatedAt time.Time      `json:"created_at"`
+	Rows      map[string]int `json:"rows"`
+	Omitted   []string       `json:"omitted,omitempty"`
+}
+
+// Conflict handling of a restore
+const (
+	// RestoreSkip keeps existing rows, restoring only the others
+	RestoreSkip = "skip"
+	// RestoreFail aborts the restore if any row conflicts
+	RestoreFail = "fail"
+)
+
+// RestoreTableResult reports what a restore did (or would do) for one
+// table. Skipped rows conflicted with existing ones or belong to a
+// deployment that did.
+type RestoreTableResult struct {
+	Table    string `json:"table"`
+	Rows     int    `json:"rows"`
+	Restored int    `json:"restored"`
+	Skipped  int    `json:"skipped"`
+}
+
+// RestoreResult represents the outcome of restoring a backup
+type RestoreResult struct {
+	DryRun    bool                 `json:"dry_run"`
+	Conflicts string               `json:"conflicts"`
+	CreatedAt time.Time            `json:"created_at"`
+	Tables    []RestoreTableResult `json:"tables"`
+}
+
+// TableSize is the on-disk size and row counts of a table
+type TableSize struct {
+	Table       string      `json:"table"`
+	LiveRows    int64       `json:"live_rows"`
+	DeadRows    int64       `json:"dead_rows"`
+	TableBytes  int64       `json:"table_bytes"`
+	IndexBytes  int64       `json:"index_bytes"`
+	TotalBytes  int64       `json:"total_bytes"`
+	LastVacuum  *time.Time  `json:"last_vacuum,omitempty"`
+	LastAnalyze *time.Time  `json:"last_analyze,omitempty"`
+	Indexes     []IndexSize `json:"indexes"`
+}
+
+// IndexSize is the on-disk size of an index and how often it was scanned
+type IndexSize struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Scans int64  `json:"scans"`
+}
+
+// HousekeepingStep is one step of a housekeeping run
+type HousekeepingStep struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HousekeepingReport represents a housekeeping run and the table sizes after
+// it
+type HousekeepingReport struct {
+	RanAt  time.Time          `json:"ran_at"`
+	Steps  []HousekeepingStep `json:"steps"`
+	Tables []TableSize        `json:"tables"`
+}
+
+// StuckDeployment is a deployment found stuck in a status by a requeue or
+// the watchdog
+type StuckDeployment struct {
+	ID          uuid.UUID `json:"id"`
+	Domain      string    `json:"domain"`
+	AppName     string    `json:"app_name"`
+	Version     int       `json:"version"`
+	Status      string    `json:"status"`
+	StatusSince time.Time `json:"status_since"`
+
+	// Skipped says why a requeue left the deployment alone
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// RequeueResult represents a requeue of stuck deployments
+type RequeueResult struct {
+	DryRun      bool              `json:"dry_run"`
+	Status      string            `json:"status"`
+	OlderThan   string            `json:"older_than"`
+	Requeued    int               `json:"requeued"`
+	Skipped     int               `json:"skipped"`
+	Deployments []StuckDeployment `json:"deployments"`
+}
+
+// StuckDeploymentNotification is posted to alerts.webhook_url when the
+// watchdog marks a stuck deployment stalled or failed
+type StuckDeploymentNotification struct {
+	Event        string    `json:"event"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Domain       string    `json:"domain"`
+	AppName      string    `json:"app_name"`
+	Version      int       `json:"version"`
+	Status       string    `json:"status"`
+	NewStatus    string    `json:"new_status"`
+	StatusSince  time.Time `json:"status_since"`
+	Threshold    string    `json:"threshold"`
+	At           time.Time `json:"at"`
+}
+
+// ImportItemResult describes what an import did (or would do) for one item
+type ImportItemResult struct {
+	Domain   string `json:"domain,omitempty"`
+	AppName  string `json:"app_name,omitempty"`
+	Registry string `json:"registry,omitempty"`
+	Action   string `json:"action"`
+	Version  int    `json:"version,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportResult represents the outcome of POST /api/v1/import
+type ImportResult struct {
+	DryRun      bool               `json:"dry_run"`
+	RequestID   string             `json:"request_id,omitempty"`
+	Deployments []ImportItemResult `json:"deployments"`
+	Registries  []ImportItemResult `json:"registries"`
+}
+
+// ProblemDetails represents an RFC 7807 problem+json error response
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Data is the outcome of a partly failed operation, if any
+	Data interface{} `json:"data,omitempty"`
 }
 
 // DeploymentStats represents deployment statistics
@@ -72,4 +1524,435 @@ type DeploymentStats struct {
 	PendingCount     int `json:"pending_count"`
 	DeployedCount    int `json:"deployed_count"`
 	FailedCount      int `json:"failed_count"`
+
+	// RefreshedAt is when the counters were last recomputed
+	RefreshedAt time.Time `json:"refreshed_at"`
+
+	// Breakdown splits the counters by app or domain
+	Breakdown []StatsGroup `json:"breakdown"`
+}
+
+// Stats breakdown groupings
+const (
+	StatsByApp    = "app_name"
+	StatsByDomain = "domain"
+)
+
+// StatsGroup holds the deployment counters of one app or domain. The
+// counters count apps by the status of their latest version, like the
+// global ones; CurrentVersion and CurrentStatus are only set per app.
+type StatsGroup struct {
+	Domain           string `json:"domain"`
+	AppName          string `json:"app_name,omitempty"`
+	TotalDeployments int    `json:"total_deployments"`
+	PendingCount     int    `json:"pending_count"`
+	DeployedCount    int    `json:"deployed_count"`
+	FailedCount      int    `json:"failed_count"`
+
+	// Versions counts every version pushed
+	Versions       int    `json:"versions"`
+	CurrentVersion int    `json:"current_version,omitempty"`
+	CurrentStatus  string `json:"current_status,omitempty"`
+
+	// LastDeployedAt is when a version was last marked deployed
+	LastDeployedAt *time.Time `json:"last_deployed_at,omitempty"`
+}
+
+// DeploymentOutcome is what happened to one deployment, read from its
+// status changes; the input of the DORA metrics
+type DeploymentOutcome struct {
+	DeploymentID uuid.UUID
+	Domain       string
+	AppName      string
+	CreatedAt    time.Time
+
+	// DeployedAt, FailedAt and RolledBackAt are when the deployment first
+	// reached each status
+	DeployedAt   *time.Time
+	FailedAt     *time.Time
+	RolledBackAt *time.Time
+
+	// RestoredAt is when another version of the app was first deployed
+	// after the rollback
+	RestoredAt *time.Time
+}
+
+// Finished reports whether the deployment was deployed, failed or rolled back
+func (o *DeploymentOutcome) Finished() bool {
+	return o.DeployedAt != nil || o.Failed()
+}
+
+// Failed reports whether the deployment failed or was rolled back
+func (o *DeploymentOutcome) Failed() bool {
+	return o.FailedAt != nil || o.RolledBackAt != nil
+}
+
+// DoraMetrics are the DORA delivery metrics of an app, a domain or, with
+// both empty, every app. Rates and durations are null without data.
+type DoraMetrics struct {
+	Domain  string `json:"domain,omitempty"`
+	AppName string `json:"app_name,omitempty"`
+
+	// Deployments counts the versions that reached deployed
+	Deployments       int     `json:"deployments"`
+	DeploymentsPerDay float64 `json:"deployments_per_day"`
+
+	// LeadTimeSeconds is the median time from push to deployed
+	LeadTimeSeconds *float64 `json:"lead_time_seconds"`
+
+	// Changes counts the versions that were deployed, failed or rolled
+	// back, and FailedChanges those that failed or were rolled back
+	Changes           int      `json:"changes"`
+	FailedChanges     int      `json:"failed_changes"`
+	ChangeFailureRate *float64 `json:"change_failure_rate"`
+
+	// TimeToRestoreSeconds is the mean time from deploying a version that
+	// was rolled back to deploying another one
+	Rollbacks            int      `json:"rollbacks"`
+	TimeToRestoreSeconds *float64 `json:"time_to_restore_seconds"`
+}
+
+// DoraReport holds the DORA metrics of the deployments pushed since Since
+type DoraReport struct {
+	Days   int           `json:"days"`
+	Since  time.Time     `json:"since"`
+	Total  DoraMetrics   `json:"total"`
+	Groups []DoraMetrics `json:"groups"`
+}
+
+// FailureRateAlert is a firing alert on an app whose deployments keep failing
+type FailureRateAlert struct {
+	Domain      string    `json:"domain" db:"domain"`
+	AppName     string    `json:"app_name" db:"app_name"`
+	FailureRate float64   `json:"failure_rate" db:"failure_rate"`
+	FiringSince time.Time `json:"firing_since" db:"firing_since"`
+}
+
+// FailureRate is an app's rolling deployment failure rate over the alert
+// window, next to its rate over the window before, so the trend shows
+type FailureRate struct {
+	Domain  string `json:"domain"`
+	AppName string `json:"app_name"`
+
+	// Changes counts the deployments that were deployed, failed or rolled
+	// back in the window, and Failures those that failed or were rolled
+	// back; FailureRate is null without changes
+	Changes     int      `json:"changes"`
+	Failures    int      `json:"failures"`
+	FailureRate *float64 `json:"failure_rate"`
+
+	PreviousChanges     int      `json:"previous_changes"`
+	PreviousFailureRate *float64 `json:"previous_failure_rate"`
+
+	// FiringSince is set while the app's failure rate alert fires
+	FiringSince *time.Time `json:"firing_since,omitempty"`
+}
+
+// FailureRateReport lists the failure rates of the apps with deployments in
+// the current or previous window
+type FailureRateReport struct {
+	Window         string        `json:"window"`
+	Threshold      float64       `json:"threshold"`
+	MinDeployments int           `json:"min_deployments"`
+	Apps           []FailureRate `json:"apps"`
+}
+
+// FailureRateNotification is posted to alerts.webhook_url when a failure
+// rate alert fires or resolves
+type FailureRateNotification struct {
+	Event       string    `json:"event"`
+	Status      string    `json:"status"`
+	Domain      string    `json:"domain"`
+	AppName     string    `json:"app_name"`
+	FailureRate float64   `json:"failure_rate"`
+	Changes     int       `json:"changes"`
+	Failures    int       `json:"failures"`
+	Threshold   float64   `json:"threshold"`
+	Window      string    `json:"window"`
+	At          time.Time `json:"at"`
+}
+
+// Failure rate alert statuses
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert rule kinds
+const (
+	// AlertRuleAppDown fires while an app has had an open incident for at
+	// least the rule's for_seconds
+	AlertRuleAppDown = "app_down"
+	// AlertRuleFailureRate fires while at least the rule's threshold of an
+	// app's deployments finished within window_seconds failed
+	AlertRuleFailureRate = "failure_rate"
+)
+
+// AlertRuleKinds lists the alert rule kinds
+var AlertRuleKinds = []string{AlertRuleAppDown, AlertRuleFailureRate}
+
+// AlertRule is an operator-defined condition on apps, evaluated
+// periodically; an empty Domain or AppName matches every app
+type AlertRule struct {
+	Name    string `json:"name" db:"name"`
+	Kind    string `json:"kind" db:"kind"`
+	Domain  string `json:"domain,omitempty" db:"domain"`
+	AppName string `json:"app_name,omitempty" db:"app_name"`
+
+	// ForSeconds is how long an app must be down before app_down fires
+	ForSeconds int `json:"for_seconds,omitempty" db:"for_seconds"`
+
+	// WindowSeconds, Threshold and MinDeployments configure failure_rate:
+	// the share of deployments, between 0 and 1, that may fail within the
+	// window, counted once at least MinDeployments finished in it
+	WindowSeconds  int     `json:"window_seconds,omitempty" db:"window_seconds"`
+	Threshold      float64 `json:"threshold,omitempty" db:"threshold"`
+	MinDeployments int     `json:"min_deployments,omitempty" db:"min_deployments"`
+
+	// SilencedUntil mutes the rule's notifications; its alerts still fire
+	// and resolve
+	SilencedUntil *time.Time `json:"silenced_until,omitempty" db:"silenced_until"`
+
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Silenced reports whether the rule's notifications are muted at now
+func (r AlertRule) Silenced(now time.Time) bool {
+	return r.SilencedUntil != nil && now.Before(*r.SilencedUntil)
+}
+
+// AlertRuleRequest creates or replaces an alert rule
+type AlertRuleRequest struct {
+	Kind           string  `json:"kind" binding:"required"`
+	Domain         string  `json:"domain"`
+	AppName        string  `json:"app_name"`
+	ForSeconds     int     `json:"for_seconds"`
+	WindowSeconds  int     `json:"window_seconds"`
+	Threshold      float64 `json:"threshold"`
+	MinDeployments int     `json:"min_deployments"`
+}
+
+// SilenceRequest mutes an alert rule for a duration such as 2h or 1d
+type SilenceRequest struct {
+	Duration string `json:"duration" binding:"required"`
+}
+
+// RuleAlert is an alert firing on an app that breaks an alert rule
+type RuleAlert struct {
+	Rule    string `json:"rule" db:"rule_name"`
+	Domain  string `json:"domain" db:"domain"`
+	AppName string `json:"app_name" db:"app_name"`
+
+	// Value is what broke the rule: seconds down or the failure rate
+	Value       float64   `json:"value" db:"value"`
+	FiringSince time.Time `json:"firing_since" db:"firing_since"`
+
+	// NotifiedAt is when the alert was last posted to alerts.webhook_url;
+	// unacknowledged alerts are posted again every alerts.repeat_interval
+	NotifiedAt     *time.Time `json:"notified_at,omitempty" db:"notified_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty" db:"acknowledged_by"`
+}
+
+// RuleAlertNotification is posted to alerts.webhook_url when an alert rule
+// fires on an app, is still firing unacknowledged, or resolves
+type RuleAlertNotification struct {
+	Event       string    `json:"event"`
+	Status      string    `json:"status"`
+	Rule        string    `json:"rule"`
+	Kind        string    `json:"kind"`
+	Domain      string    `json:"domain"`
+	AppName     string    `json:"app_name"`
+	Value       float64   `json:"value"`
+	Repeat      bool      `json:"repeat,omitempty"`
+	FiringSince time.Time `json:"firing_since"`
+	At          time.Time `json:"at"`
+}
+
+// AppSummary represents precomputed deployment analytics for one app
+type AppSummary struct {
+	Domain         string     `json:"domain" db:"domain"`
+	AppName        string     `json:"app_name" db:"app_name"`
+	TotalVersions  int        `json:"total_versions" db:"total_versions"`
+	DeployedCount  int        `json:"deployed_count" db:"deployed_count"`
+	FailedCount    int        `json:"failed_count" db:"failed_count"`
+	CurrentVersion int        `json:"current_version" db:"current_version"`
+	CurrentStatus  string     `json:"current_status" db:"current_status"`
+	LastCreatedAt  time.Time  `json:"last_created_at" db:"last_created_at"`
+	LastDeployedAt *time.Time `json:"last_deployed_at,omitempty" db:"last_deployed_at"`
+	RefreshedAt    time.Time  `json:"refreshed_at" db:"refreshed_at"`
+}
+
+// DailyDeploymentCount represents precomputed deployment counts for one app and day
+type DailyDeploymentCount struct {
+	Day           time.Time `json:"day" db:"day"`
+	Domain        string    `json:"domain" db:"domain"`
+	AppName       string    `json:"app_name" db:"app_name"`
+	CreatedCount  int       `json:"created_count" db:"created_count"`
+	DeployedCount int       `json:"deployed_count" db:"deployed_count"`
+	FailedCount   int       `json:"failed_count" db:"failed_count"`
+}
+
+// Top-N report orderings
+const (
+	TopByDeployCount = "deploy_count"
+	TopByFailures    = "failures"
+)
+
+// TopApp is one app of a top-N report with its counts over the report range
+type TopApp struct {
+	Domain        string `json:"domain" db:"domain"`
+	AppName       string `json:"app_name" db:"app_name"`
+	CreatedCount  int    `json:"created_count" db:"created_count"`
+	DeployedCount int    `json:"deployed_count" db:"deployed_count"`
+	FailedCount   int    `json:"failed_count" db:"failed_count"`
+}
+
+// TopAppsReport ranks the apps by their versions pushed since Since
+type TopAppsReport struct {
+	By    string    `json:"by"`
+	Days  int       `json:"days"`
+	Since time.Time `json:"since"`
+	Apps  []TopApp  `json:"apps"`
+}
+
+// SLACounts holds an app's health probes, deployments and incidents since
+// some time; Downtime is the part of that time its incidents were open
+type SLACounts struct {
+	Domain            string        `json:"domain" db:"domain"`
+	AppName           string        `json:"app_name" db:"app_name"`
+	Probes            int           `json:"probes" db:"probes"`
+	HealthyProbes     int           `json:"healthy_probes" db:"healthy_probes"`
+	Deployments       int           `json:"deployments" db:"deployments"`
+	FailedDeployments int           `json:"failed_deployments" db:"failed_deployments"`
+	Incidents         int           `json:"incidents" db:"incidents"`
+	Downtime          time.Duration `json:"-" db:"downtime"`
+}
+
+// SLAWindow is an app's availability over one report window: the share of
+// its health probes that were healthy, as a percentage
+type SLAWindow struct {
+	Window            string   `json:"window"`
+	Probes            int      `json:"probes"`
+	HealthyProbes     int      `json:"healthy_probes"`
+	Availability      *float64 `json:"availability"`
+	MeetsTarget       *bool    `json:"meets_target"`
+	Deployments       int      `json:"deployments"`
+	FailedDeployments int      `json:"failed_deployments"`
+	Incidents         int      `json:"incidents"`
+	DowntimeSeconds   float64  `json:"downtime_seconds"`
+}
+
+// LatencyPercentiles summarize the response times of an app's http health
+// probes, in milliseconds
+type LatencyPercentiles struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+}
+
+// LatencyPoint is the probe latency of an app over one step of a time series
+type LatencyPoint struct {
+	Time time.Time `json:"time"`
+	LatencyPercentiles
+}
+
+// DeploymentLatency is the probe latency of one deployment of an app, so a
+// version answering slower than the one before stands out
+type DeploymentLatency struct {
+	DeploymentID uuid.UUID  `json:"deployment_id"`
+	Version      int        `json:"version"`
+	DeployedAt   *time.Time `json:"deployed_at,omitempty"`
+	LatencyPercentiles
+}
+
+// LatencyReport is an app's probe latency over a window, as a time series
+// of steps and per deployment probed within it
+type LatencyReport struct {
+	Domain      string              `json:"domain"`
+	AppName     string              `json:"app_name"`
+	Window      string              `json:"window"`
+	Step        string              `json:"step"`
+	Since       time.Time           `json:"since"`
+	Points      []LatencyPoint      `json:"points"`
+	Deployments []DeploymentLatency `json:"deployments"`
+}
+
+// AppSLA holds an app's availability over each report window
+type AppSLA struct {
+	Domain  string      `json:"domain"`
+	AppName string      `json:"app_name"`
+	Windows []SLAWindow `json:"windows"`
+}
+
+// SLAReport holds the availability of every probed or deployed app over
+// each window, against the availability target
+type SLAReport struct {
+	Target  float64  `json:"target"`
+	Windows []string `json:"windows"`
+	Apps    []AppSLA `json:"apps"`
+}
+
+// Job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+
+	// JobStatusDead marks a job that failed on every attempt; it stays
+	// until an operator requeues it
+	JobStatusDead = "dead"
+)
+
+// Job types
+const (
+	JobTypePush = "push"
+
+	// JobTypeGitSync runs a git sync requested by a push webhook
+	JobTypeGitSync = "git_sync"
+
+	// JobTypeImageUpdate checks the image policies following images a
+	// registry webhook reported pushed
+	JobTypeImageUpdate = "image_update"
+
+	// JobTypeWebhook delivers a notification to alerts.webhook_url
+	JobTypeWebhook = "webhook"
+
+	// JobTypeRetention runs the retention sweep
+	JobTypeRetention = "retention"
+
+	// JobTypeOrphans runs the orphan check, and with orphans.cleanup its
+	// cleanup
+	JobTypeOrphans = "orphans"
+)
+
+// Job represents a unit of background work processed by the worker pool
+type Job struct {
+	ID         uuid.UUID       `json:"id" db:"id"`
+	Type       string          `json:"type" db:"type"`
+	Status     string          `json:"status" db:"status"`
+	Priority   string          `json:"priority" db:"priority"`
+	Payload    json.RawMessage `json:"-" db:"payload"`
+	Result     json.RawMessage `json:"result,omitempty" db:"result"`
+	Total      int             `json:"total" db:"total"`
+	Processed  int             `json:"processed" db:"processed"`
+	Error      string          `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+
+	// CancelRequested is set when a running job has been asked to stop
+	CancelRequested bool `json:"cancel_requested,omitempty" db:"cancel_requested"`
+
+	// Attempts counts how many times the job has been started; a failed
+	// job waits until RunAfter before its next attempt
+	Attempts int       `json:"attempts" db:"attempts"`
+	RunAfter time.Time `json:"run_after" db:"run_after"`
+
+	// LeaseExpiresAt is when a running job is given up on unless the
+	// replica running it renews its lease
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
 }
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoffSeconds: 10, MaxBackoffSeconds: 60}
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, 60 * time.Second},
+		{10, 60 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempts, 0.5); got != tt.expected {
+			t.Errorf("Backoff(%d) = %v, expected %v", tt.attempts, got, tt.expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	if got := policy.Backoff(1, 0); got != 5*time.Second {
+		t.Errorf("Expected the lowest jittered backoff to be 5s, got %v", got)
+	}
+	if got := policy.Backoff(1, 0.999); got < 14*time.Second || got > 15*time.Second {
+		t.Errorf("Expected the highest jittered backoff to approach 15s, got %v", got)
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	pull := &DeploymentFailure{Code: FailureImagePull}
+	port := &DeploymentFailure{Code: FailurePortInUse}
+
+	every := RetryPolicy{}
+	if !every.Retries(nil) || !every.Retries(pull) {
+		t.Error("Expected a policy without retry_on to retry every failure")
+	}
+
+	limited := RetryPolicy{RetryOn: []string{FailureImagePull, FailureHealthCheckTimeout}}
+	if !limited.Retries(pull) {
+		t.Error("Expected a listed error code to be retried")
+	}
+	if limited.Retries(port) || limited.Retries(nil) {
+		t.Error("Expected unlisted and missing error codes not to be retried")
+	}
+}
+
+func TestDeploymentMatchesMetadata(t *testing.T) {
+	d := &Deployment{DockerImage: "app:1", Port: 80, Metadata: map[string]any{"ticket": "OPS-42", "attempt": float64(2)}}
+
+	tests := []struct {
+		name     string
+		metadata map[string]any
+		expected bool
+	}{
+		{"Not given", nil, true},
+		{"Same", map[string]any{"attempt": 2, "ticket": "OPS-42"}, true},
+		{"Different value", map[string]any{"ticket": "OPS-43", "attempt": 2}, false},
+		{"Cleared", map[string]any{}, false},
+	}
+	for _, tt := range tests {
+		req := DeploymentRequest{DockerImage: "app:1", Port: 80, Metadata: tt.metadata}
+		if got := d.Matches(req); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestMetadataFilterMatches(t *testing.T) {
+	metadata := map[string]any{"ticket": "OPS-42", "attempt": float64(2), "hotfix": true, "owner": nil}
+
+	tests := []struct {
+		filter   MetadataFilter
+		expected bool
+	}{
+		{nil, true},
+		{MetadataFilter{"ticket": "OPS-42"}, true},
+		{MetadataFilter{"ticket": "OPS-42", "attempt": "2", "hotfix": "true"}, true},
+		{MetadataFilter{"ticket": "ops-42"}, false},
+		{MetadataFilter{"release": ""}, false},
+		{MetadataFilter{"owner": "null"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(metadata); got != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.filter, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package redact
+
+import (
+	"log/slog"
+	"strings"
+
+	"deployment-controller/internal/models"
+)
+
+// Mask replaces redacted values
+const Mask = "********"
+
+// DefaultPatterns are the env key fragments treated as sensitive when none
+// are configured
+var DefaultPatterns = []string{"PASSWORD", "TOKEN", "KEY"}
+
+// Redactor masks the values of env entries whose keys look sensitive
+type Redactor struct {
+	patterns []string
+}
+
+// New creates a redactor matching keys that contain any of patterns,
+// case-insensitively
+func New(patterns []string) *Redactor {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		if pattern != "" {
+			r.patterns = append(r.patterns, strings.ToUpper(pattern))
+		}
+	}
+	return r
+}
+
+// Sensitive reports whether an env key matches a redaction pattern
+func (r *Redactor) Sensitive(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range r.patterns {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Env returns a copy of env with sensitive values masked. Secret references
+// and sealed values are kept since they hold no plaintext.
+func (r *Redactor) Env(env []string) []string {
+	if env == nil {
+		return nil
+	}
+
+	redacted := make([]string, len(env))
+	for i, entry := range env {
+		redacted[i] = r.entry(entry)
+	}
+	return redacted
+}
+
+func (r *Redactor) entry(entry string) string {
+	key, value, found := strings.Cut(entry, "=")
+	if !found || value == "" || !r.Sensitive(key) {
+		return entry
+	}
+	if _, _, ok := models.ParseSecretRef(entry); ok {
+		return entry
+	}
+	if _, _, ok := models.ParseSealedValue(entry); ok {
+		return entry
+	}
+	return key + "=" + Mask
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that masks sensitive
+// values in env arrays before they are logged
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+
+	switch v := a.Value.Any().(type) {
+	case []string:
+		return slog.Any(a.Key, r.Env(v))
+	case models.EnvList:
+		return slog.Any(a.Key, r.Env(v))
+	}
+	return a
+}
@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactorEnv(t *testing.T) {
+	r := New(DefaultPatterns)
+
+	env := []string{
+		"NODE_ENV=production",
+		"DB_PASSWORD=hunter2",
+		"github_token=ghp_abc",
+		"API_KEY=",
+		"STRIPE_KEY=${secret:payments/stripe}",
+		"SIGNING_KEY=${sealed:c2VhbGVk}",
+		"NOEQUALS",
+	}
+	want := []string{
+		"NODE_ENV=production",
+		"DB_PASSWORD=" + Mask,
+		"github_token=" + Mask,
+		"API_KEY=",
+		"STRIPE_KEY=${secret:payments/stripe}",
+		"SIGNING_KEY=${sealed:c2VhbGVk}",
+		"NOEQUALS",
+	}
+
+	got := r.Env(env)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Env()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if env[1] != "DB_PASSWORD=hunter2" {
+		t.Errorf("Env must not modify its input")
+	}
+}
+
+func TestRedactorReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(DefaultPatterns)
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: r.ReplaceAttr}))
+
+	logger.Info("Created deployment", "env", []string{"DB_PASSWORD=hunter2", "MODE=prod"})
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("Log output leaked a secret: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "MODE=prod") {
+		t.Errorf("Log output lost a plain value: %s", buf.String())
+	}
+}
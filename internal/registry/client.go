@@ -0,0 +1,379 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"deployment-controller/internal/config"
+
+	"github.com/distribution/reference"
+)
+
+// manifestTypes are the manifest media types accepted when resolving a
+// digest, multi-platform indexes first so the digest covers every platform
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// maxTagPages bounds how many pages of a tag list are fetched
+const maxTagPages = 50
+
+// Credentials authenticate to a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Image is a parsed image reference
+type Image struct {
+	named reference.Named
+
+	// Registry is the registry host, e.g. docker.io or ghcr.io
+	Registry string
+	// Repository is the path within the registry, e.g. library/nginx
+	Repository string
+	// Tag defaults to latest when the reference has neither tag nor digest
+	Tag    string
+	Digest string
+}
+
+// ParseImage parses an image reference such as nginx:1.25 or
+// ghcr.io/org/app:v2@sha256:...
+func ParseImage(image string) (Image, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return Image{}, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	img := Image{
+		named:      reference.TrimNamed(named),
+		Registry:   reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		img.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		img.Digest = digested.Digest().String()
+	}
+	if img.Tag == "" && img.Digest == "" {
+		img.Tag = "latest"
+	}
+	return img, nil
+}
+
+// dockerHubAliases are the other names Docker Hub goes by
+var dockerHubAliases = map[string]bool{
+	"index.docker.io":         true,
+	"registry-1.docker.io":    true,
+	"registry.hub.docker.com": true,
+}
+
+// NormalizeHost returns the canonical form of a registry host as stored
+// with credentials or parsed from an image: lowercased, without a scheme or
+// path (docker's config.json keys Docker Hub as https://index.docker.io/v1/),
+// and with Docker Hub's aliases folded into docker.io
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if dockerHubAliases[host] {
+		return "docker.io"
+	}
+	return host
+}
+
+// WithTag returns the image reference for another tag of the repository,
+// in the familiar form (nginx rather than docker.io/library/nginx)
+func (i Image) WithTag(tag string) (string, error) {
+	tagged, err := reference.WithTag(i.named, tag)
+	if err != nil {
+		return "", fmt.Errorf("invalid tag %q: %w", tag, err)
+	}
+	return reference.FamiliarString(tagged), nil
+}
+
+// WithDigest returns the image reference pinned to digest, keeping the tag
+// for readability
+func (i Image) WithDigest(digest string) (string, error) {
+	tag := i.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	ref := reference.FamiliarString(i.named) + ":" + tag + "@" + digest
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return "", fmt.Errorf("invalid digest %q: %w", digest, err)
+	}
+	return ref, nil
+}
+
+// Client talks to registries over the OCI distribution API
+type Client struct {
+	http     *http.Client
+	insecure []string
+}
+
+// New creates a registry client
+func New(cfg config.RegistryConfig) *Client {
+	return &Client{
+		http:     &http.Client{Timeout: cfg.Timeout},
+		insecure: cfg.Insecure,
+	}
+}
+
+// baseURL returns the API root of a registry
+func (c *Client) baseURL(registry string) string {
+	scheme := "https"
+	if slices.Contains(c.insecure, registry) {
+		scheme = "http"
+	}
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+	return scheme + "://" + registry + "/v2/"
+}
+
+// Tags lists the tags of the image's repository
+func (c *Client) Tags(ctx context.Context, img Image, creds *Credentials) ([]string, error) {
+	next := c.baseURL(img.Registry) + img.Repository + "/tags/list?n=1000"
+
+	var tags []string
+	for page := 0; next != "" && page < maxTagPages; page++ {
+		resp, err := c.do(ctx, http.MethodGet, next, nil, creds)
+		if err != nil {
+			return nil, err
+		}
+
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tag list: %w", err)
+		}
+		tags = append(tags, body.Tags...)
+
+		next, err = nextPage(next, resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// nextPage resolves the rel="next" URL of a Link header against the
+// current page; it returns "" on the last page
+func nextPage(current, link string) (string, error) {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return "", nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid Link header %q", link)
+	}
+
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return "", fmt.Errorf("invalid Link header %q: %w", link, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Digest resolves the manifest digest a tag currently points to
+func (c *Client) Digest(ctx context.Context, img Image, tag string, creds *Credentials) (string, error) {
+	manifestURL := c.baseURL(img.Registry) + img.Repository + "/manifests/" + tag
+
+	resp, err := c.do(ctx, http.MethodHead, manifestURL, manifestTypes, creds)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Not every registry sends the digest on HEAD; hash the manifest instead
+	resp, err = c.do(ctx, http.MethodGet, manifestURL, manifestTypes, creds)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// do sends a request, answering an authentication challenge once, and
+// returns the response when it succeeded
+func (c *Client) do(ctx context.Context, method, target string, accept []string, creds *Credentials) (*http.Response, error) {
+	resp, err := c.send(ctx, method, target, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge, creds)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(ctx, method, target, accept, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("registry returned not found for %s", redactQuery(target))
+		}
+		return nil, fmt.Errorf("registry returned %d for %s", resp.StatusCode, redactQuery(target))
+	}
+	return resp, nil
+}
+
+// send sends one request with an optional Authorization header
+func (c *Client) send(ctx context.Context, method, target string, accept []string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build registry request: %w", err)
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge, fetching a bearer token
+// from the registry's token service when asked to
+func (c *Client) authorize(ctx context.Context, challenge string, creds *Credentials) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if creds == nil {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Scheme == "" {
+			return "", fmt.Errorf("invalid token realm %q", params["realm"])
+		}
+		query := realm.Query()
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				query.Set(key, params[key])
+			}
+		}
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to build token request: %w", err)
+		}
+		if creds != nil {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("token request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token service returned %d", resp.StatusCode)
+		}
+
+		var body struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return "", fmt.Errorf("failed to decode token response: %w", err)
+		}
+		token := body.Token
+		if token == "" {
+			token = body.AccessToken
+		}
+		if token == "" {
+			return "", fmt.Errorf("token service returned no token")
+		}
+		return "Bearer " + token, nil
+
+	default:
+		return "", fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+}
+
+// parseChallenge splits a WWW-Authenticate header into its lowercased
+// scheme and parameters; quoted values may contain commas
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[key] = strings.TrimSpace(value)
+		}
+		rest = strings.TrimLeft(rest, ", ")
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+// redactQuery drops the query string from a URL for error messages
+func redactQuery(target string) string {
+	path, _, _ := strings.Cut(target, "?")
+	return path
+}
@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+)
+
+func TestParseImage(t *testing.T) {
+	img, err := ParseImage("nginx")
+	if err != nil {
+		t.Fatalf("ParseImage failed: %v", err)
+	}
+	if img.Registry != "docker.io" || img.Repository != "library/nginx" || img.Tag != "latest" {
+		t.Errorf("Unexpected image %+v", img)
+	}
+
+	next, err := img.WithTag("1.27")
+	if err != nil || next != "nginx:1.27" {
+		t.Errorf("Expected nginx:1.27, got %q (%v)", next, err)
+	}
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	img, err = ParseImage("ghcr.io/org/app:v2@" + digest)
+	if err != nil {
+		t.Fatalf("ParseImage failed: %v", err)
+	}
+	if img.Registry != "ghcr.io" || img.Repository != "org/app" || img.Tag != "v2" || img.Digest != digest {
+		t.Errorf("Unexpected image %+v", img)
+	}
+
+	pinned, err := img.WithDigest("sha256:" + strings.Repeat("b", 64))
+	if err != nil || pinned != "ghcr.io/org/app:v2@sha256:"+strings.Repeat("b", 64) {
+		t.Errorf("Unexpected pinned image %q (%v)", pinned, err)
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	for host, expected := range map[string]string{
+		"docker.io":                   "docker.io",
+		"index.docker.io":             "docker.io",
+		"Registry-1.Docker.io":        "docker.io",
+		"https://index.docker.io/v1/": "docker.io",
+		"GHCR.io":                     "ghcr.io",
+		"registry.example.com:5000":   "registry.example.com:5000",
+		" registry.example.com:5000 ": "registry.example.com:5000",
+		"http://localhost:5000/v2/":   "localhost:5000",
+	} {
+		if got := NormalizeHost(host); got != expected {
+			t.Errorf("NormalizeHost(%q) = %q, expected %q", host, got, expected)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("c", 64)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "ci" || pass != "secret" || r.URL.Query().Get("scope") != "repository:org/app:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"abc"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test",scope="repository:org/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/org/app/tags/list":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/org/app/tags/list?n=2&last=v1.1.0>; rel="next"`)
+				w.Write([]byte(`{"tags":["v1.0.0","v1.1.0"]}`))
+				return
+			}
+			w.Write([]byte(`{"tags":["v1.2.0"]}`))
+		case "/v2/org/app/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := New(config.RegistryConfig{Timeout: 5 * time.Second, Insecure: []string{host}})
+	creds := &Credentials{Username: "ci", Password: "secret"}
+
+	img, err := ParseImage(host + "/org/app")
+	if err != nil {
+		t.Fatalf("ParseImage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	tags, err := client.Tags(ctx, img, creds)
+	if err != nil {
+		t.Fatalf("Tags failed: %v", err)
+	}
+	if !slices.Equal(tags, []string{"v1.0.0", "v1.1.0", "v1.2.0"}) {
+		t.Errorf("Expected all pages of tags, got %v", tags)
+	}
+
+	got, err := client.Digest(ctx, img, "latest", creds)
+	if err != nil {
+		t.Fatalf("Digest failed: %v", err)
+	}
+	if got != digest {
+		t.Errorf("Expected digest %s, got %s", digest, got)
+	}
+
+	if _, err := client.Tags(ctx, img, nil); err == nil {
+		t.Error("Expected anonymous access to be refused")
+	}
+}
@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// DataKeySize is the size of AES-256 data keys
+const DataKeySize = 32
+
+// keyedPrefix marks ciphertexts sealed with a data key; the key ID follows
+// up to the next colon. Ciphertexts without it use the legacy static key.
+const keyedPrefix = "dk:"
+
+// DataKey is an unwrapped data key and the ID ciphertexts refer to it by
+type DataKey struct {
+	ID  string
+	Key []byte
+}
+
+// Cipher encrypts secret values at rest with AES-256-GCM
+type Cipher struct {
+	// primary is the ID of the data key new values are encrypted with;
+	// empty means the legacy key
+	primary string
+	keys    map[string]cipher.AEAD
+
+	// legacy is derived from the static encryption key; nil when only
+	// data keys are configured
+	legacy cipher.AEAD
+}
+
+// NewCipher derives an AES-256 key from the configured encryption key
+func NewCipher(key string) (*Cipher, error) {
+	if key == "" {
+		return nil, fmt.Errorf("encryption key is not configured")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	aead, err := newAEAD(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{keys: map[string]cipher.AEAD{}, legacy: aead}, nil
+}
+
+// NewKeyring creates a cipher over data keys, newest first; the first one
+// encrypts new values and the rest only decrypt. A non-empty legacyKey keeps
+// values encrypted with the static encryption key readable until they are
+// re-encrypted.
+func NewKeyring(dataKeys []DataKey, legacyKey string) (*Cipher, error) {
+	if len(dataKeys) == 0 {
+		return nil, fmt.Errorf("at least one data key is required")
+	}
+
+	c := &Cipher{primary: dataKeys[0].ID, keys: map[string]cipher.AEAD{}}
+	for _, dataKey := range dataKeys {
+		if dataKey.ID == "" || strings.Contains(dataKey.ID, ":") {
+			return nil, fmt.Errorf("invalid data key ID %q", dataKey.ID)
+		}
+		if _, ok := c.keys[dataKey.ID]; ok {
+			return nil, fmt.Errorf("duplicate data key ID %q", dataKey.ID)
+		}
+		if len(dataKey.Key) != DataKeySize {
+			return nil, fmt.Errorf("data key %q must be %d bytes", dataKey.ID, DataKeySize)
+		}
+
+		aead, err := newAEAD(dataKey.Key)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[dataKey.ID] = aead
+	}
+
+	if legacyKey != "" {
+		legacy, err := NewCipher(legacyKey)
+		if err != nil {
+			return nil, err
+		}
+		c.legacy = legacy.legacy
+	}
+
+	return c, nil
+}
+
+// GenerateDataKey returns a new random data key
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return aead, nil
+}
+
+// PrimaryKeyID returns the ID of the data key new values are encrypted
+// with, or "" for the legacy key
+func (c *Cipher) PrimaryKeyID() string {
+	return c.primary
+}
+
+// Encrypt seals plaintext, binding it to context (e.g. the secret's
+// project/name) so a ciphertext cannot be moved to another row. The random
+// nonce is prepended to the result.
+func (c *Cipher) Encrypt(plaintext []byte, context string) ([]byte, error) {
+	aead, prefix := c.legacy, ""
+	if c.primary != "" {
+		aead, prefix = c.keys[c.primary], keyedPrefix+c.primary+":"
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte(prefix), nonce...)
+	return aead.Seal(out, nonce, plaintext, []byte(context)), nil
+}
+
+// Decrypt opens a value produced by Encrypt with the same context
+func (c *Cipher) Decrypt(ciphertext []byte, context string) ([]byte, error) {
+	if aead, sealed, ok := c.keyed(ciphertext); ok {
+		if plaintext, err := open(aead, sealed, context); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	// Legacy ciphertexts have no key ID; one that happens to start with the
+	// prefix fails authentication above and is retried here
+	if c.legacy == nil {
+		return nil, fmt.Errorf("failed to decrypt secret: no key for ciphertext")
+	}
+	return open(c.legacy, ciphertext, context)
+}
+
+// Current reports whether ciphertext is encrypted with the primary key, i.e.
+// whether re-encryption would leave it unchanged
+func (c *Cipher) Current(ciphertext []byte) bool {
+	if c.primary == "" {
+		return !strings.HasPrefix(string(ciphertext), keyedPrefix)
+	}
+	return strings.HasPrefix(string(ciphertext), keyedPrefix+c.primary+":")
+}
+
+// keyed returns the data key and sealed bytes of a keyed ciphertext
+func (c *Cipher) keyed(ciphertext []byte) (cipher.AEAD, []byte, bool) {
+	rest, ok := strings.CutPrefix(string(ciphertext), keyedPrefix)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, _, found := strings.Cut(rest, ":")
+	aead, known := c.keys[id]
+	if !found || !known {
+		return nil, nil, false
+	}
+
+	return aead, ciphertext[len(keyedPrefix)+len(id)+1:], true
+}
+
+func open(aead cipher.AEAD, ciphertext []byte, context string) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import "testing"
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher("test-encryption-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sealed, err := c.Encrypt([]byte("s3cret"), "payments/db-pass")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plaintext, err := c.Decrypt(sealed, "payments/db-pass")
+	if err != nil || string(plaintext) != "s3cret" {
+		t.Fatalf("Round trip failed: %q, %v", plaintext, err)
+	}
+
+	if _, err := c.Decrypt(sealed, "payments/other"); err == nil {
+		t.Errorf("Expected decryption with a different context to fail")
+	}
+
+	other, _ := NewCipher("another-key")
+	if _, err := other.Decrypt(sealed, "payments/db-pass"); err == nil {
+		t.Errorf("Expected decryption with a different key to fail")
+	}
+}
+
+func TestNewCipherRequiresKey(t *testing.T) {
+	if _, err := NewCipher(""); err == nil {
+		t.Errorf("Expected error for empty key")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	legacy, _ := NewCipher("test-encryption-key")
+	legacyValue, _ := legacy.Encrypt([]byte("old"), "payments/db-pass")
+
+	key1, _ := GenerateDataKey()
+	key2, _ := GenerateDataKey()
+
+	ring1, err := NewKeyring([]DataKey{{ID: "k1", Key: key1}}, "test-encryption-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	k1Value, _ := ring1.Encrypt([]byte("s3cret"), "payments/db-pass")
+
+	// Rotate: k2 is now primary, k1 and the legacy key still decrypt
+	ring2, err := NewKeyring([]DataKey{{ID: "k2", Key: key2}, {ID: "k1", Key: key1}}, "test-encryption-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for value, want := range map[string]string{string(legacyValue): "old", string(k1Value): "s3cret"} {
+		plaintext, err := ring2.Decrypt([]byte(value), "payments/db-pass")
+		if err != nil || string(plaintext) != want {
+			t.Errorf("Decrypt = %q, %v; want %q", plaintext, err, want)
+		}
+		if ring2.Current([]byte(value)) {
+			t.Errorf("Expected %q not to be current after rotation", want)
+		}
+	}
+
+	k2Value, _ := ring2.Encrypt([]byte("s3cret"), "payments/db-pass")
+	if !ring2.Current(k2Value) || ring1.Current(k2Value) {
+		t.Errorf("Expected only ring2 to consider its own ciphertext current")
+	}
+	if _, err := ring1.Decrypt(k2Value, "payments/db-pass"); err == nil {
+		t.Errorf("Expected decryption with an unknown data key to fail")
+	}
+
+	for _, keys := range [][]DataKey{nil, {{ID: "", Key: key1}}, {{ID: "a:b", Key: key1}}, {{ID: "k1", Key: []byte("short")}}, {{ID: "k1", Key: key1}, {ID: "k1", Key: key2}}} {
+		if _, err := NewKeyring(keys, ""); err == nil {
+			t.Errorf("Expected error for data keys %v", keys)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"deployment-controller/internal/clock"
+)
+
+// Resolver fetches the value of an external secret reference such as
+// "vault://secret/data/payments#db_pass". Resolvers report a missing secret
+// with the error message "secret not found".
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// Resolvers routes secret references to resolvers by scheme ("vault",
+// "aws-sm", ...). References without a scheme name stored secrets.
+type Resolvers map[string]Resolver
+
+// Lookup returns the resolver for ref's scheme, or ok=false if ref has no
+// scheme or no resolver is registered for it
+func (r Resolvers) Lookup(ref string) (resolver Resolver, scheme string, ok bool) {
+	scheme, _, found := strings.Cut(ref, "://")
+	if !found {
+		return nil, "", false
+	}
+
+	resolver, ok = r[scheme]
+	return resolver, scheme, ok
+}
+
+// HasScheme reports whether ref points at an external secret store
+func HasScheme(ref string) bool {
+	return strings.Contains(ref, "://")
+}
+
+// cachedValue is a resolved secret value and when it stops being served
+type cachedValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+// cachingResolver serves resolved values from memory for a TTL so agent
+// fetches don't hit the backing store (and its rate limits) every time.
+// Errors are never cached.
+type cachingResolver struct {
+	resolver Resolver
+	ttl      time.Duration
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	values map[string]cachedValue
+}
+
+// NewCachingResolver wraps a resolver with a TTL cache measured with clk; a
+// zero TTL disables caching
+func NewCachingResolver(resolver Resolver, ttl time.Duration, clk clock.Clock) Resolver {
+	if ttl <= 0 {
+		return resolver
+	}
+
+	return &cachingResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		clock:    clk,
+		values:   map[string]cachedValue{},
+	}
+}
+
+func (c *cachingResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.values[ref]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	value, err := c.resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.values[ref] = cachedValue{value: value, expiresAt: c.clock.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/clock"
+)
+
+// countingResolver returns the reference itself as the value
+type countingResolver struct {
+	calls int
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	r.calls++
+	if ref == "test://missing" {
+		return "", fmt.Errorf("secret not found")
+	}
+	return ref, nil
+}
+
+func TestResolversLookup(t *testing.T) {
+	backend := &countingResolver{}
+	resolvers := Resolvers{"test": backend}
+
+	if _, scheme, ok := resolvers.Lookup("test://a/b"); !ok || scheme != "test" {
+		t.Errorf("Expected test:// reference to resolve, got %q, %v", scheme, ok)
+	}
+	if _, scheme, ok := resolvers.Lookup("other://a/b"); ok || scheme != "other" {
+		t.Errorf("Expected no resolver for other://, got %q, %v", scheme, ok)
+	}
+	if _, _, ok := resolvers.Lookup("payments/db-pass"); ok || HasScheme("payments/db-pass") {
+		t.Errorf("Expected stored secret reference to have no scheme")
+	}
+}
+
+func TestCachingResolver(t *testing.T) {
+	backend := &countingResolver{}
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cached := NewCachingResolver(backend, time.Minute, clk)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if value, err := cached.Resolve(ctx, "test://a"); err != nil || value != "test://a" {
+			t.Fatalf("Resolve = %q, %v", value, err)
+		}
+	}
+	if backend.calls != 1 {
+		t.Errorf("Expected 1 backend call, got %d", backend.calls)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := cached.Resolve(ctx, "test://a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backend.calls != 2 {
+		t.Errorf("Expected the value to be refetched once the TTL passed, got %d backend calls", backend.calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Resolve(ctx, "test://missing"); err == nil {
+			t.Fatalf("Expected error for missing secret")
+		}
+	}
+	if backend.calls != 4 {
+		t.Errorf("Expected errors not to be cached, got %d backend calls", backend.calls)
+	}
+}
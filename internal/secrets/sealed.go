@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// SealingAlgorithm names the sealed value format: an ephemeral X25519 key
+// agreement, SHA-256 key derivation and AES-256-GCM
+const SealingAlgorithm = "X25519-SHA256-AES256GCM"
+
+// sealingKDFLabel domain-separates the derived AES key
+const sealingKDFLabel = "deployment-controller sealed v1"
+
+// Sealer opens values that clients encrypted to the controller's public key,
+// so plaintext never appears in CI logs or request bodies
+type Sealer struct {
+	key *ecdh.PrivateKey
+}
+
+// NewSealer loads a base64-encoded 32-byte X25519 private key
+func NewSealer(key string) (*Sealer, error) {
+	if key == "" {
+		return nil, fmt.Errorf("sealing key is not configured")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("sealing key must be base64: %w", err)
+	}
+
+	private, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealing key: %w", err)
+	}
+
+	return &Sealer{key: private}, nil
+}
+
+// PublicKey returns the raw X25519 public key clients seal values to
+func (s *Sealer) PublicKey() []byte {
+	return s.key.PublicKey().Bytes()
+}
+
+// KeyID is a short fingerprint of the public key so clients can tell when
+// the controller's key has been rotated
+func (s *Sealer) KeyID() string {
+	sum := sha256.Sum256(s.PublicKey())
+	return hex.EncodeToString(sum[:8])
+}
+
+// Seal encrypts plaintext to publicKey, binding it to context (the env
+// variable name or the secret's project/name). The result is the base64 of
+// ephemeral public key || nonce || ciphertext.
+func Seal(publicKey, plaintext []byte, context string) (string, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	aead, err := sealingAEAD(ephemeral, recipient, ephemeral.PublicKey().Bytes(), publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(ephemeral.PublicKey().Bytes(), nonce...)
+	out = aead.Seal(out, nonce, plaintext, []byte(context))
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts a value produced by Seal for this controller's key
+func (s *Sealer) Open(sealed, context string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("sealed value must be base64")
+	}
+
+	const keySize = 32
+	if len(raw) < keySize {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(raw[:keySize])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+
+	aead, err := sealingAEAD(s.key, ephemeral, raw[:keySize], s.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	rest := raw[keySize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sealed value")
+	}
+
+	return plaintext, nil
+}
+
+// sealingAEAD derives the AES-256-GCM key shared by the ephemeral and
+// recipient keys: SHA-256(label || shared secret || ephemeral || recipient)
+func sealingAEAD(private *ecdh.PrivateKey, public *ecdh.PublicKey, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement failed: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(sealingKDFLabel))
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
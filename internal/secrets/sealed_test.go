@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// testSealingKey is a fixed X25519 private key for tests
+var testSealingKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+func TestSealerRoundTrip(t *testing.T) {
+	s, err := NewSealer(testSealingKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sealed, err := Seal(s.PublicKey(), []byte("s3cret"), "DB_PASS")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plaintext, err := s.Open(sealed, "DB_PASS")
+	if err != nil || string(plaintext) != "s3cret" {
+		t.Fatalf("Round trip failed: %q, %v", plaintext, err)
+	}
+
+	if _, err := s.Open(sealed, "API_KEY"); err == nil {
+		t.Errorf("Expected opening with a different context to fail")
+	}
+
+	other, _ := NewSealer(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 32))))
+	if _, err := other.Open(sealed, "DB_PASS"); err == nil {
+		t.Errorf("Expected opening with a different key to fail")
+	}
+	if other.KeyID() == s.KeyID() {
+		t.Errorf("Expected different keys to have different key IDs")
+	}
+
+	for _, bad := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := s.Open(bad, "DB_PASS"); err == nil {
+			t.Errorf("Expected %q to fail to open", bad)
+		}
+	}
+}
+
+func TestNewSealerValidatesKey(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		if _, err := NewSealer(key); err == nil {
+			t.Errorf("Expected error for key %q", key)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deployment-controller/internal/cache"
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/database"
+	"deployment-controller/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Env is a handler backed by a fresh database with the schema applied
+type Env struct {
+	Config *config.Config
+
+	// DB is the database under the handler's cache, for setting up and
+	// checking rows directly
+	DB      *database.DB
+	Handler *handlers.Handler
+
+	// Router has no routes; tests register the handlers they exercise
+	Router *gin.Engine
+}
+
+// New creates a database for the test, applies the schema and returns a
+// handler using it through the same cache as the server. The config is
+// loaded like the server's, with its defaults; configure, when non-nil,
+// adjusts it before the handler is created.
+func New(t testing.TB, configure func(cfg *config.Config)) *Env {
+	t.Helper()
+
+	url := Postgres(t)
+	ApplySchema(t, url)
+
+	cfg := loadConfig(t, url)
+	if configure != nil {
+		configure(cfg)
+	}
+
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if testing.Verbose() {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+
+	return &Env{
+		Config:  cfg,
+		DB:      db,
+		Handler: handlers.New(cache.New(db, cfg.Cache.LatestDeploymentsTTL), logger, cfg),
+		Router:  gin.New(),
+	}
+}
+
+// loadConfig loads a config connecting to the database at url through
+// config.Load, so every other setting takes its default
+func loadConfig(t testing.TB, url string) *config.Config {
+	t.Helper()
+
+	conn, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("failed to parse test database URL: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	body := fmt.Sprintf(`database:
+  host: %q
+  port: %d
+  user: %q
+  password: %q
+  name: %q
+  max_conns: 10
+security:
+  encryption_key: integration-test-key
+`, conn.Host, conn.Port, conn.User, conn.Password, conn.Database)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load test config: %v", err)
+	}
+	return cfg
+}
+
+// Do serves a request on the router. A non-nil body is sent as JSON.
+func (e *Env) Do(t testing.TB, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return e.DoWithHeader(t, method, path, body, nil)
+}
+
+// DoWithHeader serves a request with the given headers on the router, such
+// as an If-Match precondition. A non-nil body is sent as JSON.
+func (e *Env) DoWithHeader(t testing.TB, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	e.Router.ServeHTTP(w, req)
+	return w
+}
+
+// Decode decodes the data of an API response into v, failing the test
+// unless the response has the wanted status code
+func Decode(t testing.TB, w *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if v == nil {
+		return
+	}
+
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if err := json.Unmarshal(response.Data, v); err != nil {
+		t.Fatalf("failed to decode response data: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Package testutil runs handlers against a real PostgreSQL for integration
+// tests. The database server is TEST_DATABASE_URL when set, or a throwaway
+// postgres container started with testcontainers; tests are skipped when
+// neither is available.
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// postgresImage is the image containers are started from, the same as in
+// docker-compose.yml
+const postgresImage = "postgres:15-alpine"
+
+// startupTimeout bounds how long a container may take to accept connections
+const startupTimeout = time.Minute
+
+// Postgres creates an empty database for the test on TEST_DATABASE_URL's
+// server, or on a postgres container started for it, and returns its URL.
+// The database or container is removed when the test ends.
+func Postgres(t testing.TB) string {
+	t.Helper()
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		return createDatabase(t, url)
+	}
+	return startContainer(t)
+}
+
+// createDatabase creates a uniquely named database on the server of url and
+// drops it when the test ends
+func createDatabase(t testing.TB, url string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("failed to parse TEST_DATABASE_URL: %v", err)
+	}
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to TEST_DATABASE_URL: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("failed to name test database: %v", err)
+	}
+	name := "deployment_controller_test_" + hex.EncodeToString(suffix)
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn, err := pgx.ConnectConfig(context.Background(), cfg)
+		if err != nil {
+			t.Logf("failed to drop test database %s: %v", name, err)
+			return
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(context.Background(), "DROP DATABASE "+name+" WITH (FORCE)"); err != nil {
+			t.Logf("failed to drop test database %s: %v", name, err)
+		}
+	})
+
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.User, cfg.Password, cfg.Host, cfg.Port, name)
+}
+
+// startContainer starts a postgres container with testcontainers, waits
+// until it accepts connections and removes it when the test ends
+func startContainer(t testing.TB) string {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := dockerHealthy(ctx); err != nil {
+		t.Skipf("TEST_DATABASE_URL not set and docker not available: %v", err)
+	}
+
+	// The image initializes the database on a socket-only server first and
+	// restarts, so it is ready on the second readiness line
+	container, err := postgres.Run(ctx, postgresImage,
+		postgres.WithDatabase("deployment_controller"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("password"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(startupTimeout),
+			wait.ForListeningPort("5432/tcp").WithStartupTimeout(startupTimeout),
+		),
+	)
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			t.Logf("failed to remove postgres container: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to start postgres container: %v", err)
+	}
+
+	url, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to get postgres container address: %v", err)
+	}
+	return url
+}
+
+// dockerHealthy reports why testcontainers can't reach a docker daemon, if
+// it can't. Looking the daemon up panics when none is configured, which is
+// reported as an error too.
+func dockerHealthy(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+	return provider.Health(ctx)
+}
+
+// ApplySchema applies db/schema.sql to the database at url
+func ApplySchema(t testing.TB, url string) {
+	t.Helper()
+
+	schema, err := os.ReadFile(filepath.Join(repoRoot(t), "db", "schema.sql"))
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	// Without arguments the schema is sent over the simple protocol, which
+	// runs every statement in it
+	if _, err := conn.Exec(ctx, string(schema)); err != nil {
+		t.Fatalf("failed to apply schema: %v", err)
+	}
+}
+
+// repoRoot finds the module root above the working directory, which go
+// test sets to the package being tested
+func repoRoot(t testing.TB) string {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatal("go.mod not found above the working directory")
+		}
+		dir = parent
+	}
+}
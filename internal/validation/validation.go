@@ -0,0 +1,248 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"deployment-controller/internal/awssecrets"
+	"deployment-controller/internal/models"
+	"deployment-controller/internal/vault"
+
+	"github.com/distribution/reference"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/idna"
+)
+
+// dnsLabel matches a lowercase RFC 1123 DNS label
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// hostnameProfile converts internationalized names to their punycode form
+// while enforcing hostname rules on every label
+var hostnameProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(true),
+	idna.ValidateLabels(true),
+	idna.VerifyDNSLength(true),
+)
+
+// NormalizeDomain validates a hostname and returns its canonical form:
+// lowercase ASCII, with internationalized labels converted to punycode
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", fmt.Errorf("must not be empty")
+	}
+
+	ascii, err := hostnameProfile.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("must be a valid hostname: %v", err)
+	}
+
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("must be a fully qualified hostname")
+	}
+	for _, label := range labels {
+		if !dnsLabel.MatchString(label) {
+			return "", fmt.Errorf("label %q is not a valid DNS label", label)
+		}
+	}
+
+	return ascii, nil
+}
+
+// ValidateAppName checks that an app name is a DNS label, since it is used
+// in generated proxy configuration and container names
+func ValidateAppName(name string) error {
+	if len(name) == 0 || len(name) > 63 {
+		return fmt.Errorf("must be between 1 and 63 characters")
+	}
+	if !dnsLabel.MatchString(name) {
+		return fmt.Errorf("must consist of lowercase letters, digits and '-', and start and end with a letter or digit")
+	}
+	return nil
+}
+
+// secretName matches project and secret names; '/' is reserved as the
+// separator in secret references such as "payments/db-pass"
+var secretName = regexp.MustCompile(`^[a-z0-9]([-_.a-z0-9]*[a-z0-9])?$`)
+
+// ParseCron parses a schedule's cron expression: five standard fields or a
+// descriptor such as "@daily", evaluated in UTC unless prefixed with TZ=
+func ParseCron(expr string) (cron.Schedule, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("is required")
+	}
+
+	spec := expr
+	if !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+		spec = "CRON_TZ=UTC " + spec
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("is not a valid cron expression: %v", err)
+	}
+	return schedule, nil
+}
+
+// ValidateSecretName checks a secret or secret project name
+func ValidateSecretName(name string) error {
+	if len(name) == 0 || len(name) > 128 {
+		return fmt.Errorf("must be between 1 and 128 characters")
+	}
+	if !secretName.MatchString(name) {
+		return fmt.Errorf("must consist of lowercase letters, digits, '-', '_' and '.', and start and end with a letter or digit")
+	}
+	return nil
+}
+
+// ValidateSecretRef checks a secret reference: either "project/name" (or
+// "project/name@version" to pin a version) for a stored secret, "vault://path#key" for a Vault secret, or
+// "aws-sm://id[#key]" / "aws-ssm://path" for AWS
+func ValidateSecretRef(ref string) error {
+	if scheme, rest, ok := strings.Cut(ref, "://"); ok {
+		switch scheme {
+		case "vault":
+			if path, key, _ := vault.ParseRef(ref); path == "" || key == "" {
+				return fmt.Errorf("must have the form vault://path#key")
+			}
+		case awssecrets.SecretsManagerScheme, awssecrets.ParameterStoreScheme:
+			if strings.TrimPrefix(rest, "/") == "" {
+				return fmt.Errorf("must have the form %s://name", scheme)
+			}
+		default:
+			return fmt.Errorf("unsupported secret scheme %q", scheme)
+		}
+		return nil
+	}
+
+	project, name, _, ok := models.SplitSecretRef(ref)
+	if !ok {
+		return fmt.Errorf("must have the form project/name or project/name@version")
+	}
+	if err := ValidateSecretName(project); err != nil {
+		return fmt.Errorf("project %v", err)
+	}
+	if err := ValidateSecretName(name); err != nil {
+		return fmt.Errorf("name %v", err)
+	}
+	return nil
+}
+
+// NormalizeImage parses a Docker image reference using the distribution
+// reference grammar (registry/repo:tag@digest) and returns its canonical
+// form, e.g. "nginx" becomes "docker.io/library/nginx:latest"
+func NormalizeImage(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return "", fmt.Errorf("must be a valid image reference: %v", err)
+	}
+
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// gitSHA matches an abbreviated or full git object name
+var gitSHA = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// NormalizeGitSHA checks a git commit SHA, abbreviated to at least 7 hex
+// digits or in full (SHA-1 or SHA-256), and returns it in lowercase
+func NormalizeGitSHA(sha string) (string, error) {
+	sha = strings.ToLower(strings.TrimSpace(sha))
+	if !gitSHA.MatchString(sha) {
+		return "", fmt.Errorf("must be 7 to 64 hexadecimal digits")
+	}
+	return sha, nil
+}
+
+// ValidateBuildURL checks that a CI build link is an absolute http(s) URL
+func ValidateBuildURL(raw string) error {
+	return validateHTTPURL(raw)
+}
+
+// ValidateWebhookURL checks that a webhook endpoint is an absolute http(s) URL
+func ValidateWebhookURL(raw string) error {
+	return validateHTTPURL(raw)
+}
+
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// errorCode matches a deployment failure code such as image_pull_error
+var errorCode = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ValidateErrorCode checks a deployment failure code: up to 64 lowercase
+// letters, digits and '_', starting with a letter
+func ValidateErrorCode(code string) error {
+	if !errorCode.MatchString(code) {
+		return fmt.Errorf("must be up to 64 lowercase letters, digits and '_', starting with a letter")
+	}
+	return nil
+}
+
+// metadataKey matches a deployment metadata key such as ticket or release.name
+var metadataKey = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`)
+
+// ValidateMetadataKey checks a deployment metadata key: up to 64 letters,
+// digits, '_', '.' and '-', not starting with '.' or '-'
+func ValidateMetadataKey(key string) error {
+	if !metadataKey.MatchString(key) {
+		return fmt.Errorf("must be up to 64 letters, digits, '_', '.' and '-', not starting with '.' or '-'")
+	}
+	return nil
+}
+
+// envName matches a portable environment variable name
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvError describes an invalid entry in an env list; Entry is -1 for errors
+// about the list as a whole
+type EnvError struct {
+	Entry   int
+	Message string
+}
+
+// ValidateEnv checks that every entry has the form NAME=value with a legal
+// identifier, that no name is repeated, and that the list stays within
+// maxCount entries and maxBytes total size (zero disables a limit)
+func ValidateEnv(env []string, maxCount, maxBytes int) []EnvError {
+	var errs []EnvError
+
+	if maxCount > 0 && len(env) > maxCount {
+		errs = append(errs, EnvError{Entry: -1, Message: fmt.Sprintf("must have at most %d entries, got %d", maxCount, len(env))})
+	}
+
+	total := 0
+	seen := make(map[string]int, len(env))
+	for i, entry := range env {
+		total += len(entry)
+
+		name, _, ok := strings.Cut(entry, "=")
+		if !ok {
+			errs = append(errs, EnvError{Entry: i, Message: "must have the form NAME=value"})
+			continue
+		}
+		if !envName.MatchString(name) {
+			errs = append(errs, EnvError{Entry: i, Message: fmt.Sprintf("%q is not a valid variable name", name)})
+			continue
+		}
+		if first, dup := seen[name]; dup {
+			errs = append(errs, EnvError{Entry: i, Message: fmt.Sprintf("duplicate variable %q (first set at entry %d)", name, first)})
+			continue
+		}
+		seen[name] = i
+	}
+
+	if maxBytes > 0 && total > maxBytes {
+		errs = append(errs, EnvError{Entry: -1, Message: fmt.Sprintf("must be at most %d bytes in total, got %d", maxBytes, total)})
+	}
+
+	return errs
+}
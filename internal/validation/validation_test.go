@@ -0,0 +1,252 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    string
+		wantErr bool
+	}{
+		{domain: "app1.poridhi.com", want: "app1.poridhi.com"},
+		{domain: "App1.Poridhi.COM.", want: "app1.poridhi.com"},
+		{domain: "bücher.example", want: "xn--bcher-kva.example"},
+		{domain: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{domain: "", wantErr: true},
+		{domain: "localhost", wantErr: true},
+		{domain: "bad_domain.com", wantErr: true},
+		{domain: "-leading.example.com", wantErr: true},
+		{domain: "has space.com", wantErr: true},
+		{domain: "a..b.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := NormalizeDomain(tt.domain)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %q", tt.domain, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", tt.domain, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAppName(t *testing.T) {
+	valid := []string{"order-service", "api", "a1", "x"}
+	invalid := []string{"", "Order-Service", "-api", "api-", "api_v2", "app.name",
+		"a234567890123456789012345678901234567890123456789012345678901234"}
+
+	for _, name := range valid {
+		if err := ValidateAppName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := ValidateAppName(name); err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestValidateSecretName(t *testing.T) {
+	valid := []string{"payments", "db-pass", "db_pass", "tls.key", "a"}
+	invalid := []string{"", "DB_PASS", "payments/db-pass", "-pass", "pass.", "has space"}
+
+	for _, name := range valid {
+		if err := ValidateSecretName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := ValidateSecretName(name); err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestValidateSecretRef(t *testing.T) {
+	for _, ref := range []string{"payments/db-pass", "payments/db-pass@2", "a/b", "vault://secret/data/payments#db_pass", "aws-sm://prod/payments/api-key", "aws-sm://prod/db#password", "aws-ssm://prod/payments/token"} {
+		if err := ValidateSecretRef(ref); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"", "db-pass", "payments/", "/db-pass", "a/b/c", "Payments/db-pass", "payments/db-pass@0", "payments/db-pass@x", "vault://secret/data/payments", "vault://#key", "aws-sm://", "aws-ssm:///", "gcp-sm://proj/secret"} {
+		if err := ValidateSecretRef(ref); err == nil {
+			t.Errorf("Expected %q to be invalid", ref)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	schedule, err := ParseCron("0 3 * * *")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if next := schedule.Next(from); !next.Equal(time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run at 03:00 UTC, got %v", next)
+	}
+
+	for _, expr := range []string{"@daily", "*/15 * * * *", "TZ=Europe/Berlin 0 3 * * *"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "  ", "* * *", "61 * * * *", "@sometimes"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		image   string
+		want    string
+		wantErr bool
+	}{
+		{image: "nginx", want: "docker.io/library/nginx:latest"},
+		{image: "nginx:1.25", want: "docker.io/library/nginx:1.25"},
+		{image: "myorg/api:v2", want: "docker.io/myorg/api:v2"},
+		{image: "registry.poridhi.com/order-service:latest", want: "registry.poridhi.com/order-service:latest"},
+		{image: "localhost:5000/app", want: "localhost:5000/app:latest"},
+		{
+			image: "ghcr.io/org/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			want:  "ghcr.io/org/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		},
+		{image: "", wantErr: true},
+		{image: "myorg/UPPER", wantErr: true},
+		{image: "nginx:bad tag", wantErr: true},
+		{image: "app@sha256:short", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := NormalizeImage(tt.image)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %q", tt.image, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", tt.image, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeImage(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		maxCount int
+		maxBytes int
+		entries  []int
+	}{
+		{name: "Valid", env: []string{"NODE_ENV=production", "_PRIVATE=1", "EMPTY=", "URL=a=b"}},
+		{name: "Missing separator", env: []string{"NODE_ENV"}, entries: []int{0}},
+		{name: "Illegal name", env: []string{"OK=1", "1BAD=x", "BAD-NAME=y", "=z"}, entries: []int{1, 2, 3}},
+		{name: "Duplicate", env: []string{"A=1", "B=2", "A=3"}, entries: []int{2}},
+		{name: "Too many", env: []string{"A=1", "B=2", "C=3"}, maxCount: 2, entries: []int{-1}},
+		{name: "Too large", env: []string{"A=123456789"}, maxBytes: 8, entries: []int{-1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateEnv(tt.env, tt.maxCount, tt.maxBytes)
+			if len(errs) != len(tt.entries) {
+				t.Fatalf("Expected %d errors, got %v", len(tt.entries), errs)
+			}
+			for i, err := range errs {
+				if err.Entry != tt.entries[i] {
+					t.Errorf("Expected error %d for entry %d, got entry %d (%s)", i, tt.entries[i], err.Entry, err.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeGitSHA(t *testing.T) {
+	tests := []struct {
+		sha     string
+		want    string
+		wantErr bool
+	}{
+		{sha: "3f2a9c1", want: "3f2a9c1"},
+		{sha: " 3F2A9C1E0B ", want: "3f2a9c1e0b"},
+		{sha: "0123456789abcdef0123456789abcdef01234567", want: "0123456789abcdef0123456789abcdef01234567"},
+		{sha: "", wantErr: true},
+		{sha: "3f2a9c", wantErr: true},
+		{sha: "main", wantErr: true},
+		{sha: "3f2a9c1g", wantErr: true},
+		{sha: strings.Repeat("a", 65), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeGitSHA(tt.sha)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for %q, got %q", tt.sha, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeGitSHA(%q) = %q, %v, want %q", tt.sha, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateBuildURL(t *testing.T) {
+	for _, raw := range []string{"https://github.com/poridhi/app/actions/runs/42", "http://ci.internal:8080/job/app/7/"} {
+		if err := ValidateBuildURL(raw); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"", "ci.example.com/runs/42", "/runs/42", "ftp://ci.example.com/42", "https://", "javascript:alert(1)"} {
+		if err := ValidateBuildURL(raw); err == nil {
+			t.Errorf("Expected %q to be invalid", raw)
+		}
+	}
+}
+
+func TestValidateErrorCode(t *testing.T) {
+	for _, code := range []string{"image_pull_error", "port_in_use", "health_check_timeout", "oom", "e2"} {
+		if err := ValidateErrorCode(code); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", code, err)
+		}
+	}
+	for _, code := range []string{"", "ImagePull", "image-pull", "_pull", "2fa", "image pull", strings.Repeat("a", 65)} {
+		if err := ValidateErrorCode(code); err == nil {
+			t.Errorf("Expected %q to be invalid", code)
+		}
+	}
+}
+
+func TestValidateMetadataKey(t *testing.T) {
+	for _, key := range []string{"ticket", "release.name", "JIRA-123", "_owner", "2fa", strings.Repeat("a", 64)} {
+		if err := ValidateMetadataKey(key); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", key, err)
+		}
+	}
+	for _, key := range []string{"", ".hidden", "-flag", "release name", "team/owner", strings.Repeat("a", 65)} {
+		if err := ValidateMetadataKey(key); err == nil {
+			t.Errorf("Expected %q to be invalid", key)
+		}
+	}
+}
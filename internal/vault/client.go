@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/clock"
+	"deployment-controller/internal/config"
+)
+
+// Client reads secrets from HashiCorp Vault over its HTTP API
+type Client struct {
+	address string
+	token   string
+	http    *http.Client
+	clock   clock.Clock
+}
+
+// New creates a Vault client, or returns nil when no address is configured
+func New(cfg config.VaultConfig) *Client {
+	if cfg.Address == "" {
+		return nil
+	}
+
+	return &Client{
+		address: strings.TrimSuffix(cfg.Address, "/"),
+		token:   cfg.Token,
+		http:    &http.Client{Timeout: cfg.Timeout},
+		clock:   clock.Real,
+	}
+}
+
+// SetClock sets the clock minted tokens' expiry is computed with
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Address returns the Vault server address
+func (c *Client) Address() string {
+	return c.address
+}
+
+// do sends a request to the Vault API and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return fmt.Errorf("failed to build vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("secret not found")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+// Read returns one key of the secret at path. Both KV version 2 responses
+// (values under data.data) and version 1 responses (values under data) are
+// supported.
+func (c *Client) Read(ctx context.Context, path, key string) (string, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return "", err
+	}
+
+	data := resp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret not found")
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode vault value: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// CreateToken mints a short-lived child token with the given policies
+func (c *Client) CreateToken(ctx context.Context, ttl time.Duration, policies []string) (string, time.Time, error) {
+	body := map[string]interface{}{
+		"ttl":       ttl.String(),
+		"policies":  policies,
+		"renewable": false,
+		"no_parent": false,
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/token/create", body, &resp); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := c.clock.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	return resp.Auth.ClientToken, expiresAt, nil
+}
+
+// Resolve reads the value of a "vault://path#key" reference
+func (c *Client) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := ParseRef(ref)
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q", ref)
+	}
+	return c.Read(ctx, path, key)
+}
+
+// RefScheme prefixes secret references that point at Vault
+const RefScheme = "vault://"
+
+// ParseRef splits a "vault://path#key" secret reference; ok is false for
+// references that do not point at Vault
+func ParseRef(ref string) (path, key string, ok bool) {
+	rest, found := strings.CutPrefix(ref, RefScheme)
+	if !found {
+		return "", "", false
+	}
+
+	path, key, _ = strings.Cut(rest, "#")
+	return path, key, true
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+)
+
+func TestClientRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/payments":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"db_pass": "s3cret"},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			})
+		case "/v1/kv/legacy":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"api_key": "abc"},
+			})
+		case "/v1/auth/token/create":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "child", "lease_duration": 300},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New(config.VaultConfig{Address: server.URL, Token: "root", Timeout: time.Second})
+	ctx := context.Background()
+
+	if value, err := client.Read(ctx, "secret/data/payments", "db_pass"); err != nil || value != "s3cret" {
+		t.Errorf("KV v2 read = %q, %v", value, err)
+	}
+	if value, err := client.Read(ctx, "kv/legacy", "api_key"); err != nil || value != "abc" {
+		t.Errorf("KV v1 read = %q, %v", value, err)
+	}
+	if _, err := client.Read(ctx, "secret/data/payments", "missing"); err == nil || err.Error() != "secret not found" {
+		t.Errorf("Expected not found for missing key, got %v", err)
+	}
+	if _, err := client.Read(ctx, "secret/data/unknown", "x"); err == nil || err.Error() != "secret not found" {
+		t.Errorf("Expected not found for missing path, got %v", err)
+	}
+
+	if value, err := client.Resolve(ctx, "vault://secret/data/payments#db_pass"); err != nil || value != "s3cret" {
+		t.Errorf("Resolve = %q, %v", value, err)
+	}
+
+	token, expiresAt, err := client.CreateToken(ctx, 5*time.Minute, []string{"deploy-read"})
+	if err != nil || token != "child" || time.Until(expiresAt) < 4*time.Minute {
+		t.Errorf("CreateToken = %q, %v, %v", token, expiresAt, err)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	path, key, ok := ParseRef("vault://secret/data/payments#db_pass")
+	if !ok || path != "secret/data/payments" || key != "db_pass" {
+		t.Errorf("ParseRef = %q, %q, %v", path, key, ok)
+	}
+	if _, _, ok := ParseRef("payments/db-pass"); ok {
+		t.Errorf("Expected stored secret reference not to parse as a Vault reference")
+	}
+}
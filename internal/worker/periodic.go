@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunPeriodic calls fn immediately and then every interval until ctx is
+// cancelled. Errors are logged and do not stop the loop.
+func RunPeriodic(ctx context.Context, logger *slog.Logger, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("Starting background worker", "worker", name, "interval", interval)
+
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Background worker run failed", "worker", name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped background worker", "worker", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"deployment-controller/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ListPending lists the pending deployments agents may start now under the
+// rollout limits, optionally only those of one domain. It uses the agent
+// token.
+func (c *Client) ListPending(ctx context.Context, domain string) ([]Deployment, error) {
+	query := url.Values{}
+	if domain != "" {
+		query.Set("domain", domain)
+	}
+	var deployments []Deployment
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/agent/pending", query: query, agent: true}, &deployments); err != nil {
+		return nil, err
+	}
+	return deployments, nil
+}
+
+// Claim moves up to limit pending deployments, optionally only those of one
+// domain, to deploying and returns them. A claim is not retried, since a
+// repeated claim would start more deployments. It uses the agent token.
+func (c *Client) Claim(ctx context.Context, domain string, limit int) ([]Deployment, error) {
+	var deployments []Deployment
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/agent/claim",
+		body:   models.ClaimRequest{Domain: domain, Limit: limit},
+		agent:  true,
+	}, &deployments)
+	if err != nil {
+		return nil, err
+	}
+	return deployments, nil
+}
+
+// GetAgentDeployment gets a deployment with its secret references resolved
+// to their values. It uses the agent token.
+func (c *Client) GetAgentDeployment(ctx context.Context, id uuid.UUID) (*Deployment, error) {
+	var deployment Deployment
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/agent/deployments/" + id.String(), agent: true}, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// UploadLog appends chunk seq, numbered from 0, to a deployment's log.
+// Re-sending a stored chunk is accepted, so uploads are retried. It uses the
+// agent token.
+func (c *Client) UploadLog(ctx context.Context, id uuid.UUID, seq int64, content string) (*DeploymentLogChunk, error) {
+	var chunk DeploymentLogChunk
+	_, err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/agent/deployments/" + id.String() + "/logs",
+		body:       models.DeploymentLogRequest{Seq: &seq, Content: content},
+		agent:      true,
+		idempotent: true,
+	}, &chunk)
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// ReportObservedState reports what runs for an app, replacing the previous
+// report, and returns how it compares with the app's latest deployment. It
+// uses the agent token.
+func (c *Client) ReportObservedState(ctx context.Context, domain, appName string, state ObservedStateRequest) (*AppComparison, error) {
+	var comparison AppComparison
+	_, err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/agent/apps/" + url.PathEscape(domain) + "/" + url.PathEscape(appName) + "/observed",
+		body:       state,
+		agent:      true,
+		idempotent: true,
+	}, &comparison)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
@@ -0,0 +1,333 @@
+// Package client is a Go client for the deployment controller's HTTP API.
+// It wraps pushes, deployment listing, status updates and deletes, registry
+// credentials and the agent API, retrying transient failures of requests
+// that are safe to repeat:
+//
+//	c := client.New(client.Config{BaseURL: "http://localhost:8080", Token: token})
+//	result, err := c.Push(ctx, []client.DeploymentRequest{{
+//		Domain: "app1.example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80,
+//	}}, client.PushOptions{})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployment-controller/internal/models"
+)
+
+// The API's request and response bodies
+type (
+	Deployment           = models.Deployment
+	DeploymentRequest    = models.DeploymentRequest
+	StatusUpdate         = models.StatusUpdateRequest
+	RegistryReference    = models.RegistryReference
+	RegistryCredential   = models.RegistryCredentialResponse
+	ObservedStateRequest = models.ObservedStateRequest
+	AppComparison        = models.AppComparison
+	DeploymentLogChunk   = models.DeploymentLogChunk
+	FieldError           = models.FieldError
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+
+	// maxRetryWait caps the wait before a retry, including one asked for
+	// with Retry-After
+	maxRetryWait = 30 * time.Second
+)
+
+// Config configures a Client
+type Config struct {
+	// BaseURL is the controller's address, such as http://localhost:8080
+	BaseURL string
+
+	// Token is the API bearer token; empty when the API does not require one
+	Token string
+
+	// AgentToken authenticates the agent API methods
+	AgentToken string
+
+	// AgentID is sent as X-Agent-ID to name the agent in the audit trail
+	AgentID string
+
+	// HTTPClient sends the requests; defaults to a client with a 30s timeout
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a request that is safe to repeat is
+	// retried after a network error, 429, 502, 503 or 504; defaults to 3,
+	// and a negative value disables retries
+	MaxRetries int
+
+	// RetryBackoff is the wait before the first retry, doubled for each
+	// retry after it unless the server sends Retry-After; defaults to 500ms
+	RetryBackoff time.Duration
+}
+
+// Client calls the deployment controller's API. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	token        string
+	agentToken   string
+	agentID      string
+	http         *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// New creates a client for the controller at cfg.BaseURL
+func New(cfg Config) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(cfg.BaseURL, "/"),
+		token:        cfg.Token,
+		agentToken:   cfg.AgentToken,
+		agentID:      cfg.AgentID,
+		http:         cfg.HTTPClient,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: defaultTimeout}
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = defaultMaxRetries
+	}
+	if c.retryBackoff <= 0 {
+		c.retryBackoff = defaultRetryBackoff
+	}
+	return c
+}
+
+// APIError is an error response from the controller
+type APIError struct {
+	StatusCode int
+	Message    string
+
+	// Errors lists the fields that failed validation, if any
+	Errors []FieldError
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("controller returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("controller returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Page is one page of a paginated list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
+
+// ListOptions selects a page of a paginated list
+type ListOptions struct {
+	// Limit is the page size, up to 500; the server defaults to 50
+	Limit int
+
+	// Cursor is the NextCursor of the previous page; empty for the first
+	Cursor string
+}
+
+// query encodes the options as query parameters
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		query.Set("cursor", o.Cursor)
+	}
+	return query
+}
+
+// All fetches every page of a paginated list, starting from opts.Cursor, by
+// calling list for each page in turn:
+//
+//	history, err := client.All(ctx, client.ListOptions{Limit: 500},
+//		func(ctx context.Context, opts client.ListOptions) (*client.Page[client.Deployment], error) {
+//			return c.DeploymentHistory(ctx, id, opts)
+//		})
+func All[T any](ctx context.Context, opts ListOptions, list func(ctx context.Context, opts ListOptions) (*Page[T], error)) ([]T, error) {
+	var items []T
+	for {
+		page, err := list(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.NextCursor == "" {
+			return items, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// request is a call to the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any
+
+	// agent authenticates with the agent token instead of the API token
+	agent bool
+
+	// idempotent marks requests that are safe to retry besides GET, PUT
+	// and DELETE, such as pushes with an Idempotency-Key
+	idempotent bool
+}
+
+// envelope is the body of every API response
+type envelope struct {
+	Success    bool              `json:"success"`
+	Error      string            `json:"error"`
+	Errors     []FieldError      `json:"errors"`
+	Data       json.RawMessage   `json:"data"`
+	Pagination models.Pagination `json:"pagination"`
+}
+
+// response is a decoded API response
+type response struct {
+	status int
+	header http.Header
+	envelope
+}
+
+// do sends a request, retrying transient failures when it is safe to, and
+// decodes the response's data into out when out is non-nil. Responses
+// outside 2xx are returned as an *APIError along with the response.
+func (c *Client) do(ctx context.Context, req request, out any) (*response, error) {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	retryable := req.idempotent || req.method == http.MethodGet || req.method == http.MethodPut || req.method == http.MethodDelete
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, payload)
+		if attempt >= c.maxRetries || !retryable || ctx.Err() != nil || !retry(resp, err) {
+			if err != nil {
+				return nil, err
+			}
+			return resp, resp.decode(out)
+		}
+
+		wait := c.retryBackoff << attempt
+		if resp != nil {
+			if seconds, err := strconv.Atoi(resp.header.Get("Retry-After")); err == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+		}
+		timer := time.NewTimer(min(wait, maxRetryWait))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retry reports whether a failed attempt may succeed if repeated
+func retry(resp *response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// send makes one attempt at a request
+func (c *Client) send(ctx context.Context, req request, payload []byte) (*response, error) {
+	target := c.baseURL + "/api/v1" + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+
+	token := c.token
+	if req.agent {
+		token = c.agentToken
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.agentID != "" {
+		httpReq.Header.Set("X-Agent-ID", c.agentID)
+	}
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", req.method, req.path, err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", req.method, req.path, err)
+	}
+
+	resp := &response{status: httpResp.StatusCode, header: httpResp.Header}
+	if len(data) > 0 && strings.Contains(httpResp.Header.Get("Content-Type"), "json") {
+		if err := json.Unmarshal(data, &resp.envelope); err != nil {
+			return nil, fmt.Errorf("failed to decode response to %s %s: %w", req.method, req.path, err)
+		}
+	} else if resp.status >= 300 {
+		resp.Error = strings.TrimSpace(string(data))
+	}
+	return resp, nil
+}
+
+// decode returns the response's error, or decodes its data into out
+func (r *response) decode(out any) error {
+	if r.status < 200 || r.status > 299 {
+		return &APIError{StatusCode: r.status, Message: r.Error, Errors: r.Errors}
+	}
+	if out == nil || len(r.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return fmt.Errorf("failed to decode response data: %w", err)
+	}
+	return nil
+}
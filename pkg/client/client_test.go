@@ -0,0 +1,236 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/memstore"
+	"deployment-controller/pkg/client"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newController serves the routes the client wraps from an in-memory store
+func newController(t *testing.T) *httptest.Server {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("security:\n  encryption_key: client-test-key\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store, err := memstore.New(cfg.Database.IDVersion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := handlers.New(store, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	v1.POST("/push", h.Push)
+	v1.GET("/deployments", h.GetDeployments)
+	v1.GET("/deployments/:id", h.GetDeployment)
+	v1.GET("/deployments/:id/history", h.GetDeploymentHistory)
+	v1.PATCH("/deployments/:id/status", h.UpdateDeploymentStatus)
+	v1.DELETE("/deployments/:id", h.DeleteDeployment)
+	v1.GET("/registry", h.GetRegistryCredential)
+	v1.GET("/registries", h.ListRegistries)
+	v1.PUT("/registries/:registry", h.PutRegistry)
+	v1.DELETE("/registries/:registry", h.DeleteRegistry)
+	v1.GET("/agent/pending", h.ListPendingDeployments)
+	v1.POST("/agent/claim", h.ClaimDeployments)
+	v1.GET("/agent/deployments/:id", h.GetAgentDeployment)
+	v1.POST("/agent/deployments/:id/logs", h.UploadDeploymentLog)
+	v1.POST("/agent/apps/:domain/:app_name/observed", h.ReportObservedState)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientDeployments(t *testing.T) {
+	server := newController(t)
+	c := client.New(client.Config{BaseURL: server.URL})
+	ctx := context.Background()
+
+	var pushed []client.Deployment
+	for _, image := range []string{"nginx:1.24", "nginx:1.25", "nginx:1.26"} {
+		result, err := c.Push(ctx, []client.DeploymentRequest{{Domain: "example.com", AppName: "web", DockerImage: image, Port: 80}}, client.PushOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(result.Created) != 1 || result.RequestID == "" {
+			t.Fatalf("Expected one created deployment, got %+v", result)
+		}
+		pushed = append(pushed, result.Created[0])
+	}
+
+	_, err := c.Push(ctx, []client.DeploymentRequest{{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.26"}}, client.PushOptions{})
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a 400 for an item without a port, got %v", err)
+	}
+
+	latest, err := c.ListDeployments(ctx)
+	if err != nil || len(latest) != 1 || latest[0].Version != 3 {
+		t.Fatalf("Expected version 3 to be latest, got %+v: %v", latest, err)
+	}
+
+	history, err := client.All(ctx, client.ListOptions{Limit: 2}, func(ctx context.Context, opts client.ListOptions) (*client.Page[client.Deployment], error) {
+		return c.DeploymentHistory(ctx, latest[0].ID, opts)
+	})
+	if err != nil || len(history) != 3 || history[0].Version != 3 || history[2].Version != 1 {
+		t.Fatalf("Expected three versions over two pages, got %+v: %v", history, err)
+	}
+
+	d, err := c.GetDeployment(ctx, pushed[2].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated, err := c.UpdateStatus(ctx, d.ID, client.StatusUpdate{Status: "deployed"}, d.ETag())
+	if err != nil || updated.Status != "deployed" || updated.DeployedAt == nil {
+		t.Fatalf("Expected the deployment to be deployed, got %+v: %v", updated, err)
+	}
+
+	_, err = c.UpdateStatus(ctx, d.ID, client.StatusUpdate{Status: "failed"}, d.ETag())
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 with the stale ETag, got %v", err)
+	}
+
+	err = c.DeleteDeployment(ctx, d.ID, d.ETag())
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected a 412 deleting with the stale ETag, got %v", err)
+	}
+	if err := c.DeleteDeployment(ctx, d.ID, updated.ETag()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.GetDeployment(ctx, d.ID); !client.IsNotFound(err) {
+		t.Errorf("Expected not found after deleting, got %v", err)
+	}
+	if history, err := c.DeploymentHistory(ctx, pushed[1].ID, client.ListOptions{}); err != nil || len(history.Items) != 2 {
+		t.Errorf("Expected the other two versions kept, got %+v: %v", history, err)
+	}
+}
+
+func TestClientRegistries(t *testing.T) {
+	server := newController(t)
+	c := client.New(client.Config{BaseURL: server.URL})
+	ctx := context.Background()
+
+	if err := c.PutRegistryCredential(ctx, "ghcr.io", "ci", "hunter2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cred, err := c.GetRegistryCredential(ctx, "ghcr.io")
+	if err != nil || cred.Username != "ci" || cred.Password != "hunter2" {
+		t.Fatalf("Expected the stored credential, got %+v: %v", cred, err)
+	}
+	registries, err := c.ListRegistries(ctx)
+	if err != nil || len(registries) != 1 || registries[0].Password != "" {
+		t.Errorf("Expected one registry without its password, got %+v: %v", registries, err)
+	}
+
+	if err := c.DeleteRegistryCredential(ctx, "ghcr.io"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.GetRegistryCredential(ctx, "ghcr.io"); !client.IsNotFound(err) {
+		t.Errorf("Expected not found after deleting, got %v", err)
+	}
+}
+
+func TestClientAgent(t *testing.T) {
+	server := newController(t)
+	c := client.New(client.Config{BaseURL: server.URL, AgentID: "host-1"})
+	ctx := context.Background()
+
+	if _, err := c.Push(ctx, []client.DeploymentRequest{{Domain: "example.com", AppName: "web", DockerImage: "nginx:1.25", Port: 80}}, client.PushOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pending, err := c.ListPending(ctx, "example.com")
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected one pending deployment, got %+v: %v", pending, err)
+	}
+	claimed, err := c.Claim(ctx, "", 5)
+	if err != nil || len(claimed) != 1 || claimed[0].Status != "deploying" {
+		t.Fatalf("Expected to claim the deployment, got %+v: %v", claimed, err)
+	}
+
+	d, err := c.GetAgentDeployment(ctx, claimed[0].ID)
+	if err != nil || d.ID != claimed[0].ID {
+		t.Fatalf("Expected the claimed deployment, got %+v: %v", d, err)
+	}
+	if chunk, err := c.UploadLog(ctx, d.ID, 0, "pulling\n"); err != nil || chunk.Seq != 0 || chunk.Content != "pulling\n" {
+		t.Errorf("Expected the chunk to be stored, got %+v: %v", chunk, err)
+	}
+
+	comparison, err := c.ReportObservedState(ctx, "example.com", "web", client.ObservedStateRequest{DeploymentID: &d.ID, DockerImage: d.DockerImage, Replicas: 1})
+	if err != nil || comparison.State != "in_sync" {
+		t.Errorf("Expected the app to be in sync, got %+v: %v", comparison, err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	keys := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			keys[key] = true
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if n < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"success":false,"error":"Server is draining"}`))
+			return
+		}
+		if r.URL.Path == "/api/v1/push" {
+			w.Write([]byte(`{"success":true,"data":{}}`))
+			return
+		}
+		w.Write([]byte(`{"success":true,"data":[]}`))
+	}))
+	defer server.Close()
+
+	c := client.New(client.Config{BaseURL: server.URL, RetryBackoff: time.Millisecond})
+	ctx := context.Background()
+
+	if _, err := c.ListDeployments(ctx); err != nil {
+		t.Errorf("Expected the list to succeed on the third attempt, got %v", err)
+	}
+	if _, err := c.Push(ctx, nil, client.PushOptions{}); err != nil {
+		t.Errorf("Expected the push to succeed on the third attempt, got %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Expected every push attempt to share one idempotency key, got %d", len(keys))
+	}
+
+	_, err := c.Claim(ctx, "", 1)
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "Server is draining" {
+		t.Errorf("Expected the claim to fail without retrying, got %v", err)
+	}
+	if calls["/api/v1/agent/claim"] != 1 {
+		t.Errorf("Expected one claim attempt, got %d", calls["/api/v1/agent/claim"])
+	}
+
+	none := client.New(client.Config{BaseURL: server.URL, MaxRetries: -1})
+	if _, err := none.GetDeployment(ctx, [16]byte{}); err == nil {
+		t.Error("Expected a failure with retries disabled")
+	}
+}
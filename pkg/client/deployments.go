@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// PushOptions are the options of a push
+type PushOptions struct {
+	// SkipUnchanged returns an app's current version instead of creating a
+	// new one when an item is identical to it
+	SkipUnchanged bool
+
+	// Atomic applies the whole batch or nothing
+	Atomic bool
+
+	// IdempotencyKey deduplicates retries of the same push; a random key is
+	// used when empty, so the client's own retries never push twice
+	IdempotencyKey string
+}
+
+// PushFailure is an item of a push that was not applied
+type PushFailure struct {
+	Index   int    `json:"index"`
+	Domain  string `json:"domain"`
+	AppName string `json:"app_name"`
+	Error   string `json:"error"`
+}
+
+// PushResult is the outcome of a push
+type PushResult struct {
+	RequestID      string        `json:"request_id"`
+	ProcessedCount int           `json:"processed_count"`
+	FailedCount    int           `json:"failed_count"`
+	Created        []Deployment  `json:"created_deployments"`
+	Unchanged      []Deployment  `json:"unchanged_deployments"`
+	Failed         []PushFailure `json:"failed_deployments"`
+
+	// RolledBack is set for atomic pushes undone because an item failed
+	RolledBack bool `json:"rolled_back"`
+}
+
+// Push creates a new version of each app in the batch. Items that fail are
+// listed in the result's Failed; when every item fails the result is
+// returned along with an *APIError.
+func (c *Client) Push(ctx context.Context, batch []DeploymentRequest, opts PushOptions) (*PushResult, error) {
+	query := url.Values{}
+	if opts.SkipUnchanged {
+		query.Set("skip_unchanged", "true")
+	}
+	if opts.Atomic {
+		query.Set("atomic", "true")
+	}
+	key := opts.IdempotencyKey
+	if key == "" {
+		key = uuid.NewString()
+	}
+
+	resp, err := c.do(ctx, request{
+		method:     http.MethodPost,
+		path:       "/push",
+		query:      query,
+		header:     http.Header{"Idempotency-Key": {key}},
+		body:       batch,
+		idempotent: true,
+	}, nil)
+	if resp == nil || len(resp.Data) == 0 {
+		return nil, err
+	}
+
+	var result PushResult
+	if decodeErr := json.Unmarshal(resp.Data, &result); decodeErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, decodeErr
+	}
+	return &result, err
+}
+
+// ListDeployments lists the latest version of every app
+func (c *Client) ListDeployments(ctx context.Context) ([]Deployment, error) {
+	var deployments []Deployment
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/deployments"}, &deployments); err != nil {
+		return nil, err
+	}
+	return deployments, nil
+}
+
+// GetDeployment gets a deployment by ID. Its ETag method gives the value
+// to pass as ifMatch to UpdateStatus.
+func (c *Client) GetDeployment(ctx context.Context, id uuid.UUID) (*Deployment, error) {
+	var deployment Deployment
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/deployments/" + id.String()}, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// DeploymentHistory gets a page of the versions of a deployment's app,
+// newest first
+func (c *Client) DeploymentHistory(ctx context.Context, id uuid.UUID, opts ListOptions) (*Page[Deployment], error) {
+	var history []Deployment
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/deployments/" + id.String() + "/history", query: opts.query()}, &history)
+	if err != nil {
+		return nil, err
+	}
+	return &Page[Deployment]{Items: history, NextCursor: resp.Pagination.NextCursor}, nil
+}
+
+// UpdateStatus sets a deployment's status. ifMatch is the ETag of the
+// version of the deployment the update is based on, as returned by
+// Deployment.ETag, or * to update it whatever its state; the update fails
+// with a 412 *APIError when the deployment changed in between.
+func (c *Client) UpdateStatus(ctx context.Context, id uuid.UUID, update StatusUpdate, ifMatch string) (*Deployment, error) {
+	var deployment Deployment
+	_, err := c.do(ctx, request{
+		method: http.MethodPatch,
+		path:   "/deployments/" + id.String() + "/status",
+		header: http.Header{"If-Match": {ifMatch}},
+		body:   update,
+	}, &deployment)
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// DeleteDeployment purges a deployment version with its logs, events and
+// checks. ifMatch is as for UpdateStatus.
+func (c *Client) DeleteDeployment(ctx context.Context, id uuid.UUID, ifMatch string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   "/deployments/" + id.String(),
+		header: http.Header{"If-Match": {ifMatch}},
+	}, nil)
+	return err
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"deployment-controller/internal/models"
+)
+
+// ListRegistries lists the registries with stored credentials, without
+// their passwords
+func (c *Client) ListRegistries(ctx context.Context) ([]RegistryReference, error) {
+	var registries []RegistryReference
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/registries"}, &registries); err != nil {
+		return nil, err
+	}
+	return registries, nil
+}
+
+// PutRegistryCredential stores or replaces a registry's credentials
+func (c *Client) PutRegistryCredential(ctx context.Context, registry, username, password string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   "/registries/" + url.PathEscape(registry),
+		body:   models.RegistryCredentialUpdate{Username: username, Password: password},
+	}, nil)
+	return err
+}
+
+// GetRegistryCredential gets a registry's credentials, including the
+// password; the read is recorded in the audit log
+func (c *Client) GetRegistryCredential(ctx context.Context, registry string) (*RegistryCredential, error) {
+	var cred RegistryCredential
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/registry", query: url.Values{"registry": {registry}}}, &cred)
+	if err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// DeleteRegistryCredential deletes a registry's credentials
+func (c *Client) DeleteRegistryCredential(ctx context.Context, registry string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: "/registries/" + url.PathEscape(registry)}, nil)
+	return err
+}
@@ -0,0 +1,364 @@
+// Package conformance checks that a controller speaks the agent protocol the
+// way agents expect: listing pending deployments, claiming them, fetching
+// them with resolved env values, uploading logs and reporting status and
+// observed state. Third-party agents run it from a test against a controller
+// they deploy to, so they find out about protocol changes before rolling out:
+//
+//	func TestControllerConformance(t *testing.T) {
+//		conformance.Run(t, conformance.Target{
+//			BaseURL:    os.Getenv("CONTROLLER_URL"),
+//			APIToken:   os.Getenv("CONTROLLER_API_TOKEN"),
+//			AgentToken: os.Getenv("CONTROLLER_AGENT_TOKEN"),
+//		})
+//	}
+//
+// Every run pushes its apps under a fresh domain ending in Domain, so runs
+// don't see each other's deployments. Nothing is cleaned up afterwards, so
+// point it at a development or staging controller.
+package conformance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Domain is the parent domain of the apps a run pushes
+const Domain = "conformance.test"
+
+// Target is the controller a run checks
+type Target struct {
+	// BaseURL is the controller's address, such as http://localhost:8080
+	BaseURL string
+
+	// APIToken authenticates pushes and status updates; empty when the API
+	// does not require one
+	APIToken string
+
+	// AgentToken authenticates the /api/v1/agent routes
+	AgentToken string
+
+	// AgentID is sent as X-Agent-ID; defaults to conformance
+	AgentID string
+
+	// Client sends the requests; defaults to a client with a 30s timeout
+	Client *http.Client
+}
+
+// Deployment is the part of a deployment agents rely on
+type Deployment struct {
+	ID          string   `json:"id"`
+	Domain      string   `json:"domain"`
+	AppName     string   `json:"app_name"`
+	DockerImage string   `json:"docker_image"`
+	Port        int      `json:"port"`
+	Env         []string `json:"env"`
+	Version     int      `json:"version"`
+	Status      string   `json:"status"`
+	DeployedAt  *string  `json:"deployed_at"`
+	Failure     *struct {
+		Code    string `json:"error_code"`
+		Message string `json:"error_message"`
+	} `json:"failure"`
+}
+
+// envelope is the body of every API response
+type envelope struct {
+	Success bool            `json:"success"`
+	Error   string          `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// suite holds a run's target and the version of its app the flows roll out
+type suite struct {
+	Target
+	domain string
+	web    Deployment
+}
+
+// Run checks the agent protocol against target, one subtest per flow. The
+// flows build on each other, so a failure skips the ones after it.
+func Run(t *testing.T, target Target) {
+	if target.BaseURL == "" {
+		t.Fatal("conformance: Target.BaseURL is required")
+	}
+	if target.AgentID == "" {
+		target.AgentID = "conformance"
+	}
+	if target.Client == nil {
+		target.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	target.BaseURL = strings.TrimSuffix(target.BaseURL, "/")
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("conformance: %v", err)
+	}
+	s := &suite{Target: target, domain: "run-" + hex.EncodeToString(suffix) + "." + Domain}
+
+	flows := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"AgentAuth", s.testAgentAuth},
+		{"PendingAndClaim", s.testPendingAndClaim},
+		{"FetchAndLogs", s.testFetchAndLogs},
+		{"ReportDeployed", s.testReportDeployed},
+		{"ReportFailed", s.testReportFailed},
+	}
+	failed := false
+	for _, flow := range flows {
+		ok := t.Run(flow.name, func(t *testing.T) {
+			if failed {
+				t.Skip("skipped after an earlier flow failed")
+			}
+			flow.run(t)
+		})
+		failed = failed || !ok
+	}
+}
+
+// testAgentAuth checks that agent routes require the agent token
+func (s *suite) testAgentAuth(t *testing.T) {
+	if status, _ := s.agent(t, "GET", "/pending", nil); status != http.StatusOK {
+		t.Fatalf("GET /agent/pending with the agent token: expected 200, got %d", status)
+	}
+	for name, token := range map[string]string{"no token": "", "wrong token": s.AgentToken + "-wrong"} {
+		if status, _ := s.do(t, "GET", "/api/v1/agent/pending", token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("GET /agent/pending with %s: expected 401, got %d", name, status)
+		}
+	}
+}
+
+// testPendingAndClaim checks that a pushed version is pending until one
+// claim moves it to deploying
+func (s *suite) testPendingAndClaim(t *testing.T) {
+	pushed := s.push(t, "web", "nginx:1.25")
+	if pushed.Status != "pending" || pushed.Version != 1 {
+		t.Fatalf("expected a pending version 1, got %+v", pushed)
+	}
+	s.web = pushed
+
+	var pending []Deployment
+	s.decode(t, "GET /agent/pending", http.StatusOK, &pending)(s.agent(t, "GET", "/pending?domain="+s.domain, nil))
+	if len(pending) != 1 || pending[0].ID != pushed.ID {
+		t.Fatalf("expected pending to list the pushed deployment only, got %+v", pending)
+	}
+	checkFields(t, pending[0], pushed)
+
+	var claimed []Deployment
+	s.decode(t, "POST /agent/claim", http.StatusOK, &claimed)(s.agent(t, "POST", "/claim", map[string]any{"domain": s.domain, "limit": 10}))
+	if len(claimed) != 1 || claimed[0].ID != pushed.ID || claimed[0].Status != "deploying" {
+		t.Fatalf("expected the claim to move the deployment to deploying, got %+v", claimed)
+	}
+	checkFields(t, claimed[0], pushed)
+
+	s.decode(t, "POST /agent/claim", http.StatusOK, &claimed)(s.agent(t, "POST", "/claim", map[string]any{"domain": s.domain}))
+	if len(claimed) != 0 {
+		t.Errorf("expected a claimed deployment not to be claimed again, got %+v", claimed)
+	}
+	s.decode(t, "GET /agent/pending", http.StatusOK, &pending)(s.agent(t, "GET", "/pending?domain="+s.domain, nil))
+	if len(pending) != 0 {
+		t.Errorf("expected a claimed deployment not to be pending, got %+v", pending)
+	}
+
+	if status, _ := s.agent(t, "POST", "/claim", map[string]any{"limit": 101}); status != http.StatusBadRequest && status != http.StatusUnprocessableEntity {
+		t.Errorf("POST /agent/claim with limit 101: expected 400 or 422, got %d", status)
+	}
+}
+
+// testFetchAndLogs checks fetching the claimed deployment and uploading its
+// log in order, with retried chunks accepted
+func (s *suite) testFetchAndLogs(t *testing.T) {
+	d := s.web
+
+	status, resp := s.agent(t, "GET", "/deployments/"+d.ID, nil)
+	var fetched Deployment
+	s.decode(t, "GET /agent/deployments/{id}", http.StatusOK, &fetched)(status, resp)
+	checkFields(t, fetched, d)
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("GET /agent/deployments/{id}: expected Cache-Control no-store, got %q", cc)
+	}
+
+	logs := "/deployments/" + d.ID + "/logs"
+	chunk := map[string]any{"seq": 0, "content": "pulling image\n"}
+	for _, attempt := range []string{"first upload", "retried upload"} {
+		if status, _ := s.agent(t, "POST", logs, chunk); status != http.StatusCreated {
+			t.Errorf("POST /agent%s seq 0 (%s): expected 201, got %d", logs, attempt, status)
+		}
+	}
+	if status, _ := s.agent(t, "POST", logs, map[string]any{"seq": 2, "content": "skipped\n"}); status != http.StatusConflict {
+		t.Errorf("POST /agent%s with a skipped seq: expected 409, got %d", logs, status)
+	}
+	if status, _ := s.agent(t, "GET", "/deployments/00000000-0000-4000-8000-000000000000", nil); status != http.StatusNotFound {
+		t.Errorf("GET /agent/deployments/{id} of an unknown deployment: expected 404, got %d", status)
+	}
+}
+
+// testReportDeployed checks reporting the rollout's outcome with optimistic
+// concurrency, and reporting what runs afterwards
+func (s *suite) testReportDeployed(t *testing.T) {
+	d := s.web
+	path := "/api/v1/deployments/" + d.ID + "/status"
+	body := map[string]any{"status": "deployed"}
+
+	if status, _ := s.do(t, "PATCH", path, s.APIToken, body, nil); status != http.StatusPreconditionRequired {
+		t.Errorf("PATCH %s without If-Match: expected 428, got %d", path, status)
+	}
+	if status, _ := s.do(t, "PATCH", path, s.APIToken, body, map[string]string{"If-Match": `"stale"`}); status != http.StatusPreconditionFailed {
+		t.Errorf("PATCH %s with a stale If-Match: expected 412, got %d", path, status)
+	}
+
+	var updated Deployment
+	s.decode(t, "PATCH "+path, http.StatusOK, &updated)(s.do(t, "PATCH", path, s.APIToken, body, map[string]string{"If-Match": s.etag(t, d.ID)}))
+	if updated.Status != "deployed" || updated.DeployedAt == nil {
+		t.Fatalf("expected the deployment to be deployed with deployed_at set, got %+v", updated)
+	}
+
+	observed := "/apps/" + s.domain + "/web/observed"
+	var comparison struct {
+		State string `json:"state"`
+	}
+	report := map[string]any{"deployment_id": d.ID, "docker_image": d.DockerImage, "replicas": 1}
+	s.decode(t, "POST /agent"+observed, http.StatusOK, &comparison)(s.agent(t, "POST", observed, report))
+	if comparison.State != "in_sync" {
+		t.Errorf("POST /agent%s of the deployed version: expected state in_sync, got %q", observed, comparison.State)
+	}
+}
+
+// testReportFailed checks that a failed rollout keeps the reported reason
+func (s *suite) testReportFailed(t *testing.T) {
+	pushed := s.push(t, "web", "nginx:1.26")
+	if pushed.Version != 2 {
+		t.Fatalf("expected version 2, got %+v", pushed)
+	}
+
+	var claimed []Deployment
+	s.decode(t, "POST /agent/claim", http.StatusOK, &claimed)(s.agent(t, "POST", "/claim", map[string]any{"domain": s.domain}))
+	if len(claimed) != 1 || claimed[0].ID != pushed.ID {
+		t.Fatalf("expected to claim version 2, got %+v", claimed)
+	}
+
+	path := "/api/v1/deployments/" + pushed.ID + "/status"
+	body := map[string]any{"status": "failed", "error_code": "image_pull_error", "error_message": "manifest unknown"}
+	var updated Deployment
+	s.decode(t, "PATCH "+path, http.StatusOK, &updated)(s.do(t, "PATCH", path, s.APIToken, body, map[string]string{"If-Match": "*"}))
+	if updated.Status != "failed" || updated.Failure == nil || updated.Failure.Code != "image_pull_error" || updated.Failure.Message != "manifest unknown" {
+		t.Errorf("expected the deployment to fail with the reported reason, got %+v", updated)
+	}
+
+	bad := map[string]any{"status": "deployed", "error_code": "image_pull_error"}
+	if status, _ := s.do(t, "PATCH", path, s.APIToken, bad, map[string]string{"If-Match": "*"}); status != http.StatusBadRequest {
+		t.Errorf("PATCH %s with an error code on deployed: expected 400, got %d", path, status)
+	}
+}
+
+// push creates a version of an app in the run's domain
+func (s *suite) push(t *testing.T, appName, image string) Deployment {
+	t.Helper()
+	batch := []map[string]any{{"domain": s.domain, "app_name": appName, "docker_image": image, "port": 8080, "env": []string{"MODE=conformance"}}}
+	var result struct {
+		Created []Deployment `json:"created_deployments"`
+	}
+	s.decode(t, "POST /api/v1/push", http.StatusCreated, &result)(s.do(t, "POST", "/api/v1/push", s.APIToken, batch, nil))
+	if len(result.Created) != 1 {
+		t.Fatalf("POST /api/v1/push: expected 1 created deployment, got %+v", result.Created)
+	}
+	return result.Created[0]
+}
+
+// etag gets a deployment's current ETag
+func (s *suite) etag(t *testing.T, id string) string {
+	t.Helper()
+	status, resp := s.do(t, "GET", "/api/v1/deployments/"+id, s.APIToken, nil, nil)
+	etag := resp.Header.Get("ETag")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("GET /api/v1/deployments/%s: expected 200 with an ETag, got %d %q", id, status, etag)
+	}
+	return etag
+}
+
+// agent sends a request to an agent route with the agent token
+func (s *suite) agent(t *testing.T, method, path string, body any) (int, *response) {
+	t.Helper()
+	return s.do(t, method, "/api/v1/agent"+path, s.AgentToken, body, nil)
+}
+
+// response is a received response with its body read
+type response struct {
+	Header http.Header
+	Body   []byte
+}
+
+// do sends a request and reads the whole response
+func (s *suite) do(t *testing.T, method, path, token string, body any, headers map[string]string) (int, *response) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.BaseURL+path, reader)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("X-Agent-ID", s.AgentID)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, &response{Header: resp.Header, Body: data}
+}
+
+// decode returns a function checking a response's status and decoding its
+// data into v, so it can wrap a call to do or agent
+func (s *suite) decode(t *testing.T, call string, want int, v any) func(int, *response) {
+	return func(status int, resp *response) {
+		t.Helper()
+		if status != want {
+			t.Fatalf("%s: expected %d, got %d: %s", call, want, status, resp.Body)
+		}
+		var env envelope
+		if err := json.Unmarshal(resp.Body, &env); err != nil || !env.Success {
+			t.Fatalf("%s: expected a successful response envelope, got %s", call, resp.Body)
+		}
+		if err := json.Unmarshal(env.Data, v); err != nil {
+			t.Fatalf("%s: unexpected data %s: %v", call, env.Data, err)
+		}
+	}
+}
+
+// checkFields checks that got describes the same version as want
+func checkFields(t *testing.T, got, want Deployment) {
+	t.Helper()
+	if got.ID != want.ID || got.Domain != want.Domain || got.AppName != want.AppName || got.DockerImage != want.DockerImage ||
+		got.Port != want.Port || got.Version != want.Version || fmt.Sprint(got.Env) != fmt.Sprint(want.Env) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
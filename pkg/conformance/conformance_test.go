@@ -0,0 +1,90 @@
+package conformance_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deployment-controller/internal/config"
+	"deployment-controller/internal/handlers"
+	"deployment-controller/internal/memstore"
+	"deployment-controller/internal/testutil"
+	"deployment-controller/pkg/conformance"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiToken   = "conformance-api-token"
+	agentToken = "conformance-agent-token"
+)
+
+// serve starts a controller serving the routes the suite exercises, with
+// the API and agent tokens checked as the server does
+func serve(t *testing.T, h *handlers.Handler) conformance.Target {
+	requireToken := func(token string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if c.GetHeader("Authorization") != "Bearer "+token {
+				handlers.RespondError(c, http.StatusUnauthorized, "Invalid token")
+				c.Abort()
+				return
+			}
+			c.Set(handlers.ActorKey, "agent:"+c.GetHeader(handlers.AgentIDHeader))
+		}
+	}
+
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	api := v1.Group("", requireToken(apiToken))
+	api.POST("/push", h.Push)
+	api.GET("/deployments/:id", h.GetDeployment)
+	api.PATCH("/deployments/:id/status", h.UpdateDeploymentStatus)
+
+	agent := v1.Group("/agent", requireToken(agentToken))
+	agent.GET("/deployments/:id", h.GetAgentDeployment)
+	agent.GET("/pending", h.ListPendingDeployments)
+	agent.POST("/claim", h.ClaimDeployments)
+	agent.POST("/apps/:domain/:app_name/observed", h.ReportObservedState)
+	agent.POST("/deployments/:id/logs", h.UploadDeploymentLog)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return conformance.Target{BaseURL: server.URL, APIToken: apiToken, AgentToken: agentToken, Client: server.Client()}
+}
+
+func TestConformance(t *testing.T) {
+	if url := os.Getenv("CONFORMANCE_URL"); url != "" {
+		conformance.Run(t, conformance.Target{
+			BaseURL:    url,
+			APIToken:   os.Getenv("CONFORMANCE_API_TOKEN"),
+			AgentToken: os.Getenv("CONFORMANCE_AGENT_TOKEN"),
+		})
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("security:\n  encryption_key: conformance-test-key\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store, err := memstore.New(cfg.Database.IDVersion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	conformance.Run(t, serve(t, handlers.New(store, logger, cfg)))
+}
+
+func TestIntegrationConformance(t *testing.T) {
+	env := testutil.New(t, nil)
+	conformance.Run(t, serve(t, env.Handler))
+}